@@ -4,18 +4,26 @@ import (
 	"context"
 	"crypto/tls"
 	"database/sql"
+	"encoding/json"
 	"flag"
+	"fmt"
 	"log"
 	"net/http"
 	"os"
 	"os/signal"
+	"sync"
 	"syscall"
 	"time"
 
+	"github.com/redis/go-redis/v9"
+
 	"llmproxy/internal/admin"
+	"llmproxy/internal/auth"
 	"llmproxy/internal/auth/pipeline"
+	"llmproxy/internal/billing"
 	"llmproxy/internal/config"
 	"llmproxy/internal/database"
+	"llmproxy/internal/discovery"
 	"llmproxy/internal/hooks"
 	"llmproxy/internal/lb"
 	"llmproxy/internal/metrics"
@@ -23,14 +31,25 @@ import (
 	"llmproxy/internal/proxy"
 	"llmproxy/internal/ratelimit"
 	"llmproxy/internal/routing"
+	"llmproxy/internal/scripting"
 	"llmproxy/internal/storage"
+	"llmproxy/internal/tracing"
 )
 
+// defaultShutdownTimeout 关闭时等待在途请求完成的默认最长时间
+const defaultShutdownTimeout = 10 * time.Second
+
 func main() {
 	// 解析命令行参数
 	configPath := flag.String("config", "config.yaml", "配置文件路径")
+	validateOnly := flag.Bool("validate", false, "仅校验配置文件，不启动服务")
 	flag.Parse()
 
+	// 仅校验配置
+	if *validateOnly {
+		os.Exit(validateConfig(*configPath))
+	}
+
 	// 加载配置
 	cfg, err := config.Load(*configPath)
 	if err != nil {
@@ -38,6 +57,14 @@ func main() {
 	}
 
 	log.Printf("LLMProxy 启动中...")
+
+	// 初始化分布式追踪（未启用时为空操作）
+	if err := tracing.Init(cfg.Tracing); err != nil {
+		log.Fatalf("初始化追踪失败: %v", err)
+	}
+	if tracing.Enabled() {
+		log.Printf("分布式追踪已启用: %s", cfg.Tracing.Endpoint)
+	}
 	log.Printf("监听地址: %s", cfg.GetListen())
 
 	// 初始化存储管理器
@@ -51,6 +78,13 @@ func main() {
 		}
 	}()
 
+	// 启动存储连接健康检查（断线时记录日志并清理连接池，恢复后自动重连）
+	if cfg.Storage != nil && cfg.Storage.HealthCheck != nil && cfg.Storage.HealthCheck.Enabled {
+		healthCtx, cancelHealth := context.WithCancel(context.Background())
+		defer cancelHealth()
+		go storageManager.StartHealthCheck(healthCtx, cfg.Storage.HealthCheck)
+	}
+
 	// 初始化数据库 Store（如果启用服务发现）
 	var dbStore *database.Store
 	if cfg.Discovery != nil && cfg.Discovery.Enabled {
@@ -66,7 +100,9 @@ func main() {
 						driver = dbCfg.Driver
 					}
 					var err error
-					dbStore, err = database.NewStoreFromDBWithDriver(dbConn, source.Database.Table, driver)
+					// 服务同步查询使用只读副本（如已配置），请求日志写入主库
+					readConn := storageManager.GetReadDatabase(source.Database.Storage)
+					dbStore, err = database.NewStoreFromDBWithReplica(dbConn, readConn, driver, source.Database)
 					if err != nil {
 						log.Fatalf("初始化数据库 Store 失败: %v", err)
 					}
@@ -78,14 +114,21 @@ func main() {
 		}
 	}
 
-	// 后端配置：优先使用数据库中的服务（如果有），否则使用配置文件中的 backends
-	allBackends := cfg.Backends
+	// 其他类型的发现源（static / http / consul / kubernetes / etcd / dns）由服务发现管理器定期同步
+	discoveryManager := newDiscoveryManager(cfg.Discovery, storageManager, cfg.Storage)
+
+	// 后端配置：优先使用服务发现的后端（数据库和其他发现源合并），否则使用配置文件中的 backends
+	discovered := &discoveredBackends{sets: make(map[string][]*config.Backend)}
 	if dbStore != nil {
-		dbBackends := dbStore.GetBackends()
-		if len(dbBackends) > 0 {
-			allBackends = dbBackends
-			log.Printf("使用数据库服务发现: %d 个后端", len(dbBackends))
-		}
+		discovered.sets[backendSourceDatabase] = dbStore.GetBackends()
+	}
+	if discoveryManager != nil {
+		discovered.sets[backendSourceDiscovery] = discoveryManager.GetBackends()
+	}
+	allBackends := cfg.Backends
+	if merged := discovered.merged(); len(merged) > 0 {
+		allBackends = merged
+		log.Printf("使用服务发现: %d 个后端", len(merged))
 	}
 	log.Printf("后端数量: %d", len(allBackends))
 
@@ -100,6 +143,7 @@ func main() {
 			weight = 1
 		}
 		backends = append(backends, &lb.Backend{
+			Name:    b.Name,
 			URL:     b.URL,
 			Weight:  weight,
 			Healthy: true,
@@ -112,25 +156,51 @@ func main() {
 		strategy = cfg.Routing.LoadBalance
 	}
 
-	switch strategy {
-	case "least_connections":
-		loadBalancer = lb.NewLeastConnections(allBackends, cfg.HealthCheck)
-		log.Println("负载均衡策略: 最少连接数")
-	case "latency_based":
-		loadBalancer = lb.NewLatencyBased(allBackends, cfg.HealthCheck)
-		log.Println("负载均衡策略: 延迟优先")
-	case "weighted":
-		loadBalancer = lb.NewWeighted(allBackends, cfg.HealthCheck)
-		log.Println("负载均衡策略: 加权轮询")
-	default:
-		loadBalancer = lb.NewRoundRobin(allBackends, cfg.HealthCheck)
-		log.Println("负载均衡策略: 轮询")
+	// 按 group 拆分后端：未分组的后端组成默认后端池（全部分组时默认池为所有后端）
+	defaultBackends, groupBackends := splitBackends(allBackends)
+
+	var strategyName string
+	loadBalancer, strategyName = newLoadBalancer(strategy, defaultBackends, cfg)
+	log.Printf("负载均衡策略: %s", strategyName)
+
+	// 为每个后端组创建独立的负载均衡器（model_routes 可为后端组单独指定策略）
+	groupBalancers := make(map[string]lb.LoadBalancer, len(groupBackends))
+	for name, list := range groupBackends {
+		groupStrategy := strategy
+		if s := cfg.Routing.GroupStrategy(name); s != "" {
+			groupStrategy = s
+		}
+		var groupStrategyName string
+		groupBalancers[name], groupStrategyName = newLoadBalancer(groupStrategy, list, cfg)
+		log.Printf("后端组 [%s]: %d 个后端，策略: %s", name, len(list), groupStrategyName)
+	}
+
+	// 按配置创建指标（自定义延迟分桶）
+	if cfg.Metrics != nil {
+		metrics.Init(cfg.Metrics)
+	}
+
+	// 指标标签基数控制
+	if cfg.Metrics != nil && (cfg.Metrics.NormalizePaths || cfg.Metrics.BackendLabel != "") {
+		metrics.SetLabelOptions(cfg.Metrics.NormalizePaths, cfg.Metrics.BackendLabel)
+	}
+	if cfg.Metrics != nil {
+		metrics.SetModelLabels(cfg.Metrics.ModelLabels, cfg.Metrics.MaxModelLabels)
+	}
+
+	// 后端选择原因调试日志
+	if cfg.Routing != nil && cfg.Routing.DecisionLog {
+		lb.SetDecisionLog(true)
+		log.Println("负载均衡选择原因日志已启用")
 	}
 
 	// 创建智能路由器（如果配置了）
 	var router *routing.Router
 	if cfg.Routing != nil && cfg.Routing.Enabled {
 		router = routing.NewRouter(cfg.Routing, loadBalancer, backends)
+		router.SetGroups(groupBalancers)
+		router.SetBackendLimits(allBackends)
+		router.SetUpstream(cfg.Upstream)
 		log.Println("智能路由已启用")
 		if cfg.Routing.Retry != nil && cfg.Routing.Retry.Enabled {
 			log.Printf("自动重试已启用: 最大 %d 次", cfg.Routing.Retry.MaxRetries)
@@ -138,6 +208,28 @@ func main() {
 		if len(cfg.Routing.Fallback) > 0 {
 			log.Printf("故障转移规则: %d 个", len(cfg.Routing.Fallback))
 		}
+		if len(cfg.Routing.ModelRoutes) > 0 {
+			log.Printf("模型路由规则: %d 个", len(cfg.Routing.ModelRoutes))
+		}
+	}
+
+	// 服务发现的后端集合变化时同步到负载均衡器和路由器（合并结果为空时保留当前后端）
+	discovered.apply = func(backends []*config.Backend) {
+		updateBalancers(backends, loadBalancer, groupBalancers)
+		if router != nil {
+			router.UpdateBackends(backends)
+		}
+	}
+	if dbStore != nil {
+		dbStore.OnBackendsChange(func(backends []*config.Backend) {
+			discovered.update(backendSourceDatabase, backends)
+		})
+	}
+	if discoveryManager != nil {
+		discoveryManager.OnChange(func(backends []*config.Backend) {
+			discovered.update(backendSourceDiscovery, backends)
+		})
+		discoveryManager.Start()
 	}
 
 	// 初始化 Admin API（如果启用）
@@ -159,15 +251,41 @@ func main() {
 		}
 		log.Printf("KeyStore 已初始化: %s", dbPath)
 
+		// Key 哈希存储
+		if cfg.Admin.HashKeys {
+			keyStore.SetHashKeys(true)
+			log.Println("API Key 哈希存储已启用")
+			if cfg.Admin.MigratePlaintextKeys {
+				if _, err := keyStore.MigratePlaintextKeys(); err != nil {
+					log.Fatalf("迁移明文 Key 失败: %v", err)
+				}
+			}
+		}
+
+		// Key 生命周期事件
+		if notifier := admin.NewEventNotifier(cfg.Admin.Events); notifier != nil {
+			keyStore.SetEventNotifier(notifier)
+			log.Printf("Key 事件 Webhook 已启用: %s", cfg.Admin.Events.Webhook.URL)
+		}
+
+		// 按 quota_reset_period 周期重置额度
+		quotaCtx, cancelQuota := context.WithCancel(context.Background())
+		defer cancelQuota()
+		keyStore.StartQuotaResetJob(quotaCtx, time.Minute)
+
 		// 创建 Admin Server
 		if cfg.Admin.Token != "" {
 			listen := cfg.Admin.Listen
 			if listen == "" {
 				// 未指定单独端口，后续将挂载到主服务器
 				adminServer = admin.NewServer(keyStore, cfg.Admin.Token, "")
+				adminServer.SetConfig(cfg)
+				adminServer.SetLockout(cfg.Admin.LockoutThreshold, cfg.Admin.LockoutWindow, cfg.Admin.LockoutDuration)
 				log.Println("Admin API 将挂载到主服务器")
 			} else {
 				adminServer = admin.NewServer(keyStore, cfg.Admin.Token, listen)
+				adminServer.SetConfig(cfg)
+				adminServer.SetLockout(cfg.Admin.LockoutThreshold, cfg.Admin.LockoutWindow, cfg.Admin.LockoutDuration)
 				go func() {
 					if err := adminServer.Start(); err != nil && err != http.ErrServerClosed {
 						log.Printf("Admin API 服务器启动失败: %v", err)
@@ -191,6 +309,63 @@ func main() {
 			log.Fatalf("创建鉴权管道失败: %v", err)
 		}
 		log.Println("鉴权管道已启用")
+
+		// 鉴权决策审计日志
+		if audit := cfg.Auth.Audit; audit != nil && audit.Enabled {
+			var auditDB *sql.DB
+			driver := ""
+			if audit.Output == "database" {
+				auditDB = storageManager.GetDatabase(audit.Storage)
+				if dbCfg := cfg.Storage.GetDatabase(audit.Storage); dbCfg != nil {
+					driver = dbCfg.Driver
+				}
+			}
+			auditLogger, err := pipeline.NewAuditLogger(audit, auditDB, driver)
+			if err != nil {
+				log.Fatalf("创建鉴权审计日志失败: %v", err)
+			}
+			pipelineExecutor.SetAuditLogger(auditLogger)
+		}
+
+		// Admin API 鉴权测试（/admin/auth/test）
+		if adminServer != nil {
+			adminServer.SetAuthTester(pipelineExecutor.TestAuth)
+		}
+	}
+
+	// 创建每日消费统计器（如果启用计费）
+	var spendTracker *billing.SpendTracker
+	if cfg.Billing != nil && cfg.Billing.Enabled {
+		var redisClient redis.UniversalClient
+		if cfg.Billing.Redis != "" {
+			redisClient = storageManager.GetCache(cfg.Billing.Redis)
+			if redisClient == nil {
+				log.Printf("警告: Redis 缓存 [%s] 未找到，每日消费降级为进程内计数", cfg.Billing.Redis)
+			}
+		}
+		var err error
+		spendTracker, err = billing.NewSpendTracker(cfg.Billing, redisClient)
+		if err != nil {
+			log.Fatalf("创建每日消费统计器失败: %v", err)
+		}
+		if pipelineExecutor != nil {
+			pipelineExecutor.SetSpendChecker(spendTracker)
+		}
+		log.Printf("计费已启用: %d 个模型价格，下次重置: %s", len(cfg.Billing.Pricing), spendTracker.NextReset().Format(time.RFC3339))
+	}
+
+	// 创建 Idempotency-Key 响应缓存（如果启用）
+	var idempotency *proxy.IdempotencyCache
+	if cfg.Server.Idempotency != nil && cfg.Server.Idempotency.Enabled {
+		var redisClient redis.UniversalClient
+		if cfg.Server.Idempotency.Redis != "" {
+			redisClient = storageManager.GetCache(cfg.Server.Idempotency.Redis)
+			if redisClient == nil {
+				log.Printf("警告: Redis 缓存 [%s] 未找到，幂等键降级为进程内缓存", cfg.Server.Idempotency.Redis)
+			}
+		}
+		idempotency = proxy.NewIdempotencyCache(cfg.Server.Idempotency, redisClient)
+		log.Println("Idempotency-Key 已启用")
 	}
 
 	// 初始化用量上报器（支持多个）
@@ -210,15 +385,18 @@ func main() {
 						if dbCfg := cfg.Storage.GetDatabase(reporter.Database.Storage); dbCfg != nil {
 							driver = dbCfg.Driver
 						}
-						if err := proxy.InitUsageDatabaseWithConnection(reporter.Name, dbConn, driver, reporter.Database.Table); err != nil {
+						if err := proxy.InitUsageDatabaseWithConnection(reporter.Name, dbConn, driver, reporter.Database); err != nil {
 							log.Fatalf("初始化用量数据库 [%s] 失败: %v", reporter.Name, err)
 						}
 					} else {
-						log.Printf("警告: 用量数据库 [%s] 未找到存储连接: %s", reporter.Name, reporter.Database.Storage)
+						log.Printf("警告: 用量数据库 [%s] 未找到存储连接: %s，该上报器已禁用", reporter.Name, reporter.Database.Storage)
 					}
 				}
 			case "webhook":
 				if reporter.Webhook != nil {
+					if err := proxy.InitUsageWebhook(reporter); err != nil {
+						log.Fatalf("初始化用量 Webhook [%s] 失败: %v", reporter.Name, err)
+					}
 					log.Printf("用量 Webhook [%s] 已配置: %s", reporter.Name, reporter.Webhook.URL)
 				}
 			case "builtin":
@@ -233,6 +411,9 @@ func main() {
 						log.Printf("警告: 初始化内置用量存储失败: %v", err)
 					} else {
 						proxy.InitBuiltinUsage(usageStore)
+						if adminServer != nil {
+							adminServer.SetUsageStore(usageStore)
+						}
 						log.Printf("内置用量存储 [%s] 已启用 (保留: %d 天)", reporter.Name, retentionDays)
 					}
 				} else {
@@ -281,9 +462,18 @@ func main() {
 	// 创建限流器（如果启用限流）
 	var limiter ratelimit.RateLimiter
 	if cfg.RateLimit != nil && cfg.RateLimit.Enabled {
+		slidingWindow := cfg.RateLimit.Algorithm == config.RateLimitSlidingWindow
+		defaults := ratelimit.DefaultLimit(cfg.RateLimit)
+		newMemoryLimiter := func() ratelimit.RateLimiter {
+			if slidingWindow {
+				return ratelimit.NewMemorySlidingWindowLimiter(defaults)
+			}
+			return ratelimit.NewMemoryRateLimiter(defaults)
+		}
+
 		switch cfg.RateLimit.Storage {
 		case "memory", "":
-			limiter = ratelimit.NewMemoryRateLimiter()
+			limiter = newMemoryLimiter()
 			log.Println("限流已启用: 内存存储")
 		case "redis":
 			// 从存储管理器获取 Redis 连接
@@ -292,16 +482,22 @@ func main() {
 				cacheName = "default"
 			}
 			redisClient := storageManager.GetCache(cacheName)
-			if redisClient != nil {
-				limiter = ratelimit.NewRedisRateLimiter(redisClient, "llmproxy:ratelimit:")
+			if redisClient == nil {
+				log.Printf("警告: Redis 缓存 [%s] 未找到，降级为内存限流", cacheName)
+				limiter = newMemoryLimiter()
+			} else if slidingWindow {
+				limiter = ratelimit.NewRedisSlidingWindowLimiter(redisClient, "llmproxy:ratelimit:", defaults)
 				log.Println("限流已启用: Redis 存储")
 			} else {
-				log.Printf("警告: Redis 缓存 [%s] 未找到，降级为内存限流", cacheName)
-				limiter = ratelimit.NewMemoryRateLimiter()
+				limiter = ratelimit.NewRedisRateLimiter(redisClient, "llmproxy:ratelimit:", defaults)
+				log.Println("限流已启用: Redis 存储")
 			}
 		default:
 			log.Printf("警告: 不支持的限流存储方式: %s, 使用内存限流", cfg.RateLimit.Storage)
-			limiter = ratelimit.NewMemoryRateLimiter()
+			limiter = newMemoryLimiter()
+		}
+		if slidingWindow {
+			log.Println("限流算法: 滑动窗口（不允许突发）")
 		}
 
 		if cfg.RateLimit.Global != nil && cfg.RateLimit.Global.Enabled {
@@ -316,35 +512,82 @@ func main() {
 	mux := http.NewServeMux()
 
 	// 注册 Prometheus metrics 端点
-	mux.HandleFunc("/metrics", metrics.Handler)
-	log.Println("Prometheus metrics 端点: /metrics")
-
-	// 注册健康检查端点
-	mux.HandleFunc("/health", func(w http.ResponseWriter, r *http.Request) {
+	metricsPath := "/metrics"
+	if cfg.Metrics != nil && cfg.Metrics.Path != "" {
+		metricsPath = cfg.Metrics.Path
+	}
+	mux.HandleFunc(metricsPath, metrics.Handler)
+	log.Printf("Prometheus metrics 端点: %s", metricsPath)
+
+	// 注册存活检查端点（?detail=1 时返回存储连接状态）
+	// 只表示进程在运行，后端或存储不可用不影响结果，避免 Kubernetes 误重启实例
+	health := func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Query().Get("detail") != "" {
+			status := "ok"
+			if !storageManager.Healthy() {
+				status = "degraded"
+			}
+			w.Header().Set("Content-Type", "application/json")
+			_ = json.NewEncoder(w).Encode(map[string]interface{}{
+				"status":  status,
+				"storage": storageManager.Status(),
+			})
+			return
+		}
 		w.WriteHeader(http.StatusOK)
 		_, _ = w.Write([]byte("OK"))
-	})
-	log.Println("健康检查端点: /health")
+	}
+	mux.HandleFunc("/health", health)
+	mux.HandleFunc("/livez", health)
+	log.Println("存活检查端点: /health, /livez")
+
+	// 注册就绪检查端点：收到退出信号、健康后端不足或必需的存储连接不可用时返回 503，
+	// 便于上游 LB 摘除流量
+	readiness := middleware.NewReadiness()
+	if rc := cfg.Server.Readiness; rc != nil {
+		if rc.MinHealthyBackends > 0 {
+			pools := []lb.LoadBalancer{loadBalancer}
+			for _, balancer := range groupBalancers {
+				pools = append(pools, balancer)
+			}
+			readiness.AddCheck("backends", middleware.BackendsCheck(rc.MinHealthyBackends, pools...))
+		}
+		if len(rc.Storage) > 0 {
+			readiness.AddCheck("storage", middleware.StorageCheck(storageManager, rc.Storage))
+		}
+	}
+	mux.HandleFunc("/ready", readiness.Handler)
+	mux.HandleFunc("/readyz", readiness.Handler)
+	log.Println("就绪检查端点: /ready, /readyz")
 
 	// 注册 Admin API 路由（如果未配置单独端口）
 	if adminServer != nil && (cfg.Admin == nil || cfg.Admin.Listen == "") {
 		adminServer.RegisterRoutes(mux)
 	}
 
+	// 内置鉴权使用 Admin KeyStore 中的额度：请求完成后扣减 used_quota
+	var quotaStore auth.KeyStore
+	if keyStore != nil && usesBuiltinAuth(cfg.Auth) {
+		quotaStore = auth.NewAdminKeyStore(keyStore)
+		log.Println("内置鉴权额度扣减已启用")
+	}
+
 	// 创建代理处理器
 	var proxyHandler http.HandlerFunc
 	if dbStore != nil {
-		proxyHandler = proxy.NewDatabaseHandler(cfg, loadBalancer, router, nil, limiter, dbStore)
+		proxyHandler = proxy.NewDatabaseHandler(cfg, loadBalancer, router, quotaStore, limiter, dbStore, idempotency)
 		log.Println("使用数据库集成处理器")
 	} else {
 		proxyHandler = proxy.NewHandlerWithOptions(&proxy.HandlerOptions{
 			Config:       cfg,
 			LoadBalancer: loadBalancer,
 			Router:       router,
-			KeyStore:     nil,
+			KeyStore:     quotaStore,
 			Limiter:      limiter,
 			Logger:       logger,
 			Hooks:        hooksExecutor,
+			Spend:        spendTracker,
+			Idempotency:  idempotency,
 		})
 	}
 
@@ -353,24 +596,53 @@ func main() {
 
 	// 限流中间件（最外层）
 	if limiter != nil && cfg.RateLimit != nil && cfg.RateLimit.Enabled {
-		handler = ratelimit.Middleware(limiter, cfg.RateLimit, handler)
+		if logger != nil {
+			handler = ratelimit.MiddlewareWithDenialLog(limiter, cfg.RateLimit, logger, handler)
+		} else {
+			handler = ratelimit.Middleware(limiter, cfg.RateLimit, handler)
+		}
 	}
 
 	// 鉴权中间件
 	if pipelineExecutor != nil {
+		if logger != nil {
+			pipelineExecutor.SetDenialLogger(logger)
+		}
 		handler = pipeline.Middleware(pipelineExecutor, handler)
 	}
 
+	// 追踪中间件（根 Span 包含鉴权和限流）
+	if tracing.Enabled() {
+		handler = tracing.Middleware(handler)
+	}
+
 	// 注册代理处理器
 	mux.HandleFunc("/", handler)
 	log.Println("代理端点: /v1/chat/completions, /v1/completions")
 
 	// 启动负载均衡器健康检查
 	if cfg.HealthCheck != nil && cfg.HealthCheck.Enabled {
+		if sc := cfg.HealthCheck.Script; sc != nil && sc.Enabled {
+			healthScript, err := scripting.NewHealthCheckScript(&scripting.EngineConfig{
+				Script:     sc.Script,
+				ScriptFile: sc.Path,
+				Timeout:    sc.Timeout,
+				MaxMemory:  scripting.MB(sc.MaxMemory),
+			})
+			if err != nil {
+				log.Fatalf("初始化健康检查脚本失败: %v", err)
+			}
+			lb.SetHealthScript(healthScript)
+			log.Println("健康检查脚本已启用")
+		}
+
 		ctx, cancel := context.WithCancel(context.Background())
 		defer cancel()
 
 		go loadBalancer.Start(ctx)
+		for _, balancer := range groupBalancers {
+			go balancer.Start(ctx)
+		}
 	}
 
 	// 应用 CORS 中间件（如果启用）
@@ -380,6 +652,15 @@ func main() {
 		log.Println("CORS 已启用")
 	}
 
+	// 将已校验的客户端证书 CN 传给鉴权和钩子（双向 TLS）
+	if cfg.Server != nil && cfg.Server.TLS != nil && cfg.Server.TLS.Enabled && cfg.Server.TLS.ClientCNHeader != "" {
+		finalHandler = middleware.ClientCertMiddleware(cfg.Server.TLS.ClientCNHeader, finalHandler)
+	}
+
+	// 关闭时排空在途请求：统计在途请求数，排空期间响应带 Connection: close
+	drainer := middleware.NewDrainer()
+	finalHandler = drainer.Middleware(finalHandler)
+
 	// 创建 HTTP 服务器
 	server := &http.Server{
 		Addr:         cfg.GetListen(),
@@ -395,17 +676,21 @@ func main() {
 	// 配置 TLS（如果启用）
 	tlsEnabled := cfg.Server != nil && cfg.Server.TLS != nil && cfg.Server.TLS.Enabled
 	if tlsEnabled {
-		tlsCfg := &tls.Config{
-			MinVersion: tls.VersionTLS12,
+		tlsCfg, err := middleware.ServerTLSConfig(cfg.Server.TLS)
+		if err != nil {
+			log.Fatalf("TLS 配置错误: %v", err)
 		}
 		server.TLSConfig = tlsCfg
+		if tlsCfg.ClientAuth != tls.NoClientCert {
+			log.Printf("客户端证书认证已启用: %s", cfg.Server.TLS.ClientAuth)
+		}
 	}
 
 	// 启动服务器（在 goroutine 中）
 	go func() {
 		if tlsEnabled {
 			log.Printf("LLMProxy 已启动 (HTTPS)，监听 %s", cfg.GetListen())
-			if err := server.ListenAndServeTLS(cfg.Server.TLS.CertFile, cfg.Server.TLS.KeyFile); err != nil && err != http.ErrServerClosed {
+			if err := server.ListenAndServeTLS("", ""); err != nil && err != http.ErrServerClosed {
 				log.Fatalf("服务器启动失败: %v", err)
 			}
 		} else {
@@ -421,13 +706,28 @@ func main() {
 	signal.Notify(quit, syscall.SIGINT, syscall.SIGTERM)
 	<-quit
 
-	log.Println("正在关闭服务器...")
+	// 先将就绪状态置为不可用，等待上游 LB 感知后再关闭
+	readiness.Stop()
+	drainer.Start()
+	if cfg.Server != nil && cfg.Server.ShutdownDelay > 0 {
+		log.Printf("就绪状态已置为不可用，等待 %v 后关闭...", cfg.Server.ShutdownDelay)
+		time.Sleep(cfg.Server.ShutdownDelay)
+	}
+
+	// 停止接受新连接，等待在途请求（含流式响应）完成，超时后强制断开
+	shutdownTimeout := defaultShutdownTimeout
+	if cfg.Server != nil && cfg.Server.ShutdownTimeout > 0 {
+		shutdownTimeout = cfg.Server.ShutdownTimeout
+	}
+	log.Printf("正在关闭服务器，等待 %d 个在途请求完成（最长 %v）...", drainer.InFlight(), shutdownTimeout)
 
-	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
-	defer cancel()
+	_ = drainer.Shutdown(server, shutdownTimeout)
 
-	if err := server.Shutdown(ctx); err != nil {
-		log.Printf("HTTP 服务器关闭失败: %v", err)
+	// 停止服务发现
+	if discoveryManager != nil {
+		if err := discoveryManager.Close(); err != nil {
+			log.Printf("服务发现关闭失败: %v", err)
+		}
 	}
 
 	// 关闭数据库 Store
@@ -472,5 +772,220 @@ func main() {
 		}
 	}
 
+	// 导出剩余的追踪数据（排空可能已用完关闭超时，使用独立的超时）
+	traceCtx, cancelTrace := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancelTrace()
+	tracing.Shutdown(traceCtx)
+
 	log.Println("服务器已关闭")
 }
+
+// newLoadBalancer 按策略创建负载均衡器
+// 参数：
+//   - strategy: 负载均衡策略
+//   - backends: 后端配置列表
+//   - cfg: 配置对象
+//
+// 返回：
+//   - lb.LoadBalancer: 负载均衡器实例
+//   - string: 策略名称（用于日志）
+func newLoadBalancer(strategy string, backends []*config.Backend, cfg *config.Config) (lb.LoadBalancer, string) {
+	switch strategy {
+	case "least_connections":
+		return lb.NewLeastConnections(backends, cfg.HealthCheck), "最少连接数"
+	case "latency_based":
+		return lb.NewLatencyBased(backends, cfg.HealthCheck), "延迟优先"
+	case "peak_ewma":
+		var decay time.Duration
+		if cfg.Routing.PeakEWMA != nil {
+			decay = cfg.Routing.PeakEWMA.Decay
+		}
+		return lb.NewPeakEWMA(backends, cfg.HealthCheck, decay), "峰值 EWMA"
+	case "weighted":
+		return lb.NewWeighted(backends, cfg.HealthCheck), "加权轮询"
+	case "consistent_hash":
+		virtualNodes := 0
+		if cfg.Routing.ConsistentHash != nil {
+			virtualNodes = cfg.Routing.ConsistentHash.VirtualNodes
+		}
+		return lb.NewConsistentHash(backends, cfg.HealthCheck, virtualNodes), "一致性哈希"
+	case "", "round_robin":
+		return lb.NewRoundRobin(backends, cfg.HealthCheck), "轮询"
+	default:
+		// 策略名拼写错误（如 latency-based）时不能静默降级
+		msg := fmt.Sprintf("不支持的负载均衡策略 %q（可选 round_robin / least_connections / latency_based / peak_ewma / weighted / consistent_hash）", strategy)
+		if cfg.Routing != nil && cfg.Routing.StrictLoadBalance {
+			log.Fatalf("%s", msg)
+		}
+		log.Printf("警告: %s，已回退为轮询", msg)
+		return lb.NewRoundRobin(backends, cfg.HealthCheck), "轮询（回退）"
+	}
+}
+
+// splitBackends 按 group 拆分后端
+// 参数：
+//   - backends: 后端配置列表
+//
+// 返回：
+//   - []*config.Backend: 默认后端池（未分组的后端，全部分组时为所有后端）
+//   - map[string][]*config.Backend: 后端组名 -> 后端列表
+func splitBackends(backends []*config.Backend) ([]*config.Backend, map[string][]*config.Backend) {
+	var defaults []*config.Backend
+	groups := make(map[string][]*config.Backend)
+	for _, b := range backends {
+		if b.Group == "" {
+			defaults = append(defaults, b)
+		} else {
+			groups[b.Group] = append(groups[b.Group], b)
+		}
+	}
+	if len(defaults) == 0 {
+		defaults = backends
+	}
+	return defaults, groups
+}
+
+// 服务发现的后端来源
+const (
+	backendSourceDatabase  = "database"  // 数据库服务发现（database.Store）
+	backendSourceDiscovery = "discovery" // 服务发现管理器（其他类型的发现源）
+)
+
+// discoveredBackends 合并各来源服务发现的后端列表，任一来源变化时同步合并结果
+type discoveredBackends struct {
+	mu    sync.Mutex
+	sets  map[string][]*config.Backend // 来源 -> 最近一次发现的后端列表
+	apply func([]*config.Backend)      // 同步合并后的后端列表
+}
+
+// update 记录来源的最新后端列表，并同步合并结果（合并结果为空时保留当前后端）
+// 参数：
+//   - source: 后端来源
+//   - backends: 该来源最新的后端列表
+func (d *discoveredBackends) update(source string, backends []*config.Backend) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	d.sets[source] = backends
+	merged := d.merged()
+	if len(merged) == 0 {
+		log.Println("服务发现: 没有可用服务，保留当前后端列表")
+		return
+	}
+	if d.apply != nil {
+		d.apply(merged)
+	}
+}
+
+// merged 按数据库、其他发现源的顺序合并后端列表（URL 相同时保留先出现的）
+func (d *discoveredBackends) merged() []*config.Backend {
+	var merged []*config.Backend
+	seen := make(map[string]bool)
+	for _, source := range []string{backendSourceDatabase, backendSourceDiscovery} {
+		for _, b := range d.sets[source] {
+			if !seen[b.URL] {
+				seen[b.URL] = true
+				merged = append(merged, b)
+			}
+		}
+	}
+	return merged
+}
+
+// newDiscoveryManager 为数据库以外的发现源创建服务发现管理器
+// 数据库发现源由 database.Store 同步（同时负责数据库模式的请求处理），不重复加入管理器
+// 参数：
+//   - cfg: 服务发现配置
+//   - storageManager: 存储管理器
+//   - storageCfg: 存储配置
+//
+// 返回：
+//   - *discovery.Manager: 管理器（未启用或没有其他发现源时为 nil）
+func newDiscoveryManager(cfg *config.DiscoveryConfig, storageManager *storage.Manager, storageCfg *config.StorageConfig) *discovery.Manager {
+	if cfg == nil || !cfg.Enabled {
+		return nil
+	}
+	sources := make([]*config.DiscoverySource, 0, len(cfg.Sources))
+	for _, source := range cfg.Sources {
+		if source != nil && source.Enabled && source.Type != "database" {
+			sources = append(sources, source)
+		}
+	}
+	if len(sources) == 0 {
+		return nil
+	}
+
+	managerCfg := *cfg
+	managerCfg.Sources = sources
+	manager, err := discovery.NewManager(&managerCfg, storageManager, storageCfg)
+	if err != nil {
+		log.Printf("警告: 初始化服务发现失败: %v", err)
+		return nil
+	}
+	log.Printf("服务发现已启用: %d 个发现源", len(sources))
+	return manager
+}
+
+// updateBalancers 将服务发现的后端列表同步到负载均衡器
+// 后端组在启动时创建，新出现的后端组需要重启才能生效
+// 参数：
+//   - backends: 最新的后端配置列表
+//   - defaultBalancer: 默认后端池的负载均衡器
+//   - groupBalancers: 后端组名 -> 负载均衡器
+func updateBalancers(backends []*config.Backend, defaultBalancer lb.LoadBalancer, groupBalancers map[string]lb.LoadBalancer) {
+	defaults, groups := splitBackends(backends)
+	defaultBalancer.UpdateBackends(defaults)
+	for name, balancer := range groupBalancers {
+		balancer.UpdateBackends(groups[name])
+	}
+	for name := range groups {
+		if _, ok := groupBalancers[name]; !ok {
+			log.Printf("服务发现: 后端组 [%s] 在启动时不存在，重启后生效", name)
+		}
+	}
+	log.Printf("服务发现: 负载均衡器已更新，共 %d 个后端", len(backends))
+}
+
+// usesBuiltinAuth 判断鉴权管道中是否启用了内置（builtin）提供者
+// 参数：
+//   - authCfg: 鉴权配置
+//
+// 返回：
+//   - bool: 是否启用
+func usesBuiltinAuth(authCfg *config.AuthConfig) bool {
+	if authCfg == nil || !authCfg.Enabled {
+		return false
+	}
+	for _, p := range authCfg.Pipeline {
+		if p != nil && p.Enabled && p.Type == "builtin" {
+			return true
+		}
+	}
+	return false
+}
+
+// validateConfig 加载并校验配置文件，输出校验报告
+// 参数：
+//   - path: 配置文件路径
+//
+// 返回：
+//   - int: 进程退出码，0 表示配置有效
+func validateConfig(path string) int {
+	cfg, err := config.Load(path)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "✗ %s: %v\n", path, err)
+		return 1
+	}
+
+	errs := cfg.Validate()
+	if len(errs) == 0 {
+		fmt.Printf("✓ %s: 配置有效\n", path)
+		return 0
+	}
+
+	fmt.Fprintf(os.Stderr, "✗ %s: 发现 %d 个错误\n", path, len(errs))
+	for _, e := range errs {
+		fmt.Fprintf(os.Stderr, "  - %v\n", e)
+	}
+	return 1
+}
@@ -0,0 +1,15 @@
+-- 健康检查脚本示例
+-- 后端返回 200 但响应体报告降级（如 {"status": "degraded"}）时视为不健康
+
+-- 非 JSON 响应交给 expected_status 判断
+local data = json.decode(response.body)
+if data == nil then
+    return nil
+end
+
+if data.status == "degraded" or data.status == "maintenance" then
+    log.info("后端 " .. backend.url .. " 报告状态: " .. data.status)
+    return false
+end
+
+return data.status == "ok"
@@ -0,0 +1,227 @@
+package admin
+
+import (
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// 审计操作类型
+const (
+	AuditActionCreate     = "create"
+	AuditActionUpdate     = "update"
+	AuditActionDelete     = "delete"
+	AuditActionBulkDelete = "bulk_delete"
+	AuditActionSync       = "sync"
+	AuditActionResetQuota = "reset_quota"
+	AuditActionExport     = "export"
+)
+
+// AuditRecord 审计日志记录
+type AuditRecord struct {
+	ID               int64     `json:"id"`
+	Action           string    `json:"action"`                      // 操作类型
+	Target           string    `json:"target,omitempty"`            // 操作对象（Key 已脱敏）
+	TokenFingerprint string    `json:"token_fingerprint,omitempty"` // Admin Token 指纹（SHA-256 前 12 位）
+	SourceIP         string    `json:"source_ip,omitempty"`         // 来源 IP
+	Detail           string    `json:"detail,omitempty"`            // 补充说明
+	CreatedAt        time.Time `json:"created_at"`
+}
+
+// AuditQueryParams 审计日志查询参数
+type AuditQueryParams struct {
+	Action    string     // 按操作类型筛选
+	StartTime *time.Time // 开始时间
+	EndTime   *time.Time // 结束时间
+	Offset    int        // 偏移量
+	Limit     int        // 限制数量
+}
+
+// AuditStore 审计日志存储
+type AuditStore struct {
+	db *sql.DB
+}
+
+// NewAuditStore 创建审计日志存储
+// 使用与 KeyStore 相同的数据库连接
+func NewAuditStore(db *sql.DB) (*AuditStore, error) {
+	store := &AuditStore{db: db}
+
+	if err := store.initSchema(); err != nil {
+		return nil, fmt.Errorf("初始化审计日志表结构失败: %w", err)
+	}
+	return store, nil
+}
+
+// initSchema 初始化数据库表结构
+func (s *AuditStore) initSchema() error {
+	schema := `
+	CREATE TABLE IF NOT EXISTS audit_log (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		action TEXT NOT NULL,
+		target TEXT,
+		token_fingerprint TEXT,
+		source_ip TEXT,
+		detail TEXT,
+		created_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP
+	);
+	CREATE INDEX IF NOT EXISTS idx_audit_action ON audit_log(action);
+	CREATE INDEX IF NOT EXISTS idx_audit_created_at ON audit_log(created_at);
+	`
+	_, err := s.db.Exec(schema)
+	return err
+}
+
+// Record 写入一条审计日志
+func (s *AuditStore) Record(record *AuditRecord) error {
+	if record.CreatedAt.IsZero() {
+		record.CreatedAt = time.Now()
+	}
+
+	// 统一以 UTC 存储：created_at 按文本比较，混用时区会导致时间范围查询出错
+	query := `
+	INSERT INTO audit_log (action, target, token_fingerprint, source_ip, detail, created_at)
+	VALUES (?, ?, ?, ?, ?, ?)
+	`
+	_, err := s.db.Exec(query, record.Action, record.Target, record.TokenFingerprint,
+		record.SourceIP, record.Detail, record.CreatedAt.UTC())
+	if err != nil {
+		return fmt.Errorf("写入审计日志失败: %w", err)
+	}
+	return nil
+}
+
+// Query 查询审计日志（按时间倒序）
+func (s *AuditStore) Query(params *AuditQueryParams) ([]*AuditRecord, int, error) {
+	// 构建查询条件
+	where := "1=1"
+	args := []interface{}{}
+
+	if params.Action != "" {
+		where += " AND action = ?"
+		args = append(args, params.Action)
+	}
+	if params.StartTime != nil {
+		where += " AND created_at >= ?"
+		args = append(args, params.StartTime.UTC())
+	}
+	if params.EndTime != nil {
+		where += " AND created_at <= ?"
+		args = append(args, params.EndTime.UTC())
+	}
+
+	// 查询总数
+	countQuery := fmt.Sprintf("SELECT COUNT(*) FROM audit_log WHERE %s", where)
+	var total int
+	if err := s.db.QueryRow(countQuery, args...).Scan(&total); err != nil {
+		return nil, 0, fmt.Errorf("查询审计日志总数失败: %w", err)
+	}
+
+	// 设置默认值
+	limit := params.Limit
+	if limit <= 0 {
+		limit = 20
+	}
+	if limit > 1000 {
+		limit = 1000
+	}
+
+	query := fmt.Sprintf(`
+		SELECT id, action, target, token_fingerprint, source_ip, detail, created_at
+		FROM audit_log
+		WHERE %s
+		ORDER BY created_at DESC, id DESC
+		LIMIT ? OFFSET ?
+	`, where)
+
+	args = append(args, limit, params.Offset)
+	rows, err := s.db.Query(query, args...)
+	if err != nil {
+		return nil, 0, fmt.Errorf("查询审计日志失败: %w", err)
+	}
+	defer func() {
+		_ = rows.Close()
+	}()
+
+	var records []*AuditRecord
+	for rows.Next() {
+		var r AuditRecord
+		var target, fingerprint, sourceIP, detail sql.NullString
+		if err := rows.Scan(&r.ID, &r.Action, &target, &fingerprint, &sourceIP, &detail, &r.CreatedAt); err != nil {
+			return nil, 0, fmt.Errorf("扫描行失败: %w", err)
+		}
+		r.Target = target.String
+		r.TokenFingerprint = fingerprint.String
+		r.SourceIP = sourceIP.String
+		r.Detail = detail.String
+		records = append(records, &r)
+	}
+
+	return records, total, nil
+}
+
+// audit 记录一次 Admin 操作（审计存储不可用时忽略）
+// 参数：
+//   - r: Admin API 请求
+//   - action: 操作类型
+//   - target: 操作对象（Key 需先经 maskKey 脱敏）
+//   - detail: 补充说明
+func (s *Server) audit(r *http.Request, action, target, detail string) {
+	if s.auditStore == nil {
+		return
+	}
+
+	record := &AuditRecord{
+		Action:           action,
+		Target:           target,
+		TokenFingerprint: tokenFingerprint(r.Header.Get("X-Admin-Token")),
+		SourceIP:         sourceIP(r),
+		Detail:           detail,
+	}
+	if err := s.auditStore.Record(record); err != nil {
+		log.Printf("审计日志写入失败: %v", err)
+	}
+}
+
+// maskKey 脱敏 API Key（与请求日志的脱敏方式一致）
+func maskKey(key string) string {
+	if key == "" {
+		return "-"
+	}
+	if len(key) <= 8 {
+		return "***"
+	}
+	return key[:4] + "***" + key[len(key)-4:]
+}
+
+// tokenFingerprint 计算 Admin Token 指纹，用于区分操作者而不记录明文
+func tokenFingerprint(token string) string {
+	if token == "" {
+		return ""
+	}
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])[:12]
+}
+
+// sourceIP 提取请求来源 IP
+// 优先级：X-Forwarded-For > X-Real-IP > RemoteAddr
+func sourceIP(r *http.Request) string {
+	if xff := r.Header.Get("X-Forwarded-For"); xff != "" {
+		if ip := strings.TrimSpace(strings.Split(xff, ",")[0]); ip != "" {
+			return ip
+		}
+	}
+	if xri := r.Header.Get("X-Real-IP"); xri != "" {
+		return xri
+	}
+	if host, _, err := net.SplitHostPort(r.RemoteAddr); err == nil {
+		return host
+	}
+	return r.RemoteAddr
+}
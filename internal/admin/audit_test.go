@@ -0,0 +1,140 @@
+package admin
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+)
+
+// listAudit 调用 /admin/audit/list 并返回结果
+func listAudit(t *testing.T, h http.Handler, req AuditListRequest) AuditListResponse {
+	t.Helper()
+	rec := doAdmin(t, h, http.MethodPost, "/admin/audit/list", req)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("audit list: status = %d, body = %s", rec.Code, rec.Body)
+	}
+	var resp AuditListResponse
+	decodeResponse(t, rec, &resp)
+	return resp
+}
+
+func TestAuditRecordedForKeyOperations(t *testing.T) {
+	_, h := newTestServer(t)
+
+	const key = "sk-audit-0123456789"
+	name := "renamed"
+	steps := []struct {
+		path string
+		body interface{}
+	}{
+		{"/admin/keys/create", CreateRequest{Key: key, StartsAt: "2026-01-01T00:00:00Z"}},
+		{"/admin/keys/update", UpdateRequest{Key: key, Name: &name}},
+		{"/admin/keys/delete", DeleteRequest{Key: key}},
+	}
+	for _, step := range steps {
+		if rec := doAdmin(t, h, http.MethodPost, step.path, step.body); rec.Code != http.StatusOK {
+			t.Fatalf("%s: status = %d, body = %s", step.path, rec.Code, rec.Body)
+		}
+	}
+
+	resp := listAudit(t, h, AuditListRequest{})
+	if resp.Total != 3 || len(resp.Records) != 3 {
+		t.Fatalf("audit records = %d (total %d), want 3", len(resp.Records), resp.Total)
+	}
+
+	// 按时间倒序返回
+	wantActions := []string{AuditActionDelete, AuditActionUpdate, AuditActionCreate}
+	for i, record := range resp.Records {
+		if record.Action != wantActions[i] {
+			t.Errorf("records[%d].action = %q, want %q", i, record.Action, wantActions[i])
+		}
+		// Key 脱敏，与 maskKey 一致，不出现明文
+		if record.Target != "sk-a***6789" || strings.Contains(record.Target, key) {
+			t.Errorf("records[%d].target = %q, want masked key", i, record.Target)
+		}
+		if record.TokenFingerprint != tokenFingerprint(testAdminToken) || len(record.TokenFingerprint) != 12 {
+			t.Errorf("records[%d].token_fingerprint = %q", i, record.TokenFingerprint)
+		}
+		if record.SourceIP != "192.0.2.1" {
+			t.Errorf("records[%d].source_ip = %q, want the httptest remote address", i, record.SourceIP)
+		}
+	}
+
+	// 失败的操作不记录
+	if rec := doAdmin(t, h, http.MethodPost, "/admin/keys/delete", DeleteRequest{Key: key}); rec.Code == http.StatusOK {
+		t.Fatalf("deleting a missing key succeeded")
+	}
+	if resp := listAudit(t, h, AuditListRequest{}); resp.Total != 3 {
+		t.Errorf("audit total after failed delete = %d, want 3", resp.Total)
+	}
+}
+
+func TestAuditListFilters(t *testing.T) {
+	s, h := newTestServer(t)
+	base := time.Date(2026, 3, 15, 10, 0, 0, 0, time.UTC)
+	records := []*AuditRecord{
+		{Action: AuditActionCreate, Target: "a", CreatedAt: base},
+		{Action: AuditActionUpdate, Target: "b", CreatedAt: base.Add(time.Hour)},
+		{Action: AuditActionCreate, Target: "c", CreatedAt: base.Add(2 * time.Hour)},
+		{Action: AuditActionDelete, Target: "d", CreatedAt: base.Add(3 * time.Hour)},
+	}
+	for _, record := range records {
+		if err := s.auditStore.Record(record); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	targets := func(resp AuditListResponse) string {
+		names := make([]string, len(resp.Records))
+		for i, r := range resp.Records {
+			names[i] = r.Target
+		}
+		return strings.Join(names, ",")
+	}
+
+	tests := []struct {
+		name string
+		req  AuditListRequest
+		want string
+	}{
+		{"全部", AuditListRequest{}, "d,c,b,a"},
+		{"按操作类型", AuditListRequest{Action: AuditActionCreate}, "c,a"},
+		{"开始时间（含）", AuditListRequest{StartTime: "2026-03-15T11:00:00Z"}, "d,c,b"},
+		{"结束时间（含）", AuditListRequest{EndTime: "2026-03-15T11:00:00Z"}, "b,a"},
+		{"时间范围", AuditListRequest{StartTime: "2026-03-15T10:30:00Z", EndTime: "2026-03-15T12:30:00Z"}, "c,b"},
+		{"其他时区的时间范围", AuditListRequest{StartTime: "2026-03-15T18:30:00+08:00", EndTime: "2026-03-15T20:30:00+08:00"}, "c,b"},
+		{"操作类型 + 时间范围", AuditListRequest{Action: AuditActionCreate, StartTime: "2026-03-15T10:30:00Z"}, "c"},
+		{"分页", AuditListRequest{Limit: 2, Offset: 1}, "c,b"},
+		{"没有匹配", AuditListRequest{Action: AuditActionSync}, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resp := listAudit(t, h, tt.req)
+			if got := targets(resp); got != tt.want {
+				t.Errorf("targets = %q, want %q", got, tt.want)
+			}
+		})
+	}
+
+	if rec := doAdmin(t, h, http.MethodPost, "/admin/audit/list", AuditListRequest{StartTime: "yesterday"}); rec.Code != http.StatusBadRequest {
+		t.Errorf("invalid start_time: status = %d, want 400", rec.Code)
+	}
+}
+
+func TestMaskKey(t *testing.T) {
+	tests := []struct {
+		key  string
+		want string
+	}{
+		{"", "-"},
+		{"short", "***"},
+		{"12345678", "***"},
+		{"sk-0123456789", "sk-0***6789"},
+	}
+	for _, tt := range tests {
+		if got := maskKey(tt.key); got != tt.want {
+			t.Errorf("maskKey(%q) = %q, want %q", tt.key, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,69 @@
+package admin
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+)
+
+// AuthTestRequest 鉴权测试请求（只执行鉴权管道，不转发请求）
+type AuthTestRequest struct {
+	Key     string            `json:"key"`               // 待测试的 API Key
+	IP      string            `json:"ip,omitempty"`      // 模拟的客户端 IP（可选）
+	Method  string            `json:"method,omitempty"`  // 模拟的 HTTP 方法（默认 POST）
+	Path    string            `json:"path,omitempty"`    // 模拟的请求路径（默认 /v1/chat/completions）
+	Headers map[string]string `json:"headers,omitempty"` // 模拟的请求头（可选，供 Lua 脚本读取）
+}
+
+// AuthTestResult 鉴权测试结果
+type AuthTestResult struct {
+	Allow      bool                   `json:"allow"`              // 是否放行
+	StatusCode int                    `json:"status_code"`        // 实际请求会返回的 HTTP 状态码
+	StatusName string                 `json:"status_name"`        // 状态名称（如 ACTIVE, DISABLED, NOT_FOUND）
+	Message    string                 `json:"message,omitempty"`  // 拒绝时的错误消息
+	Provider   string                 `json:"provider,omitempty"` // 做出决策的 Provider（未匹配任何 Provider 时为空）
+	Metadata   map[string]interface{} `json:"metadata,omitempty"` // 鉴权脚本返回的元数据
+	ResetAt    int64                  `json:"reset_at,omitempty"` // 额度下一次重置时间（Unix 秒）
+}
+
+// AuthTester 执行一次鉴权测试（由鉴权管道提供，admin 包不直接依赖 pipeline）
+type AuthTester func(ctx context.Context, req *AuthTestRequest) (*AuthTestResult, error)
+
+// SetAuthTester 设置鉴权测试函数，供 /admin/auth/test 使用
+// 参数：
+//   - tester: 鉴权测试函数（未启用鉴权管道时不设置）
+func (s *Server) SetAuthTester(tester AuthTester) {
+	s.authTester = tester
+}
+
+// handleAuthTest 用指定 Key 执行完整的鉴权管道并返回结果（不转发请求，不计入审计日志）
+func (s *Server) handleAuthTest(w http.ResponseWriter, r *http.Request) {
+	if s.authTester == nil {
+		s.writeError(w, http.StatusServiceUnavailable, "未启用鉴权管道")
+		return
+	}
+
+	var req AuthTestRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		s.writeError(w, http.StatusBadRequest, "请求解析失败: "+err.Error())
+		return
+	}
+	if req.Key == "" {
+		s.writeError(w, http.StatusBadRequest, "key 不能为空")
+		return
+	}
+	if req.Method == "" {
+		req.Method = http.MethodPost
+	}
+	if req.Path == "" {
+		req.Path = "/v1/chat/completions"
+	}
+
+	result, err := s.authTester(r.Context(), &req)
+	if err != nil {
+		s.writeError(w, http.StatusInternalServerError, "鉴权执行失败: "+err.Error())
+		return
+	}
+
+	s.writeSuccess(w, "测试完成", result)
+}
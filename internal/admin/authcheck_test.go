@@ -0,0 +1,72 @@
+package admin
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestAuthTestEndpoint(t *testing.T) {
+	s, h := newTestServer(t)
+
+	// 未启用鉴权管道
+	if rec := doAdmin(t, h, http.MethodPost, "/admin/auth/test", AuthTestRequest{Key: "sk-test"}); rec.Code != http.StatusServiceUnavailable {
+		t.Fatalf("without tester: status = %d, want 503", rec.Code)
+	}
+
+	var got *AuthTestRequest
+	s.SetAuthTester(func(ctx context.Context, req *AuthTestRequest) (*AuthTestResult, error) {
+		got = req
+		if req.Key == "sk-broken" {
+			return nil, errors.New("provider unavailable")
+		}
+		return &AuthTestResult{Allow: false, StatusCode: 403, StatusName: "DISABLED", Provider: "builtin"}, nil
+	})
+
+	// 未指定方法和路径时使用默认值
+	rec := doAdmin(t, h, http.MethodPost, "/admin/auth/test", AuthTestRequest{Key: "sk-test", IP: "203.0.113.7"})
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status = %d, body = %s", rec.Code, rec.Body)
+	}
+	var result AuthTestResult
+	decodeResponse(t, rec, &result)
+	if result.StatusName != "DISABLED" || result.Provider != "builtin" || result.StatusCode != 403 {
+		t.Errorf("result = %+v", result)
+	}
+	if got.Method != http.MethodPost || got.Path != "/v1/chat/completions" || got.IP != "203.0.113.7" {
+		t.Errorf("tester request = %+v, want defaults and the supplied IP", got)
+	}
+
+	tests := []struct {
+		name string
+		body interface{}
+		want int
+	}{
+		{"缺少 key", AuthTestRequest{}, http.StatusBadRequest},
+		{"请求体无效", "not an object", http.StatusBadRequest},
+		{"鉴权执行失败", AuthTestRequest{Key: "sk-broken"}, http.StatusInternalServerError},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if rec := doAdmin(t, h, http.MethodPost, "/admin/auth/test", tt.body); rec.Code != tt.want {
+				t.Errorf("status = %d, want %d", rec.Code, tt.want)
+			}
+		})
+	}
+
+	// 与其他接口一样需要 Admin Token
+	req := httptest.NewRequest(http.MethodPost, "/admin/auth/test", strings.NewReader(`{"key":"sk-test"}`))
+	rec = httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+	if rec.Code != http.StatusUnauthorized {
+		t.Errorf("without token: status = %d, want 401", rec.Code)
+	}
+
+	// 不计入审计日志
+	if resp := listAudit(t, h, AuditListRequest{}); resp.Total != 0 {
+		t.Errorf("audit total = %d, want 0", resp.Total)
+	}
+}
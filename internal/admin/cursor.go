@@ -0,0 +1,52 @@
+package admin
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+)
+
+// listCursor 游标分页位置（上一页最后一条记录）
+// created_at 保存数据库中的原始文本，保证与存储值逐字节比较，避免时间格式往返带来的误差
+type listCursor struct {
+	CreatedAt string `json:"t"`           // created_at 原始值
+	Key       string `json:"k,omitempty"` // api_keys 的主键
+	ID        int64  `json:"i,omitempty"` // usage_records 的主键
+}
+
+// encode 编码为不透明的游标字符串
+func (c *listCursor) encode() string {
+	data, _ := json.Marshal(c)
+	return base64.RawURLEncoding.EncodeToString(data)
+}
+
+// decodeCursor 解析游标字符串
+// 参数：
+//   - s: 上一页返回的 next_cursor
+//
+// 返回：
+//   - *listCursor: 游标位置
+//   - error: 游标格式无效时返回错误
+func decodeCursor(s string) (*listCursor, error) {
+	data, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return nil, fmt.Errorf("无效的 cursor")
+	}
+	var c listCursor
+	if err := json.Unmarshal(data, &c); err != nil || c.CreatedAt == "" {
+		return nil, fmt.Errorf("无效的 cursor")
+	}
+	return &c, nil
+}
+
+// extraScanner 在原有扫描列之后追加额外的扫描目标
+// 用于在复用 scanAPIKey / scanUsageRecord 的同时读取 created_at 原始文本
+type extraScanner struct {
+	rowScanner
+	extra []interface{}
+}
+
+// Scan 扫描一行（额外目标对应查询末尾的附加列）
+func (e extraScanner) Scan(dest ...interface{}) error {
+	return e.rowScanner.Scan(append(dest, e.extra...)...)
+}
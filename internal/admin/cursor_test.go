@@ -0,0 +1,295 @@
+package admin
+
+import (
+	"fmt"
+	"net/http"
+	"sync"
+	"testing"
+	"time"
+)
+
+// pageAllKeys 按游标翻页读取全部 Key，每页之间调用 between
+func pageAllKeys(t *testing.T, store *KeyStore, order string, limit int, between func(page int)) []string {
+	t.Helper()
+	var keys []string
+	cursor := ""
+	for page := 0; ; page++ {
+		result, err := store.List(&KeyListParams{Order: order, Limit: limit, Cursor: cursor})
+		if err != nil {
+			t.Fatalf("List(page %d) error = %v", page, err)
+		}
+		if len(result.Keys) > limit {
+			t.Fatalf("page %d has %d keys, limit %d", page, len(result.Keys), limit)
+		}
+		for _, key := range result.Keys {
+			keys = append(keys, key.Key)
+		}
+		if !result.HasMore {
+			if result.NextCursor != "" {
+				t.Errorf("last page returned next_cursor %q", result.NextCursor)
+			}
+			return keys
+		}
+		if result.NextCursor == "" {
+			t.Fatalf("page %d: has_more without next_cursor", page)
+		}
+		cursor = result.NextCursor
+		if between != nil {
+			between(page)
+		}
+	}
+}
+
+// assertEachOnce 检查 want 中的每一项在 got 中恰好出现一次
+func assertEachOnce(t *testing.T, got, want []string) {
+	t.Helper()
+	seen := make(map[string]int, len(got))
+	for _, v := range got {
+		seen[v]++
+	}
+	for v, n := range seen {
+		if n > 1 {
+			t.Errorf("%s returned %d times", v, n)
+		}
+	}
+	for _, v := range want {
+		if seen[v] == 0 {
+			t.Errorf("%s skipped", v)
+		}
+	}
+}
+
+// seedCursorKeys 创建 n 个 Key，每 3 个共用同一个 created_at（检验相同时间时的稳定排序）
+func seedCursorKeys(t *testing.T, store *KeyStore, n int) []string {
+	t.Helper()
+	base := time.Date(2026, 3, 1, 0, 0, 0, 0, time.UTC)
+	keys := make([]string, n)
+	for i := range keys {
+		keys[i] = fmt.Sprintf("sk-page-%03d", i)
+		mustCreate(t, store, &APIKey{Key: keys[i]})
+		createdAt := base.Add(time.Duration(i/3) * time.Minute)
+		if _, err := store.GetDB().Exec(`UPDATE api_keys SET created_at = ? WHERE key = ?`, createdAt, keys[i]); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return keys
+}
+
+func TestKeyStoreCursorPagination(t *testing.T) {
+	store := newTestKeyStore(t)
+	want := seedCursorKeys(t, store, 25)
+
+	for _, order := range []string{"desc", "asc"} {
+		t.Run(order, func(t *testing.T) {
+			got := pageAllKeys(t, store, order, 4, nil)
+			if len(got) != len(want) {
+				t.Fatalf("paged %d keys, want %d", len(got), len(want))
+			}
+			assertEachOnce(t, got, want)
+
+			// 顺序与一次性查询一致
+			all, err := store.List(&KeyListParams{Order: order, Limit: 100})
+			if err != nil {
+				t.Fatal(err)
+			}
+			for i, key := range all.Keys {
+				if got[i] != key.Key {
+					t.Fatalf("position %d: cursor order %s, offset order %s", i, got[i], key.Key)
+				}
+			}
+		})
+	}
+}
+
+func TestKeyStoreCursorConcurrentInserts(t *testing.T) {
+	store := newTestKeyStore(t)
+	want := seedCursorKeys(t, store, 30)
+
+	// 翻页期间持续写入新 Key
+	stop := make(chan struct{})
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for i := 0; ; i++ {
+			select {
+			case <-stop:
+				return
+			default:
+			}
+			if err := store.Create(&APIKey{Key: fmt.Sprintf("sk-new-%04d", i)}); err != nil {
+				t.Error(err)
+				return
+			}
+			time.Sleep(time.Millisecond)
+		}
+	}()
+
+	got := pageAllKeys(t, store, "desc", 4, func(int) { time.Sleep(5 * time.Millisecond) })
+	close(stop)
+	wg.Wait()
+
+	// 倒序翻页时新 Key 排在游标之前，不会出现在后续页中；已有 Key 不重复、不遗漏
+	var seeded []string
+	for _, key := range got {
+		if key[:8] == "sk-page-" {
+			seeded = append(seeded, key)
+		}
+	}
+	if len(seeded) != len(want) {
+		t.Errorf("paged %d seeded keys, want %d", len(seeded), len(want))
+	}
+	assertEachOnce(t, got, want)
+}
+
+func TestKeyStoreOffsetHasMore(t *testing.T) {
+	store := newTestKeyStore(t)
+	seedCursorKeys(t, store, 5)
+
+	tests := []struct {
+		offset, limit int
+		count         int
+		hasMore       bool
+	}{
+		{0, 2, 2, true},
+		{2, 2, 2, true},
+		{4, 2, 1, false},
+		{0, 5, 5, false},
+	}
+	for _, tt := range tests {
+		result, err := store.List(&KeyListParams{Offset: tt.offset, Limit: tt.limit})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(result.Keys) != tt.count || result.HasMore != tt.hasMore || result.Total != 5 {
+			t.Errorf("offset %d limit %d: %d keys, has_more %v, total %d", tt.offset, tt.limit, len(result.Keys), result.HasMore, result.Total)
+		}
+	}
+
+	// 非 created_at 排序不返回游标，也不接受游标
+	result, err := store.List(&KeyListParams{Sort: "name", Limit: 2})
+	if err != nil || !result.HasMore || result.NextCursor != "" {
+		t.Errorf("sort by name: %+v, %v", result, err)
+	}
+	first, _ := store.List(&KeyListParams{Limit: 2})
+	if _, err := store.List(&KeyListParams{Sort: "name", Limit: 2, Cursor: first.NextCursor}); err == nil {
+		t.Error("cursor with sort=name: error = nil")
+	}
+}
+
+func TestListEndpointCursor(t *testing.T) {
+	s, h := newTestServer(t)
+	want := seedCursorKeys(t, s.keyStore, 7)
+
+	var got []string
+	req := ListRequest{Limit: 3}
+	for pages := 0; ; pages++ {
+		if pages > 3 {
+			t.Fatal("too many pages")
+		}
+		rec := doAdmin(t, h, http.MethodPost, "/admin/keys/list", req)
+		var list ListResponse
+		decodeResponse(t, rec, &list)
+		if rec.Code != http.StatusOK || list.Total != 7 {
+			t.Fatalf("list: %d %s", rec.Code, rec.Body)
+		}
+		for _, key := range list.Keys {
+			got = append(got, key.Key)
+		}
+		if !list.HasMore {
+			break
+		}
+		req.Cursor = list.NextCursor
+		// 设置游标时忽略 offset
+		req.Offset = 100
+	}
+	if len(got) != len(want) {
+		t.Fatalf("paged %v, want %d keys", got, len(want))
+	}
+	assertEachOnce(t, got, want)
+
+	// GET /admin/keys 同样支持 cursor
+	first := doAdmin(t, h, http.MethodGet, "/admin/keys?limit=3", nil)
+	var list ListResponse
+	decodeResponse(t, first, &list)
+	rec := doAdmin(t, h, http.MethodGet, "/admin/keys?limit=3&cursor="+list.NextCursor, nil)
+	decodeResponse(t, rec, &list)
+	if rec.Code != http.StatusOK || len(list.Keys) != 3 || list.Keys[0].Key != got[3] {
+		t.Errorf("GET with cursor: %d %s", rec.Code, rec.Body)
+	}
+
+	for _, req := range []ListRequest{{Cursor: "not-a-cursor"}, {Cursor: list.NextCursor, Sort: "name"}} {
+		if rec := doAdmin(t, h, http.MethodPost, "/admin/keys/list", req); rec.Code != http.StatusBadRequest {
+			t.Errorf("list %+v: status = %d, want 400", req, rec.Code)
+		}
+	}
+}
+
+func TestUsageStoreCursorConcurrentInserts(t *testing.T) {
+	s, _ := newTestServer(t)
+	store := newTestUsageStore(t, s)
+
+	// 每 4 条共用同一个 created_at
+	base := time.Date(2026, 3, 1, 0, 0, 0, 0, time.UTC)
+	var want []string
+	for i := 0; i < 40; i++ {
+		id := fmt.Sprintf("req-%03d", i)
+		want = append(want, id)
+		if err := store.Record(&UsageRecord{RequestID: id, APIKey: "sk-a", CreatedAt: base.Add(time.Duration(i/4) * time.Second)}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	stop := make(chan struct{})
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for i := 0; ; i++ {
+			select {
+			case <-stop:
+				return
+			default:
+			}
+			if err := store.Record(&UsageRecord{RequestID: fmt.Sprintf("new-%04d", i), APIKey: "sk-a", CreatedAt: time.Now()}); err != nil {
+				t.Error(err)
+				return
+			}
+			time.Sleep(time.Millisecond)
+		}
+	}()
+
+	var got []string
+	cursor := ""
+	for page := 0; ; page++ {
+		result, err := store.Query(&UsageQueryParams{Limit: 6, Cursor: cursor})
+		if err != nil {
+			t.Fatalf("Query(page %d) error = %v", page, err)
+		}
+		for _, r := range result.Records {
+			got = append(got, r.RequestID)
+		}
+		if !result.HasMore {
+			break
+		}
+		cursor = result.NextCursor
+		time.Sleep(5 * time.Millisecond)
+	}
+	close(stop)
+	wg.Wait()
+
+	var seeded int
+	for _, id := range got {
+		if id[:4] == "req-" {
+			seeded++
+		}
+	}
+	if seeded != len(want) {
+		t.Errorf("paged %d seeded records, want %d", seeded, len(want))
+	}
+	assertEachOnce(t, got, want)
+
+	if _, err := store.Query(&UsageQueryParams{Cursor: "%%%"}); err == nil {
+		t.Error("invalid cursor: error = nil")
+	}
+}
@@ -0,0 +1,149 @@
+package admin
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+
+	"llmproxy/internal/config"
+	"llmproxy/internal/utils"
+)
+
+// Key 生命周期事件类型
+const (
+	KeyEventCreated       = "created"
+	KeyEventUpdated       = "updated"
+	KeyEventDeleted       = "deleted"
+	KeyEventQuotaExceeded = "quota_exceeded"
+)
+
+// KeyEvent Key 生命周期事件（Webhook 请求体）
+type KeyEvent struct {
+	Event     string     `json:"event"`             // 事件类型: created / updated / deleted / quota_exceeded
+	APIKey    string     `json:"api_key"`           // 脱敏后的 API Key
+	Name      string     `json:"name,omitempty"`    // Key 名称
+	UserID    string     `json:"user_id,omitempty"` // 用户 ID
+	Status    *KeyStatus `json:"status,omitempty"`  // 事件发生后的状态（deleted 时为删除前的状态）
+	Timestamp time.Time  `json:"timestamp"`         // 事件时间
+}
+
+// EventNotifier Key 生命周期事件通知器
+// 事件异步发送，失败时按配置重试，不影响 KeyStore 的写入
+type EventNotifier struct {
+	cfg    *config.KeyEventConfig
+	client *http.Client
+}
+
+// NewEventNotifier 创建事件通知器
+// 参数：
+//   - cfg: 事件配置（为 nil、未启用或未配置 URL 时返回 nil）
+//
+// 返回：
+//   - *EventNotifier: 事件通知器
+func NewEventNotifier(cfg *config.KeyEventConfig) *EventNotifier {
+	if cfg == nil || !cfg.Enabled || cfg.Webhook == nil || cfg.Webhook.URL == "" {
+		return nil
+	}
+
+	timeout := cfg.Webhook.Timeout
+	if timeout <= 0 {
+		timeout = 3 * time.Second
+	}
+
+	return &EventNotifier{
+		cfg:    cfg,
+		client: &http.Client{Timeout: timeout},
+	}
+}
+
+// SetEventNotifier 设置 Key 生命周期事件通知器（为 nil 时不发送事件）
+// 参数：
+//   - notifier: 事件通知器
+func (s *KeyStore) SetEventNotifier(notifier *EventNotifier) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.events = notifier
+}
+
+// notify 异步发送 Key 事件，调用方需持有锁
+// 参数：
+//   - event: 事件类型
+//   - keyStr: API Key 明文（事件中只包含脱敏后的值）
+//   - key: Key 数据（可为 nil）
+func (s *KeyStore) notify(event, keyStr string, key *APIKey) {
+	if s.events == nil {
+		return
+	}
+
+	e := &KeyEvent{
+		Event:     event,
+		APIKey:    utils.MaskKey(keyStr),
+		Timestamp: time.Now(),
+	}
+	if key != nil {
+		status := key.Status
+		e.Name = key.Name
+		e.UserID = key.UserID
+		e.Status = &status
+	}
+	go s.events.send(e)
+}
+
+// send 发送事件 Webhook（支持重试）
+func (n *EventNotifier) send(event *KeyEvent) {
+	data, err := json.Marshal(event)
+	if err != nil {
+		log.Printf("序列化 Key 事件失败: %v", err)
+		return
+	}
+
+	retries := n.cfg.Webhook.Retry
+	if retries <= 0 {
+		retries = 1
+	}
+
+	for attempt := 0; attempt < retries; attempt++ {
+		if attempt > 0 {
+			time.Sleep(time.Duration(attempt) * 100 * time.Millisecond)
+		}
+		if err = n.post(data); err == nil {
+			return
+		}
+	}
+	log.Printf("Key 事件发送失败，已重试 %d 次: event=%s, key=%s, %v", retries, event.Event, event.APIKey, err)
+}
+
+// post 发送一次 Webhook 请求（配置了 webhook.secret 时附带签名）
+func (n *EventNotifier) post(data []byte) error {
+	method := n.cfg.Webhook.Method
+	if method == "" {
+		method = http.MethodPost
+	}
+
+	req, err := http.NewRequestWithContext(context.Background(), method, n.cfg.Webhook.URL, bytes.NewReader(data))
+	if err != nil {
+		return fmt.Errorf("创建请求失败: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	for k, v := range n.cfg.Webhook.Headers {
+		req.Header.Set(k, v)
+	}
+	utils.SignRequest(req, data, n.cfg.Webhook.Secret, n.cfg.Webhook.SignatureHeader)
+
+	resp, err := n.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("请求失败: %w", err)
+	}
+	defer func() {
+		_ = resp.Body.Close()
+	}()
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("返回状态码: %d", resp.StatusCode)
+	}
+	return nil
+}
@@ -0,0 +1,202 @@
+package admin
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"llmproxy/internal/config"
+	"llmproxy/internal/utils"
+)
+
+// testEventSecret 测试用签名密钥
+const testEventSecret = "event-secret"
+
+// receivedEvent 事件 Webhook 收到的请求
+type receivedEvent struct {
+	header http.Header
+	body   []byte
+}
+
+// newEventWebhook 启动记录请求的事件 Webhook，前 failures 次请求返回 500
+func newEventWebhook(t *testing.T, failures int32) (*httptest.Server, <-chan receivedEvent) {
+	t.Helper()
+	events := make(chan receivedEvent, 16)
+	var calls atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		if calls.Add(1) <= failures {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		events <- receivedEvent{header: r.Header.Clone(), body: body}
+	}))
+	t.Cleanup(server.Close)
+	return server, events
+}
+
+// newEventKeyStore 创建向指定 Webhook 发送签名事件的 KeyStore
+func newEventKeyStore(t *testing.T, url string) *KeyStore {
+	t.Helper()
+	store := newTestKeyStore(t)
+	store.SetEventNotifier(NewEventNotifier(&config.KeyEventConfig{
+		Enabled: true,
+		Webhook: &config.UsageWebhookConfig{
+			URL:     url,
+			Retry:   3,
+			Headers: map[string]string{"X-Source": "llmproxy"},
+			Secret:  testEventSecret,
+		},
+	}))
+	return store
+}
+
+// waitEvent 等待下一个事件，校验签名后返回解析的事件
+func waitEvent(t *testing.T, events <-chan receivedEvent) KeyEvent {
+	t.Helper()
+	select {
+	case got := <-events:
+		timestamp := got.header.Get(utils.TimestampHeader)
+		if timestamp == "" {
+			t.Fatalf("missing %s header", utils.TimestampHeader)
+		}
+		if sig := got.header.Get(utils.SignatureHeader); sig != utils.SignBody(testEventSecret, timestamp, got.body) {
+			t.Errorf("signature = %q, want HMAC of timestamp and body", sig)
+		}
+		if got.header.Get("X-Source") != "llmproxy" || got.header.Get("Content-Type") != "application/json" {
+			t.Errorf("headers = %v", got.header)
+		}
+		var event KeyEvent
+		if err := json.Unmarshal(got.body, &event); err != nil {
+			t.Fatalf("invalid event body %s: %v", got.body, err)
+		}
+		return event
+	case <-time.After(3 * time.Second):
+		t.Fatal("timed out waiting for key event")
+		return KeyEvent{}
+	}
+}
+
+// assertNoEvent 确认短时间内没有更多事件
+func assertNoEvent(t *testing.T, events <-chan receivedEvent) {
+	t.Helper()
+	select {
+	case got := <-events:
+		t.Errorf("unexpected event: %s", got.body)
+	case <-time.After(100 * time.Millisecond):
+	}
+}
+
+func TestKeyEventsForEachOperation(t *testing.T) {
+	server, events := newEventWebhook(t, 0)
+	store := newEventKeyStore(t, server.URL)
+	const key = "sk-events-0123456789"
+
+	check := func(event KeyEvent, want string, status KeyStatus) {
+		t.Helper()
+		if event.Event != want {
+			t.Errorf("event = %q, want %q", event.Event, want)
+		}
+		// 只发送脱敏后的 Key
+		if event.APIKey != "sk-event..." {
+			t.Errorf("%s: api_key = %q, want masked key", want, event.APIKey)
+		}
+		if event.Name != "billing" || event.UserID != "u1" {
+			t.Errorf("%s: name/user_id = %q/%q", want, event.Name, event.UserID)
+		}
+		if event.Status == nil || *event.Status != status {
+			t.Errorf("%s: status = %v, want %d", want, event.Status, status)
+		}
+		if time.Since(event.Timestamp) > time.Minute || event.Timestamp.IsZero() {
+			t.Errorf("%s: timestamp = %v", want, event.Timestamp)
+		}
+	}
+
+	apiKey := &APIKey{Key: key, Name: "billing", UserID: "u1", TotalQuota: 10}
+	mustCreate(t, store, apiKey)
+	check(waitEvent(t, events), KeyEventCreated, KeyStatusActive)
+
+	apiKey.Status = KeyStatusDisabled
+	if err := store.Update(apiKey); err != nil {
+		t.Fatal(err)
+	}
+	check(waitEvent(t, events), KeyEventUpdated, KeyStatusDisabled)
+
+	apiKey.Status = KeyStatusActive
+	if err := store.Update(apiKey); err != nil {
+		t.Fatal(err)
+	}
+	check(waitEvent(t, events), KeyEventUpdated, KeyStatusActive)
+
+	// 未耗尽额度时不发送事件，耗尽时只发送一次
+	if err := store.IncrementUsedQuota(key, 5); err != nil {
+		t.Fatal(err)
+	}
+	assertNoEvent(t, events)
+	if err := store.IncrementUsedQuota(key, 5); err != nil {
+		t.Fatal(err)
+	}
+	check(waitEvent(t, events), KeyEventQuotaExceeded, KeyStatusQuotaExceeded)
+	if err := store.IncrementUsedQuota(key, 5); err != nil {
+		t.Fatal(err)
+	}
+	assertNoEvent(t, events)
+
+	// deleted 事件带删除前的状态
+	if err := store.Delete(key); err != nil {
+		t.Fatal(err)
+	}
+	check(waitEvent(t, events), KeyEventDeleted, KeyStatusQuotaExceeded)
+
+	// 失败的操作不发送事件
+	if err := store.Delete(key); err == nil {
+		t.Fatal("deleting a missing key succeeded")
+	}
+	assertNoEvent(t, events)
+}
+
+func TestKeyEventRetry(t *testing.T) {
+	server, events := newEventWebhook(t, 2)
+	store := newEventKeyStore(t, server.URL)
+
+	mustCreate(t, store, &APIKey{Key: "sk-retry-0123456789", Name: "billing", UserID: "u1"})
+	if event := waitEvent(t, events); event.Event != KeyEventCreated {
+		t.Errorf("event = %q, want created after retries", event.Event)
+	}
+}
+
+func TestKeyEventUnsignedWithoutSecret(t *testing.T) {
+	server, events := newEventWebhook(t, 0)
+	store := newTestKeyStore(t)
+	store.SetEventNotifier(NewEventNotifier(&config.KeyEventConfig{
+		Enabled: true,
+		Webhook: &config.UsageWebhookConfig{URL: server.URL},
+	}))
+
+	mustCreate(t, store, &APIKey{Key: "sk-plain"})
+	select {
+	case got := <-events:
+		if got.header.Get(utils.SignatureHeader) != "" || got.header.Get(utils.TimestampHeader) != "" {
+			t.Errorf("unsigned webhook got signature headers: %v", got.header)
+		}
+	case <-time.After(3 * time.Second):
+		t.Fatal("timed out waiting for key event")
+	}
+}
+
+func TestNewEventNotifierDisabled(t *testing.T) {
+	for _, cfg := range []*config.KeyEventConfig{
+		nil,
+		{Enabled: false, Webhook: &config.UsageWebhookConfig{URL: "http://example.com"}},
+		{Enabled: true},
+		{Enabled: true, Webhook: &config.UsageWebhookConfig{}},
+	} {
+		if n := NewEventNotifier(cfg); n != nil {
+			t.Errorf("NewEventNotifier(%+v) = %v, want nil", cfg, n)
+		}
+	}
+}
@@ -0,0 +1,94 @@
+package admin
+
+import (
+	"crypto/rand"
+	"errors"
+	"fmt"
+	"math/big"
+	"strings"
+)
+
+// 生成 Key 的默认值与限制
+const (
+	DefaultKeyPrefix = "sk-llmproxy-" // 默认 Key 前缀
+	DefaultKeyLength = 32             // 默认随机部分长度
+	MinKeyLength     = 16             // 随机部分最小长度
+	MaxKeyLength     = 128            // 随机部分最大长度
+
+	keyGenAttempts = 5 // 冲突时的最大尝试次数
+)
+
+// keyAlphabet 随机部分使用的字符集（base62）
+const keyAlphabet = "abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ0123456789"
+
+// ErrKeyCollision 多次生成的 Key 均已存在
+var ErrKeyCollision = errors.New("生成的 Key 多次与已有 Key 冲突")
+
+// GenerateKey 生成密码学安全的随机 API Key
+// 参数：
+//   - prefix: Key 前缀（如 sk-llmproxy-）
+//   - length: 随机部分长度（MinKeyLength ~ MaxKeyLength）
+//
+// 返回：
+//   - string: 生成的 Key
+//   - error: 错误信息
+func GenerateKey(prefix string, length int) (string, error) {
+	if length < MinKeyLength || length > MaxKeyLength {
+		return "", fmt.Errorf("key 长度应在 %d ~ %d 之间", MinKeyLength, MaxKeyLength)
+	}
+
+	max := big.NewInt(int64(len(keyAlphabet)))
+	var sb strings.Builder
+	sb.Grow(len(prefix) + length)
+	sb.WriteString(prefix)
+	for i := 0; i < length; i++ {
+		n, err := rand.Int(rand.Reader, max)
+		if err != nil {
+			return "", fmt.Errorf("生成随机数失败: %w", err)
+		}
+		sb.WriteByte(keyAlphabet[n.Int64()])
+	}
+	return sb.String(), nil
+}
+
+// CreateGenerated 生成随机 Key 并写入存储
+// 写入时遇到唯一约束冲突会重新生成，超过最大尝试次数返回 ErrKeyCollision
+// 参数：
+//   - key: API Key 数据（Key 字段由本方法填充）
+//   - prefix: Key 前缀
+//   - length: 随机部分长度
+//
+// 返回：
+//   - error: 错误信息
+func (s *KeyStore) CreateGenerated(key *APIKey, prefix string, length int) error {
+	return s.createGenerated(key, func() (string, error) {
+		return GenerateKey(prefix, length)
+	})
+}
+
+// createGenerated 使用指定生成函数创建 Key（带冲突重试）
+func (s *KeyStore) createGenerated(key *APIKey, generate func() (string, error)) error {
+	for attempt := 1; attempt <= keyGenAttempts; attempt++ {
+		k, err := generate()
+		if err != nil {
+			return err
+		}
+		key.Key = k
+
+		err = s.Create(key)
+		if err == nil {
+			return nil
+		}
+		if !isUniqueViolation(err) {
+			return err
+		}
+	}
+
+	key.Key = ""
+	return ErrKeyCollision
+}
+
+// isUniqueViolation 判断是否为唯一约束冲突
+func isUniqueViolation(err error) bool {
+	return strings.Contains(err.Error(), "UNIQUE constraint failed")
+}
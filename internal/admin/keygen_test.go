@@ -0,0 +1,143 @@
+package admin
+
+import (
+	"errors"
+	"net/http"
+	"strings"
+	"testing"
+
+	"llmproxy/internal/config"
+)
+
+func TestGenerateKey(t *testing.T) {
+	seen := make(map[string]bool)
+	for i := 0; i < 1000; i++ {
+		key, err := GenerateKey("sk-llmproxy-", 32)
+		if err != nil {
+			t.Fatalf("GenerateKey() error = %v", err)
+		}
+		if !strings.HasPrefix(key, "sk-llmproxy-") {
+			t.Fatalf("GenerateKey() = %q, want prefix sk-llmproxy-", key)
+		}
+		random := strings.TrimPrefix(key, "sk-llmproxy-")
+		if len(random) != 32 {
+			t.Fatalf("random part %q has length %d, want 32", random, len(random))
+		}
+		if strings.Trim(random, keyAlphabet) != "" {
+			t.Fatalf("random part %q contains characters outside base62", random)
+		}
+		if seen[key] {
+			t.Fatalf("GenerateKey() returned duplicate %q", key)
+		}
+		seen[key] = true
+	}
+
+	for _, length := range []int{MinKeyLength - 1, MaxKeyLength + 1, 0} {
+		if _, err := GenerateKey("sk-", length); err == nil {
+			t.Errorf("GenerateKey(length=%d) error = nil", length)
+		}
+	}
+	if key, err := GenerateKey("", MinKeyLength); err != nil || len(key) != MinKeyLength {
+		t.Errorf("GenerateKey(no prefix) = %q, %v", key, err)
+	}
+}
+
+// sequenceGenerator 按顺序返回预设 Key 的生成函数，并记录调用次数
+func sequenceGenerator(keys ...string) (func() (string, error), *int) {
+	calls := 0
+	return func() (string, error) {
+		key := keys[min(calls, len(keys)-1)]
+		calls++
+		return key, nil
+	}, &calls
+}
+
+func TestCreateGeneratedRetriesOnCollision(t *testing.T) {
+	store := newTestKeyStore(t)
+	mustCreate(t, store, &APIKey{Key: "sk-taken", Name: "existing"})
+
+	generate, calls := sequenceGenerator("sk-taken", "sk-taken", "sk-fresh")
+	key := &APIKey{Name: "generated"}
+	if err := store.createGenerated(key, generate); err != nil {
+		t.Fatalf("createGenerated() error = %v", err)
+	}
+	if key.Key != "sk-fresh" || *calls != 3 {
+		t.Errorf("key = %q after %d attempts, want sk-fresh after 3", key.Key, *calls)
+	}
+	if got := mustGet(t, store, "sk-fresh"); got.Name != "generated" {
+		t.Errorf("stored key = %+v", got)
+	}
+}
+
+func TestCreateGeneratedFailsCleanlyOnRepeatedCollision(t *testing.T) {
+	store := newTestKeyStore(t)
+	mustCreate(t, store, &APIKey{Key: "sk-taken", Name: "existing"})
+
+	generate, calls := sequenceGenerator("sk-taken")
+	key := &APIKey{Name: "generated"}
+	err := store.createGenerated(key, generate)
+	if !errors.Is(err, ErrKeyCollision) {
+		t.Fatalf("createGenerated() error = %v, want ErrKeyCollision", err)
+	}
+	if *calls != keyGenAttempts {
+		t.Errorf("attempts = %d, want %d", *calls, keyGenAttempts)
+	}
+	// 失败时不返回冲突的 Key，已有 Key 不被覆盖，也没有写入新记录
+	if key.Key != "" {
+		t.Errorf("key.Key = %q after failure, want empty", key.Key)
+	}
+	if got := mustGet(t, store, "sk-taken"); got.Name != "existing" {
+		t.Errorf("existing key overwritten: %+v", got)
+	}
+	if result, err := store.List(&KeyListParams{Limit: 10}); err != nil || result.Total != 1 {
+		t.Errorf("List() total = %v, %v; want 1", result, err)
+	}
+
+	// 非冲突错误直接返回，不重试
+	generate = func() (string, error) { return "", errors.New("entropy exhausted") }
+	if err := store.createGenerated(&APIKey{}, generate); err == nil || errors.Is(err, ErrKeyCollision) {
+		t.Errorf("createGenerated() with failing generator = %v", err)
+	}
+}
+
+func TestCreateEndpointGeneratesKey(t *testing.T) {
+	s, h := newTestServer(t)
+	s.SetConfig(&config.Config{Admin: &config.AdminConfig{KeyPrefix: "sk-acme-", KeyLength: 24}})
+
+	var created APIKey
+	rec := doAdmin(t, h, http.MethodPost, "/admin/keys/create", CreateRequest{Generate: true, Name: "ci", StartsAt: "2026-01-01T00:00:00Z"})
+	decodeResponse(t, rec, &created)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("create: status = %d, body = %s", rec.Code, rec.Body)
+	}
+	// 明文 Key 只在创建响应中返回一次
+	if !strings.HasPrefix(created.Key, "sk-acme-") || len(created.Key) != len("sk-acme-")+24 {
+		t.Errorf("generated key = %q", created.Key)
+	}
+	if got := mustGet(t, s.keyStore, created.Key); got.Name != "ci" {
+		t.Errorf("stored key = %+v", got)
+	}
+
+	// 请求中的前缀和长度优先于配置
+	rec = doAdmin(t, h, http.MethodPost, "/admin/keys/create", CreateRequest{Generate: true, KeyPrefix: "sk-x-", KeyLength: 16, StartsAt: "2026-01-01T00:00:00Z"})
+	decodeResponse(t, rec, &created)
+	if !strings.HasPrefix(created.Key, "sk-x-") || len(created.Key) != len("sk-x-")+16 {
+		t.Errorf("generated key = %q", created.Key)
+	}
+
+	tests := []struct {
+		name string
+		req  CreateRequest
+	}{
+		{"generate 时指定 key", CreateRequest{Generate: true, Key: "sk-mine", StartsAt: "2026-01-01T00:00:00Z"}},
+		{"长度过短", CreateRequest{Generate: true, KeyLength: MinKeyLength - 1, StartsAt: "2026-01-01T00:00:00Z"}},
+		{"长度过长", CreateRequest{Generate: true, KeyLength: MaxKeyLength + 1, StartsAt: "2026-01-01T00:00:00Z"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if rec := doAdmin(t, h, http.MethodPost, "/admin/keys/create", tt.req); rec.Code != http.StatusBadRequest {
+				t.Errorf("status = %d, want 400: %s", rec.Code, rec.Body)
+			}
+		})
+	}
+}
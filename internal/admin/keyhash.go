@@ -0,0 +1,119 @@
+package admin
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"log"
+	"strings"
+)
+
+// hashedKeyPrefix 哈希存储的 Key 前缀（用于区分明文与哈希记录）
+const hashedKeyPrefix = "sha256:"
+
+// HashKey 计算 API Key 的存储哈希
+// 参数：
+//   - keyStr: 明文 API Key
+//
+// 返回：
+//   - string: "sha256:" + 十六进制摘要
+func HashKey(keyStr string) string {
+	sum := sha256.Sum256([]byte(keyStr))
+	return hashedKeyPrefix + hex.EncodeToString(sum[:])
+}
+
+// IsHashedKey 判断是否为哈希存储的 Key（"sha256:" + 64 位十六进制）
+func IsHashedKey(keyStr string) bool {
+	return strings.HasPrefix(keyStr, hashedKeyPrefix) && len(keyStr) == len(hashedKeyPrefix)+sha256.Size*2
+}
+
+// SetHashKeys 设置是否以哈希形式存储新写入的 Key
+// 查询始终同时匹配明文和哈希记录，因此开启前已存在的明文 Key 仍可使用
+// 参数：
+//   - enabled: 是否启用
+func (s *KeyStore) SetHashKeys(enabled bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.hashKeys = enabled
+}
+
+// storedKey 返回写入数据库的 Key 值（调用方需持有锁）
+func (s *KeyStore) storedKey(keyStr string) string {
+	if s.hashKeys && !IsHashedKey(keyStr) {
+		return HashKey(keyStr)
+	}
+	return keyStr
+}
+
+// keyWhere 构建按 Key 查询的条件，同时匹配明文和哈希记录
+// 参数：
+//   - keyStr: 明文 Key 或已哈希的 Key（如 Get 返回的 Key 字段）
+//
+// 返回：
+//   - string: WHERE 条件
+//   - []interface{}: 查询参数
+func keyWhere(keyStr string) (string, []interface{}) {
+	if IsHashedKey(keyStr) {
+		return "key = ?", []interface{}{keyStr}
+	}
+	return "key IN (?, ?)", []interface{}{HashKey(keyStr), keyStr}
+}
+
+// MigratePlaintextKeys 将已存在的明文 Key 转为哈希存储
+// 仅改写 api_keys 表，usage_records 中记录的 api_key 保持不变
+//
+// 返回：
+//   - int64: 迁移的 Key 数量
+//   - error: 错误信息
+func (s *KeyStore) MigratePlaintextKeys() (int64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	rows, err := s.db.Query(`SELECT key FROM api_keys WHERE key NOT LIKE ?`, hashedKeyPrefix+"%")
+	if err != nil {
+		return 0, fmt.Errorf("查询明文 Key 失败: %w", err)
+	}
+
+	var plain []string
+	for rows.Next() {
+		var key string
+		if err := rows.Scan(&key); err != nil {
+			_ = rows.Close()
+			return 0, fmt.Errorf("扫描行失败: %w", err)
+		}
+		plain = append(plain, key)
+	}
+	_ = rows.Close()
+	if len(plain) == 0 {
+		return 0, nil
+	}
+
+	tx, err := s.db.Begin()
+	if err != nil {
+		return 0, fmt.Errorf("开始事务失败: %w", err)
+	}
+	defer func() {
+		_ = tx.Rollback() // 忽略回滚错误，因为可能已 Commit
+	}()
+
+	stmt, err := tx.Prepare(`UPDATE api_keys SET key = ? WHERE key = ?`)
+	if err != nil {
+		return 0, fmt.Errorf("准备语句失败: %w", err)
+	}
+	defer func() {
+		_ = stmt.Close()
+	}()
+
+	for _, key := range plain {
+		if _, err := stmt.Exec(HashKey(key), key); err != nil {
+			return 0, fmt.Errorf("迁移 Key 失败: %w", err)
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return 0, fmt.Errorf("提交事务失败: %w", err)
+	}
+
+	log.Printf("KeyStore: 已将 %d 个明文 Key 迁移为哈希存储", len(plain))
+	return int64(len(plain)), nil
+}
@@ -0,0 +1,132 @@
+package admin
+
+import (
+	"testing"
+)
+
+// storedKeys 返回 api_keys 表中实际存储的 key 列
+func storedKeys(t *testing.T, store *KeyStore) map[string]bool {
+	t.Helper()
+	rows, err := store.GetDB().Query(`SELECT key FROM api_keys`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rows.Close()
+	keys := make(map[string]bool)
+	for rows.Next() {
+		var key string
+		if err := rows.Scan(&key); err != nil {
+			t.Fatal(err)
+		}
+		keys[key] = true
+	}
+	return keys
+}
+
+func TestHashKey(t *testing.T) {
+	const want = "sha256:ba7816bf8f01cfea414140de5dae2223b00361a396177a9cb410ff61f20015ad"
+	if got := HashKey("abc"); got != want {
+		t.Errorf("HashKey(abc) = %q, want %q", got, want)
+	}
+
+	tests := []struct {
+		key  string
+		want bool
+	}{
+		{want, true},
+		{"abc", false},
+		{"sha256:abc", false},
+		{"sk-sha256:ba7816bf8f01cfea414140de5dae2223b00361a396177a9cb410ff61f20015ad", false},
+	}
+	for _, tt := range tests {
+		if got := IsHashedKey(tt.key); got != tt.want {
+			t.Errorf("IsHashedKey(%q) = %v, want %v", tt.key, got, tt.want)
+		}
+	}
+}
+
+func TestHashedKeyStore(t *testing.T) {
+	store := newTestKeyStore(t)
+	store.SetHashKeys(true)
+	mustCreate(t, store, &APIKey{Key: "sk-secret", Name: "hashed", TotalQuota: 10})
+
+	// 数据库中只保存哈希
+	hashed := HashKey("sk-secret")
+	if stored := storedKeys(t, store); !stored[hashed] || stored["sk-secret"] {
+		t.Fatalf("stored keys = %v, want only the hash", stored)
+	}
+
+	// 用明文查询，返回的 Key 字段为哈希
+	key := mustGet(t, store, "sk-secret")
+	if key.Key != hashed || key.Name != "hashed" {
+		t.Errorf("Get() = %+v", key)
+	}
+	if !store.Exists("sk-secret") || !store.Exists(hashed) {
+		t.Error("Exists() = false for plaintext or hashed key")
+	}
+
+	// 更新和扣减额度同样按明文定位
+	key.Name = "renamed"
+	if err := store.Update(key); err != nil {
+		t.Fatalf("Update() error = %v", err)
+	}
+	if err := store.IncrementUsedQuota("sk-secret", 3); err != nil {
+		t.Fatal(err)
+	}
+	if key := mustGet(t, store, "sk-secret"); key.Name != "renamed" || key.UsedQuota != 3 {
+		t.Errorf("after update: %+v", key)
+	}
+
+	if err := store.Delete("sk-secret"); err != nil {
+		t.Fatalf("Delete() error = %v", err)
+	}
+	if key, _ := store.Get("sk-secret"); key != nil {
+		t.Errorf("Get() after Delete() = %+v", key)
+	}
+	if store.Exists(hashed) {
+		t.Error("hashed row still exists after Delete()")
+	}
+}
+
+func TestMixedModeLookup(t *testing.T) {
+	store := newTestKeyStore(t)
+
+	// 开启哈希前写入的明文记录
+	mustCreate(t, store, &APIKey{Key: "sk-legacy", Name: "legacy"})
+	store.SetHashKeys(true)
+	mustCreate(t, store, &APIKey{Key: "sk-new", Name: "new"})
+
+	stored := storedKeys(t, store)
+	if !stored["sk-legacy"] || !stored[HashKey("sk-new")] {
+		t.Fatalf("stored keys = %v", stored)
+	}
+
+	// 两种记录都能用明文查到
+	if key := mustGet(t, store, "sk-legacy"); key.Key != "sk-legacy" || key.Name != "legacy" {
+		t.Errorf("legacy Get() = %+v", key)
+	}
+	if key := mustGet(t, store, "sk-new"); key.Key != HashKey("sk-new") || key.Name != "new" {
+		t.Errorf("new Get() = %+v", key)
+	}
+
+	// 迁移后明文记录改为哈希，查询不受影响
+	count, err := store.MigratePlaintextKeys()
+	if err != nil || count != 1 {
+		t.Fatalf("MigratePlaintextKeys() = %d, %v; want 1", count, err)
+	}
+	stored = storedKeys(t, store)
+	if stored["sk-legacy"] || !stored[HashKey("sk-legacy")] {
+		t.Errorf("stored keys after migration = %v", stored)
+	}
+	if key := mustGet(t, store, "sk-legacy"); key.Name != "legacy" {
+		t.Errorf("legacy Get() after migration = %+v", key)
+	}
+	if count, err := store.MigratePlaintextKeys(); err != nil || count != 0 {
+		t.Errorf("second MigratePlaintextKeys() = %d, %v; want 0", count, err)
+	}
+
+	// 明文 Key 在哈希模式下仍不能重复创建
+	if err := store.Create(&APIKey{Key: "sk-legacy"}); err == nil {
+		t.Error("Create() duplicate of migrated key: error = nil")
+	}
+}
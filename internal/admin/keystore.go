@@ -6,6 +6,7 @@ import (
 	"log"
 	"os"
 	"path/filepath"
+	"strings"
 	"sync"
 	"time"
 
@@ -35,13 +36,36 @@ type APIKey struct {
 	ExpiresAt *time.Time `json:"expires_at,omitempty"` // 过期时间（可选）
 	CreatedAt time.Time  `json:"created_at"`           // 创建时间
 	UpdatedAt time.Time  `json:"updated_at"`           // 更新时间
+
+	TotalQuota       int64      `json:"total_quota"`                  // 总额度（Token，0 表示不限制）
+	UsedQuota        int64      `json:"used_quota"`                   // 已用额度
+	QuotaResetPeriod string     `json:"quota_reset_period,omitempty"` // 重置周期: daily / weekly / monthly / never
+	LastResetAt      *time.Time `json:"last_reset_at,omitempty"`      // 上次重置时间
+	Rollover         bool       `json:"rollover,omitempty"`           // 周期重置时是否结转未用额度
+	RolloverCap      int64      `json:"rollover_cap,omitempty"`       // 结转上限（0 表示不超过 total_quota）
+	RolloverQuota    int64      `json:"rollover_quota,omitempty"`     // 本周期从上周期结转的额度（重置时维护）
+
+	DailyCostLimit float64 `json:"daily_cost_limit,omitempty"` // 每日消费上限（0 表示不限制，需启用 billing）
+}
+
+// keyColumns api_keys 表查询列（与 scanAPIKey 的扫描顺序一致）
+const keyColumns = `key, name, user_id, status, starts_at, expires_at, created_at, updated_at,
+	total_quota, used_quota, quota_reset_period, last_reset_at, rollover, rollover_cap, rollover_quota,
+	daily_cost_limit`
+
+// rowScanner sql.Row / sql.Rows 的公共接口
+type rowScanner interface {
+	Scan(dest ...interface{}) error
 }
 
 // KeyStore API Key 存储
 type KeyStore struct {
-	db     *sql.DB
-	dbPath string
-	mu     sync.RWMutex
+	db       *sql.DB
+	dbPath   string
+	mu       sync.RWMutex
+	hashKeys bool // 新写入的 Key 是否以 SHA-256 哈希存储
+
+	events *EventNotifier // Key 生命周期事件通知器（可为 nil）
 }
 
 // NewKeyStore 创建 KeyStore
@@ -58,8 +82,8 @@ func NewKeyStore(dbPath string) (*KeyStore, error) {
 		return nil, fmt.Errorf("创建数据库目录失败: %w", err)
 	}
 
-	// 打开数据库
-	db, err := sql.Open("sqlite", dbPath)
+	// 打开数据库（用量记录与 Admin 查询并发访问同一文件，加锁冲突时等待而不是直接返回 SQLITE_BUSY）
+	db, err := sql.Open("sqlite", dbPath+"?_pragma=busy_timeout(5000)")
 	if err != nil {
 		return nil, fmt.Errorf("打开数据库失败: %w", err)
 	}
@@ -94,7 +118,15 @@ func (s *KeyStore) initSchema() error {
 		starts_at DATETIME,
 		expires_at DATETIME,
 		created_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
-		updated_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP
+		updated_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
+		total_quota INTEGER NOT NULL DEFAULT 0,
+		used_quota INTEGER NOT NULL DEFAULT 0,
+		quota_reset_period TEXT,
+		last_reset_at DATETIME,
+		rollover INTEGER NOT NULL DEFAULT 0,
+		rollover_cap INTEGER NOT NULL DEFAULT 0,
+		rollover_quota INTEGER NOT NULL DEFAULT 0,
+		daily_cost_limit REAL NOT NULL DEFAULT 0
 	);
 	CREATE INDEX IF NOT EXISTS idx_api_keys_status ON api_keys(status);
 	CREATE INDEX IF NOT EXISTS idx_api_keys_user_id ON api_keys(user_id);
@@ -116,6 +148,17 @@ func (s *KeyStore) migrateSchema() {
 	_, _ = s.db.Exec(`ALTER TABLE api_keys ADD COLUMN user_id TEXT`)
 	// 尝试添加 starts_at 字段（忽略已存在错误）
 	_, _ = s.db.Exec(`ALTER TABLE api_keys ADD COLUMN starts_at DATETIME`)
+	// 尝试添加额度字段（忽略已存在错误）
+	_, _ = s.db.Exec(`ALTER TABLE api_keys ADD COLUMN total_quota INTEGER NOT NULL DEFAULT 0`)
+	_, _ = s.db.Exec(`ALTER TABLE api_keys ADD COLUMN used_quota INTEGER NOT NULL DEFAULT 0`)
+	_, _ = s.db.Exec(`ALTER TABLE api_keys ADD COLUMN quota_reset_period TEXT`)
+	_, _ = s.db.Exec(`ALTER TABLE api_keys ADD COLUMN last_reset_at DATETIME`)
+	// 尝试添加额度结转字段（忽略已存在错误）
+	_, _ = s.db.Exec(`ALTER TABLE api_keys ADD COLUMN rollover INTEGER NOT NULL DEFAULT 0`)
+	_, _ = s.db.Exec(`ALTER TABLE api_keys ADD COLUMN rollover_cap INTEGER NOT NULL DEFAULT 0`)
+	_, _ = s.db.Exec(`ALTER TABLE api_keys ADD COLUMN rollover_quota INTEGER NOT NULL DEFAULT 0`)
+	// 尝试添加每日消费上限字段（忽略已存在错误）
+	_, _ = s.db.Exec(`ALTER TABLE api_keys ADD COLUMN daily_cost_limit REAL NOT NULL DEFAULT 0`)
 	// 尝试创建 user_id 索引（忽略已存在错误）
 	_, _ = s.db.Exec(`CREATE INDEX IF NOT EXISTS idx_api_keys_user_id ON api_keys(user_id)`)
 }
@@ -135,10 +178,14 @@ func (s *KeyStore) Create(key *APIKey) error {
 	key.UpdatedAt = now
 
 	query := `
-	INSERT INTO api_keys (key, name, user_id, status, starts_at, expires_at, created_at, updated_at)
-	VALUES (?, ?, ?, ?, ?, ?, ?, ?)
+	INSERT INTO api_keys (key, name, user_id, status, starts_at, expires_at, created_at, updated_at,
+		total_quota, used_quota, quota_reset_period, last_reset_at, rollover, rollover_cap, rollover_quota,
+		daily_cost_limit)
+	VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
 	`
-	_, err := s.db.Exec(query, key.Key, key.Name, key.UserID, key.Status, key.StartsAt, key.ExpiresAt, key.CreatedAt, key.UpdatedAt)
+	_, err := s.db.Exec(query, s.storedKey(key.Key), key.Name, key.UserID, key.Status, key.StartsAt, key.ExpiresAt, key.CreatedAt, key.UpdatedAt,
+		key.TotalQuota, key.UsedQuota, key.QuotaResetPeriod, key.LastResetAt, key.Rollover, key.RolloverCap, key.RolloverQuota,
+		key.DailyCostLimit)
 	if err != nil {
 		return fmt.Errorf("创建 API Key 失败: %w", err)
 	}
@@ -148,6 +195,7 @@ func (s *KeyStore) Create(key *APIKey) error {
 		keyPrefix = keyPrefix[:8]
 	}
 	log.Printf("KeyStore: 已创建 Key [%s...] status=%d", keyPrefix, key.Status)
+	s.notify(KeyEventCreated, key.Key, key)
 	return nil
 }
 
@@ -163,12 +211,16 @@ func (s *KeyStore) Update(key *APIKey) error {
 
 	key.UpdatedAt = time.Now()
 
+	// used_quota / rollover_quota 不在此更新，避免覆盖并发累加的用量（由 ResetQuota 维护）
+	where, whereArgs := keyWhere(key.Key)
 	query := `
 	UPDATE api_keys
-	SET name = ?, user_id = ?, status = ?, starts_at = ?, expires_at = ?, updated_at = ?
-	WHERE key = ?
-	`
-	result, err := s.db.Exec(query, key.Name, key.UserID, key.Status, key.StartsAt, key.ExpiresAt, key.UpdatedAt, key.Key)
+	SET name = ?, user_id = ?, status = ?, starts_at = ?, expires_at = ?, updated_at = ?,
+		total_quota = ?, quota_reset_period = ?, rollover = ?, rollover_cap = ?, daily_cost_limit = ?
+	WHERE ` + where
+	args := append([]interface{}{key.Name, key.UserID, key.Status, key.StartsAt, key.ExpiresAt, key.UpdatedAt,
+		key.TotalQuota, key.QuotaResetPeriod, key.Rollover, key.RolloverCap, key.DailyCostLimit}, whereArgs...)
+	result, err := s.db.Exec(query, args...)
 	if err != nil {
 		return fmt.Errorf("更新 API Key 失败: %w", err)
 	}
@@ -183,6 +235,7 @@ func (s *KeyStore) Update(key *APIKey) error {
 		keyPrefix = keyPrefix[:8]
 	}
 	log.Printf("KeyStore: 已更新 Key [%s...] status=%d", keyPrefix, key.Status)
+	s.notify(KeyEventUpdated, key.Key, key)
 	return nil
 }
 
@@ -196,8 +249,15 @@ func (s *KeyStore) Delete(keyStr string) error {
 	s.mu.Lock()
 	defer s.mu.Unlock()
 
-	query := `DELETE FROM api_keys WHERE key = ?`
-	result, err := s.db.Exec(query, keyStr)
+	// 事件中带上删除前的名称、用户和状态
+	var old *APIKey
+	if s.events != nil {
+		old, _ = s.get(keyStr)
+	}
+
+	where, args := keyWhere(keyStr)
+	query := `DELETE FROM api_keys WHERE ` + where
+	result, err := s.db.Exec(query, args...)
 	if err != nil {
 		return fmt.Errorf("删除 API Key 失败: %w", err)
 	}
@@ -212,9 +272,132 @@ func (s *KeyStore) Delete(keyStr string) error {
 		keyPrefix = keyPrefix[:8]
 	}
 	log.Printf("KeyStore: 已删除 Key [%s...]", keyPrefix)
+	s.notify(KeyEventDeleted, keyStr, old)
 	return nil
 }
 
+// KeyDeleteFilter 批量删除条件（多个条件之间为 AND 关系）
+type KeyDeleteFilter struct {
+	Keys          []string   // 按 Key 列表删除（明文或哈希值）
+	Status        *KeyStatus // 按状态筛选
+	UserID        string     // 按用户 ID 筛选
+	ExpiresBefore *time.Time // 过期时间早于该时间（未设置过期时间的 Key 不匹配）
+	All           bool       // 未设置任何条件时是否允许删除全部 Key（防止误删）
+}
+
+// keyDeleteWhere 根据批量删除条件构建筛选条件（ExpiresBefore 只筛选有过期时间的 Key）
+// 参数：
+//   - filter: 批量删除条件
+//
+// 返回：
+//   - string: WHERE 条件
+//   - []interface{}: 查询参数
+//   - bool: 是否设置了任一条件
+func keyDeleteWhere(filter *KeyDeleteFilter) (string, []interface{}, bool) {
+	where := "1=1"
+	args := []interface{}{}
+	filtered := false
+
+	if len(filter.Keys) > 0 {
+		conds := make([]string, 0, len(filter.Keys))
+		for _, k := range filter.Keys {
+			cond, condArgs := keyWhere(k)
+			conds = append(conds, cond)
+			args = append(args, condArgs...)
+		}
+		where += " AND (" + strings.Join(conds, " OR ") + ")"
+		filtered = true
+	}
+	if filter.Status != nil {
+		where += " AND status = ?"
+		args = append(args, *filter.Status)
+		filtered = true
+	}
+	if filter.UserID != "" {
+		where += " AND user_id = ?"
+		args = append(args, filter.UserID)
+		filtered = true
+	}
+	if filter.ExpiresBefore != nil {
+		// 存储格式随时区变化，时间比较在 BulkDelete 中逐行进行
+		where += " AND expires_at IS NOT NULL"
+		filtered = true
+	}
+	return where, args, filtered
+}
+
+// BulkDelete 在一个事务中批量删除符合条件的 API Key
+// 参数：
+//   - filter: 批量删除条件（未设置任何条件时必须显式设置 All）
+//
+// 返回：
+//   - int64: 删除的 Key 数量
+//   - error: 错误信息
+func (s *KeyStore) BulkDelete(filter *KeyDeleteFilter) (int64, error) {
+	where, args, filtered := keyDeleteWhere(filter)
+	if !filtered && !filter.All {
+		return 0, fmt.Errorf("未指定删除条件")
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	tx, err := s.db.Begin()
+	if err != nil {
+		return 0, fmt.Errorf("开始事务失败: %w", err)
+	}
+	defer func() {
+		_ = tx.Rollback() // 忽略回滚错误，因为可能已 Commit
+	}()
+
+	// 先取出待删除的 Key（过期时间在此逐行比较），再按主键逐个删除
+	rows, err := tx.Query(fmt.Sprintf(`SELECT %s FROM api_keys WHERE %s`, keyColumns, where), args...)
+	if err != nil {
+		return 0, fmt.Errorf("查询待删除 Key 失败: %w", err)
+	}
+	var deleted []*APIKey
+	for rows.Next() {
+		key, err := scanAPIKey(rows)
+		if err != nil {
+			_ = rows.Close()
+			return 0, fmt.Errorf("扫描行失败: %w", err)
+		}
+		if filter.ExpiresBefore != nil && !key.ExpiresAt.Before(*filter.ExpiresBefore) {
+			continue
+		}
+		deleted = append(deleted, key)
+	}
+	_ = rows.Close()
+
+	stmt, err := tx.Prepare(`DELETE FROM api_keys WHERE key = ?`)
+	if err != nil {
+		return 0, fmt.Errorf("准备语句失败: %w", err)
+	}
+	defer func() {
+		_ = stmt.Close()
+	}()
+
+	var count int64
+	for _, key := range deleted {
+		result, err := stmt.Exec(key.Key)
+		if err != nil {
+			return 0, fmt.Errorf("批量删除 API Key 失败: %w", err)
+		}
+		n, _ := result.RowsAffected()
+		count += n
+	}
+
+	if err := tx.Commit(); err != nil {
+		return 0, fmt.Errorf("提交事务失败: %w", err)
+	}
+
+	log.Printf("KeyStore: 已批量删除 %d 个 Key", count)
+	for _, key := range deleted {
+		s.notify(KeyEventDeleted, key.Key, key)
+	}
+	return count, nil
+}
+
 // Get 获取 API Key
 // 参数：
 //   - keyStr: API Key 字符串
@@ -225,17 +408,14 @@ func (s *KeyStore) Delete(keyStr string) error {
 func (s *KeyStore) Get(keyStr string) (*APIKey, error) {
 	s.mu.RLock()
 	defer s.mu.RUnlock()
+	return s.get(keyStr)
+}
 
-	query := `
-	SELECT key, name, user_id, status, starts_at, expires_at, created_at, updated_at
-	FROM api_keys WHERE key = ?
-	`
-	row := s.db.QueryRow(query, keyStr)
-
-	var key APIKey
-	var name, userID sql.NullString
-	var startsAt, expiresAt sql.NullTime
-	err := row.Scan(&key.Key, &name, &userID, &key.Status, &startsAt, &expiresAt, &key.CreatedAt, &key.UpdatedAt)
+// get 获取 API Key，调用方需持有锁
+func (s *KeyStore) get(keyStr string) (*APIKey, error) {
+	where, args := keyWhere(keyStr)
+	query := `SELECT ` + keyColumns + ` FROM api_keys WHERE ` + where + ` LIMIT 1`
+	key, err := scanAPIKey(s.db.QueryRow(query, args...))
 	if err == sql.ErrNoRows {
 		return nil, nil // 未找到
 	}
@@ -243,6 +423,26 @@ func (s *KeyStore) Get(keyStr string) (*APIKey, error) {
 		return nil, fmt.Errorf("查询 API Key 失败: %w", err)
 	}
 
+	return key, nil
+}
+
+// scanAPIKey 扫描一行 api_keys 记录（列顺序见 keyColumns）
+// 参数：
+//   - row: 查询结果行
+//
+// 返回：
+//   - *APIKey: API Key 数据
+//   - error: 错误信息
+func scanAPIKey(row rowScanner) (*APIKey, error) {
+	var key APIKey
+	var name, userID, resetPeriod sql.NullString
+	var startsAt, expiresAt, lastResetAt sql.NullTime
+	if err := row.Scan(&key.Key, &name, &userID, &key.Status, &startsAt, &expiresAt, &key.CreatedAt, &key.UpdatedAt,
+		&key.TotalQuota, &key.UsedQuota, &resetPeriod, &lastResetAt, &key.Rollover, &key.RolloverCap, &key.RolloverQuota,
+		&key.DailyCostLimit); err != nil {
+		return nil, err
+	}
+
 	if name.Valid {
 		key.Name = name.String
 	}
@@ -255,69 +455,163 @@ func (s *KeyStore) Get(keyStr string) (*APIKey, error) {
 	if expiresAt.Valid {
 		key.ExpiresAt = &expiresAt.Time
 	}
+	if resetPeriod.Valid {
+		key.QuotaResetPeriod = resetPeriod.String
+	}
+	if lastResetAt.Valid {
+		key.LastResetAt = &lastResetAt.Time
+	}
 
 	return &key, nil
 }
 
-// List 列出所有 API Key
+// KeyListParams Key 列表查询参数
+type KeyListParams struct {
+	Status    *KeyStatus // 按状态筛选
+	UserID    string     // 按用户 ID 筛选
+	KeyPrefix string     // 按 Key 前缀筛选
+	Name      string     // 按名称子串搜索
+	Sort      string     // 排序字段（见 keySortColumns，默认 created_at）
+	Order     string     // 排序方向: asc / desc（默认 desc）
+	Offset    int        // 偏移量（设置 Cursor 时忽略）
+	Limit     int        // 限制数量
+	Cursor    string     // 游标（上一页的 NextCursor，仅支持按 created_at 排序）
+}
+
+// KeyListResult Key 列表查询结果
+type KeyListResult struct {
+	Keys       []*APIKey // 当前页
+	Total      int       // 符合筛选条件的总数
+	HasMore    bool      // 是否还有下一页
+	NextCursor string    // 下一页游标（没有下一页时为空）
+}
+
+// keySortColumns 允许排序的字段
+var keySortColumns = map[string]bool{
+	"created_at": true,
+	"updated_at": true,
+	"expires_at": true,
+	"name":       true,
+	"user_id":    true,
+	"used_quota": true,
+}
+
+// likeEscaper 转义 LIKE 通配符
+var likeEscaper = strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`)
+
+// List 按条件列出 API Key
 // 参数：
-//   - offset: 偏移量
-//   - limit: 限制数量
+//   - params: 查询参数（筛选、排序、分页）
 //
 // 返回：
-//   - []*APIKey: API Key 列表
-//   - int: 总数
+//   - *KeyListResult: 当前页、总数及下一页游标
 //   - error: 错误信息
-func (s *KeyStore) List(offset, limit int) ([]*APIKey, int, error) {
+func (s *KeyStore) List(params *KeyListParams) (*KeyListResult, error) {
+	// 构建查询条件
+	where := "1=1"
+	args := []interface{}{}
+
+	if params.Status != nil {
+		where += " AND status = ?"
+		args = append(args, *params.Status)
+	}
+	if params.UserID != "" {
+		where += " AND user_id = ?"
+		args = append(args, params.UserID)
+	}
+	if params.KeyPrefix != "" {
+		where += ` AND key LIKE ? ESCAPE '\'`
+		args = append(args, likeEscaper.Replace(params.KeyPrefix)+"%")
+	}
+	if params.Name != "" {
+		where += ` AND name LIKE ? ESCAPE '\'`
+		args = append(args, "%"+likeEscaper.Replace(params.Name)+"%")
+	}
+
+	sort := params.Sort
+	if sort == "" {
+		sort = "created_at"
+	}
+	if !keySortColumns[sort] {
+		return nil, fmt.Errorf("不支持的排序字段: %s", sort)
+	}
+	order := "DESC"
+	if strings.EqualFold(params.Order, "asc") {
+		order = "ASC"
+	}
+
+	var cursor *listCursor
+	if params.Cursor != "" {
+		if sort != "created_at" {
+			return nil, fmt.Errorf("cursor 仅支持按 created_at 排序")
+		}
+		c, err := decodeCursor(params.Cursor)
+		if err != nil {
+			return nil, err
+		}
+		cursor = c
+	}
+
 	s.mu.RLock()
 	defer s.mu.RUnlock()
 
 	// 查询总数
 	var total int
-	countQuery := `SELECT COUNT(*) FROM api_keys`
-	if err := s.db.QueryRow(countQuery).Scan(&total); err != nil {
-		return nil, 0, fmt.Errorf("查询总数失败: %w", err)
+	countQuery := fmt.Sprintf("SELECT COUNT(*) FROM api_keys WHERE %s", where)
+	if err := s.db.QueryRow(countQuery, args...).Scan(&total); err != nil {
+		return nil, fmt.Errorf("查询总数失败: %w", err)
 	}
 
-	// 查询列表
-	query := `
-	SELECT key, name, user_id, status, starts_at, expires_at, created_at, updated_at
+	// 游标分页：从上一页最后一条之后继续（keyset，不使用 OFFSET）
+	offset := params.Offset
+	if cursor != nil {
+		cmp := "<"
+		if order == "ASC" {
+			cmp = ">"
+		}
+		where += fmt.Sprintf(" AND (created_at %s ? OR (created_at = ? AND key > ?))", cmp)
+		args = append(args, cursor.CreatedAt, cursor.CreatedAt, cursor.Key)
+		offset = 0
+	}
+
+	// 查询列表（相同排序值按 key 排序，保证分页稳定；多取一条用于判断是否还有下一页）
+	query := fmt.Sprintf(`SELECT %s, CAST(created_at AS TEXT)
 	FROM api_keys
-	ORDER BY created_at DESC
+	WHERE %s
+	ORDER BY %s %s, key ASC
 	LIMIT ? OFFSET ?
-	`
-	rows, err := s.db.Query(query, limit, offset)
+	`, keyColumns, where, sort, order)
+	args = append(args, params.Limit+1, offset)
+	rows, err := s.db.Query(query, args...)
 	if err != nil {
-		return nil, 0, fmt.Errorf("查询 API Key 列表失败: %w", err)
+		return nil, fmt.Errorf("查询 API Key 列表失败: %w", err)
 	}
 	defer func() {
 		_ = rows.Close()
 	}()
 
-	var keys []*APIKey
+	result := &KeyListResult{Total: total}
+	var lastCreatedAt string
 	for rows.Next() {
-		var key APIKey
-		var name, userID sql.NullString
-		var startsAt, expiresAt sql.NullTime
-		if err := rows.Scan(&key.Key, &name, &userID, &key.Status, &startsAt, &expiresAt, &key.CreatedAt, &key.UpdatedAt); err != nil {
-			return nil, 0, fmt.Errorf("扫描行失败: %w", err)
-		}
-		if name.Valid {
-			key.Name = name.String
-		}
-		if userID.Valid {
-			key.UserID = userID.String
-		}
-		if startsAt.Valid {
-			key.StartsAt = &startsAt.Time
+		if len(result.Keys) == params.Limit {
+			result.HasMore = true
+			break
 		}
-		if expiresAt.Valid {
-			key.ExpiresAt = &expiresAt.Time
+		var createdAt string
+		key, err := scanAPIKey(extraScanner{rows, []interface{}{&createdAt}})
+		if err != nil {
+			return nil, fmt.Errorf("扫描行失败: %w", err)
 		}
-		keys = append(keys, &key)
+		result.Keys = append(result.Keys, key)
+		lastCreatedAt = createdAt
 	}
 
-	return keys, total, nil
+	// 游标只在默认的 created_at 排序下有意义
+	if result.HasMore && sort == "created_at" && len(result.Keys) > 0 {
+		last := result.Keys[len(result.Keys)-1]
+		result.NextCursor = (&listCursor{CreatedAt: lastCreatedAt, Key: last.Key}).encode()
+	}
+	return result, nil
 }
 
 // SyncMode 同步模式
@@ -343,6 +637,8 @@ func (s *KeyStore) Sync(keys []*APIKey) error {
 //   - keys: API Key 列表
 //   - mode: 同步模式 (full=全量覆盖, incremental=增量更新)
 //
+// 增量模式下已存在 Key 的 used_quota 保持不变，避免覆盖已累计的用量
+//
 // 返回：
 //   - error: 错误信息
 func (s *KeyStore) SyncWithMode(keys []*APIKey, mode SyncMode) error {
@@ -369,8 +665,9 @@ func (s *KeyStore) SyncWithMode(keys []*APIKey, mode SyncMode) error {
 	if mode == SyncModeFull {
 		// 全量模式：直接插入
 		stmt, err := tx.Prepare(`
-		INSERT INTO api_keys (key, name, user_id, status, starts_at, expires_at, created_at, updated_at)
-		VALUES (?, ?, ?, ?, ?, ?, ?, ?)
+		INSERT INTO api_keys (key, name, user_id, status, starts_at, expires_at, created_at, updated_at,
+			total_quota, used_quota, quota_reset_period, rollover, rollover_cap, daily_cost_limit)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
 		`)
 		if err != nil {
 			return fmt.Errorf("准备语句失败: %w", err)
@@ -384,22 +681,29 @@ func (s *KeyStore) SyncWithMode(keys []*APIKey, mode SyncMode) error {
 				key.CreatedAt = now
 			}
 			key.UpdatedAt = now
-			if _, err := stmt.Exec(key.Key, key.Name, key.UserID, key.Status, key.StartsAt, key.ExpiresAt, key.CreatedAt, key.UpdatedAt); err != nil {
+			if _, err := stmt.Exec(s.storedKey(key.Key), key.Name, key.UserID, key.Status, key.StartsAt, key.ExpiresAt, key.CreatedAt, key.UpdatedAt,
+				key.TotalQuota, key.UsedQuota, key.QuotaResetPeriod, key.Rollover, key.RolloverCap, key.DailyCostLimit); err != nil {
 				return fmt.Errorf("插入 API Key 失败: %w", err)
 			}
 		}
 	} else {
 		// 增量模式：使用 UPSERT
 		stmt, err := tx.Prepare(`
-		INSERT INTO api_keys (key, name, user_id, status, starts_at, expires_at, created_at, updated_at)
-		VALUES (?, ?, ?, ?, ?, ?, ?, ?)
+		INSERT INTO api_keys (key, name, user_id, status, starts_at, expires_at, created_at, updated_at,
+			total_quota, used_quota, quota_reset_period, rollover, rollover_cap, daily_cost_limit)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
 		ON CONFLICT(key) DO UPDATE SET
 			name = excluded.name,
 			user_id = excluded.user_id,
 			status = excluded.status,
 			starts_at = excluded.starts_at,
 			expires_at = excluded.expires_at,
-			updated_at = excluded.updated_at
+			updated_at = excluded.updated_at,
+			total_quota = excluded.total_quota,
+			quota_reset_period = excluded.quota_reset_period,
+			rollover = excluded.rollover,
+			rollover_cap = excluded.rollover_cap,
+			daily_cost_limit = excluded.daily_cost_limit
 		`)
 		if err != nil {
 			return fmt.Errorf("准备语句失败: %w", err)
@@ -413,7 +717,15 @@ func (s *KeyStore) SyncWithMode(keys []*APIKey, mode SyncMode) error {
 				key.CreatedAt = now
 			}
 			key.UpdatedAt = now
-			if _, err := stmt.Exec(key.Key, key.Name, key.UserID, key.Status, key.StartsAt, key.ExpiresAt, key.CreatedAt, key.UpdatedAt); err != nil {
+			stored := s.storedKey(key.Key)
+			if stored != key.Key {
+				// 哈希模式：已存在的明文记录先转为哈希，保证 UPSERT 命中同一行
+				if _, err := tx.Exec(`UPDATE api_keys SET key = ? WHERE key = ?`, stored, key.Key); err != nil {
+					return fmt.Errorf("迁移 API Key 失败: %w", err)
+				}
+			}
+			if _, err := stmt.Exec(stored, key.Name, key.UserID, key.Status, key.StartsAt, key.ExpiresAt, key.CreatedAt, key.UpdatedAt,
+				key.TotalQuota, key.UsedQuota, key.QuotaResetPeriod, key.Rollover, key.RolloverCap, key.DailyCostLimit); err != nil {
 				return fmt.Errorf("插入/更新 API Key 失败: %w", err)
 			}
 		}
@@ -446,13 +758,44 @@ func (s *KeyStore) Exists(keyStr string) bool {
 	defer s.mu.RUnlock()
 
 	var count int
-	query := `SELECT COUNT(*) FROM api_keys WHERE key = ?`
-	if err := s.db.QueryRow(query, keyStr).Scan(&count); err != nil {
+	where, args := keyWhere(keyStr)
+	query := `SELECT COUNT(*) FROM api_keys WHERE ` + where
+	if err := s.db.QueryRow(query, args...).Scan(&count); err != nil {
 		return false
 	}
 	return count > 0
 }
 
+// EachActive 遍历所有 active 状态的 Key（用于预热鉴权缓存）
+// 参数：
+//   - fn: 处理函数，返回错误时停止遍历
+//
+// 返回：
+//   - error: 错误信息
+func (s *KeyStore) EachActive(fn func(key *APIKey) error) error {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	rows, err := s.db.Query(`SELECT `+keyColumns+` FROM api_keys WHERE status = ?`, KeyStatusActive)
+	if err != nil {
+		return fmt.Errorf("查询 API Key 失败: %w", err)
+	}
+	defer func() {
+		_ = rows.Close()
+	}()
+
+	for rows.Next() {
+		key, err := scanAPIKey(rows)
+		if err != nil {
+			return fmt.Errorf("扫描行失败: %w", err)
+		}
+		if err := fn(key); err != nil {
+			return err
+		}
+	}
+	return rows.Err()
+}
+
 // GetDB 获取数据库连接（供外部使用，如用量存储）
 // 返回：
 //   - *sql.DB: 数据库连接
@@ -0,0 +1,351 @@
+package admin
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+)
+
+// testAdminToken 测试用 Admin Token
+const testAdminToken = "test-admin-token"
+
+// newTestKeyStore 在临时目录创建 KeyStore
+func newTestKeyStore(t *testing.T) *KeyStore {
+	t.Helper()
+	store, err := NewKeyStore(filepath.Join(t.TempDir(), "keys.db"))
+	if err != nil {
+		t.Fatalf("NewKeyStore() error = %v", err)
+	}
+	t.Cleanup(func() { _ = store.Close() })
+	return store
+}
+
+// newTestServer 创建使用临时 KeyStore 的 Admin API，返回服务器和路由
+func newTestServer(t *testing.T) (*Server, http.Handler) {
+	t.Helper()
+	s := NewServer(newTestKeyStore(t), testAdminToken, "")
+	mux := http.NewServeMux()
+	s.RegisterRoutes(mux)
+	return s, mux
+}
+
+// doAdmin 以 Admin Token 发送请求（body 为 nil 时不带请求体），返回响应记录
+func doAdmin(t *testing.T, h http.Handler, method, path string, body interface{}) *httptest.ResponseRecorder {
+	t.Helper()
+	var buf bytes.Buffer
+	if body != nil {
+		if err := json.NewEncoder(&buf).Encode(body); err != nil {
+			t.Fatal(err)
+		}
+	}
+	req := httptest.NewRequest(method, path, &buf)
+	req.Header.Set("X-Admin-Token", testAdminToken)
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+	return rec
+}
+
+// decodeResponse 解析 Admin API 响应，data 非 nil 时解析到 data
+func decodeResponse(t *testing.T, rec *httptest.ResponseRecorder, data interface{}) Response {
+	t.Helper()
+	var raw struct {
+		Response
+		Data json.RawMessage `json:"data"`
+	}
+	if err := json.Unmarshal(rec.Body.Bytes(), &raw); err != nil {
+		t.Fatalf("响应不是 JSON: %v: %s", err, rec.Body.String())
+	}
+	if data != nil && len(raw.Data) > 0 {
+		if err := json.Unmarshal(raw.Data, data); err != nil {
+			t.Fatalf("解析 data 失败: %v: %s", err, raw.Data)
+		}
+	}
+	return raw.Response
+}
+
+// mustCreate 创建 Key，失败时终止测试
+func mustCreate(t *testing.T, store *KeyStore, key *APIKey) {
+	t.Helper()
+	if err := store.Create(key); err != nil {
+		t.Fatalf("Create(%s) error = %v", key.Key, err)
+	}
+}
+
+// mustGet 读取 Key，不存在时终止测试
+func mustGet(t *testing.T, store *KeyStore, keyStr string) *APIKey {
+	t.Helper()
+	key, err := store.Get(keyStr)
+	if err != nil || key == nil {
+		t.Fatalf("Get(%s) = %v, %v", keyStr, key, err)
+	}
+	return key
+}
+
+func TestKeyStoreQuotaColumnsRoundTrip(t *testing.T) {
+	store := newTestKeyStore(t)
+	mustCreate(t, store, &APIKey{Key: "sk-quota", UserID: "u1", TotalQuota: 1000, UsedQuota: 250, QuotaResetPeriod: "monthly"})
+
+	got := mustGet(t, store, "sk-quota")
+	if got.TotalQuota != 1000 || got.UsedQuota != 250 || got.QuotaResetPeriod != "monthly" || got.LastResetAt != nil {
+		t.Errorf("Get() = %+v", got)
+	}
+
+	// Update 修改总额度和周期，不覆盖已用额度
+	got.TotalQuota = 2000
+	got.UsedQuota = 0
+	got.QuotaResetPeriod = "daily"
+	if err := store.Update(got); err != nil {
+		t.Fatal(err)
+	}
+	got = mustGet(t, store, "sk-quota")
+	if got.TotalQuota != 2000 || got.UsedQuota != 250 || got.QuotaResetPeriod != "daily" {
+		t.Errorf("after Update() = %+v", got)
+	}
+}
+
+func TestKeyStoreDailyCostLimit(t *testing.T) {
+	s, h := newTestServer(t)
+
+	rec := doAdmin(t, h, http.MethodPost, "/admin/keys/create", CreateRequest{Key: "sk-cost", StartsAt: "2026-01-01T00:00:00Z", DailyCostLimit: 10})
+	if rec.Code != http.StatusOK {
+		t.Fatalf("create: status = %d, body = %s", rec.Code, rec.Body)
+	}
+	if got := mustGet(t, s.keyStore, "sk-cost").DailyCostLimit; got != 10 {
+		t.Errorf("after create: daily_cost_limit = %v, want 10", got)
+	}
+
+	limit := 2.5
+	rec = doAdmin(t, h, http.MethodPost, "/admin/keys/update", UpdateRequest{Key: "sk-cost", DailyCostLimit: &limit})
+	if rec.Code != http.StatusOK {
+		t.Fatalf("update: status = %d, body = %s", rec.Code, rec.Body)
+	}
+	if got := mustGet(t, s.keyStore, "sk-cost").DailyCostLimit; got != 2.5 {
+		t.Errorf("after update: daily_cost_limit = %v, want 2.5", got)
+	}
+
+	// 增量同步覆盖上限
+	if err := s.keyStore.SyncWithMode([]*APIKey{{Key: "sk-cost", DailyCostLimit: 4}}, SyncModeIncremental); err != nil {
+		t.Fatal(err)
+	}
+	if got := mustGet(t, s.keyStore, "sk-cost").DailyCostLimit; got != 4 {
+		t.Errorf("after sync: daily_cost_limit = %v, want 4", got)
+	}
+}
+
+// seedListKeys 创建列表筛选测试用的 Key
+func seedListKeys(t *testing.T, store *KeyStore) {
+	t.Helper()
+	keys := []*APIKey{
+		{Key: "sk-prod-aaa", Name: "Alice prod", UserID: "alice", UsedQuota: 30},
+		{Key: "sk-prod-bbb", Name: "Bob prod", UserID: "bob", Status: KeyStatusDisabled, UsedQuota: 10},
+		{Key: "sk-test-ccc", Name: "Alice test", UserID: "alice", UsedQuota: 20},
+		{Key: "sk-test-ddd", Name: "50%_off promo", UserID: "carol", Status: KeyStatusQuotaExceeded},
+		{Key: "sk-prod_eee", Name: "underscore", UserID: "carol"},
+	}
+	for _, key := range keys {
+		mustCreate(t, store, key)
+	}
+}
+
+// listKeyNames 返回列表结果中的 Key
+func listKeyNames(keys []*APIKey) string {
+	names := make([]string, len(keys))
+	for i, key := range keys {
+		names[i] = key.Key
+	}
+	return strings.Join(names, ",")
+}
+
+func TestKeyStoreListFilters(t *testing.T) {
+	store := newTestKeyStore(t)
+	seedListKeys(t, store)
+	status := func(s KeyStatus) *KeyStatus { return &s }
+
+	tests := []struct {
+		name   string
+		params KeyListParams
+		want   string // 按 key 升序排列的期望结果
+	}{
+		{"无筛选", KeyListParams{}, "sk-prod-aaa,sk-prod-bbb,sk-prod_eee,sk-test-ccc,sk-test-ddd"},
+		{"按状态", KeyListParams{Status: status(KeyStatusActive)}, "sk-prod-aaa,sk-prod_eee,sk-test-ccc"},
+		{"按禁用状态", KeyListParams{Status: status(KeyStatusDisabled)}, "sk-prod-bbb"},
+		{"按用户", KeyListParams{UserID: "alice"}, "sk-prod-aaa,sk-test-ccc"},
+		{"按 Key 前缀", KeyListParams{KeyPrefix: "sk-test-"}, "sk-test-ccc,sk-test-ddd"},
+		{"前缀中的下划线按字面匹配", KeyListParams{KeyPrefix: "sk-prod_"}, "sk-prod_eee"},
+		{"按名称子串", KeyListParams{Name: "prod"}, "sk-prod-aaa,sk-prod-bbb"},
+		{"名称中的百分号按字面匹配", KeyListParams{Name: "50%"}, "sk-test-ddd"},
+		{"用户 + 前缀", KeyListParams{UserID: "alice", KeyPrefix: "sk-prod"}, "sk-prod-aaa"},
+		{"状态 + 名称", KeyListParams{Status: status(KeyStatusActive), Name: "Alice"}, "sk-prod-aaa,sk-test-ccc"},
+		{"用户 + 状态 + 前缀", KeyListParams{UserID: "carol", Status: status(KeyStatusQuotaExceeded), KeyPrefix: "sk-test"}, "sk-test-ddd"},
+		{"没有匹配", KeyListParams{UserID: "alice", Status: status(KeyStatusDisabled)}, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			params := tt.params
+			params.Sort = "name"
+			params.Limit = 100
+			result, err := store.List(&params)
+			if err != nil {
+				t.Fatalf("List() error = %v", err)
+			}
+			keys := strings.Split(listKeyNames(result.Keys), ",")
+			sort.Strings(keys)
+			got := strings.Join(keys, ",")
+			if got != tt.want {
+				t.Errorf("List() = %s, want %s", got, tt.want)
+			}
+			if result.Total != len(result.Keys) || result.HasMore {
+				t.Errorf("Total = %d, HasMore = %v; want %d, false", result.Total, result.HasMore, len(result.Keys))
+			}
+		})
+	}
+}
+
+func TestKeyStoreListSortAndTotal(t *testing.T) {
+	store := newTestKeyStore(t)
+	seedListKeys(t, store)
+
+	// 按已用额度降序，相同值按 key 升序
+	result, err := store.List(&KeyListParams{Sort: "used_quota", Limit: 10})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := listKeyNames(result.Keys); got != "sk-prod-aaa,sk-test-ccc,sk-prod-bbb,sk-prod_eee,sk-test-ddd" {
+		t.Errorf("sort used_quota desc = %s", got)
+	}
+
+	result, err = store.List(&KeyListParams{Sort: "name", Order: "asc", Limit: 10})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := listKeyNames(result.Keys); got != "sk-test-ddd,sk-prod-aaa,sk-test-ccc,sk-prod-bbb,sk-prod_eee" {
+		t.Errorf("sort name asc = %s", got)
+	}
+
+	// total 是筛选后的总数，与分页无关
+	result, err = store.List(&KeyListParams{UserID: "alice", Sort: "name", Order: "asc", Limit: 1, Offset: 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.Total != 2 || listKeyNames(result.Keys) != "sk-test-ccc" || result.HasMore {
+		t.Errorf("page 2 of alice: total = %d, keys = %s, has_more = %v", result.Total, listKeyNames(result.Keys), result.HasMore)
+	}
+
+	if _, err := store.List(&KeyListParams{Sort: "key; DROP TABLE api_keys", Limit: 10}); err == nil {
+		t.Error("List() with unknown sort column: error = nil")
+	}
+}
+
+func TestListEndpointFilters(t *testing.T) {
+	s, h := newTestServer(t)
+	seedListKeys(t, s.keyStore)
+
+	status := int(KeyStatusActive)
+	rec := doAdmin(t, h, http.MethodPost, "/admin/keys/list", ListRequest{Status: &status, UserID: "alice", Sort: "name", Order: "asc"})
+	var list ListResponse
+	decodeResponse(t, rec, &list)
+	if rec.Code != http.StatusOK || list.Total != 2 || listKeyNames(list.Keys) != "sk-prod-aaa,sk-test-ccc" {
+		t.Errorf("list = %d %s", rec.Code, rec.Body)
+	}
+
+	for _, req := range []ListRequest{{Sort: "password"}, {Order: "sideways"}} {
+		if rec := doAdmin(t, h, http.MethodPost, "/admin/keys/list", req); rec.Code != http.StatusBadRequest {
+			t.Errorf("list %+v: status = %d, want 400", req, rec.Code)
+		}
+	}
+}
+
+// remainingKeys 返回 KeyStore 中剩余的全部 Key（按 key 排序）
+func remainingKeys(t *testing.T, store *KeyStore) string {
+	t.Helper()
+	result, err := store.List(&KeyListParams{Sort: "name", Limit: 1000})
+	if err != nil {
+		t.Fatal(err)
+	}
+	names := make([]string, len(result.Keys))
+	for i, key := range result.Keys {
+		names[i] = key.Key
+	}
+	sort.Strings(names)
+	return strings.Join(names, ",")
+}
+
+// seedExpiringKeys 创建已过期、未过期和不过期的 Key
+func seedExpiringKeys(t *testing.T, store *KeyStore) {
+	t.Helper()
+	past := time.Now().Add(-time.Hour)
+	future := time.Now().Add(time.Hour)
+	mustCreate(t, store, &APIKey{Key: "sk-expired-a", UserID: "alice", Status: KeyStatusExpired, ExpiresAt: &past})
+	mustCreate(t, store, &APIKey{Key: "sk-expired-b", UserID: "bob", ExpiresAt: &past})
+	mustCreate(t, store, &APIKey{Key: "sk-future", UserID: "alice", ExpiresAt: &future})
+	mustCreate(t, store, &APIKey{Key: "sk-forever", UserID: "alice"})
+	mustCreate(t, store, &APIKey{Key: "sk-disabled", UserID: "bob", Status: KeyStatusDisabled})
+}
+
+func TestKeyStoreBulkDelete(t *testing.T) {
+	now := time.Now()
+	expired := KeyStatusExpired
+	disabled := KeyStatusDisabled
+	tests := []struct {
+		name   string
+		filter KeyDeleteFilter
+		want   int64
+		remain string
+	}{
+		{"按列表", KeyDeleteFilter{Keys: []string{"sk-future", "sk-forever", "sk-missing"}}, 2, "sk-disabled,sk-expired-a,sk-expired-b"},
+		{"按状态", KeyDeleteFilter{Status: &expired}, 1, "sk-disabled,sk-expired-b,sk-forever,sk-future"},
+		{"按过期时间", KeyDeleteFilter{ExpiresBefore: &now}, 2, "sk-disabled,sk-forever,sk-future"},
+		{"多个条件为 AND", KeyDeleteFilter{UserID: "bob", Status: &disabled}, 1, "sk-expired-a,sk-expired-b,sk-forever,sk-future"},
+		{"列表 + 用户", KeyDeleteFilter{Keys: []string{"sk-expired-a", "sk-expired-b"}, UserID: "alice"}, 1, "sk-disabled,sk-expired-b,sk-forever,sk-future"},
+		{"确认后删除全部", KeyDeleteFilter{All: true}, 5, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			store := newTestKeyStore(t)
+			seedExpiringKeys(t, store)
+			count, err := store.BulkDelete(&tt.filter)
+			if err != nil {
+				t.Fatalf("BulkDelete() error = %v", err)
+			}
+			if count != tt.want {
+				t.Errorf("BulkDelete() = %d, want %d", count, tt.want)
+			}
+			if got := remainingKeys(t, store); got != tt.remain {
+				t.Errorf("remaining = %q, want %q", got, tt.remain)
+			}
+		})
+	}
+
+	// 未设置任何条件且未确认时不删除
+	store := newTestKeyStore(t)
+	seedExpiringKeys(t, store)
+	if _, err := store.BulkDelete(&KeyDeleteFilter{}); err == nil {
+		t.Error("BulkDelete() with empty filter: error = nil")
+	}
+	if got := remainingKeys(t, store); strings.Count(got, ",") != 4 {
+		t.Errorf("keys deleted by empty filter: remaining %q", got)
+	}
+}
+
+func TestKeyStoreBulkDeleteHashed(t *testing.T) {
+	store := newTestKeyStore(t)
+	mustCreate(t, store, &APIKey{Key: "sk-legacy"})
+	store.SetHashKeys(true)
+	mustCreate(t, store, &APIKey{Key: "sk-hashed"})
+	mustCreate(t, store, &APIKey{Key: "sk-keep"})
+
+	// 明文 Key 同时匹配明文和哈希存储的记录
+	count, err := store.BulkDelete(&KeyDeleteFilter{Keys: []string{"sk-legacy", "sk-hashed"}})
+	if err != nil || count != 2 {
+		t.Fatalf("BulkDelete() = %d, %v; want 2", count, err)
+	}
+	if got := remainingKeys(t, store); got != HashKey("sk-keep") {
+		t.Errorf("remaining = %q", got)
+	}
+}
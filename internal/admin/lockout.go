@@ -0,0 +1,141 @@
+package admin
+
+import (
+	"net"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// 默认的错误 Token 锁定参数
+const (
+	DefaultLockoutThreshold = 5                // 窗口内允许的失败次数
+	DefaultLockoutWindow    = 5 * time.Minute  // 失败计数窗口
+	DefaultLockoutDuration  = 15 * time.Minute // 锁定时长
+
+	lockoutPruneSize = 10000 // 记录数超过该值时清理过期记录
+)
+
+// lockoutEntry 单个来源的失败记录
+type lockoutEntry struct {
+	failures     int       // 窗口内失败次数
+	windowStart  time.Time // 窗口开始时间
+	blockedUntil time.Time // 锁定截止时间
+}
+
+// lockout 按来源 IP 统计错误 Token 次数，超过阈值后临时锁定
+type lockout struct {
+	mu        sync.Mutex
+	threshold int
+	window    time.Duration
+	duration  time.Duration
+	entries   map[string]*lockoutEntry
+	now       func() time.Time
+}
+
+// newLockout 创建错误 Token 锁定器
+// 参数：
+//   - threshold: 窗口内允许的失败次数（<= 0 时使用默认值）
+//   - window: 失败计数窗口（<= 0 时使用默认值）
+//   - duration: 锁定时长（<= 0 时使用默认值）
+//
+// 返回：
+//   - *lockout: 锁定器实例
+func newLockout(threshold int, window, duration time.Duration) *lockout {
+	if threshold <= 0 {
+		threshold = DefaultLockoutThreshold
+	}
+	if window <= 0 {
+		window = DefaultLockoutWindow
+	}
+	if duration <= 0 {
+		duration = DefaultLockoutDuration
+	}
+	return &lockout{
+		threshold: threshold,
+		window:    window,
+		duration:  duration,
+		entries:   make(map[string]*lockoutEntry),
+		now:       time.Now,
+	}
+}
+
+// blocked 检查来源是否处于锁定状态
+// 返回：
+//   - time.Duration: 剩余锁定时长（未锁定时为 0）
+func (l *lockout) blocked(ip string) time.Duration {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	entry, ok := l.entries[ip]
+	if !ok {
+		return 0
+	}
+	if remaining := entry.blockedUntil.Sub(l.now()); remaining > 0 {
+		return remaining
+	}
+	return 0
+}
+
+// fail 记录一次失败，达到阈值时锁定该来源
+// 返回：
+//   - bool: 本次失败是否触发锁定
+func (l *lockout) fail(ip string) bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := l.now()
+	if len(l.entries) > lockoutPruneSize {
+		l.prune(now)
+	}
+
+	entry, ok := l.entries[ip]
+	if !ok || now.Sub(entry.windowStart) > l.window {
+		entry = &lockoutEntry{windowStart: now}
+		l.entries[ip] = entry
+	}
+
+	entry.failures++
+	if entry.failures >= l.threshold {
+		entry.blockedUntil = now.Add(l.duration)
+		entry.failures = 0
+		entry.windowStart = now
+		return true
+	}
+	return false
+}
+
+// succeed 鉴权成功后清除该来源的失败记录
+func (l *lockout) succeed(ip string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	delete(l.entries, ip)
+}
+
+// prune 清理窗口和锁定均已过期的记录（调用方需持有锁）
+func (l *lockout) prune(now time.Time) {
+	for ip, entry := range l.entries {
+		if now.After(entry.blockedUntil) && now.Sub(entry.windowStart) > l.window {
+			delete(l.entries, ip)
+		}
+	}
+}
+
+// SetLockout 设置错误 Token 锁定参数
+// 同一来源 IP 在 window 内连续 threshold 次使用错误 Token 后，锁定 duration，期间返回 429
+// 参数：
+//   - threshold: 窗口内允许的失败次数（<= 0 时使用默认值 5）
+//   - window: 失败计数窗口（<= 0 时使用默认值 5 分钟）
+//   - duration: 锁定时长（<= 0 时使用默认值 15 分钟）
+func (s *Server) SetLockout(threshold int, window, duration time.Duration) {
+	s.lockout = newLockout(threshold, window, duration)
+}
+
+// remoteIP 返回连接的对端 IP
+// 锁定按连接地址计数，不信任可伪造的 X-Forwarded-For
+func remoteIP(r *http.Request) string {
+	if host, _, err := net.SplitHostPort(r.RemoteAddr); err == nil {
+		return host
+	}
+	return r.RemoteAddr
+}
@@ -0,0 +1,121 @@
+package admin
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+// fakeClock 可手动推进的时钟
+type fakeClock struct{ t time.Time }
+
+func (c *fakeClock) now() time.Time { return c.t }
+
+func (c *fakeClock) advance(d time.Duration) { c.t = c.t.Add(d) }
+
+// tokenRequest 以指定 Token 和来源地址请求列表接口，返回状态码
+func tokenRequest(h http.Handler, token, remoteAddr string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(http.MethodPost, "/admin/keys/list", strings.NewReader(`{}`))
+	req.RemoteAddr = remoteAddr
+	if token != "" {
+		req.Header.Set("X-Admin-Token", token)
+	}
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+	return rec
+}
+
+func TestLockoutTriggersAndClears(t *testing.T) {
+	s, h := newTestServer(t)
+	s.SetLockout(3, time.Minute, 10*time.Minute)
+	clock := &fakeClock{t: time.Date(2026, 3, 15, 10, 0, 0, 0, time.UTC)}
+	s.lockout.now = clock.now
+
+	const attacker = "203.0.113.7:4000"
+
+	// 阈值之前返回 403，缺少 Token 同样计为失败
+	for i, token := range []string{"wrong-1", ""} {
+		if rec := tokenRequest(h, token, attacker); rec.Code != http.StatusForbidden && rec.Code != http.StatusUnauthorized {
+			t.Fatalf("attempt %d: status = %d, want 401/403", i+1, rec.Code)
+		}
+	}
+	if rec := tokenRequest(h, "wrong-3", attacker); rec.Code != http.StatusForbidden {
+		t.Fatalf("attempt 3: status = %d, want 403", rec.Code)
+	}
+
+	// 锁定期间即使 Token 正确也返回 429 和 Retry-After
+	rec := tokenRequest(h, testAdminToken, attacker)
+	if rec.Code != http.StatusTooManyRequests {
+		t.Fatalf("locked: status = %d, want 429", rec.Code)
+	}
+	if got := rec.Header().Get("Retry-After"); got != "601" {
+		t.Errorf("Retry-After = %q, want 601", got)
+	}
+
+	// 锁定只影响该来源
+	if rec := tokenRequest(h, testAdminToken, "198.51.100.1:5000"); rec.Code != http.StatusOK {
+		t.Errorf("other source: status = %d, want 200", rec.Code)
+	}
+
+	clock.advance(9 * time.Minute)
+	rec = tokenRequest(h, testAdminToken, attacker)
+	if rec.Code != http.StatusTooManyRequests {
+		t.Errorf("before lockout ends: status = %d, want 429", rec.Code)
+	}
+	if got := rec.Header().Get("Retry-After"); got != "61" {
+		t.Errorf("Retry-After = %q, want 61", got)
+	}
+
+	// 锁定到期后恢复
+	clock.advance(time.Minute + time.Second)
+	if rec := tokenRequest(h, testAdminToken, attacker); rec.Code != http.StatusOK {
+		t.Errorf("after lockout: status = %d, want 200", rec.Code)
+	}
+}
+
+func TestLockoutWindowExpires(t *testing.T) {
+	l := newLockout(3, time.Minute, 10*time.Minute)
+	clock := &fakeClock{t: time.Date(2026, 3, 15, 10, 0, 0, 0, time.UTC)}
+	l.now = clock.now
+
+	// 窗口过期后重新计数，不触发锁定
+	l.fail("ip")
+	l.fail("ip")
+	clock.advance(time.Minute + time.Second)
+	if l.fail("ip") {
+		t.Fatal("failure after window expiry triggered lockout")
+	}
+	if l.fail("ip") {
+		t.Fatal("second failure in new window triggered lockout")
+	}
+	if !l.fail("ip") {
+		t.Fatal("third failure in window did not trigger lockout")
+	}
+	if l.blocked("ip") != 10*time.Minute {
+		t.Errorf("blocked() = %v, want 10m", l.blocked("ip"))
+	}
+}
+
+func TestLockoutResetOnSuccess(t *testing.T) {
+	l := newLockout(3, time.Minute, 10*time.Minute)
+
+	// 成功鉴权清除失败计数
+	l.fail("ip")
+	l.fail("ip")
+	l.succeed("ip")
+	if l.fail("ip") || l.fail("ip") {
+		t.Fatal("lockout triggered after counter was reset by a success")
+	}
+	if l.blocked("ip") != 0 {
+		t.Error("blocked() != 0 before threshold")
+	}
+}
+
+func TestNewLockoutDefaults(t *testing.T) {
+	l := newLockout(0, 0, -1)
+	if l.threshold != DefaultLockoutThreshold || l.window != DefaultLockoutWindow || l.duration != DefaultLockoutDuration {
+		t.Errorf("newLockout(0, 0, -1) = %d, %v, %v", l.threshold, l.window, l.duration)
+	}
+}
@@ -0,0 +1,335 @@
+package admin
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"log"
+	"time"
+)
+
+// rolloverSet 重置额度时维护 rollover_quota 的 SQL 片段（SET 中的列均为更新前的值）
+// 开启结转时保留上一周期的未用额度（total_quota + rollover_quota - used_quota），
+// 不超过 rollover_cap（未配置时不超过 total_quota），与 auth.ResetQuotaIfNeeded 一致
+const rolloverSet = `rollover_quota = CASE WHEN rollover != 0 AND total_quota > 0
+		THEN MAX(0, MIN(total_quota + rollover_quota - used_quota, CASE WHEN rollover_cap > 0 THEN rollover_cap ELSE total_quota END))
+		ELSE 0 END`
+
+// IncrementUsedQuota 增加已使用额度（原子操作）
+// 已用额度达到本周期可用额度（total_quota + rollover_quota）时，正常状态的 Key 转为 quota_exceeded
+// 参数：
+//   - keyStr: API Key 字符串
+//   - tokens: 消耗的 tokens
+//
+// 返回：
+//   - error: 错误信息
+func (s *KeyStore) IncrementUsedQuota(keyStr string, tokens int64) error {
+	if tokens <= 0 {
+		return nil
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	// 启用事件通知时记录更新前的状态，用于判断本次是否转为 quota_exceeded
+	wasActive := false
+	if s.events != nil {
+		if old, err := s.get(keyStr); err == nil && old != nil {
+			wasActive = old.Status == KeyStatusActive
+		}
+	}
+
+	where, whereArgs := keyWhere(keyStr)
+	query := `
+	UPDATE api_keys
+	SET used_quota = used_quota + ?, updated_at = ?,
+		status = CASE WHEN status = ? AND total_quota > 0 AND used_quota + ? >= total_quota + rollover_quota THEN ? ELSE status END
+	WHERE ` + where
+	args := append([]interface{}{tokens, time.Now(), KeyStatusActive, tokens, KeyStatusQuotaExceeded}, whereArgs...)
+	result, err := s.db.Exec(query, args...)
+	if err != nil {
+		return fmt.Errorf("增加已用额度失败: %w", err)
+	}
+
+	rows, _ := result.RowsAffected()
+	if rows == 0 {
+		return fmt.Errorf("API Key 不存在")
+	}
+
+	if wasActive {
+		if key, err := s.get(keyStr); err == nil && key != nil && key.Status == KeyStatusQuotaExceeded {
+			s.notify(KeyEventQuotaExceeded, keyStr, key)
+		}
+	}
+	return nil
+}
+
+// ResetQuota 重置额度（已用额度清零，last_reset_at 设为当前时间）
+// 开启 rollover 的 Key 结转未用额度；因额度耗尽而处于 quota_exceeded 状态的 Key 同时恢复为 active
+// 参数：
+//   - keyStr: API Key 字符串（与 userID 二选一）
+//   - userID: 用户标识（重置该用户的所有 Key）
+//
+// 返回：
+//   - int64: 重置的 Key 数量
+//   - error: 错误信息
+func (s *KeyStore) ResetQuota(keyStr, userID string) (int64, error) {
+	if keyStr == "" && userID == "" {
+		return 0, fmt.Errorf("key 和 user_id 不能同时为空")
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	where, whereArgs := "user_id = ?", []interface{}{userID}
+	if keyStr != "" {
+		where, whereArgs = keyWhere(keyStr)
+	}
+
+	now := time.Now()
+	query := `
+	UPDATE api_keys
+	SET ` + rolloverSet + `, used_quota = 0, last_reset_at = ?, updated_at = ?,
+		status = CASE WHEN status = ? THEN ? ELSE status END
+	WHERE ` + where
+	args := append([]interface{}{now, now, KeyStatusQuotaExceeded, KeyStatusActive}, whereArgs...)
+	result, err := s.db.Exec(query, args...)
+	if err != nil {
+		return 0, fmt.Errorf("重置额度失败: %w", err)
+	}
+
+	rows, _ := result.RowsAffected()
+	log.Printf("KeyStore: 已重置 %d 个 Key 的额度", rows)
+	return rows, nil
+}
+
+// ResetDueQuotas 按 quota_reset_period 重置到期的额度
+// 周期按自然日 / 自然周（ISO）/ 自然月计算：上次重置（未重置过则为创建时间）
+// 与当前时间不在同一周期内即重置；开启 rollover 的 Key 结转未用额度
+// 参数：
+//   - now: 当前时间
+//
+// 返回：
+//   - int64: 重置的 Key 数量
+//   - error: 错误信息
+func (s *KeyStore) ResetDueQuotas(now time.Time) (int64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	query := `
+	SELECT key, quota_reset_period, last_reset_at, created_at
+	FROM api_keys
+	WHERE quota_reset_period IN ('daily', 'weekly', 'monthly')
+	`
+	rows, err := s.db.Query(query)
+	if err != nil {
+		return 0, fmt.Errorf("查询待重置 Key 失败: %w", err)
+	}
+
+	var due []string
+	for rows.Next() {
+		var key, period string
+		var lastResetAt sql.NullTime
+		var createdAt time.Time
+		if err := rows.Scan(&key, &period, &lastResetAt, &createdAt); err != nil {
+			_ = rows.Close()
+			return 0, fmt.Errorf("扫描行失败: %w", err)
+		}
+		last := createdAt
+		if lastResetAt.Valid {
+			last = lastResetAt.Time
+		}
+		if quotaResetDue(period, last, now) {
+			due = append(due, key)
+		}
+	}
+	_ = rows.Close()
+	if len(due) == 0 {
+		return 0, nil
+	}
+
+	tx, err := s.db.Begin()
+	if err != nil {
+		return 0, fmt.Errorf("开始事务失败: %w", err)
+	}
+	defer func() {
+		_ = tx.Rollback() // 忽略回滚错误，因为可能已 Commit
+	}()
+
+	stmt, err := tx.Prepare(`
+	UPDATE api_keys
+	SET ` + rolloverSet + `, used_quota = 0, last_reset_at = ?, updated_at = ?,
+		status = CASE WHEN status = ? THEN ? ELSE status END
+	WHERE key = ?
+	`)
+	if err != nil {
+		return 0, fmt.Errorf("准备语句失败: %w", err)
+	}
+	defer func() {
+		_ = stmt.Close()
+	}()
+
+	for _, key := range due {
+		if _, err := stmt.Exec(now, now, KeyStatusQuotaExceeded, KeyStatusActive, key); err != nil {
+			return 0, fmt.Errorf("重置额度失败: %w", err)
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return 0, fmt.Errorf("提交事务失败: %w", err)
+	}
+
+	log.Printf("KeyStore: 已按周期重置 %d 个 Key 的额度", len(due))
+	return int64(len(due)), nil
+}
+
+// StartQuotaResetJob 启动额度周期重置任务
+// 参数：
+//   - ctx: 上下文，用于停止任务
+//   - interval: 检查间隔（<= 0 时默认 1 分钟）
+func (s *KeyStore) StartQuotaResetJob(ctx context.Context, interval time.Duration) {
+	if interval <= 0 {
+		interval = time.Minute
+	}
+
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for {
+			if _, err := s.ResetDueQuotas(time.Now()); err != nil {
+				log.Printf("额度周期重置失败: %v", err)
+			}
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+		}
+	}()
+}
+
+// NextQuotaReset 计算下一次周期重置时间（与 quotaResetDue 的自然周期一致）
+// 重置由后台任务按检查间隔执行，实际重置可能比返回时间晚一个检查间隔
+// 参数：
+//   - period: 重置周期（daily / weekly / monthly）
+//   - now: 当前时间
+//
+// 返回：
+//   - time.Time: 下一次重置时间（下一个自然日 / ISO 周一 / 自然月的零点）
+//   - bool: 是否会周期重置（never 或空时为 false）
+func NextQuotaReset(period string, now time.Time) (time.Time, bool) {
+	y, m, d := now.Date()
+	switch period {
+	case "daily":
+		return time.Date(y, m, d+1, 0, 0, 0, 0, now.Location()), true
+	case "weekly":
+		// ISO 周从周一开始
+		days := (8 - int(now.Weekday())) % 7
+		if days == 0 {
+			days = 7
+		}
+		return time.Date(y, m, d+days, 0, 0, 0, 0, now.Location()), true
+	case "monthly":
+		return time.Date(y, m+1, 1, 0, 0, 0, 0, now.Location()), true
+	}
+	return time.Time{}, false
+}
+
+// quotaResetDue 判断额度是否到了重置时间
+// 参数：
+//   - period: 重置周期（daily / weekly / monthly）
+//   - last: 上次重置时间
+//   - now: 当前时间
+//
+// 返回：
+//   - bool: 是否需要重置
+func quotaResetDue(period string, last, now time.Time) bool {
+	last = last.In(now.Location())
+	switch period {
+	case "daily":
+		ly, lm, ld := last.Date()
+		ny, nm, nd := now.Date()
+		return ly != ny || lm != nm || ld != nd
+	case "weekly":
+		ly, lw := last.ISOWeek()
+		ny, nw := now.ISOWeek()
+		return ly != ny || lw != nw
+	case "monthly":
+		return last.Year() != now.Year() || last.Month() != now.Month()
+	}
+	return false
+}
+
+// maxKeyUsageKeys 按 user_id 查询用量时最多汇总的 Key 数量
+const maxKeyUsageKeys = 1000
+
+// KeyQuota 单个 Key 的额度情况
+type KeyQuota struct {
+	Key              string     `json:"key"`                          // API Key
+	Name             string     `json:"name,omitempty"`               // 名称/备注
+	Status           KeyStatus  `json:"status"`                       // 状态
+	TotalQuota       int64      `json:"total_quota"`                  // 总额度（0 表示不限制）
+	UsedQuota        int64      `json:"used_quota"`                   // 已用额度
+	Remaining        *int64     `json:"remaining"`                    // 剩余额度（不限制时为 null）
+	QuotaResetPeriod string     `json:"quota_reset_period,omitempty"` // 重置周期
+	LastResetAt      *time.Time `json:"last_reset_at,omitempty"`      // 上次重置时间
+	RolloverQuota    int64      `json:"rollover_quota,omitempty"`     // 本周期从上周期结转的额度
+}
+
+// remainingQuota 计算剩余额度
+// 参数：
+//   - total: 总额度（0 表示不限制）
+//   - rollover: 本周期结转的额度（计入可用额度）
+//   - used: 已用额度
+//
+// 返回：
+//   - *int64: 剩余额度（不小于 0；不限制时为 nil）
+func remainingQuota(total, rollover, used int64) *int64 {
+	if total <= 0 {
+		return nil
+	}
+	remaining := max(total+rollover-used, 0)
+	return &remaining
+}
+
+// summarizeQuota 汇总多个 Key 的额度
+// 剩余额度为各 Key 剩余额度之和；任一 Key 不限制额度时，汇总的总额度为 0、剩余额度为 nil
+// 参数：
+//   - keys: API Key 列表
+//
+// 返回：
+//   - *KeyUsageResponse: 各 Key 的额度和汇总值（不含用量统计）
+func summarizeQuota(keys []*APIKey) *KeyUsageResponse {
+	resp := &KeyUsageResponse{Keys: make([]*KeyQuota, 0, len(keys))}
+	unlimited := false
+	var remaining int64
+	for _, key := range keys {
+		quota := &KeyQuota{
+			Key:              key.Key,
+			Name:             key.Name,
+			Status:           key.Status,
+			TotalQuota:       key.TotalQuota,
+			UsedQuota:        key.UsedQuota,
+			Remaining:        remainingQuota(key.TotalQuota, key.RolloverQuota, key.UsedQuota),
+			QuotaResetPeriod: key.QuotaResetPeriod,
+			LastResetAt:      key.LastResetAt,
+			RolloverQuota:    key.RolloverQuota,
+		}
+		resp.Keys = append(resp.Keys, quota)
+		resp.UsedQuota += key.UsedQuota
+		if quota.Remaining == nil {
+			unlimited = true
+			continue
+		}
+		resp.TotalQuota += key.TotalQuota
+		remaining += *quota.Remaining
+	}
+	if unlimited {
+		resp.TotalQuota = 0
+		return resp
+	}
+	// 按 Key 分别计算后求和：某个 Key 超用不会抵扣其他 Key 的剩余额度
+	resp.Remaining = &remaining
+	return resp
+}
@@ -0,0 +1,438 @@
+package admin
+
+import (
+	"net/http"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestResetQuotaEndpoint(t *testing.T) {
+	s, h := newTestServer(t)
+	store := s.keyStore
+	mustCreate(t, store, &APIKey{Key: "sk-a1", UserID: "alice", Status: KeyStatusQuotaExceeded, TotalQuota: 100, UsedQuota: 100})
+	mustCreate(t, store, &APIKey{Key: "sk-a2", UserID: "alice", Status: KeyStatusDisabled, TotalQuota: 100, UsedQuota: 40})
+	mustCreate(t, store, &APIKey{Key: "sk-b1", UserID: "bob", TotalQuota: 100, UsedQuota: 70})
+
+	// 按 key 重置：已用额度清零，quota_exceeded 恢复为 active
+	before := time.Now()
+	rec := doAdmin(t, h, http.MethodPost, "/admin/keys/reset_quota", ResetQuotaRequest{Key: "sk-a1"})
+	if rec.Code != http.StatusOK {
+		t.Fatalf("reset by key: status = %d, body = %s", rec.Code, rec.Body)
+	}
+	var data map[string]int64
+	decodeResponse(t, rec, &data)
+	if data["reset"] != 1 {
+		t.Errorf("reset = %d, want 1", data["reset"])
+	}
+	key := mustGet(t, store, "sk-a1")
+	if key.UsedQuota != 0 || key.Status != KeyStatusActive || key.LastResetAt == nil || key.LastResetAt.Before(before.Add(-time.Second)) {
+		t.Errorf("after reset: %+v", key)
+	}
+
+	// 按 user_id 重置该用户的所有 Key，禁用状态保持不变，其他用户不受影响
+	rec = doAdmin(t, h, http.MethodPost, "/admin/keys/reset_quota", ResetQuotaRequest{UserID: "alice"})
+	decodeResponse(t, rec, &data)
+	if rec.Code != http.StatusOK || data["reset"] != 2 {
+		t.Fatalf("reset by user: status = %d, body = %s", rec.Code, rec.Body)
+	}
+	if key := mustGet(t, store, "sk-a2"); key.UsedQuota != 0 || key.Status != KeyStatusDisabled {
+		t.Errorf("sk-a2 after reset: %+v", key)
+	}
+	if key := mustGet(t, store, "sk-b1"); key.UsedQuota != 70 || key.LastResetAt != nil {
+		t.Errorf("sk-b1 should be untouched: %+v", key)
+	}
+
+	tests := []struct {
+		name string
+		req  ResetQuotaRequest
+		want int
+	}{
+		{"Key 不存在", ResetQuotaRequest{Key: "sk-missing"}, http.StatusNotFound},
+		{"用户没有 Key", ResetQuotaRequest{UserID: "nobody"}, http.StatusNotFound},
+		{"key 和 user_id 都为空", ResetQuotaRequest{}, http.StatusBadRequest},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := doAdmin(t, h, http.MethodPost, "/admin/keys/reset_quota", tt.req)
+			if rec.Code != tt.want {
+				t.Errorf("status = %d, want %d: %s", rec.Code, tt.want, rec.Body)
+			}
+		})
+	}
+}
+
+func TestQuotaResetDue(t *testing.T) {
+	shanghai := time.FixedZone("UTC+8", 8*3600)
+	at := func(s string) time.Time {
+		ts, err := time.ParseInLocation("2006-01-02 15:04:05", s, shanghai)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return ts
+	}
+
+	tests := []struct {
+		name   string
+		period string
+		last   time.Time
+		now    time.Time
+		want   bool
+	}{
+		{"每日: 同一天", "daily", at("2026-03-15 00:00:00"), at("2026-03-15 23:59:59"), false},
+		{"每日: 跨过零点", "daily", at("2026-03-14 23:59:59"), at("2026-03-15 00:00:00"), true},
+		{"每日: 按当前时区判断日期", "daily", at("2026-03-15 07:00:00").UTC(), at("2026-03-15 09:00:00"), false},
+		{"每周: 周一到周日为同一周", "weekly", at("2026-03-09 00:00:00"), at("2026-03-15 23:59:59"), false},
+		{"每周: 周日到周一", "weekly", at("2026-03-15 23:59:59"), at("2026-03-16 00:00:00"), true},
+		{"每周: 跨年的同一 ISO 周", "weekly", at("2026-12-31 12:00:00"), at("2027-01-01 12:00:00"), false},
+		{"每月: 同一月", "monthly", at("2026-03-01 00:00:00"), at("2026-03-31 23:59:59"), false},
+		{"每月: 跨月", "monthly", at("2026-01-31 23:59:59"), at("2026-02-01 00:00:00"), true},
+		{"每月: 不同年份的同一月", "monthly", at("2025-03-15 00:00:00"), at("2026-03-15 00:00:00"), true},
+		{"从不重置", "never", at("2020-01-01 00:00:00"), at("2026-03-15 00:00:00"), false},
+		{"未设置周期", "", at("2020-01-01 00:00:00"), at("2026-03-15 00:00:00"), false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := quotaResetDue(tt.period, tt.last, tt.now); got != tt.want {
+				t.Errorf("quotaResetDue(%q, %v, %v) = %v, want %v", tt.period, tt.last, tt.now, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestNextQuotaReset(t *testing.T) {
+	now := time.Date(2026, 3, 15, 10, 30, 0, 0, time.UTC) // 周日
+	tests := []struct {
+		period string
+		want   time.Time
+		ok     bool
+	}{
+		{"daily", time.Date(2026, 3, 16, 0, 0, 0, 0, time.UTC), true},
+		{"weekly", time.Date(2026, 3, 16, 0, 0, 0, 0, time.UTC), true},
+		{"monthly", time.Date(2026, 4, 1, 0, 0, 0, 0, time.UTC), true},
+		{"never", time.Time{}, false},
+	}
+	for _, tt := range tests {
+		got, ok := NextQuotaReset(tt.period, now)
+		if !got.Equal(tt.want) || ok != tt.ok {
+			t.Errorf("NextQuotaReset(%q) = %v, %v; want %v, %v", tt.period, got, ok, tt.want, tt.ok)
+		}
+	}
+
+	// 周一当天的下一次周重置是下周一
+	monday := time.Date(2026, 3, 16, 0, 0, 0, 0, time.UTC)
+	if got, _ := NextQuotaReset("weekly", monday); !got.Equal(monday.AddDate(0, 0, 7)) {
+		t.Errorf("NextQuotaReset(weekly, monday) = %v", got)
+	}
+}
+
+func TestResetDueQuotas(t *testing.T) {
+	store := newTestKeyStore(t)
+	now := time.Date(2026, 3, 15, 12, 0, 0, 0, time.Local)
+	ts := func(d time.Time) *time.Time { return &d }
+
+	mustCreate(t, store, &APIKey{Key: "sk-daily-due", UsedQuota: 10, Status: KeyStatusQuotaExceeded, QuotaResetPeriod: "daily",
+		LastResetAt: ts(time.Date(2026, 3, 14, 23, 59, 59, 0, time.Local))})
+	mustCreate(t, store, &APIKey{Key: "sk-daily-fresh", UsedQuota: 10, QuotaResetPeriod: "daily",
+		LastResetAt: ts(time.Date(2026, 3, 15, 0, 0, 0, 0, time.Local))})
+	mustCreate(t, store, &APIKey{Key: "sk-monthly-due", UsedQuota: 10, QuotaResetPeriod: "monthly",
+		LastResetAt: ts(time.Date(2026, 2, 28, 23, 0, 0, 0, time.Local))})
+	mustCreate(t, store, &APIKey{Key: "sk-monthly-fresh", UsedQuota: 10, QuotaResetPeriod: "monthly",
+		LastResetAt: ts(time.Date(2026, 3, 1, 0, 0, 0, 0, time.Local))})
+	mustCreate(t, store, &APIKey{Key: "sk-never", UsedQuota: 10, QuotaResetPeriod: "never",
+		LastResetAt: ts(time.Date(2020, 1, 1, 0, 0, 0, 0, time.Local))})
+
+	count, err := store.ResetDueQuotas(now)
+	if err != nil {
+		t.Fatalf("ResetDueQuotas() error = %v", err)
+	}
+	if count != 2 {
+		t.Errorf("ResetDueQuotas() = %d, want 2", count)
+	}
+
+	for keyStr, wantUsed := range map[string]int64{
+		"sk-daily-due":     0,
+		"sk-daily-fresh":   10,
+		"sk-monthly-due":   0,
+		"sk-monthly-fresh": 10,
+		"sk-never":         10,
+	} {
+		if got := mustGet(t, store, keyStr).UsedQuota; got != wantUsed {
+			t.Errorf("%s used_quota = %d, want %d", keyStr, got, wantUsed)
+		}
+	}
+	if key := mustGet(t, store, "sk-daily-due"); key.Status != KeyStatusActive || key.LastResetAt == nil || !key.LastResetAt.Equal(now) {
+		t.Errorf("sk-daily-due after reset: %+v", key)
+	}
+
+	// 同一周期内再次执行不会重复重置
+	if count, err := store.ResetDueQuotas(now.Add(time.Hour)); err != nil || count != 0 {
+		t.Errorf("second ResetDueQuotas() = %d, %v; want 0", count, err)
+	}
+}
+
+func TestIncrementUsedQuota(t *testing.T) {
+	store := newTestKeyStore(t)
+	mustCreate(t, store, &APIKey{Key: "sk-limited", TotalQuota: 100})
+	mustCreate(t, store, &APIKey{Key: "sk-unlimited"})
+	mustCreate(t, store, &APIKey{Key: "sk-disabled", Status: KeyStatusDisabled, TotalQuota: 10})
+
+	steps := []struct {
+		name       string
+		key        string
+		tokens     int64
+		wantUsed   int64
+		wantStatus KeyStatus
+	}{
+		{"未达到总额度", "sk-limited", 60, 60, KeyStatusActive},
+		{"0 不累加", "sk-limited", 0, 60, KeyStatusActive},
+		{"负数不累加", "sk-limited", -10, 60, KeyStatusActive},
+		{"差 1 未耗尽", "sk-limited", 39, 99, KeyStatusActive},
+		{"恰好达到总额度转为 quota_exceeded", "sk-limited", 1, 100, KeyStatusQuotaExceeded},
+		{"耗尽后继续累加", "sk-limited", 5, 105, KeyStatusQuotaExceeded},
+		{"不限制额度不转换状态", "sk-unlimited", 1 << 40, 1 << 40, KeyStatusActive},
+		{"禁用的 Key 保持禁用", "sk-disabled", 20, 20, KeyStatusDisabled},
+	}
+	for _, step := range steps {
+		if err := store.IncrementUsedQuota(step.key, step.tokens); err != nil {
+			t.Fatalf("%s: IncrementUsedQuota() error = %v", step.name, err)
+		}
+		key := mustGet(t, store, step.key)
+		if key.UsedQuota != step.wantUsed || key.Status != step.wantStatus {
+			t.Errorf("%s: used = %d, status = %v; want %d, %v", step.name, key.UsedQuota, key.Status, step.wantUsed, step.wantStatus)
+		}
+	}
+
+	if err := store.IncrementUsedQuota("sk-missing", 1); err == nil {
+		t.Error("IncrementUsedQuota() on missing key: error = nil")
+	}
+}
+
+func TestQuotaRollover(t *testing.T) {
+	store := newTestKeyStore(t)
+	last := time.Date(2026, 2, 1, 0, 0, 0, 0, time.Local)
+	now := time.Date(2026, 3, 1, 0, 0, 0, 0, time.Local)
+	mustCreate(t, store, &APIKey{Key: "sk-rollover", TotalQuota: 100, UsedQuota: 30, Rollover: true, QuotaResetPeriod: "monthly", LastResetAt: &last})
+	mustCreate(t, store, &APIKey{Key: "sk-capped", TotalQuota: 100, Rollover: true, RolloverCap: 50, QuotaResetPeriod: "monthly", LastResetAt: &last})
+	mustCreate(t, store, &APIKey{Key: "sk-no-rollover", TotalQuota: 100, UsedQuota: 30, QuotaResetPeriod: "monthly", LastResetAt: &last})
+
+	// 周期重置任务：结转未用额度，不超过 rollover_cap（未配置时不超过 total_quota）
+	if count, err := store.ResetDueQuotas(now); err != nil || count != 3 {
+		t.Fatalf("ResetDueQuotas() = %d, %v; want 3", count, err)
+	}
+	for keyStr, want := range map[string]int64{"sk-rollover": 70, "sk-capped": 50, "sk-no-rollover": 0} {
+		if key := mustGet(t, store, keyStr); key.RolloverQuota != want || key.UsedQuota != 0 {
+			t.Errorf("%s: rollover_quota = %d, used = %d; want %d, 0", keyStr, key.RolloverQuota, key.UsedQuota, want)
+		}
+	}
+
+	// 本周期可用额度为 total_quota + rollover_quota，达到后才转为 quota_exceeded
+	if err := store.IncrementUsedQuota("sk-rollover", 150); err != nil {
+		t.Fatal(err)
+	}
+	if key := mustGet(t, store, "sk-rollover"); key.Status != KeyStatusActive {
+		t.Errorf("150/170 used: status = %v, want active", key.Status)
+	}
+	if err := store.IncrementUsedQuota("sk-rollover", 20); err != nil {
+		t.Fatal(err)
+	}
+	if key := mustGet(t, store, "sk-rollover"); key.Status != KeyStatusQuotaExceeded {
+		t.Errorf("170/170 used: status = %v, want quota_exceeded", key.Status)
+	}
+
+	// 手动重置：用完的周期没有可结转的额度
+	if _, err := store.ResetQuota("sk-rollover", ""); err != nil {
+		t.Fatal(err)
+	}
+	if key := mustGet(t, store, "sk-rollover"); key.RolloverQuota != 0 || key.Status != KeyStatusActive {
+		t.Errorf("after manual reset: rollover_quota = %d, status = %v; want 0, active", key.RolloverQuota, key.Status)
+	}
+
+	// 结转只保留上一周期的未用额度，不会跨多个周期累积
+	if _, err := store.ResetQuota("sk-capped", ""); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := store.ResetQuota("sk-rollover", ""); err != nil {
+		t.Fatal(err)
+	}
+	if key := mustGet(t, store, "sk-rollover"); key.RolloverQuota != 100 {
+		t.Errorf("unused period: rollover_quota = %d, want 100", key.RolloverQuota)
+	}
+	if key := mustGet(t, store, "sk-capped"); key.RolloverQuota != 50 {
+		t.Errorf("capped: rollover_quota = %d, want 50", key.RolloverQuota)
+	}
+}
+
+func TestRolloverEndpoints(t *testing.T) {
+	s, h := newTestServer(t)
+
+	rec := doAdmin(t, h, http.MethodPost, "/admin/keys/create", CreateRequest{Key: "sk-rollover", StartsAt: "2026-01-01T00:00:00Z",
+		TotalQuota: 100, Rollover: true, RolloverCap: 40})
+	if rec.Code != http.StatusOK {
+		t.Fatalf("create: status = %d, body = %s", rec.Code, rec.Body)
+	}
+	if key := mustGet(t, s.keyStore, "sk-rollover"); !key.Rollover || key.RolloverCap != 40 {
+		t.Errorf("after create: rollover = %v, cap = %d; want true, 40", key.Rollover, key.RolloverCap)
+	}
+
+	// 未指定的字段保持不变
+	rollover := false
+	rec = doAdmin(t, h, http.MethodPost, "/admin/keys/update", UpdateRequest{Key: "sk-rollover", Rollover: &rollover})
+	if rec.Code != http.StatusOK {
+		t.Fatalf("update: status = %d, body = %s", rec.Code, rec.Body)
+	}
+	if key := mustGet(t, s.keyStore, "sk-rollover"); key.Rollover || key.RolloverCap != 40 {
+		t.Errorf("after update: rollover = %v, cap = %d; want false, 40", key.Rollover, key.RolloverCap)
+	}
+}
+
+func TestIncrementUsedQuotaConcurrent(t *testing.T) {
+	store := newTestKeyStore(t)
+	mustCreate(t, store, &APIKey{Key: "sk-concurrent", TotalQuota: 1000})
+
+	var wg sync.WaitGroup
+	for i := 0; i < 50; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if err := store.IncrementUsedQuota("sk-concurrent", 20); err != nil {
+				t.Error(err)
+			}
+		}()
+	}
+	wg.Wait()
+
+	key := mustGet(t, store, "sk-concurrent")
+	if key.UsedQuota != 1000 || key.Status != KeyStatusQuotaExceeded {
+		t.Errorf("after 50 x 20 tokens: used = %d, status = %v", key.UsedQuota, key.Status)
+	}
+}
+
+func TestUpdateRaisingQuotaReactivatesKey(t *testing.T) {
+	s, h := newTestServer(t)
+	mustCreate(t, s.keyStore, &APIKey{Key: "sk-raise", TotalQuota: 100})
+	if err := s.keyStore.IncrementUsedQuota("sk-raise", 100); err != nil {
+		t.Fatal(err)
+	}
+
+	update := func(total int64) KeyStatus {
+		t.Helper()
+		rec := doAdmin(t, h, http.MethodPost, "/admin/keys/update", UpdateRequest{Key: "sk-raise", TotalQuota: &total})
+		if rec.Code != http.StatusOK {
+			t.Fatalf("update: status = %d, body = %s", rec.Code, rec.Body)
+		}
+		return mustGet(t, s.keyStore, "sk-raise").Status
+	}
+
+	// 调高后仍不足已用额度：保持 quota_exceeded
+	if got := update(100); got != KeyStatusQuotaExceeded {
+		t.Errorf("total=100: status = %v, want quota_exceeded", got)
+	}
+	if got := update(200); got != KeyStatusActive {
+		t.Errorf("total=200: status = %v, want active", got)
+	}
+}
+
+// keyUsage 调用 /admin/keys/usage 并返回结果
+func keyUsage(t *testing.T, h http.Handler, req KeyUsageRequest) *KeyUsageResponse {
+	t.Helper()
+	rec := doAdmin(t, h, http.MethodPost, "/admin/keys/usage", req)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("key usage %+v: status = %d, body = %s", req, rec.Code, rec.Body)
+	}
+	var resp KeyUsageResponse
+	decodeResponse(t, rec, &resp)
+	return &resp
+}
+
+func TestKeyUsageEndpoint(t *testing.T) {
+	s, h := newTestServer(t)
+	seedUsage(t, newTestUsageStore(t, s))
+	mustCreate(t, s.keyStore, &APIKey{Key: "sk-alice", UserID: "alice", TotalQuota: 1000, UsedQuota: 465})
+	// 超用的 Key 剩余额度为 0，不抵扣其他 Key
+	mustCreate(t, s.keyStore, &APIKey{Key: "sk-alice2", UserID: "alice", TotalQuota: 100, UsedQuota: 150})
+	mustCreate(t, s.keyStore, &APIKey{Key: "sk-bob", UserID: "bob", UsedQuota: 1530})
+
+	// 按 key 查询：剩余额度 = 总额度 - 已用额度，用量来自内置用量存储
+	resp := keyUsage(t, h, KeyUsageRequest{Key: "sk-alice"})
+	if len(resp.Keys) != 1 || resp.TotalQuota != 1000 || resp.UsedQuota != 465 || resp.Remaining == nil || *resp.Remaining != 535 {
+		t.Errorf("by key: %+v", resp)
+	}
+	if resp.Keys[0].Remaining == nil || *resp.Keys[0].Remaining != 535 {
+		t.Errorf("keys[0].remaining = %v, want 535", resp.Keys[0].Remaining)
+	}
+	if resp.Usage == nil || resp.Usage.TotalRequests != 3 || resp.Usage.TotalTokens != 465 {
+		t.Errorf("by key usage = %+v, want 3 requests / 465 tokens", resp.Usage)
+	}
+
+	// 时间范围只影响用量统计
+	resp = keyUsage(t, h, KeyUsageRequest{Key: "sk-alice", StartTime: "2026-03-14T00:00:00Z", EndTime: "2026-03-14T23:59:59Z"})
+	if resp.Usage == nil || resp.Usage.TotalRequests != 2 || resp.Usage.TotalTokens != 450 || *resp.Remaining != 535 {
+		t.Errorf("by key in range: %+v, usage %+v", resp, resp.Usage)
+	}
+
+	// 按 user_id 汇总
+	resp = keyUsage(t, h, KeyUsageRequest{UserID: "alice"})
+	if len(resp.Keys) != 2 || resp.TotalQuota != 1100 || resp.UsedQuota != 615 || resp.Remaining == nil || *resp.Remaining != 535 {
+		t.Errorf("by user: %+v", resp)
+	}
+	if resp.Usage == nil || resp.Usage.TotalTokens != 465 {
+		t.Errorf("by user usage = %+v, want 465 tokens", resp.Usage)
+	}
+
+	// 不限制额度：remaining 为 null
+	rec := doAdmin(t, h, http.MethodPost, "/admin/keys/usage", KeyUsageRequest{UserID: "bob"})
+	if rec.Code != http.StatusOK || !strings.Contains(rec.Body.String(), `"remaining":null`) {
+		t.Errorf("unlimited key: status = %d, body = %s", rec.Code, rec.Body)
+	}
+	resp = keyUsage(t, h, KeyUsageRequest{UserID: "bob"})
+	if resp.TotalQuota != 0 || resp.Remaining != nil || resp.Usage.TotalTokens != 1530 {
+		t.Errorf("unlimited key: %+v", resp)
+	}
+
+	tests := []struct {
+		name string
+		req  KeyUsageRequest
+		want int
+	}{
+		{"Key 不存在", KeyUsageRequest{Key: "sk-missing"}, http.StatusNotFound},
+		{"用户没有 Key", KeyUsageRequest{UserID: "nobody"}, http.StatusNotFound},
+		{"key 和 user_id 都为空", KeyUsageRequest{}, http.StatusBadRequest},
+		{"key 和 user_id 同时提供", KeyUsageRequest{Key: "sk-alice", UserID: "alice"}, http.StatusBadRequest},
+		{"无效的开始时间", KeyUsageRequest{Key: "sk-alice", StartTime: "yesterday"}, http.StatusBadRequest},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := doAdmin(t, h, http.MethodPost, "/admin/keys/usage", tt.req)
+			if rec.Code != tt.want {
+				t.Errorf("status = %d, want %d: %s", rec.Code, tt.want, rec.Body)
+			}
+		})
+	}
+}
+
+func TestKeyUsageWithoutUsageStore(t *testing.T) {
+	s, h := newTestServer(t)
+	mustCreate(t, s.keyStore, &APIKey{Key: "sk-a", TotalQuota: 10, UsedQuota: 4})
+
+	// 未启用内置用量存储时只返回额度
+	resp := keyUsage(t, h, KeyUsageRequest{Key: "sk-a"})
+	if resp.Usage != nil || resp.Remaining == nil || *resp.Remaining != 6 {
+		t.Errorf("without usage store: %+v", resp)
+	}
+}
+
+func TestKeyUsageIncludesRollover(t *testing.T) {
+	s, h := newTestServer(t)
+	mustCreate(t, s.keyStore, &APIKey{Key: "sk-rollover", TotalQuota: 100, UsedQuota: 120, Rollover: true, RolloverQuota: 50})
+
+	// 剩余额度 = total_quota + rollover_quota - used_quota
+	resp := keyUsage(t, h, KeyUsageRequest{Key: "sk-rollover"})
+	if resp.Remaining == nil || *resp.Remaining != 30 {
+		t.Errorf("remaining = %v, want 30", resp.Remaining)
+	}
+	if len(resp.Keys) != 1 || resp.Keys[0].RolloverQuota != 50 {
+		t.Errorf("keys = %+v, want rollover_quota 50", resp.Keys)
+	}
+}
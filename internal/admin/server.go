@@ -1,19 +1,31 @@
 package admin
 
 import (
+	"crypto/subtle"
+	"encoding/csv"
 	"encoding/json"
 	"fmt"
 	"log"
 	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
 	"time"
+
+	"llmproxy/internal/config"
 )
 
 // Server Admin API 服务器
 type Server struct {
-	keyStore *KeyStore    // Key 存储
-	token    string       // 访问令牌
-	listen   string       // 监听地址
-	server   *http.Server // HTTP 服务器
+	keyStore   *KeyStore      // Key 存储
+	auditStore *AuditStore    // 审计日志存储（初始化失败时为 nil）
+	usageStore *UsageStore    // 用量存储（未启用内置用量存储时为 nil）
+	token      string         // 访问令牌
+	listen     string         // 监听地址
+	server     *http.Server   // HTTP 服务器
+	config     *config.Config // 生效配置（供 /admin/config 查看，可选）
+	lockout    *lockout       // 错误 Token 锁定
+	authTester AuthTester     // 鉴权测试（未启用鉴权管道时为 nil）
 }
 
 // NewServer 创建 Admin API 服务器
@@ -28,24 +40,47 @@ func NewServer(keyStore *KeyStore, token string, listen string) *Server {
 	if listen == "" {
 		listen = ":8080"
 	}
+
+	// 审计日志复用 KeyStore 的数据库
+	var auditStore *AuditStore
+	if keyStore != nil {
+		store, err := NewAuditStore(keyStore.GetDB())
+		if err != nil {
+			log.Printf("警告: %v，Admin 操作将不记录审计日志", err)
+		} else {
+			auditStore = store
+		}
+	}
+
 	return &Server{
-		keyStore: keyStore,
-		token:    token,
-		listen:   listen,
+		keyStore:   keyStore,
+		auditStore: auditStore,
+		token:      token,
+		listen:     listen,
+		lockout:    newLockout(0, 0, 0),
 	}
 }
 
+// SetConfig 设置生效配置，供 /admin/config 只读查看
+// 参数：
+//   - cfg: 已加载（填充默认值、替换环境变量）的配置
+func (s *Server) SetConfig(cfg *config.Config) {
+	s.config = cfg
+}
+
+// SetUsageStore 设置用量存储，供 /admin/usage/stats 查询
+// 参数：
+//   - store: 内置用量存储
+func (s *Server) SetUsageStore(store *UsageStore) {
+	s.usageStore = store
+}
+
 // Start 启动 Admin API 服务器
 func (s *Server) Start() error {
 	mux := http.NewServeMux()
 
 	// 注册路由
-	mux.HandleFunc("/admin/keys/create", s.authMiddleware(s.handleCreate))
-	mux.HandleFunc("/admin/keys/update", s.authMiddleware(s.handleUpdate))
-	mux.HandleFunc("/admin/keys/delete", s.authMiddleware(s.handleDelete))
-	mux.HandleFunc("/admin/keys/get", s.authMiddleware(s.handleGet))
-	mux.HandleFunc("/admin/keys/list", s.authMiddleware(s.handleList))
-	mux.HandleFunc("/admin/keys/sync", s.authMiddleware(s.handleSync))
+	s.registerRoutes(mux)
 
 	s.server = &http.Server{
 		Addr:         s.listen,
@@ -70,16 +105,37 @@ func (s *Server) Stop() error {
 // RegisterRoutes 将 Admin API 路由注册到外部 ServeMux
 // 用于将 Admin API 挂载到主服务器上
 func (s *Server) RegisterRoutes(mux *http.ServeMux) {
+	s.registerRoutes(mux)
+	log.Println("Admin API 路由已注册到主服务器")
+}
+
+// registerRoutes 注册全部 Admin API 路由
+// POST + JSON 请求体的接口保持不变；另提供 REST 风格的别名（由 Go 1.22 路由模式提取 Key）：
+//   - GET /admin/keys?limit=&offset=...: 等同于 POST /admin/keys/list
+//   - GET /admin/keys/{key}: 等同于 POST /admin/keys/get
+//   - DELETE /admin/keys/{key}: 等同于 POST /admin/keys/delete
+func (s *Server) registerRoutes(mux *http.ServeMux) {
 	mux.HandleFunc("/admin/keys/create", s.authMiddleware(s.handleCreate))
 	mux.HandleFunc("/admin/keys/update", s.authMiddleware(s.handleUpdate))
 	mux.HandleFunc("/admin/keys/delete", s.authMiddleware(s.handleDelete))
+	mux.HandleFunc("/admin/keys/bulk_delete", s.authMiddleware(s.handleBulkDelete))
 	mux.HandleFunc("/admin/keys/get", s.authMiddleware(s.handleGet))
 	mux.HandleFunc("/admin/keys/list", s.authMiddleware(s.handleList))
 	mux.HandleFunc("/admin/keys/sync", s.authMiddleware(s.handleSync))
-	log.Println("Admin API 路由已注册到主服务器")
+	mux.HandleFunc("/admin/keys/reset_quota", s.authMiddleware(s.handleResetQuota))
+	mux.HandleFunc("/admin/keys/usage", s.authMiddleware(s.handleKeyUsage))
+	mux.HandleFunc("/admin/config", s.authMiddleware(s.handleConfig))
+	mux.HandleFunc("/admin/auth/test", s.authMiddleware(s.handleAuthTest))
+	mux.HandleFunc("/admin/audit/list", s.authMiddleware(s.handleAuditList))
+	mux.HandleFunc("/admin/usage/stats", s.authMiddleware(s.handleUsageStats))
+	mux.HandleFunc("/admin/usage/export", s.authMiddleware(s.handleUsageExport))
+
+	// REST 风格别名（字面路径如 /admin/keys/get 比 {key} 更具体，优先匹配旧接口）
+	mux.HandleFunc("/admin/keys", s.restMiddleware(s.handleKeysCollection))
+	mux.HandleFunc("/admin/keys/{key}", s.restMiddleware(s.handleKeyResource))
 }
 
-// authMiddleware Token 鉴权中间件
+// authMiddleware Token 鉴权中间件（只允许 POST 请求）
 func (s *Server) authMiddleware(next http.HandlerFunc) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		// 检查请求方法
@@ -88,18 +144,53 @@ func (s *Server) authMiddleware(next http.HandlerFunc) http.HandlerFunc {
 			return
 		}
 
-		// 检查 Token
-		token := r.Header.Get("X-Admin-Token")
-		if token == "" {
-			s.writeError(w, http.StatusUnauthorized, "缺少 X-Admin-Token 头")
-			return
+		if s.checkToken(w, r) {
+			next(w, r)
 		}
-		if token != s.token {
-			s.writeError(w, http.StatusForbidden, "无效的 Token")
-			return
+	}
+}
+
+// restMiddleware REST 风格接口的 Token 鉴权中间件（请求方法由处理函数自行检查）
+func (s *Server) restMiddleware(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if s.checkToken(w, r) {
+			next(w, r)
 		}
+	}
+}
 
-		next(w, r)
+// checkToken 校验 X-Admin-Token，失败时写入错误响应
+// 返回：
+//   - bool: 是否通过校验
+func (s *Server) checkToken(w http.ResponseWriter, r *http.Request) bool {
+	// 检查来源是否因多次错误 Token 被锁定
+	ip := remoteIP(r)
+	if remaining := s.lockout.blocked(ip); remaining > 0 {
+		w.Header().Set("Retry-After", strconv.Itoa(int(remaining.Seconds())+1))
+		s.writeError(w, http.StatusTooManyRequests, "错误 Token 次数过多，请稍后再试")
+		return false
+	}
+
+	// 检查 Token
+	token := r.Header.Get("X-Admin-Token")
+	if token == "" {
+		s.failAuth(ip)
+		s.writeError(w, http.StatusUnauthorized, "缺少 X-Admin-Token 头")
+		return false
+	}
+	if subtle.ConstantTimeCompare([]byte(token), []byte(s.token)) != 1 {
+		s.failAuth(ip)
+		s.writeError(w, http.StatusForbidden, "无效的 Token")
+		return false
+	}
+	s.lockout.succeed(ip)
+	return true
+}
+
+// failAuth 记录一次 Token 校验失败
+func (s *Server) failAuth(ip string) {
+	if s.lockout.fail(ip) {
+		log.Printf("Admin API: 来源 %s 多次使用错误 Token，已锁定 %s", ip, s.lockout.duration)
 	}
 }
 
@@ -109,12 +200,22 @@ func (s *Server) authMiddleware(next http.HandlerFunc) http.HandlerFunc {
 
 // CreateRequest 创建 Key 请求
 type CreateRequest struct {
-	Key       string `json:"key"`                  // API Key
+	Key       string `json:"key"`                  // API Key（generate 为 true 时留空）
+	Generate  bool   `json:"generate,omitempty"`   // 是否自动生成随机 Key（明文仅在响应中返回一次）
+	KeyPrefix string `json:"key_prefix,omitempty"` // 生成 Key 的前缀（默认取 admin.key_prefix）
+	KeyLength int    `json:"key_length,omitempty"` // 生成 Key 随机部分长度（默认取 admin.key_length）
 	Name      string `json:"name,omitempty"`       // 名称/备注
 	UserID    string `json:"user_id,omitempty"`    // 用户标识
 	Status    int    `json:"status"`               // 状态: 0=active, 1=disabled, 2=quota_exceeded, 3=expired
 	StartsAt  string `json:"starts_at"`            // 开始时间（RFC3339 格式，必填）
 	ExpiresAt string `json:"expires_at,omitempty"` // 过期时间（RFC3339 格式）
+
+	TotalQuota       int64  `json:"total_quota,omitempty"`        // 总额度（Token，0 表示不限制）
+	QuotaResetPeriod string `json:"quota_reset_period,omitempty"` // 重置周期: daily / weekly / monthly / never
+	Rollover         bool   `json:"rollover,omitempty"`           // 周期重置时是否结转未用额度
+	RolloverCap      int64  `json:"rollover_cap,omitempty"`       // 结转上限（0 表示不超过 total_quota）
+
+	DailyCostLimit float64 `json:"daily_cost_limit,omitempty"` // 每日消费上限（0 表示不限制，需启用 billing）
 }
 
 // UpdateRequest 更新 Key 请求
@@ -125,6 +226,13 @@ type UpdateRequest struct {
 	Status    *int    `json:"status,omitempty"`     // 状态（可选）
 	StartsAt  *string `json:"starts_at,omitempty"`  // 开始时间（可选，空字符串表示清除）
 	ExpiresAt *string `json:"expires_at,omitempty"` // 过期时间（可选，空字符串表示清除）
+
+	TotalQuota       *int64  `json:"total_quota,omitempty"`        // 总额度（可选）
+	QuotaResetPeriod *string `json:"quota_reset_period,omitempty"` // 重置周期（可选）
+	Rollover         *bool   `json:"rollover,omitempty"`           // 是否结转未用额度（可选）
+	RolloverCap      *int64  `json:"rollover_cap,omitempty"`       // 结转上限（可选）
+
+	DailyCostLimit *float64 `json:"daily_cost_limit,omitempty"` // 每日消费上限（可选，0 表示不限制）
 }
 
 // DeleteRequest 删除 Key 请求
@@ -132,15 +240,116 @@ type DeleteRequest struct {
 	Key string `json:"key"` // API Key
 }
 
+// BulkDeleteRequest 批量删除 Key 请求（多个条件之间为 AND 关系）
+type BulkDeleteRequest struct {
+	Keys          []string `json:"keys,omitempty"`           // 按 Key 列表删除（最多 1000 个）
+	Status        *int     `json:"status,omitempty"`         // 按状态筛选（如 3=expired）
+	UserID        string   `json:"user_id,omitempty"`        // 按用户 ID 筛选
+	ExpiresBefore string   `json:"expires_before,omitempty"` // 过期时间早于该时间（RFC3339 格式，"now" 表示当前时间）
+	ConfirmAll    bool     `json:"confirm_all,omitempty"`    // 未设置任何条件时必须为 true 才会删除全部 Key
+}
+
+// maxBulkDeleteKeys 批量删除单次最多指定的 Key 数量
+const maxBulkDeleteKeys = 1000
+
 // GetRequest 获取 Key 请求
 type GetRequest struct {
 	Key string `json:"key"` // API Key
 }
 
+// ResetQuotaRequest 重置额度请求（key 与 user_id 二选一）
+type ResetQuotaRequest struct {
+	Key    string `json:"key,omitempty"`     // API Key
+	UserID string `json:"user_id,omitempty"` // 用户标识（重置该用户的所有 Key）
+}
+
+// KeyUsageRequest Key 用量与剩余额度查询请求（key 与 user_id 二选一）
+type KeyUsageRequest struct {
+	Key       string `json:"key,omitempty"`        // API Key
+	UserID    string `json:"user_id,omitempty"`    // 用户标识（汇总该用户的所有 Key）
+	StartTime string `json:"start_time,omitempty"` // 用量统计开始时间（RFC3339 格式，可选）
+	EndTime   string `json:"end_time,omitempty"`   // 用量统计结束时间（RFC3339 格式，可选）
+}
+
+// KeyUsageResponse Key 用量与剩余额度查询响应数据
+type KeyUsageResponse struct {
+	Keys       []*KeyQuota `json:"keys"`            // 各 Key 的额度
+	TotalQuota int64       `json:"total_quota"`     // 总额度之和（任一 Key 不限制时为 0）
+	UsedQuota  int64       `json:"used_quota"`      // 已用额度之和
+	Remaining  *int64      `json:"remaining"`       // 剩余额度（不限制时为 null）
+	Usage      *UsageStats `json:"usage,omitempty"` // 时间范围内的用量统计（未启用内置用量存储时省略）
+}
+
+// AuditListRequest 审计日志查询请求
+type AuditListRequest struct {
+	Action    string `json:"action,omitempty"`     // 操作类型: create / update / delete / sync / reset_quota / export（可选）
+	StartTime string `json:"start_time,omitempty"` // 开始时间（RFC3339 格式，可选）
+	EndTime   string `json:"end_time,omitempty"`   // 结束时间（RFC3339 格式，可选）
+	Offset    int    `json:"offset"`               // 偏移量
+	Limit     int    `json:"limit"`                // 限制数量（默认 20，最大 1000）
+}
+
+// AuditListResponse 审计日志查询响应数据
+type AuditListResponse struct {
+	Records []*AuditRecord `json:"records"` // 审计记录
+	Total   int            `json:"total"`   // 总数
+}
+
+// UsageFilter 用量筛选条件
+type UsageFilter struct {
+	APIKey    string `json:"api_key,omitempty"`    // 按 API Key 筛选（可选）
+	UserID    string `json:"user_id,omitempty"`    // 按用户 ID 筛选（可选）
+	Model     string `json:"model,omitempty"`      // 按模型筛选（可选）
+	StartTime string `json:"start_time,omitempty"` // 开始时间（RFC3339 格式，可选）
+	EndTime   string `json:"end_time,omitempty"`   // 结束时间（RFC3339 格式，可选）
+}
+
+// queryParams 转换为用量查询参数
+func (f *UsageFilter) queryParams() (*UsageQueryParams, error) {
+	params := &UsageQueryParams{
+		APIKey: f.APIKey,
+		UserID: f.UserID,
+		Model:  f.Model,
+	}
+	if f.StartTime != "" {
+		t, err := time.Parse(time.RFC3339, f.StartTime)
+		if err != nil {
+			return nil, fmt.Errorf("start_time 格式错误，请使用 RFC3339 格式")
+		}
+		params.StartTime = &t
+	}
+	if f.EndTime != "" {
+		t, err := time.Parse(time.RFC3339, f.EndTime)
+		if err != nil {
+			return nil, fmt.Errorf("end_time 格式错误，请使用 RFC3339 格式")
+		}
+		params.EndTime = &t
+	}
+	return params, nil
+}
+
+// UsageStatsRequest 用量统计请求
+type UsageStatsRequest struct {
+	UsageFilter
+	GroupBy []string `json:"group_by,omitempty"` // 分组维度: model / user_id / api_key / day（可组合，为空时返回总计）
+}
+
+// UsageExportRequest 用量导出请求
+type UsageExportRequest struct {
+	UsageFilter
+}
+
 // ListRequest 列表请求
 type ListRequest struct {
-	Offset int `json:"offset"` // 偏移量
-	Limit  int `json:"limit"`  // 限制数量
+	Offset    int    `json:"offset"`     // 偏移量
+	Limit     int    `json:"limit"`      // 限制数量
+	Status    *int   `json:"status"`     // 按状态筛选（可选）
+	UserID    string `json:"user_id"`    // 按用户 ID 筛选（可选）
+	KeyPrefix string `json:"key_prefix"` // 按 Key 前缀筛选（可选）
+	Name      string `json:"name"`       // 按名称子串搜索（可选）
+	Sort      string `json:"sort"`       // 排序字段: created_at / updated_at / expires_at / name / user_id / used_quota（默认 created_at）
+	Order     string `json:"order"`      // 排序方向: asc / desc（默认 desc）
+	Cursor    string `json:"cursor"`     // 游标（上一页的 next_cursor，设置后忽略 offset，仅支持按 created_at 排序）
 }
 
 // SyncRequest 同步请求
@@ -157,6 +366,14 @@ type SyncKeyItem struct {
 	Status    int    `json:"status"`               // 状态
 	StartsAt  string `json:"starts_at"`            // 开始时间（必填）
 	ExpiresAt string `json:"expires_at,omitempty"` // 过期时间
+
+	TotalQuota       int64  `json:"total_quota,omitempty"`        // 总额度（Token，0 表示不限制）
+	UsedQuota        int64  `json:"used_quota,omitempty"`         // 已用额度（仅新插入的 Key 生效）
+	QuotaResetPeriod string `json:"quota_reset_period,omitempty"` // 重置周期
+	Rollover         bool   `json:"rollover,omitempty"`           // 周期重置时是否结转未用额度
+	RolloverCap      int64  `json:"rollover_cap,omitempty"`       // 结转上限（0 表示不超过 total_quota）
+
+	DailyCostLimit float64 `json:"daily_cost_limit,omitempty"` // 每日消费上限（0 表示不限制，需启用 billing）
 }
 
 // Response 通用响应
@@ -169,8 +386,10 @@ type Response struct {
 
 // ListResponse 列表响应数据
 type ListResponse struct {
-	Keys  []*APIKey `json:"keys"`  // Key 列表
-	Total int       `json:"total"` // 总数
+	Keys       []*APIKey `json:"keys"`                  // Key 列表
+	Total      int       `json:"total"`                 // 总数
+	HasMore    bool      `json:"has_more"`              // 是否还有下一页
+	NextCursor string    `json:"next_cursor,omitempty"` // 下一页游标（按 created_at 排序且有下一页时返回）
 }
 
 // ============================================================
@@ -185,7 +404,22 @@ func (s *Server) handleCreate(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	if req.Key == "" {
+	if req.Generate {
+		if req.Key != "" {
+			s.writeError(w, http.StatusBadRequest, "generate 为 true 时不能指定 key")
+			return
+		}
+		if req.KeyPrefix == "" {
+			req.KeyPrefix = s.keyPrefix()
+		}
+		if req.KeyLength == 0 {
+			req.KeyLength = s.keyLength()
+		}
+		if req.KeyLength < MinKeyLength || req.KeyLength > MaxKeyLength {
+			s.writeError(w, http.StatusBadRequest, fmt.Sprintf("key_length 应在 %d ~ %d 之间", MinKeyLength, MaxKeyLength))
+			return
+		}
+	} else if req.Key == "" {
 		s.writeError(w, http.StatusBadRequest, "key 不能为空")
 		return
 	}
@@ -197,17 +431,27 @@ func (s *Server) handleCreate(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// 检查是否已存在
-	if s.keyStore.Exists(req.Key) {
+	if !req.Generate && s.keyStore.Exists(req.Key) {
 		s.writeError(w, http.StatusConflict, "Key 已存在")
 		return
 	}
 
+	if !validResetPeriod(req.QuotaResetPeriod) {
+		s.writeError(w, http.StatusBadRequest, "quota_reset_period 无效，应为 daily / weekly / monthly / never")
+		return
+	}
+
 	// 构建 APIKey
 	key := &APIKey{
-		Key:    req.Key,
-		Name:   req.Name,
-		UserID: req.UserID,
-		Status: KeyStatus(req.Status),
+		Key:              req.Key,
+		Name:             req.Name,
+		UserID:           req.UserID,
+		Status:           KeyStatus(req.Status),
+		TotalQuota:       req.TotalQuota,
+		QuotaResetPeriod: req.QuotaResetPeriod,
+		Rollover:         req.Rollover,
+		RolloverCap:      max(req.RolloverCap, 0),
+		DailyCostLimit:   max(req.DailyCostLimit, 0),
 	}
 
 	// 解析开始时间（必填）
@@ -229,14 +473,40 @@ func (s *Server) handleCreate(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// 创建
-	if err := s.keyStore.Create(key); err != nil {
+	if req.Generate {
+		err = s.keyStore.CreateGenerated(key, req.KeyPrefix, req.KeyLength)
+	} else {
+		err = s.keyStore.Create(key)
+	}
+	if err != nil {
 		s.writeError(w, http.StatusInternalServerError, "创建失败: "+err.Error())
 		return
 	}
+	detail := ""
+	if req.Generate {
+		detail = "generated"
+	}
+	s.audit(r, AuditActionCreate, maskKey(key.Key), detail)
 
 	s.writeSuccess(w, "创建成功", key)
 }
 
+// keyPrefix 返回生成 Key 的默认前缀
+func (s *Server) keyPrefix() string {
+	if s.config != nil && s.config.Admin != nil && s.config.Admin.KeyPrefix != "" {
+		return s.config.Admin.KeyPrefix
+	}
+	return DefaultKeyPrefix
+}
+
+// keyLength 返回生成 Key 的默认随机部分长度
+func (s *Server) keyLength() int {
+	if s.config != nil && s.config.Admin != nil && s.config.Admin.KeyLength > 0 {
+		return s.config.Admin.KeyLength
+	}
+	return DefaultKeyLength
+}
+
 // handleUpdate 更新 Key
 func (s *Server) handleUpdate(w http.ResponseWriter, r *http.Request) {
 	var req UpdateRequest
@@ -298,11 +568,37 @@ func (s *Server) handleUpdate(w http.ResponseWriter, r *http.Request) {
 		}
 	}
 
+	if req.TotalQuota != nil {
+		key.TotalQuota = *req.TotalQuota
+		// 调高额度后恢复因额度耗尽而停用的 Key（未显式指定状态时）
+		if req.Status == nil && key.Status == KeyStatusQuotaExceeded &&
+			(key.TotalQuota <= 0 || key.UsedQuota < key.TotalQuota+key.RolloverQuota) {
+			key.Status = KeyStatusActive
+		}
+	}
+	if req.QuotaResetPeriod != nil {
+		if !validResetPeriod(*req.QuotaResetPeriod) {
+			s.writeError(w, http.StatusBadRequest, "quota_reset_period 无效，应为 daily / weekly / monthly / never")
+			return
+		}
+		key.QuotaResetPeriod = *req.QuotaResetPeriod
+	}
+	if req.Rollover != nil {
+		key.Rollover = *req.Rollover
+	}
+	if req.RolloverCap != nil {
+		key.RolloverCap = max(*req.RolloverCap, 0)
+	}
+	if req.DailyCostLimit != nil {
+		key.DailyCostLimit = max(*req.DailyCostLimit, 0)
+	}
+
 	// 更新
 	if err := s.keyStore.Update(key); err != nil {
 		s.writeError(w, http.StatusInternalServerError, "更新失败: "+err.Error())
 		return
 	}
+	s.audit(r, AuditActionUpdate, maskKey(req.Key), "")
 
 	s.writeSuccess(w, "更新成功", key)
 }
@@ -315,20 +611,101 @@ func (s *Server) handleDelete(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	if req.Key == "" {
+	s.deleteKey(w, r, req.Key)
+}
+
+// deleteKey 删除 Key（POST /admin/keys/delete 与 DELETE /admin/keys/{key} 共用）
+func (s *Server) deleteKey(w http.ResponseWriter, r *http.Request, key string) {
+	if key == "" {
 		s.writeError(w, http.StatusBadRequest, "key 不能为空")
 		return
 	}
 
 	// 删除
-	if err := s.keyStore.Delete(req.Key); err != nil {
+	if err := s.keyStore.Delete(key); err != nil {
 		s.writeError(w, http.StatusNotFound, err.Error())
 		return
 	}
+	s.audit(r, AuditActionDelete, maskKey(key), "")
 
 	s.writeSuccess(w, "删除成功", nil)
 }
 
+// handleBulkDelete 批量删除 Key（单个事务）
+func (s *Server) handleBulkDelete(w http.ResponseWriter, r *http.Request) {
+	var req BulkDeleteRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		s.writeError(w, http.StatusBadRequest, "请求解析失败: "+err.Error())
+		return
+	}
+
+	if len(req.Keys) > maxBulkDeleteKeys {
+		s.writeError(w, http.StatusBadRequest, fmt.Sprintf("keys 最多 %d 个", maxBulkDeleteKeys))
+		return
+	}
+	filter := &KeyDeleteFilter{
+		UserID: req.UserID,
+		All:    req.ConfirmAll,
+	}
+	for _, k := range req.Keys {
+		if k == "" {
+			s.writeError(w, http.StatusBadRequest, "keys 中不能包含空值")
+			return
+		}
+		filter.Keys = append(filter.Keys, k)
+	}
+	if req.Status != nil {
+		status := KeyStatus(*req.Status)
+		filter.Status = &status
+	}
+	if req.ExpiresBefore != "" {
+		t := time.Now()
+		if req.ExpiresBefore != "now" {
+			parsed, err := time.Parse(time.RFC3339, req.ExpiresBefore)
+			if err != nil {
+				s.writeError(w, http.StatusBadRequest, "expires_before 格式错误，请使用 RFC3339 格式或 now")
+				return
+			}
+			t = parsed
+		}
+		filter.ExpiresBefore = &t
+	}
+	if _, _, filtered := keyDeleteWhere(filter); !filtered && !filter.All {
+		s.writeError(w, http.StatusBadRequest, "未指定删除条件；如确需删除全部 Key，请设置 confirm_all 为 true")
+		return
+	}
+
+	count, err := s.keyStore.BulkDelete(filter)
+	if err != nil {
+		s.writeError(w, http.StatusInternalServerError, "删除失败: "+err.Error())
+		return
+	}
+	s.audit(r, AuditActionBulkDelete, bulkDeleteTarget(&req), fmt.Sprintf("deleted=%d", count))
+
+	s.writeSuccess(w, fmt.Sprintf("删除成功，共 %d 个 Key", count), map[string]int64{"deleted": count})
+}
+
+// bulkDeleteTarget 批量删除条件的审计描述（Key 已脱敏）
+func bulkDeleteTarget(req *BulkDeleteRequest) string {
+	var parts []string
+	if len(req.Keys) > 0 {
+		parts = append(parts, fmt.Sprintf("keys=%d", len(req.Keys)))
+	}
+	if req.Status != nil {
+		parts = append(parts, fmt.Sprintf("status=%d", *req.Status))
+	}
+	if req.UserID != "" {
+		parts = append(parts, "user_id="+req.UserID)
+	}
+	if req.ExpiresBefore != "" {
+		parts = append(parts, "expires_before="+req.ExpiresBefore)
+	}
+	if len(parts) == 0 {
+		return "all"
+	}
+	return strings.Join(parts, ",")
+}
+
 // handleGet 获取 Key
 func (s *Server) handleGet(w http.ResponseWriter, r *http.Request) {
 	var req GetRequest
@@ -337,13 +714,18 @@ func (s *Server) handleGet(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	if req.Key == "" {
+	s.getKey(w, req.Key)
+}
+
+// getKey 查询 Key（POST /admin/keys/get 与 GET /admin/keys/{key} 共用）
+func (s *Server) getKey(w http.ResponseWriter, keyValue string) {
+	if keyValue == "" {
 		s.writeError(w, http.StatusBadRequest, "key 不能为空")
 		return
 	}
 
 	// 查询
-	key, err := s.keyStore.Get(req.Key)
+	key, err := s.keyStore.Get(keyValue)
 	if err != nil {
 		s.writeError(w, http.StatusInternalServerError, "查询失败: "+err.Error())
 		return
@@ -363,7 +745,11 @@ func (s *Server) handleList(w http.ResponseWriter, r *http.Request) {
 		s.writeError(w, http.StatusBadRequest, "请求解析失败: "+err.Error())
 		return
 	}
+	s.listKeys(w, req)
+}
 
+// listKeys 列出 Key（POST /admin/keys/list 与 GET /admin/keys 共用）
+func (s *Server) listKeys(w http.ResponseWriter, req ListRequest) {
 	// 默认值
 	if req.Limit <= 0 {
 		req.Limit = 20
@@ -371,18 +757,430 @@ func (s *Server) handleList(w http.ResponseWriter, r *http.Request) {
 	if req.Limit > 100 {
 		req.Limit = 100
 	}
+	if req.Sort != "" && !keySortColumns[req.Sort] {
+		s.writeError(w, http.StatusBadRequest, "不支持的排序字段: "+req.Sort)
+		return
+	}
+	if req.Order != "" && req.Order != "asc" && req.Order != "desc" {
+		s.writeError(w, http.StatusBadRequest, "order 只能为 asc 或 desc")
+		return
+	}
+	if req.Cursor != "" {
+		if req.Sort != "" && req.Sort != "created_at" {
+			s.writeError(w, http.StatusBadRequest, "cursor 仅支持按 created_at 排序")
+			return
+		}
+		if _, err := decodeCursor(req.Cursor); err != nil {
+			s.writeError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+	}
+
+	params := &KeyListParams{
+		UserID:    req.UserID,
+		KeyPrefix: req.KeyPrefix,
+		Name:      req.Name,
+		Sort:      req.Sort,
+		Order:     req.Order,
+		Offset:    req.Offset,
+		Limit:     req.Limit,
+		Cursor:    req.Cursor,
+	}
+	if req.Status != nil {
+		status := KeyStatus(*req.Status)
+		params.Status = &status
+	}
 
 	// 查询
-	keys, total, err := s.keyStore.List(req.Offset, req.Limit)
+	result, err := s.keyStore.List(params)
 	if err != nil {
 		s.writeError(w, http.StatusInternalServerError, "查询失败: "+err.Error())
 		return
 	}
 
 	s.writeSuccess(w, "查询成功", ListResponse{
-		Keys:  keys,
-		Total: total,
+		Keys:       result.Keys,
+		Total:      result.Total,
+		HasMore:    result.HasMore,
+		NextCursor: result.NextCursor,
+	})
+}
+
+// handleKeysCollection REST 风格的 Key 集合接口
+// GET /admin/keys：查询参数与 ListRequest 字段同名（offset、limit、cursor、status、user_id、key_prefix、name、sort、order）
+func (s *Server) handleKeysCollection(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		w.Header().Set("Allow", http.MethodGet)
+		s.writeError(w, http.StatusMethodNotAllowed, "只允许 GET 请求")
+		return
+	}
+
+	req, err := parseListQuery(r.URL.Query())
+	if err != nil {
+		s.writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	s.listKeys(w, req)
+}
+
+// handleKeyResource REST 风格的单个 Key 接口
+// GET /admin/keys/{key} 查询，DELETE /admin/keys/{key} 删除
+func (s *Server) handleKeyResource(w http.ResponseWriter, r *http.Request) {
+	key := r.PathValue("key")
+	switch r.Method {
+	case http.MethodGet:
+		s.getKey(w, key)
+	case http.MethodDelete:
+		s.deleteKey(w, r, key)
+	default:
+		w.Header().Set("Allow", "GET, DELETE")
+		s.writeError(w, http.StatusMethodNotAllowed, "只允许 GET 或 DELETE 请求")
+	}
+}
+
+// parseListQuery 将 URL 查询参数解析为列表请求
+// 参数：
+//   - query: URL 查询参数
+//
+// 返回：
+//   - ListRequest: 列表请求
+//   - error: 数字参数格式错误时返回错误
+func parseListQuery(query url.Values) (ListRequest, error) {
+	req := ListRequest{
+		UserID:    query.Get("user_id"),
+		KeyPrefix: query.Get("key_prefix"),
+		Name:      query.Get("name"),
+		Sort:      query.Get("sort"),
+		Order:     query.Get("order"),
+		Cursor:    query.Get("cursor"),
+	}
+
+	ints := []struct {
+		name string
+		dst  *int
+	}{
+		{"offset", &req.Offset},
+		{"limit", &req.Limit},
+	}
+	for _, p := range ints {
+		v := query.Get(p.name)
+		if v == "" {
+			continue
+		}
+		n, err := strconv.Atoi(v)
+		if err != nil {
+			return req, fmt.Errorf("%s 必须为整数", p.name)
+		}
+		*p.dst = n
+	}
+
+	if v := query.Get("status"); v != "" {
+		status, err := strconv.Atoi(v)
+		if err != nil {
+			return req, fmt.Errorf("status 必须为整数")
+		}
+		req.Status = &status
+	}
+	return req, nil
+}
+
+// handleConfig 查看生效配置（只读，敏感字段已脱敏）
+func (s *Server) handleConfig(w http.ResponseWriter, r *http.Request) {
+	if s.config == nil {
+		s.writeError(w, http.StatusNotFound, "未提供生效配置")
+		return
+	}
+
+	redacted, err := s.config.Redacted()
+	if err != nil {
+		s.writeError(w, http.StatusInternalServerError, "获取配置失败: "+err.Error())
+		return
+	}
+
+	s.writeSuccess(w, "查询成功", redacted)
+}
+
+// handleAuditList 查询审计日志
+func (s *Server) handleAuditList(w http.ResponseWriter, r *http.Request) {
+	var req AuditListRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		s.writeError(w, http.StatusBadRequest, "请求解析失败: "+err.Error())
+		return
+	}
+
+	if s.auditStore == nil {
+		s.writeError(w, http.StatusServiceUnavailable, "审计日志不可用")
+		return
+	}
+
+	params := &AuditQueryParams{
+		Action: req.Action,
+		Offset: req.Offset,
+		Limit:  req.Limit,
+	}
+	if req.StartTime != "" {
+		t, err := time.Parse(time.RFC3339, req.StartTime)
+		if err != nil {
+			s.writeError(w, http.StatusBadRequest, "start_time 格式错误，请使用 RFC3339 格式")
+			return
+		}
+		params.StartTime = &t
+	}
+	if req.EndTime != "" {
+		t, err := time.Parse(time.RFC3339, req.EndTime)
+		if err != nil {
+			s.writeError(w, http.StatusBadRequest, "end_time 格式错误，请使用 RFC3339 格式")
+			return
+		}
+		params.EndTime = &t
+	}
+
+	records, total, err := s.auditStore.Query(params)
+	if err != nil {
+		s.writeError(w, http.StatusInternalServerError, "查询失败: "+err.Error())
+		return
+	}
+
+	s.writeSuccess(w, "查询成功", AuditListResponse{
+		Records: records,
+		Total:   total,
+	})
+}
+
+// handleUsageStats 统计用量（可按维度分组）
+func (s *Server) handleUsageStats(w http.ResponseWriter, r *http.Request) {
+	var req UsageStatsRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		s.writeError(w, http.StatusBadRequest, "请求解析失败: "+err.Error())
+		return
+	}
+
+	if s.usageStore == nil {
+		s.writeError(w, http.StatusServiceUnavailable, "内置用量存储未启用")
+		return
+	}
+
+	seen := make(map[string]bool)
+	for _, dim := range req.GroupBy {
+		if !ValidUsageGroupBy(dim) {
+			s.writeError(w, http.StatusBadRequest, "group_by 仅支持 model / user_id / api_key / day: "+dim)
+			return
+		}
+		if seen[dim] {
+			s.writeError(w, http.StatusBadRequest, "group_by 存在重复维度: "+dim)
+			return
+		}
+		seen[dim] = true
+	}
+
+	params, err := req.queryParams()
+	if err != nil {
+		s.writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	if len(req.GroupBy) == 0 {
+		stats, err := s.usageStore.Stats(params)
+		if err != nil {
+			s.writeError(w, http.StatusInternalServerError, "统计失败: "+err.Error())
+			return
+		}
+		s.writeSuccess(w, "查询成功", stats)
+		return
+	}
+
+	groups, err := s.usageStore.StatsGrouped(params, req.GroupBy)
+	if err != nil {
+		s.writeError(w, http.StatusInternalServerError, "统计失败: "+err.Error())
+		return
+	}
+	if groups == nil {
+		groups = []*UsageGroupStats{}
+	}
+	s.writeSuccess(w, "查询成功", groups)
+}
+
+// usageExportColumns 用量导出 CSV 的表头
+var usageExportColumns = []string{
+	"id", "created_at", "request_id", "api_key", "user_id", "model",
+	"prompt_tokens", "completion_tokens", "total_tokens",
+	"endpoint", "backend_url", "status_code", "latency_ms", "streaming",
+}
+
+// handleUsageExport 以 CSV 流式导出用量记录（API Key 已脱敏）
+// 每批记录写完后立即刷新，导出过程中不在内存中缓存全部数据
+func (s *Server) handleUsageExport(w http.ResponseWriter, r *http.Request) {
+	var req UsageExportRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		s.writeError(w, http.StatusBadRequest, "请求解析失败: "+err.Error())
+		return
+	}
+
+	if s.usageStore == nil {
+		s.writeError(w, http.StatusServiceUnavailable, "内置用量存储未启用")
+		return
+	}
+
+	params, err := req.queryParams()
+	if err != nil {
+		s.writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	filename := fmt.Sprintf("usage-%s.csv", time.Now().Format("20060102-150405"))
+	w.Header().Set("Content-Type", "text/csv; charset=utf-8")
+	w.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="%s"`, filename))
+	w.WriteHeader(http.StatusOK)
+
+	flusher, _ := w.(http.Flusher)
+	cw := csv.NewWriter(w)
+	_ = cw.Write(usageExportColumns)
+
+	count := 0
+	err = s.usageStore.Export(params, func(rec *UsageRecord) error {
+		apiKey := ""
+		if rec.APIKey != "" {
+			apiKey = maskKey(rec.APIKey)
+		}
+		if err := cw.Write([]string{
+			strconv.FormatInt(rec.ID, 10),
+			rec.CreatedAt.Format(time.RFC3339),
+			rec.RequestID,
+			apiKey,
+			rec.UserID,
+			rec.Model,
+			strconv.Itoa(rec.PromptTokens),
+			strconv.Itoa(rec.CompletionTokens),
+			strconv.Itoa(rec.TotalTokens),
+			rec.Endpoint,
+			rec.BackendURL,
+			strconv.Itoa(rec.StatusCode),
+			strconv.FormatInt(rec.LatencyMs, 10),
+			strconv.FormatBool(rec.Streaming),
+		}); err != nil {
+			return err
+		}
+
+		count++
+		if count%usageExportBatchSize == 0 {
+			cw.Flush()
+			if err := cw.Error(); err != nil {
+				return err
+			}
+			if flusher != nil {
+				flusher.Flush()
+			}
+		}
+		return nil
 	})
+	cw.Flush()
+	if flusher != nil {
+		flusher.Flush()
+	}
+
+	// 响应头已发送，出错时只能记录日志（客户端收到的 CSV 不完整）
+	if err == nil {
+		err = cw.Error()
+	}
+	if err != nil {
+		log.Printf("用量导出中断（已写入 %d 条）: %v", count, err)
+		return
+	}
+	s.audit(r, AuditActionExport, "", fmt.Sprintf("导出用量记录 %d 条", count))
+}
+
+// handleResetQuota 重置额度
+// 按 key 重置单个 Key，或按 user_id 重置该用户的所有 Key
+func (s *Server) handleResetQuota(w http.ResponseWriter, r *http.Request) {
+	var req ResetQuotaRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		s.writeError(w, http.StatusBadRequest, "请求解析失败: "+err.Error())
+		return
+	}
+
+	if req.Key == "" && req.UserID == "" {
+		s.writeError(w, http.StatusBadRequest, "key 和 user_id 不能同时为空")
+		return
+	}
+
+	count, err := s.keyStore.ResetQuota(req.Key, req.UserID)
+	if err != nil {
+		s.writeError(w, http.StatusInternalServerError, "重置失败: "+err.Error())
+		return
+	}
+	if count == 0 {
+		s.writeError(w, http.StatusNotFound, "Key 不存在")
+		return
+	}
+	target := maskKey(req.Key)
+	if req.Key == "" {
+		target = "user_id=" + req.UserID
+	}
+	s.audit(r, AuditActionResetQuota, target, fmt.Sprintf("reset=%d", count))
+
+	s.writeSuccess(w, fmt.Sprintf("重置成功，共 %d 个 Key", count), map[string]int64{"reset": count})
+}
+
+// handleKeyUsage 查询 Key 的剩余额度和时间范围内的用量
+// 按 key 查询单个 Key，或按 user_id 汇总该用户的所有 Key；用量来自内置用量存储
+func (s *Server) handleKeyUsage(w http.ResponseWriter, r *http.Request) {
+	var req KeyUsageRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		s.writeError(w, http.StatusBadRequest, "请求解析失败: "+err.Error())
+		return
+	}
+
+	if (req.Key == "") == (req.UserID == "") {
+		s.writeError(w, http.StatusBadRequest, "key 和 user_id 必须且只能提供一个")
+		return
+	}
+
+	filter := UsageFilter{
+		APIKey:    req.Key,
+		UserID:    req.UserID,
+		StartTime: req.StartTime,
+		EndTime:   req.EndTime,
+	}
+	params, err := filter.queryParams()
+	if err != nil {
+		s.writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	var keys []*APIKey
+	if req.Key != "" {
+		key, err := s.keyStore.Get(req.Key)
+		if err != nil {
+			s.writeError(w, http.StatusInternalServerError, "查询失败: "+err.Error())
+			return
+		}
+		if key != nil {
+			keys = append(keys, key)
+		}
+	} else {
+		result, err := s.keyStore.List(&KeyListParams{UserID: req.UserID, Limit: maxKeyUsageKeys})
+		if err != nil {
+			s.writeError(w, http.StatusInternalServerError, "查询失败: "+err.Error())
+			return
+		}
+		keys = result.Keys
+	}
+	if len(keys) == 0 {
+		s.writeError(w, http.StatusNotFound, "Key 不存在")
+		return
+	}
+
+	resp := summarizeQuota(keys)
+	if s.usageStore != nil {
+		stats, err := s.usageStore.Stats(params)
+		if err != nil {
+			s.writeError(w, http.StatusInternalServerError, "统计失败: "+err.Error())
+			return
+		}
+		resp.Usage = stats
+	}
+
+	s.writeSuccess(w, "查询成功", resp)
 }
 
 // handleSync 批量同步 Key
@@ -424,11 +1222,22 @@ func (s *Server) handleSync(w http.ResponseWriter, r *http.Request) {
 			return
 		}
 
+		if !validResetPeriod(item.QuotaResetPeriod) {
+			s.writeError(w, http.StatusBadRequest, fmt.Sprintf("keys[%d].quota_reset_period 无效", i))
+			return
+		}
+
 		key := &APIKey{
-			Key:    item.Key,
-			Name:   item.Name,
-			UserID: item.UserID,
-			Status: KeyStatus(item.Status),
+			Key:              item.Key,
+			Name:             item.Name,
+			UserID:           item.UserID,
+			Status:           KeyStatus(item.Status),
+			TotalQuota:       item.TotalQuota,
+			UsedQuota:        item.UsedQuota,
+			QuotaResetPeriod: item.QuotaResetPeriod,
+			Rollover:         item.Rollover,
+			RolloverCap:      max(item.RolloverCap, 0),
+			DailyCostLimit:   max(item.DailyCostLimit, 0),
 		}
 
 		// 解析开始时间
@@ -456,6 +1265,7 @@ func (s *Server) handleSync(w http.ResponseWriter, r *http.Request) {
 		s.writeError(w, http.StatusInternalServerError, "同步失败: "+err.Error())
 		return
 	}
+	s.audit(r, AuditActionSync, "", fmt.Sprintf("mode=%s, keys=%d", mode, len(keys)))
 
 	modeStr := "全量覆盖"
 	if mode == SyncModeIncremental {
@@ -468,6 +1278,15 @@ func (s *Server) handleSync(w http.ResponseWriter, r *http.Request) {
 //                    辅助函数
 // ============================================================
 
+// validResetPeriod 检查额度重置周期是否有效（空表示不重置）
+func validResetPeriod(period string) bool {
+	switch period {
+	case "", "daily", "weekly", "monthly", "never":
+		return true
+	}
+	return false
+}
+
 // writeSuccess 写入成功响应
 func (s *Server) writeSuccess(w http.ResponseWriter, message string, data interface{}) {
 	w.Header().Set("Content-Type", "application/json")
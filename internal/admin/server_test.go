@@ -0,0 +1,198 @@
+package admin
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"reflect"
+	"testing"
+)
+
+// responseData 解析响应中的 data，用于比较两个接口的返回
+func responseData(t *testing.T, rec *httptest.ResponseRecorder) interface{} {
+	t.Helper()
+	var data interface{}
+	decodeResponse(t, rec, &data)
+	return data
+}
+
+func TestRESTGetKeyMatchesPost(t *testing.T) {
+	s, h := newTestServer(t)
+	seedListKeys(t, s.keyStore)
+	mustCreate(t, s.keyStore, &APIKey{Key: "sk with space", Name: "escaped"})
+
+	for _, key := range []string{"sk-prod-aaa", "sk with space"} {
+		post := doAdmin(t, h, http.MethodPost, "/admin/keys/get", GetRequest{Key: key})
+		get := doAdmin(t, h, http.MethodGet, "/admin/keys/"+url.PathEscape(key), nil)
+		if post.Code != http.StatusOK || get.Code != http.StatusOK {
+			t.Fatalf("%s: POST = %d, GET = %d: %s", key, post.Code, get.Code, get.Body)
+		}
+		if p, g := responseData(t, post), responseData(t, get); !reflect.DeepEqual(p, g) {
+			t.Errorf("%s: GET data = %v, want POST data %v", key, g, p)
+		}
+	}
+
+	post := doAdmin(t, h, http.MethodPost, "/admin/keys/get", GetRequest{Key: "sk-missing"})
+	get := doAdmin(t, h, http.MethodGet, "/admin/keys/sk-missing", nil)
+	if get.Code != post.Code || get.Code != http.StatusNotFound {
+		t.Errorf("missing key: GET = %d, POST = %d, want 404", get.Code, post.Code)
+	}
+}
+
+func TestRESTListKeysMatchesPost(t *testing.T) {
+	s, h := newTestServer(t)
+	seedListKeys(t, s.keyStore)
+
+	status := int(KeyStatusActive)
+	tests := []struct {
+		name  string
+		query string
+		req   ListRequest
+	}{
+		{"默认", "", ListRequest{}},
+		{"过滤和排序", "?status=0&user_id=alice&sort=name&order=asc", ListRequest{Status: &status, UserID: "alice", Sort: "name", Order: "asc"}},
+		{"前缀和分页", "?key_prefix=sk-prod&limit=1&offset=1", ListRequest{KeyPrefix: "sk-prod", Limit: 1, Offset: 1}},
+		{"名称", "?name=promo", ListRequest{Name: "promo"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			post := doAdmin(t, h, http.MethodPost, "/admin/keys/list", tt.req)
+			get := doAdmin(t, h, http.MethodGet, "/admin/keys"+tt.query, nil)
+			if post.Code != http.StatusOK || get.Code != http.StatusOK {
+				t.Fatalf("POST = %d, GET = %d: %s", post.Code, get.Code, get.Body)
+			}
+			if p, g := responseData(t, post), responseData(t, get); !reflect.DeepEqual(p, g) {
+				t.Errorf("GET data = %v, want POST data %v", g, p)
+			}
+		})
+	}
+
+	for _, query := range []string{"?limit=ten", "?offset=x", "?status=active", "?sort=password"} {
+		if rec := doAdmin(t, h, http.MethodGet, "/admin/keys"+query, nil); rec.Code != http.StatusBadRequest {
+			t.Errorf("GET /admin/keys%s: status = %d, want 400", query, rec.Code)
+		}
+	}
+}
+
+func TestRESTDeleteKey(t *testing.T) {
+	s, h := newTestServer(t)
+	seedListKeys(t, s.keyStore)
+
+	rec := doAdmin(t, h, http.MethodDelete, "/admin/keys/sk-prod-aaa", nil)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("DELETE: status = %d, body = %s", rec.Code, rec.Body)
+	}
+	if key, _ := s.keyStore.Get("sk-prod-aaa"); key != nil {
+		t.Errorf("key still exists after DELETE: %+v", key)
+	}
+	// 与 POST /admin/keys/delete 一样记录审计日志
+	if resp := listAudit(t, h, AuditListRequest{Action: AuditActionDelete}); resp.Total != 1 || resp.Records[0].Target != maskKey("sk-prod-aaa") {
+		t.Errorf("audit records = %+v", resp.Records)
+	}
+
+	if rec := doAdmin(t, h, http.MethodDelete, "/admin/keys/sk-prod-aaa", nil); rec.Code != http.StatusNotFound {
+		t.Errorf("second DELETE: status = %d, want 404", rec.Code)
+	}
+	if rec := doAdmin(t, h, http.MethodPost, "/admin/keys/delete", DeleteRequest{Key: "sk-prod-bbb"}); rec.Code != http.StatusOK {
+		t.Errorf("POST delete still works: status = %d", rec.Code)
+	}
+}
+
+func TestRESTRoutesMethodsAndAuth(t *testing.T) {
+	_, h := newTestServer(t)
+
+	tests := []struct {
+		name   string
+		method string
+		path   string
+		want   int
+		allow  string
+	}{
+		{"集合不支持 POST", http.MethodPost, "/admin/keys", http.StatusMethodNotAllowed, "GET"},
+		{"单个 Key 不支持 PUT", http.MethodPut, "/admin/keys/sk-a", http.StatusMethodNotAllowed, "GET, DELETE"},
+		// 旧接口的字面路径优先于 {key}，仍只允许 POST
+		{"旧接口不接受 GET", http.MethodGet, "/admin/keys/list", http.StatusMethodNotAllowed, ""},
+		{"旧接口不接受 DELETE", http.MethodDelete, "/admin/keys/delete", http.StatusMethodNotAllowed, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := doAdmin(t, h, tt.method, tt.path, nil)
+			if rec.Code != tt.want {
+				t.Errorf("status = %d, want %d", rec.Code, tt.want)
+			}
+			if tt.allow != "" && rec.Header().Get("Allow") != tt.allow {
+				t.Errorf("Allow = %q, want %q", rec.Header().Get("Allow"), tt.allow)
+			}
+		})
+	}
+
+	// REST 接口同样需要 Token
+	for _, req := range []*http.Request{
+		httptest.NewRequest(http.MethodGet, "/admin/keys", nil),
+		httptest.NewRequest(http.MethodGet, "/admin/keys/sk-a", nil),
+		httptest.NewRequest(http.MethodDelete, "/admin/keys/sk-a", nil),
+	} {
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, req)
+		if rec.Code != http.StatusUnauthorized {
+			t.Errorf("%s %s without token: status = %d, want 401", req.Method, req.URL.Path, rec.Code)
+		}
+	}
+}
+
+func TestBulkDeleteEndpoint(t *testing.T) {
+	s, h := newTestServer(t)
+	seedExpiringKeys(t, s.keyStore)
+
+	// 按列表删除，返回删除数量
+	rec := doAdmin(t, h, http.MethodPost, "/admin/keys/bulk_delete", BulkDeleteRequest{Keys: []string{"sk-future", "sk-missing"}})
+	var data map[string]int64
+	decodeResponse(t, rec, &data)
+	if rec.Code != http.StatusOK || data["deleted"] != 1 {
+		t.Fatalf("delete by list: %d %s", rec.Code, rec.Body)
+	}
+
+	// 按过期时间删除
+	rec = doAdmin(t, h, http.MethodPost, "/admin/keys/bulk_delete", BulkDeleteRequest{ExpiresBefore: "now"})
+	decodeResponse(t, rec, &data)
+	if rec.Code != http.StatusOK || data["deleted"] != 2 {
+		t.Fatalf("delete by expires_before: %d %s", rec.Code, rec.Body)
+	}
+	if got := remainingKeys(t, s.keyStore); got != "sk-disabled,sk-forever" {
+		t.Errorf("remaining = %q", got)
+	}
+
+	resp := listAudit(t, h, AuditListRequest{Action: AuditActionBulkDelete})
+	if resp.Total != 2 || resp.Records[0].Target != "expires_before=now" || resp.Records[0].Detail != "deleted=2" || resp.Records[1].Target != "keys=2" {
+		t.Errorf("audit records = %+v", resp.Records)
+	}
+
+	tests := []struct {
+		name string
+		req  interface{}
+	}{
+		{"空条件", BulkDeleteRequest{}},
+		{"空 Key", BulkDeleteRequest{Keys: []string{"sk-forever", ""}}},
+		{"无效的过期时间", BulkDeleteRequest{ExpiresBefore: "yesterday"}},
+		{"Key 过多", BulkDeleteRequest{Keys: make([]string, maxBulkDeleteKeys+1)}},
+		{"无效 JSON", "not an object"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := doAdmin(t, h, http.MethodPost, "/admin/keys/bulk_delete", tt.req)
+			if rec.Code != http.StatusBadRequest {
+				t.Errorf("status = %d, want 400: %s", rec.Code, rec.Body)
+			}
+		})
+	}
+	if got := remainingKeys(t, s.keyStore); got != "sk-disabled,sk-forever" {
+		t.Errorf("rejected requests deleted keys: remaining %q", got)
+	}
+
+	// 显式确认后删除全部
+	rec = doAdmin(t, h, http.MethodPost, "/admin/keys/bulk_delete", BulkDeleteRequest{ConfirmAll: true})
+	decodeResponse(t, rec, &data)
+	if rec.Code != http.StatusOK || data["deleted"] != 2 || remainingKeys(t, s.keyStore) != "" {
+		t.Errorf("confirm_all: %d %s", rec.Code, rec.Body)
+	}
+}
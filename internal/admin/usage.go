@@ -4,6 +4,7 @@ import (
 	"database/sql"
 	"fmt"
 	"log"
+	"strings"
 	"time"
 )
 
@@ -110,13 +111,27 @@ type UsageQueryParams struct {
 	Model     string     // 按模型筛选
 	StartTime *time.Time // 开始时间
 	EndTime   *time.Time // 结束时间
-	Offset    int        // 偏移量
+	Offset    int        // 偏移量（设置 Cursor 时忽略）
 	Limit     int        // 限制数量
+	Cursor    string     // 游标（上一页的 NextCursor）
 }
 
-// Query 查询用量记录
-func (s *UsageStore) Query(params *UsageQueryParams) ([]*UsageRecord, int, error) {
-	// 构建查询条件
+// UsageQueryResult 用量查询结果
+type UsageQueryResult struct {
+	Records    []*UsageRecord // 当前页
+	Total      int            // 符合筛选条件的总数
+	HasMore    bool           // 是否还有下一页
+	NextCursor string         // 下一页游标（没有下一页时为空）
+}
+
+// usageWhere 根据查询参数构建筛选条件
+// 参数：
+//   - params: 查询参数
+//
+// 返回：
+//   - string: WHERE 条件
+//   - []interface{}: 查询参数
+func usageWhere(params *UsageQueryParams) (string, []interface{}) {
 	where := "1=1"
 	args := []interface{}{}
 
@@ -140,12 +155,25 @@ func (s *UsageStore) Query(params *UsageQueryParams) ([]*UsageRecord, int, error
 		where += " AND created_at <= ?"
 		args = append(args, *params.EndTime)
 	}
+	return where, args
+}
+
+// Query 查询用量记录（按 created_at 倒序）
+// 设置 Cursor 时使用 keyset 分页，从上一页最后一条之后继续，不受新写入记录影响
+// 参数：
+//   - params: 查询参数（筛选、分页）
+//
+// 返回：
+//   - *UsageQueryResult: 当前页、总数及下一页游标
+//   - error: 错误信息
+func (s *UsageStore) Query(params *UsageQueryParams) (*UsageQueryResult, error) {
+	where, args := usageWhere(params)
 
 	// 查询总数
 	countQuery := fmt.Sprintf("SELECT COUNT(*) FROM usage_records WHERE %s", where)
 	var total int
 	if err := s.db.QueryRow(countQuery, args...).Scan(&total); err != nil {
-		return nil, 0, fmt.Errorf("查询用量总数失败: %w", err)
+		return nil, fmt.Errorf("查询用量总数失败: %w", err)
 	}
 
 	// 设置默认值
@@ -157,59 +185,156 @@ func (s *UsageStore) Query(params *UsageQueryParams) ([]*UsageRecord, int, error
 		limit = 1000
 	}
 
-	// 查询列表
+	offset := params.Offset
+	if params.Cursor != "" {
+		cursor, err := decodeCursor(params.Cursor)
+		if err != nil {
+			return nil, err
+		}
+		where += " AND (created_at < ? OR (created_at = ? AND id < ?))"
+		args = append(args, cursor.CreatedAt, cursor.CreatedAt, cursor.ID)
+		offset = 0
+	}
+
+	// 查询列表（多取一条用于判断是否还有下一页）
 	query := fmt.Sprintf(`
 		SELECT id, request_id, api_key, user_id, model,
 			prompt_tokens, completion_tokens, total_tokens,
-			endpoint, backend_url, status_code, latency_ms, streaming, created_at
+			endpoint, backend_url, status_code, latency_ms, streaming, created_at,
+			CAST(created_at AS TEXT)
 		FROM usage_records
 		WHERE %s
-		ORDER BY created_at DESC
+		ORDER BY created_at DESC, id DESC
 		LIMIT ? OFFSET ?
 	`, where)
 
-	args = append(args, limit, params.Offset)
+	args = append(args, limit+1, offset)
 	rows, err := s.db.Query(query, args...)
 	if err != nil {
-		return nil, 0, fmt.Errorf("查询用量列表失败: %w", err)
+		return nil, fmt.Errorf("查询用量列表失败: %w", err)
 	}
 	defer func() {
 		_ = rows.Close()
 	}()
 
-	var records []*UsageRecord
+	result := &UsageQueryResult{Total: total}
+	var lastCreatedAt string
 	for rows.Next() {
-		var r UsageRecord
-		var requestID, apiKey, userID, model, endpoint, backendURL sql.NullString
-		if err := rows.Scan(
-			&r.ID, &requestID, &apiKey, &userID, &model,
-			&r.PromptTokens, &r.CompletionTokens, &r.TotalTokens,
-			&endpoint, &backendURL, &r.StatusCode, &r.LatencyMs, &r.Streaming, &r.CreatedAt,
-		); err != nil {
-			return nil, 0, fmt.Errorf("扫描用量记录失败: %w", err)
-		}
-		if requestID.Valid {
-			r.RequestID = requestID.String
+		if len(result.Records) == limit {
+			result.HasMore = true
+			break
 		}
-		if apiKey.Valid {
-			r.APIKey = apiKey.String
+		var createdAt string
+		r, err := scanUsageRecord(extraScanner{rows, []interface{}{&createdAt}})
+		if err != nil {
+			return nil, err
 		}
-		if userID.Valid {
-			r.UserID = userID.String
+		result.Records = append(result.Records, r)
+		lastCreatedAt = createdAt
+	}
+
+	if result.HasMore {
+		last := result.Records[len(result.Records)-1]
+		result.NextCursor = (&listCursor{CreatedAt: lastCreatedAt, ID: last.ID}).encode()
+	}
+	return result, nil
+}
+
+// usageExportBatchSize 导出时每批读取的记录数
+const usageExportBatchSize = 1000
+
+// Export 按 ID 顺序逐批读取符合条件的用量记录
+// 每批最多读取 usageExportBatchSize 条，内存占用与总记录数无关
+// 参数：
+//   - params: 查询参数（忽略分页）
+//   - fn: 每条记录的回调，返回错误时停止导出
+//
+// 返回：
+//   - error: 错误信息
+func (s *UsageStore) Export(params *UsageQueryParams, fn func(*UsageRecord) error) error {
+	where, args := usageWhere(params)
+	query := fmt.Sprintf(`
+		SELECT id, request_id, api_key, user_id, model,
+			prompt_tokens, completion_tokens, total_tokens,
+			endpoint, backend_url, status_code, latency_ms, streaming, created_at
+		FROM usage_records
+		WHERE %s AND id > ?
+		ORDER BY id ASC
+		LIMIT ?
+	`, where)
+
+	var lastID int64
+	for {
+		batch, err := s.exportBatch(query, append(args, lastID, usageExportBatchSize))
+		if err != nil {
+			return err
 		}
-		if model.Valid {
-			r.Model = model.String
+		for _, r := range batch {
+			if err := fn(r); err != nil {
+				return err
+			}
 		}
-		if endpoint.Valid {
-			r.Endpoint = endpoint.String
+		if len(batch) < usageExportBatchSize {
+			return nil
 		}
-		if backendURL.Valid {
-			r.BackendURL = backendURL.String
+		lastID = batch[len(batch)-1].ID
+	}
+}
+
+// exportBatch 读取一批用量记录（读完即释放连接，避免回调阻塞时长时间占用）
+func (s *UsageStore) exportBatch(query string, args []interface{}) ([]*UsageRecord, error) {
+	rows, err := s.db.Query(query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("导出用量记录失败: %w", err)
+	}
+	defer func() {
+		_ = rows.Close()
+	}()
+
+	batch := make([]*UsageRecord, 0, usageExportBatchSize)
+	for rows.Next() {
+		r, err := scanUsageRecord(rows)
+		if err != nil {
+			return nil, err
 		}
-		records = append(records, &r)
+		batch = append(batch, r)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("导出用量记录失败: %w", err)
 	}
+	return batch, nil
+}
 
-	return records, total, nil
+// scanUsageRecord 扫描一行用量记录
+func scanUsageRecord(rows rowScanner) (*UsageRecord, error) {
+	var r UsageRecord
+	var requestID, apiKey, userID, model, endpoint, backendURL sql.NullString
+	if err := rows.Scan(
+		&r.ID, &requestID, &apiKey, &userID, &model,
+		&r.PromptTokens, &r.CompletionTokens, &r.TotalTokens,
+		&endpoint, &backendURL, &r.StatusCode, &r.LatencyMs, &r.Streaming, &r.CreatedAt,
+	); err != nil {
+		return nil, fmt.Errorf("扫描用量记录失败: %w", err)
+	}
+	if requestID.Valid {
+		r.RequestID = requestID.String
+	}
+	if apiKey.Valid {
+		r.APIKey = apiKey.String
+	}
+	if userID.Valid {
+		r.UserID = userID.String
+	}
+	if model.Valid {
+		r.Model = model.String
+	}
+	if endpoint.Valid {
+		r.Endpoint = endpoint.String
+	}
+	if backendURL.Valid {
+		r.BackendURL = backendURL.String
+	}
+	return &r, nil
 }
 
 // UsageStats 用量统计
@@ -223,30 +348,7 @@ type UsageStats struct {
 
 // Stats 统计用量
 func (s *UsageStore) Stats(params *UsageQueryParams) (*UsageStats, error) {
-	// 构建查询条件
-	where := "1=1"
-	args := []interface{}{}
-
-	if params.APIKey != "" {
-		where += " AND api_key = ?"
-		args = append(args, params.APIKey)
-	}
-	if params.UserID != "" {
-		where += " AND user_id = ?"
-		args = append(args, params.UserID)
-	}
-	if params.Model != "" {
-		where += " AND model = ?"
-		args = append(args, params.Model)
-	}
-	if params.StartTime != nil {
-		where += " AND created_at >= ?"
-		args = append(args, *params.StartTime)
-	}
-	if params.EndTime != nil {
-		where += " AND created_at <= ?"
-		args = append(args, *params.EndTime)
-	}
+	where, args := usageWhere(params)
 
 	query := fmt.Sprintf(`
 		SELECT 
@@ -254,7 +356,7 @@ func (s *UsageStore) Stats(params *UsageQueryParams) (*UsageStats, error) {
 			COALESCE(SUM(total_tokens), 0) as total_tokens,
 			COALESCE(SUM(prompt_tokens), 0) as prompt_tokens,
 			COALESCE(SUM(completion_tokens), 0) as completion_tokens,
-			COALESCE(AVG(latency_ms), 0) as avg_latency_ms
+			CAST(COALESCE(AVG(latency_ms), 0) AS INTEGER) as avg_latency_ms
 		FROM usage_records
 		WHERE %s
 	`, where)
@@ -273,6 +375,105 @@ func (s *UsageStore) Stats(params *UsageQueryParams) (*UsageStats, error) {
 	return &stats, nil
 }
 
+// UsageGroupStats 分组用量统计（未参与分组的维度为空）
+type UsageGroupStats struct {
+	Model  string `json:"model,omitempty"`
+	UserID string `json:"user_id,omitempty"`
+	APIKey string `json:"api_key,omitempty"`
+	Day    string `json:"day,omitempty"` // 日期（YYYY-MM-DD，按记录写入时的时区）
+	UsageStats
+}
+
+// usageGroupColumns 支持的分组维度 -> SQL 表达式
+var usageGroupColumns = map[string]string{
+	"model":   "COALESCE(model, '')",
+	"user_id": "COALESCE(user_id, '')",
+	"api_key": "COALESCE(api_key, '')",
+	"day":     "substr(created_at, 1, 10)",
+}
+
+// ValidUsageGroupBy 检查分组维度是否受支持
+func ValidUsageGroupBy(dim string) bool {
+	_, ok := usageGroupColumns[dim]
+	return ok
+}
+
+// StatsGrouped 按维度分组统计用量
+// 参数：
+//   - params: 查询参数（筛选条件与 Stats 相同，忽略分页）
+//   - groupBy: 分组维度，可组合: model / user_id / api_key / day
+//
+// 返回：
+//   - []*UsageGroupStats: 每组的统计结果（按分组维度排序）
+//   - error: 错误信息
+func (s *UsageStore) StatsGrouped(params *UsageQueryParams, groupBy []string) ([]*UsageGroupStats, error) {
+	if len(groupBy) == 0 {
+		return nil, fmt.Errorf("group_by 不能为空")
+	}
+
+	var exprs []string
+	seen := make(map[string]bool)
+	for _, dim := range groupBy {
+		expr, ok := usageGroupColumns[dim]
+		if !ok {
+			return nil, fmt.Errorf("不支持的分组维度: %s", dim)
+		}
+		if seen[dim] {
+			return nil, fmt.Errorf("重复的分组维度: %s", dim)
+		}
+		seen[dim] = true
+		exprs = append(exprs, expr)
+	}
+
+	where, args := usageWhere(params)
+	cols := strings.Join(exprs, ", ")
+	query := fmt.Sprintf(`
+		SELECT %s,
+			COUNT(*) as total_requests,
+			COALESCE(SUM(total_tokens), 0) as total_tokens,
+			COALESCE(SUM(prompt_tokens), 0) as prompt_tokens,
+			COALESCE(SUM(completion_tokens), 0) as completion_tokens,
+			CAST(COALESCE(AVG(latency_ms), 0) AS INTEGER) as avg_latency_ms
+		FROM usage_records
+		WHERE %s
+		GROUP BY %s
+		ORDER BY %s
+	`, cols, where, cols, cols)
+
+	rows, err := s.db.Query(query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("分组统计用量失败: %w", err)
+	}
+	defer func() {
+		_ = rows.Close()
+	}()
+
+	var result []*UsageGroupStats
+	for rows.Next() {
+		var g UsageGroupStats
+		dest := make([]interface{}, 0, len(groupBy)+5)
+		for _, dim := range groupBy {
+			switch dim {
+			case "model":
+				dest = append(dest, &g.Model)
+			case "user_id":
+				dest = append(dest, &g.UserID)
+			case "api_key":
+				dest = append(dest, &g.APIKey)
+			case "day":
+				dest = append(dest, &g.Day)
+			}
+		}
+		dest = append(dest, &g.TotalRequests, &g.TotalTokens, &g.PromptTokens, &g.CompletionTokens, &g.AvgLatencyMs)
+		if err := rows.Scan(dest...); err != nil {
+			return nil, fmt.Errorf("扫描行失败: %w", err)
+		}
+		result = append(result, &g)
+	}
+
+	return result, nil
+}
+
 // Cleanup 清理过期数据
 func (s *UsageStore) Cleanup() (int64, error) {
 	if s.retentionDays <= 0 {
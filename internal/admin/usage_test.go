@@ -0,0 +1,318 @@
+package admin
+
+import (
+	"encoding/csv"
+	"fmt"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+)
+
+// newTestUsageStore 在服务器的 KeyStore 数据库上创建用量存储
+func newTestUsageStore(t *testing.T, s *Server) *UsageStore {
+	t.Helper()
+	store, err := NewUsageStore(s.keyStore.GetDB(), 0)
+	if err != nil {
+		t.Fatalf("NewUsageStore() error = %v", err)
+	}
+	s.SetUsageStore(store)
+	return store
+}
+
+// usageDay 测试数据的基准日期
+var usageDay = time.Date(2026, 3, 14, 9, 0, 0, 0, time.UTC)
+
+// seedUsage 写入跨模型、用户和日期的用量记录
+// 每条记录 total_tokens = prompt + completion
+func seedUsage(t *testing.T, store *UsageStore) {
+	t.Helper()
+	records := []UsageRecord{
+		{APIKey: "sk-alice", UserID: "alice", Model: "gpt-4o", PromptTokens: 100, CompletionTokens: 50, LatencyMs: 100, CreatedAt: usageDay},
+		{APIKey: "sk-alice", UserID: "alice", Model: "gpt-4o", PromptTokens: 200, CompletionTokens: 100, LatencyMs: 300, CreatedAt: usageDay.Add(2 * time.Hour)},
+		{APIKey: "sk-alice", UserID: "alice", Model: "llama-3", PromptTokens: 10, CompletionTokens: 5, LatencyMs: 50, CreatedAt: usageDay.AddDate(0, 0, 1)},
+		{APIKey: "sk-bob", UserID: "bob", Model: "gpt-4o", PromptTokens: 1000, CompletionTokens: 500, LatencyMs: 200, CreatedAt: usageDay.AddDate(0, 0, 1)},
+		{APIKey: "sk-bob", UserID: "bob", Model: "llama-3", PromptTokens: 20, CompletionTokens: 10, LatencyMs: 70, CreatedAt: usageDay.AddDate(0, 0, 2)},
+		{APIKey: "sk-anon", Model: "llama-3", PromptTokens: 1, CompletionTokens: 1, LatencyMs: 10, CreatedAt: usageDay.AddDate(0, 0, 2)},
+	}
+	for i := range records {
+		r := records[i]
+		r.RequestID = fmt.Sprintf("req-%d", i)
+		r.TotalTokens = r.PromptTokens + r.CompletionTokens
+		r.StatusCode = http.StatusOK
+		if err := store.Record(&r); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+// groupKey 拼接分组维度值，便于断言
+func groupKey(g *UsageGroupStats) string {
+	return g.Model + "|" + g.UserID + "|" + g.APIKey + "|" + g.Day
+}
+
+// sortKey 按分组维度顺序拼接维度值，用于检查排序
+func sortKey(g *UsageGroupStats, groupBy []string) string {
+	values := map[string]string{"model": g.Model, "user_id": g.UserID, "api_key": g.APIKey, "day": g.Day}
+	parts := make([]string, len(groupBy))
+	for i, dim := range groupBy {
+		parts[i] = values[dim]
+	}
+	return strings.Join(parts, "\x00")
+}
+
+func TestUsageStatsGrouped(t *testing.T) {
+	s, _ := newTestServer(t)
+	store := newTestUsageStore(t, s)
+	seedUsage(t, store)
+
+	type sums struct {
+		requests, total, prompt, completion, latency int64
+	}
+	tests := []struct {
+		name    string
+		params  UsageQueryParams
+		groupBy []string
+		want    map[string]sums
+	}{
+		{
+			name:    "按模型",
+			groupBy: []string{"model"},
+			want: map[string]sums{
+				"gpt-4o|||":  {3, 1950, 1300, 650, 200},
+				"llama-3|||": {3, 47, 31, 16, 43},
+			},
+		},
+		{
+			name:    "按用户（无用户的记录归为空字符串）",
+			groupBy: []string{"user_id"},
+			want: map[string]sums{
+				"|||":      {1, 2, 1, 1, 10},
+				"|alice||": {3, 465, 310, 155, 150},
+				"|bob||":   {2, 1530, 1020, 510, 135},
+			},
+		},
+		{
+			name:    "按日期",
+			groupBy: []string{"day"},
+			want: map[string]sums{
+				"|||2026-03-14": {2, 450, 300, 150, 200},
+				"|||2026-03-15": {2, 1515, 1010, 505, 125},
+				"|||2026-03-16": {2, 32, 21, 11, 40},
+			},
+		},
+		{
+			name:    "按模型和日期",
+			groupBy: []string{"model", "day"},
+			want: map[string]sums{
+				"gpt-4o|||2026-03-14":  {2, 450, 300, 150, 200},
+				"gpt-4o|||2026-03-15":  {1, 1500, 1000, 500, 200},
+				"llama-3|||2026-03-15": {1, 15, 10, 5, 50},
+				"llama-3|||2026-03-16": {2, 32, 21, 11, 40},
+			},
+		},
+		{
+			name:    "筛选后按 Key 分组",
+			params:  UsageQueryParams{Model: "gpt-4o"},
+			groupBy: []string{"api_key"},
+			want: map[string]sums{
+				"||sk-alice|": {2, 450, 300, 150, 200},
+				"||sk-bob|":   {1, 1500, 1000, 500, 200},
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			groups, err := store.StatsGrouped(&tt.params, tt.groupBy)
+			if err != nil {
+				t.Fatalf("StatsGrouped() error = %v", err)
+			}
+			if len(groups) != len(tt.want) {
+				t.Fatalf("StatsGrouped() returned %d groups, want %d", len(groups), len(tt.want))
+			}
+			for i, g := range groups {
+				want, ok := tt.want[groupKey(g)]
+				if !ok {
+					t.Errorf("unexpected group %q", groupKey(g))
+					continue
+				}
+				got := sums{g.TotalRequests, g.TotalTokens, g.PromptTokens, g.CompletionTokens, g.AvgLatencyMs}
+				if got != want {
+					t.Errorf("group %q = %+v, want %+v", groupKey(g), got, want)
+				}
+				// 按分组维度排序
+				if i > 0 && sortKey(groups[i-1], tt.groupBy) > sortKey(g, tt.groupBy) {
+					t.Errorf("groups not sorted: %q before %q", groupKey(groups[i-1]), groupKey(g))
+				}
+			}
+		})
+	}
+
+	// 各分组之和等于总计
+	total, err := store.Stats(&UsageQueryParams{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if total.TotalRequests != 6 || total.TotalTokens != 1997 {
+		t.Errorf("Stats() = %+v", total)
+	}
+
+	for _, groupBy := range [][]string{nil, {"region"}, {"model", "model"}} {
+		if _, err := store.StatsGrouped(&UsageQueryParams{}, groupBy); err == nil {
+			t.Errorf("StatsGrouped(%v) error = nil", groupBy)
+		}
+	}
+}
+
+func TestUsageStatsEndpoint(t *testing.T) {
+	s, h := newTestServer(t)
+	seedUsage(t, newTestUsageStore(t, s))
+
+	var groups []*UsageGroupStats
+	rec := doAdmin(t, h, http.MethodPost, "/admin/usage/stats", UsageStatsRequest{
+		UsageFilter: UsageFilter{UserID: "alice", StartTime: "2026-03-14T00:00:00Z", EndTime: "2026-03-14T23:59:59Z"},
+		GroupBy:     []string{"model"},
+	})
+	decodeResponse(t, rec, &groups)
+	if rec.Code != http.StatusOK || len(groups) != 1 || groups[0].Model != "gpt-4o" || groups[0].TotalTokens != 450 {
+		t.Errorf("grouped stats = %d %s", rec.Code, rec.Body)
+	}
+
+	// 不分组时返回总计
+	var stats UsageStats
+	rec = doAdmin(t, h, http.MethodPost, "/admin/usage/stats", UsageStatsRequest{UsageFilter: UsageFilter{Model: "llama-3"}})
+	decodeResponse(t, rec, &stats)
+	if rec.Code != http.StatusOK || stats.TotalRequests != 3 || stats.TotalTokens != 47 {
+		t.Errorf("flat stats = %d %s", rec.Code, rec.Body)
+	}
+
+	// 没有匹配时返回空数组而不是 null
+	rec = doAdmin(t, h, http.MethodPost, "/admin/usage/stats", UsageStatsRequest{UsageFilter: UsageFilter{Model: "none"}, GroupBy: []string{"day"}})
+	if rec.Code != http.StatusOK || !strings.Contains(rec.Body.String(), `"data":[]`) {
+		t.Errorf("empty grouped stats = %d %s", rec.Code, rec.Body)
+	}
+
+	for _, groupBy := range [][]string{{"region"}, {"day", "day"}} {
+		rec := doAdmin(t, h, http.MethodPost, "/admin/usage/stats", UsageStatsRequest{GroupBy: groupBy})
+		if rec.Code != http.StatusBadRequest {
+			t.Errorf("group_by %v: status = %d, want 400", groupBy, rec.Code)
+		}
+	}
+}
+
+func TestUsageExportCSV(t *testing.T) {
+	s, h := newTestServer(t)
+	store := newTestUsageStore(t, s)
+	records := []*UsageRecord{
+		{RequestID: "req-1", APIKey: "sk-live-0123456789", UserID: "alice", Model: "gpt-4o", PromptTokens: 10, CompletionTokens: 5, TotalTokens: 15,
+			Endpoint: "/v1/chat/completions", BackendURL: "http://vllm-1:8000", StatusCode: 200, LatencyMs: 120, Streaming: true, CreatedAt: usageDay},
+		{RequestID: "req-2", APIKey: "short", UserID: "bob", Model: "llama-3", TotalTokens: 0, StatusCode: 502, CreatedAt: usageDay.Add(time.Hour)},
+		{RequestID: "req-3", UserID: "carol", Model: "gpt-4o, \"quoted\"", StatusCode: 200, CreatedAt: usageDay.Add(2 * time.Hour)},
+		{RequestID: "req-4", APIKey: "sk-live-9999999999", UserID: "dave", Model: "gpt-4o", StatusCode: 200, CreatedAt: usageDay.AddDate(0, 1, 0)},
+	}
+	for _, r := range records {
+		if err := store.Record(r); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	rec := doAdmin(t, h, http.MethodPost, "/admin/usage/export", UsageExportRequest{UsageFilter{EndTime: "2026-03-31T00:00:00Z"}})
+	if rec.Code != http.StatusOK {
+		t.Fatalf("export: status = %d, body = %s", rec.Code, rec.Body)
+	}
+	if ct := rec.Header().Get("Content-Type"); ct != "text/csv; charset=utf-8" {
+		t.Errorf("Content-Type = %q", ct)
+	}
+	if cd := rec.Header().Get("Content-Disposition"); !strings.HasPrefix(cd, `attachment; filename="usage-`) {
+		t.Errorf("Content-Disposition = %q", cd)
+	}
+
+	rows, err := csv.NewReader(rec.Body).ReadAll()
+	if err != nil {
+		t.Fatalf("parse CSV: %v", err)
+	}
+	if strings.Join(rows[0], ",") != strings.Join(usageExportColumns, ",") {
+		t.Fatalf("header = %v, want %v", rows[0], usageExportColumns)
+	}
+	// 时间范围外的 req-4 不导出
+	if len(rows) != 4 {
+		t.Fatalf("exported %d rows, want 3 records + header", len(rows)-1)
+	}
+
+	col := make(map[string]int)
+	for i, name := range rows[0] {
+		col[name] = i
+	}
+	want := []map[string]string{
+		{"id": "1", "created_at": "2026-03-14T09:00:00Z", "request_id": "req-1", "api_key": "sk-l***6789", "user_id": "alice", "model": "gpt-4o",
+			"prompt_tokens": "10", "completion_tokens": "5", "total_tokens": "15", "endpoint": "/v1/chat/completions",
+			"backend_url": "http://vllm-1:8000", "status_code": "200", "latency_ms": "120", "streaming": "true"},
+		{"request_id": "req-2", "api_key": "***", "status_code": "502", "streaming": "false"},
+		{"request_id": "req-3", "api_key": "", "model": `gpt-4o, "quoted"`},
+	}
+	for i, fields := range want {
+		row := rows[i+1]
+		if len(row) != len(usageExportColumns) {
+			t.Fatalf("row %d has %d columns, want %d", i+1, len(row), len(usageExportColumns))
+		}
+		for name, value := range fields {
+			if got := row[col[name]]; got != value {
+				t.Errorf("row %d %s = %q, want %q", i+1, name, got, value)
+			}
+		}
+		// 明文 Key 不出现在导出中
+		for _, r := range records {
+			if len(r.APIKey) > 8 && strings.Contains(strings.Join(row, ","), r.APIKey) {
+				t.Errorf("row %d contains plaintext key %s", i+1, r.APIKey)
+			}
+		}
+	}
+}
+
+func TestUsageExportBatches(t *testing.T) {
+	s, _ := newTestServer(t)
+	store := newTestUsageStore(t, s)
+
+	// 跨多个批次写入，验证分批读取不重复、不遗漏
+	const n = 2*usageExportBatchSize + 1
+	tx, err := store.GetDB().Begin()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < n; i++ {
+		model := "gpt-4o"
+		if i%2 == 1 {
+			model = "llama-3"
+		}
+		if _, err := tx.Exec(`INSERT INTO usage_records (request_id, api_key, user_id, model, endpoint, backend_url, status_code, latency_ms, created_at)
+			VALUES (?, '', '', ?, '', '', 200, 0, ?)`, fmt.Sprintf("req-%d", i), model, usageDay); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		t.Fatal(err)
+	}
+
+	count := func(params *UsageQueryParams) int {
+		var lastID int64
+		total := 0
+		err := store.Export(params, func(r *UsageRecord) error {
+			if r.ID <= lastID {
+				t.Fatalf("record %d exported after %d", r.ID, lastID)
+			}
+			lastID = r.ID
+			total++
+			return nil
+		})
+		if err != nil {
+			t.Fatalf("Export() error = %v", err)
+		}
+		return total
+	}
+	if got := count(&UsageQueryParams{}); got != n {
+		t.Errorf("exported %d records, want %d", got, n)
+	}
+	if got := count(&UsageQueryParams{Model: "gpt-4o"}); got != usageExportBatchSize+1 {
+		t.Errorf("exported %d gpt-4o records, want %d", got, usageExportBatchSize+1)
+	}
+}
@@ -0,0 +1,84 @@
+package auth
+
+import (
+	"fmt"
+
+	"llmproxy/internal/admin"
+)
+
+// adminKeyStore 将 Admin 模块的 SQLite KeyStore 适配为 KeyStore 接口
+// 供代理处理器查询 Key 信息和扣减额度
+type adminKeyStore struct {
+	store *admin.KeyStore
+}
+
+// NewAdminKeyStore 创建基于 Admin KeyStore 的 Key 存储
+// 参数：
+//   - store: Admin 模块的 KeyStore
+//
+// 返回：
+//   - KeyStore: Key 存储实例（store 为 nil 时返回 nil）
+func NewAdminKeyStore(store *admin.KeyStore) KeyStore {
+	if store == nil {
+		return nil
+	}
+	return &adminKeyStore{store: store}
+}
+
+// Get 获取 API Key
+func (s *adminKeyStore) Get(key string) (*APIKey, error) {
+	k, err := s.store.Get(key)
+	if err != nil {
+		return nil, err
+	}
+	if k == nil {
+		return nil, fmt.Errorf("API Key 不存在")
+	}
+
+	apiKey := &APIKey{
+		Key:              k.Key,
+		Name:             k.Name,
+		UserID:           k.UserID,
+		Status:           k.Status.String(),
+		TotalQuota:       k.TotalQuota,
+		UsedQuota:        k.UsedQuota,
+		QuotaResetPeriod: k.QuotaResetPeriod,
+		Rollover:         k.Rollover,
+		RolloverCap:      k.RolloverCap,
+		RolloverQuota:    k.RolloverQuota,
+		DailyCostLimit:   k.DailyCostLimit,
+		ExpiresAt:        k.ExpiresAt,
+		CreatedAt:        k.CreatedAt,
+		UpdatedAt:        k.UpdatedAt,
+	}
+	if k.LastResetAt != nil {
+		apiKey.LastResetAt = *k.LastResetAt
+	}
+	return apiKey, nil
+}
+
+// Update 更新 API Key（仅同步名称、用户、额度配置和过期时间）
+func (s *adminKeyStore) Update(key *APIKey) error {
+	k, err := s.store.Get(key.Key)
+	if err != nil {
+		return err
+	}
+	if k == nil {
+		return fmt.Errorf("API Key 不存在")
+	}
+
+	k.Name = key.Name
+	k.UserID = key.UserID
+	k.TotalQuota = key.TotalQuota
+	k.QuotaResetPeriod = key.QuotaResetPeriod
+	k.Rollover = key.Rollover
+	k.RolloverCap = key.RolloverCap
+	k.DailyCostLimit = key.DailyCostLimit
+	k.ExpiresAt = key.ExpiresAt
+	return s.store.Update(k)
+}
+
+// IncrementUsedQuota 增加已使用额度（原子操作）
+func (s *adminKeyStore) IncrementUsedQuota(key string, tokens int64) error {
+	return s.store.IncrementUsedQuota(key, tokens)
+}
@@ -0,0 +1,29 @@
+package auth
+
+import (
+	"llmproxy/internal/types"
+)
+
+// Identity 调用方身份（使用 types 包中的定义）
+type Identity = types.Identity
+
+// NewIdentity 从鉴权元数据构造调用方身份
+// 参数：
+//   - apiKey: API Key
+//   - provider: 做出放行决策的 Provider
+//   - metadata: 鉴权元数据
+//
+// 返回：
+//   - *Identity: 调用方身份
+func NewIdentity(apiKey, provider string, metadata map[string]interface{}) *Identity {
+	identity := &Identity{
+		APIKey:        apiKey,
+		Provider:      provider,
+		Metadata:      metadata,
+		AllowedModels: ParseAllowedModels(metadata[MetadataAllowedModels]),
+	}
+	identity.UserID, _ = metadata["user_id"].(string)
+	identity.Name, _ = metadata["name"].(string)
+	identity.RateTier, _ = metadata["rate_tier"].(string)
+	return identity
+}
@@ -1,6 +1,7 @@
 package auth
 
 import (
+	"fmt"
 	"log"
 	"net/http"
 	"time"
@@ -81,6 +82,11 @@ func MiddlewareWithConfig(keyStore KeyStore, config *MiddlewareConfig, next http
 		// 6. 检查额度
 		if !CheckQuota(key) {
 			log.Printf("鉴权失败: 额度不足: %s", utils.MaskKey(apiKey))
+			if resetAt, ok := NextQuotaReset(key); ok {
+				SetResetHeaders(w, resetAt)
+				http.Error(w, fmt.Sprintf(`{"error":"Quota exceeded","reset_at":%q}`, resetAt.Format(time.RFC3339)), http.StatusTooManyRequests)
+				return
+			}
 			http.Error(w, `{"error":"Quota exceeded"}`, http.StatusTooManyRequests)
 			return
 		}
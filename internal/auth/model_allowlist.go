@@ -0,0 +1,74 @@
+package auth
+
+import (
+	"context"
+	"strings"
+
+	"llmproxy/internal/routing"
+	"llmproxy/internal/types"
+)
+
+// MetadataAllowedModels 鉴权元数据中模型白名单的字段名
+const MetadataAllowedModels = "allowed_models"
+
+// AllowedModels 从上下文中的调用方身份读取模型白名单（未限制时返回 nil）
+func AllowedModels(ctx context.Context) []string {
+	if identity := types.IdentityFromContext(ctx); identity != nil {
+		return identity.AllowedModels
+	}
+	return nil
+}
+
+// ParseAllowedModels 解析 Provider 返回的模型白名单
+// 支持逗号分隔的字符串（数据库列、Redis 字段）和字符串数组（Lua 脚本、JSON）
+// 参数：
+//   - v: allowed_models 字段的值
+//
+// 返回：
+//   - []string: 模型列表（为空表示不限制）
+func ParseAllowedModels(v interface{}) []string {
+	var items []string
+	switch val := v.(type) {
+	case string:
+		items = strings.Split(val, ",")
+	case []byte:
+		items = strings.Split(string(val), ",")
+	case []string:
+		items = val
+	case []interface{}:
+		for _, item := range val {
+			if s, ok := item.(string); ok {
+				items = append(items, s)
+			}
+		}
+	case map[string]interface{}:
+		// Lua 数组表转换后为以下标为键的表
+		for _, item := range val {
+			if s, ok := item.(string); ok {
+				items = append(items, s)
+			}
+		}
+	}
+
+	var models []string
+	for _, item := range items {
+		if item = strings.TrimSpace(item); item != "" {
+			models = append(models, item)
+		}
+	}
+	return models
+}
+
+// ModelAllowed 检查模型是否在白名单内（白名单为空表示不限制）
+// 参数：
+//   - allowed: 模型白名单（支持 * 后缀通配，单独的 * 匹配所有模型）
+//   - model: 请求的模型名
+//
+// 返回：
+//   - bool: 是否允许
+func ModelAllowed(allowed []string, model string) bool {
+	if len(allowed) == 0 {
+		return true
+	}
+	return routing.MatchModels(allowed, model)
+}
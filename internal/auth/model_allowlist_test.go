@@ -0,0 +1,71 @@
+package auth
+
+import (
+	"context"
+	"reflect"
+	"testing"
+
+	"llmproxy/internal/types"
+)
+
+func TestParseAllowedModels(t *testing.T) {
+	tests := []struct {
+		name  string
+		value interface{}
+		want  []string
+	}{
+		{"逗号分隔", "gpt-4o, gpt-4o-mini ,claude-*", []string{"gpt-4o", "gpt-4o-mini", "claude-*"}},
+		{"数据库 []byte", []byte("gpt-4o,"), []string{"gpt-4o"}},
+		{"字符串数组", []string{"gpt-4o", " "}, []string{"gpt-4o"}},
+		{"JSON 数组", []interface{}{"gpt-4o", 1, "o1-*"}, []string{"gpt-4o", "o1-*"}},
+		{"Lua 数组表", map[string]interface{}{"1": "gpt-4o"}, []string{"gpt-4o"}},
+		{"空字符串", "", nil},
+		{"未设置", nil, nil},
+		{"不支持的类型", 42, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := ParseAllowedModels(tt.value); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("ParseAllowedModels(%v) = %q, want %q", tt.value, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestModelAllowed(t *testing.T) {
+	allowed := []string{"gpt-4o", "claude-3-*"}
+
+	tests := []struct {
+		name    string
+		allowed []string
+		model   string
+		want    bool
+	}{
+		{"在白名单内", allowed, "gpt-4o", true},
+		{"不在白名单内", allowed, "gpt-4", false},
+		{"不做前缀匹配", allowed, "gpt-4o-mini", false},
+		{"通配符匹配", allowed, "claude-3-opus", true},
+		{"通配符不匹配", allowed, "claude-2", false},
+		{"单独的 * 匹配所有模型", []string{"*"}, "any-model", true},
+		{"未限制", nil, "any-model", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := ModelAllowed(tt.allowed, tt.model); got != tt.want {
+				t.Errorf("ModelAllowed(%q, %q) = %v, want %v", tt.allowed, tt.model, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestAllowedModelsFromIdentity(t *testing.T) {
+	if got := AllowedModels(context.Background()); got != nil {
+		t.Errorf("AllowedModels() without identity = %q, want nil", got)
+	}
+
+	identity := NewIdentity("sk-test", "file", map[string]interface{}{MetadataAllowedModels: "gpt-4o,o1-*"})
+	ctx := types.WithIdentity(context.Background(), identity)
+	if got := AllowedModels(ctx); !reflect.DeepEqual(got, []string{"gpt-4o", "o1-*"}) {
+		t.Errorf("AllowedModels() = %q", got)
+	}
+}
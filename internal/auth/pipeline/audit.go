@@ -0,0 +1,281 @@
+package pipeline
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"log"
+	"math/rand"
+	"strings"
+	"sync"
+	"time"
+
+	"llmproxy/internal/config"
+	"llmproxy/internal/logfile"
+)
+
+// 鉴权决策
+const (
+	AuditDecisionAllow = "allow"
+	AuditDecisionDeny  = "deny"
+)
+
+// 鉴权审计默认参数
+const (
+	DefaultAuditTable = "auth_audit_logs"
+
+	auditQueueSize = 1024 // 待写入队列长度，写满时丢弃
+)
+
+// AuditEvent 一次鉴权决策
+type AuditEvent struct {
+	Timestamp time.Time `json:"timestamp"`
+	KeyPrefix string    `json:"key_prefix"`         // API Key 前缀（不记录完整 Key）
+	Decision  string    `json:"decision"`           // allow / deny
+	Reason    string    `json:"reason,omitempty"`   // 拒绝原因（状态名或错误消息）
+	Provider  string    `json:"provider,omitempty"` // 做出决策的 Provider
+	ClientIP  string    `json:"client_ip"`
+	Method    string    `json:"method"`
+	Path      string    `json:"path"`
+}
+
+// AuditLogger 鉴权决策审计日志
+// 异步写入文件（每行一条 JSON）或数据库；放行决策可按比例采样，并按每秒条数限流
+type AuditLogger struct {
+	cfg     *config.AuthAuditConfig
+	file    *logfile.File
+	db      *sql.DB
+	driver  string
+	table   string
+	queue   chan *AuditEvent
+	stop    chan struct{}
+	done    chan struct{}
+	closeMu sync.Once
+
+	mu          sync.Mutex // 保护限流计数
+	windowStart time.Time  // 当前限流窗口（1 秒）的开始时间
+	windowCount int        // 当前窗口已接收条数
+	dropped     int        // 当前窗口因限流或队列已满丢弃的条数
+}
+
+// NewAuditLogger 创建鉴权审计日志
+// 参数：
+//   - cfg: 审计配置
+//   - db: output=database 时使用的数据库连接
+//   - driver: 数据库驱动（mysql / postgres / sqlite）
+//
+// 返回：
+//   - *AuditLogger: 审计日志实例（未启用时为 nil）
+//   - error: 错误信息
+func NewAuditLogger(cfg *config.AuthAuditConfig, db *sql.DB, driver string) (*AuditLogger, error) {
+	if cfg == nil || !cfg.Enabled {
+		return nil, nil
+	}
+
+	a := &AuditLogger{
+		cfg:    cfg,
+		driver: driver,
+		queue:  make(chan *AuditEvent, auditQueueSize),
+		stop:   make(chan struct{}),
+		done:   make(chan struct{}),
+	}
+
+	switch cfg.Output {
+	case "database":
+		if db == nil {
+			return nil, fmt.Errorf("鉴权审计: 数据库 [%s] 未找到", cfg.Storage)
+		}
+		a.db = db
+		a.table = cfg.Table
+		if a.table == "" {
+			a.table = DefaultAuditTable
+		}
+		if err := a.initTable(); err != nil {
+			return nil, fmt.Errorf("初始化鉴权审计表失败: %w", err)
+		}
+		log.Printf("鉴权审计日志已启用，表: %s", a.table)
+	default:
+		if cfg.File == nil || cfg.File.Path == "" {
+			return nil, fmt.Errorf("鉴权审计: 未配置 file.path")
+		}
+		file, err := logfile.Open(cfg.File, 0600)
+		if err != nil {
+			return nil, fmt.Errorf("打开鉴权审计文件失败: %w", err)
+		}
+		a.file = file
+		log.Printf("鉴权审计日志已启用，文件: %s", cfg.File.Path)
+	}
+
+	go a.run()
+	return a, nil
+}
+
+// initTable 初始化审计表
+func (a *AuditLogger) initTable() error {
+	idType := "INTEGER PRIMARY KEY AUTOINCREMENT"
+	tsType := "DATETIME"
+	index := ""
+	switch a.driver {
+	case "mysql":
+		idType = "BIGINT AUTO_INCREMENT PRIMARY KEY"
+		index = ",\n\t\t\tINDEX idx_timestamp (timestamp)"
+	case "postgres":
+		idType = "BIGSERIAL PRIMARY KEY"
+		tsType = "TIMESTAMP"
+	}
+
+	createSQL := fmt.Sprintf(`
+		CREATE TABLE IF NOT EXISTS %s (
+			id %s,
+			timestamp %s NOT NULL,
+			key_prefix VARCHAR(32),
+			decision VARCHAR(8) NOT NULL,
+			reason VARCHAR(256),
+			provider VARCHAR(64),
+			client_ip VARCHAR(64),
+			method VARCHAR(10),
+			path VARCHAR(256)%s
+		)
+	`, a.table, idType, tsType, index)
+	if _, err := a.db.Exec(createSQL); err != nil {
+		return err
+	}
+	if a.driver == "mysql" {
+		return nil
+	}
+
+	indexSQL := fmt.Sprintf("CREATE INDEX IF NOT EXISTS idx_%s_timestamp ON %s (timestamp)", a.table, a.table)
+	_, err := a.db.Exec(indexSQL)
+	return err
+}
+
+// Record 记录一次鉴权决策（非阻塞）
+// 放行决策按 sample_rate 采样（deny_only 时不记录）；超过 max_per_second 或队列已满时丢弃
+// 参数：
+//   - event: 鉴权决策
+func (a *AuditLogger) Record(event *AuditEvent) {
+	if a == nil {
+		return
+	}
+	if event.Decision == AuditDecisionAllow {
+		if a.cfg.DenyOnly {
+			return
+		}
+		if rate := a.cfg.SampleRate; rate > 0 && rate < 1 && rand.Float64() >= rate {
+			return
+		}
+	}
+	if !a.admit(event.Timestamp) {
+		return
+	}
+
+	select {
+	case a.queue <- event:
+	default:
+		a.mu.Lock()
+		a.dropped++
+		a.mu.Unlock()
+	}
+}
+
+// admit 按每秒条数限流，新窗口开始时报告上一窗口丢弃的条数
+func (a *AuditLogger) admit(now time.Time) bool {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	if now.Sub(a.windowStart) >= time.Second {
+		if a.dropped > 0 {
+			log.Printf("鉴权审计: 超出写入上限，丢弃 %d 条记录", a.dropped)
+		}
+		a.windowStart = now
+		a.windowCount = 0
+		a.dropped = 0
+	}
+	if a.cfg.MaxPerSecond > 0 && a.windowCount >= a.cfg.MaxPerSecond {
+		a.dropped++
+		return false
+	}
+	a.windowCount++
+	return true
+}
+
+// run 后台写入循环，收到停止信号后写完队列中剩余的记录
+func (a *AuditLogger) run() {
+	defer close(a.done)
+	for {
+		select {
+		case event := <-a.queue:
+			a.writeOrLog(event)
+		case <-a.stop:
+			for {
+				select {
+				case event := <-a.queue:
+					a.writeOrLog(event)
+				default:
+					return
+				}
+			}
+		}
+	}
+}
+
+// writeOrLog 写入一条记录，失败时记录日志
+func (a *AuditLogger) writeOrLog(event *AuditEvent) {
+	if err := a.write(event); err != nil {
+		log.Printf("鉴权审计写入失败: %v", err)
+	}
+}
+
+// write 写入一条记录
+func (a *AuditLogger) write(event *AuditEvent) error {
+	if a.file != nil {
+		line, err := json.Marshal(event)
+		if err != nil {
+			return err
+		}
+		_, err = a.file.Write(append(line, '\n'))
+		return err
+	}
+
+	placeholders := make([]string, 8)
+	for i := range placeholders {
+		placeholders[i] = "?"
+		if a.driver == "postgres" {
+			placeholders[i] = fmt.Sprintf("$%d", i+1)
+		}
+	}
+	insertSQL := fmt.Sprintf(`
+		INSERT INTO %s (timestamp, key_prefix, decision, reason, provider, client_ip, method, path)
+		VALUES (%s)
+	`, a.table, strings.Join(placeholders, ", "))
+	_, err := a.db.Exec(insertSQL, event.Timestamp, event.KeyPrefix, event.Decision, event.Reason,
+		event.Provider, event.ClientIP, event.Method, event.Path)
+	return err
+}
+
+// Close 写完队列中的记录后关闭
+func (a *AuditLogger) Close() error {
+	if a == nil {
+		return nil
+	}
+	a.closeMu.Do(func() {
+		close(a.stop)
+	})
+	<-a.done
+	if a.file != nil {
+		return a.file.Close()
+	}
+	return nil
+}
+
+// auditKeyPrefix 返回用于审计的 Key 前缀
+// 足够区分 Key 来源（如 sk-proj-），又不足以还原 Key
+func auditKeyPrefix(apiKey string) string {
+	if apiKey == "" {
+		return ""
+	}
+	if len(apiKey) <= 12 {
+		return "***"
+	}
+	return apiKey[:8] + "***"
+}
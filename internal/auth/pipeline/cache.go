@@ -0,0 +1,131 @@
+package pipeline
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"llmproxy/internal/admin"
+)
+
+// 鉴权缓存默认参数
+const (
+	DefaultCacheTTL = 30 * time.Second // 缓存条目有效期
+
+	cacheWarmTimeout = 30 * time.Second // 启动预热超时
+	cachePruneSize   = 100000           // 条目数超过该值时清理过期条目
+)
+
+// Preloader 支持批量预加载的 Provider（用于启动时预热缓存）
+type Preloader interface {
+	// Preload 遍历数据源中的所有有效 Key
+	// 参数：
+	//   - ctx: 上下文
+	//   - fn: 处理函数（key 为明文或哈希存储的 Key，data 与 Query 返回的数据一致）
+	// 返回：
+	//   - error: 错误信息
+	Preload(ctx context.Context, fn func(key string, data map[string]interface{})) error
+}
+
+// cacheEntry 缓存条目
+type cacheEntry struct {
+	data      map[string]interface{} // Provider 返回的数据（只读）
+	expiresAt time.Time              // 过期时间
+}
+
+// cachedProvider 带 TTL 缓存的 Provider 包装
+// 只缓存命中的结果，未找到和查询错误不缓存，新建的 Key 可立即使用；
+// 缓存以 Key 的 SHA-256 哈希为索引，与 KeyStore 的哈希存储兼容，且不在内存中保留明文
+type cachedProvider struct {
+	Provider
+	ttl     time.Duration
+	mu      sync.RWMutex
+	entries map[string]cacheEntry
+	now     func() time.Time
+}
+
+// newCachedProvider 创建带缓存的 Provider
+// 参数：
+//   - provider: 被包装的 Provider
+//   - ttl: 缓存有效期（<= 0 时使用默认值）
+//
+// 返回：
+//   - *cachedProvider: 带缓存的 Provider
+func newCachedProvider(provider Provider, ttl time.Duration) *cachedProvider {
+	if ttl <= 0 {
+		ttl = DefaultCacheTTL
+	}
+	return &cachedProvider{
+		Provider: provider,
+		ttl:      ttl,
+		entries:  make(map[string]cacheEntry),
+		now:      time.Now,
+	}
+}
+
+// cacheKey 计算预加载条目的缓存索引（哈希存储的 Key 原样使用）
+func cacheKey(apiKey string) string {
+	if admin.IsHashedKey(apiKey) {
+		return apiKey
+	}
+	return admin.HashKey(apiKey)
+}
+
+// Query 优先从缓存读取，未命中时查询被包装的 Provider
+// 客户端提交的哈希值视为不存在：预加载的条目以哈希为索引，原样使用会绕过鉴权
+func (c *cachedProvider) Query(ctx context.Context, apiKey string) *ProviderResult {
+	if admin.IsHashedKey(apiKey) {
+		return &ProviderResult{Found: false}
+	}
+	k := admin.HashKey(apiKey)
+
+	c.mu.RLock()
+	entry, ok := c.entries[k]
+	c.mu.RUnlock()
+	if ok && c.now().Before(entry.expiresAt) {
+		return &ProviderResult{Found: true, Data: entry.data}
+	}
+
+	result := c.Provider.Query(ctx, apiKey)
+	if result.Found && result.Error == nil {
+		c.store(k, result.Data)
+	}
+	return result
+}
+
+// store 写入缓存条目
+func (c *cachedProvider) store(k string, data map[string]interface{}) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	now := c.now()
+	if len(c.entries) > cachePruneSize {
+		for key, entry := range c.entries {
+			if !now.Before(entry.expiresAt) {
+				delete(c.entries, key)
+			}
+		}
+	}
+	c.entries[k] = cacheEntry{data: data, expiresAt: now.Add(c.ttl)}
+}
+
+// warm 通过被包装 Provider 的 Preload 预热缓存
+// 参数：
+//   - ctx: 上下文
+//
+// 返回：
+//   - int: 预加载的 Key 数量
+//   - error: 错误信息（Provider 不支持预加载时返回 nil）
+func (c *cachedProvider) warm(ctx context.Context) (int, error) {
+	preloader, ok := c.Provider.(Preloader)
+	if !ok {
+		return 0, nil
+	}
+
+	count := 0
+	err := preloader.Preload(ctx, func(key string, data map[string]interface{}) {
+		c.store(cacheKey(key), data)
+		count++
+	})
+	return count, err
+}
@@ -20,6 +20,8 @@ func FromConfig(cfg *config.AuthConfig) *PipelineConfig {
 	pipelineConfig := &PipelineConfig{
 		Enabled:     true,
 		HeaderNames: cfg.HeaderNames,
+		Scheme:      cfg.Scheme,
+		QueryParam:  cfg.QueryParam,
 		SkipPaths:   cfg.SkipPaths,
 		Mode:        PipelineMode(cfg.Mode),
 		Providers:   make([]*ProviderConfig, 0),
@@ -43,6 +45,8 @@ func FromConfig(cfg *config.AuthConfig) *PipelineConfig {
 			if p.Lua != nil {
 				providerCfg.LuaScript = p.Lua.Script
 				providerCfg.LuaScriptFile = p.Lua.Path
+				providerCfg.LuaMaxMemory = p.Lua.MaxMemory
+				providerCfg.LuaModulePath = p.Lua.ModulePath
 			}
 
 			// 转换 Redis 配置
@@ -60,6 +64,8 @@ func FromConfig(cfg *config.AuthConfig) *PipelineConfig {
 					Table:     p.Database.Table,
 					KeyColumn: p.Database.KeyColumn,
 					Fields:    p.Database.Fields,
+
+					StartsAtColumn: p.Database.StartsAtColumn,
 				}
 			}
 
@@ -77,11 +83,31 @@ func FromConfig(cfg *config.AuthConfig) *PipelineConfig {
 				}
 			}
 
+			// 转换 OAuth2 令牌内省配置
+			if o := p.OAuth2Introspect; o != nil {
+				providerCfg.OAuth2Introspect = &OAuth2IntrospectConfig{
+					Endpoint:      o.Endpoint,
+					ClientID:      o.ClientID,
+					ClientSecret:  o.ClientSecret,
+					TokenTypeHint: o.TokenTypeHint,
+					Timeout:       o.Timeout,
+					Fields:        o.Fields,
+				}
+			}
+
 			// 转换静态配置
 			if p.Static != nil {
 				providerCfg.StaticKeys = p.Static.Keys
 			}
 
+			// 转换缓存配置
+			if p.Cache != nil {
+				providerCfg.Cache = &CacheConfig{
+					TTL:     p.Cache.TTL,
+					Preload: p.Cache.Preload,
+				}
+			}
+
 			pipelineConfig.Providers = append(pipelineConfig.Providers, providerCfg)
 		}
 	} else {
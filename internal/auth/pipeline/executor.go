@@ -2,14 +2,20 @@ package pipeline
 
 import (
 	"context"
+	"database/sql"
 	"encoding/json"
 	"fmt"
 	"log"
 	"net/http"
+	"strconv"
+	"strings"
 	"time"
 
 	"llmproxy/internal/admin"
+	"llmproxy/internal/auth"
 	"llmproxy/internal/config"
+	"llmproxy/internal/scripting"
+	"llmproxy/internal/utils"
 )
 
 // Executor 管道执行器
@@ -20,6 +26,20 @@ type Executor struct {
 	luaExecutor *LuaExecutor         // Lua 执行器
 	keyStore    *admin.KeyStore      // KeyStore 实例（用于 builtin provider）
 	statusCodes *config.StatusCodes  // 状态码配置
+	spend       SpendChecker         // 每日消费查询（可选）
+	audit       *AuditLogger         // 鉴权决策审计日志（可选）
+	denials     DenialLogger         // 拒绝请求的访问日志（可选）
+}
+
+// DenialLogger 拒绝请求的访问日志接口（由 proxy.Logger 实现）
+type DenialLogger interface {
+	LogDenied(r *http.Request, apiKey string, statusCode int, reason string, latency time.Duration)
+}
+
+// SpendChecker 每日消费查询接口（由 billing.SpendTracker 实现）
+type SpendChecker interface {
+	Spent(apiKey string) (float64, error)
+	NextReset() time.Time
 }
 
 // providerWithConfig Provider 及其配置
@@ -74,6 +94,13 @@ func NewExecutorWithStorage(cfg *PipelineConfig, storageManager interface{}, api
 		if err != nil {
 			return nil, fmt.Errorf("创建 Provider [%s] 失败: %w", providerCfg.Name, err)
 		}
+		if providerCfg.Cache != nil {
+			cached := newCachedProvider(provider, providerCfg.Cache.TTL)
+			if providerCfg.Cache.Preload {
+				executor.warmCache(providerCfg.Name, cached)
+			}
+			provider = cached
+		}
 
 		executor.providers = append(executor.providers, providerWithConfig{
 			provider: provider,
@@ -92,6 +119,39 @@ func NewExecutorWithStorage(cfg *PipelineConfig, storageManager interface{}, api
 	return executor, nil
 }
 
+// warmCache 启动时预热 Provider 缓存，避免重启后的请求全部穿透到数据源
+// 预热失败只记录日志，不影响启动
+// 参数：
+//   - name: Provider 名称
+//   - cached: 带缓存的 Provider
+func (e *Executor) warmCache(name string, cached *cachedProvider) {
+	ctx, cancel := context.WithTimeout(context.Background(), cacheWarmTimeout)
+	defer cancel()
+
+	start := time.Now()
+	count, err := cached.warm(ctx)
+	if err != nil {
+		log.Printf("鉴权管道: Provider [%s] 缓存预热失败（已加载 %d 个 Key）: %v", name, count, err)
+		return
+	}
+	log.Printf("鉴权管道: Provider [%s] 缓存预热完成，加载 %d 个 Key，耗时 %v", name, count, time.Since(start))
+}
+
+// SetAuditLogger 设置鉴权决策审计日志（Close 时一并关闭）
+func (e *Executor) SetAuditLogger(audit *AuditLogger) {
+	e.audit = audit
+}
+
+// SetDenialLogger 设置拒绝请求的访问日志，被鉴权拒绝的请求也会出现在访问日志中
+func (e *Executor) SetDenialLogger(denials DenialLogger) {
+	e.denials = denials
+}
+
+// SetSpendChecker 设置每日消费查询器，启用 daily_cost_limit 检查
+func (e *Executor) SetSpendChecker(spend SpendChecker) {
+	e.spend = spend
+}
+
 // createProviderWithStorage 创建带存储管理器的 Provider 实例
 func (e *Executor) createProviderWithStorage(cfg *ProviderConfig, storageManager interface{}, apiKeys []*config.APIKey) (Provider, error) {
 	switch cfg.Type {
@@ -112,18 +172,25 @@ func (e *Executor) createProviderWithStorage(cfg *ProviderConfig, storageManager
 		if storageManager == nil {
 			return nil, fmt.Errorf("redis provider 需要 StorageManager")
 		}
-		sm, ok := storageManager.(interface{ GetCache(string) interface{} })
-		if !ok {
+		var redisClient RedisClient
+		switch sm := storageManager.(type) {
+		case interface{ GetCache(string) RedisClient }:
+			redisClient = sm.GetCache(cfg.Redis.Storage)
+		case interface{ GetCache(string) interface{} }:
+			cache := sm.GetCache(cfg.Redis.Storage)
+			if cache != nil {
+				client, ok := cache.(RedisClient)
+				if !ok {
+					return nil, fmt.Errorf("无效的 Redis 客户端类型")
+				}
+				redisClient = client
+			}
+		default:
 			return nil, fmt.Errorf("StorageManager 不支持 GetCache")
 		}
-		cache := sm.GetCache(cfg.Redis.Storage)
-		if cache == nil {
+		if redisClient == nil {
 			return nil, fmt.Errorf("redis 缓存 [%s] 未找到", cfg.Redis.Storage)
 		}
-		redisClient, ok := cache.(RedisClient)
-		if !ok {
-			return nil, fmt.Errorf("无效的 Redis 客户端类型")
-		}
 		return NewRedisProviderWithClient(cfg.Name, redisClient, cfg.Redis.KeyPattern)
 
 	case ProviderTypeDatabase:
@@ -136,11 +203,18 @@ func (e *Executor) createProviderWithStorage(cfg *ProviderConfig, storageManager
 		if storageManager == nil {
 			return nil, fmt.Errorf("database provider 需要 StorageManager")
 		}
-		sm, ok := storageManager.(interface{ GetDatabase(string) interface{} })
-		if !ok {
+		// 鉴权只读查询，优先使用只读副本
+		var db interface{}
+		switch sm := storageManager.(type) {
+		case interface{ GetReadDatabase(string) *sql.DB }:
+			if conn := sm.GetReadDatabase(cfg.Database.Storage); conn != nil {
+				db = conn
+			}
+		case interface{ GetDatabase(string) interface{} }:
+			db = sm.GetDatabase(cfg.Database.Storage)
+		default:
 			return nil, fmt.Errorf("StorageManager 不支持 GetDatabase")
 		}
-		db := sm.GetDatabase(cfg.Database.Storage)
 		if db == nil {
 			return nil, fmt.Errorf("数据库 [%s] 未找到", cfg.Database.Storage)
 		}
@@ -149,6 +223,9 @@ func (e *Executor) createProviderWithStorage(cfg *ProviderConfig, storageManager
 	case ProviderTypeWebhook:
 		return NewWebhookProvider(cfg.Name, cfg.Webhook)
 
+	case ProviderTypeOAuth2Introspect:
+		return NewOAuth2IntrospectProvider(cfg.Name, cfg.OAuth2Introspect)
+
 	case ProviderTypeLua:
 		// Lua 类型使用脚本执行
 		return NewLuaProvider(cfg.Name, cfg.LuaScript, cfg.LuaScriptFile)
@@ -178,8 +255,8 @@ func (e *Executor) Execute(ctx context.Context, apiKey string, requestInfo *Requ
 	// 累积的元数据
 	metadata := make(map[string]interface{})
 
-	// 记录是否有任何 Provider 成功匹配
-	anyMatched := false
+	// 记录成功匹配的 Provider
+	var matched []string
 
 	for _, pwc := range e.providers {
 		// 查询 Provider
@@ -199,7 +276,7 @@ func (e *Executor) Execute(ctx context.Context, apiKey string, requestInfo *Requ
 			continue
 		}
 
-		anyMatched = true
+		matched = append(matched, pwc.provider.Name())
 
 		// 执行 Lua 脚本（如果有）
 		luaResult, err := e.executeLuaScript(pwc.config, &AuthContext{
@@ -212,8 +289,9 @@ func (e *Executor) Execute(ctx context.Context, apiKey string, requestInfo *Requ
 		if err != nil {
 			log.Printf("鉴权管道: Provider [%s] Lua 脚本执行错误: %v", pwc.provider.Name(), err)
 			return &AuthResult{
-				Allow:   false,
-				Message: fmt.Sprintf("鉴权脚本执行错误: %v", err),
+				Allow:    false,
+				Message:  fmt.Sprintf("鉴权脚本执行错误: %v", err),
+				Provider: pwc.provider.Name(),
 			}, nil
 		}
 
@@ -221,6 +299,17 @@ func (e *Executor) Execute(ctx context.Context, apiKey string, requestInfo *Requ
 		for k, v := range luaResult.Metadata {
 			metadata[k] = v
 		}
+		// Lua 脚本未返回的身份字段从 Provider 数据补充（供代理处理器直接使用，无需再次查询）
+		for _, k := range identityFields {
+			if _, ok := metadata[k]; ok {
+				continue
+			}
+			if v, ok := result.Data[k]; ok && v != nil {
+				metadata[k] = v
+			}
+		}
+
+		luaResult.Provider = pwc.provider.Name()
 
 		// 根据管道模式处理结果
 		switch e.config.Mode {
@@ -246,11 +335,12 @@ func (e *Executor) Execute(ctx context.Context, apiKey string, requestInfo *Requ
 	}
 
 	// 根据模式返回最终结果
-	if e.config.Mode == PipelineModeAll && anyMatched {
+	if e.config.Mode == PipelineModeAll && len(matched) > 0 {
 		// all 模式下，所有都通过
 		return &AuthResult{
 			Allow:    true,
 			Metadata: metadata,
+			Provider: strings.Join(matched, ","),
 		}, nil
 	}
 
@@ -258,6 +348,51 @@ func (e *Executor) Execute(ctx context.Context, apiKey string, requestInfo *Requ
 	return e.buildStatusResult("NOT_FOUND", KeyStatusActive), nil
 }
 
+// identityFields 从 Provider 数据补充到鉴权元数据的身份字段
+var identityFields = []string{"user_id", "name", "rate_tier", auth.MetadataAllowedModels}
+
+// TestAuth 用指定 Key 执行鉴权管道（供 Admin API 的 /admin/auth/test 排查鉴权问题）
+// 与 Middleware 的判断一致，但不转发请求、不写审计日志和访问日志
+// 参数：
+//   - ctx: 上下文
+//   - req: 测试请求（Key 及模拟的请求信息）
+//
+// 返回：
+//   - *admin.AuthTestResult: 鉴权结果（包含做出决策的 Provider）
+//   - error: 错误信息
+func (e *Executor) TestAuth(ctx context.Context, req *admin.AuthTestRequest) (*admin.AuthTestResult, error) {
+	ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	defer cancel()
+
+	result, err := e.Execute(ctx, req.Key, &RequestInfo{
+		Method:  req.Method,
+		Path:    req.Path,
+		Headers: req.Headers,
+		IP:      req.IP,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	// 未设置状态码时与 Middleware 一致：放行 200，拒绝 403
+	statusCode := result.StatusCode
+	if statusCode == 0 {
+		statusCode = http.StatusForbidden
+		if result.Allow {
+			statusCode = http.StatusOK
+		}
+	}
+	return &admin.AuthTestResult{
+		Allow:      result.Allow,
+		StatusCode: statusCode,
+		StatusName: result.StatusName,
+		Message:    result.Message,
+		Provider:   result.Provider,
+		Metadata:   result.Metadata,
+		ResetAt:    result.ResetAt,
+	}, nil
+}
+
 // executeLuaScript 执行 Lua 脚本
 func (e *Executor) executeLuaScript(cfg *ProviderConfig, ctx *AuthContext) (*AuthResult, error) {
 	// 如果没有配置 Lua 脚本，使用默认逻辑
@@ -267,11 +402,19 @@ func (e *Executor) executeLuaScript(cfg *ProviderConfig, ctx *AuthContext) (*Aut
 
 	// 从文件加载脚本
 	if cfg.LuaScriptFile != "" {
-		return e.luaExecutor.ExecuteFile(cfg.LuaScriptFile, ctx)
+		return e.luaExecutor.ExecuteFile(cfg.LuaScriptFile, ctx, luaOptions(cfg))
 	}
 
 	// 执行内联脚本
-	return e.luaExecutor.Execute(cfg.LuaScript, ctx)
+	return e.luaExecutor.Execute(cfg.LuaScript, ctx, luaOptions(cfg))
+}
+
+// luaOptions 从 Provider 配置构造 Lua 执行选项
+func luaOptions(cfg *ProviderConfig) LuaOptions {
+	return LuaOptions{
+		MaxMemory:  scripting.MB(cfg.LuaMaxMemory),
+		ModulePath: cfg.LuaModulePath,
+	}
 }
 
 // defaultAuthLogic 默认鉴权逻辑（无 Lua 脚本时使用）
@@ -286,7 +429,7 @@ func (e *Executor) defaultAuthLogic(ctx *AuthContext) (*AuthResult, error) {
 		case KeyStatusDisabled:
 			return e.buildStatusResult("DISABLED", KeyStatusDisabled), nil
 		case KeyStatusQuotaExceeded:
-			return e.buildStatusResult("QUOTA_EXCEEDED", KeyStatusQuotaExceeded), nil
+			return e.withQuotaReset(e.buildStatusResult("QUOTA_EXCEEDED", KeyStatusQuotaExceeded), data), nil
 		case KeyStatusExpired:
 			return e.buildStatusResult("EXPIRED", KeyStatusExpired), nil
 		default:
@@ -302,12 +445,19 @@ func (e *Executor) defaultAuthLogic(ctx *AuthContext) (*AuthResult, error) {
 		case "expired":
 			return e.buildStatusResult("EXPIRED", KeyStatusExpired), nil
 		case "quota_exceeded":
-			return e.buildStatusResult("QUOTA_EXCEEDED", KeyStatusQuotaExceeded), nil
+			return e.withQuotaReset(e.buildStatusResult("QUOTA_EXCEEDED", KeyStatusQuotaExceeded), data), nil
 		default:
 			return e.buildStatusResult("DISABLED", KeyStatusDisabled), nil
 		}
 	}
 
+	// 检查生效时间（未到 starts_at 的 Key 暂不可用）
+	if startsAt, ok := e.getUnixTime(data, "starts_at"); ok && startsAt > 0 {
+		if time.Now().Unix() < startsAt {
+			return e.buildStatusResult("NOT_YET_ACTIVE", KeyStatusDisabled), nil
+		}
+	}
+
 	// 检查过期时间（方案 A: LLMProxy 自动判断过期）
 	if expiresAt, ok := e.getInt64(data, "expires_at"); ok && expiresAt > 0 {
 		if time.Now().Unix() > expiresAt {
@@ -317,9 +467,13 @@ func (e *Executor) defaultAuthLogic(ctx *AuthContext) (*AuthResult, error) {
 
 	// 检查额度
 	if totalQuota, ok := e.getInt64(data, "total_quota"); ok && totalQuota > 0 {
+		// 结转额度计入本周期可用额度
+		if rollover, ok := e.getInt64(data, "rollover_quota"); ok && rollover > 0 {
+			totalQuota += rollover
+		}
 		usedQuota, _ := e.getInt64(data, "used_quota")
 		if usedQuota >= totalQuota {
-			return e.buildStatusResult("QUOTA_EXCEEDED", KeyStatusQuotaExceeded), nil
+			return e.withQuotaReset(e.buildStatusResult("QUOTA_EXCEEDED", KeyStatusQuotaExceeded), data), nil
 		}
 	}
 
@@ -330,12 +484,39 @@ func (e *Executor) defaultAuthLogic(ctx *AuthContext) (*AuthResult, error) {
 		}
 	}
 
+	// 检查每日消费上限
+	if limit, ok := e.getFloat64(data, "daily_cost_limit"); ok && limit > 0 && e.spend != nil {
+		spent, err := e.spend.Spent(ctx.APIKey)
+		if err != nil {
+			// 计数不可用时放行，避免 Redis 故障导致全部拒绝
+			log.Printf("鉴权管道: 查询每日消费失败: %v", err)
+		} else if spent >= limit {
+			result := e.buildStatusResult("DAILY_COST_EXCEEDED", KeyStatusQuotaExceeded)
+			result.ResetAt = e.spend.NextReset().Unix()
+			return result, nil
+		}
+	}
+
 	return &AuthResult{Allow: true, StatusCode: 200, StatusName: "ACTIVE"}, nil
 }
 
+// withQuotaReset 为额度耗尽的结果附加下一次重置时间（Provider 提供 quota_reset_at 时）
+// 参数：
+//   - result: 鉴权结果
+//   - data: Provider 查询到的数据
+//
+// 返回：
+//   - *AuthResult: 鉴权结果
+func (e *Executor) withQuotaReset(result *AuthResult, data map[string]interface{}) *AuthResult {
+	if resetAt, ok := e.getInt64(data, "quota_reset_at"); ok && resetAt > 0 {
+		result.ResetAt = resetAt
+	}
+	return result
+}
+
 // buildStatusResult 根据状态构建鉴权结果
 // 参数：
-//   - statusName: 状态名称（如 DISABLED, EXPIRED, QUOTA_EXCEEDED, NOT_FOUND）
+//   - statusName: 状态名称（如 DISABLED, EXPIRED, QUOTA_EXCEEDED, DAILY_COST_EXCEEDED, NOT_YET_ACTIVE, NOT_FOUND）
 //   - keyStatus: 内部状态码
 //
 // 返回：
@@ -376,6 +557,10 @@ func (e *Executor) getStatusConfig(statusName string) *config.StatusCodeConfig {
 		return e.statusCodes.Expired
 	case "QUOTA_EXCEEDED":
 		return e.statusCodes.QuotaExceeded
+	case "DAILY_COST_EXCEEDED":
+		return e.statusCodes.DailyCostExceeded
+	case "NOT_YET_ACTIVE":
+		return e.statusCodes.NotYetActive
 	case "NOT_FOUND":
 		return e.statusCodes.NotFound
 	default:
@@ -425,14 +610,56 @@ func (e *Executor) getFloat64(data map[string]interface{}, key string) (float64,
 	return 0, false
 }
 
+// unixTimeLayouts 字符串时间支持的格式（数据库 / Redis 中常见的写法）
+var unixTimeLayouts = []string{
+	time.RFC3339Nano,
+	"2006-01-02 15:04:05.999999999-07:00",
+	"2006-01-02 15:04:05.999999999 -0700 MST",
+	"2006-01-02 15:04:05",
+}
+
+// getUnixTime 从 map 中获取时间（Unix 秒）
+// 支持 Unix 时间戳（数字或数字字符串）、time.Time（数据库驱动返回）及常见的时间字符串
+func (e *Executor) getUnixTime(data map[string]interface{}, key string) (int64, bool) {
+	v, ok := data[key]
+	if !ok || v == nil {
+		return 0, false
+	}
+	switch val := v.(type) {
+	case time.Time:
+		if val.IsZero() {
+			return 0, false
+		}
+		return val.Unix(), true
+	case string:
+		if val == "" {
+			return 0, false
+		}
+		if i, err := strconv.ParseInt(val, 10, 64); err == nil {
+			return i, true
+		}
+		for _, layout := range unixTimeLayouts {
+			if t, err := time.Parse(layout, val); err == nil {
+				return t.Unix(), true
+			}
+		}
+		return 0, false
+	}
+	return e.getInt64(data, key)
+}
+
 // WriteErrorResponse 写入错误响应（JSON 格式）
 // 响应格式: {"error": {"code": "DISABLED", "message": "API Key 已被禁用"}}
+// 额度耗尽且可确定重置时间时，附加 reset_at 字段及 Retry-After / X-RateLimit-Reset 响应头
 // 参数：
 //   - w: HTTP 响应写入器
 //   - result: 鉴权结果
 //   - statusCode: HTTP 状态码（可选，优先使用 result.StatusCode）
 func WriteErrorResponse(w http.ResponseWriter, result *AuthResult, statusCode int) {
 	w.Header().Set("Content-Type", "application/json")
+	if result.ResetAt > 0 {
+		auth.SetResetHeaders(w, time.Unix(result.ResetAt, 0))
+	}
 
 	// 优先使用 result 中的状态码
 	httpCode := statusCode
@@ -453,6 +680,9 @@ func WriteErrorResponse(w http.ResponseWriter, result *AuthResult, statusCode in
 			Message: result.Message,
 		},
 	}
+	if result.ResetAt > 0 {
+		resp.Error.ResetAt = time.Unix(result.ResetAt, 0).Format(time.RFC3339)
+	}
 
 	if err := json.NewEncoder(w).Encode(resp); err != nil {
 		log.Printf("写入错误响应失败: %v", err)
@@ -469,6 +699,9 @@ func (e *Executor) Close() error {
 	if e.luaExecutor != nil {
 		e.luaExecutor.Close()
 	}
+	if err := e.audit.Close(); err != nil {
+		log.Printf("关闭鉴权审计日志失败: %v", err)
+	}
 	return nil
 }
 
@@ -480,14 +713,37 @@ func (e *Executor) GetHeaderNames() []string {
 	return e.config.HeaderNames
 }
 
+// KeySource 获取 API Key 的提取方式（Header 列表、认证方案、查询参数）
+func (e *Executor) KeySource() *utils.APIKeySource {
+	if e.config == nil {
+		return nil
+	}
+	return &utils.APIKeySource{
+		HeaderNames: e.config.HeaderNames,
+		Scheme:      e.config.Scheme,
+		QueryParam:  e.config.QueryParam,
+	}
+}
+
 // ShouldSkip 检查路径是否应跳过鉴权
+// skip_paths 按前缀匹配，末尾的 "*" 可省略（"/admin/*" 与 "/admin/" 等价），空字符串被忽略
+// 不支持通配符：只去掉末尾的 "*"，路径中间的 "*" 按字面匹配
+// 参数：
+//   - path: 请求路径
+//
+// 返回：
+//   - bool: 是否跳过鉴权
 func (e *Executor) ShouldSkip(path string) bool {
 	if e.config == nil || len(e.config.SkipPaths) == 0 {
 		return false
 	}
 	for _, skipPath := range e.config.SkipPaths {
+		skipPath = strings.TrimSuffix(skipPath, "*")
+		if skipPath == "" {
+			continue
+		}
 		// 前缀匹配
-		if len(path) >= len(skipPath) && path[:len(skipPath)] == skipPath {
+		if strings.HasPrefix(path, skipPath) {
 			return true
 		}
 	}
@@ -0,0 +1,187 @@
+package pipeline
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"llmproxy/internal/admin"
+	"llmproxy/internal/config"
+)
+
+func TestBuiltinProviderStartsAt(t *testing.T) {
+	store := newTestAdminKeyStore(t)
+	future := time.Now().Add(time.Hour)
+	past := time.Now().Add(-time.Hour)
+	keys := []*admin.APIKey{
+		{Key: "sk-pending", StartsAt: &future},
+		{Key: "sk-active", StartsAt: &past},
+		{Key: "sk-no-start"},
+	}
+	for _, key := range keys {
+		if err := store.Create(key); err != nil {
+			t.Fatal(err)
+		}
+	}
+	executor := newBuiltinExecutor(t, store)
+	executor.statusCodes = &config.StatusCodes{
+		NotYetActive: &config.StatusCodeConfig{Allow: false, HttpCode: 403, Message: "API Key 尚未生效"},
+	}
+
+	tests := []struct {
+		name       string
+		key        string
+		wantAllow  bool
+		wantStatus string
+	}{
+		{"尚未生效", "sk-pending", false, "NOT_YET_ACTIVE"},
+		{"已生效", "sk-active", true, ""},
+		{"未设置生效时间", "sk-no-start", true, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result, err := executor.Execute(context.Background(), tt.key, &RequestInfo{Method: "POST", Path: "/v1/chat/completions"})
+			if err != nil {
+				t.Fatalf("Execute() error = %v", err)
+			}
+			if result.Allow != tt.wantAllow {
+				t.Fatalf("Execute() = %+v, want allow = %v", result, tt.wantAllow)
+			}
+			if tt.wantStatus != "" && (result.StatusName != tt.wantStatus || result.StatusCode != 403 || result.Message != "API Key 尚未生效") {
+				t.Errorf("Execute() = %+v, want %s with 403", result, tt.wantStatus)
+			}
+		})
+	}
+}
+
+func TestDefaultAuthLogicStartsAt(t *testing.T) {
+	e := &Executor{}
+	now := time.Now()
+
+	tests := []struct {
+		name      string
+		startsAt  interface{}
+		wantAllow bool
+	}{
+		{"未来的 Unix 时间戳", now.Add(time.Hour).Unix(), false},
+		{"过去的 Unix 时间戳", now.Add(-time.Hour).Unix(), true},
+		{"未来的数字字符串", "9999999999", false},
+		{"未来的 RFC3339", now.Add(time.Hour).UTC().Format(time.RFC3339), false},
+		{"过去的 RFC3339", now.Add(-time.Hour).UTC().Format(time.RFC3339), true},
+		{"未来的 time.Time", now.Add(time.Hour), false},
+		{"零值 time.Time", time.Time{}, true},
+		{"空字符串", "", true},
+		{"NULL", nil, true},
+		{"0", int64(0), true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result, err := e.defaultAuthLogic(&AuthContext{Data: map[string]interface{}{"starts_at": tt.startsAt}})
+			if err != nil {
+				t.Fatalf("defaultAuthLogic() error = %v", err)
+			}
+			if result.Allow != tt.wantAllow {
+				t.Errorf("defaultAuthLogic(starts_at=%v) = %+v, want allow = %v", tt.startsAt, result, tt.wantAllow)
+			}
+			if !tt.wantAllow && result.StatusName != "NOT_YET_ACTIVE" {
+				t.Errorf("StatusName = %q, want NOT_YET_ACTIVE", result.StatusName)
+			}
+		})
+	}
+
+	// 没有 starts_at 字段视为立即生效
+	if result, err := e.defaultAuthLogic(&AuthContext{Data: map[string]interface{}{}}); err != nil || !result.Allow {
+		t.Errorf("defaultAuthLogic() without starts_at = %+v, %v; want allowed", result, err)
+	}
+}
+
+func TestGetUnixTime(t *testing.T) {
+	e := &Executor{}
+	want := time.Date(2026, 3, 15, 10, 0, 0, 0, time.UTC).Unix()
+
+	tests := []struct {
+		name   string
+		value  interface{}
+		want   int64
+		wantOK bool
+	}{
+		{"time.Time", time.Date(2026, 3, 15, 18, 0, 0, 0, time.FixedZone("CST", 8*3600)), want, true},
+		{"int64", want, want, true},
+		{"数字字符串", "1773568800", want, true},
+		{"RFC3339", "2026-03-15T10:00:00Z", want, true},
+		{"RFC3339 带时区", "2026-03-15T18:00:00+08:00", want, true},
+		{"SQLite 时间字符串", "2026-03-15 10:00:00", want, true},
+		{"无法解析", "next week", 0, false},
+		{"零值 time.Time", time.Time{}, 0, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, ok := e.getUnixTime(map[string]interface{}{"starts_at": tt.value}, "starts_at")
+			if got != tt.want || ok != tt.wantOK {
+				t.Errorf("getUnixTime(%v) = %d, %v; want %d, %v", tt.value, got, ok, tt.want, tt.wantOK)
+			}
+		})
+	}
+}
+
+func TestTestAuthThroughAdminEndpoint(t *testing.T) {
+	store := newTestAdminKeyStore(t)
+	for _, key := range []*admin.APIKey{
+		{Key: "sk-valid", UserID: "alice"},
+		{Key: "sk-disabled", Status: admin.KeyStatus(KeyStatusDisabled)},
+	} {
+		if err := store.Create(key); err != nil {
+			t.Fatal(err)
+		}
+	}
+	executor := newBuiltinExecutor(t, store)
+	executor.statusCodes = &config.StatusCodes{
+		Disabled: &config.StatusCodeConfig{Allow: false, HttpCode: 403, Message: "API Key 已被禁用"},
+		NotFound: &config.StatusCodeConfig{Allow: false, HttpCode: 401, Message: "API Key 不存在"},
+	}
+
+	server := admin.NewServer(store, "admin-token", "")
+	server.SetAuthTester(executor.TestAuth)
+	mux := http.NewServeMux()
+	server.RegisterRoutes(mux)
+
+	tests := []struct {
+		name         string
+		key          string
+		wantAllow    bool
+		wantCode     int
+		wantStatus   string
+		wantProvider string
+	}{
+		{"有效 Key", "sk-valid", true, 200, "ACTIVE", "builtin"},
+		{"已禁用", "sk-disabled", false, 403, "DISABLED", "builtin"},
+		{"不存在", "sk-missing", false, 401, "NOT_FOUND", ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			body, _ := json.Marshal(admin.AuthTestRequest{Key: tt.key})
+			req := httptest.NewRequest(http.MethodPost, "/admin/auth/test", bytes.NewReader(body))
+			req.Header.Set("X-Admin-Token", "admin-token")
+			rec := httptest.NewRecorder()
+			mux.ServeHTTP(rec, req)
+			if rec.Code != http.StatusOK {
+				t.Fatalf("status = %d, body = %s", rec.Code, rec.Body)
+			}
+
+			var resp struct {
+				Data admin.AuthTestResult `json:"data"`
+			}
+			if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil {
+				t.Fatal(err)
+			}
+			got := resp.Data
+			if got.Allow != tt.wantAllow || got.StatusCode != tt.wantCode || got.StatusName != tt.wantStatus || got.Provider != tt.wantProvider {
+				t.Errorf("result = %+v, want allow=%v %d %s provider=%q", got, tt.wantAllow, tt.wantCode, tt.wantStatus, tt.wantProvider)
+			}
+		})
+	}
+}
@@ -3,22 +3,32 @@ package pipeline
 import (
 	"fmt"
 	"os"
+	"sync"
 	"time"
 
+	"llmproxy/internal/scripting"
+
 	lua "github.com/yuin/gopher-lua"
 	luajson "layeh.com/gopher-luar"
 )
 
 // LuaExecutor Lua 脚本执行器
 type LuaExecutor struct {
-	state *lua.LState // Lua 状态机
+	state  *lua.LState // Lua 状态机
+	protos sync.Map    // 脚本内容 -> 编译后的字节码（*lua.FunctionProto），同一脚本只解析一次
+}
+
+// LuaOptions Lua 脚本执行选项
+type LuaOptions struct {
+	MaxMemory  int64    // 内存上限（字节，0 表示不限制）
+	ModulePath []string // require 的模块搜索目录
 }
 
 // NewLuaExecutor 创建 Lua 执行器
 // 返回：
 //   - *LuaExecutor: Lua 执行器实例
 func NewLuaExecutor() *LuaExecutor {
-	L := lua.NewState()
+	L := scripting.NewState()
 
 	// 注册全局函数
 	registerGlobalFunctions(L)
@@ -54,13 +64,14 @@ func registerGlobalFunctions(L *lua.LState) {
 // 参数：
 //   - script: Lua 脚本内容
 //   - ctx: 鉴权上下文
+//   - opts: 执行选项
 //
 // 返回：
 //   - *AuthResult: 鉴权结果
 //   - error: 错误信息
-func (e *LuaExecutor) Execute(script string, ctx *AuthContext) (*AuthResult, error) {
-	// 创建新的 Lua 状态机（避免并发问题）
-	L := lua.NewState()
+func (e *LuaExecutor) Execute(script string, ctx *AuthContext, opts LuaOptions) (*AuthResult, error) {
+	// 创建新的沙箱化 Lua 状态机（避免并发问题；require 只能加载 module_path 内的模块）
+	L := scripting.NewSandbox(opts.ModulePath)
 	defer L.Close()
 
 	// 注册全局函数
@@ -69,8 +80,13 @@ func (e *LuaExecutor) Execute(script string, ctx *AuthContext) (*AuthResult, err
 	// 设置上下文变量
 	e.setContextVariables(L, ctx)
 
+	proto, err := e.compile(script)
+	if err != nil {
+		return nil, err
+	}
+
 	// 执行脚本
-	if err := L.DoString(script); err != nil {
+	if err := scripting.DoProtoLimited(L, proto, opts.MaxMemory); err != nil {
 		return nil, fmt.Errorf("lua 脚本执行失败: %w", err)
 	}
 
@@ -81,20 +97,40 @@ func (e *LuaExecutor) Execute(script string, ctx *AuthContext) (*AuthResult, err
 	return e.parseResult(result)
 }
 
+// compile 获取脚本的字节码（首次使用时编译并缓存）
+// 参数：
+//   - script: Lua 脚本内容
+//
+// 返回：
+//   - *lua.FunctionProto: 编译后的函数原型
+//   - error: 语法错误
+func (e *LuaExecutor) compile(script string) (*lua.FunctionProto, error) {
+	if proto, ok := e.protos.Load(script); ok {
+		return proto.(*lua.FunctionProto), nil
+	}
+	proto, err := scripting.Compile(script, "<auth>")
+	if err != nil {
+		return nil, fmt.Errorf("lua 脚本编译失败: %w", err)
+	}
+	e.protos.Store(script, proto)
+	return proto, nil
+}
+
 // ExecuteFile 从文件执行 Lua 脚本
 // 参数：
 //   - filePath: Lua 脚本文件路径
 //   - ctx: 鉴权上下文
+//   - opts: 执行选项
 //
 // 返回：
 //   - *AuthResult: 鉴权结果
 //   - error: 错误信息
-func (e *LuaExecutor) ExecuteFile(filePath string, ctx *AuthContext) (*AuthResult, error) {
+func (e *LuaExecutor) ExecuteFile(filePath string, ctx *AuthContext, opts LuaOptions) (*AuthResult, error) {
 	script, err := os.ReadFile(filePath)
 	if err != nil {
 		return nil, fmt.Errorf("读取 Lua 脚本文件失败: %w", err)
 	}
-	return e.Execute(string(script), ctx)
+	return e.Execute(string(script), ctx, opts)
 }
 
 // setContextVariables 设置上下文变量
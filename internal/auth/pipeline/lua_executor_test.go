@@ -0,0 +1,104 @@
+package pipeline
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+
+	"llmproxy/internal/scripting"
+)
+
+// protoCount 返回执行器缓存的字节码数量
+func protoCount(e *LuaExecutor) int {
+	count := 0
+	e.protos.Range(func(_, _ interface{}) bool {
+		count++
+		return true
+	})
+	return count
+}
+
+func TestLuaExecutorCompilesOnce(t *testing.T) {
+	e := NewLuaExecutor()
+	defer e.Close()
+	const script = `return { allow = api_key ~= "blocked", metadata = { key = api_key } }`
+
+	// 并发执行同一脚本，每次执行使用新的 VM 加载缓存的字节码
+	var wg sync.WaitGroup
+	for g := 0; g < 10; g++ {
+		wg.Add(1)
+		go func(g int) {
+			defer wg.Done()
+			for i := 0; i < 20; i++ {
+				key := fmt.Sprintf("sk-%d-%d", g, i)
+				result, err := e.Execute(script, &AuthContext{APIKey: key}, LuaOptions{})
+				if err != nil || !result.Allow || result.Metadata["key"] != key {
+					t.Errorf("Execute(%s) = %+v, %v", key, result, err)
+					return
+				}
+			}
+		}(g)
+	}
+	wg.Wait()
+
+	if result, err := e.Execute(script, &AuthContext{APIKey: "blocked"}, LuaOptions{}); err != nil || result.Allow {
+		t.Errorf("Execute(blocked) = %+v, %v; want denied", result, err)
+	}
+	if got := protoCount(e); got != 1 {
+		t.Errorf("cached protos = %d, want 1", got)
+	}
+
+	// 语法错误不缓存
+	if _, err := e.Execute(`return {`, &AuthContext{}, LuaOptions{}); err == nil {
+		t.Error("Execute() with a syntax error: error = nil")
+	}
+	if got := protoCount(e); got != 1 {
+		t.Errorf("cached protos after a syntax error = %d, want 1", got)
+	}
+}
+
+func TestLuaExecutorMemoryLimit(t *testing.T) {
+	e := NewLuaExecutor()
+	defer e.Close()
+
+	const script = `local t = {} for i = 1, 1e8 do t[i] = i end return { allow = true }`
+	_, err := e.Execute(script, &AuthContext{}, LuaOptions{MaxMemory: scripting.MB(1)})
+	if !errors.Is(err, scripting.ErrMemoryLimit) {
+		t.Errorf("Execute() error = %v, want ErrMemoryLimit", err)
+	}
+
+	// 上限以内的脚本正常执行
+	result, err := e.Execute(`local t = {} for i = 1, 1000 do t[i] = i end return { allow = #t == 1000 }`, &AuthContext{}, LuaOptions{MaxMemory: scripting.MB(1)})
+	if err != nil || !result.Allow {
+		t.Errorf("Execute() = %+v, %v; want allowed", result, err)
+	}
+}
+
+func TestLuaExecutorRequireModule(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "keys.lua"), []byte(`
+return function(key) return string.sub(key, 1, 3) == "sk-" end
+`), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	e := NewLuaExecutor()
+	defer e.Close()
+
+	const script = `local valid = require("keys") return { allow = valid(api_key) }`
+	opts := LuaOptions{ModulePath: []string{dir}}
+	if result, err := e.Execute(script, &AuthContext{APIKey: "sk-123"}, opts); err != nil || !result.Allow {
+		t.Errorf("Execute(sk-123) = %+v, %v; want allowed", result, err)
+	}
+	if result, err := e.Execute(script, &AuthContext{APIKey: "bad"}, opts); err != nil || result.Allow {
+		t.Errorf("Execute(bad) = %+v, %v; want denied", result, err)
+	}
+
+	// 未配置 module_path 时 require 报错
+	if _, err := e.Execute(script, &AuthContext{APIKey: "sk-123"}, LuaOptions{}); err == nil || !strings.Contains(err.Error(), "require 未启用") {
+		t.Errorf("Execute() without module_path: error = %v", err)
+	}
+}
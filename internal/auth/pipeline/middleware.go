@@ -6,6 +6,9 @@ import (
 	"net/http"
 	"time"
 
+	"llmproxy/internal/auth"
+	"llmproxy/internal/tracing"
+	"llmproxy/internal/types"
 	"llmproxy/internal/utils"
 )
 
@@ -26,14 +29,19 @@ func Middleware(executor *Executor, next http.HandlerFunc) http.HandlerFunc {
 			return
 		}
 
+		clientIP := utils.GetClientIP(r.Header.Get("X-Forwarded-For"), r.Header.Get("X-Real-IP"), r.RemoteAddr)
+
 		// 1. 提取 API Key
-		apiKey := utils.ExtractAPIKeyFromHeaders(r.Header, executor.GetHeaderNames())
+		apiKey := utils.ExtractAPIKeyFromRequest(r, executor.KeySource())
 		if apiKey == "" {
 			log.Println("鉴权管道: 缺少 API Key")
-			WriteErrorResponse(w, &AuthResult{
+			result := &AuthResult{
 				Allow:   false,
 				Message: "缺少 API Key",
-			}, http.StatusUnauthorized)
+			}
+			executor.recordAudit(r, clientIP, apiKey, result)
+			executor.logDenied(r, apiKey, http.StatusUnauthorized, "missing_api_key", startTime)
+			WriteErrorResponse(w, result, http.StatusUnauthorized)
 			return
 		}
 
@@ -41,7 +49,7 @@ func Middleware(executor *Executor, next http.HandlerFunc) http.HandlerFunc {
 		requestInfo := &RequestInfo{
 			Method: r.Method,
 			Path:   r.URL.Path,
-			IP:     utils.GetClientIP(r.Header.Get("X-Forwarded-For"), r.Header.Get("X-Real-IP"), r.RemoteAddr),
+			IP:     clientIP,
 			Headers: func() map[string]string {
 				headers := make(map[string]string)
 				for k, v := range r.Header {
@@ -57,36 +65,97 @@ func Middleware(executor *Executor, next http.HandlerFunc) http.HandlerFunc {
 		ctx, cancel := context.WithTimeout(r.Context(), 10*time.Second)
 		defer cancel()
 
+		_, span := tracing.Start(ctx, "auth.pipeline", tracing.KindInternal)
 		result, err := executor.Execute(ctx, apiKey, requestInfo)
+		if result != nil {
+			span.SetAttr("auth.allowed", result.Allow)
+			span.SetAttr("auth.provider", result.Provider)
+		}
+		span.SetError(err)
+		span.End()
 		if err != nil {
 			log.Printf("鉴权管道: 执行错误: %v", err)
-			WriteErrorResponse(w, &AuthResult{
+			result := &AuthResult{
 				Allow:   false,
 				Message: "鉴权服务异常",
-			}, http.StatusInternalServerError)
+			}
+			executor.recordAudit(r, clientIP, apiKey, result)
+			executor.logDenied(r, apiKey, http.StatusInternalServerError, "auth_error", startTime)
+			WriteErrorResponse(w, result, http.StatusInternalServerError)
 			return
 		}
 
 		// 4. 检查结果
+		executor.recordAudit(r, clientIP, apiKey, result)
 		if !result.Allow {
 			log.Printf("鉴权管道: 拒绝访问 - %s (耗时: %v)", result.Message, time.Since(startTime))
+			executor.logDenied(r, apiKey, http.StatusForbidden, denyReason(result), startTime)
 			WriteErrorResponse(w, result, http.StatusForbidden)
 			return
 		}
 
 		log.Printf("鉴权管道: 验证通过 (耗时: %v)", time.Since(startTime))
 
-		// 5. 将元数据存入请求头（供后续处理器使用）
-		if result.Metadata != nil {
-			if userID, ok := result.Metadata["user_id"].(string); ok {
-				r.Header.Set("X-API-Key-UserID", userID)
-			}
-			if name, ok := result.Metadata["name"].(string); ok {
-				r.Header.Set("X-API-Key-Name", name)
-			}
+		// 5. 将调用方身份存入请求上下文，元数据存入请求头（供后续处理器使用）
+		identity := auth.NewIdentity(apiKey, result.Provider, result.Metadata)
+		r = r.WithContext(types.WithIdentity(r.Context(), identity))
+		if identity.UserID != "" {
+			r.Header.Set("X-API-Key-UserID", identity.UserID)
+		}
+		if identity.Name != "" {
+			r.Header.Set("X-API-Key-Name", identity.Name)
 		}
 
 		// 6. 调用下一个处理器
 		next(w, r)
 	}
 }
+
+// recordAudit 记录一次鉴权决策（未配置审计日志时忽略）
+// 参数：
+//   - r: HTTP 请求
+//   - clientIP: 客户端 IP
+//   - apiKey: API Key（只记录前缀）
+//   - result: 鉴权结果
+func (e *Executor) recordAudit(r *http.Request, clientIP, apiKey string, result *AuthResult) {
+	if e.audit == nil {
+		return
+	}
+
+	event := &AuditEvent{
+		Timestamp: time.Now(),
+		KeyPrefix: auditKeyPrefix(apiKey),
+		Decision:  AuditDecisionAllow,
+		Provider:  result.Provider,
+		ClientIP:  clientIP,
+		Method:    r.Method,
+		Path:      r.URL.Path,
+	}
+	if !result.Allow {
+		event.Decision = AuditDecisionDeny
+		event.Reason = denyReason(result)
+	}
+	e.audit.Record(event)
+}
+
+// logDenied 将被拒绝的请求写入访问日志（未设置时忽略）
+// 参数：
+//   - r: HTTP 请求
+//   - apiKey: API Key
+//   - statusCode: 响应状态码
+//   - reason: 拒绝原因
+//   - startTime: 鉴权开始时间
+func (e *Executor) logDenied(r *http.Request, apiKey string, statusCode int, reason string, startTime time.Time) {
+	if e.denials == nil {
+		return
+	}
+	e.denials.LogDenied(r, apiKey, statusCode, "auth:"+reason, time.Since(startTime))
+}
+
+// denyReason 拒绝原因：优先使用状态名，否则使用提示信息
+func denyReason(result *AuthResult) string {
+	if result.StatusName != "" {
+		return result.StatusName
+	}
+	return result.Message
+}
@@ -0,0 +1,190 @@
+package pipeline
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+
+	"llmproxy/internal/admin"
+	"llmproxy/internal/auth"
+	"llmproxy/internal/config"
+	"llmproxy/internal/types"
+)
+
+// newMiddlewareExecutor 创建只包含 builtin Provider 的执行器，并写入指定的 Key
+func newMiddlewareExecutor(t *testing.T, cfg *PipelineConfig, keys ...string) *Executor {
+	t.Helper()
+	store := newTestAdminKeyStore(t)
+	for _, key := range keys {
+		if err := store.Create(&admin.APIKey{Key: key}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	cfg.Enabled = true
+	cfg.Mode = PipelineModeFirstMatch
+	cfg.Providers = []*ProviderConfig{{Name: "builtin", Type: ProviderTypeBuiltin, Enabled: true}}
+	executor, err := NewExecutorWithStorage(cfg, nil, nil, store, nil)
+	if err != nil {
+		t.Fatalf("NewExecutorWithStorage() error = %v", err)
+	}
+	t.Cleanup(func() { _ = executor.Close() })
+	return executor
+}
+
+// newMiddlewareHandler 创建鉴权中间件，下游处理器返回 200 并记录调用方 Key
+func newMiddlewareHandler(t *testing.T, cfg *PipelineConfig, keys ...string) (http.Handler, *string) {
+	t.Helper()
+	executor := newMiddlewareExecutor(t, cfg, keys...)
+
+	var gotKey string
+	handler := Middleware(executor, func(w http.ResponseWriter, r *http.Request) {
+		gotKey = ""
+		if identity := types.IdentityFromContext(r.Context()); identity != nil {
+			gotKey = identity.APIKey
+		}
+		w.WriteHeader(http.StatusOK)
+	})
+	return handler, &gotKey
+}
+
+func TestMiddlewareKeySources(t *testing.T) {
+	tests := []struct {
+		name    string
+		cfg     *PipelineConfig
+		url     string
+		headers map[string]string
+		want    int
+	}{
+		{"Authorization Bearer", &PipelineConfig{}, "/v1/chat/completions", map[string]string{"Authorization": "Bearer sk-valid"}, http.StatusOK},
+		{"X-API-Key", &PipelineConfig{}, "/v1/chat/completions", map[string]string{"X-API-Key": "sk-valid"}, http.StatusOK},
+		{"Api-Key", &PipelineConfig{}, "/v1/chat/completions", map[string]string{"Api-Key": "sk-valid"}, http.StatusOK},
+		{"未配置查询参数", &PipelineConfig{}, "/v1/chat/completions?api_key=sk-valid", nil, http.StatusUnauthorized},
+		{"查询参数", &PipelineConfig{QueryParam: "api_key"}, "/v1/chat/completions?api_key=sk-valid", nil, http.StatusOK},
+		{"自定义认证方案", &PipelineConfig{Scheme: "Token"}, "/v1/chat/completions", map[string]string{"Authorization": "Token sk-valid"}, http.StatusOK},
+		{"自定义认证方案下 Bearer 无效", &PipelineConfig{Scheme: "Token"}, "/v1/chat/completions", map[string]string{"Authorization": "Bearer sk-valid"}, http.StatusUnauthorized},
+		{"自定义 Header", &PipelineConfig{HeaderNames: []string{"X-Custom-Key"}}, "/v1/chat/completions", map[string]string{"X-Custom-Key": "sk-valid"}, http.StatusOK},
+		{"自定义 Header 后不再读取 X-API-Key", &PipelineConfig{HeaderNames: []string{"X-Custom-Key"}}, "/v1/chat/completions", map[string]string{"X-API-Key": "sk-valid"}, http.StatusUnauthorized},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			handler, gotKey := newMiddlewareHandler(t, tt.cfg, "sk-valid")
+			req := httptest.NewRequest(http.MethodPost, tt.url, nil)
+			for k, v := range tt.headers {
+				req.Header.Set(k, v)
+			}
+			rec := httptest.NewRecorder()
+			handler.ServeHTTP(rec, req)
+			if rec.Code != tt.want {
+				t.Fatalf("status = %d, want %d; body = %s", rec.Code, tt.want, rec.Body)
+			}
+			if tt.want == http.StatusOK && *gotKey != "sk-valid" {
+				t.Errorf("identity key = %q, want sk-valid", *gotKey)
+			}
+		})
+	}
+}
+
+func TestMiddlewareSkipPaths(t *testing.T) {
+	executor := newMiddlewareExecutor(t, &PipelineConfig{SkipPaths: []string{"/health", "/metrics", "/admin/*"}})
+
+	var reached bool
+	handler := Middleware(executor, func(w http.ResponseWriter, r *http.Request) {
+		reached = true
+		w.WriteHeader(http.StatusOK)
+	})
+
+	tests := []struct {
+		path        string
+		wantReached bool
+		wantStatus  int
+	}{
+		{"/health", true, http.StatusOK},
+		{"/metrics", true, http.StatusOK},
+		{"/admin/keys/list", true, http.StatusOK},
+		{"/admin/", true, http.StatusOK},
+		{"/v1/chat/completions", false, http.StatusUnauthorized},
+		{"/v1/models", false, http.StatusUnauthorized},
+		{"/administrator", false, http.StatusUnauthorized},
+	}
+	for _, tt := range tests {
+		t.Run(tt.path, func(t *testing.T) {
+			reached = false
+			// 不携带任何 Key
+			rec := httptest.NewRecorder()
+			handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, tt.path, nil))
+			if reached != tt.wantReached || rec.Code != tt.wantStatus {
+				t.Errorf("reached = %v, status = %d; want %v, %d", reached, rec.Code, tt.wantReached, tt.wantStatus)
+			}
+		})
+	}
+}
+
+func TestShouldSkip(t *testing.T) {
+	e := &Executor{config: &PipelineConfig{SkipPaths: []string{"/health", "/admin/*", "", "*", "/v1/*/models"}}}
+
+	tests := []struct {
+		path string
+		want bool
+	}{
+		{"/health", true},
+		{"/healthz", true}, // 前缀匹配
+		{"/admin/keys/list", true},
+		{"/admin", false}, // "/admin/*" 等价于 "/admin/"
+		{"/v1/chat/completions", false},
+		{"/v1/*/models", true},      // 中间的 "*" 按字面匹配
+		{"/v1/gpt-4/models", false}, // 不是通配符
+		{"/", false},                // 空字符串和单独的 "*" 被忽略
+	}
+	for _, tt := range tests {
+		if got := e.ShouldSkip(tt.path); got != tt.want {
+			t.Errorf("ShouldSkip(%q) = %v, want %v", tt.path, got, tt.want)
+		}
+	}
+
+	if (&Executor{config: &PipelineConfig{}}).ShouldSkip("/health") {
+		t.Error("ShouldSkip() with no skip_paths = true")
+	}
+}
+
+func TestMiddlewareAllowedModels(t *testing.T) {
+	executor, err := NewExecutorWithStorage(&PipelineConfig{
+		Enabled: true,
+		Mode:    PipelineModeFirstMatch,
+		Providers: []*ProviderConfig{{
+			Name:    "static",
+			Type:    ProviderTypeStatic,
+			Enabled: true,
+			StaticKeys: []*config.APIKey{
+				{Key: "sk-restricted", AllowedModels: []string{"gpt-4o", "claude-*"}},
+				{Key: "sk-open"},
+			},
+		}},
+	}, nil, nil, nil, nil)
+	if err != nil {
+		t.Fatalf("NewExecutorWithStorage() error = %v", err)
+	}
+	t.Cleanup(func() { _ = executor.Close() })
+
+	var got []string
+	handler := Middleware(executor, func(w http.ResponseWriter, r *http.Request) {
+		got = auth.AllowedModels(r.Context())
+	})
+
+	tests := []struct {
+		key  string
+		want []string
+	}{
+		{"sk-restricted", []string{"gpt-4o", "claude-*"}},
+		{"sk-open", nil},
+	}
+	for _, tt := range tests {
+		got = []string{"unset"}
+		req := httptest.NewRequest(http.MethodPost, "/v1/chat/completions", nil)
+		req.Header.Set("Authorization", "Bearer "+tt.key)
+		handler.ServeHTTP(httptest.NewRecorder(), req)
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%s: allowed models = %q, want %q", tt.key, got, tt.want)
+		}
+	}
+}
@@ -2,6 +2,7 @@ package pipeline
 
 import (
 	"context"
+	"time"
 
 	"llmproxy/internal/admin"
 )
@@ -38,6 +39,11 @@ func NewBuiltinProvider(name string, keyStore *admin.KeyStore) Provider {
 // 返回：
 //   - *ProviderResult: 查询结果
 func (b *BuiltinProvider) Query(ctx context.Context, apiKey string) *ProviderResult {
+	// 客户端只能提交明文 Key：直接提交存储的哈希值（如数据库泄露后）视为不存在
+	if admin.IsHashedKey(apiKey) {
+		return &ProviderResult{Found: false}
+	}
+
 	// 从 KeyStore 查询
 	key, err := b.keyStore.Get(apiKey)
 	if err != nil {
@@ -52,12 +58,51 @@ func (b *BuiltinProvider) Query(ctx context.Context, apiKey string) *ProviderRes
 		return &ProviderResult{Found: false}
 	}
 
+	return &ProviderResult{
+		Found: true,
+		Data:  builtinKeyData(key),
+	}
+}
+
+// Preload 遍历所有 active 状态的 Key，用于预热缓存
+// 参数：
+//   - ctx: 上下文
+//   - fn: 处理函数（key 为明文或哈希存储的 Key）
+//
+// 返回：
+//   - error: 错误信息
+func (b *BuiltinProvider) Preload(ctx context.Context, fn func(key string, data map[string]interface{})) error {
+	return b.keyStore.EachActive(func(key *admin.APIKey) error {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		fn(key.Key, builtinKeyData(key))
+		return nil
+	})
+}
+
+// builtinKeyData 将 KeyStore 中的 Key 转换为 Provider 数据
+func builtinKeyData(key *admin.APIKey) map[string]interface{} {
 	// 转换为 map 格式
 	data := map[string]interface{}{
-		"key":        key.Key,
-		"status":     int(key.Status), // 返回整数状态
-		"created_at": key.CreatedAt.Unix(),
-		"updated_at": key.UpdatedAt.Unix(),
+		"key":         key.Key,
+		"status":      int(key.Status), // 返回整数状态
+		"total_quota": key.TotalQuota,
+		"used_quota":  key.UsedQuota,
+		"created_at":  key.CreatedAt.Unix(),
+		"updated_at":  key.UpdatedAt.Unix(),
+	}
+	if key.DailyCostLimit > 0 {
+		data["daily_cost_limit"] = key.DailyCostLimit
+	}
+
+	// 结转额度计入本周期可用额度（见 defaultAuthLogic）
+	if key.Rollover {
+		data["rollover"] = true
+		data["rollover_cap"] = key.RolloverCap
+	}
+	if key.RolloverQuota > 0 {
+		data["rollover_quota"] = key.RolloverQuota
 	}
 
 	// 处理可选字段
@@ -73,11 +118,14 @@ func (b *BuiltinProvider) Query(ctx context.Context, apiKey string) *ProviderRes
 	if key.ExpiresAt != nil {
 		data["expires_at"] = key.ExpiresAt.Unix()
 	}
-
-	return &ProviderResult{
-		Found: true,
-		Data:  data,
+	if key.QuotaResetPeriod != "" {
+		data["quota_reset_period"] = key.QuotaResetPeriod
+		if resetAt, ok := admin.NextQuotaReset(key.QuotaResetPeriod, time.Now()); ok {
+			data["quota_reset_at"] = resetAt.Unix()
+		}
 	}
+
+	return data
 }
 
 // GetKeyStore 获取 KeyStore 实例（用于外部访问）
@@ -0,0 +1,243 @@
+package pipeline
+
+import (
+	"context"
+	"errors"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"llmproxy/internal/admin"
+)
+
+// newTestAdminKeyStore 在临时目录创建 Admin KeyStore
+func newTestAdminKeyStore(t *testing.T) *admin.KeyStore {
+	t.Helper()
+	store, err := admin.NewKeyStore(filepath.Join(t.TempDir(), "keys.db"))
+	if err != nil {
+		t.Fatalf("NewKeyStore() error = %v", err)
+	}
+	t.Cleanup(func() { _ = store.Close() })
+	return store
+}
+
+// newBuiltinExecutor 创建只包含 builtin Provider 的管道执行器
+func newBuiltinExecutor(t *testing.T, store *admin.KeyStore) *Executor {
+	t.Helper()
+	executor, err := NewExecutorWithStorage(&PipelineConfig{
+		Enabled: true,
+		Mode:    PipelineModeFirstMatch,
+		Providers: []*ProviderConfig{
+			{Name: "builtin", Type: ProviderTypeBuiltin, Enabled: true},
+		},
+	}, nil, nil, store, nil)
+	if err != nil {
+		t.Fatalf("NewExecutorWithStorage() error = %v", err)
+	}
+	t.Cleanup(func() { _ = executor.Close() })
+	return executor
+}
+
+func TestBuiltinProviderExposesQuota(t *testing.T) {
+	store := newTestAdminKeyStore(t)
+	if err := store.Create(&admin.APIKey{Key: "sk-builtin", TotalQuota: 100, UsedQuota: 30, QuotaResetPeriod: "daily"}); err != nil {
+		t.Fatal(err)
+	}
+
+	result := NewBuiltinProvider("builtin", store).Query(context.Background(), "sk-builtin")
+	if !result.Found || result.Error != nil {
+		t.Fatalf("Query() = %+v", result)
+	}
+	if result.Data["total_quota"] != int64(100) || result.Data["used_quota"] != int64(30) || result.Data["quota_reset_period"] != "daily" {
+		t.Errorf("Query().Data = %v", result.Data)
+	}
+}
+
+func TestBuiltinProviderEnforcesQuota(t *testing.T) {
+	store := newTestAdminKeyStore(t)
+	if err := store.Create(&admin.APIKey{Key: "sk-builtin", TotalQuota: 100}); err != nil {
+		t.Fatal(err)
+	}
+	executor := newBuiltinExecutor(t, store)
+
+	execute := func() *AuthResult {
+		t.Helper()
+		result, err := executor.Execute(context.Background(), "sk-builtin", &RequestInfo{Method: "POST", Path: "/v1/chat/completions"})
+		if err != nil {
+			t.Fatalf("Execute() error = %v", err)
+		}
+		return result
+	}
+
+	if result := execute(); !result.Allow {
+		t.Fatalf("fresh key: %+v, want allowed", result)
+	}
+
+	if err := store.IncrementUsedQuota("sk-builtin", 99); err != nil {
+		t.Fatal(err)
+	}
+	if result := execute(); !result.Allow {
+		t.Fatalf("99/100 used: %+v, want allowed", result)
+	}
+
+	// 用量达到总额度：KeyStore 转为 quota_exceeded，管道拒绝
+	if err := store.IncrementUsedQuota("sk-builtin", 1); err != nil {
+		t.Fatal(err)
+	}
+	if result := execute(); result.Allow || result.StatusName != "QUOTA_EXCEEDED" {
+		t.Fatalf("100/100 used: %+v, want QUOTA_EXCEEDED", result)
+	}
+
+	// 重置后恢复
+	if _, err := store.ResetQuota("sk-builtin", ""); err != nil {
+		t.Fatal(err)
+	}
+	if result := execute(); !result.Allow {
+		t.Fatalf("after reset: %+v, want allowed", result)
+	}
+}
+
+func TestBuiltinProviderRollover(t *testing.T) {
+	store := newTestAdminKeyStore(t)
+	if err := store.Create(&admin.APIKey{Key: "sk-rollover", TotalQuota: 100, Rollover: true, RolloverQuota: 50}); err != nil {
+		t.Fatal(err)
+	}
+
+	result := NewBuiltinProvider("builtin", store).Query(context.Background(), "sk-rollover")
+	if result.Data["rollover_quota"] != int64(50) || result.Data["rollover"] != true {
+		t.Errorf("Query().Data = %v, want rollover fields", result.Data)
+	}
+
+	// 结转额度计入本周期可用额度：超过 total_quota 但未超过 total_quota + rollover_quota 时仍然允许
+	executor := newBuiltinExecutor(t, store)
+	if err := store.IncrementUsedQuota("sk-rollover", 120); err != nil {
+		t.Fatal(err)
+	}
+	if result, err := executor.Execute(context.Background(), "sk-rollover", &RequestInfo{}); err != nil || !result.Allow {
+		t.Fatalf("120/150 used: %+v, %v; want allowed", result, err)
+	}
+	if err := store.IncrementUsedQuota("sk-rollover", 30); err != nil {
+		t.Fatal(err)
+	}
+	if result, err := executor.Execute(context.Background(), "sk-rollover", &RequestInfo{}); err != nil || result.Allow {
+		t.Fatalf("150/150 used: %+v, %v; want denied", result, err)
+	}
+}
+
+// stubSpend 固定返回当日消费的 SpendChecker
+type stubSpend struct {
+	spent float64
+	err   error
+	reset time.Time
+}
+
+func (s *stubSpend) Spent(apiKey string) (float64, error) { return s.spent, s.err }
+
+func (s *stubSpend) NextReset() time.Time { return s.reset }
+
+func TestBuiltinProviderDailyCostLimit(t *testing.T) {
+	store := newTestAdminKeyStore(t)
+	if err := store.Create(&admin.APIKey{Key: "sk-cost", DailyCostLimit: 5}); err != nil {
+		t.Fatal(err)
+	}
+	reset := time.Date(2026, 3, 16, 0, 0, 0, 0, time.UTC)
+	spend := &stubSpend{reset: reset}
+	executor := newBuiltinExecutor(t, store)
+	executor.SetSpendChecker(spend)
+
+	execute := func() *AuthResult {
+		t.Helper()
+		result, err := executor.Execute(context.Background(), "sk-cost", &RequestInfo{})
+		if err != nil {
+			t.Fatalf("Execute() error = %v", err)
+		}
+		return result
+	}
+
+	spend.spent = 4.99
+	if result := execute(); !result.Allow {
+		t.Fatalf("4.99/5 spent: %+v, want allowed", result)
+	}
+
+	// 达到每日上限：拒绝并返回次日零点
+	spend.spent = 5
+	result := execute()
+	if result.Allow || result.StatusName != "DAILY_COST_EXCEEDED" || result.ResetAt != reset.Unix() {
+		t.Fatalf("5/5 spent: %+v, want DAILY_COST_EXCEEDED reset at %d", result, reset.Unix())
+	}
+
+	// 消费计数不可用时放行
+	spend.err = errors.New("redis down")
+	if result := execute(); !result.Allow {
+		t.Fatalf("spend unavailable: %+v, want allowed", result)
+	}
+
+	// 未设置上限的 Key 不检查消费
+	if err := store.Create(&admin.APIKey{Key: "sk-nolimit"}); err != nil {
+		t.Fatal(err)
+	}
+	spend.spent, spend.err = 100, nil
+	if result, err := executor.Execute(context.Background(), "sk-nolimit", &RequestInfo{}); err != nil || !result.Allow {
+		t.Fatalf("no limit: %+v, %v; want allowed", result, err)
+	}
+}
+
+func TestBuiltinProviderHashedLookup(t *testing.T) {
+	store := newTestAdminKeyStore(t)
+	if err := store.Create(&admin.APIKey{Key: "sk-legacy"}); err != nil {
+		t.Fatal(err)
+	}
+	store.SetHashKeys(true)
+	if err := store.Create(&admin.APIKey{Key: "sk-hashed"}); err != nil {
+		t.Fatal(err)
+	}
+	executor := newBuiltinExecutor(t, store)
+
+	// 客户端发送明文 Key，明文和哈希记录都能通过鉴权
+	for _, key := range []string{"sk-legacy", "sk-hashed"} {
+		result, err := executor.Execute(context.Background(), key, &RequestInfo{})
+		if err != nil || !result.Allow {
+			t.Errorf("Execute(%s) = %+v, %v; want allowed", key, result, err)
+		}
+	}
+
+	// 存储的哈希值本身不能当作 Key 使用
+	hashed := admin.HashKey("sk-hashed")
+	for _, key := range []string{hashed, hashed[len("sha256:"):]} {
+		result, err := executor.Execute(context.Background(), key, &RequestInfo{})
+		if err != nil || result.Allow {
+			t.Errorf("Execute(%s) = %+v, %v; want denied", key, result, err)
+		}
+	}
+}
+
+func TestBuiltinProviderCachedHashRejected(t *testing.T) {
+	store := newTestAdminKeyStore(t)
+	store.SetHashKeys(true)
+	if err := store.Create(&admin.APIKey{Key: "sk-secret"}); err != nil {
+		t.Fatal(err)
+	}
+	executor, err := NewExecutorWithStorage(&PipelineConfig{
+		Enabled: true,
+		Mode:    PipelineModeFirstMatch,
+		Providers: []*ProviderConfig{
+			{Name: "builtin", Type: ProviderTypeBuiltin, Enabled: true, Cache: &CacheConfig{Preload: true}},
+		},
+	}, nil, nil, store, nil)
+	if err != nil {
+		t.Fatalf("NewExecutorWithStorage() error = %v", err)
+	}
+	t.Cleanup(func() { _ = executor.Close() })
+
+	// 预加载后缓存以哈希为索引，明文 Key 命中缓存
+	result, err := executor.Execute(context.Background(), "sk-secret", &RequestInfo{})
+	if err != nil || !result.Allow {
+		t.Fatalf("Execute(plain) = %+v, %v; want allowed", result, err)
+	}
+
+	// 直接提交存储的哈希值不能命中预加载的缓存条目
+	result, err = executor.Execute(context.Background(), admin.HashKey("sk-secret"), &RequestInfo{})
+	if err != nil || result.Allow {
+		t.Errorf("Execute(hash) = %+v, %v; want denied", result, err)
+	}
+}
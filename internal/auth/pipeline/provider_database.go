@@ -19,6 +19,8 @@ type DatabaseProvider struct {
 	table     string   // 表名
 	keyColumn string   // API Key 列名
 	fields    []string // 需要查询的字段
+
+	startsAtColumn string // 生效时间列名（结果中统一映射为 starts_at）
 }
 
 // NewDatabaseProviderWithDB 使用已创建的数据库连接创建 Provider
@@ -48,6 +50,10 @@ func NewDatabaseProviderWithDB(name string, db interface{}, cfg *DatabaseConfig)
 	if keyColumn == "" {
 		keyColumn = "api_key"
 	}
+	startsAtColumn := cfg.StartsAtColumn
+	if startsAtColumn == "" {
+		startsAtColumn = "starts_at"
+	}
 
 	return &DatabaseProvider{
 		BaseProvider: BaseProvider{
@@ -58,6 +64,8 @@ func NewDatabaseProviderWithDB(name string, db interface{}, cfg *DatabaseConfig)
 		table:     cfg.Table,
 		keyColumn: keyColumn,
 		fields:    cfg.Fields,
+
+		startsAtColumn: startsAtColumn,
 	}, nil
 }
 
@@ -104,6 +112,88 @@ func (d *DatabaseProvider) Query(ctx context.Context, apiKey string) *ProviderRe
 		return &ProviderResult{Found: false}
 	}
 
+	data, err := scanRowData(rows, columns)
+	if err != nil {
+		return &ProviderResult{
+			Found: false,
+			Error: err,
+		}
+	}
+	d.mapStartsAt(data)
+
+	return &ProviderResult{
+		Found: true,
+		Data:  data,
+	}
+}
+
+// Preload 遍历表中所有 Key，用于预热缓存
+// 查询字段未包含 key 列时额外读取该列，但不放入 data，保证与 Query 返回的数据一致
+// 参数：
+//   - ctx: 上下文
+//   - fn: 处理函数
+//
+// 返回：
+//   - error: 错误信息
+func (d *DatabaseProvider) Preload(ctx context.Context, fn func(key string, data map[string]interface{})) error {
+	selectFields := "*"
+	extraKey := false
+	if len(d.fields) > 0 {
+		fields := d.fields
+		extraKey = true
+		for _, f := range d.fields {
+			if f == d.keyColumn {
+				extraKey = false
+				break
+			}
+		}
+		if extraKey {
+			fields = append([]string{d.keyColumn}, fields...)
+		}
+		selectFields = strings.Join(fields, ", ")
+	}
+
+	query := fmt.Sprintf("SELECT %s FROM %s", selectFields, d.table)
+	rows, err := d.db.QueryContext(ctx, query)
+	if err != nil {
+		return fmt.Errorf("数据库查询失败: %w", err)
+	}
+	defer func() {
+		_ = rows.Close()
+	}()
+
+	columns, err := rows.Columns()
+	if err != nil {
+		return fmt.Errorf("获取列信息失败: %w", err)
+	}
+
+	for rows.Next() {
+		data, err := scanRowData(rows, columns)
+		if err != nil {
+			return err
+		}
+		key := fmt.Sprint(data[d.keyColumn])
+		if extraKey {
+			delete(data, d.keyColumn)
+		}
+		d.mapStartsAt(data)
+		fn(key, data)
+	}
+	return rows.Err()
+}
+
+// mapStartsAt 将自定义的生效时间列映射为 starts_at，供默认鉴权逻辑检查
+func (d *DatabaseProvider) mapStartsAt(data map[string]interface{}) {
+	if d.startsAtColumn == "starts_at" {
+		return
+	}
+	if v, ok := data[d.startsAtColumn]; ok {
+		data["starts_at"] = v
+	}
+}
+
+// scanRowData 将当前行扫描为 列名 -> 值 的 map（[]byte 转为 string）
+func scanRowData(rows *sql.Rows, columns []string) (map[string]interface{}, error) {
 	// 创建接收器
 	values := make([]interface{}, len(columns))
 	valuePtrs := make([]interface{}, len(columns))
@@ -113,10 +203,7 @@ func (d *DatabaseProvider) Query(ctx context.Context, apiKey string) *ProviderRe
 
 	// 扫描数据
 	if err := rows.Scan(valuePtrs...); err != nil {
-		return &ProviderResult{
-			Found: false,
-			Error: fmt.Errorf("数据扫描失败: %w", err),
-		}
+		return nil, fmt.Errorf("数据扫描失败: %w", err)
 	}
 
 	// 转换为 map
@@ -130,11 +217,7 @@ func (d *DatabaseProvider) Query(ctx context.Context, apiKey string) *ProviderRe
 			data[col] = val
 		}
 	}
-
-	return &ProviderResult{
-		Found: true,
-		Data:  data,
-	}
+	return data, nil
 }
 
 // Close 关闭 Provider
@@ -0,0 +1,133 @@
+package pipeline
+
+import (
+	"context"
+	"database/sql"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	"llmproxy/internal/auth"
+
+	_ "modernc.org/sqlite"
+)
+
+// newTestKeyDB 创建带自定义生效时间列的 Key 表
+func newTestKeyDB(t *testing.T) *sql.DB {
+	t.Helper()
+	db, err := sql.Open("sqlite", filepath.Join(t.TempDir(), "keys.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = db.Close() })
+	if _, err := db.Exec(`CREATE TABLE user_keys (api_key TEXT PRIMARY KEY, status INTEGER, valid_from INTEGER)`); err != nil {
+		t.Fatal(err)
+	}
+	return db
+}
+
+func TestDatabaseProviderStartsAtColumn(t *testing.T) {
+	db := newTestKeyDB(t)
+	now := time.Now()
+	rows := []struct {
+		key       string
+		validFrom interface{}
+	}{
+		{"sk-pending", now.Add(time.Hour).Unix()},
+		{"sk-active", now.Add(-time.Hour).Unix()},
+		{"sk-no-start", nil},
+	}
+	for _, row := range rows {
+		if _, err := db.Exec(`INSERT INTO user_keys (api_key, status, valid_from) VALUES (?, 0, ?)`, row.key, row.validFrom); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	provider, err := NewDatabaseProviderWithDB("db", db, &DatabaseConfig{Table: "user_keys", StartsAtColumn: "valid_from"})
+	if err != nil {
+		t.Fatalf("NewDatabaseProviderWithDB() error = %v", err)
+	}
+	e := &Executor{}
+
+	tests := []struct {
+		key       string
+		wantAllow bool
+	}{
+		{"sk-pending", false},
+		{"sk-active", true},
+		{"sk-no-start", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.key, func(t *testing.T) {
+			result := provider.Query(context.Background(), tt.key)
+			if !result.Found || result.Error != nil {
+				t.Fatalf("Query() = %+v", result)
+			}
+			// 自定义列映射为 starts_at
+			if result.Data["starts_at"] != result.Data["valid_from"] {
+				t.Errorf("starts_at = %v, want valid_from %v", result.Data["starts_at"], result.Data["valid_from"])
+			}
+			auth, err := e.defaultAuthLogic(&AuthContext{APIKey: tt.key, Data: result.Data})
+			if err != nil {
+				t.Fatalf("defaultAuthLogic() error = %v", err)
+			}
+			if auth.Allow != tt.wantAllow {
+				t.Errorf("defaultAuthLogic() = %+v, want allow = %v", auth, tt.wantAllow)
+			}
+		})
+	}
+}
+
+// testDatabases 按名称提供数据库连接的 StorageManager
+type testDatabases map[string]*sql.DB
+
+func (d testDatabases) GetDatabase(name string) interface{} {
+	if db, ok := d[name]; ok {
+		return db
+	}
+	return nil
+}
+
+func TestDatabaseProviderAllowedModels(t *testing.T) {
+	db := newTestKeyDB(t)
+	if _, err := db.Exec(`ALTER TABLE user_keys ADD COLUMN allowed_models TEXT`); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := db.Exec(`INSERT INTO user_keys (api_key, status, allowed_models) VALUES ('sk-restricted', 0, 'gpt-4o, o1-*'), ('sk-open', 0, NULL)`); err != nil {
+		t.Fatal(err)
+	}
+	executor, err := NewExecutorWithStorage(&PipelineConfig{
+		Enabled: true,
+		Mode:    PipelineModeFirstMatch,
+		Providers: []*ProviderConfig{{
+			Name:     "db",
+			Type:     ProviderTypeDatabase,
+			Enabled:  true,
+			Database: &DatabaseConfig{Storage: "main", Table: "user_keys"},
+		}},
+	}, testDatabases{"main": db}, nil, nil, nil)
+	if err != nil {
+		t.Fatalf("NewExecutorWithStorage() error = %v", err)
+	}
+	t.Cleanup(func() { _ = executor.Close() })
+
+	// 逗号分隔的列值随元数据传给调用方身份，解析为模型列表
+	tests := []struct {
+		key  string
+		want []string
+	}{
+		{"sk-restricted", []string{"gpt-4o", "o1-*"}},
+		{"sk-open", nil},
+	}
+	for _, tt := range tests {
+		result, err := executor.Execute(context.Background(), tt.key, &RequestInfo{})
+		if err != nil || !result.Allow {
+			t.Fatalf("%s: Execute() = %+v, %v", tt.key, result, err)
+		}
+		identity := auth.NewIdentity(tt.key, result.Provider, result.Metadata)
+		if !reflect.DeepEqual(identity.AllowedModels, tt.want) {
+			t.Errorf("%s: allowed models = %q, want %q", tt.key, identity.AllowedModels, tt.want)
+		}
+	}
+}
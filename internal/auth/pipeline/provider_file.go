@@ -5,6 +5,7 @@ import (
 	"sync"
 	"time"
 
+	"llmproxy/internal/auth"
 	"llmproxy/internal/config"
 )
 
@@ -54,14 +55,17 @@ func NewFileProvider(name string, keys []*config.APIKey) Provider {
 // 返回：
 //   - *ProviderResult: 查询结果
 func (f *FileProvider) Query(ctx context.Context, apiKey string) *ProviderResult {
-	f.mu.RLock()
-	defer f.mu.RUnlock()
+	f.mu.Lock()
+	defer f.mu.Unlock()
 
 	key, ok := f.keys[apiKey]
 	if !ok {
 		return &ProviderResult{Found: false}
 	}
 
+	// 按周期重置额度（开启 rollover 时结转未用额度）
+	_ = auth.ResetQuotaIfNeeded(key)
+
 	// 转换为 map 格式
 	data := map[string]interface{}{
 		"key":                key.Key,
@@ -71,8 +75,12 @@ func (f *FileProvider) Query(ctx context.Context, apiKey string) *ProviderResult
 		"total_quota":        key.TotalQuota,
 		"used_quota":         key.UsedQuota,
 		"quota_reset_period": key.QuotaResetPeriod,
+		"rollover":           key.Rollover,
+		"rollover_quota":     key.RolloverQuota,
+		"daily_cost_limit":   key.DailyCostLimit,
 		"allowed_ips":        key.AllowedIPs,
 		"denied_ips":         key.DeniedIPs,
+		"allowed_models":     key.AllowedModels,
 		"created_at":         key.CreatedAt.Unix(),
 		"updated_at":         key.UpdatedAt.Unix(),
 	}
@@ -81,6 +89,9 @@ func (f *FileProvider) Query(ctx context.Context, apiKey string) *ProviderResult
 	if key.ExpiresAt != nil {
 		data["expires_at"] = key.ExpiresAt.Unix()
 	}
+	if resetAt, ok := auth.NextQuotaReset(key); ok {
+		data["quota_reset_at"] = resetAt.Unix()
+	}
 
 	return &ProviderResult{
 		Found: true,
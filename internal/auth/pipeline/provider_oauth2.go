@@ -0,0 +1,202 @@
+package pipeline
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+// defaultIntrospectFields 内省响应字段到鉴权数据字段的默认映射
+// exp 映射为 expires_at，由默认鉴权逻辑判断过期
+var defaultIntrospectFields = map[string]string{
+	"scope":    "scope",
+	"username": "user_id",
+	"exp":      "expires_at",
+}
+
+// OAuth2IntrospectProvider OAuth2 令牌内省 Provider（RFC 7662）
+// 把 API Key 当作不透明访问令牌提交到内省端点，active=true 视为找到；
+// 有效结果缓存到令牌的 exp，未返回 exp 的结果不缓存
+type OAuth2IntrospectProvider struct {
+	BaseProvider
+	client        *http.Client      // HTTP 客户端
+	endpoint      string            // 内省端点 URL
+	clientID      string            // 客户端 ID
+	clientSecret  string            // 客户端密钥
+	tokenTypeHint string            // token_type_hint 参数
+	fields        map[string]string // 内省响应字段 -> 鉴权数据字段
+
+	mu      sync.RWMutex
+	entries map[string]cacheEntry // 有效令牌缓存（以令牌哈希为索引）
+	now     func() time.Time
+}
+
+// NewOAuth2IntrospectProvider 创建 OAuth2 令牌内省 Provider
+// 参数：
+//   - name: Provider 名称
+//   - cfg: 内省配置
+//
+// 返回：
+//   - Provider: Provider 实例
+//   - error: 错误信息
+func NewOAuth2IntrospectProvider(name string, cfg *OAuth2IntrospectConfig) (Provider, error) {
+	if cfg == nil {
+		return nil, fmt.Errorf("oauth2_introspect 配置不能为空")
+	}
+	if cfg.Endpoint == "" {
+		return nil, fmt.Errorf("oauth2_introspect endpoint 不能为空")
+	}
+
+	timeout := cfg.Timeout
+	if timeout == 0 {
+		timeout = 5 * time.Second
+	}
+	hint := cfg.TokenTypeHint
+	if hint == "" {
+		hint = "access_token"
+	}
+
+	fields := make(map[string]string, len(defaultIntrospectFields)+len(cfg.Fields))
+	for k, v := range defaultIntrospectFields {
+		fields[k] = v
+	}
+	for k, v := range cfg.Fields {
+		if v == "" {
+			// 映射为空表示不使用该字段
+			delete(fields, k)
+			continue
+		}
+		fields[k] = v
+	}
+
+	return &OAuth2IntrospectProvider{
+		BaseProvider: BaseProvider{
+			name:         name,
+			providerType: ProviderTypeOAuth2Introspect,
+		},
+		client: &http.Client{
+			Timeout: timeout,
+		},
+		endpoint:      cfg.Endpoint,
+		clientID:      cfg.ClientID,
+		clientSecret:  cfg.ClientSecret,
+		tokenTypeHint: hint,
+		fields:        fields,
+		entries:       make(map[string]cacheEntry),
+		now:           time.Now,
+	}, nil
+}
+
+// Query 通过内省端点验证访问令牌
+// 参数：
+//   - ctx: 上下文
+//   - apiKey: 访问令牌
+//
+// 返回：
+//   - *ProviderResult: 查询结果（active=false 时 Found 为 false）
+func (o *OAuth2IntrospectProvider) Query(ctx context.Context, apiKey string) *ProviderResult {
+	k := cacheKey(apiKey)
+
+	o.mu.RLock()
+	entry, ok := o.entries[k]
+	o.mu.RUnlock()
+	if ok && o.now().Before(entry.expiresAt) {
+		return &ProviderResult{Found: true, Data: entry.data}
+	}
+
+	resp, err := o.introspect(ctx, apiKey)
+	if err != nil {
+		return &ProviderResult{Found: false, Error: err}
+	}
+
+	if active, _ := resp["active"].(bool); !active {
+		return &ProviderResult{Found: false}
+	}
+
+	data := map[string]interface{}{
+		"status": "active",
+	}
+	for from, to := range o.fields {
+		if v, ok := resp[from]; ok && v != nil {
+			data[to] = v
+		}
+	}
+
+	// 有效结果缓存到令牌过期
+	if exp, ok := resp["exp"].(float64); ok && exp > 0 {
+		expiresAt := time.Unix(int64(exp), 0)
+		if o.now().Before(expiresAt) {
+			o.store(k, data, expiresAt)
+		}
+	}
+
+	return &ProviderResult{Found: true, Data: data}
+}
+
+// introspect 向内省端点提交令牌
+// 参数：
+//   - ctx: 上下文
+//   - token: 访问令牌
+//
+// 返回：
+//   - map[string]interface{}: 内省响应
+//   - error: 请求失败或响应无效时返回错误
+func (o *OAuth2IntrospectProvider) introspect(ctx context.Context, token string) (map[string]interface{}, error) {
+	form := url.Values{}
+	form.Set("token", token)
+	form.Set("token_type_hint", o.tokenTypeHint)
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, o.endpoint, strings.NewReader(form.Encode()))
+	if err != nil {
+		return nil, fmt.Errorf("创建请求失败: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Accept", "application/json")
+	if o.clientID != "" {
+		req.SetBasicAuth(url.QueryEscape(o.clientID), url.QueryEscape(o.clientSecret))
+	}
+
+	resp, err := o.client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("内省请求失败: %w", err)
+	}
+	defer func() {
+		_ = resp.Body.Close()
+	}()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("读取响应失败: %w", err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("内省端点返回 HTTP %d", resp.StatusCode)
+	}
+
+	var data map[string]interface{}
+	if err := json.Unmarshal(body, &data); err != nil {
+		return nil, fmt.Errorf("响应解析失败: %w", err)
+	}
+	return data, nil
+}
+
+// store 写入缓存条目
+func (o *OAuth2IntrospectProvider) store(k string, data map[string]interface{}, expiresAt time.Time) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	now := o.now()
+	if len(o.entries) > cachePruneSize {
+		for key, entry := range o.entries {
+			if !now.Before(entry.expiresAt) {
+				delete(o.entries, key)
+			}
+		}
+	}
+	o.entries[k] = cacheEntry{data: data, expiresAt: expiresAt}
+}
@@ -0,0 +1,211 @@
+package pipeline
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// introspectServer 模拟 RFC 7662 内省端点
+// tok-active 有效，tok-error 返回 500，tok-garbage 返回非 JSON，其他令牌无效
+type introspectServer struct {
+	*httptest.Server
+	calls atomic.Int32 // 内省请求次数
+}
+
+// newIntrospectServer 启动内省端点（要求 client-id / client-secret 的 Basic 认证），exp 为有效令牌的过期时间
+func newIntrospectServer(t *testing.T, exp time.Time) *introspectServer {
+	t.Helper()
+	s := &introspectServer{}
+	s.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		s.calls.Add(1)
+		if id, secret, ok := r.BasicAuth(); !ok || id != "client-id" || secret != "client-secret" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		if r.Method != http.MethodPost || r.PostFormValue("token_type_hint") != "access_token" {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		switch r.PostFormValue("token") {
+		case "tok-active":
+			fmt.Fprintf(w, `{"active":true,"scope":"chat embeddings","username":"alice","client_id":"app","exp":%d}`, exp.Unix())
+		case "tok-error":
+			w.WriteHeader(http.StatusInternalServerError)
+		case "tok-garbage":
+			_, _ = w.Write([]byte(`<html>`))
+		default:
+			_, _ = w.Write([]byte(`{"active":false}`))
+		}
+	}))
+	t.Cleanup(s.Close)
+	return s
+}
+
+// newIntrospectProvider 创建指向 server 的内省 Provider
+func newIntrospectProvider(t *testing.T, server *introspectServer, fields map[string]string) *OAuth2IntrospectProvider {
+	t.Helper()
+	provider, err := NewOAuth2IntrospectProvider("oauth2", &OAuth2IntrospectConfig{
+		Endpoint:     server.URL,
+		ClientID:     "client-id",
+		ClientSecret: "client-secret",
+		Fields:       fields,
+	})
+	if err != nil {
+		t.Fatalf("NewOAuth2IntrospectProvider() error = %v", err)
+	}
+	return provider.(*OAuth2IntrospectProvider)
+}
+
+func TestOAuth2IntrospectProviderQuery(t *testing.T) {
+	exp := time.Now().Add(time.Hour).Truncate(time.Second)
+	server := newIntrospectServer(t, exp)
+	provider := newIntrospectProvider(t, server, nil)
+
+	// active=true：映射 scope / username / exp
+	result := provider.Query(context.Background(), "tok-active")
+	if !result.Found || result.Error != nil {
+		t.Fatalf("active: Query() = %+v", result)
+	}
+	if result.Data["scope"] != "chat embeddings" || result.Data["user_id"] != "alice" || result.Data["expires_at"] != float64(exp.Unix()) {
+		t.Errorf("active: Data = %v", result.Data)
+	}
+	if _, ok := result.Data["client_id"]; ok {
+		t.Errorf("active: unmapped field client_id in Data = %v", result.Data)
+	}
+
+	// active=false：未找到，不是错误
+	if result := provider.Query(context.Background(), "tok-inactive"); result.Found || result.Error != nil {
+		t.Errorf("inactive: Query() = %+v, want not found", result)
+	}
+
+	// 端点错误和无效响应返回错误
+	for _, token := range []string{"tok-error", "tok-garbage"} {
+		if result := provider.Query(context.Background(), token); result.Found || result.Error == nil {
+			t.Errorf("%s: Query() = %+v, want error", token, result)
+		}
+	}
+
+	// 客户端凭证错误
+	bad, err := NewOAuth2IntrospectProvider("oauth2", &OAuth2IntrospectConfig{Endpoint: server.URL, ClientID: "client-id", ClientSecret: "wrong"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result := bad.Query(context.Background(), "tok-active"); result.Error == nil {
+		t.Errorf("wrong secret: Query() = %+v, want error", result)
+	}
+}
+
+func TestOAuth2IntrospectProviderCache(t *testing.T) {
+	exp := time.Now().Add(time.Hour).Truncate(time.Second)
+	server := newIntrospectServer(t, exp)
+	provider := newIntrospectProvider(t, server, nil)
+	now := time.Now()
+	provider.now = func() time.Time { return now }
+
+	// 有效结果缓存到 exp
+	for i := 0; i < 3; i++ {
+		if result := provider.Query(context.Background(), "tok-active"); !result.Found {
+			t.Fatalf("Query() #%d = %+v", i+1, result)
+		}
+	}
+	if got := server.calls.Load(); got != 1 {
+		t.Errorf("introspection calls for cached token = %d, want 1", got)
+	}
+
+	// 过期后重新内省
+	now = exp.Add(time.Second)
+	provider.Query(context.Background(), "tok-active")
+	if got := server.calls.Load(); got != 2 {
+		t.Errorf("introspection calls after exp = %d, want 2", got)
+	}
+
+	// 无效结果不缓存
+	server.calls.Store(0)
+	provider.Query(context.Background(), "tok-inactive")
+	provider.Query(context.Background(), "tok-inactive")
+	if got := server.calls.Load(); got != 2 {
+		t.Errorf("introspection calls for inactive token = %d, want 2", got)
+	}
+}
+
+func TestOAuth2IntrospectProviderFields(t *testing.T) {
+	server := newIntrospectServer(t, time.Now().Add(time.Hour))
+	provider := newIntrospectProvider(t, server, map[string]string{
+		"client_id": "name",     // 新增映射
+		"username":  "username", // 覆盖默认映射
+		"exp":       "",         // 不使用 exp
+	})
+
+	result := provider.Query(context.Background(), "tok-active")
+	if !result.Found {
+		t.Fatalf("Query() = %+v", result)
+	}
+	if result.Data["name"] != "app" || result.Data["username"] != "alice" || result.Data["scope"] != "chat embeddings" {
+		t.Errorf("Data = %v", result.Data)
+	}
+	for _, field := range []string{"user_id", "expires_at"} {
+		if _, ok := result.Data[field]; ok {
+			t.Errorf("Data contains %s: %v", field, result.Data)
+		}
+	}
+}
+
+func TestOAuth2IntrospectPipeline(t *testing.T) {
+	server := newIntrospectServer(t, time.Now().Add(time.Hour))
+	executor, err := NewExecutorWithStorage(&PipelineConfig{
+		Enabled: true,
+		Mode:    PipelineModeFirstMatch,
+		Providers: []*ProviderConfig{{
+			Name:    "oauth2",
+			Type:    ProviderTypeOAuth2Introspect,
+			Enabled: true,
+			OAuth2Introspect: &OAuth2IntrospectConfig{
+				Endpoint:     server.URL,
+				ClientID:     "client-id",
+				ClientSecret: "client-secret",
+			},
+		}},
+	}, nil, nil, nil, nil)
+	if err != nil {
+		t.Fatalf("NewExecutorWithStorage() error = %v", err)
+	}
+	t.Cleanup(func() { _ = executor.Close() })
+
+	tests := []struct {
+		token      string
+		wantAllow  bool
+		wantStatus string
+	}{
+		{"tok-active", true, "ACTIVE"},
+		{"tok-inactive", false, "NOT_FOUND"},
+		{"tok-error", false, "NOT_FOUND"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.token, func(t *testing.T) {
+			result, err := executor.Execute(context.Background(), tt.token, &RequestInfo{Method: "POST", Path: "/v1/chat/completions"})
+			if err != nil {
+				t.Fatalf("Execute() error = %v", err)
+			}
+			if result.Allow != tt.wantAllow || result.StatusName != tt.wantStatus {
+				t.Errorf("Execute() = %+v, want allow=%v %s", result, tt.wantAllow, tt.wantStatus)
+			}
+			if tt.wantAllow && result.Metadata["user_id"] != "alice" {
+				t.Errorf("Metadata = %v, want user_id alice", result.Metadata)
+			}
+		})
+	}
+
+	// 已过期的令牌（exp 早于当前时间）由默认鉴权逻辑拒绝
+	expired := newIntrospectServer(t, time.Now().Add(-time.Minute))
+	executor.providers[0].provider = newIntrospectProvider(t, expired, nil)
+	result, err := executor.Execute(context.Background(), "tok-active", &RequestInfo{})
+	if err != nil || result.Allow || result.StatusName != "EXPIRED" {
+		t.Errorf("expired token: Execute() = %+v, %v; want EXPIRED", result, err)
+	}
+}
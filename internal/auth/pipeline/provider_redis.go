@@ -14,8 +14,8 @@ import (
 // 从 Redis 读取 API Key 信息
 type RedisProvider struct {
 	BaseProvider
-	client     *redis.Client // Redis 客户端
-	keyPattern string        // Key 模式
+	client     redis.UniversalClient // Redis 客户端
+	keyPattern string                // Key 模式
 }
 
 // NewRedisProviderWithClient 使用已创建的 Redis 连接创建 Provider
@@ -27,7 +27,7 @@ type RedisProvider struct {
 // 返回：
 //   - Provider: Provider 实例
 //   - error: 错误信息
-func NewRedisProviderWithClient(name string, client *redis.Client, keyPattern string) (Provider, error) {
+func NewRedisProviderWithClient(name string, client redis.UniversalClient, keyPattern string) (Provider, error) {
 	if client == nil {
 		return nil, fmt.Errorf("redis 客户端不能为空")
 	}
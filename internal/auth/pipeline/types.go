@@ -9,7 +9,7 @@ import (
 )
 
 // RedisClient Redis 客户端类型别名
-type RedisClient = *redis.Client
+type RedisClient = redis.UniversalClient
 
 // ProviderType 鉴权提供者类型
 type ProviderType string
@@ -22,6 +22,8 @@ const (
 	ProviderTypeLua      ProviderType = "lua"      // Lua 脚本
 	ProviderTypeStatic   ProviderType = "static"   // 静态 API Keys
 	ProviderTypeBuiltin  ProviderType = "builtin"  // 内置 SQLite 存储
+
+	ProviderTypeOAuth2Introspect ProviderType = "oauth2_introspect" // OAuth2 令牌内省（RFC 7662）
 )
 
 // KeyStatus 别名，方便引用
@@ -50,6 +52,8 @@ type AuthResult struct {
 	StatusCode int                    `json:"status_code"`        // HTTP 状态码
 	StatusName string                 `json:"status_name"`        // 状态名称（如 DISABLED, EXPIRED）
 	Metadata   map[string]interface{} `json:"metadata,omitempty"` // 附加元数据
+	ResetAt    int64                  `json:"reset_at,omitempty"` // 额度下一次重置时间（Unix 秒，未知时为 0）
+	Provider   string                 `json:"-"`                  // 做出决策的 Provider（all 模式放行时为全部匹配的 Provider，逗号分隔）
 }
 
 // ProviderResult Provider 查询结果
@@ -77,8 +81,9 @@ type RequestInfo struct {
 
 // ErrorDetail 错误详情（嵌套结构）
 type ErrorDetail struct {
-	Code    string `json:"code"`    // 状态码名称（如 DISABLED, EXPIRED）
-	Message string `json:"message"` // 错误消息
+	Code    string `json:"code"`               // 状态码名称（如 DISABLED, EXPIRED）
+	Message string `json:"message"`            // 错误消息
+	ResetAt string `json:"reset_at,omitempty"` // 额度下一次重置时间（RFC3339，仅额度耗尽时）
 }
 
 // ErrorResponse 错误响应结构
@@ -99,6 +104,8 @@ type DatabaseConfig struct {
 	Table     string   `yaml:"table"`      // 表名
 	KeyColumn string   `yaml:"key_column"` // API Key 列名
 	Fields    []string `yaml:"fields"`     // 需要查询的字段列表
+
+	StartsAtColumn string `yaml:"starts_at_column"` // 生效时间列名（默认 starts_at）
 }
 
 // WebhookConfig Webhook 配置
@@ -109,6 +116,16 @@ type WebhookConfig struct {
 	Headers map[string]string `yaml:"headers"` // 自定义请求头
 }
 
+// OAuth2IntrospectConfig OAuth2 令牌内省配置
+type OAuth2IntrospectConfig struct {
+	Endpoint      string            `yaml:"endpoint"`        // 内省端点 URL
+	ClientID      string            `yaml:"client_id"`       // 客户端 ID
+	ClientSecret  string            `yaml:"client_secret"`   // 客户端密钥
+	TokenTypeHint string            `yaml:"token_type_hint"` // token_type_hint 参数
+	Timeout       time.Duration     `yaml:"timeout"`         // 超时时间
+	Fields        map[string]string `yaml:"fields"`          // 内省响应字段 -> 鉴权数据字段
+}
+
 // ProviderConfig 单个 Provider 配置
 type ProviderConfig struct {
 	Name          string           `yaml:"name"`               // Provider 名称
@@ -120,13 +137,26 @@ type ProviderConfig struct {
 	StaticKeys    []*config.APIKey `yaml:"static,omitempty"`   // 静态 API Keys
 	LuaScript     string           `yaml:"lua_script"`         // Lua 脚本内容
 	LuaScriptFile string           `yaml:"lua_script_file"`    // Lua 脚本文件路径
+	LuaMaxMemory  int              `yaml:"lua_max_memory"`     // Lua 脚本内存上限（MB，0 表示不限制）
+	LuaModulePath []string         `yaml:"lua_module_path"`    // Lua require 的模块搜索目录
+	Cache         *CacheConfig     `yaml:"cache,omitempty"`    // 查询结果缓存
+
+	OAuth2Introspect *OAuth2IntrospectConfig `yaml:"oauth2_introspect,omitempty"` // OAuth2 令牌内省配置
+}
+
+// CacheConfig Provider 缓存配置
+type CacheConfig struct {
+	TTL     time.Duration `yaml:"ttl"`     // 缓存有效期
+	Preload bool          `yaml:"preload"` // 启动时预加载
 }
 
 // PipelineConfig 鉴权管道配置
 type PipelineConfig struct {
 	Enabled     bool              `yaml:"enabled"`      // 是否启用管道鉴权
 	HeaderNames []string          `yaml:"header_names"` // 自定义认证 Header 名称列表
-	SkipPaths   []string          `yaml:"skip_paths"`   // 跳过鉴权的路径前缀
+	Scheme      string            `yaml:"scheme"`       // Authorization 头的认证方案（默认 Bearer）
+	QueryParam  string            `yaml:"query_param"`  // 从 URL 查询参数读取 Key 的参数名（为空时不启用）
+	SkipPaths   []string          `yaml:"skip_paths"`   // 跳过鉴权的路径前缀（末尾 "*" 可省略）
 	Mode        PipelineMode      `yaml:"mode"`         // 管道模式：first_match 或 all
 	Providers   []*ProviderConfig `yaml:"pipeline"`     // Provider 列表（按顺序执行）
 }
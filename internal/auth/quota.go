@@ -1,6 +1,8 @@
 package auth
 
 import (
+	"net/http"
+	"strconv"
 	"time"
 )
 
@@ -16,7 +18,42 @@ func CheckQuota(key *APIKey) bool {
 		return true
 	}
 
-	return key.UsedQuota < key.TotalQuota
+	return key.UsedQuota < EffectiveQuota(key)
+}
+
+// EffectiveQuota 计算本周期可用的总额度（周期额度 + 结转额度）
+// 参数：
+//   - key: API Key
+//
+// 返回：
+//   - int64: 本周期可用总额度（0 表示不限制）
+func EffectiveQuota(key *APIKey) int64 {
+	if key.TotalQuota <= 0 {
+		return 0
+	}
+	return key.TotalQuota + key.RolloverQuota
+}
+
+// rolloverAmount 计算周期重置时可结转的额度
+// 未用额度 = 本周期可用总额度 - 已用额度，不超过 rollover_cap（未配置时不超过 total_quota）
+func rolloverAmount(key *APIKey) int64 {
+	if !key.Rollover || key.TotalQuota <= 0 {
+		return 0
+	}
+
+	unused := EffectiveQuota(key) - key.UsedQuota
+	if unused <= 0 {
+		return 0
+	}
+
+	limit := key.RolloverCap
+	if limit <= 0 {
+		limit = key.TotalQuota
+	}
+	if unused > limit {
+		unused = limit
+	}
+	return unused
 }
 
 // DeductQuota 扣减额度
@@ -28,6 +65,40 @@ func DeductQuota(key *APIKey, tokens int64) {
 	key.UpdatedAt = time.Now()
 }
 
+// NextQuotaReset 计算下一次周期重置时间（与 ResetQuotaIfNeeded 的判断一致）
+// 参数：
+//   - key: API Key
+//
+// 返回：
+//   - time.Time: 下一次重置时间
+//   - bool: 是否会周期重置（never 或空时为 false）
+func NextQuotaReset(key *APIKey) (time.Time, bool) {
+	switch key.QuotaResetPeriod {
+	case "daily":
+		return key.LastResetAt.Add(24 * time.Hour), true
+	case "weekly":
+		return key.LastResetAt.Add(7 * 24 * time.Hour), true
+	case "monthly":
+		y, m, _ := time.Now().Date()
+		return time.Date(y, m+1, 1, 0, 0, 0, 0, time.Local), true
+	}
+	return time.Time{}, false
+}
+
+// SetResetHeaders 设置额度重置相关的响应头
+// Retry-After 为距重置的秒数（至少 1），X-RateLimit-Reset 为重置时间的 Unix 秒
+// 参数：
+//   - w: HTTP 响应写入器
+//   - resetAt: 下一次重置时间
+func SetResetHeaders(w http.ResponseWriter, resetAt time.Time) {
+	wait := int64(time.Until(resetAt).Seconds())
+	if wait < 1 {
+		wait = 1
+	}
+	w.Header().Set("Retry-After", strconv.FormatInt(wait, 10))
+	w.Header().Set("X-RateLimit-Reset", strconv.FormatInt(resetAt.Unix(), 10))
+}
+
 // ResetQuotaIfNeeded 按周期重置额度
 // 参数：
 //   - key: API Key
@@ -55,6 +126,8 @@ func ResetQuotaIfNeeded(key *APIKey) bool {
 	}
 
 	if shouldReset {
+		// 结转只保留上一个周期的未用额度，不会无限累积
+		key.RolloverQuota = rolloverAmount(key)
 		key.UsedQuota = 0
 		key.LastResetAt = now
 		key.UpdatedAt = now
@@ -0,0 +1,192 @@
+package auth
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+
+	"llmproxy/internal/config"
+	"llmproxy/internal/utils"
+)
+
+// QuotaAlertEvent 额度阈值告警事件（Webhook 请求体）
+type QuotaAlertEvent struct {
+	Event       string    `json:"event"`             // 事件类型，固定为 quota_threshold
+	APIKey      string    `json:"api_key"`           // API Key（仅前 8 位）
+	Name        string    `json:"name,omitempty"`    // Key 名称
+	UserID      string    `json:"user_id,omitempty"` // 用户 ID
+	Threshold   int       `json:"threshold"`         // 跨过的阈值（百分比）
+	UsedQuota   int64     `json:"used_quota"`        // 已用额度
+	TotalQuota  int64     `json:"total_quota"`       // 本周期总额度（含结转额度）
+	PeriodStart time.Time `json:"period_start"`      // 当前重置周期的开始时间
+	Timestamp   time.Time `json:"timestamp"`         // 触发时间
+}
+
+// alertingKeyStore 带额度阈值告警的 KeyStore 装饰器
+type alertingKeyStore struct {
+	KeyStore
+	cfg        *config.QuotaAlertConfig
+	thresholds []int
+	client     *http.Client
+
+	mu    sync.Mutex
+	fired map[string]*firedThresholds // key -> 当前周期已触发的阈值
+}
+
+// firedThresholds 单个 Key 在某个周期内已触发的阈值
+type firedThresholds struct {
+	period time.Time
+	levels map[int]bool
+}
+
+// NewAlertingKeyStore 为 KeyStore 增加额度阈值告警
+// 每次 IncrementUsedQuota 后检查已用额度比例，跨过阈值时异步回调 Webhook。
+// 每个阈值在一个重置周期（LastResetAt 不变）内只触发一次。
+// 参数：
+//   - store: 原始 KeyStore
+//   - cfg: 告警配置（为 nil 或未启用时直接返回原始 store）
+//
+// 返回：
+//   - KeyStore: 带告警的 KeyStore
+func NewAlertingKeyStore(store KeyStore, cfg *config.QuotaAlertConfig) KeyStore {
+	if store == nil || cfg == nil || !cfg.Enabled || cfg.Webhook == nil || cfg.Webhook.URL == "" {
+		return store
+	}
+
+	thresholds := make([]int, 0, len(cfg.Thresholds))
+	for _, t := range cfg.Thresholds {
+		if t > 0 {
+			thresholds = append(thresholds, t)
+		}
+	}
+	sort.Ints(thresholds)
+
+	timeout := cfg.Webhook.Timeout
+	if timeout <= 0 {
+		timeout = 3 * time.Second
+	}
+
+	return &alertingKeyStore{
+		KeyStore:   store,
+		cfg:        cfg,
+		thresholds: thresholds,
+		client:     &http.Client{Timeout: timeout},
+		fired:      make(map[string]*firedThresholds),
+	}
+}
+
+// IncrementUsedQuota 增加已使用额度，并在跨过阈值时触发告警
+func (s *alertingKeyStore) IncrementUsedQuota(key string, tokens int64) error {
+	if err := s.KeyStore.IncrementUsedQuota(key, tokens); err != nil {
+		return err
+	}
+
+	// Key 可能在扣减后被并发删除，此时 Get 返回 (nil, nil)
+	apiKey, err := s.KeyStore.Get(key)
+	if err != nil || apiKey == nil || apiKey.TotalQuota <= 0 {
+		return nil
+	}
+
+	for _, threshold := range s.crossed(apiKey) {
+		event := &QuotaAlertEvent{
+			Event:       "quota_threshold",
+			APIKey:      utils.MaskKey(apiKey.Key),
+			Name:        apiKey.Name,
+			UserID:      apiKey.UserID,
+			Threshold:   threshold,
+			UsedQuota:   apiKey.UsedQuota,
+			TotalQuota:  EffectiveQuota(apiKey),
+			PeriodStart: apiKey.LastResetAt,
+			Timestamp:   time.Now(),
+		}
+		go s.send(event)
+	}
+
+	return nil
+}
+
+// crossed 返回本次新跨过的阈值，并记录为已触发
+func (s *alertingKeyStore) crossed(apiKey *APIKey) []int {
+	percent := float64(apiKey.UsedQuota) * 100 / float64(EffectiveQuota(apiKey))
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	f, ok := s.fired[apiKey.Key]
+	if !ok || !f.period.Equal(apiKey.LastResetAt) {
+		// 新的重置周期，清空已触发记录
+		f = &firedThresholds{period: apiKey.LastResetAt, levels: make(map[int]bool)}
+		s.fired[apiKey.Key] = f
+	}
+
+	var result []int
+	for _, t := range s.thresholds {
+		if percent >= float64(t) && !f.levels[t] {
+			f.levels[t] = true
+			result = append(result, t)
+		}
+	}
+	return result
+}
+
+// send 发送告警 Webhook（支持重试）
+func (s *alertingKeyStore) send(event *QuotaAlertEvent) {
+	data, err := json.Marshal(event)
+	if err != nil {
+		log.Printf("序列化额度告警失败: %v", err)
+		return
+	}
+
+	retries := s.cfg.Webhook.Retry
+	if retries <= 0 {
+		retries = 1
+	}
+
+	for attempt := 0; attempt < retries; attempt++ {
+		if attempt > 0 {
+			time.Sleep(time.Duration(attempt) * 100 * time.Millisecond)
+		}
+		if err = s.post(data); err == nil {
+			log.Printf("额度告警已发送: key=%s, 阈值=%d%%", event.APIKey, event.Threshold)
+			return
+		}
+	}
+	log.Printf("额度告警发送失败，已重试 %d 次: %v", retries, err)
+}
+
+// post 发送一次 Webhook 请求
+func (s *alertingKeyStore) post(data []byte) error {
+	method := s.cfg.Webhook.Method
+	if method == "" {
+		method = http.MethodPost
+	}
+
+	req, err := http.NewRequestWithContext(context.Background(), method, s.cfg.Webhook.URL, bytes.NewReader(data))
+	if err != nil {
+		return fmt.Errorf("创建请求失败: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	for k, v := range s.cfg.Webhook.Headers {
+		req.Header.Set(k, v)
+	}
+	utils.SignRequest(req, data, s.cfg.Webhook.Secret, s.cfg.Webhook.SignatureHeader)
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("请求失败: %w", err)
+	}
+	defer func() {
+		_ = resp.Body.Close()
+	}()
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("返回状态码: %d", resp.StatusCode)
+	}
+	return nil
+}
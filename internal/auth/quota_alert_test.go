@@ -0,0 +1,134 @@
+package auth
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"testing"
+	"time"
+
+	"llmproxy/internal/config"
+)
+
+// newAlertWebhook 启动接收额度告警的模拟 Webhook
+func newAlertWebhook(t *testing.T) (string, <-chan QuotaAlertEvent) {
+	t.Helper()
+	events := make(chan QuotaAlertEvent, 16)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var event QuotaAlertEvent
+		if err := json.NewDecoder(r.Body).Decode(&event); err != nil {
+			t.Errorf("decode alert: %v", err)
+		}
+		events <- event
+	}))
+	t.Cleanup(server.Close)
+	return server.URL, events
+}
+
+// receiveThresholds 等待指定数量的告警，返回按阈值排序的结果；随后短暂等待确认没有多余的告警
+func receiveThresholds(t *testing.T, events <-chan QuotaAlertEvent, n int) []QuotaAlertEvent {
+	t.Helper()
+	var got []QuotaAlertEvent
+	for len(got) < n {
+		select {
+		case event := <-events:
+			got = append(got, event)
+		case <-time.After(5 * time.Second):
+			t.Fatalf("received %d alerts, want %d", len(got), n)
+		}
+	}
+	select {
+	case event := <-events:
+		t.Fatalf("unexpected alert: %+v", event)
+	case <-time.After(100 * time.Millisecond):
+	}
+	sort.Slice(got, func(i, j int) bool { return got[i].Threshold < got[j].Threshold })
+	return got
+}
+
+// thresholdsOf 提取告警的阈值列表
+func thresholdsOf(events []QuotaAlertEvent) []int {
+	var thresholds []int
+	for _, event := range events {
+		thresholds = append(thresholds, event.Threshold)
+	}
+	return thresholds
+}
+
+// deletedKeyStore 模拟扣减后 Key 被并发删除：Get 返回 (nil, nil)
+type deletedKeyStore struct{}
+
+func (deletedKeyStore) Get(key string) (*APIKey, error) { return nil, nil }
+
+func (deletedKeyStore) Update(key *APIKey) error { return nil }
+
+func (deletedKeyStore) IncrementUsedQuota(key string, tokens int64) error { return nil }
+
+func TestAlertingKeyStore(t *testing.T) {
+	url, events := newAlertWebhook(t)
+	period := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+	key := &APIKey{Key: "sk-alert-1234567890", Name: "alert", UserID: "user_001", TotalQuota: 100, LastResetAt: period}
+	base := NewFileKeyStore([]*APIKey{key})
+	store := NewAlertingKeyStore(base, &config.QuotaAlertConfig{
+		Enabled:    true,
+		Thresholds: []int{50, 80, 100},
+		Webhook:    &config.UsageWebhookConfig{URL: url},
+	})
+
+	increment := func(tokens int64) {
+		t.Helper()
+		if err := store.IncrementUsedQuota(key.Key, tokens); err != nil {
+			t.Fatalf("IncrementUsedQuota() error = %v", err)
+		}
+	}
+
+	// 未跨过阈值时不告警
+	increment(40)
+	receiveThresholds(t, events, 0)
+
+	// 跨过 50%：告警一次，Key 脱敏
+	increment(20)
+	got := receiveThresholds(t, events, 1)
+	if got[0].Threshold != 50 || got[0].UsedQuota != 60 || got[0].TotalQuota != 100 || !got[0].PeriodStart.Equal(period) {
+		t.Errorf("alert = %+v, want threshold 50 at 60/100", got[0])
+	}
+	if got[0].APIKey != "sk-alert..." || got[0].Name != "alert" || got[0].UserID != "user_001" {
+		t.Errorf("alert key = %q, name = %q, user = %q; want the masked key", got[0].APIKey, got[0].Name, got[0].UserID)
+	}
+
+	// 同一周期内不重复告警
+	increment(5)
+	receiveThresholds(t, events, 0)
+
+	// 一次跨过多个阈值时逐个告警
+	increment(40)
+	if got := thresholdsOf(receiveThresholds(t, events, 2)); len(got) != 2 || got[0] != 80 || got[1] != 100 {
+		t.Errorf("thresholds = %v, want [80 100]", got)
+	}
+	increment(10)
+	receiveThresholds(t, events, 0)
+
+	// 额度重置（LastResetAt 变化）后重新计数
+	if err := base.Update(&APIKey{Key: key.Key, Status: "active", TotalQuota: 100, LastResetAt: period.AddDate(0, 1, 0)}); err != nil {
+		t.Fatal(err)
+	}
+	increment(50)
+	if got := thresholdsOf(receiveThresholds(t, events, 1)); got[0] != 50 {
+		t.Errorf("thresholds after reset = %v, want [50]", got)
+	}
+}
+
+func TestAlertingKeyStoreDeletedKey(t *testing.T) {
+	url, events := newAlertWebhook(t)
+	store := NewAlertingKeyStore(deletedKeyStore{}, &config.QuotaAlertConfig{
+		Enabled:    true,
+		Thresholds: []int{50},
+		Webhook:    &config.UsageWebhookConfig{URL: url},
+	})
+
+	if err := store.IncrementUsedQuota("sk-deleted", 100); err != nil {
+		t.Errorf("IncrementUsedQuota() error = %v", err)
+	}
+	receiveThresholds(t, events, 0)
+}
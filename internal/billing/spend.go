@@ -0,0 +1,183 @@
+package billing
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"log"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+
+	"llmproxy/internal/config"
+)
+
+// SpendTracker 每日消费统计器
+// 按配置的模型价格计算每次请求的费用，并按 Key 累计当日消费。
+// 使用 Redis 时多实例共享计数；未配置 Redis 时退化为进程内计数。
+// 计数 Key 中包含所在时区的日期，因此在该时区零点自动切换到新的计数；
+// Redis 中只保存 API Key 的 SHA-256 哈希，不保存明文。
+type SpendTracker struct {
+	client  redis.UniversalClient
+	prefix  string
+	loc     *time.Location
+	pricing []*config.ModelPrice
+	now     func() time.Time
+
+	mu     sync.Mutex
+	memory map[string]float64 // 进程内计数（无 Redis 时使用）
+	day    string             // 进程内计数对应的日期
+}
+
+// NewSpendTracker 创建每日消费统计器
+// 参数：
+//   - cfg: 计费配置
+//   - client: Redis 客户端（可选，为 nil 时使用进程内计数）
+//
+// 返回：
+//   - *SpendTracker: 统计器实例
+//   - error: 错误信息
+func NewSpendTracker(cfg *config.BillingConfig, client redis.UniversalClient) (*SpendTracker, error) {
+	loc := time.Local
+	if cfg.Timezone != "" {
+		l, err := time.LoadLocation(cfg.Timezone)
+		if err != nil {
+			return nil, fmt.Errorf("加载时区失败: %w", err)
+		}
+		loc = l
+	}
+
+	return &SpendTracker{
+		client:  client,
+		prefix:  "llmproxy:spend:",
+		loc:     loc,
+		pricing: cfg.Pricing,
+		now:     time.Now,
+		memory:  make(map[string]float64),
+	}, nil
+}
+
+// Cost 计算一次请求的费用
+// 参数：
+//   - model: 模型名
+//   - promptTokens: 输入 token 数
+//   - completionTokens: 输出 token 数
+//
+// 返回：
+//   - float64: 费用（未配置该模型价格时为 0）
+func (s *SpendTracker) Cost(model string, promptTokens, completionTokens int) float64 {
+	if s == nil {
+		return 0
+	}
+	price := s.findPrice(model)
+	if price == nil {
+		return 0
+	}
+	return float64(promptTokens)/1000*price.Prompt + float64(completionTokens)/1000*price.Completion
+}
+
+// Record 累计 Key 的当日消费
+// 参数：
+//   - apiKey: API Key
+//   - cost: 本次费用
+func (s *SpendTracker) Record(apiKey string, cost float64) {
+	if s == nil || apiKey == "" || cost <= 0 {
+		return
+	}
+
+	if s.client == nil {
+		s.mu.Lock()
+		s.rotateLocked()
+		s.memory[apiKey] += cost
+		s.mu.Unlock()
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	key := s.dayKey(apiKey)
+	pipe := s.client.TxPipeline()
+	pipe.IncrByFloat(ctx, key, cost)
+	// 保留 48 小时，跨时区零点后旧 Key 自然过期
+	pipe.Expire(ctx, key, 48*time.Hour)
+	if _, err := pipe.Exec(ctx); err != nil {
+		log.Printf("记录每日消费失败: %v", err)
+	}
+}
+
+// Spent 获取 Key 的当日已消费金额
+// 参数：
+//   - apiKey: API Key
+//
+// 返回：
+//   - float64: 当日已消费金额
+//   - error: 错误信息
+func (s *SpendTracker) Spent(apiKey string) (float64, error) {
+	if s == nil {
+		return 0, nil
+	}
+
+	if s.client == nil {
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		s.rotateLocked()
+		return s.memory[apiKey], nil
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	spent, err := s.client.Get(ctx, s.dayKey(apiKey)).Float64()
+	if err == redis.Nil {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, fmt.Errorf("查询每日消费失败: %w", err)
+	}
+	return spent, nil
+}
+
+// NextReset 获取下一次计数重置时间（所在时区的下一个零点）
+func (s *SpendTracker) NextReset() time.Time {
+	now := s.now().In(s.loc)
+	return time.Date(now.Year(), now.Month(), now.Day()+1, 0, 0, 0, 0, s.loc)
+}
+
+// dayKey 生成当日计数 Key（使用 API Key 的哈希，避免明文写入 Redis）
+func (s *SpendTracker) dayKey(apiKey string) string {
+	sum := sha256.Sum256([]byte(apiKey))
+	return s.prefix + s.today() + ":sha256:" + hex.EncodeToString(sum[:])
+}
+
+// today 返回所在时区的当前日期
+func (s *SpendTracker) today() string {
+	return s.now().In(s.loc).Format("20060102")
+}
+
+// rotateLocked 日期变化时清空进程内计数（调用方需持有锁）
+func (s *SpendTracker) rotateLocked() {
+	if today := s.today(); today != s.day {
+		s.day = today
+		s.memory = make(map[string]float64)
+	}
+}
+
+// findPrice 查找模型价格（支持 * 后缀通配符，按配置顺序匹配）
+func (s *SpendTracker) findPrice(model string) *config.ModelPrice {
+	for _, p := range s.pricing {
+		if p == nil {
+			continue
+		}
+		if p.Model == model {
+			return p
+		}
+		if strings.HasSuffix(p.Model, "*") && strings.HasPrefix(model, strings.TrimSuffix(p.Model, "*")) {
+			return p
+		}
+	}
+	return nil
+}
@@ -0,0 +1,153 @@
+package billing
+
+import (
+	"math"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/redis/go-redis/v9"
+
+	"llmproxy/internal/config"
+)
+
+// testPricing 测试用的模型价格（按顺序匹配）
+var testPricing = []*config.ModelPrice{
+	{Model: "gpt-4o-mini*", Prompt: 0.00015, Completion: 0.0006},
+	{Model: "gpt-4*", Prompt: 0.03, Completion: 0.06},
+	{Model: "claude-3-haiku", Prompt: 0.00025, Completion: 0.00125},
+}
+
+// newTestTracker 创建使用固定时钟的统计器（client 为 nil 时使用进程内计数）
+func newTestTracker(t *testing.T, client redis.UniversalClient, now *time.Time) *SpendTracker {
+	t.Helper()
+	tracker, err := NewSpendTracker(&config.BillingConfig{Enabled: true, Timezone: "Asia/Shanghai", Pricing: testPricing}, client)
+	if err != nil {
+		t.Fatalf("NewSpendTracker() error = %v", err)
+	}
+	tracker.now = func() time.Time { return *now }
+	return tracker
+}
+
+// mustSpent 读取当日消费
+func mustSpent(t *testing.T, tracker *SpendTracker, apiKey string) float64 {
+	t.Helper()
+	spent, err := tracker.Spent(apiKey)
+	if err != nil {
+		t.Fatalf("Spent() error = %v", err)
+	}
+	return spent
+}
+
+// almostEqual 比较浮点金额
+func almostEqual(a, b float64) bool {
+	return math.Abs(a-b) < 1e-9
+}
+
+func TestCost(t *testing.T) {
+	now := time.Now()
+	tracker := newTestTracker(t, nil, &now)
+
+	tests := []struct {
+		name       string
+		model      string
+		prompt     int
+		completion int
+		want       float64
+	}{
+		{"精确匹配", "claude-3-haiku", 1000, 2000, 0.00025 + 0.0025},
+		{"通配符按顺序匹配", "gpt-4o-mini-2024-07-18", 2000, 1000, 0.0003 + 0.0006},
+		{"前缀通配", "gpt-4-turbo", 500, 500, 0.015 + 0.03},
+		{"未配置价格", "llama-3", 1000, 1000, 0},
+		{"没有用量", "gpt-4", 0, 0, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tracker.Cost(tt.model, tt.prompt, tt.completion); !almostEqual(got, tt.want) {
+				t.Errorf("Cost(%s, %d, %d) = %v, want %v", tt.model, tt.prompt, tt.completion, got, tt.want)
+			}
+		})
+	}
+
+	// 未启用计费时统计器为 nil
+	var disabled *SpendTracker
+	if got := disabled.Cost("gpt-4", 1000, 1000); got != 0 {
+		t.Errorf("nil tracker Cost() = %v, want 0", got)
+	}
+}
+
+func TestSpendTrackerMemory(t *testing.T) {
+	shanghai, err := time.LoadLocation("Asia/Shanghai")
+	if err != nil {
+		t.Skip("Asia/Shanghai timezone unavailable")
+	}
+	now := time.Date(2026, 3, 15, 23, 59, 0, 0, shanghai)
+	tracker := newTestTracker(t, nil, &now)
+
+	tracker.Record("sk-a", 0.5)
+	tracker.Record("sk-a", 0.25)
+	tracker.Record("sk-b", 1)
+	tracker.Record("sk-a", 0) // 0 和负数不累计
+	tracker.Record("sk-a", -1)
+	if got := mustSpent(t, tracker, "sk-a"); !almostEqual(got, 0.75) {
+		t.Errorf("sk-a spent = %v, want 0.75", got)
+	}
+	if got := mustSpent(t, tracker, "sk-b"); !almostEqual(got, 1) {
+		t.Errorf("sk-b spent = %v, want 1", got)
+	}
+	if want := time.Date(2026, 3, 16, 0, 0, 0, 0, shanghai); !tracker.NextReset().Equal(want) {
+		t.Errorf("NextReset() = %v, want %v", tracker.NextReset(), want)
+	}
+
+	// 所在时区零点后切换到新的计数
+	now = now.Add(time.Minute)
+	if got := mustSpent(t, tracker, "sk-a"); got != 0 {
+		t.Errorf("after midnight: spent = %v, want 0", got)
+	}
+	tracker.Record("sk-a", 0.1)
+	if got := mustSpent(t, tracker, "sk-a"); !almostEqual(got, 0.1) {
+		t.Errorf("new day spent = %v, want 0.1", got)
+	}
+}
+
+func TestSpendTrackerRedis(t *testing.T) {
+	mr := miniredis.RunT(t)
+	client := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+	t.Cleanup(func() { _ = client.Close() })
+
+	// UTC 16:00 已是上海时间次日零点
+	now := time.Date(2026, 3, 15, 15, 30, 0, 0, time.UTC)
+	tracker := newTestTracker(t, client, &now)
+	other := newTestTracker(t, client, &now) // 另一个实例共享计数
+
+	tracker.Record("sk-secret-key", 0.5)
+	other.Record("sk-secret-key", 0.25)
+	if got := mustSpent(t, tracker, "sk-secret-key"); !almostEqual(got, 0.75) {
+		t.Errorf("spent = %v, want 0.75", got)
+	}
+
+	// Redis 中只保存 Key 的哈希，并设置过期时间
+	keys := mr.Keys()
+	if len(keys) != 1 || !strings.HasPrefix(keys[0], "llmproxy:spend:20260315:sha256:") {
+		t.Fatalf("redis keys = %v, want one hashed counter for 20260315", keys)
+	}
+	if strings.Contains(keys[0], "sk-secret-key") {
+		t.Errorf("redis key %q contains the plaintext API key", keys[0])
+	}
+	if ttl := mr.TTL(keys[0]); ttl != 48*time.Hour {
+		t.Errorf("TTL = %v, want 48h", ttl)
+	}
+
+	// 上海时间零点后读取新的计数 Key
+	now = now.Add(time.Hour)
+	if got := mustSpent(t, tracker, "sk-secret-key"); got != 0 {
+		t.Errorf("after midnight: spent = %v, want 0", got)
+	}
+
+	// Redis 不可用时返回错误，由调用方决定是否放行
+	mr.Close()
+	if _, err := tracker.Spent("sk-secret-key"); err == nil {
+		t.Error("Spent() with redis down: error = nil")
+	}
+}
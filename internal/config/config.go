@@ -3,6 +3,7 @@ package config
 import (
 	"fmt"
 	"os"
+	"reflect"
 	"time"
 
 	"gopkg.in/yaml.v3"
@@ -20,10 +21,79 @@ type ServerConfig struct {
 	IdleTimeout    time.Duration `yaml:"idle_timeout"`     // 空闲超时
 	MaxHeaderBytes int           `yaml:"max_header_bytes"` // 最大请求头大小
 	MaxBodySize    int64         `yaml:"max_body_size"`    // 最大请求体大小
+	ShutdownDelay  time.Duration `yaml:"shutdown_delay"`   // 收到退出信号后，/ready 返回 503 并等待该时长再关闭（供上游 LB 摘除流量）
+	StreamMismatch string        `yaml:"stream_mismatch"`  // 请求 stream: true 但上游未返回流式响应时的处理方式：json（默认，按普通 JSON 返回）/ sse（仍按 SSE 返回）
 	CORS           *CORSConfig   `yaml:"cors"`             // CORS 配置
 	TLS            *TLSConfig    `yaml:"tls"`              // TLS 配置
+
+	RequestValidation *RequestValidationConfig `yaml:"request_validation"` // 转发前校验 tools / response_format 结构
+	Idempotency       *IdempotencyConfig       `yaml:"idempotency"`        // Idempotency-Key 重放保护
+	AnthropicMessages *AnthropicMessagesConfig `yaml:"anthropic_messages"` // Anthropic Messages API 转换
+	ShutdownTimeout   time.Duration            `yaml:"shutdown_timeout"`   // 关闭时等待在途请求（含流式响应）完成的最长时间，超时后强制断开（默认 10s）
+	Readiness         *ReadinessConfig         `yaml:"readiness"`          // 就绪检查（/ready、/readyz）条件
+}
+
+// ReadinessConfig 就绪检查条件
+// 任一条件不满足时 /ready、/readyz 返回 503；/health、/livez 只检查进程存活，不受影响
+type ReadinessConfig struct {
+	MinHealthyBackends int      `yaml:"min_healthy_backends"` // 所有后端池合计至少需要的健康后端数（默认 1，负数表示不检查）
+	Storage            []string `yaml:"storage"`              // 必须可用的存储连接名称（"*" 表示全部，默认不检查）
+}
+
+// AnthropicMessagesConfig Anthropic Messages API 转换配置
+// 启用后接受 /v1/messages 请求，转换为 OpenAI Chat Completions 格式转发给后端，
+// 并将响应（含 SSE 流）转换回 Anthropic 格式
+type AnthropicMessagesConfig struct {
+	Enabled bool `yaml:"enabled"` // 是否启用
 }
 
+// IdempotencyConfig 幂等键配置
+// 非流式请求携带 Idempotency-Key 请求头时缓存成功响应，同一 Key 重放时直接返回缓存，
+// 不再调用后端，也不重复计费
+type IdempotencyConfig struct {
+	Enabled bool          `yaml:"enabled"` // 是否启用
+	TTL     time.Duration `yaml:"ttl"`     // 响应缓存时间（默认 24h）
+	Redis   string        `yaml:"redis"`   // 引用 storage.caches[name]，为空时使用进程内缓存（多实例不共享）
+}
+
+// RequestValidationConfig 转发前的结构化请求校验配置
+// 在请求发往后端前检查 tools / functions / response_format 的结构和其中的 JSON Schema，
+// 明显不合法的请求直接返回 400，避免浪费一次上游调用
+type RequestValidationConfig struct {
+	Enabled       bool   `yaml:"enabled"`        // 是否启用
+	SchemaVersion string `yaml:"schema_version"` // Schema 未声明 $schema 时使用的版本：2020-12（默认）/ 2019-09 / draft-07 / draft-06 / draft-04
+}
+
+// server.request_validation.schema_version 取值
+const (
+	SchemaDraft04   = "draft-04"
+	SchemaDraft06   = "draft-06"
+	SchemaDraft07   = "draft-07"
+	SchemaDraft2019 = "2019-09"
+	SchemaDraft2020 = "2020-12"
+)
+
+// UpstreamConfig 发往后端的请求头配置
+type UpstreamConfig struct {
+	UserAgent string `yaml:"user_agent"` // 覆盖上游请求的 User-Agent，{version} 替换为版本号（为空时透传客户端 UA）
+	Via       bool   `yaml:"via"`        // 追加 Via 请求头（1.1 llmproxy）
+}
+
+// TracingConfig 分布式追踪配置（Span 以 OTLP/HTTP JSON 格式导出）
+type TracingConfig struct {
+	Enabled     bool              `yaml:"enabled"`      // 是否启用（关闭时不创建 Span）
+	Endpoint    string            `yaml:"endpoint"`     // OTLP/HTTP 导出地址，如 http://otel-collector:4318/v1/traces
+	ServiceName string            `yaml:"service_name"` // 服务名（默认 llmproxy）
+	SampleRate  float64           `yaml:"sample_rate"`  // 新链路的采样率 (0, 1]，默认 1；请求带 traceparent 时沿用其采样标记
+	Headers     map[string]string `yaml:"headers"`      // 导出请求附加的请求头（如鉴权）
+}
+
+// server.stream_mismatch 取值
+const (
+	StreamMismatchJSON = "json" // 按普通 JSON 响应返回
+	StreamMismatchSSE  = "sse"  // 仍按 SSE 响应头返回（旧行为）
+)
+
 // CORSConfig CORS 跨域配置
 type CORSConfig struct {
 	Enabled          bool     `yaml:"enabled"`
@@ -41,7 +111,10 @@ type TLSConfig struct {
 	CertFile     string `yaml:"cert_file"`
 	KeyFile      string `yaml:"key_file"`
 	ClientCAFile string `yaml:"client_ca_file"`
-	ClientAuth   string `yaml:"client_auth"`
+	ClientAuth   string `yaml:"client_auth"` // none / request / verify / require
+
+	// 将已校验的客户端证书 CN 写入该请求头（为空时不写入）
+	ClientCNHeader string `yaml:"client_cn_header"`
 }
 
 // ============================================================
@@ -59,10 +132,10 @@ type LogConfig struct {
 // LogFileConfig 日志文件配置
 type LogFileConfig struct {
 	Path     string `yaml:"path"`
-	Rotate   string `yaml:"rotate"`   // daily / hourly / size
-	MaxSize  int    `yaml:"max_size"` // MB
-	MaxAge   int    `yaml:"max_age"`  // 天
-	Compress bool   `yaml:"compress"`
+	Rotate   string `yaml:"rotate"`   // daily / hourly / size（为空不轮转）
+	MaxSize  int    `yaml:"max_size"` // MB（rotate=size 时默认 100，daily / hourly 时可选的附加上限）
+	MaxAge   int    `yaml:"max_age"`  // 轮转文件保留天数（0 表示不清理）
+	Compress bool   `yaml:"compress"` // 轮转文件压缩为 .gz
 }
 
 // ============================================================
@@ -73,6 +146,15 @@ type LogFileConfig struct {
 type StorageConfig struct {
 	Databases []*DatabaseConnection `yaml:"databases"` // 数据库连接池
 	Caches    []*CacheConnection    `yaml:"caches"`    // 缓存连接池
+
+	HealthCheck *StorageHealthCheckConfig `yaml:"health_check"` // 连接健康检查（可选）
+}
+
+// StorageHealthCheckConfig 存储连接健康检查配置
+type StorageHealthCheckConfig struct {
+	Enabled  bool          `yaml:"enabled"`  // 是否启用
+	Interval time.Duration `yaml:"interval"` // 检查间隔（默认 10s）
+	Timeout  time.Duration `yaml:"timeout"`  // 单次 Ping 超时（默认 3s）
 }
 
 // DatabaseConnection 数据库连接配置
@@ -91,6 +173,12 @@ type DatabaseConnection struct {
 	MaxIdleConns    int           `yaml:"max_idle_conns"`     // 最大空闲连接数
 	ConnMaxLifetime time.Duration `yaml:"conn_max_lifetime"`  // 连接最大生命周期
 	ConnMaxIdleTime time.Duration `yaml:"conn_max_idle_time"` // 空闲连接最大时间
+
+	// 只读副本：鉴权（database 提供者）和服务发现的读查询使用副本，写入（用量、日志等）仍使用主库
+	ReadDSN     string `yaml:"read_dsn"`     // 副本 DSN
+	ReadHost    string `yaml:"read_host"`    // 副本主机（其余参数与主库相同，read_dsn 优先）
+	ReadPort    int    `yaml:"read_port"`    // 副本端口（为空时与主库相同）
+	ReadReplica string `yaml:"read_replica"` // 引用另一个数据库连接作为副本（与 read_dsn / read_host 互斥）
 }
 
 // GetDSN 生成数据库 DSN 连接字符串
@@ -126,6 +214,35 @@ func (c *DatabaseConnection) GetDSN() string {
 	}
 }
 
+// GetReadDSN 生成只读副本的 DSN 连接字符串
+// 返回：
+//   - string: 副本 DSN（未配置 read_dsn / read_host 时为空）
+func (c *DatabaseConnection) GetReadDSN() string {
+	if c == nil {
+		return ""
+	}
+	if c.ReadDSN != "" {
+		return c.ReadDSN
+	}
+	if c.ReadHost == "" {
+		return ""
+	}
+	replica := *c
+	replica.DSN = ""
+	replica.Host = c.ReadHost
+	if c.ReadPort > 0 {
+		replica.Port = c.ReadPort
+	}
+	return replica.GetDSN()
+}
+
+// Redis 部署模式
+const (
+	RedisModeStandalone = "standalone" // 单节点（默认）
+	RedisModeSentinel   = "sentinel"   // 哨兵高可用
+	RedisModeCluster    = "cluster"    // 集群分片
+)
+
 // CacheConnection 缓存连接配置
 type CacheConnection struct {
 	Name         string        `yaml:"name"`           // 连接名称
@@ -141,6 +258,31 @@ type CacheConnection struct {
 	WriteTimeout time.Duration `yaml:"write_timeout"`  // 写入超时
 	MaxSize      int           `yaml:"max_size"`       // 内存缓存最大条目
 	TTL          time.Duration `yaml:"ttl"`            // 内存缓存默认 TTL
+
+	// Redis 部署模式
+	Mode             string   `yaml:"mode"`              // standalone（默认）/ sentinel / cluster
+	MasterName       string   `yaml:"master_name"`       // Sentinel 监控的主节点名称
+	Addrs            []string `yaml:"addrs"`             // Sentinel 地址或 Cluster 节点地址（未配置时使用 addr）
+	SentinelPassword string   `yaml:"sentinel_password"` // Sentinel 自身的密码（可选）
+}
+
+// GetMode 获取 Redis 部署模式（未配置时为 standalone）
+func (c *CacheConnection) GetMode() string {
+	if c.Mode == "" {
+		return RedisModeStandalone
+	}
+	return c.Mode
+}
+
+// GetAddrs 获取 Sentinel / Cluster 节点地址（未配置 addrs 时使用 addr）
+func (c *CacheConnection) GetAddrs() []string {
+	if len(c.Addrs) > 0 {
+		return c.Addrs
+	}
+	if c.Addr != "" {
+		return []string{c.Addr}
+	}
+	return nil
 }
 
 // GetDatabase 根据名称获取数据库连接
@@ -182,6 +324,15 @@ type Backend struct {
 	ConnectTimeout time.Duration     `yaml:"connect_timeout"` // 连接超时
 	MaxIdleConns   int               `yaml:"max_idle_conns"`  // 最大空闲连接
 	Headers        map[string]string `yaml:"headers"`         // 自定义请求头
+	Group          string            `yaml:"group"`           // 后端组（配合 routing.model_routes 按模型路由）
+	RateLimit      *BackendRateLimit `yaml:"rate_limit"`      // 发往该后端的请求限流（需要 routing.enabled）
+}
+
+// BackendRateLimit 后端级限流配置（令牌桶，按后端名称计数）
+// 用于遵守上游提供商的 QPS 限制，达到上限的后端在路由时视为暂时不可用
+type BackendRateLimit struct {
+	RequestsPerSecond int `yaml:"requests_per_second"` // 每秒请求数
+	BurstSize         int `yaml:"burst_size"`          // 桶容量（默认等于 requests_per_second）
 }
 
 // ============================================================
@@ -199,7 +350,7 @@ type DiscoveryConfig struct {
 // DiscoverySource 发现源配置
 type DiscoverySource struct {
 	Name       string                   `yaml:"name"`                 // 源名称
-	Type       string                   `yaml:"type"`                 // 类型: database / static / consul / kubernetes / etcd / http
+	Type       string                   `yaml:"type"`                 // 类型: database / static / consul / kubernetes / etcd / http / dns
 	Enabled    bool                     `yaml:"enabled"`              // 是否启用
 	Database   *DiscoveryDatabaseConfig `yaml:"database,omitempty"`   // 数据库配置
 	Static     *DiscoveryStaticConfig   `yaml:"static,omitempty"`     // 静态配置
@@ -207,14 +358,48 @@ type DiscoverySource struct {
 	Kubernetes *DiscoveryK8sConfig      `yaml:"kubernetes,omitempty"` // Kubernetes 配置
 	Etcd       *DiscoveryEtcdConfig     `yaml:"etcd,omitempty"`       // Etcd 配置
 	HTTP       *DiscoveryHTTPConfig     `yaml:"http,omitempty"`       // HTTP 配置
+	DNS        *DiscoveryDNSConfig      `yaml:"dns,omitempty"`        // DNS SRV 配置
 	Script     *ScriptConfig            `yaml:"script,omitempty"`     // Lua 后处理脚本
 }
 
 // DiscoveryDatabaseConfig 数据库发现配置
 type DiscoveryDatabaseConfig struct {
-	Storage string            `yaml:"storage"` // 引用 storage.databases[name]
-	Table   string            `yaml:"table"`   // 表名
-	Fields  map[string]string `yaml:"fields"`  // 字段映射
+	Storage      string            `yaml:"storage"`       // 引用 storage.databases[name]
+	Table        string            `yaml:"table"`         // 表名
+	Fields       map[string]string `yaml:"fields"`        // 字段映射: name / url / weight / status
+	ActiveStatus []string          `yaml:"active_status"` // 视为可用的状态值（默认 enabled / active）
+	Where        string            `yaml:"where"`         // 自定义 WHERE 条件（设置后替代状态过滤）
+}
+
+// GetTable 获取表名（默认 services）
+func (c *DiscoveryDatabaseConfig) GetTable() string {
+	if c == nil || c.Table == "" {
+		return "services"
+	}
+	return c.Table
+}
+
+// GetField 获取字段映射后的列名（未配置时与字段名相同）
+// 参数：
+//   - field: 字段名（name / url / weight / status）
+//
+// 返回：
+//   - string: 数据库列名
+func (c *DiscoveryDatabaseConfig) GetField(field string) string {
+	if c != nil {
+		if column, ok := c.Fields[field]; ok && column != "" {
+			return column
+		}
+	}
+	return field
+}
+
+// GetActiveStatus 获取视为可用的状态值列表
+func (c *DiscoveryDatabaseConfig) GetActiveStatus() []string {
+	if c == nil || len(c.ActiveStatus) == 0 {
+		return []string{"enabled", "active"}
+	}
+	return c.ActiveStatus
 }
 
 // DiscoveryStaticConfig 静态发现配置
@@ -227,7 +412,8 @@ type DiscoveryConsulConfig struct {
 	Addr     string        `yaml:"addr"`     // Consul 地址
 	Service  string        `yaml:"service"`  // 服务名
 	Tag      string        `yaml:"tag"`      // 标签过滤
-	Interval time.Duration `yaml:"interval"` // 同步间隔
+	Interval time.Duration `yaml:"interval"` // 同步间隔（服务端不支持阻塞查询时的轮询间隔）
+	Wait     time.Duration `yaml:"wait"`     // 阻塞查询最长等待时间（默认 5m）
 }
 
 // DiscoveryK8sConfig Kubernetes 发现配置
@@ -255,10 +441,20 @@ type DiscoveryHTTPConfig struct {
 	Headers  map[string]string `yaml:"headers"`  // 请求头
 }
 
+// DiscoveryDNSConfig DNS SRV 发现配置
+type DiscoveryDNSConfig struct {
+	Name   string        `yaml:"name"`   // SRV 记录名，如 _llm._tcp.service.consul
+	Scheme string        `yaml:"scheme"` // 后端协议: http / https（默认 http）
+	Server string        `yaml:"server"` // DNS 服务器地址 host:port（可选，默认系统解析器）
+	TTL    time.Duration `yaml:"ttl"`    // 解析结果缓存时间（0 表示每次都重新解析）
+}
+
 // UsageConfig 用量上报配置
 type UsageConfig struct {
 	Enabled   bool             `yaml:"enabled"`   // 是否启用
 	Reporters []*UsageReporter `yaml:"reporters"` // 上报器列表（可配置多个）
+
+	IncludeStreamUsage bool `yaml:"include_stream_usage"` // 为流式请求附加 stream_options.include_usage，保证上游返回用量
 }
 
 // UsageReporter 单个用量上报器配置
@@ -270,6 +466,17 @@ type UsageReporter struct {
 	Database *UsageDatabaseConfig `yaml:"database,omitempty"` // 数据库配置
 	Builtin  *UsageBuiltinConfig  `yaml:"builtin,omitempty"`  // 内置 SQLite 配置
 	Script   *ScriptConfig        `yaml:"script,omitempty"`   // Lua 脚本
+	Shadow   bool                 `yaml:"shadow"`             // 影子上报器：异步执行、不重试、不计入 Webhook 成功/失败指标
+
+	DeadLetter *UsageDeadLetterConfig `yaml:"dead_letter,omitempty"` // 死信队列（仅 webhook 上报器）
+}
+
+// UsageDeadLetterConfig 用量死信队列配置
+// Webhook 重试耗尽后记录追加到本地文件，由后台任务在端点恢复后重新发送
+type UsageDeadLetterConfig struct {
+	File          string        `yaml:"file"`           // 死信文件路径（JSON Lines，留空不启用）
+	MaxRecords    int           `yaml:"max_records"`    // 最多保留的记录数（默认 100000，超出后丢弃新记录）
+	DrainInterval time.Duration `yaml:"drain_interval"` // 后台重新发送的间隔（默认 30s）
 }
 
 // UsageWebhookConfig 用量 Webhook 配置
@@ -279,12 +486,27 @@ type UsageWebhookConfig struct {
 	Timeout time.Duration     `yaml:"timeout"` // 超时时间
 	Retry   int               `yaml:"retry"`   // 重试次数
 	Headers map[string]string `yaml:"headers"` // 请求头
+
+	// 请求签名（配置 secret 后启用，未配置时请求与之前一致）
+	Secret          string `yaml:"secret"`           // HMAC-SHA256 签名密钥
+	SignatureHeader string `yaml:"signature_header"` // 签名请求头名（默认 X-LLMProxy-Signature）
+
+	// 重试退避（指数退避 + 随机抖动，与 routing.retry 的字段一致）
+	InitialWait time.Duration `yaml:"initial_wait"` // 首次重试前的等待（默认 100ms）
+	MaxWait     time.Duration `yaml:"max_wait"`     // 最大等待（默认 5s，Retry-After 同样不超过该值）
+	Multiplier  float64       `yaml:"multiplier"`   // 退避倍数（默认 2）
 }
 
 // UsageDatabaseConfig 用量数据库配置
 type UsageDatabaseConfig struct {
 	Storage string `yaml:"storage"` // 引用 storage.databases[name]
 	Table   string `yaml:"table"`   // 表名
+
+	Retry          int           `yaml:"retry"`           // 写入尝试次数（默认 3）
+	RetryBackoff   time.Duration `yaml:"retry_backoff"`   // 首次重试等待时间，之后每次翻倍（默认 100ms）
+	SpillFile      string        `yaml:"spill_file"`      // 重试仍失败时追加写入的本地文件（JSON Lines，留空不启用）
+	SpillMax       int           `yaml:"spill_max"`       // 溢出文件最多保留的记录数（默认 100000，超出后丢弃新记录）
+	ReplayInterval time.Duration `yaml:"replay_interval"` // 后台重放溢出文件的间隔（默认 30s）
 }
 
 // UsageBuiltinConfig 内置用量存储配置
@@ -299,15 +521,22 @@ type UsageBuiltinConfig struct {
 
 // HealthCheckConfig 健康检查配置
 type HealthCheckConfig struct {
-	Enabled            bool          `yaml:"enabled"`             // 是否启用
-	Interval           time.Duration `yaml:"interval"`            // 检查间隔
-	Timeout            time.Duration `yaml:"timeout"`             // 超时时间
-	Method             string        `yaml:"method"`              // HTTP 方法
-	Path               string        `yaml:"path"`                // 健康检查路径
-	ExpectedStatus     int           `yaml:"expected_status"`     // 期望状态码
-	UnhealthyThreshold int           `yaml:"unhealthy_threshold"` // 不健康阈值
-	HealthyThreshold   int           `yaml:"healthy_threshold"`   // 健康阈值
-	Script             *ScriptConfig `yaml:"script,omitempty"`    // Lua 脚本
+	Enabled            bool              `yaml:"enabled"`             // 是否启用
+	Interval           time.Duration     `yaml:"interval"`            // 检查间隔
+	Timeout            time.Duration     `yaml:"timeout"`             // 超时时间
+	Method             string            `yaml:"method"`              // HTTP 方法（默认 GET，配置了 body 时默认 POST）
+	Path               string            `yaml:"path"`                // 健康检查路径
+	Headers            map[string]string `yaml:"headers"`             // 附加请求头（如 Authorization）
+	Body               string            `yaml:"body"`                // 请求体（如模型服务需要的小型 POST 请求）
+	ExpectedStatus     StatusMatch       `yaml:"expected_status"`     // 期望状态码（200、"200-299" 或 [200, 204]）
+	UnhealthyThreshold int               `yaml:"unhealthy_threshold"` // 不健康阈值
+	HealthyThreshold   int               `yaml:"healthy_threshold"`   // 健康阈值
+	Script             *ScriptConfig     `yaml:"script,omitempty"`    // Lua 脚本
+
+	// 探测方式：http（默认）/ grpc（grpc.health.v1.Health/Check，返回 SERVING 视为健康）
+	Type        string `yaml:"type"`
+	GRPCPort    int    `yaml:"grpc_port"`    // gRPC 健康检查端口（默认使用后端 URL 的端口）
+	GRPCService string `yaml:"grpc_service"` // 检查的服务名（默认为空，表示整个服务器）
 }
 
 // ============================================================
@@ -323,6 +552,73 @@ type RoutingConfig struct {
 	Script         *ScriptConfig  `yaml:"script,omitempty"`
 	Retry          *RetryConfig   `yaml:"retry"`
 	Fallback       []FallbackRule `yaml:"fallback"`
+	ModelRoutes    []ModelRoute   `yaml:"model_routes"` // 按模型路由到后端组
+	DecisionLog    bool           `yaml:"decision_log"` // 输出后端选择原因的调试日志
+
+	ConsistentHash *ConsistentHashConfig `yaml:"consistent_hash"` // 一致性哈希配置（load_balance: consistent_hash 时生效）
+	PeakEWMA       *PeakEWMAConfig       `yaml:"peak_ewma"`       // 峰值 EWMA 配置（load_balance: peak_ewma 时生效）
+	ModelPin       *ModelPinConfig       `yaml:"model_pin"`       // 通过 Prefer 请求头固定上游模型名（不依赖 enabled）
+	ModelFallback  []ModelFallbackRule   `yaml:"model_fallback"`  // 模型在所有后端均不可用时按顺序降级到替代模型（需要 enabled）
+	Hedge          *HedgeConfig          `yaml:"hedge"`           // 对冲请求：首个请求超过延迟仍未响应时向其他后端追加请求（需要 enabled）
+	Mirror         *MirrorConfig         `yaml:"mirror"`          // 流量镜像：按比例把请求异步复制到影子后端（不依赖 enabled）
+	Canary         *CanaryConfig         `yaml:"canary"`          // 金丝雀分流：按比例把匹配的请求固定分流到金丝雀后端（需要 enabled）
+
+	// 负载均衡策略名称无法识别时拒绝启动（默认仅输出警告并回退为轮询）
+	StrictLoadBalance bool `yaml:"strict_load_balance"`
+}
+
+// HedgeConfig 对冲请求配置
+// 仅用于非流式请求：首个请求在 delay 内未返回响应头时，向另一个健康后端追加请求，
+// 采用最先返回的响应并取消其余请求
+type HedgeConfig struct {
+	Enabled          bool          `yaml:"enabled"`            // 是否启用
+	Delay            time.Duration `yaml:"delay"`              // 追加请求前的等待时间（默认 1s）
+	MaxExtraRequests int           `yaml:"max_extra_requests"` // 最多追加的请求数（默认 1）
+}
+
+// MirrorConfig 流量镜像配置
+// 按比例把匹配的请求异步复制到影子后端，丢弃影子响应，客户端始终收到主后端的响应
+type MirrorConfig struct {
+	Enabled    bool          `yaml:"enabled"`    // 是否启用
+	Target     string        `yaml:"target"`     // 影子后端 URL
+	Percentage float64       `yaml:"percentage"` // 镜像比例（0-100）
+	Models     []string      `yaml:"models"`     // 只镜像这些模型（支持 * 后缀通配，为空时镜像所有模型）
+	Timeout    time.Duration `yaml:"timeout"`    // 影子请求超时（默认 60s）
+}
+
+// CanaryConfig 金丝雀分流配置
+// 匹配的请求按哈希 Key（consistent_hash.header / API Key / 客户端 IP）确定性分流，
+// 同一个 Key 始终落在同一侧；金丝雀后端不参与其他请求的负载均衡
+type CanaryConfig struct {
+	Enabled    bool              `yaml:"enabled"`    // 是否启用
+	Backend    string            `yaml:"backend"`    // 金丝雀后端 URL 或名称
+	Percentage float64           `yaml:"percentage"` // 分流到金丝雀后端的比例（0-100）
+	Models     []string          `yaml:"models"`     // 只分流这些模型（支持 * 后缀通配，为空时匹配所有模型）
+	Headers    map[string]string `yaml:"headers"`    // 只分流带有这些请求头的请求（值必须相等，为空时不限制）
+}
+
+// ModelFallbackRule 模型降级规则
+type ModelFallbackRule struct {
+	Models    []string `yaml:"models"`    // 适用的模型（支持 * 后缀通配）
+	Fallbacks []string `yaml:"fallbacks"` // 按顺序尝试的替代模型（改写请求体的 model 字段）
+}
+
+// ModelPinConfig 模型版本固定配置
+// 客户端通过 Prefer: model=<name> 请求头指定确切的上游模型名（如带日期的快照版本），
+// 该名称在 on_request 钩子之后写回请求体的 model 字段，不再被改写
+type ModelPinConfig struct {
+	Allowed []string `yaml:"allowed"` // 允许固定的模型名（支持 * 后缀通配）；为空时忽略 Prefer 请求头
+}
+
+// ConsistentHashConfig 一致性哈希配置
+type ConsistentHashConfig struct {
+	Header       string `yaml:"header"`        // 缓存亲和 Header（存在时优先作为哈希 Key，否则使用 API Key，再否则使用客户端 IP）
+	VirtualNodes int    `yaml:"virtual_nodes"` // 每个权重单位的虚拟节点数（默认 160）
+}
+
+// PeakEWMAConfig 峰值 EWMA 负载均衡配置
+type PeakEWMAConfig struct {
+	Decay time.Duration `yaml:"decay"` // 延迟 EWMA 的衰减时间常数（默认 10s，越小越快反映最近的延迟）
 }
 
 // RetryConfig 重试配置
@@ -335,11 +631,39 @@ type RetryConfig struct {
 	RetryOn     []string      `yaml:"retry_on"` // 重试条件: 5xx, connect_failure, timeout
 }
 
+// ModelRoute 模型路由规则（按顺序匹配，首个匹配生效）
+type ModelRoute struct {
+	Models      []string `yaml:"models"`       // 模型列表（支持 * 后缀通配，如 gpt-4*）
+	Group       string   `yaml:"group"`        // 目标后端组（backends[].group）
+	LoadBalance string   `yaml:"load_balance"` // 该后端组的负载均衡策略（为空时使用 routing.load_balance）
+}
+
+// GroupStrategy 返回后端组使用的负载均衡策略
+// model_routes 中指向该组的规则配置了 load_balance 时使用该策略，否则使用 routing.load_balance
+// 参数：
+//   - group: 后端组名称
+//
+// 返回：
+//   - string: 策略名称（未配置时为空）
+func (r *RoutingConfig) GroupStrategy(group string) string {
+	if r == nil {
+		return ""
+	}
+	for _, route := range r.ModelRoutes {
+		if route.Group == group && route.LoadBalance != "" {
+			return route.LoadBalance
+		}
+	}
+	return r.LoadBalance
+}
+
 // FallbackRule 故障转移规则
 type FallbackRule struct {
 	Models   []string `yaml:"models"`   // 适用的模型列表（空表示所有）
 	Primary  string   `yaml:"primary"`  // 主后端
 	Fallback []string `yaml:"fallback"` // 备用后端列表
+	// 最多尝试的备用后端数量（0 表示不限制），超出后立即返回错误
+	MaxFallbackAttempts int `yaml:"max_fallback_attempts"`
 }
 
 // ============================================================
@@ -348,12 +672,66 @@ type FallbackRule struct {
 
 // AuthConfig 鉴权配置
 type AuthConfig struct {
-	Enabled     bool            `yaml:"enabled"`      // 是否启用鉴权
-	Mode        string          `yaml:"mode"`         // 管道模式：first_match 或 all
-	SkipPaths   []string        `yaml:"skip_paths"`   // 跳过鉴权的路径
-	HeaderNames []string        `yaml:"header_names"` // 自定义认证 Header 名称列表
-	Pipeline    []*AuthProvider `yaml:"pipeline"`     // 鉴权管道配置
-	StatusCodes *StatusCodes    `yaml:"status_codes"` // 状态码配置
+	Enabled      bool              `yaml:"enabled"`       // 是否启用鉴权
+	Mode         string            `yaml:"mode"`          // 管道模式：first_match 或 all
+	SkipPaths    []string          `yaml:"skip_paths"`    // 跳过鉴权的路径（前缀匹配，末尾 "*" 可省略）
+	HeaderNames  []string          `yaml:"header_names"`  // 自定义认证 Header 名称列表（默认 Authorization / X-API-Key / Api-Key）
+	Scheme       string            `yaml:"scheme"`        // Authorization 头的认证方案（默认 Bearer）
+	QueryParam   string            `yaml:"query_param"`   // 从 URL 查询参数读取 Key 的参数名（如 api_key，默认不启用）
+	Pipeline     []*AuthProvider   `yaml:"pipeline"`      // 鉴权管道配置
+	StatusCodes  *StatusCodes      `yaml:"status_codes"`  // 状态码配置
+	QuotaAlerts  *QuotaAlertConfig `yaml:"quota_alerts"`  // 额度阈值告警
+	DefaultQuota *QuotaPolicy      `yaml:"default_quota"` // 全局默认额度（应用于未单独配置额度的静态 Key）
+
+	Audit *AuthAuditConfig `yaml:"audit"` // 鉴权决策审计日志
+}
+
+// AuthAuditConfig 鉴权决策审计日志配置
+// 记录每次鉴权的放行/拒绝决策，独立于请求日志
+type AuthAuditConfig struct {
+	Enabled      bool           `yaml:"enabled"`
+	Output       string         `yaml:"output"`         // file / database（默认 file）
+	File         *LogFileConfig `yaml:"file,omitempty"` // output=file 时的文件路径
+	Storage      string         `yaml:"storage"`        // output=database 时引用 storage.databases[name]
+	Table        string         `yaml:"table"`          // 表名（默认 auth_audit_logs）
+	SampleRate   float64        `yaml:"sample_rate"`    // 放行决策的采样率 (0, 1]，默认 1；拒绝决策始终记录
+	DenyOnly     bool           `yaml:"deny_only"`      // 只记录拒绝决策
+	MaxPerSecond int            `yaml:"max_per_second"` // 每秒最多写入条数（0 表示不限制），超出的丢弃
+}
+
+// QuotaPolicy 额度策略
+type QuotaPolicy struct {
+	TotalQuota       int64  `yaml:"total_quota"`        // 每周期额度（Token）
+	QuotaResetPeriod string `yaml:"quota_reset_period"` // 重置周期: daily / weekly / monthly / never
+	Rollover         bool   `yaml:"rollover"`           // 是否结转未用额度
+	RolloverCap      int64  `yaml:"rollover_cap"`       // 结转上限（0 表示不超过 total_quota）
+}
+
+// Apply 将额度策略应用到未单独配置额度的 Key
+// 参数：
+//   - key: API Key
+func (p *QuotaPolicy) Apply(key *APIKey) {
+	if p == nil || key == nil || key.TotalQuota > 0 {
+		return
+	}
+	key.TotalQuota = p.TotalQuota
+	if key.QuotaResetPeriod == "" {
+		key.QuotaResetPeriod = p.QuotaResetPeriod
+	}
+	if !key.Rollover {
+		key.Rollover = p.Rollover
+	}
+	if key.RolloverCap == 0 {
+		key.RolloverCap = p.RolloverCap
+	}
+}
+
+// QuotaAlertConfig 额度阈值告警配置
+// Key 的已用额度跨过阈值时回调 Webhook，每个阈值在一个重置周期内只触发一次
+type QuotaAlertConfig struct {
+	Enabled    bool                `yaml:"enabled"`    // 是否启用
+	Thresholds []int               `yaml:"thresholds"` // 阈值百分比列表（默认 80, 100）
+	Webhook    *UsageWebhookConfig `yaml:"webhook"`    // 回调 Webhook
 }
 
 // StatusCodeConfig 单个状态码配置
@@ -365,17 +743,20 @@ type StatusCodeConfig struct {
 
 // StatusCodes 状态码配置（可配置错误消息和 HTTP 状态码）
 type StatusCodes struct {
-	Active        *StatusCodeConfig `yaml:"active"`         // 正常状态
-	Disabled      *StatusCodeConfig `yaml:"disabled"`       // 已禁用
-	Expired       *StatusCodeConfig `yaml:"expired"`        // 已过期
-	QuotaExceeded *StatusCodeConfig `yaml:"quota_exceeded"` // 额度耗尽
-	NotFound      *StatusCodeConfig `yaml:"not_found"`      // 不存在
+	Active            *StatusCodeConfig `yaml:"active"`              // 正常状态
+	Disabled          *StatusCodeConfig `yaml:"disabled"`            // 已禁用
+	Expired           *StatusCodeConfig `yaml:"expired"`             // 已过期
+	QuotaExceeded     *StatusCodeConfig `yaml:"quota_exceeded"`      // 额度耗尽
+	DailyCostExceeded *StatusCodeConfig `yaml:"daily_cost_exceeded"` // 当日消费达到上限
+	NotYetActive      *StatusCodeConfig `yaml:"not_yet_active"`      // 尚未到生效时间（starts_at）
+	ModelNotAllowed   *StatusCodeConfig `yaml:"model_not_allowed"`   // 请求的模型不在 Key 的 allowed_models 内
+	NotFound          *StatusCodeConfig `yaml:"not_found"`           // 不存在
 }
 
 // AuthProvider 鉴权提供者配置
 type AuthProvider struct {
 	Name     string              `yaml:"name"`               // Provider 名称
-	Type     string              `yaml:"type"`               // Provider 类型: builtin / redis / database / webhook / lua / static
+	Type     string              `yaml:"type"`               // Provider 类型: builtin / redis / database / webhook / lua / static / oauth2_introspect
 	Enabled  bool                `yaml:"enabled"`            // 是否启用
 	Redis    *RedisAuthConfig    `yaml:"redis,omitempty"`    // Redis 配置
 	Database *DatabaseAuthConfig `yaml:"database,omitempty"` // 数据库配置
@@ -383,6 +764,15 @@ type AuthProvider struct {
 	Lua      *LuaAuthConfig      `yaml:"lua,omitempty"`      // Lua 脚本配置
 	Static   *StaticAuthConfig   `yaml:"static,omitempty"`   // 静态配置
 	Script   *ScriptConfig       `yaml:"script,omitempty"`   // Lua 后处理脚本
+	Cache    *AuthCacheConfig    `yaml:"cache,omitempty"`    // 查询结果缓存
+
+	OAuth2Introspect *OAuth2IntrospectAuthConfig `yaml:"oauth2_introspect,omitempty"` // OAuth2 令牌内省配置
+}
+
+// AuthCacheConfig 鉴权 Provider 缓存配置
+type AuthCacheConfig struct {
+	TTL     time.Duration `yaml:"ttl"`     // 缓存有效期（默认 30s），Key 的修改最多延迟该时长生效
+	Preload bool          `yaml:"preload"` // 启动时批量预加载有效 Key（仅 builtin / database）
 }
 
 // RedisAuthConfig Redis 鉴权配置
@@ -397,6 +787,8 @@ type DatabaseAuthConfig struct {
 	Table     string   `yaml:"table"`      // 表名
 	KeyColumn string   `yaml:"key_column"` // API Key 列名
 	Fields    []string `yaml:"fields"`     // 需要查询的字段列表
+
+	StartsAtColumn string `yaml:"starts_at_column"` // 生效时间列名（默认 starts_at，该列为空时不限制）
 }
 
 // WebhookAuthConfig Webhook 鉴权配置
@@ -407,12 +799,29 @@ type WebhookAuthConfig struct {
 	Headers map[string]string `yaml:"headers"` // 自定义请求头
 }
 
+// OAuth2IntrospectAuthConfig OAuth2 令牌内省（RFC 7662）鉴权配置
+// 把请求携带的不透明访问令牌 POST 到内省端点，active=true 视为找到
+type OAuth2IntrospectAuthConfig struct {
+	Endpoint      string        `yaml:"endpoint"`        // 内省端点 URL
+	ClientID      string        `yaml:"client_id"`       // 客户端 ID（HTTP Basic 认证）
+	ClientSecret  string        `yaml:"client_secret"`   // 客户端密钥
+	TokenTypeHint string        `yaml:"token_type_hint"` // token_type_hint 参数（默认 access_token）
+	Timeout       time.Duration `yaml:"timeout"`         // 超时时间（默认 5s）
+
+	// 内省响应字段到鉴权数据字段的映射，与默认映射合并
+	// 默认: scope -> scope, username -> user_id, exp -> expires_at
+	Fields map[string]string `yaml:"fields"`
+}
+
 // LuaAuthConfig Lua 脚本鉴权配置
 type LuaAuthConfig struct {
 	Path      string        `yaml:"path"`       // 脚本文件路径
 	Script    string        `yaml:"script"`     // 内联脚本
 	Timeout   time.Duration `yaml:"timeout"`    // 超时时间
 	MaxMemory int           `yaml:"max_memory"` // 最大内存 MB
+
+	// require 的模块搜索目录（配置后 require 只能加载这些目录内的 .lua 文件）
+	ModulePath []string `yaml:"module_path"`
 }
 
 // StaticAuthConfig 静态鉴权配置
@@ -429,9 +838,14 @@ type APIKey struct {
 	TotalQuota       int64      `yaml:"total_quota" json:"total_quota"`
 	UsedQuota        int64      `yaml:"used_quota" json:"used_quota"`
 	QuotaResetPeriod string     `yaml:"quota_reset_period" json:"quota_reset_period"`
+	DailyCostLimit   float64    `yaml:"daily_cost_limit" json:"daily_cost_limit"` // 每日消费上限（0 表示不限制，需启用 billing）
+	Rollover         bool       `yaml:"rollover" json:"rollover"`                 // 周期重置时是否结转未用额度
+	RolloverCap      int64      `yaml:"rollover_cap" json:"rollover_cap"`         // 结转上限（0 表示不超过 total_quota）
+	RolloverQuota    int64      `yaml:"rollover_quota" json:"rollover_quota"`     // 本周期从上周期结转的额度
 	LastResetAt      time.Time  `yaml:"last_reset_at" json:"last_reset_at"`
 	AllowedIPs       []string   `yaml:"allowed_ips" json:"allowed_ips"`
 	DeniedIPs        []string   `yaml:"denied_ips" json:"denied_ips"`
+	AllowedModels    []string   `yaml:"allowed_models" json:"allowed_models"` // 允许使用的模型（支持 * 后缀通配，为空表示不限制）
 	ExpiresAt        *time.Time `yaml:"expires_at" json:"expires_at"`
 	CreatedAt        time.Time  `yaml:"created_at" json:"created_at"`
 	UpdatedAt        time.Time  `yaml:"updated_at" json:"updated_at"`
@@ -449,8 +863,26 @@ type RateLimitConfig struct {
 	Script  *ScriptConfig `yaml:"script,omitempty"`
 	Global  *GlobalLimit  `yaml:"global"`
 	PerKey  *KeyLimit     `yaml:"per_key"`
+
+	Algorithm string       `yaml:"algorithm"` // token_bucket（默认）/ sliding_window
+	PerModel  []ModelLimit `yaml:"per_model"` // 模型级限流（与 Key 无关，按顺序匹配，首个匹配生效）
 }
 
+// ModelLimit 模型级限流规则
+// 同一规则匹配的所有模型共享额度
+type ModelLimit struct {
+	Models            []string `yaml:"models"`              // 模型列表（支持 * 后缀通配，如 gpt-4*）
+	RequestsPerSecond int      `yaml:"requests_per_second"` // 每秒请求数（0 表示不限）
+	RequestsPerMinute int      `yaml:"requests_per_minute"` // 每分钟请求数（0 表示不限，仅支持 token_bucket）
+	BurstSize         int      `yaml:"burst_size"`          // 突发容量（默认 requests_per_second 的 2 倍）
+}
+
+// 限流算法
+const (
+	RateLimitTokenBucket   = "token_bucket"   // 令牌桶：允许 burst_size 内的突发
+	RateLimitSlidingWindow = "sliding_window" // 滑动窗口：任意 1 秒内严格不超过 requests_per_second
+)
+
 // GlobalLimit 全局限流配置
 type GlobalLimit struct {
 	Enabled           bool `yaml:"enabled"`
@@ -461,12 +893,13 @@ type GlobalLimit struct {
 
 // KeyLimit Key 级限流配置
 type KeyLimit struct {
-	Enabled           bool  `yaml:"enabled"`
-	RequestsPerSecond int   `yaml:"requests_per_second"`
-	RequestsPerMinute int   `yaml:"requests_per_minute"`
-	TokensPerMinute   int64 `yaml:"tokens_per_minute"`
-	MaxConcurrent     int   `yaml:"max_concurrent"`
-	BurstSize         int   `yaml:"burst_size"`
+	Enabled              bool  `yaml:"enabled"`
+	RequestsPerSecond    int   `yaml:"requests_per_second"`
+	RequestsPerMinute    int   `yaml:"requests_per_minute"`
+	TokensPerMinute      int64 `yaml:"tokens_per_minute"`
+	MaxConcurrent        int   `yaml:"max_concurrent"`
+	MaxConcurrentStreams int   `yaml:"max_concurrent_streams"` // 单个 Key（无 Key 时按 IP）最大并发流式连接数
+	BurstSize            int   `yaml:"burst_size"`
 }
 
 // ============================================================
@@ -486,8 +919,15 @@ type RequestLoggingConfig struct {
 	Storage     string         `yaml:"storage"`      // 引用 storage.databases[name]
 	Table       string         `yaml:"table"`        // 表名（默认 request_logs）
 	IncludeBody bool           `yaml:"include_body"` // 是否记录请求/响应体
+	LogTools    bool           `yaml:"log_tools"`    // 记录请求声明和响应调用的工具名称（不含参数）
 	Script      *ScriptConfig  `yaml:"script,omitempty"`
 	File        *LogFileConfig `yaml:"file,omitempty"`
+
+	// 数据库批量写入
+	BatchSize     int           `yaml:"batch_size"`     // 每批最多写入条数（默认 100）
+	FlushInterval time.Duration `yaml:"flush_interval"` // 未满一批时的最长等待时间（默认 1s）
+	BufferSize    int           `yaml:"buffer_size"`    // 待写入缓冲区大小（默认 10000）
+	BlockOnFull   bool          `yaml:"block_on_full"`  // 缓冲区满时阻塞等待（默认丢弃并记录日志）
 }
 
 // AccessLoggingConfig 访问日志配置
@@ -497,6 +937,8 @@ type AccessLoggingConfig struct {
 	Output  string         `yaml:"output"` // file / stdout
 	Script  *ScriptConfig  `yaml:"script,omitempty"`
 	File    *LogFileConfig `yaml:"file,omitempty"`
+
+	LogDenied bool `yaml:"log_denied"` // 记录被鉴权/限流中间件拒绝的请求（默认 false）
 }
 
 // ============================================================
@@ -509,6 +951,12 @@ type MetricsConfig struct {
 	Path           string    `yaml:"path"` // 指标端点路径
 	CustomLabels   []string  `yaml:"custom_labels"`
 	LatencyBuckets []float64 `yaml:"latency_buckets"`
+
+	// 标签基数控制
+	NormalizePaths bool     `yaml:"normalize_paths"`  // 将路径中的 ID 折叠为 :id
+	BackendLabel   string   `yaml:"backend_label"`    // backend 标签取值: name（默认，未命名时为 URL）/ url / none
+	ModelLabels    []string `yaml:"model_labels"`     // model 标签白名单（支持 * 后缀通配），其余模型记为 other
+	MaxModelLabels int      `yaml:"max_model_labels"` // 未配置白名单时最多记录的不同模型数（默认 50），超出记为 other
 }
 
 // ============================================================
@@ -524,6 +972,32 @@ type HooksConfig struct {
 	OnResponse *ScriptConfig `yaml:"on_response,omitempty"`
 	OnError    *ScriptConfig `yaml:"on_error,omitempty"`
 	OnComplete *ScriptConfig `yaml:"on_complete,omitempty"`
+
+	// on_request 修改请求体后，请求日志记录修改前的原始请求体（默认记录实际发往后端的请求体）
+	LogOriginalBody bool `yaml:"log_original_body"`
+
+	// 钩子脚本 require 的模块搜索目录（配置后 require 只能加载这些目录内的 .lua 文件）
+	ModulePath []string `yaml:"module_path"`
+}
+
+// ============================================================
+//                    计费配置
+// ============================================================
+
+// BillingConfig 计费配置
+// 按模型价格计算请求费用，用于 Key 元数据中 daily_cost_limit 的每日消费上限
+type BillingConfig struct {
+	Enabled  bool          `yaml:"enabled"`  // 是否启用
+	Redis    string        `yaml:"redis"`    // 引用 storage.caches 中的 Redis（为空时使用进程内计数）
+	Timezone string        `yaml:"timezone"` // 每日重置所用时区（如 Asia/Shanghai，默认本地时区）
+	Pricing  []*ModelPrice `yaml:"pricing"`  // 模型价格列表（按顺序匹配）
+}
+
+// ModelPrice 模型价格（每 1K token）
+type ModelPrice struct {
+	Model      string  `yaml:"model"`      // 模型名（支持 * 后缀通配，如 gpt-4*）
+	Prompt     float64 `yaml:"prompt"`     // 输入价格 / 1K token
+	Completion float64 `yaml:"completion"` // 输出价格 / 1K token
 }
 
 // ============================================================
@@ -549,6 +1023,26 @@ type AdminConfig struct {
 	Token   string `yaml:"token"`   // 访问令牌
 	Listen  string `yaml:"listen"`  // 监听地址（可选，默认与主服务同端口）
 	DBPath  string `yaml:"db_path"` // SQLite 数据库路径（默认 ./data/keys.db）
+
+	KeyPrefix string `yaml:"key_prefix"` // 自动生成 Key 的前缀（默认 sk-llmproxy-）
+	KeyLength int    `yaml:"key_length"` // 自动生成 Key 的随机部分长度（默认 32，范围 16 ~ 128）
+
+	HashKeys             bool `yaml:"hash_keys"`              // 以 SHA-256 哈希存储 Key（查询同时兼容明文记录）
+	MigratePlaintextKeys bool `yaml:"migrate_plaintext_keys"` // 启动时将已有明文 Key 转为哈希（需开启 hash_keys）
+
+	// 错误 Token 锁定（按来源 IP）
+	LockoutThreshold int           `yaml:"lockout_threshold"` // 窗口内允许的错误次数（默认 5）
+	LockoutWindow    time.Duration `yaml:"lockout_window"`    // 错误计数窗口（默认 5m）
+	LockoutDuration  time.Duration `yaml:"lockout_duration"`  // 锁定时长（默认 15m）
+
+	Events *KeyEventConfig `yaml:"events"` // Key 生命周期事件 Webhook
+}
+
+// KeyEventConfig Key 生命周期事件配置
+// Key 被创建、更新、删除或额度耗尽时异步回调 Webhook
+type KeyEventConfig struct {
+	Enabled bool                `yaml:"enabled"` // 是否启用
+	Webhook *UsageWebhookConfig `yaml:"webhook"` // 回调 Webhook（配置 webhook.secret 时签名）
 }
 
 // Config 主配置结构
@@ -567,6 +1061,9 @@ type Config struct {
 	Metrics     *MetricsConfig     `yaml:"metrics"`      // 指标配置
 	Usage       *UsageConfig       `yaml:"usage"`        // 用量上报配置
 	Hooks       *HooksConfig       `yaml:"hooks"`        // 生命周期钩子
+	Billing     *BillingConfig     `yaml:"billing"`      // 计费配置（每日消费上限）
+	Upstream    *UpstreamConfig    `yaml:"upstream"`     // 发往后端的请求头
+	Tracing     *TracingConfig     `yaml:"tracing"`      // 分布式追踪
 
 	// 兼容旧配置（已废弃）
 	Listen string `yaml:"listen"` // 已废弃，请使用 server.listen
@@ -601,6 +1098,9 @@ func Load(path string) (*Config, error) {
 		return nil, fmt.Errorf("解析配置文件失败: %w", err)
 	}
 
+	// 展开字符串中的环境变量引用（${VAR} / ${VAR:-default}，$$ 转义为 $）
+	expandEnvInValue(reflect.ValueOf(&cfg))
+
 	// 设置服务器默认值
 	if cfg.Server == nil {
 		cfg.Server = &ServerConfig{}
@@ -623,6 +1123,15 @@ func Load(path string) (*Config, error) {
 	if cfg.Server.MaxBodySize == 0 {
 		cfg.Server.MaxBodySize = 10 << 20 // 10MB
 	}
+	if cfg.Server.StreamMismatch == "" {
+		cfg.Server.StreamMismatch = StreamMismatchJSON
+	}
+	if cfg.Server.Readiness == nil {
+		cfg.Server.Readiness = &ReadinessConfig{}
+	}
+	if cfg.Server.Readiness.MinHealthyBackends == 0 {
+		cfg.Server.Readiness.MinHealthyBackends = 1
+	}
 
 	// 设置日志默认值
 	if cfg.Log == nil {
@@ -651,9 +1160,12 @@ func Load(path string) (*Config, error) {
 		}
 		if cfg.HealthCheck.Method == "" {
 			cfg.HealthCheck.Method = "GET"
+			if cfg.HealthCheck.Body != "" {
+				cfg.HealthCheck.Method = "POST"
+			}
 		}
-		if cfg.HealthCheck.ExpectedStatus == 0 {
-			cfg.HealthCheck.ExpectedStatus = 200
+		if cfg.HealthCheck.ExpectedStatus.IsZero() {
+			cfg.HealthCheck.ExpectedStatus, _ = ParseStatusMatch("200")
 		}
 		if cfg.HealthCheck.UnhealthyThreshold == 0 {
 			cfg.HealthCheck.UnhealthyThreshold = 3
@@ -711,9 +1223,32 @@ func Load(path string) (*Config, error) {
 		if cfg.Auth.StatusCodes.QuotaExceeded == nil {
 			cfg.Auth.StatusCodes.QuotaExceeded = &StatusCodeConfig{Allow: false, HttpCode: 429, Message: "额度已用尽，请充值"}
 		}
+		if cfg.Auth.StatusCodes.DailyCostExceeded == nil {
+			cfg.Auth.StatusCodes.DailyCostExceeded = &StatusCodeConfig{Allow: false, HttpCode: 402, Message: "今日消费已达上限"}
+		}
+		if cfg.Auth.StatusCodes.NotYetActive == nil {
+			cfg.Auth.StatusCodes.NotYetActive = &StatusCodeConfig{Allow: false, HttpCode: 403, Message: "API Key 尚未生效"}
+		}
+		if cfg.Auth.StatusCodes.ModelNotAllowed == nil {
+			cfg.Auth.StatusCodes.ModelNotAllowed = &StatusCodeConfig{Allow: false, HttpCode: 403, Message: "当前 API Key 无权使用该模型"}
+		}
 		if cfg.Auth.StatusCodes.NotFound == nil {
 			cfg.Auth.StatusCodes.NotFound = &StatusCodeConfig{Allow: false, HttpCode: 401, Message: "无效的 API Key"}
 		}
+		if cfg.Auth.QuotaAlerts != nil && len(cfg.Auth.QuotaAlerts.Thresholds) == 0 {
+			cfg.Auth.QuotaAlerts.Thresholds = []int{80, 100}
+		}
+		// 全局默认额度应用到静态 Key
+		if cfg.Auth.DefaultQuota != nil {
+			for _, p := range cfg.Auth.Pipeline {
+				if p == nil || p.Static == nil {
+					continue
+				}
+				for _, key := range p.Static.Keys {
+					cfg.Auth.DefaultQuota.Apply(key)
+				}
+			}
+		}
 	}
 
 	// Admin API 配置默认值
@@ -721,6 +1256,12 @@ func Load(path string) (*Config, error) {
 		if cfg.Admin.DBPath == "" {
 			cfg.Admin.DBPath = "./data/keys.db"
 		}
+		if cfg.Admin.KeyPrefix == "" {
+			cfg.Admin.KeyPrefix = "sk-llmproxy-"
+		}
+		if cfg.Admin.KeyLength == 0 {
+			cfg.Admin.KeyLength = 32
+		}
 	}
 
 	// 限流配置默认值
@@ -0,0 +1,99 @@
+package config
+
+import (
+	"os"
+	"reflect"
+	"strings"
+)
+
+// expandEnv 展开字符串中的环境变量引用
+// 支持的语法：
+//   - ${VAR}: 替换为环境变量 VAR 的值，未设置时为空字符串
+//   - ${VAR:-default}: VAR 未设置或为空时使用 default
+//   - $$: 转义为单个 $
+//
+// 参数：
+//   - s: 原始字符串
+//
+// 返回：
+//   - string: 展开后的字符串
+func expandEnv(s string) string {
+	if !strings.Contains(s, "$") {
+		return s
+	}
+
+	var sb strings.Builder
+	for i := 0; i < len(s); i++ {
+		if s[i] != '$' || i+1 >= len(s) {
+			sb.WriteByte(s[i])
+			continue
+		}
+
+		switch s[i+1] {
+		case '$':
+			sb.WriteByte('$')
+			i++
+		case '{':
+			end := strings.IndexByte(s[i+2:], '}')
+			if end < 0 {
+				// 未闭合，按原样保留
+				sb.WriteString(s[i:])
+				return sb.String()
+			}
+			sb.WriteString(lookupEnv(s[i+2 : i+2+end]))
+			i += end + 2
+		default:
+			sb.WriteByte('$')
+		}
+	}
+	return sb.String()
+}
+
+// lookupEnv 解析 "VAR" 或 "VAR:-default" 表达式并返回值
+func lookupEnv(expr string) string {
+	name, def, hasDefault := strings.Cut(expr, ":-")
+	value, ok := os.LookupEnv(name)
+	if hasDefault && (!ok || value == "") {
+		return def
+	}
+	return value
+}
+
+// expandEnvInValue 递归展开结构体中所有字符串字段的环境变量引用
+// 参数：
+//   - v: 待处理的反射值（需可寻址）
+func expandEnvInValue(v reflect.Value) {
+	switch v.Kind() {
+	case reflect.Ptr, reflect.Interface:
+		if !v.IsNil() {
+			expandEnvInValue(v.Elem())
+		}
+	case reflect.Struct:
+		for i := 0; i < v.NumField(); i++ {
+			if v.Type().Field(i).IsExported() {
+				expandEnvInValue(v.Field(i))
+			}
+		}
+	case reflect.Slice, reflect.Array:
+		for i := 0; i < v.Len(); i++ {
+			expandEnvInValue(v.Index(i))
+		}
+	case reflect.Map:
+		if v.Type().Elem().Kind() != reflect.String {
+			for _, key := range v.MapKeys() {
+				elem := v.MapIndex(key)
+				if elem.Kind() == reflect.Ptr || elem.Kind() == reflect.Interface {
+					expandEnvInValue(elem)
+				}
+			}
+			return
+		}
+		for _, key := range v.MapKeys() {
+			v.SetMapIndex(key, reflect.ValueOf(expandEnv(v.MapIndex(key).String())).Convert(v.Type().Elem()))
+		}
+	case reflect.String:
+		if v.CanSet() {
+			v.SetString(expandEnv(v.String()))
+		}
+	}
+}
@@ -0,0 +1,110 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestExpandEnv(t *testing.T) {
+	t.Setenv("LLMPROXY_TEST_SET", "value")
+	t.Setenv("LLMPROXY_TEST_EMPTY", "")
+
+	tests := []struct {
+		name string
+		in   string
+		want string
+	}{
+		{"无引用", "plain", "plain"},
+		{"已设置", "${LLMPROXY_TEST_SET}", "value"},
+		{"嵌入字符串", "redis://${LLMPROXY_TEST_SET}:6379/0", "redis://value:6379/0"},
+		{"未设置无默认值", "${LLMPROXY_TEST_MISSING}", ""},
+		{"未设置使用默认值", "${LLMPROXY_TEST_MISSING:-fallback}", "fallback"},
+		{"空值使用默认值", "${LLMPROXY_TEST_EMPTY:-fallback}", "fallback"},
+		{"已设置忽略默认值", "${LLMPROXY_TEST_SET:-fallback}", "value"},
+		{"默认值为空", "${LLMPROXY_TEST_MISSING:-}", ""},
+		{"转义", "$${LLMPROXY_TEST_SET}", "${LLMPROXY_TEST_SET}"},
+		{"双美元", "cost: $$5", "cost: $5"},
+		{"单独的美元符号", "$5 and $", "$5 and $"},
+		{"未闭合", "${LLMPROXY_TEST_SET", "${LLMPROXY_TEST_SET"},
+		{"多个引用", "${LLMPROXY_TEST_SET}-${LLMPROXY_TEST_MISSING:-x}", "value-x"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := expandEnv(tt.in); got != tt.want {
+				t.Errorf("expandEnv(%q) = %q, want %q", tt.in, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestExpandEnvInValue(t *testing.T) {
+	t.Setenv("LLMPROXY_TEST_TOKEN", "secret")
+
+	type inner struct {
+		Token   string
+		Headers map[string]string
+	}
+	type outer struct {
+		Name    string
+		Inner   *inner
+		List    []string
+		Items   []*inner
+		ByName  map[string]*inner
+		private string
+	}
+
+	v := &outer{
+		Name:    "${LLMPROXY_TEST_TOKEN}",
+		Inner:   &inner{Token: "Bearer ${LLMPROXY_TEST_TOKEN}", Headers: map[string]string{"X": "${LLMPROXY_TEST_TOKEN}"}},
+		List:    []string{"${LLMPROXY_TEST_MISSING:-a}", "b"},
+		Items:   []*inner{{Token: "${LLMPROXY_TEST_TOKEN}"}},
+		ByName:  map[string]*inner{"k": {Token: "${LLMPROXY_TEST_TOKEN}"}},
+		private: "${LLMPROXY_TEST_TOKEN}",
+	}
+	expandEnvInValue(reflect.ValueOf(v))
+
+	want := &outer{
+		Name:    "secret",
+		Inner:   &inner{Token: "Bearer secret", Headers: map[string]string{"X": "secret"}},
+		List:    []string{"a", "b"},
+		Items:   []*inner{{Token: "secret"}},
+		ByName:  map[string]*inner{"k": {Token: "secret"}},
+		private: "${LLMPROXY_TEST_TOKEN}",
+	}
+	if !reflect.DeepEqual(v, want) {
+		t.Errorf("expandEnvInValue() = %+v, want %+v", v, want)
+	}
+}
+
+func TestLoadExpandsEnv(t *testing.T) {
+	t.Setenv("LLMPROXY_TEST_LISTEN", ":9999")
+	t.Setenv("LLMPROXY_TEST_BACKEND", "http://10.0.0.1:8000")
+
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	data := `
+server:
+  listen: "${LLMPROXY_TEST_LISTEN}"
+backends:
+  - name: "${LLMPROXY_TEST_NAME:-vllm}"
+    url: "${LLMPROXY_TEST_BACKEND}"
+`
+	if err := os.WriteFile(path, []byte(data), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	cfg, err := Load(path)
+	if err != nil {
+		t.Fatalf("Load() error = %v", err)
+	}
+	if cfg.Server.Listen != ":9999" {
+		t.Errorf("server.listen = %q, want %q", cfg.Server.Listen, ":9999")
+	}
+	if len(cfg.Backends) != 1 {
+		t.Fatalf("len(backends) = %d, want 1", len(cfg.Backends))
+	}
+	if cfg.Backends[0].Name != "vllm" || cfg.Backends[0].URL != "http://10.0.0.1:8000" {
+		t.Errorf("backend = %+v", cfg.Backends[0])
+	}
+}
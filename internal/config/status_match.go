@@ -0,0 +1,125 @@
+package config
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// StatusMatch HTTP 状态码匹配规则
+// 支持单个状态码（200）、范围（"200-299"）、逗号分隔的列表（"200,204,300-399"）或 YAML 列表（[200, 204]）
+type StatusMatch struct {
+	raw    string   // 原始配置（用于输出生效配置）
+	ranges [][2]int // 闭区间列表
+}
+
+// ParseStatusMatch 解析状态码匹配规则
+// 参数：
+//   - s: 规则字符串（如 "200"、"200-299"、"200,204"）
+//
+// 返回：
+//   - StatusMatch: 匹配规则
+//   - error: 格式无效时返回错误
+func ParseStatusMatch(s string) (StatusMatch, error) {
+	m := StatusMatch{raw: strings.TrimSpace(s)}
+	for _, part := range strings.Split(s, ",") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+		lo, hi, isRange := strings.Cut(part, "-")
+		from, err := parseStatusCode(lo)
+		if err != nil {
+			return StatusMatch{}, err
+		}
+		to := from
+		if isRange {
+			if to, err = parseStatusCode(hi); err != nil {
+				return StatusMatch{}, err
+			}
+			if to < from {
+				return StatusMatch{}, fmt.Errorf("无效的状态码范围 %q", part)
+			}
+		}
+		m.ranges = append(m.ranges, [2]int{from, to})
+	}
+	if len(m.ranges) == 0 {
+		return StatusMatch{}, fmt.Errorf("状态码规则不能为空")
+	}
+	return m, nil
+}
+
+// parseStatusCode 解析单个状态码（100-599）
+func parseStatusCode(s string) (int, error) {
+	code, err := strconv.Atoi(strings.TrimSpace(s))
+	if err != nil || code < 100 || code > 599 {
+		return 0, fmt.Errorf("无效的状态码 %q", s)
+	}
+	return code, nil
+}
+
+// IsZero 是否未配置
+func (m StatusMatch) IsZero() bool {
+	return len(m.ranges) == 0
+}
+
+// Match 检查状态码是否匹配
+// 参数：
+//   - code: HTTP 状态码
+//
+// 返回：
+//   - bool: 是否匹配（未配置时不匹配任何状态码）
+func (m StatusMatch) Match(code int) bool {
+	for _, r := range m.ranges {
+		if code >= r[0] && code <= r[1] {
+			return true
+		}
+	}
+	return false
+}
+
+// String 返回原始规则
+func (m StatusMatch) String() string {
+	return m.raw
+}
+
+// UnmarshalYAML 从整数、字符串或列表解析
+func (m *StatusMatch) UnmarshalYAML(node *yaml.Node) error {
+	var s string
+	switch node.Kind {
+	case yaml.ScalarNode:
+		s = node.Value
+	case yaml.SequenceNode:
+		parts := make([]string, 0, len(node.Content))
+		for _, item := range node.Content {
+			if item.Kind != yaml.ScalarNode {
+				return fmt.Errorf("第 %d 行: expected_status 列表只能包含状态码或范围", item.Line)
+			}
+			parts = append(parts, item.Value)
+		}
+		s = strings.Join(parts, ",")
+	default:
+		return fmt.Errorf("第 %d 行: 无效的状态码规则", node.Line)
+	}
+	if strings.TrimSpace(s) == "" {
+		*m = StatusMatch{}
+		return nil
+	}
+
+	parsed, err := ParseStatusMatch(s)
+	if err != nil {
+		return fmt.Errorf("第 %d 行: %w", node.Line, err)
+	}
+	*m = parsed
+	return nil
+}
+
+// MarshalYAML 输出原始规则（单个状态码输出为整数）
+func (m StatusMatch) MarshalYAML() (interface{}, error) {
+	if code, err := strconv.Atoi(m.raw); err == nil {
+		return code, nil
+	}
+	return m.raw, nil
+}
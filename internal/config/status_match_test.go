@@ -0,0 +1,118 @@
+package config
+
+import (
+	"strings"
+	"testing"
+
+	"gopkg.in/yaml.v3"
+)
+
+func TestParseStatusMatch(t *testing.T) {
+	tests := []struct {
+		rule    string
+		match   []int
+		noMatch []int
+		wantErr bool
+	}{
+		{rule: "200", match: []int{200}, noMatch: []int{201, 199}},
+		{rule: "200-299", match: []int{200, 204, 299}, noMatch: []int{199, 300}},
+		{rule: "200, 204, 300-399", match: []int{200, 204, 302}, noMatch: []int{201, 400}},
+		{rule: "", wantErr: true},
+		{rule: "ok", wantErr: true},
+		{rule: "99", wantErr: true},
+		{rule: "299-200", wantErr: true},
+		{rule: "200-", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.rule, func(t *testing.T) {
+			m, err := ParseStatusMatch(tt.rule)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ParseStatusMatch(%q) error = %v, wantErr %v", tt.rule, err, tt.wantErr)
+			}
+			for _, code := range tt.match {
+				if !m.Match(code) {
+					t.Errorf("Match(%d) = false", code)
+				}
+			}
+			for _, code := range tt.noMatch {
+				if m.Match(code) {
+					t.Errorf("Match(%d) = true", code)
+				}
+			}
+		})
+	}
+
+	// 未配置时不匹配任何状态码
+	var zero StatusMatch
+	if !zero.IsZero() || zero.Match(200) {
+		t.Error("zero StatusMatch: IsZero() = false or Match(200) = true")
+	}
+}
+
+func TestStatusMatchYAML(t *testing.T) {
+	tests := []struct {
+		name    string
+		yaml    string
+		match   int
+		noMatch int
+		out     string // 重新输出的 YAML
+	}{
+		{"整数", "expected_status: 204", 204, 200, "expected_status: 204"},
+		{"范围字符串", `expected_status: "200-299"`, 250, 300, "expected_status: 200-299"},
+		{"列表", "expected_status: [200, 204]", 204, 201, "expected_status: 200,204"},
+		{"列表中的范围", `expected_status: [200, "300-399"]`, 302, 204, "expected_status: 200,300-399"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var cfg struct {
+				ExpectedStatus StatusMatch `yaml:"expected_status"`
+			}
+			if err := yaml.Unmarshal([]byte(tt.yaml), &cfg); err != nil {
+				t.Fatalf("Unmarshal() error = %v", err)
+			}
+			if !cfg.ExpectedStatus.Match(tt.match) || cfg.ExpectedStatus.Match(tt.noMatch) {
+				t.Errorf("Match(%d) / Match(%d) = %v / %v", tt.match, tt.noMatch, cfg.ExpectedStatus.Match(tt.match), cfg.ExpectedStatus.Match(tt.noMatch))
+			}
+			out, err := yaml.Marshal(cfg)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := strings.TrimSpace(string(out)); got != tt.out {
+				t.Errorf("Marshal() = %q, want %q", got, tt.out)
+			}
+		})
+	}
+
+	for _, bad := range []string{"expected_status: abc", "expected_status: {code: 200}", "expected_status: [[200]]"} {
+		var cfg struct {
+			ExpectedStatus StatusMatch `yaml:"expected_status"`
+		}
+		if err := yaml.Unmarshal([]byte(bad), &cfg); err == nil {
+			t.Errorf("Unmarshal(%q) error = nil", bad)
+		}
+	}
+}
+
+func TestHealthCheckDefaults(t *testing.T) {
+	tests := []struct {
+		name       string
+		extra      string
+		wantMethod string
+		wantMatch  int
+	}{
+		{"默认 GET 和 200", "", "GET", 200},
+		{"配置了 body 时默认 POST", "  body: '{\"model\":\"m\"}'\n", "POST", 200},
+		{"显式方法和状态码范围", "  method: HEAD\n  expected_status: \"200-299\"\n", "HEAD", 204},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := loadTestConfig(t, validTestConfig+"health_check:\n  enabled: true\n"+tt.extra)
+			if cfg.HealthCheck.Method != tt.wantMethod {
+				t.Errorf("Method = %q, want %q", cfg.HealthCheck.Method, tt.wantMethod)
+			}
+			if !cfg.HealthCheck.ExpectedStatus.Match(tt.wantMatch) {
+				t.Errorf("ExpectedStatus = %q, want a match for %d", cfg.HealthCheck.ExpectedStatus, tt.wantMatch)
+			}
+		})
+	}
+}
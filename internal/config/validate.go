@@ -0,0 +1,786 @@
+package config
+
+import (
+	"fmt"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+
+	lua "github.com/yuin/gopher-lua"
+	"github.com/yuin/gopher-lua/parse"
+)
+
+// Validate 对配置进行结构与语义校验
+// 检查项包括：存储引用是否存在、限流 Redis 缓存是否存在、
+// Lua 脚本能否编译、故障转移规则引用的后端是否存在等
+//
+// 返回：
+//   - []error: 所有校验错误，为空表示配置有效
+func (c *Config) Validate() []error {
+	v := &validator{cfg: c}
+
+	v.validateServer()
+	v.validateAdmin()
+	v.validateMetrics()
+	v.validateStorage()
+	v.validateBackends()
+	v.validateDiscovery()
+	v.validateAuth()
+	v.validateRateLimit()
+	v.validateRouting()
+	v.validateLogging()
+	v.validateUsage()
+	v.validateHooks()
+	v.validateBilling()
+	v.validateTracing()
+	if c.HealthCheck != nil {
+		v.checkScript("health_check.script", c.HealthCheck.Script)
+		switch c.HealthCheck.Type {
+		case "", "http", "grpc":
+		default:
+			v.addf("health_check.type: 不支持的探测方式 %q（可选 http / grpc）", c.HealthCheck.Type)
+		}
+		if c.HealthCheck.GRPCPort < 0 || c.HealthCheck.GRPCPort > 65535 {
+			v.addf("health_check.grpc_port: 无效的端口 %d", c.HealthCheck.GRPCPort)
+		}
+	}
+
+	return v.errs
+}
+
+// validator 配置校验器，收集所有错误而非遇错即停
+type validator struct {
+	cfg  *Config
+	errs []error
+}
+
+// addf 记录一条校验错误
+func (v *validator) addf(format string, args ...interface{}) {
+	v.errs = append(v.errs, fmt.Errorf(format, args...))
+}
+
+// validateStorage 校验存储连接配置
+func (v *validator) validateStorage() {
+	if v.cfg.Storage == nil {
+		return
+	}
+	names := make(map[string]bool)
+	for i, db := range v.cfg.Storage.Databases {
+		field := fmt.Sprintf("storage.databases[%d]", i)
+		if db == nil {
+			continue
+		}
+		if db.Name == "" {
+			v.addf("%s: name 不能为空", field)
+		} else if names[db.Name] {
+			v.addf("%s: 数据库连接名称重复: %s", field, db.Name)
+		}
+		names[db.Name] = true
+		switch db.Driver {
+		case "mysql", "postgres", "sqlite":
+		default:
+			v.addf("%s: 不支持的数据库驱动: %q", field, db.Driver)
+		}
+		v.checkReadReplica(field, db)
+	}
+
+	if hc := v.cfg.Storage.HealthCheck; hc != nil && hc.Enabled {
+		if hc.Interval < 0 {
+			v.addf("storage.health_check.interval 不能为负数")
+		}
+		if hc.Timeout < 0 {
+			v.addf("storage.health_check.timeout 不能为负数")
+		}
+		if hc.Interval > 0 && hc.Timeout > hc.Interval {
+			v.addf("storage.health_check.timeout 不能大于 interval")
+		}
+	}
+
+	names = make(map[string]bool)
+	for i, cache := range v.cfg.Storage.Caches {
+		field := fmt.Sprintf("storage.caches[%d]", i)
+		if cache == nil {
+			continue
+		}
+		if cache.Name == "" {
+			v.addf("%s: name 不能为空", field)
+		} else if names[cache.Name] {
+			v.addf("%s: 缓存连接名称重复: %s", field, cache.Name)
+		}
+		names[cache.Name] = true
+		if cache.Driver == "redis" {
+			v.checkRedisMode(field, cache)
+		}
+	}
+}
+
+// checkRedisMode 校验 Redis 部署模式及对应的地址配置
+func (v *validator) checkRedisMode(field string, cache *CacheConnection) {
+	switch cache.GetMode() {
+	case RedisModeStandalone:
+		if cache.Addr == "" {
+			v.addf("%s: Redis 地址 addr 不能为空", field)
+		}
+	case RedisModeSentinel:
+		if cache.MasterName == "" {
+			v.addf("%s: sentinel 模式需要配置 master_name", field)
+		}
+		if len(cache.GetAddrs()) == 0 {
+			v.addf("%s: sentinel 模式需要配置 addrs（Sentinel 地址）", field)
+		}
+	case RedisModeCluster:
+		if len(cache.GetAddrs()) == 0 {
+			v.addf("%s: cluster 模式需要配置 addrs（集群节点地址）", field)
+		}
+		if cache.DB != 0 {
+			v.addf("%s: cluster 模式不支持 db（只能使用 0 号库）", field)
+		}
+	default:
+		v.addf("%s: 不支持的 Redis 模式 %q（可选 standalone / sentinel / cluster）", field, cache.Mode)
+	}
+}
+
+// validateBackends 校验静态后端配置
+func (v *validator) validateBackends() {
+	for i, b := range v.cfg.Backends {
+		field := fmt.Sprintf("backends[%d]", i)
+		if b == nil {
+			continue
+		}
+		if b.URL == "" {
+			v.addf("%s: url 不能为空", field)
+			continue
+		}
+		if u, err := url.Parse(b.URL); err != nil || u.Scheme == "" || u.Host == "" {
+			v.addf("%s: 无效的 url: %s", field, b.URL)
+		}
+		if b.RateLimit != nil {
+			if b.RateLimit.RequestsPerSecond <= 0 {
+				v.addf("%s.rate_limit.requests_per_second 必须大于 0", field)
+			}
+			if b.RateLimit.BurstSize < 0 {
+				v.addf("%s.rate_limit.burst_size 不能为负数", field)
+			}
+		}
+	}
+}
+
+// validateDiscovery 校验服务发现配置
+func (v *validator) validateDiscovery() {
+	if v.cfg.Discovery == nil || !v.cfg.Discovery.Enabled {
+		return
+	}
+	for i, source := range v.cfg.Discovery.Sources {
+		if source == nil || !source.Enabled {
+			continue
+		}
+		field := fmt.Sprintf("discovery.sources[%d]", i)
+		if source.Type == "database" {
+			if source.Database == nil {
+				v.addf("%s: 缺少 database 配置", field)
+			} else {
+				v.checkDatabaseRef(field+".database.storage", source.Database.Storage)
+			}
+		}
+		v.checkScript(field+".script", source.Script)
+	}
+}
+
+// validateAuth 校验鉴权配置
+func (v *validator) validateAuth() {
+	if v.cfg.Auth == nil || !v.cfg.Auth.Enabled {
+		return
+	}
+	switch v.cfg.Auth.Mode {
+	case "", "first_match", "all":
+	default:
+		v.addf("auth.mode: 不支持的管道模式: %q", v.cfg.Auth.Mode)
+	}
+	for i, p := range v.cfg.Auth.Pipeline {
+		if p == nil || !p.Enabled {
+			continue
+		}
+		field := fmt.Sprintf("auth.pipeline[%d]", i)
+		switch p.Type {
+		case "redis":
+			if p.Redis == nil {
+				v.addf("%s: 缺少 redis 配置", field)
+			} else {
+				v.checkCacheRef(field+".redis.storage", p.Redis.Storage)
+			}
+		case "database":
+			if p.Database == nil {
+				v.addf("%s: 缺少 database 配置", field)
+			} else {
+				v.checkDatabaseRef(field+".database.storage", p.Database.Storage)
+			}
+		case "lua":
+			if p.Lua == nil {
+				v.addf("%s: 缺少 lua 配置", field)
+			} else {
+				v.checkLua(field+".lua", p.Lua.Script, p.Lua.Path)
+				v.checkModulePath(field+".lua.module_path", p.Lua.ModulePath)
+			}
+		case "oauth2_introspect":
+			if p.OAuth2Introspect == nil || p.OAuth2Introspect.Endpoint == "" {
+				v.addf("%s: 缺少 oauth2_introspect.endpoint", field)
+			} else if p.OAuth2Introspect.Timeout < 0 {
+				v.addf("%s.oauth2_introspect.timeout: 不能为负数，当前为 %v", field, p.OAuth2Introspect.Timeout)
+			}
+		}
+		v.checkScript(field+".script", p.Script)
+		if c := p.Cache; c != nil {
+			if c.TTL < 0 {
+				v.addf("%s.cache.ttl: 不能为负数，当前为 %v", field, c.TTL)
+			}
+			if c.Preload && p.Type != "builtin" && p.Type != "database" {
+				v.addf("%s.cache.preload: 仅 builtin / database 类型支持预加载，当前为 %q", field, p.Type)
+			}
+		}
+	}
+	if a := v.cfg.Auth.Audit; a != nil && a.Enabled {
+		switch a.Output {
+		case "", "file":
+			if a.File == nil || a.File.Path == "" {
+				v.addf("auth.audit.file.path: output 为 file 时必须配置")
+			}
+			v.checkLogFile("auth.audit.file", a.File)
+		case "database":
+			v.checkDatabaseRef("auth.audit.storage", a.Storage)
+		default:
+			v.addf("auth.audit.output: 不支持的取值 %q（可选 file / database）", a.Output)
+		}
+		if a.SampleRate < 0 || a.SampleRate > 1 {
+			v.addf("auth.audit.sample_rate: 必须在 0 到 1 之间，当前为 %v", a.SampleRate)
+		}
+		if a.MaxPerSecond < 0 {
+			v.addf("auth.audit.max_per_second: 不能为负数，当前为 %d", a.MaxPerSecond)
+		}
+	}
+	if qa := v.cfg.Auth.QuotaAlerts; qa != nil && qa.Enabled {
+		if qa.Webhook == nil || qa.Webhook.URL == "" {
+			v.addf("auth.quota_alerts.webhook.url: 未配置回调地址")
+		}
+		for i, t := range qa.Thresholds {
+			if t <= 0 {
+				v.addf("auth.quota_alerts.thresholds[%d]: 阈值必须大于 0: %d", i, t)
+			}
+		}
+	}
+	if dq := v.cfg.Auth.DefaultQuota; dq != nil {
+		switch dq.QuotaResetPeriod {
+		case "", "daily", "weekly", "monthly", "never":
+		default:
+			v.addf("auth.default_quota.quota_reset_period: 不支持的重置周期: %q", dq.QuotaResetPeriod)
+		}
+		if dq.TotalQuota < 0 || dq.RolloverCap < 0 {
+			v.addf("auth.default_quota: total_quota 和 rollover_cap 不能为负数")
+		}
+	}
+}
+
+// validateRateLimit 校验限流配置
+func (v *validator) validateRateLimit() {
+	rl := v.cfg.RateLimit
+	if rl == nil || !rl.Enabled {
+		return
+	}
+	switch rl.Storage {
+	case "", "memory":
+	case "redis":
+		cacheName := rl.Redis
+		if cacheName == "" {
+			cacheName = "default"
+		}
+		v.checkCacheRef("rate_limit.redis", cacheName)
+	default:
+		v.addf("rate_limit.storage: 不支持的存储方式: %q", rl.Storage)
+	}
+	switch rl.Algorithm {
+	case "", RateLimitTokenBucket, RateLimitSlidingWindow:
+	default:
+		v.addf("rate_limit.algorithm: 不支持的限流算法: %q（可选 token_bucket / sliding_window）", rl.Algorithm)
+	}
+	for i, rule := range rl.PerModel {
+		field := fmt.Sprintf("rate_limit.per_model[%d]", i)
+		if len(rule.Models) == 0 {
+			v.addf("%s: models 不能为空", field)
+		}
+		for _, m := range rule.Models {
+			if m == "" || strings.Contains(strings.TrimSuffix(m, "*"), "*") {
+				v.addf("%s: 模型名 %q 不合法（只支持 * 后缀通配）", field, m)
+			}
+		}
+		if rule.RequestsPerSecond < 0 || rule.RequestsPerMinute < 0 || rule.BurstSize < 0 {
+			v.addf("%s: 限额不能为负数", field)
+		}
+		if rule.RequestsPerSecond == 0 && rule.RequestsPerMinute == 0 {
+			v.addf("%s: 需要配置 requests_per_second 或 requests_per_minute", field)
+		}
+		if rule.RequestsPerMinute > 0 && rl.Algorithm == RateLimitSlidingWindow {
+			v.addf("%s: sliding_window 算法只支持 requests_per_second", field)
+		}
+	}
+	v.checkScript("rate_limit.script", rl.Script)
+}
+
+// validateRouting 校验路由配置
+func (v *validator) validateRouting() {
+	r := v.cfg.Routing
+	if r == nil {
+		return
+	}
+	if !loadBalanceStrategies[r.LoadBalance] {
+		v.addf("routing.load_balance: 不支持的负载均衡策略: %q", r.LoadBalance)
+	}
+	v.checkScript("routing.script", r.Script)
+
+	for i, rule := range r.Fallback {
+		field := fmt.Sprintf("routing.fallback[%d]", i)
+		if rule.Primary != "" && !v.hasBackend(rule.Primary) {
+			v.addf("%s.primary: 后端不存在于 backends 中: %s", field, rule.Primary)
+		}
+		for j, fb := range rule.Fallback {
+			if !v.hasBackend(fb) {
+				v.addf("%s.fallback[%d]: 后端不存在于 backends 中: %s", field, j, fb)
+			}
+		}
+	}
+
+	groups := make(map[string]bool)
+	for _, b := range v.cfg.Backends {
+		if b != nil && b.Group != "" {
+			groups[b.Group] = true
+		}
+	}
+	for i, rule := range r.ModelFallback {
+		field := fmt.Sprintf("routing.model_fallback[%d]", i)
+		if len(rule.Models) == 0 {
+			v.addf("%s.models: 未指定模型", field)
+		}
+		if len(rule.Fallbacks) == 0 {
+			v.addf("%s.fallbacks: 未指定替代模型", field)
+		}
+	}
+
+	if r.PeakEWMA != nil && r.PeakEWMA.Decay < 0 {
+		v.addf("routing.peak_ewma.decay 不能为负数")
+	}
+
+	if h := r.Hedge; h != nil && h.Enabled {
+		if h.Delay < 0 {
+			v.addf("routing.hedge.delay 不能为负数")
+		}
+		if h.MaxExtraRequests < 0 {
+			v.addf("routing.hedge.max_extra_requests 不能为负数")
+		}
+	}
+
+	if m := r.Mirror; m != nil && m.Enabled {
+		if u, err := url.Parse(m.Target); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			v.addf("routing.mirror.target: 必须是 http(s) URL: %q", m.Target)
+		}
+		if m.Percentage < 0 || m.Percentage > 100 {
+			v.addf("routing.mirror.percentage: 必须在 0-100 之间: %v", m.Percentage)
+		}
+		if m.Timeout < 0 {
+			v.addf("routing.mirror.timeout 不能为负数")
+		}
+	}
+
+	if c := r.Canary; c != nil && c.Enabled {
+		if c.Backend == "" {
+			v.addf("routing.canary.backend 不能为空")
+		} else if !v.hasBackend(c.Backend) {
+			v.addf("routing.canary.backend: 后端不存在于 backends 中: %s", c.Backend)
+		}
+		if c.Percentage < 0 || c.Percentage > 100 {
+			v.addf("routing.canary.percentage: 必须在 0-100 之间: %v", c.Percentage)
+		}
+	}
+
+	if r.ModelPin != nil {
+		for i, m := range r.ModelPin.Allowed {
+			if strings.TrimSpace(m) == "" {
+				v.addf("routing.model_pin.allowed[%d]: 模型名不能为空", i)
+			}
+		}
+	}
+
+	groupStrategies := make(map[string]string)
+	for i, route := range r.ModelRoutes {
+		field := fmt.Sprintf("routing.model_routes[%d]", i)
+		if len(route.Models) == 0 {
+			v.addf("%s.models: 未指定模型", field)
+		}
+		if !groups[route.Group] {
+			v.addf("%s.group: 没有后端属于该组: %q", field, route.Group)
+		}
+		if route.LoadBalance == "" {
+			continue
+		}
+		if !loadBalanceStrategies[route.LoadBalance] {
+			v.addf("%s.load_balance: 不支持的负载均衡策略: %q", field, route.LoadBalance)
+		}
+		// 同一后端组只有一个负载均衡器，指向它的规则不能配置不同的策略
+		if prev, ok := groupStrategies[route.Group]; ok && prev != route.LoadBalance {
+			v.addf("%s.load_balance: 后端组 %q 已配置策略 %q，不能再配置 %q", field, route.Group, prev, route.LoadBalance)
+		}
+		groupStrategies[route.Group] = route.LoadBalance
+	}
+}
+
+// loadBalanceStrategies 支持的负载均衡策略（空值为默认的轮询）
+var loadBalanceStrategies = map[string]bool{
+	"":                  true,
+	"round_robin":       true,
+	"least_connections": true,
+	"latency_based":     true,
+	"peak_ewma":         true,
+	"weighted":          true,
+	"consistent_hash":   true,
+}
+
+// validateServer 校验服务器配置
+func (v *validator) validateServer() {
+	s := v.cfg.Server
+	if s == nil {
+		return
+	}
+	switch s.StreamMismatch {
+	case "", StreamMismatchJSON, StreamMismatchSSE:
+	default:
+		v.addf("server.stream_mismatch: 不支持的取值 %q（可选 json / sse）", s.StreamMismatch)
+	}
+	if s.ShutdownTimeout < 0 {
+		v.addf("server.shutdown_timeout 不能为负数")
+	}
+	if rd := s.Readiness; rd != nil && len(rd.Storage) > 0 {
+		if v.cfg.Storage == nil || v.cfg.Storage.HealthCheck == nil || !v.cfg.Storage.HealthCheck.Enabled {
+			v.addf("server.readiness.storage: 需要启用 storage.health_check")
+		}
+		for i, name := range rd.Storage {
+			if name == "*" {
+				continue
+			}
+			if v.cfg.Storage.GetDatabase(name) == nil && v.cfg.Storage.GetCache(name) == nil {
+				v.addf("server.readiness.storage[%d]: 引用的存储连接不存在: %s", i, name)
+			}
+		}
+	}
+	if rv := s.RequestValidation; rv != nil && rv.Enabled {
+		switch rv.SchemaVersion {
+		case "", SchemaDraft04, SchemaDraft06, SchemaDraft07, SchemaDraft2019, SchemaDraft2020:
+		default:
+			v.addf("server.request_validation.schema_version: 不支持的取值 %q（可选 2020-12 / 2019-09 / draft-07 / draft-06 / draft-04）", rv.SchemaVersion)
+		}
+	}
+	if idem := s.Idempotency; idem != nil && idem.Enabled {
+		if idem.TTL < 0 {
+			v.addf("server.idempotency.ttl 不能为负数")
+		}
+		if idem.Redis != "" {
+			v.checkCacheRef("server.idempotency.redis", idem.Redis)
+		}
+	}
+	if t := s.TLS; t != nil && t.Enabled {
+		if t.CertFile == "" || t.KeyFile == "" {
+			v.addf("server.tls: 启用 TLS 时必须配置 cert_file 和 key_file")
+		}
+		switch t.ClientAuth {
+		case "", "none", "request":
+		case "verify", "require":
+			if t.ClientCAFile == "" {
+				v.addf("server.tls.client_ca_file: client_auth 为 %s 时必须配置", t.ClientAuth)
+			}
+		default:
+			v.addf("server.tls.client_auth: 不支持的取值 %q（可选 none / request / verify / require）", t.ClientAuth)
+		}
+	}
+}
+
+// validateAdmin 校验 Admin API 配置
+func (v *validator) validateAdmin() {
+	a := v.cfg.Admin
+	if a == nil || !a.Enabled {
+		return
+	}
+	if a.KeyLength != 0 && (a.KeyLength < 16 || a.KeyLength > 128) {
+		v.addf("admin.key_length: 应在 16 ~ 128 之间，当前为 %d", a.KeyLength)
+	}
+	if a.MigratePlaintextKeys && !a.HashKeys {
+		v.addf("admin.migrate_plaintext_keys: 需要同时开启 hash_keys")
+	}
+	if e := a.Events; e != nil && e.Enabled {
+		if e.Webhook == nil || e.Webhook.URL == "" {
+			v.addf("admin.events.webhook.url: 未配置回调地址")
+		}
+	}
+}
+
+// validateMetrics 校验指标配置
+func (v *validator) validateMetrics() {
+	m := v.cfg.Metrics
+	if m == nil {
+		return
+	}
+	switch m.BackendLabel {
+	case "", "url", "name", "none":
+	default:
+		v.addf("metrics.backend_label: 不支持的取值 %q（可选 url / name / none）", m.BackendLabel)
+	}
+	if m.MaxModelLabels < 0 {
+		v.addf("metrics.max_model_labels: 不能为负数，当前为 %d", m.MaxModelLabels)
+	}
+	if m.Path != "" && !strings.HasPrefix(m.Path, "/") {
+		v.addf("metrics.path: 必须以 / 开头，当前为 %q", m.Path)
+	}
+	for i, b := range m.LatencyBuckets {
+		if i > 0 && b <= m.LatencyBuckets[i-1] {
+			v.addf("metrics.latency_buckets: 必须严格递增，第 %d 项 %v 不大于前一项 %v", i, b, m.LatencyBuckets[i-1])
+			break
+		}
+	}
+}
+
+// validateLogging 校验请求/访问日志配置
+func (v *validator) validateLogging() {
+	l := v.cfg.Logging
+	if l == nil || !l.Enabled {
+		return
+	}
+	if l.Request != nil && l.Request.Enabled {
+		if l.Request.Storage != "" {
+			v.checkDatabaseRef("logging.request.storage", l.Request.Storage)
+		}
+		v.checkScript("logging.request.script", l.Request.Script)
+		v.checkLogFile("logging.request.file", l.Request.File)
+	}
+	if l.Access != nil && l.Access.Enabled {
+		v.checkScript("logging.access.script", l.Access.Script)
+		v.checkLogFile("logging.access.file", l.Access.File)
+	}
+}
+
+// validateUsage 校验用量上报配置
+func (v *validator) validateUsage() {
+	u := v.cfg.Usage
+	if u == nil || !u.Enabled {
+		return
+	}
+	for i, reporter := range u.Reporters {
+		if reporter == nil || !reporter.Enabled {
+			continue
+		}
+		field := fmt.Sprintf("usage.reporters[%d]", i)
+		switch reporter.Type {
+		case "webhook":
+			if reporter.Webhook == nil || reporter.Webhook.URL == "" {
+				v.addf("%s: 缺少 webhook.url", field)
+			}
+			if dl := reporter.DeadLetter; dl != nil && dl.File != "" && reporter.Shadow {
+				v.addf("%s.dead_letter: 影子上报器不支持死信队列", field)
+			}
+		case "database":
+			if reporter.Database == nil {
+				v.addf("%s: 缺少 database 配置", field)
+			} else {
+				v.checkDatabaseRef(field+".database.storage", reporter.Database.Storage)
+			}
+			if reporter.DeadLetter != nil && reporter.DeadLetter.File != "" {
+				v.addf("%s.dead_letter: 仅 webhook 上报器支持，数据库上报器请使用 database.spill_file", field)
+			}
+		case "builtin":
+			if v.cfg.Admin == nil || !v.cfg.Admin.Enabled {
+				v.addf("%s: 内置用量存储需要启用 admin 模块", field)
+			}
+		default:
+			v.addf("%s: 不支持的上报器类型: %q", field, reporter.Type)
+		}
+		v.checkScript(field+".script", reporter.Script)
+	}
+}
+
+// validateHooks 校验生命周期钩子脚本
+func (v *validator) validateHooks() {
+	h := v.cfg.Hooks
+	if h == nil || !h.Enabled {
+		return
+	}
+	v.checkScript("hooks.on_request", h.OnRequest)
+	v.checkScript("hooks.on_auth", h.OnAuth)
+	v.checkScript("hooks.on_route", h.OnRoute)
+	v.checkScript("hooks.on_response", h.OnResponse)
+	v.checkScript("hooks.on_error", h.OnError)
+	v.checkScript("hooks.on_complete", h.OnComplete)
+	v.checkModulePath("hooks.module_path", h.ModulePath)
+}
+
+// validateBilling 校验计费配置
+func (v *validator) validateBilling() {
+	b := v.cfg.Billing
+	if b == nil || !b.Enabled {
+		return
+	}
+	if b.Redis != "" {
+		v.checkCacheRef("billing.redis", b.Redis)
+	}
+	if b.Timezone != "" {
+		if _, err := time.LoadLocation(b.Timezone); err != nil {
+			v.addf("billing.timezone: 无效的时区 %q: %v", b.Timezone, err)
+		}
+	}
+	for i, p := range b.Pricing {
+		if p == nil || p.Model == "" {
+			v.addf("billing.pricing[%d].model: 模型名为空", i)
+			continue
+		}
+		if p.Prompt < 0 || p.Completion < 0 {
+			v.addf("billing.pricing[%d]: 价格不能为负数", i)
+		}
+	}
+}
+
+// validateTracing 校验分布式追踪配置
+func (v *validator) validateTracing() {
+	t := v.cfg.Tracing
+	if t == nil || !t.Enabled {
+		return
+	}
+	if t.Endpoint == "" {
+		v.addf("tracing.endpoint: 启用追踪时必须配置 OTLP 导出地址")
+	} else if u, err := url.Parse(t.Endpoint); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		v.addf("tracing.endpoint: 无效的地址 %q（需为 http:// 或 https:// 开头的完整 URL）", t.Endpoint)
+	}
+	if t.SampleRate < 0 || t.SampleRate > 1 {
+		v.addf("tracing.sample_rate: 必须在 0 到 1 之间，当前为 %v", t.SampleRate)
+	}
+}
+
+// checkReadReplica 检查数据库连接的只读副本配置
+func (v *validator) checkReadReplica(field string, db *DatabaseConnection) {
+	if db.ReadReplica == "" {
+		if db.ReadHost != "" && db.DSN != "" && db.ReadDSN == "" {
+			v.addf("%s.read_host: 主库使用 dsn 时无法推导副本连接，请配置 read_dsn", field)
+		}
+		if (db.ReadDSN != "" || db.ReadHost != "") && db.Driver == "sqlite" {
+			v.addf("%s: sqlite 不支持只读副本", field)
+		}
+		return
+	}
+	if db.ReadDSN != "" || db.ReadHost != "" {
+		v.addf("%s.read_replica: 不能与 read_dsn / read_host 同时配置", field)
+	}
+	if db.ReadReplica == db.Name {
+		v.addf("%s.read_replica: 不能引用自身", field)
+		return
+	}
+	replica := v.cfg.Storage.GetDatabase(db.ReadReplica)
+	if replica == nil {
+		v.addf("%s.read_replica: 引用的数据库连接 %q 不存在（需在 storage.databases 中定义）", field, db.ReadReplica)
+		return
+	}
+	if replica.Driver != db.Driver {
+		v.addf("%s.read_replica: 副本 %q 的驱动 %s 与主库 %s 不一致", field, db.ReadReplica, replica.Driver, db.Driver)
+	}
+}
+
+// checkDatabaseRef 检查数据库连接引用是否存在
+func (v *validator) checkDatabaseRef(field, name string) {
+	if name == "" {
+		v.addf("%s: 未指定存储连接", field)
+		return
+	}
+	if v.cfg.Storage.GetDatabase(name) == nil {
+		v.addf("%s: 引用的数据库连接不存在: %s", field, name)
+	}
+}
+
+// checkCacheRef 检查缓存连接引用是否存在
+func (v *validator) checkCacheRef(field, name string) {
+	if name == "" {
+		v.addf("%s: 未指定缓存连接", field)
+		return
+	}
+	if v.cfg.Storage.GetCache(name) == nil {
+		v.addf("%s: 引用的缓存连接不存在: %s", field, name)
+	}
+}
+
+// hasBackend 检查后端是否存在（按 URL 或名称匹配）
+func (v *validator) hasBackend(ref string) bool {
+	for _, b := range v.cfg.Backends {
+		if b != nil && (b.URL == ref || (b.Name != "" && b.Name == ref)) {
+			return true
+		}
+	}
+	return false
+}
+
+// checkLogFile 检查日志文件的轮转配置
+func (v *validator) checkLogFile(field string, f *LogFileConfig) {
+	if f == nil {
+		return
+	}
+	switch f.Rotate {
+	case "", "daily", "hourly", "size":
+	default:
+		v.addf("%s.rotate: 不支持的取值 %q（可选 daily / hourly / size）", field, f.Rotate)
+	}
+	if f.MaxSize < 0 {
+		v.addf("%s.max_size: 不能为负数", field)
+	}
+	if f.MaxAge < 0 {
+		v.addf("%s.max_age: 不能为负数", field)
+	}
+}
+
+// checkScript 检查已启用的脚本配置能否编译
+func (v *validator) checkScript(field string, sc *ScriptConfig) {
+	if sc == nil || !sc.Enabled {
+		return
+	}
+	v.checkLua(field, sc.Script, sc.Path)
+}
+
+// checkLua 编译 Lua 脚本（内联优先，其次文件），仅检查语法不执行
+func (v *validator) checkLua(field, script, path string) {
+	name := field
+	if script == "" {
+		if path == "" {
+			v.addf("%s: 未配置 script 或 path", field)
+			return
+		}
+		data, err := os.ReadFile(path)
+		if err != nil {
+			v.addf("%s: 读取脚本文件失败: %v", field, err)
+			return
+		}
+		script = string(data)
+		name = path
+	}
+
+	chunk, err := parse.Parse(strings.NewReader(script), name)
+	if err != nil {
+		v.addf("%s: Lua 脚本语法错误: %v", field, err)
+		return
+	}
+	if _, err := lua.Compile(chunk, name); err != nil {
+		v.addf("%s: Lua 脚本编译失败: %v", field, err)
+	}
+}
+
+// checkModulePath 检查 require 的模块搜索目录是否存在
+func (v *validator) checkModulePath(field string, paths []string) {
+	for i, p := range paths {
+		info, err := os.Stat(p)
+		if err != nil {
+			v.addf("%s[%d]: 模块目录不可访问: %v", field, i, err)
+			continue
+		}
+		if !info.IsDir() {
+			v.addf("%s[%d]: %s 不是目录", field, i, p)
+		}
+	}
+}
@@ -0,0 +1,205 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// loadTestConfig 把 YAML 写入临时文件并加载
+func loadTestConfig(t *testing.T, data string) *Config {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	if err := os.WriteFile(path, []byte(data), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	cfg, err := Load(path)
+	if err != nil {
+		t.Fatalf("Load() error = %v", err)
+	}
+	return cfg
+}
+
+const validTestConfig = `
+storage:
+  databases:
+    - name: "main"
+      enabled: true
+      driver: "sqlite"
+      path: "./data/llmproxy.db"
+backends:
+  - name: "vllm-1"
+    url: "http://localhost:8000"
+  - name: "vllm-2"
+    url: "http://localhost:8001"
+auth:
+  enabled: true
+  pipeline:
+    - name: "db"
+      type: "database"
+      enabled: true
+      database:
+        storage: "main"
+        table: "api_keys"
+        key_column: "key"
+    - name: "custom"
+      type: "lua"
+      enabled: true
+      lua:
+        script: |
+          if key_info == nil then
+            return {allow = false}
+          end
+          return {allow = true}
+routing:
+  enabled: true
+  load_balance: "weighted"
+  fallback:
+    - primary: "vllm-1"
+      fallback: ["vllm-2"]
+`
+
+func TestValidateValidConfig(t *testing.T) {
+	cfg := loadTestConfig(t, validTestConfig)
+	if errs := cfg.Validate(); len(errs) != 0 {
+		t.Fatalf("Validate() = %v, want no errors", errs)
+	}
+}
+
+func TestMetricsConfigDefaults(t *testing.T) {
+	tests := []struct {
+		name     string
+		metrics  string
+		wantPath string
+	}{
+		{"未配置路径时默认 /metrics", "metrics:\n  enabled: true\n", "/metrics"},
+		{"自定义路径", "metrics:\n  enabled: true\n  path: \"/internal/metrics\"\n  latency_buckets: [5, 50, 500]\n", "/internal/metrics"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := loadTestConfig(t, validTestConfig+tt.metrics)
+			if errs := cfg.Validate(); len(errs) != 0 {
+				t.Fatalf("Validate() = %v", errs)
+			}
+			if cfg.Metrics.Path != tt.wantPath {
+				t.Errorf("metrics.path = %q, want %q", cfg.Metrics.Path, tt.wantPath)
+			}
+		})
+	}
+}
+
+func TestValidateBrokenConfigs(t *testing.T) {
+	tests := []struct {
+		name    string
+		replace [2]string // 在有效配置上做的替换
+		want    string    // 期望错误中包含的内容
+	}{
+		{
+			name:    "存储引用不存在",
+			replace: [2]string{`storage: "main"`, `storage: "missing"`},
+			want:    "auth.pipeline[0].database.storage: 引用的数据库连接不存在: missing",
+		},
+		{
+			name:    "故障转移后端不存在",
+			replace: [2]string{`fallback: ["vllm-2"]`, `fallback: ["vllm-3"]`},
+			want:    "routing.fallback[0].fallback[0]: 后端不存在于 backends 中: vllm-3",
+		},
+		{
+			name:    "主后端不存在",
+			replace: [2]string{`primary: "vllm-1"`, `primary: "nope"`},
+			want:    "routing.fallback[0].primary: 后端不存在于 backends 中: nope",
+		},
+		{
+			name:    "Lua 语法错误",
+			replace: [2]string{`return {allow = true}`, `return {allow = true`},
+			want:    "auth.pipeline[1].lua: Lua 脚本语法错误",
+		},
+		{
+			name:    "未知负载均衡策略",
+			replace: [2]string{`load_balance: "weighted"`, `load_balance: "latency-based"`},
+			want:    `routing.load_balance: 不支持的负载均衡策略: "latency-based"`,
+		},
+		{
+			name:    "峰值 EWMA 衰减时间为负数",
+			replace: [2]string{`load_balance: "weighted"`, "load_balance: \"peak_ewma\"\n  peak_ewma:\n    decay: -1s"},
+			want:    "routing.peak_ewma.decay 不能为负数",
+		},
+		{
+			name:    "指标路径不以 / 开头",
+			replace: [2]string{"routing:", "metrics:\n  enabled: true\n  path: \"metrics\"\nrouting:"},
+			want:    `metrics.path: 必须以 / 开头，当前为 "metrics"`,
+		},
+		{
+			name:    "指标分桶未递增",
+			replace: [2]string{"routing:", "metrics:\n  enabled: true\n  latency_buckets: [100, 50]\nrouting:"},
+			want:    "metrics.latency_buckets: 必须严格递增",
+		},
+		{
+			name:    "无效的后端 URL",
+			replace: [2]string{`url: "http://localhost:8001"`, `url: "localhost:8001"`},
+			want:    "backends[1]: 无效的 url",
+		},
+		{
+			name:    "就绪检查依赖未启用的存储健康检查",
+			replace: [2]string{"routing:", "server:\n  readiness:\n    storage: [\"main\"]\nrouting:"},
+			want:    "server.readiness.storage: 需要启用 storage.health_check",
+		},
+		{
+			name:    "就绪检查引用不存在的存储连接",
+			replace: [2]string{"routing:", "server:\n  readiness:\n    storage: [\"*\", \"redis\"]\nrouting:"},
+			want:    "server.readiness.storage[1]: 引用的存储连接不存在: redis",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if !strings.Contains(validTestConfig, tt.replace[0]) {
+				t.Fatalf("测试配置中没有 %q", tt.replace[0])
+			}
+			cfg := loadTestConfig(t, strings.Replace(validTestConfig, tt.replace[0], tt.replace[1], 1))
+			errs := cfg.Validate()
+			for _, err := range errs {
+				if strings.Contains(err.Error(), tt.want) {
+					return
+				}
+			}
+			t.Errorf("Validate() = %v, want error containing %q", errs, tt.want)
+		})
+	}
+}
+
+func TestValidateLuaScriptFile(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "route.lua")
+	if err := os.WriteFile(path, []byte("if then end"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	cfg := loadTestConfig(t, validTestConfig+`
+  script:
+    enabled: true
+    path: "`+path+`"
+`)
+	errs := cfg.Validate()
+	if len(errs) != 1 || !strings.Contains(errs[0].Error(), "routing.script: Lua 脚本语法错误") {
+		t.Fatalf("Validate() = %v, want one routing.script syntax error", errs)
+	}
+
+	cfg.Routing.Script.Path = filepath.Join(dir, "missing.lua")
+	errs = cfg.Validate()
+	if len(errs) != 1 || !strings.Contains(errs[0].Error(), "读取脚本文件失败") {
+		t.Fatalf("Validate() = %v, want one read error", errs)
+	}
+}
+
+func TestValidateCollectsAllErrors(t *testing.T) {
+	broken := strings.NewReplacer(
+		`storage: "main"`, `storage: "missing"`,
+		`fallback: ["vllm-2"]`, `fallback: ["vllm-3"]`,
+	).Replace(validTestConfig)
+
+	if errs := loadTestConfig(t, broken).Validate(); len(errs) != 2 {
+		t.Fatalf("Validate() = %v, want 2 errors", errs)
+	}
+}
@@ -65,12 +65,16 @@ func (RequestLog) TableName() string {
 // Store 数据库存储
 type Store struct {
 	db           *gorm.DB
+	readDB       *gorm.DB // 服务同步使用的只读副本（未配置时与 db 相同）
 	conn         *config.DatabaseConnection
 	tableName    string
+	query        *config.DiscoveryDatabaseConfig // 字段映射与过滤条件
 	syncInterval time.Duration
 	services     []Service
 	mu           sync.RWMutex
 	stopCh       chan struct{} // 停止信号
+
+	onChange func([]*config.Backend) // 后端列表变化时的回调（同步 goroutine 中调用）
 }
 
 // NewStoreFromConnection 从数据库连接配置创建 Store
@@ -127,6 +131,7 @@ func NewStoreFromConnection(conn *config.DatabaseConnection, tableName string) (
 
 	store := &Store{
 		db:           db,
+		readDB:       db,
 		conn:         conn,
 		tableName:    tableName,
 		syncInterval: 30 * time.Second,
@@ -152,39 +157,45 @@ func NewStoreFromDB(sqlDB *sql.DB, tableName string) (*Store, error) {
 //   - tableName: 表名
 //   - driver: 驱动类型 (mysql/postgres/sqlite)
 func NewStoreFromDBWithDriver(sqlDB *sql.DB, tableName string, driver string) (*Store, error) {
+	return NewStoreFromDBWithConfig(sqlDB, driver, &config.DiscoveryDatabaseConfig{Table: tableName})
+}
+
+// NewStoreFromDBWithConfig 从已创建的数据库连接创建 Store（使用发现配置中的表名、字段映射和过滤条件）
+// 参数:
+//   - sqlDB: 已创建的数据库连接
+//   - driver: 驱动类型 (mysql/postgres/sqlite)
+//   - cfg: 数据库发现配置
+func NewStoreFromDBWithConfig(sqlDB *sql.DB, driver string, cfg *config.DiscoveryDatabaseConfig) (*Store, error) {
+	return NewStoreFromDBWithReplica(sqlDB, nil, driver, cfg)
+}
+
+// NewStoreFromDBWithReplica 从已创建的数据库连接创建 Store，服务同步查询使用只读副本
+// 参数:
+//   - sqlDB: 主库连接（请求日志写入）
+//   - readDB: 只读副本连接（为 nil 或与主库相同时读写都使用主库）
+//   - driver: 驱动类型 (mysql/postgres/sqlite)
+//   - cfg: 数据库发现配置
+func NewStoreFromDBWithReplica(sqlDB, readDB *sql.DB, driver string, cfg *config.DiscoveryDatabaseConfig) (*Store, error) {
 	if sqlDB == nil {
 		return nil, nil
 	}
 
-	// 根据驱动类型选择 GORM dialector
-	var dialector gorm.Dialector
-	switch driver {
-	case "mysql", "":
-		dialector = mysql.New(mysql.Config{Conn: sqlDB})
-	case "postgres":
-		dialector = postgres.New(postgres.Config{Conn: sqlDB})
-	case "sqlite":
-		// SQLite 不支持通过已有连接创建，回退到 mysql
-		log.Println("警告: SQLite 不支持通过已有连接创建 GORM，尝试使用 MySQL 模式")
-		dialector = mysql.New(mysql.Config{Conn: sqlDB})
-	default:
-		return nil, fmt.Errorf("不支持的数据库驱动: %s", driver)
-	}
-
-	db, err := gorm.Open(dialector, &gorm.Config{
-		Logger: logger.Default.LogMode(logger.Silent),
-	})
+	db, err := openGorm(sqlDB, driver)
 	if err != nil {
 		return nil, err
 	}
-
-	if tableName == "" {
-		tableName = "services"
+	reader := db
+	if readDB != nil && readDB != sqlDB {
+		if reader, err = openGorm(readDB, driver); err != nil {
+			return nil, err
+		}
 	}
 
 	store := &Store{
 		db:           db,
-		tableName:    tableName,
+		readDB:       reader,
+		tableName:    cfg.GetTable(),
+		query:        cfg,
 		syncInterval: 30 * time.Second,
 	}
 
@@ -194,6 +205,26 @@ func NewStoreFromDBWithDriver(sqlDB *sql.DB, tableName string, driver string) (*
 	return store, nil
 }
 
+// openGorm 使用已创建的数据库连接打开 GORM
+func openGorm(sqlDB *sql.DB, driver string) (*gorm.DB, error) {
+	// 根据驱动类型选择 GORM dialector
+	var dialector gorm.Dialector
+	switch driver {
+	case "mysql", "":
+		dialector = mysql.New(mysql.Config{Conn: sqlDB})
+	case "postgres":
+		dialector = postgres.New(postgres.Config{Conn: sqlDB})
+	case "sqlite":
+		dialector = sqlite.New(sqlite.Config{Conn: sqlDB})
+	default:
+		return nil, fmt.Errorf("不支持的数据库驱动: %s", driver)
+	}
+
+	return gorm.Open(dialector, &gorm.Config{
+		Logger: logger.Default.LogMode(logger.Silent),
+	})
+}
+
 // StartSync 启动定时同步
 func (s *Store) StartSync() {
 	if s.syncInterval <= 0 {
@@ -239,17 +270,54 @@ func (s *Store) Close() error {
 
 // syncServices 同步服务配置
 func (s *Store) syncServices() {
+	// 按字段映射查询，列名统一别名为 Service 的字段名
+	q := s.query
+	tx := s.readDB.Table(s.tableName).Select(fmt.Sprintf("%s AS name, %s AS url, %s AS weight, %s AS status",
+		q.GetField("name"), q.GetField("url"), q.GetField("weight"), q.GetField("status")))
+	if q != nil && q.Where != "" {
+		tx = tx.Where(q.Where)
+	} else {
+		tx = tx.Where(fmt.Sprintf("%s IN ?", q.GetField("status")), q.GetActiveStatus())
+	}
+
 	var services []Service
-	if err := s.db.Where("status = ?", "enabled").Find(&services).Error; err != nil {
+	if err := tx.Scan(&services).Error; err != nil {
 		log.Printf("同步服务失败: %v", err)
 		return
 	}
 
 	s.mu.Lock()
+	changed := !sameServices(s.services, services)
 	s.services = services
+	onChange := s.onChange
 	s.mu.Unlock()
 
 	log.Printf("已同步 %d 个服务", len(services))
+	if changed && onChange != nil {
+		onChange(s.GetBackends())
+	}
+}
+
+// OnBackendsChange 设置后端列表变化时的回调（同步发现新增、删除或修改了服务时调用）
+// 参数：
+//   - fn: 回调函数，参数为最新的后端列表
+func (s *Store) OnBackendsChange(fn func([]*config.Backend)) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.onChange = fn
+}
+
+// sameServices 比较两次同步的服务列表在后端配置（名称、URL、权重）上是否相同
+func sameServices(a, b []Service) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i].Name != b[i].Name || a[i].URL != b[i].URL || a[i].Weight != b[i].Weight {
+			return false
+		}
+	}
+	return true
 }
 
 // GetServices 获取服务列表
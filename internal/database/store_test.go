@@ -0,0 +1,114 @@
+package database
+
+import (
+	"database/sql"
+	"testing"
+
+	_ "modernc.org/sqlite"
+
+	"llmproxy/internal/config"
+)
+
+func TestStoreSyncServicesFieldMapping(t *testing.T) {
+	db, err := sql.Open("sqlite", ":memory:")
+	if err != nil {
+		t.Fatal(err)
+	}
+	db.SetMaxOpenConns(1)
+	defer func() { _ = db.Close() }()
+
+	for _, stmt := range []string{
+		`CREATE TABLE upstreams (svc_name TEXT, endpoint TEXT, lb_weight INTEGER, state TEXT)`,
+		`INSERT INTO upstreams VALUES ('vllm-1', 'http://10.0.0.1:8000', 5, 'online')`,
+		`INSERT INTO upstreams VALUES ('vllm-2', 'http://10.0.0.2:8000', 0, 'online')`,
+		`INSERT INTO upstreams VALUES ('vllm-3', 'http://10.0.0.3:8000', 1, 'offline')`,
+	} {
+		if _, err := db.Exec(stmt); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	store, err := NewStoreFromDBWithConfig(db, "sqlite", &config.DiscoveryDatabaseConfig{
+		Table: "upstreams",
+		Fields: map[string]string{
+			"name":   "svc_name",
+			"url":    "endpoint",
+			"weight": "lb_weight",
+			"status": "state",
+		},
+		ActiveStatus: []string{"online"},
+	})
+	if err != nil {
+		t.Fatalf("NewStoreFromDBWithConfig() error = %v", err)
+	}
+
+	backends := store.GetBackends()
+	if len(backends) != 2 {
+		t.Fatalf("GetBackends() returned %d backends, want 2", len(backends))
+	}
+	if backends[0].Name != "vllm-1" || backends[0].URL != "http://10.0.0.1:8000" || backends[0].Weight != 5 {
+		t.Errorf("backends[0] = %+v", *backends[0])
+	}
+	if backends[1].Name != "vllm-2" {
+		t.Errorf("backends[1] = %+v", *backends[1])
+	}
+
+	// where 覆盖默认的状态过滤
+	store.query.Where = "state = 'offline'"
+	store.syncServices()
+	if backends := store.GetBackends(); len(backends) != 1 || backends[0].Name != "vllm-3" {
+		t.Errorf("GetBackends() with where = %v", backends)
+	}
+}
+
+func TestStoreOnBackendsChange(t *testing.T) {
+	db, err := sql.Open("sqlite", ":memory:")
+	if err != nil {
+		t.Fatal(err)
+	}
+	db.SetMaxOpenConns(1)
+	defer func() { _ = db.Close() }()
+
+	exec := func(stmt string) {
+		t.Helper()
+		if _, err := db.Exec(stmt); err != nil {
+			t.Fatal(err)
+		}
+	}
+	exec(`CREATE TABLE services (name TEXT, url TEXT, weight INTEGER, status TEXT)`)
+	exec(`INSERT INTO services VALUES ('vllm-1', 'http://10.0.0.1:8000', 1, 'active')`)
+
+	store, err := NewStoreFromDBWithConfig(db, "sqlite", &config.DiscoveryDatabaseConfig{Table: "services"})
+	if err != nil {
+		t.Fatalf("NewStoreFromDBWithConfig() error = %v", err)
+	}
+
+	var calls [][]*config.Backend
+	store.OnBackendsChange(func(backends []*config.Backend) {
+		calls = append(calls, backends)
+	})
+
+	// 服务列表没有变化时不触发回调
+	store.syncServices()
+	if len(calls) != 0 {
+		t.Fatalf("callback fired %d times for an unchanged sync", len(calls))
+	}
+
+	exec(`INSERT INTO services VALUES ('vllm-2', 'http://10.0.0.2:8000', 1, 'active')`)
+	store.syncServices()
+	if len(calls) != 1 || len(calls[0]) != 2 {
+		t.Fatalf("after adding a service: calls = %v", calls)
+	}
+
+	exec(`UPDATE services SET status = 'inactive' WHERE name = 'vllm-1'`)
+	store.syncServices()
+	if len(calls) != 2 || len(calls[1]) != 1 || calls[1][0].Name != "vllm-2" {
+		t.Fatalf("after removing a service: calls = %v", calls)
+	}
+
+	exec(`UPDATE services SET weight = 3 WHERE name = 'vllm-2'`)
+	store.syncServices()
+	if len(calls) != 3 || calls[2][0].Weight != 3 {
+		t.Errorf("after changing a weight: calls = %v", calls)
+	}
+}
@@ -5,20 +5,31 @@ import (
 	"encoding/json"
 	"fmt"
 	"io"
+	"log"
 	"net/http"
+	"net/url"
+	"strconv"
+	"sync"
 	"time"
 
 	"llmproxy/internal/config"
 )
 
 // ConsulSource Consul 服务发现源
-// 通过 Consul HTTP API 获取服务列表
+// 通过 Consul HTTP API 获取服务列表，支持阻塞查询（blocking query）监听变更
 type ConsulSource struct {
 	BaseSource
 	addr       string
 	service    string
 	tag        string
+	interval   time.Duration // 服务端不支持阻塞查询时的轮询间隔
+	wait       time.Duration // 阻塞查询最长等待时间
 	httpClient *http.Client
+
+	mu       sync.RWMutex
+	index    uint64            // 最近一次的 X-Consul-Index
+	backends []*config.Backend // 最近一次的结果
+	watching bool              // 是否正在监听（监听时 Discover 直接返回缓存）
 }
 
 // consulServiceEntry Consul 服务条目
@@ -28,11 +39,11 @@ type consulServiceEntry struct {
 
 // consulService Consul 服务信息
 type consulService struct {
-	ID      string   `json:"ID"`
-	Service string   `json:"Service"`
-	Address string   `json:"Address"`
-	Port    int      `json:"Port"`
-	Tags    []string `json:"Tags"`
+	ID      string            `json:"ID"`
+	Service string            `json:"Service"`
+	Address string            `json:"Address"`
+	Port    int               `json:"Port"`
+	Tags    []string          `json:"Tags"`
 	Meta    map[string]string `json:"Meta"`
 }
 
@@ -52,69 +63,178 @@ func NewConsulSource(name string, cfg *config.DiscoveryConsulConfig) (Source, er
 		return nil, fmt.Errorf("consul 服务名为空")
 	}
 
+	interval := cfg.Interval
+	if interval <= 0 {
+		interval = 30 * time.Second
+	}
+	wait := cfg.Wait
+	if wait <= 0 {
+		wait = 5 * time.Minute
+	}
+
 	return &ConsulSource{
 		BaseSource: NewBaseSource(name, "consul"),
 		addr:       cfg.Addr,
 		service:    cfg.Service,
 		tag:        cfg.Tag,
+		interval:   interval,
+		wait:       wait,
 		httpClient: &http.Client{
-			Timeout: 10 * time.Second,
+			// Consul 会在 wait 基础上增加最多 wait/16 的随机抖动
+			Timeout: wait + wait/16 + 10*time.Second,
 		},
 	}, nil
 }
 
 // Discover 从 Consul 获取服务列表
+// 监听运行中时直接返回监听得到的最新结果，否则执行一次普通查询
 func (c *ConsulSource) Discover(ctx context.Context) ([]*config.Backend, error) {
+	c.mu.RLock()
+	if c.watching && c.index > 0 {
+		backends := c.backends
+		c.mu.RUnlock()
+		return backends, nil
+	}
+	c.mu.RUnlock()
+
+	backends, index, err := c.query(ctx, 0)
+	if err != nil {
+		return nil, err
+	}
+
+	c.mu.Lock()
+	c.index = index
+	c.backends = backends
+	c.mu.Unlock()
+
+	return backends, nil
+}
+
+// Watch 使用阻塞查询监听服务变更，每次变更后调用 onChange
+// 若服务端未返回 X-Consul-Index，则退化为按 interval 轮询
+// 参数：
+//   - ctx: 上下文，取消时停止监听
+//   - onChange: 服务列表变更回调
+func (c *ConsulSource) Watch(ctx context.Context, onChange func()) {
+	c.mu.Lock()
+	c.watching = true
+	c.mu.Unlock()
+	defer func() {
+		c.mu.Lock()
+		c.watching = false
+		c.mu.Unlock()
+	}()
+
+	for {
+		c.mu.RLock()
+		lastIndex := c.index
+		c.mu.RUnlock()
+
+		backends, index, err := c.query(ctx, lastIndex)
+		if ctx.Err() != nil {
+			return
+		}
+		if err != nil {
+			log.Printf("Consul 阻塞查询失败 [%s]: %v", c.Name(), err)
+			if !sleepContext(ctx, c.interval) {
+				return
+			}
+			continue
+		}
+
+		changed := index == 0 || index != lastIndex
+		// 索引回退（如 Consul 重启）时重置，避免一直阻塞
+		if index < lastIndex {
+			index = 0
+		}
+
+		c.mu.Lock()
+		c.index = index
+		c.backends = backends
+		c.mu.Unlock()
+
+		if changed {
+			onChange()
+		}
+
+		// 服务端不支持阻塞查询，按间隔轮询
+		if index == 0 {
+			if !sleepContext(ctx, c.interval) {
+				return
+			}
+		}
+	}
+}
+
+// query 执行一次 Consul 健康服务查询
+// 参数：
+//   - ctx: 上下文
+//   - index: 阻塞查询索引（0 表示普通查询）
+//
+// 返回：
+//   - []*config.Backend: 后端列表
+//   - uint64: 响应中的 X-Consul-Index（不存在时为 0）
+//   - error: 错误信息
+func (c *ConsulSource) query(ctx context.Context, index uint64) ([]*config.Backend, uint64, error) {
 	// 构建 Consul API URL
-	url := fmt.Sprintf("%s/v1/health/service/%s?passing=true", c.addr, c.service)
+	params := url.Values{}
+	params.Set("passing", "true")
 	if c.tag != "" {
-		url += "&tag=" + c.tag
+		params.Set("tag", c.tag)
+	}
+	if index > 0 {
+		params.Set("index", strconv.FormatUint(index, 10))
+		params.Set("wait", fmt.Sprintf("%ds", int(c.wait.Seconds())))
 	}
+	reqURL := fmt.Sprintf("%s/v1/health/service/%s?%s", c.addr, c.service, params.Encode())
 
 	// 创建请求
-	req, err := http.NewRequestWithContext(ctx, "GET", url, nil)
+	req, err := http.NewRequestWithContext(ctx, "GET", reqURL, nil)
 	if err != nil {
-		return nil, fmt.Errorf("创建请求失败: %w", err)
+		return nil, 0, fmt.Errorf("创建请求失败: %w", err)
 	}
 
 	// 发送请求
 	resp, err := c.httpClient.Do(req)
 	if err != nil {
-		return nil, fmt.Errorf("请求 Consul 失败: %w", err)
+		return nil, 0, fmt.Errorf("请求 Consul 失败: %w", err)
 	}
 	defer func() {
 		_ = resp.Body.Close()
 	}()
 
 	if resp.StatusCode != http.StatusOK {
-		return nil, fmt.Errorf("consul 返回状态码: %d", resp.StatusCode)
+		return nil, 0, fmt.Errorf("consul 返回状态码: %d", resp.StatusCode)
 	}
 
 	// 读取响应
 	body, err := io.ReadAll(resp.Body)
 	if err != nil {
-		return nil, fmt.Errorf("读取响应失败: %w", err)
+		return nil, 0, fmt.Errorf("读取响应失败: %w", err)
 	}
 
 	// 解析 JSON
 	var entries []consulServiceEntry
 	if err := json.Unmarshal(body, &entries); err != nil {
-		return nil, fmt.Errorf("解析响应失败: %w", err)
+		return nil, 0, fmt.Errorf("解析响应失败: %w", err)
 	}
 
+	// 解析索引（不存在或非法时为 0）
+	newIndex, _ := strconv.ParseUint(resp.Header.Get("X-Consul-Index"), 10, 64)
+
 	// 转换为 config.Backend
 	var backends []*config.Backend
 	for _, entry := range entries {
 		svc := entry.Service
-		
+
 		// 构建服务 URL
 		address := svc.Address
 		if address == "" {
 			continue
 		}
-		
-		url := fmt.Sprintf("http://%s:%d", address, svc.Port)
-		
+
+		backendURL := fmt.Sprintf("http://%s:%d", address, svc.Port)
+
 		// 从 Meta 中读取权重
 		weight := 1
 		if w, ok := svc.Meta["weight"]; ok {
@@ -123,10 +243,22 @@ func (c *ConsulSource) Discover(ctx context.Context) ([]*config.Backend, error)
 
 		backends = append(backends, &config.Backend{
 			Name:   svc.ID,
-			URL:    url,
+			URL:    backendURL,
 			Weight: weight,
 		})
 	}
 
-	return backends, nil
+	return backends, newIndex, nil
+}
+
+// sleepContext 等待指定时长，ctx 取消时提前返回 false
+func sleepContext(ctx context.Context, d time.Duration) bool {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return true
+	case <-ctx.Done():
+		return false
+	}
 }
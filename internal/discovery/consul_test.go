@@ -0,0 +1,276 @@
+package discovery
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"llmproxy/internal/config"
+)
+
+// mockConsul 模拟 Consul 健康服务查询，支持阻塞查询
+type mockConsul struct {
+	mu       sync.Mutex
+	index    uint64
+	services []consulServiceEntry
+	changed  chan struct{} // 每次变更时关闭并替换
+	noIndex  bool          // 不返回 X-Consul-Index（模拟不支持阻塞查询）
+	requests []string      // 收到的查询参数
+}
+
+func newMockConsul(index uint64, addrs ...string) *mockConsul {
+	m := &mockConsul{index: index, changed: make(chan struct{})}
+	m.services = consulEntries(addrs...)
+	return m
+}
+
+func consulEntries(addrs ...string) []consulServiceEntry {
+	entries := make([]consulServiceEntry, len(addrs))
+	for i, addr := range addrs {
+		entries[i] = consulServiceEntry{Service: consulService{
+			ID:      "llm-" + addr,
+			Service: "llm",
+			Address: addr,
+			Port:    8000,
+			Meta:    map[string]string{"weight": "2"},
+		}}
+	}
+	return entries
+}
+
+// bump 更新服务列表并递增索引，唤醒阻塞中的查询
+func (m *mockConsul) bump(addrs ...string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.index++
+	m.services = consulEntries(addrs...)
+	close(m.changed)
+	m.changed = make(chan struct{})
+}
+
+func (m *mockConsul) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.URL.Path != "/v1/health/service/llm" || r.URL.Query().Get("passing") != "true" {
+		http.NotFound(w, r)
+		return
+	}
+
+	m.mu.Lock()
+	m.requests = append(m.requests, r.URL.RawQuery)
+	index, changed := m.index, m.changed
+	m.mu.Unlock()
+
+	// 阻塞查询：索引未变化时等待变更或超时
+	if want, _ := strconv.ParseUint(r.URL.Query().Get("index"), 10, 64); want > 0 && want == index {
+		select {
+		case <-changed:
+		case <-time.After(2 * time.Second):
+		case <-r.Context().Done():
+			return
+		}
+	}
+
+	m.mu.Lock()
+	body, _ := json.Marshal(m.services)
+	if !m.noIndex {
+		w.Header().Set("X-Consul-Index", fmt.Sprint(m.index))
+	}
+	m.mu.Unlock()
+	w.Header().Set("Content-Type", "application/json")
+	_, _ = w.Write(body)
+}
+
+func (m *mockConsul) requestCount() int {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return len(m.requests)
+}
+
+func newTestConsulSource(t *testing.T, addr string, interval time.Duration) *ConsulSource {
+	t.Helper()
+	source, err := NewConsulSource("consul", &config.DiscoveryConsulConfig{
+		Addr:     addr,
+		Service:  "llm",
+		Interval: interval,
+		Wait:     time.Second,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return source.(*ConsulSource)
+}
+
+// waitForURLs 等待 Discover 返回期望的后端列表
+func waitForURLs(t *testing.T, source Source, want ...string) {
+	t.Helper()
+	deadline := time.Now().Add(3 * time.Second)
+	for {
+		backends, err := source.Discover(context.Background())
+		if err == nil && len(backends) == len(want) {
+			match := true
+			for i, b := range backends {
+				if b.URL != want[i] {
+					match = false
+				}
+			}
+			if match {
+				return
+			}
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("Discover() = %v, %v; want %v", backends, err, want)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestConsulDiscover(t *testing.T) {
+	mock := newMockConsul(7, "10.0.0.1")
+	srv := httptest.NewServer(mock)
+	defer srv.Close()
+
+	c := newTestConsulSource(t, srv.URL, time.Minute)
+	backends, err := c.Discover(context.Background())
+	if err != nil {
+		t.Fatalf("Discover() error = %v", err)
+	}
+	if len(backends) != 1 || backends[0].URL != "http://10.0.0.1:8000" || backends[0].Weight != 2 || backends[0].Name != "llm-10.0.0.1" {
+		t.Fatalf("Discover() = %+v", backends)
+	}
+	if c.index != 7 {
+		t.Errorf("index = %d, want 7", c.index)
+	}
+}
+
+func TestConsulWatchBlockingQuery(t *testing.T) {
+	mock := newMockConsul(7, "10.0.0.1")
+	srv := httptest.NewServer(mock)
+	defer srv.Close()
+
+	// 轮询间隔设为 1 小时：变更只能通过阻塞查询及时到达
+	c := newTestConsulSource(t, srv.URL, time.Hour)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	changes := make(chan struct{}, 10)
+	go c.Watch(ctx, func() { changes <- struct{}{} })
+
+	waitChange := func() {
+		t.Helper()
+		select {
+		case <-changes:
+		case <-time.After(3 * time.Second):
+			t.Fatal("onChange not called")
+		}
+	}
+
+	waitChange() // 首次查询
+	waitForURLs(t, c, "http://10.0.0.1:8000")
+
+	mock.bump("10.0.0.1", "10.0.0.2")
+	waitChange()
+	waitForURLs(t, c, "http://10.0.0.1:8000", "http://10.0.0.2:8000")
+
+	mock.mu.Lock()
+	requests := append([]string(nil), mock.requests...)
+	mock.mu.Unlock()
+	if len(requests) < 2 {
+		t.Fatalf("requests = %v, want at least 2", requests)
+	}
+	// 第二次起带上一次的索引发起阻塞查询
+	if want := "index=7&passing=true&wait=1s"; requests[1] != want {
+		t.Errorf("blocking query = %q, want %q", requests[1], want)
+	}
+}
+
+func TestConsulWatchIndexUnchangedDoesNotNotify(t *testing.T) {
+	mock := newMockConsul(3, "10.0.0.1")
+	srv := httptest.NewServer(mock)
+	defer srv.Close()
+
+	c := newTestConsulSource(t, srv.URL, time.Hour)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	var mu sync.Mutex
+	calls := 0
+	go c.Watch(ctx, func() {
+		mu.Lock()
+		calls++
+		mu.Unlock()
+	})
+
+	// 阻塞查询超时返回相同索引，不触发回调
+	time.Sleep(2500 * time.Millisecond)
+	mu.Lock()
+	defer mu.Unlock()
+	if calls != 1 {
+		t.Errorf("onChange called %d times, want 1", calls)
+	}
+}
+
+func TestConsulWatchFallsBackToPolling(t *testing.T) {
+	mock := newMockConsul(0, "10.0.0.1")
+	mock.noIndex = true
+	srv := httptest.NewServer(mock)
+	defer srv.Close()
+
+	c := newTestConsulSource(t, srv.URL, 50*time.Millisecond)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go c.Watch(ctx, func() {})
+
+	time.Sleep(300 * time.Millisecond)
+	if n := mock.requestCount(); n < 3 || n > 10 {
+		t.Errorf("requests = %d, want periodic polling every 50ms", n)
+	}
+	mock.mu.Lock()
+	for _, q := range mock.requests {
+		if q != "passing=true" {
+			t.Errorf("polling query = %q, want no index", q)
+		}
+	}
+	mock.mu.Unlock()
+}
+
+func TestManagerConsumesConsulChanges(t *testing.T) {
+	mock := newMockConsul(1, "10.0.0.1")
+	srv := httptest.NewServer(mock)
+	defer srv.Close()
+
+	m, err := NewManager(&config.DiscoveryConfig{
+		Enabled:  true,
+		Interval: time.Hour,
+		Sources: []*config.DiscoverySource{{
+			Name:    "consul",
+			Type:    "consul",
+			Enabled: true,
+			Consul:  &config.DiscoveryConsulConfig{Addr: srv.URL, Service: "llm", Interval: time.Hour, Wait: time.Second},
+		}},
+	}, nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	updates := make(chan []*config.Backend, 10)
+	m.OnChange(func(backends []*config.Backend) { updates <- backends })
+	m.Start()
+	defer func() { _ = m.Close() }()
+
+	mock.bump("10.0.0.1", "10.0.0.3")
+	deadline := time.After(3 * time.Second)
+	for {
+		select {
+		case backends := <-updates:
+			if len(backends) == 2 && backends[1].URL == "http://10.0.0.3:8000" {
+				return
+			}
+		case <-deadline:
+			t.Fatalf("manager backends = %v, want the pushed change", m.GetBackends())
+		}
+	}
+}
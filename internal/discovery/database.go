@@ -4,6 +4,7 @@ import (
 	"context"
 	"database/sql"
 	"fmt"
+	"strings"
 
 	"llmproxy/internal/config"
 )
@@ -12,10 +13,9 @@ import (
 // 从数据库表中读取后端服务列表
 type DatabaseSource struct {
 	BaseSource
-	db        *sql.DB
-	driver    string
-	tableName string
-	fields    map[string]string
+	db     *sql.DB
+	driver string
+	cfg    *config.DiscoveryDatabaseConfig
 }
 
 // NewDatabaseSource 创建数据库发现源
@@ -33,32 +33,11 @@ func NewDatabaseSource(name string, db *sql.DB, driver string, cfg *config.Disco
 		return nil, fmt.Errorf("数据库连接为空")
 	}
 
-	tableName := cfg.Table
-	if tableName == "" {
-		tableName = "services"
-	}
-
-	// 默认字段映射
-	fields := map[string]string{
-		"name":   "name",
-		"url":    "url",
-		"weight": "weight",
-		"status": "status",
-	}
-
-	// 合并自定义字段映射
-	if cfg.Fields != nil {
-		for k, v := range cfg.Fields {
-			fields[k] = v
-		}
-	}
-
 	return &DatabaseSource{
 		BaseSource: NewBaseSource(name, "database"),
 		db:         db,
 		driver:     driver,
-		tableName:  tableName,
-		fields:     fields,
+		cfg:        cfg,
 	}, nil
 }
 
@@ -66,13 +45,27 @@ func NewDatabaseSource(name string, db *sql.DB, driver string, cfg *config.Disco
 func (d *DatabaseSource) Discover(ctx context.Context) ([]*config.Backend, error) {
 	// 构建查询语句
 	query := fmt.Sprintf(
-		"SELECT %s, %s, %s FROM %s WHERE %s = 'enabled' OR %s = 'active'",
-		d.fields["name"], d.fields["url"], d.fields["weight"],
-		d.tableName,
-		d.fields["status"], d.fields["status"],
+		"SELECT %s, %s, %s FROM %s",
+		d.cfg.GetField("name"), d.cfg.GetField("url"), d.cfg.GetField("weight"),
+		d.cfg.GetTable(),
 	)
 
-	rows, err := d.db.QueryContext(ctx, query)
+	var args []interface{}
+	if d.cfg != nil && d.cfg.Where != "" {
+		// 自定义过滤条件
+		query += " WHERE " + d.cfg.Where
+	} else {
+		// 按状态列过滤
+		statuses := d.cfg.GetActiveStatus()
+		placeholders := make([]string, len(statuses))
+		for i, status := range statuses {
+			placeholders[i] = d.placeholder(i + 1)
+			args = append(args, status)
+		}
+		query += fmt.Sprintf(" WHERE %s IN (%s)", d.cfg.GetField("status"), strings.Join(placeholders, ", "))
+	}
+
+	rows, err := d.db.QueryContext(ctx, query, args...)
 	if err != nil {
 		return nil, fmt.Errorf("查询数据库失败: %w", err)
 	}
@@ -83,21 +76,30 @@ func (d *DatabaseSource) Discover(ctx context.Context) ([]*config.Backend, error
 	var backends []*config.Backend
 	for rows.Next() {
 		var name, url string
-		var weight int
+		var weight sql.NullInt64
 		if err := rows.Scan(&name, &url, &weight); err != nil {
 			continue // 跳过错误行
 		}
 
-		if weight <= 0 {
-			weight = 1
+		w := int(weight.Int64)
+		if w <= 0 {
+			w = 1
 		}
 
 		backends = append(backends, &config.Backend{
 			Name:   name,
 			URL:    url,
-			Weight: weight,
+			Weight: w,
 		})
 	}
 
 	return backends, nil
 }
+
+// placeholder 返回对应驱动的 SQL 占位符
+func (d *DatabaseSource) placeholder(n int) string {
+	if d.driver == "postgres" {
+		return fmt.Sprintf("$%d", n)
+	}
+	return "?"
+}
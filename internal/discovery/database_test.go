@@ -0,0 +1,168 @@
+package discovery
+
+import (
+	"context"
+	"database/sql"
+	"testing"
+
+	_ "modernc.org/sqlite"
+
+	"llmproxy/internal/config"
+)
+
+// openTestUpstreamDB 创建内存 SQLite 数据库，表结构使用非标准列名
+func openTestUpstreamDB(t *testing.T) *sql.DB {
+	t.Helper()
+	db, err := sql.Open("sqlite", ":memory:")
+	if err != nil {
+		t.Fatal(err)
+	}
+	// 内存数据库每个连接独立，限制为单连接
+	db.SetMaxOpenConns(1)
+	t.Cleanup(func() { _ = db.Close() })
+
+	stmts := []string{
+		`CREATE TABLE upstreams (svc_name TEXT, endpoint TEXT, lb_weight INTEGER, state TEXT, region TEXT)`,
+		`INSERT INTO upstreams VALUES ('vllm-1', 'http://10.0.0.1:8000', 5, 'online', 'us')`,
+		`INSERT INTO upstreams VALUES ('vllm-2', 'http://10.0.0.2:8000', NULL, 'online', 'eu')`,
+		`INSERT INTO upstreams VALUES ('vllm-3', 'http://10.0.0.3:8000', 2, 'draining', 'us')`,
+		`INSERT INTO upstreams VALUES ('vllm-4', 'http://10.0.0.4:8000', 1, 'offline', 'us')`,
+	}
+	for _, stmt := range stmts {
+		if _, err := db.Exec(stmt); err != nil {
+			t.Fatalf("%s: %v", stmt, err)
+		}
+	}
+	return db
+}
+
+// testUpstreamsConfig 非标准列名的字段映射
+func testUpstreamsConfig() *config.DiscoveryDatabaseConfig {
+	return &config.DiscoveryDatabaseConfig{
+		Table: "upstreams",
+		Fields: map[string]string{
+			"name":   "svc_name",
+			"url":    "endpoint",
+			"weight": "lb_weight",
+			"status": "state",
+		},
+	}
+}
+
+func backendNames(backends []*config.Backend) []string {
+	names := make([]string, len(backends))
+	for i, b := range backends {
+		names[i] = b.Name
+	}
+	return names
+}
+
+func TestDatabaseSourceFieldMapping(t *testing.T) {
+	db := openTestUpstreamDB(t)
+
+	tests := []struct {
+		name   string
+		modify func(cfg *config.DiscoveryDatabaseConfig)
+		want   []string
+	}{
+		{
+			name:   "自定义可用状态",
+			modify: func(cfg *config.DiscoveryDatabaseConfig) { cfg.ActiveStatus = []string{"online"} },
+			want:   []string{"vllm-1", "vllm-2"},
+		},
+		{
+			name:   "多个可用状态",
+			modify: func(cfg *config.DiscoveryDatabaseConfig) { cfg.ActiveStatus = []string{"online", "draining"} },
+			want:   []string{"vllm-1", "vllm-2", "vllm-3"},
+		},
+		{
+			name:   "默认状态值不匹配",
+			modify: func(cfg *config.DiscoveryDatabaseConfig) {},
+			want:   []string{},
+		},
+		{
+			name:   "where 覆盖状态过滤",
+			modify: func(cfg *config.DiscoveryDatabaseConfig) { cfg.Where = "region = 'us' AND state <> 'offline'" },
+			want:   []string{"vllm-1", "vllm-3"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := testUpstreamsConfig()
+			tt.modify(cfg)
+			source, err := NewDatabaseSource("db", db, "sqlite", cfg)
+			if err != nil {
+				t.Fatal(err)
+			}
+			backends, err := source.Discover(context.Background())
+			if err != nil {
+				t.Fatalf("Discover() error = %v", err)
+			}
+			got := backendNames(backends)
+			if len(got) != len(tt.want) {
+				t.Fatalf("Discover() = %v, want %v", got, tt.want)
+			}
+			for i := range got {
+				if got[i] != tt.want[i] {
+					t.Fatalf("Discover() = %v, want %v", got, tt.want)
+				}
+			}
+		})
+	}
+}
+
+func TestDatabaseSourceWeightAndURL(t *testing.T) {
+	db := openTestUpstreamDB(t)
+	cfg := testUpstreamsConfig()
+	cfg.ActiveStatus = []string{"online"}
+
+	source, err := NewDatabaseSource("db", db, "sqlite", cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	backends, err := source.Discover(context.Background())
+	if err != nil || len(backends) != 2 {
+		t.Fatalf("Discover() = %v, %v", backends, err)
+	}
+	if backends[0].URL != "http://10.0.0.1:8000" || backends[0].Weight != 5 {
+		t.Errorf("backends[0] = %+v", *backends[0])
+	}
+	// 权重为 NULL 时按 1 处理
+	if backends[1].Weight != 1 {
+		t.Errorf("backends[1].Weight = %d, want 1", backends[1].Weight)
+	}
+}
+
+func TestDatabaseSourceDefaults(t *testing.T) {
+	db, err := sql.Open("sqlite", ":memory:")
+	if err != nil {
+		t.Fatal(err)
+	}
+	db.SetMaxOpenConns(1)
+	defer func() { _ = db.Close() }()
+
+	for _, stmt := range []string{
+		`CREATE TABLE services (name TEXT, url TEXT, weight INTEGER, status TEXT)`,
+		`INSERT INTO services VALUES ('a', 'http://a:8000', 1, 'enabled')`,
+		`INSERT INTO services VALUES ('b', 'http://b:8000', 1, 'active')`,
+		`INSERT INTO services VALUES ('c', 'http://c:8000', 1, 'disabled')`,
+	} {
+		if _, err := db.Exec(stmt); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// 未配置字段映射时使用 services 表、同名列和 enabled / active 状态
+	source, err := NewDatabaseSource("db", db, "sqlite", &config.DiscoveryDatabaseConfig{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	backends, err := source.Discover(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := backendNames(backends); len(got) != 2 || got[0] != "a" || got[1] != "b" {
+		t.Errorf("Discover() = %v, want [a b]", got)
+	}
+}
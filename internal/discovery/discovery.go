@@ -24,6 +24,13 @@ type Source interface {
 	Close() error
 }
 
+// Watcher 支持主动推送变更的发现源（可选实现）
+// Manager 会为实现该接口的发现源启动监听，变更到达时立即同步，而不必等待下一个同步周期
+type Watcher interface {
+	// Watch 阻塞监听变更，每次变更后调用 onChange，ctx 取消时返回
+	Watch(ctx context.Context, onChange func())
+}
+
 // BaseSource 基础发现源（提供通用功能）
 type BaseSource struct {
 	name       string
@@ -0,0 +1,152 @@
+package discovery
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"strings"
+	"sync"
+	"time"
+
+	"llmproxy/internal/config"
+)
+
+// SRVResolver SRV 记录解析接口（便于替换为自定义解析器）
+type SRVResolver interface {
+	LookupSRV(ctx context.Context, service, proto, name string) (string, []*net.SRV, error)
+}
+
+// DNSSource DNS SRV 服务发现源
+// 解析 SRV 记录（如 Consul DNS、Kubernetes Headless Service），
+// 生成 scheme://target:port 形式的后端
+type DNSSource struct {
+	BaseSource
+	srvName  string
+	scheme   string
+	ttl      time.Duration
+	resolver SRVResolver
+
+	mu         sync.Mutex
+	cached     []*config.Backend
+	resolvedAt time.Time
+}
+
+// NewDNSSource 创建 DNS SRV 发现源
+// 参数：
+//   - name: 发现源名称
+//   - cfg: DNS 发现配置
+//
+// 返回：
+//   - Source: 发现源实例
+//   - error: 错误信息
+func NewDNSSource(name string, cfg *config.DiscoveryDNSConfig) (Source, error) {
+	if cfg.Name == "" {
+		return nil, fmt.Errorf("dns SRV 名称为空")
+	}
+
+	scheme := cfg.Scheme
+	if scheme == "" {
+		scheme = "http"
+	}
+	if scheme != "http" && scheme != "https" {
+		return nil, fmt.Errorf("dns 不支持的协议: %s", scheme)
+	}
+
+	var resolver SRVResolver = net.DefaultResolver
+	if cfg.Server != "" {
+		// 使用指定的 DNS 服务器
+		server := cfg.Server
+		resolver = &net.Resolver{
+			PreferGo: true,
+			Dial: func(ctx context.Context, network, _ string) (net.Conn, error) {
+				var d net.Dialer
+				return d.DialContext(ctx, network, server)
+			},
+		}
+	}
+
+	return &DNSSource{
+		BaseSource: NewBaseSource(name, "dns"),
+		srvName:    cfg.Name,
+		scheme:     scheme,
+		ttl:        cfg.TTL,
+		resolver:   resolver,
+	}, nil
+}
+
+// SetResolver 替换 SRV 解析器（用于自定义解析或测试）
+func (d *DNSSource) SetResolver(resolver SRVResolver) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.resolver = resolver
+	d.cached = nil
+}
+
+// Discover 解析 SRV 记录获取服务列表
+// 在 TTL 有效期内直接返回上次的解析结果
+func (d *DNSSource) Discover(ctx context.Context) ([]*config.Backend, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if d.cached != nil && d.ttl > 0 && time.Since(d.resolvedAt) < d.ttl {
+		return d.cached, nil
+	}
+
+	// 名称已是完整的 SRV 名称（如 _llm._tcp.example.com），service/proto 传空
+	_, records, err := d.resolver.LookupSRV(ctx, "", "", d.srvName)
+	if err != nil {
+		return nil, fmt.Errorf("解析 SRV 记录失败: %w", err)
+	}
+
+	backends := srvToBackends(records, d.scheme)
+	d.cached = backends
+	d.resolvedAt = time.Now()
+
+	return backends, nil
+}
+
+// srvToBackends 将 SRV 记录转换为后端列表
+// 按 RFC 2782 语义仅使用优先级最高（Priority 值最小）的一组记录，
+// 组内使用记录的 Weight 作为负载均衡权重
+// 参数：
+//   - records: SRV 记录
+//   - scheme: 协议（http / https）
+//
+// 返回：
+//   - []*config.Backend: 后端列表
+func srvToBackends(records []*net.SRV, scheme string) []*config.Backend {
+	if len(records) == 0 {
+		return nil
+	}
+
+	minPriority := records[0].Priority
+	for _, r := range records {
+		if r.Priority < minPriority {
+			minPriority = r.Priority
+		}
+	}
+
+	var backends []*config.Backend
+	for _, r := range records {
+		if r.Priority != minPriority {
+			continue
+		}
+		target := strings.TrimSuffix(r.Target, ".")
+		if target == "" {
+			continue
+		}
+
+		weight := int(r.Weight)
+		if weight <= 0 {
+			weight = 1
+		}
+
+		backends = append(backends, &config.Backend{
+			Name:   fmt.Sprintf("%s:%d", target, r.Port),
+			URL:    fmt.Sprintf("%s://%s:%d", scheme, target, r.Port),
+			Weight: weight,
+		})
+	}
+
+	return backends
+}
@@ -0,0 +1,111 @@
+package discovery
+
+import (
+	"context"
+	"errors"
+	"net"
+	"testing"
+	"time"
+
+	"llmproxy/internal/config"
+)
+
+// mockSRVResolver 返回固定 SRV 记录的解析器
+type mockSRVResolver struct {
+	records []*net.SRV
+	err     error
+	calls   int
+	names   []string
+}
+
+func (m *mockSRVResolver) LookupSRV(_ context.Context, service, proto, name string) (string, []*net.SRV, error) {
+	m.calls++
+	m.names = append(m.names, service+"|"+proto+"|"+name)
+	return name, m.records, m.err
+}
+
+func newTestDNSSource(t *testing.T, cfg *config.DiscoveryDNSConfig, resolver SRVResolver) *DNSSource {
+	t.Helper()
+	source, err := NewDNSSource("dns", cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	d := source.(*DNSSource)
+	d.SetResolver(resolver)
+	return d
+}
+
+func TestDNSDiscover(t *testing.T) {
+	resolver := &mockSRVResolver{records: []*net.SRV{
+		{Target: "vllm-0.llm.svc.cluster.local.", Port: 8000, Priority: 10, Weight: 5},
+		{Target: "vllm-1.llm.svc.cluster.local.", Port: 8001, Priority: 10, Weight: 0},
+		{Target: "backup.llm.svc.cluster.local.", Port: 8000, Priority: 20, Weight: 100},
+		{Target: ".", Port: 8000, Priority: 10, Weight: 1},
+	}}
+	d := newTestDNSSource(t, &config.DiscoveryDNSConfig{Name: "_llm._tcp.llm.svc.cluster.local", Scheme: "https"}, resolver)
+
+	backends, err := d.Discover(context.Background())
+	if err != nil {
+		t.Fatalf("Discover() error = %v", err)
+	}
+
+	if len(resolver.names) != 1 || resolver.names[0] != "||_llm._tcp.llm.svc.cluster.local" {
+		t.Errorf("LookupSRV called with %v", resolver.names)
+	}
+
+	// 只使用优先级最高的一组，跳过空目标，权重 0 按 1 处理
+	want := []config.Backend{
+		{Name: "vllm-0.llm.svc.cluster.local:8000", URL: "https://vllm-0.llm.svc.cluster.local:8000", Weight: 5},
+		{Name: "vllm-1.llm.svc.cluster.local:8001", URL: "https://vllm-1.llm.svc.cluster.local:8001", Weight: 1},
+	}
+	if len(backends) != len(want) {
+		t.Fatalf("Discover() returned %d backends, want %d", len(backends), len(want))
+	}
+	for i, b := range backends {
+		if b.Name != want[i].Name || b.URL != want[i].URL || b.Weight != want[i].Weight {
+			t.Errorf("backends[%d] = %+v, want %+v", i, *b, want[i])
+		}
+	}
+}
+
+func TestDNSDiscoverCachesWithinTTL(t *testing.T) {
+	resolver := &mockSRVResolver{records: []*net.SRV{{Target: "a.example.com.", Port: 80, Weight: 1}}}
+	d := newTestDNSSource(t, &config.DiscoveryDNSConfig{Name: "_llm._tcp.example.com", TTL: time.Minute}, resolver)
+
+	for i := 0; i < 3; i++ {
+		backends, err := d.Discover(context.Background())
+		if err != nil || len(backends) != 1 || backends[0].URL != "http://a.example.com:80" {
+			t.Fatalf("Discover() = %v, %v", backends, err)
+		}
+	}
+	if resolver.calls != 1 {
+		t.Errorf("resolver called %d times within TTL, want 1", resolver.calls)
+	}
+
+	// 过期后重新解析
+	d.resolvedAt = time.Now().Add(-2 * time.Minute)
+	if _, err := d.Discover(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if resolver.calls != 2 {
+		t.Errorf("resolver called %d times after TTL, want 2", resolver.calls)
+	}
+}
+
+func TestDNSDiscoverError(t *testing.T) {
+	resolver := &mockSRVResolver{err: errors.New("no such host")}
+	d := newTestDNSSource(t, &config.DiscoveryDNSConfig{Name: "_llm._tcp.example.com"}, resolver)
+
+	if _, err := d.Discover(context.Background()); err == nil {
+		t.Fatal("Discover() error = nil, want resolver error")
+	}
+}
+
+func TestNewDNSSourceValidation(t *testing.T) {
+	if _, err := NewDNSSource("dns", &config.DiscoveryDNSConfig{}); err == nil {
+		t.Error("NewDNSSource() with empty name: error = nil")
+	}
+	if _, err := NewDNSSource("dns", &config.DiscoveryDNSConfig{Name: "_llm._tcp.example.com", Scheme: "grpc"}); err == nil {
+		t.Error("NewDNSSource() with scheme grpc: error = nil")
+	}
+}
@@ -1,7 +1,9 @@
 package discovery
 
 import (
+	"bytes"
 	"context"
+	"encoding/base64"
 	"encoding/json"
 	"fmt"
 	"io"
@@ -23,6 +25,12 @@ type EtcdSource struct {
 	httpClient *http.Client
 }
 
+// etcdRangeRequest Etcd Range 请求
+type etcdRangeRequest struct {
+	Key      string `json:"key"`
+	RangeEnd string `json:"range_end"`
+}
+
 // etcdRangeResponse Etcd Range 响应
 type etcdRangeResponse struct {
 	Kvs []etcdKeyValue `json:"kvs"`
@@ -96,13 +104,18 @@ func (e *EtcdSource) discoverFromEndpoint(ctx context.Context, endpoint string)
 	url := fmt.Sprintf("%s/v3/kv/range", strings.TrimSuffix(endpoint, "/"))
 
 	// 构建请求体
-	// Etcd v3 API 使用 base64 编码的 key
-	reqBody := fmt.Sprintf(`{"key":"%s","range_end":"%s"}`,
-		base64Encode(e.prefix),
-		base64Encode(prefixEnd(e.prefix)))
+	// Etcd v3 gRPC 网关要求 bytes 字段使用标准 base64 编码
+	// range_end 需在原始字节上计算后再编码
+	reqBody, err := json.Marshal(etcdRangeRequest{
+		Key:      base64Encode([]byte(e.prefix)),
+		RangeEnd: base64Encode(prefixEnd([]byte(e.prefix))),
+	})
+	if err != nil {
+		return nil, fmt.Errorf("序列化请求失败: %w", err)
+	}
 
 	// 创建请求
-	req, err := http.NewRequestWithContext(ctx, "POST", url, strings.NewReader(reqBody))
+	req, err := http.NewRequestWithContext(ctx, "POST", url, bytes.NewReader(reqBody))
 	if err != nil {
 		return nil, fmt.Errorf("创建请求失败: %w", err)
 	}
@@ -151,12 +164,12 @@ func (e *EtcdSource) discoverFromEndpoint(ctx context.Context, endpoint string)
 
 		// 解析服务信息
 		var svc etcdServiceValue
-		if err := json.Unmarshal([]byte(value), &svc); err != nil {
+		if err := json.Unmarshal(value, &svc); err != nil {
 			// 尝试直接使用 value 作为 URL
 			key, _ := base64Decode(kv.Key)
 			backends = append(backends, &config.Backend{
-				Name:   strings.TrimPrefix(key, e.prefix),
-				URL:    value,
+				Name:   strings.TrimPrefix(string(key), e.prefix),
+				URL:    strings.TrimSpace(string(value)),
 				Weight: 1,
 			})
 			continue
@@ -182,32 +195,27 @@ func (e *EtcdSource) discoverFromEndpoint(ctx context.Context, endpoint string)
 	return backends, nil
 }
 
-// base64Encode Base64 编码
-func base64Encode(s string) string {
-	return fmt.Sprintf("%x", []byte(s))
+// base64Encode 标准 Base64 编码（Etcd v3 JSON 网关格式）
+func base64Encode(b []byte) string {
+	return base64.StdEncoding.EncodeToString(b)
 }
 
-// base64Decode Base64 解码 (实际是 hex)
-func base64Decode(s string) (string, error) {
-	var result []byte
-	for i := 0; i < len(s); i += 2 {
-		var b byte
-		_, err := fmt.Sscanf(s[i:i+2], "%02x", &b)
-		if err != nil {
-			return "", err
-		}
-		result = append(result, b)
-	}
-	return string(result), nil
+// base64Decode 标准 Base64 解码
+func base64Decode(s string) ([]byte, error) {
+	return base64.StdEncoding.DecodeString(s)
 }
 
-// prefixEnd 计算前缀范围的结束值
-func prefixEnd(prefix string) string {
-	if prefix == "" {
-		return ""
+// prefixEnd 计算前缀范围的结束值（与 etcd clientv3.GetPrefixRangeEnd 一致）
+// 从末尾找到第一个小于 0xff 的字节加 1 并截断其后内容；
+// 若全部为 0xff，则返回 "\x00" 表示查询到末尾
+func prefixEnd(prefix []byte) []byte {
+	end := make([]byte, len(prefix))
+	copy(end, prefix)
+	for i := len(end) - 1; i >= 0; i-- {
+		if end[i] < 0xff {
+			end[i]++
+			return end[:i+1]
+		}
 	}
-	// 增加最后一个字符
-	end := []byte(prefix)
-	end[len(end)-1]++
-	return string(end)
+	return []byte{0}
 }
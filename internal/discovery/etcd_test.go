@@ -0,0 +1,157 @@
+package discovery
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"llmproxy/internal/config"
+)
+
+// etcdRangeFixture etcd v3.5 JSON 网关对 /v3/kv/range 的真实响应格式
+// （int64 字段以字符串表示，bytes 字段为标准 base64）
+const etcdRangeFixture = `{
+  "header": {
+    "cluster_id": "14841639068965178418",
+    "member_id": "10276657743932975437",
+    "revision": "12",
+    "raft_term": "2"
+  },
+  "kvs": [
+    {
+      "key": "L2xsbXByb3h5L2JhY2tlbmRzL3ZsbG0tMQ==",
+      "create_revision": "10",
+      "mod_revision": "10",
+      "version": "1",
+      "value": "eyJuYW1lIjoidmxsbS0xIiwidXJsIjoiaHR0cDovLzEwLjAuMC4xOjgwMDAiLCJ3ZWlnaHQiOjUsInN0YXR1cyI6ImFjdGl2ZSJ9"
+    },
+    {
+      "key": "L2xsbXByb3h5L2JhY2tlbmRzL3ZsbG0tMg==",
+      "create_revision": "11",
+      "mod_revision": "11",
+      "version": "1",
+      "value": "aHR0cDovLzEwLjAuMC4yOjgwMDA="
+    },
+    {
+      "key": "L2xsbXByb3h5L2JhY2tlbmRzL3ZsbG0tMw==",
+      "create_revision": "12",
+      "mod_revision": "12",
+      "version": "1",
+      "value": "eyJuYW1lIjoidmxsbS0zIiwidXJsIjoiaHR0cDovLzEwLjAuMC4zOjgwMDAiLCJzdGF0dXMiOiJkaXNhYmxlZCJ9"
+    }
+  ],
+  "count": "3"
+}`
+
+func TestEtcdBase64RoundTrip(t *testing.T) {
+	tests := []struct {
+		raw     string
+		encoded string
+	}{
+		{"/llmproxy/backends/", "L2xsbXByb3h5L2JhY2tlbmRzLw=="},
+		{"/llmproxy/backends/vllm-1", "L2xsbXByb3h5L2JhY2tlbmRzL3ZsbG0tMQ=="},
+		{"http://10.0.0.2:8000", "aHR0cDovLzEwLjAuMC4yOjgwMDA="},
+	}
+	for _, tt := range tests {
+		if got := base64Encode([]byte(tt.raw)); got != tt.encoded {
+			t.Errorf("base64Encode(%q) = %q, want %q", tt.raw, got, tt.encoded)
+		}
+		decoded, err := base64Decode(tt.encoded)
+		if err != nil || string(decoded) != tt.raw {
+			t.Errorf("base64Decode(%q) = %q, %v; want %q", tt.encoded, decoded, err, tt.raw)
+		}
+	}
+}
+
+func TestEtcdPrefixEnd(t *testing.T) {
+	tests := []struct {
+		prefix []byte
+		want   []byte
+	}{
+		{[]byte("/llmproxy/backends/"), []byte("/llmproxy/backends0")},
+		{[]byte("a\xff"), []byte("b")},
+		{[]byte("\xff\xff"), []byte{0}},
+	}
+	for _, tt := range tests {
+		if got := prefixEnd(tt.prefix); !bytes.Equal(got, tt.want) {
+			t.Errorf("prefixEnd(%q) = %q, want %q", tt.prefix, got, tt.want)
+		}
+	}
+}
+
+func TestEtcdDiscover(t *testing.T) {
+	var got etcdRangeRequest
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost || r.URL.Path != "/v3/kv/range" {
+			http.NotFound(w, r)
+			return
+		}
+		body, _ := io.ReadAll(r.Body)
+		if err := json.Unmarshal(body, &got); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write([]byte(etcdRangeFixture))
+	}))
+	defer srv.Close()
+
+	source, err := NewEtcdSource("etcd", &config.DiscoveryEtcdConfig{
+		Endpoints: []string{srv.URL},
+		Prefix:    "/llmproxy/backends/",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	backends, err := source.Discover(context.Background())
+	if err != nil {
+		t.Fatalf("Discover() error = %v", err)
+	}
+
+	// 请求中的 key / range_end 为原始前缀字节的 base64
+	if got.Key != "L2xsbXByb3h5L2JhY2tlbmRzLw==" || got.RangeEnd != "L2xsbXByb3h5L2JhY2tlbmRzMA==" {
+		t.Errorf("range request = %+v", got)
+	}
+
+	// vllm-3 状态为 disabled，被跳过
+	want := []config.Backend{
+		{Name: "vllm-1", URL: "http://10.0.0.1:8000", Weight: 5},
+		{Name: "vllm-2", URL: "http://10.0.0.2:8000", Weight: 1},
+	}
+	if len(backends) != len(want) {
+		t.Fatalf("Discover() returned %d backends, want %d", len(backends), len(want))
+	}
+	for i, b := range backends {
+		if b.Name != want[i].Name || b.URL != want[i].URL || b.Weight != want[i].Weight {
+			t.Errorf("backends[%d] = %+v, want %+v", i, *b, want[i])
+		}
+	}
+}
+
+func TestEtcdDiscoverFallsBackToNextEndpoint(t *testing.T) {
+	down := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer down.Close()
+	up := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte(etcdRangeFixture))
+	}))
+	defer up.Close()
+
+	source, err := NewEtcdSource("etcd", &config.DiscoveryEtcdConfig{
+		Endpoints: []string{down.URL, up.URL},
+		Prefix:    "/llmproxy/backends/",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	backends, err := source.Discover(context.Background())
+	if err != nil || len(backends) != 2 {
+		t.Fatalf("Discover() = %d backends, %v; want 2 backends", len(backends), err)
+	}
+}
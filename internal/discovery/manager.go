@@ -19,6 +19,9 @@ type Manager struct {
 	backends []*config.Backend
 	mu       sync.RWMutex
 	stopCh   chan struct{}
+	cancel   context.CancelFunc // 取消发现源监听
+
+	onChange func([]*config.Backend) // 后端列表变化时的回调
 
 	// 存储管理器引用（用于创建数据库发现源）
 	storageManager interface {
@@ -110,6 +113,12 @@ func (m *Manager) createSource(cfg *config.DiscoverySource) (Source, error) {
 		}
 		return NewEtcdSource(cfg.Name, cfg.Etcd)
 
+	case "dns":
+		if cfg.DNS == nil {
+			return nil, fmt.Errorf("dns 发现源配置为空")
+		}
+		return NewDNSSource(cfg.Name, cfg.DNS)
+
 	case "database":
 		if cfg.Database == nil {
 			return nil, fmt.Errorf("database 发现源配置为空")
@@ -117,7 +126,13 @@ func (m *Manager) createSource(cfg *config.DiscoverySource) (Source, error) {
 		if m.storageManager == nil {
 			return nil, fmt.Errorf("database 发现源需要 StorageManager")
 		}
-		dbConn := m.storageManager.GetDatabase(cfg.Database.Storage)
+		// 发现源只读，优先使用只读副本
+		var dbConn *sql.DB
+		if rm, ok := m.storageManager.(interface{ GetReadDatabase(string) *sql.DB }); ok {
+			dbConn = rm.GetReadDatabase(cfg.Database.Storage)
+		} else {
+			dbConn = m.storageManager.GetDatabase(cfg.Database.Storage)
+		}
 		if dbConn == nil {
 			return nil, fmt.Errorf("数据库 [%s] 未找到", cfg.Database.Storage)
 		}
@@ -147,6 +162,16 @@ func (m *Manager) Start() {
 
 	m.stopCh = make(chan struct{})
 
+	// 为支持变更推送的发现源启动监听
+	ctx, cancel := context.WithCancel(context.Background())
+	m.cancel = cancel
+	for _, source := range m.sources {
+		if watcher, ok := source.(Watcher); ok {
+			go watcher.Watch(ctx, m.discover)
+			log.Printf("发现源 [%s] 已启用变更监听", source.Name())
+		}
+	}
+
 	go func() {
 		ticker := time.NewTicker(interval)
 		defer ticker.Stop()
@@ -170,6 +195,9 @@ func (m *Manager) Stop() {
 	if m == nil {
 		return
 	}
+	if m.cancel != nil {
+		m.cancel()
+	}
 	if m.stopCh != nil {
 		close(m.stopCh)
 	}
@@ -219,10 +247,40 @@ func (m *Manager) discover() {
 	}
 
 	m.mu.Lock()
+	changed := !sameBackends(m.backends, allBackends)
 	m.backends = allBackends
+	onChange := m.onChange
 	m.mu.Unlock()
 
 	log.Printf("服务发现: 共 %d 个后端服务", len(allBackends))
+	if changed && onChange != nil {
+		onChange(allBackends)
+	}
+}
+
+// OnChange 设置后端列表变化时的回调（定期同步或变更推送发现新增、删除或修改了后端时调用）
+// 参数：
+//   - fn: 回调函数，参数为最新的后端列表
+func (m *Manager) OnChange(fn func([]*config.Backend)) {
+	if m == nil {
+		return
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.onChange = fn
+}
+
+// sameBackends 比较两次发现的后端列表（名称、URL、权重、分组）是否相同
+func sameBackends(a, b []*config.Backend) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i].Name != b[i].Name || a[i].URL != b[i].URL || a[i].Weight != b[i].Weight || a[i].Group != b[i].Group {
+			return false
+		}
+	}
+	return true
 }
 
 // GetBackends 获取当前发现的后端服务列表
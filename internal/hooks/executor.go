@@ -8,6 +8,7 @@ import (
 	"time"
 
 	"llmproxy/internal/config"
+	"llmproxy/internal/scripting"
 
 	lua "github.com/yuin/gopher-lua"
 )
@@ -79,6 +80,9 @@ type hookEngine struct {
 	script     string
 	scriptFile string
 	timeout    time.Duration
+	proto      *lua.FunctionProto // 编译后的脚本字节码（每次执行只需加载，无需重新解析）
+	maxMemory  int64              // 内存上限（字节，0 表示不限制）
+	modulePath []string           // require 的模块搜索目录
 }
 
 // NewExecutor 创建钩子执行器
@@ -91,7 +95,7 @@ func NewExecutor(cfg *config.HooksConfig) (*Executor, error) {
 
 	// 初始化各个钩子
 	if cfg.OnRequest != nil && cfg.OnRequest.Enabled {
-		engine, err := newHookEngine(cfg.OnRequest)
+		engine, err := newHookEngine(cfg.OnRequest, cfg.ModulePath)
 		if err != nil {
 			return nil, fmt.Errorf("初始化 on_request 钩子失败: %w", err)
 		}
@@ -100,7 +104,7 @@ func NewExecutor(cfg *config.HooksConfig) (*Executor, error) {
 	}
 
 	if cfg.OnAuth != nil && cfg.OnAuth.Enabled {
-		engine, err := newHookEngine(cfg.OnAuth)
+		engine, err := newHookEngine(cfg.OnAuth, cfg.ModulePath)
 		if err != nil {
 			return nil, fmt.Errorf("初始化 on_auth 钩子失败: %w", err)
 		}
@@ -109,7 +113,7 @@ func NewExecutor(cfg *config.HooksConfig) (*Executor, error) {
 	}
 
 	if cfg.OnRoute != nil && cfg.OnRoute.Enabled {
-		engine, err := newHookEngine(cfg.OnRoute)
+		engine, err := newHookEngine(cfg.OnRoute, cfg.ModulePath)
 		if err != nil {
 			return nil, fmt.Errorf("初始化 on_route 钩子失败: %w", err)
 		}
@@ -118,7 +122,7 @@ func NewExecutor(cfg *config.HooksConfig) (*Executor, error) {
 	}
 
 	if cfg.OnResponse != nil && cfg.OnResponse.Enabled {
-		engine, err := newHookEngine(cfg.OnResponse)
+		engine, err := newHookEngine(cfg.OnResponse, cfg.ModulePath)
 		if err != nil {
 			return nil, fmt.Errorf("初始化 on_response 钩子失败: %w", err)
 		}
@@ -127,7 +131,7 @@ func NewExecutor(cfg *config.HooksConfig) (*Executor, error) {
 	}
 
 	if cfg.OnError != nil && cfg.OnError.Enabled {
-		engine, err := newHookEngine(cfg.OnError)
+		engine, err := newHookEngine(cfg.OnError, cfg.ModulePath)
 		if err != nil {
 			return nil, fmt.Errorf("初始化 on_error 钩子失败: %w", err)
 		}
@@ -136,7 +140,7 @@ func NewExecutor(cfg *config.HooksConfig) (*Executor, error) {
 	}
 
 	if cfg.OnComplete != nil && cfg.OnComplete.Enabled {
-		engine, err := newHookEngine(cfg.OnComplete)
+		engine, err := newHookEngine(cfg.OnComplete, cfg.ModulePath)
 		if err != nil {
 			return nil, fmt.Errorf("初始化 on_complete 钩子失败: %w", err)
 		}
@@ -148,7 +152,7 @@ func NewExecutor(cfg *config.HooksConfig) (*Executor, error) {
 }
 
 // newHookEngine 创建钩子引擎
-func newHookEngine(cfg *config.ScriptConfig) (*hookEngine, error) {
+func newHookEngine(cfg *config.ScriptConfig, modulePath []string) (*hookEngine, error) {
 	if cfg.Script == "" && cfg.Path == "" {
 		return nil, fmt.Errorf("脚本内容和脚本文件路径不能同时为空")
 	}
@@ -157,6 +161,8 @@ func newHookEngine(cfg *config.ScriptConfig) (*hookEngine, error) {
 		script:     cfg.Script,
 		scriptFile: cfg.Path,
 		timeout:    cfg.Timeout,
+		maxMemory:  scripting.MB(cfg.MaxMemory),
+		modulePath: modulePath,
 	}
 
 	if engine.timeout == 0 {
@@ -178,16 +184,14 @@ func newHookEngine(cfg *config.ScriptConfig) (*hookEngine, error) {
 	return engine, nil
 }
 
-// validate 验证脚本
+// validate 编译脚本
+// 不试运行：启动时没有 request、response 等全局变量，读取它们的脚本会误报失败
 func (e *hookEngine) validate() error {
-	L := lua.NewState()
-	defer L.Close()
-
 	var err error
 	if e.scriptFile != "" {
-		err = L.DoFile(e.scriptFile)
+		e.proto, err = scripting.CompileFile(e.scriptFile)
 	} else {
-		err = L.DoString(e.script)
+		e.proto, err = scripting.Compile(e.script, "<hook>")
 	}
 	return err
 }
@@ -249,7 +253,8 @@ func (e *hookEngine) execute(hookType HookType, ctx *HookContext) *HookResult {
 		Metadata: make(map[string]interface{}),
 	}
 
-	L := lua.NewState()
+	// 沙箱化的 VM（禁用文件和进程相关函数，require 只能加载 module_path 内的模块）
+	L := scripting.NewSandbox(e.modulePath)
 	defer L.Close()
 
 	// 设置全局变量
@@ -261,13 +266,7 @@ func (e *hookEngine) execute(hookType HookType, ctx *HookContext) *HookResult {
 	// 执行脚本
 	done := make(chan error, 1)
 	go func() {
-		var err error
-		if e.scriptFile != "" {
-			err = L.DoFile(e.scriptFile)
-		} else {
-			err = L.DoString(e.script)
-		}
-		done <- err
+		done <- scripting.DoProtoLimited(L, e.proto, e.maxMemory)
 	}()
 
 	select {
@@ -312,6 +311,13 @@ func (e *hookEngine) execute(hookType HookType, ctx *HookContext) *HookResult {
 			}
 		}
 
+		// body（修改后的请求/响应体，字符串）
+		if v := tbl.RawGetString("body"); v != lua.LNil {
+			if s, ok := v.(lua.LString); ok {
+				result.Body = []byte(string(s))
+			}
+		}
+
 		// headers
 		if v := tbl.RawGetString("headers"); v != lua.LNil {
 			if headersTable, ok := v.(*lua.LTable); ok {
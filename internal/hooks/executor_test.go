@@ -0,0 +1,106 @@
+package hooks
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"llmproxy/internal/config"
+	"llmproxy/internal/scripting"
+)
+
+// newTestExecutor 创建只启用 on_request 钩子的执行器
+func newTestExecutor(t *testing.T, script string) *Executor {
+	t.Helper()
+	executor, err := NewExecutor(&config.HooksConfig{
+		Enabled:   true,
+		OnRequest: &config.ScriptConfig{Enabled: true, Script: script},
+	})
+	if err != nil {
+		t.Fatalf("NewExecutor() error = %v", err)
+	}
+	return executor
+}
+
+func TestNewExecutorValidatesSyntaxOnly(t *testing.T) {
+	// 读取 request 的脚本在启动时没有上下文，不能因此验证失败
+	executor := newTestExecutor(t, `return { continue = request.method == "POST" }`)
+	result := executor.ExecuteOnRequest(&HookContext{Request: &RequestInfo{Method: "POST"}})
+	if !result.Continue || result.Error != "" {
+		t.Errorf("ExecuteOnRequest() = %+v, want continue", result)
+	}
+
+	_, err := NewExecutor(&config.HooksConfig{
+		Enabled:   true,
+		OnRequest: &config.ScriptConfig{Enabled: true, Script: `return {`},
+	})
+	if err == nil {
+		t.Error("NewExecutor() with a syntax error: error = nil")
+	}
+}
+
+func TestHookMemoryLimit(t *testing.T) {
+	executor, err := NewExecutor(&config.HooksConfig{
+		Enabled: true,
+		OnRequest: &config.ScriptConfig{
+			Enabled:   true,
+			Timeout:   10 * time.Second,
+			MaxMemory: 1,
+			Script:    `local t = {} for i = 1, 1e8 do t[i] = i end return { continue = true }`,
+		},
+	})
+	if err != nil {
+		t.Fatalf("NewExecutor() error = %v", err)
+	}
+
+	result := executor.ExecuteOnRequest(&HookContext{Request: &RequestInfo{}})
+	if !strings.Contains(result.Error, scripting.ErrMemoryLimit.Error()) {
+		t.Errorf("ExecuteOnRequest() error = %q, want the memory limit error", result.Error)
+	}
+}
+
+func TestHookRequireModule(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "tenant.lua"), []byte(`
+return function(headers) return headers["X-Tenant"] == "vip" end
+`), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	executor, err := NewExecutor(&config.HooksConfig{
+		Enabled:    true,
+		ModulePath: []string{dir},
+		OnRequest: &config.ScriptConfig{Enabled: true, Script: `
+local is_vip = require("tenant")
+return { continue = is_vip(request.headers) }
+`},
+	})
+	if err != nil {
+		t.Fatalf("NewExecutor() error = %v", err)
+	}
+
+	vip := executor.ExecuteOnRequest(&HookContext{Request: &RequestInfo{Headers: map[string]string{"X-Tenant": "vip"}}})
+	if !vip.Continue || vip.Error != "" {
+		t.Errorf("vip request = %+v, want continue", vip)
+	}
+	other := executor.ExecuteOnRequest(&HookContext{Request: &RequestInfo{Headers: map[string]string{}}})
+	if other.Continue {
+		t.Errorf("other request = %+v, want rejected", other)
+	}
+}
+
+func TestHookSandbox(t *testing.T) {
+	// 未配置 module_path 时 require 报错；文件操作函数不可用
+	for _, script := range []string{
+		`require("os") return { continue = true }`,
+		`io.open("/etc/passwd") return { continue = true }`,
+		`dofile("/etc/passwd") return { continue = true }`,
+	} {
+		executor := newTestExecutor(t, script)
+		if result := executor.ExecuteOnRequest(&HookContext{Request: &RequestInfo{}}); result.Error == "" {
+			t.Errorf("%s: error = \"\", want the sandbox to reject it", script)
+		}
+	}
+}
@@ -2,14 +2,53 @@ package lb
 
 import (
 	"context"
+	"sync/atomic"
 	"time"
+
+	"llmproxy/internal/config"
 )
 
 // Backend 后端服务器信息
 type Backend struct {
+	Name    string // 后端名称（来自配置，可为空）
 	URL     string // 后端 URL
 	Weight  int    // 权重
 	Healthy bool   // 健康状态
+
+	// 运行时统计（并发安全，由 StartRequest / EndRequest 维护，供路由脚本等读取）
+	ActiveConnections atomic.Int64 // 在途请求数（已发出、尚未收到响应）
+	AvgLatencyMs      atomic.Int64 // 成功请求延迟的指数移动平均（毫秒，0 表示尚无数据）
+}
+
+// latencyAlpha 平均延迟的平滑系数（与延迟优先策略一致）
+const latencyAlpha = 0.3
+
+// StartRequest 记录向后端发出一个请求
+func (b *Backend) StartRequest() {
+	b.ActiveConnections.Add(1)
+}
+
+// EndRequest 记录请求结束：减少在途请求数，成功时更新平均延迟
+// 参数：
+//   - latency: 请求延迟
+//   - err: 错误信息（失败时不更新延迟）
+func (b *Backend) EndRequest(latency time.Duration, err error) {
+	b.ActiveConnections.Add(-1)
+	if err != nil {
+		return
+	}
+
+	sample := latency.Milliseconds()
+	for {
+		old := b.AvgLatencyMs.Load()
+		avg := sample
+		if old != 0 {
+			avg = int64(latencyAlpha*float64(sample) + (1-latencyAlpha)*float64(old))
+		}
+		if b.AvgLatencyMs.CompareAndSwap(old, avg) {
+			return
+		}
+	}
 }
 
 // LoadBalancer 负载均衡器接口
@@ -32,6 +71,12 @@ type LoadBalancer interface {
 	//   - err: 错误信息（nil 表示成功）
 	RecordResult(backend *Backend, latency time.Duration, err error)
 
+	// UpdateBackends 替换后端列表（服务发现的后端集合变化时调用）
+	// URL 未变化的后端保留健康状态和统计数据，新后端初始为健康；与 Next 并发调用安全
+	// 参数：
+	//   - backends: 新的后端配置列表
+	UpdateBackends(backends []*config.Backend)
+
 	// Start 启动健康检查
 	// 参数：
 	//   - ctx: 上下文，用于取消健康检查
@@ -0,0 +1,150 @@
+package lb
+
+import (
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"llmproxy/internal/config"
+)
+
+// allStrategies 返回每种负载均衡策略的构造函数
+func allStrategies() map[string]func([]*config.Backend) LoadBalancer {
+	return map[string]func([]*config.Backend) LoadBalancer{
+		"round_robin": func(b []*config.Backend) LoadBalancer { return NewRoundRobin(b, nil) },
+		"least_connections": func(b []*config.Backend) LoadBalancer {
+			return NewLeastConnections(b, nil)
+		},
+		"latency_based": func(b []*config.Backend) LoadBalancer { return NewLatencyBased(b, nil) },
+		"peak_ewma":     func(b []*config.Backend) LoadBalancer { return NewPeakEWMA(b, nil, 0) },
+		"weighted":      func(b []*config.Backend) LoadBalancer { return NewWeighted(b, nil) },
+		"consistent_hash": func(b []*config.Backend) LoadBalancer {
+			return NewConsistentHash(b, nil, 0)
+		},
+	}
+}
+
+// nextNames 连续选择 n 次（全部选完后再释放，使按连接数选择的策略分散请求），返回选中的后端名称集合
+func nextNames(balancer LoadBalancer, n int) map[string]bool {
+	names := make(map[string]bool)
+	var selected []*Backend
+	for i := 0; i < n; i++ {
+		b := balancer.Next()
+		if b == nil {
+			names[""] = true
+			continue
+		}
+		names[b.Name] = true
+		selected = append(selected, b)
+	}
+	for _, b := range selected {
+		balancer.RecordResult(b, time.Millisecond, nil)
+	}
+	return names
+}
+
+func TestUpdateBackendsAllStrategies(t *testing.T) {
+	for name, newBalancer := range allStrategies() {
+		t.Run(name, func(t *testing.T) {
+			balancer := newBalancer(testBackends(2))
+			unhealthy := balancer.(interface{ GetBackends() []*Backend }).GetBackends()[1]
+			balancer.UpdateHealth(unhealthy, false)
+
+			// 新增后端参与选择；未变化的后端保留健康状态
+			balancer.UpdateBackends(testBackends(4))
+			got := nextNames(balancer, 200)
+			if got["b1"] || got[""] {
+				t.Errorf("after adding: selected %v, want unhealthy b1 still skipped", got)
+			}
+
+			// 原有后端都不健康时选择新增的后端
+			balancer.UpdateHealth(balancer.(interface{ GetBackends() []*Backend }).GetBackends()[0], false)
+			got = nextNames(balancer, 200)
+			if got["b0"] || got["b1"] || got[""] {
+				t.Errorf("after adding: selected %v, want only the new b2 and b3", got)
+			}
+
+			// 删除后端后不再被选中
+			balancer.UpdateBackends(testBackends(4)[2:])
+			got = nextNames(balancer, 200)
+			if got["b0"] || got["b1"] || got[""] {
+				t.Errorf("after removing: selected %v, want only b2 and b3", got)
+			}
+			if backends := balancer.(interface{ GetBackends() []*Backend }).GetBackends(); len(backends) != 2 {
+				t.Errorf("GetBackends() = %d backends, want 2", len(backends))
+			}
+
+			// 删除全部后端
+			balancer.UpdateBackends(nil)
+			if b := balancer.Next(); b != nil {
+				t.Errorf("Next() with no backends = %s, want nil", b.Name)
+			}
+		})
+	}
+}
+
+// TestUpdateBackendsConcurrentNext 选择与替换后端列表并发进行，需配合 -race 运行
+func TestUpdateBackendsConcurrentNext(t *testing.T) {
+	for name, newBalancer := range allStrategies() {
+		t.Run(name, func(t *testing.T) {
+			balancer := newBalancer(testBackends(3))
+			var wg sync.WaitGroup
+			stop := make(chan struct{})
+			for i := 0; i < 4; i++ {
+				wg.Add(1)
+				go func() {
+					defer wg.Done()
+					for {
+						select {
+						case <-stop:
+							return
+						default:
+						}
+						if b := balancer.Next(); b != nil {
+							balancer.RecordResult(b, time.Millisecond, nil)
+						}
+					}
+				}()
+			}
+			for i := 0; i < 200; i++ {
+				balancer.UpdateBackends(testBackends(1 + i%4))
+			}
+			close(stop)
+			wg.Wait()
+		})
+	}
+}
+
+func TestBackendRequestStats(t *testing.T) {
+	b := &Backend{Name: "b0"}
+
+	b.StartRequest()
+	b.StartRequest()
+	if got := b.ActiveConnections.Load(); got != 2 {
+		t.Fatalf("ActiveConnections = %d, want 2", got)
+	}
+
+	// 首个样本直接作为平均值，之后按 EWMA 平滑
+	b.EndRequest(100*time.Millisecond, nil)
+	if got := b.AvgLatencyMs.Load(); got != 100 {
+		t.Errorf("AvgLatencyMs after first sample = %d, want 100", got)
+	}
+	b.EndRequest(200*time.Millisecond, nil)
+	if got := b.AvgLatencyMs.Load(); got != 130 {
+		t.Errorf("AvgLatencyMs after second sample = %d, want 130", got)
+	}
+	if got := b.ActiveConnections.Load(); got != 0 {
+		t.Errorf("ActiveConnections = %d, want 0", got)
+	}
+
+	// 失败请求只减少在途数，不影响延迟
+	b.StartRequest()
+	b.EndRequest(5*time.Second, errors.New("timeout"))
+	if got := b.AvgLatencyMs.Load(); got != 130 {
+		t.Errorf("AvgLatencyMs after failure = %d, want 130", got)
+	}
+	if got := b.ActiveConnections.Load(); got != 0 {
+		t.Errorf("ActiveConnections after failure = %d, want 0", got)
+	}
+}
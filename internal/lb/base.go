@@ -2,18 +2,24 @@ package lb
 
 import (
 	"context"
+	"io"
 	"log"
 	"net/http"
+	"strings"
+	"sync"
 	"time"
 
 	"llmproxy/internal/config"
+	"llmproxy/internal/metrics"
 )
 
 // BaseLoadBalancer 基础负载均衡器（提供通用功能）
 type BaseLoadBalancer struct {
 	backends    []*Backend                // 后端列表
+	backendsMu  sync.RWMutex              // 保护 backends 切片（替换后端列表时加写锁）
 	healthCheck *config.HealthCheckConfig // 健康检查配置
 	httpClient  *http.Client              // HTTP 客户端
+	grpcClient  *http.Client              // gRPC 健康检查客户端（health_check.type 为 grpc 时创建）
 }
 
 // NewBaseLoadBalancer 创建基础负载均衡器
@@ -31,6 +37,13 @@ func NewBaseLoadBalancer(backends []*config.Backend, healthCheck *config.HealthC
 			Timeout: 3 * time.Second,
 		},
 	}
+	if healthCheck != nil && healthCheck.Type == HealthCheckTypeGRPC {
+		timeout := healthCheck.Timeout
+		if timeout <= 0 {
+			timeout = 3 * time.Second
+		}
+		base.grpcClient = newGRPCHealthClient(timeout)
+	}
 
 	// 初始化后端列表
 	for _, b := range backends {
@@ -42,6 +55,7 @@ func NewBaseLoadBalancer(backends []*config.Backend, healthCheck *config.HealthC
 			weight = 1
 		}
 		base.backends = append(base.backends, &Backend{
+			Name:    b.Name,
 			URL:     b.URL,
 			Weight:  weight,
 			Healthy: true,
@@ -55,9 +69,53 @@ func NewBaseLoadBalancer(backends []*config.Backend, healthCheck *config.HealthC
 // 返回：
 //   - []*Backend: 后端列表
 func (b *BaseLoadBalancer) GetBackends() []*Backend {
+	b.backendsMu.RLock()
+	defer b.backendsMu.RUnlock()
 	return b.backends
 }
 
+// setBackends 替换后端列表
+// 参数：
+//   - backends: 新的后端列表
+func (b *BaseLoadBalancer) setBackends(backends []*Backend) {
+	b.backendsMu.Lock()
+	defer b.backendsMu.Unlock()
+	b.backends = backends
+}
+
+// mergeBackends 按新的后端配置生成后端列表（不修改当前列表，调用方需持有策略的写锁）
+// URL 未变化的后端沿用原实例以保留健康状态，名称和权重按新配置更新
+// 参数：
+//   - backends: 新的后端配置列表
+//
+// 返回：
+//   - []*Backend: 新的后端列表
+func (b *BaseLoadBalancer) mergeBackends(backends []*config.Backend) []*Backend {
+	old := make(map[string]*Backend)
+	for _, bk := range b.GetBackends() {
+		old[bk.URL] = bk
+	}
+
+	merged := NewBaseLoadBalancer(backends, b.healthCheck).backends
+	for i, bk := range merged {
+		if prev, ok := old[bk.URL]; ok {
+			prev.Name = bk.Name
+			prev.Weight = bk.Weight
+			merged[i] = prev
+		}
+	}
+	return merged
+}
+
+// backendURLs 返回后端 URL 集合
+func backendURLs(backends []*Backend) map[string]bool {
+	urls := make(map[string]bool, len(backends))
+	for _, b := range backends {
+		urls[b.URL] = true
+	}
+	return urls
+}
+
 // StartHealthCheck 启动健康检查
 // 参数：
 //   - ctx: 上下文，用于取消健康检查
@@ -89,9 +147,10 @@ func (b *BaseLoadBalancer) StartHealthCheck(ctx context.Context, updateFunc func
 // 参数：
 //   - updateFunc: 更新健康状态的函数
 func (b *BaseLoadBalancer) checkHealth(updateFunc func(*Backend, bool)) {
-	for _, backend := range b.backends {
+	for _, backend := range b.GetBackends() {
 		go func(bk *Backend) {
 			healthy := b.isHealthy(bk)
+			metrics.RecordBackendCheck(bk.Name, bk.URL, healthy)
 			updateFunc(bk, healthy)
 		}(backend)
 	}
@@ -107,34 +166,99 @@ func (b *BaseLoadBalancer) isHealthy(backend *Backend) bool {
 	if b.healthCheck == nil {
 		return true
 	}
+	if b.grpcClient != nil {
+		return b.isGRPCHealthy(backend)
+	}
 
 	path := b.healthCheck.Path
 	if path == "" {
 		path = "/health"
 	}
 
-	url := backend.URL + path
-	resp, err := b.httpClient.Get(url)
+	method := b.healthCheck.Method
+	if method == "" {
+		method = http.MethodGet
+		if b.healthCheck.Body != "" {
+			method = http.MethodPost
+		}
+	}
+	var body io.Reader
+	if b.healthCheck.Body != "" {
+		body = strings.NewReader(b.healthCheck.Body)
+	}
+
+	req, err := http.NewRequest(method, backend.URL+path, body)
+	if err != nil {
+		return false
+	}
+	for k, v := range b.healthCheck.Headers {
+		req.Header.Set(k, v)
+	}
+	if body != nil && req.Header.Get("Content-Type") == "" {
+		req.Header.Set("Content-Type", "application/json")
+	}
+
+	resp, err := b.httpClient.Do(req)
 	if err != nil {
 		return false
 	}
 	defer func() {
+		_, _ = io.Copy(io.Discard, io.LimitReader(resp.Body, healthResponseLimit))
 		_ = resp.Body.Close()
 	}()
 
-	expectedStatus := b.healthCheck.ExpectedStatus
-	if expectedStatus == 0 {
-		return resp.StatusCode >= 200 && resp.StatusCode < 300
+	// 配置了脚本时由脚本根据状态码、响应头和响应体给出结论
+	if script := currentHealthScript(); script != nil {
+		respBody, err := io.ReadAll(io.LimitReader(resp.Body, healthResponseLimit))
+		if err != nil {
+			return false
+		}
+		healthy, ok, err := script.CheckHealth(backend, &HealthCheckResponse{
+			StatusCode: resp.StatusCode,
+			Header:     resp.Header,
+			Body:       respBody,
+		})
+		if err != nil {
+			log.Printf("健康检查脚本执行失败（%s），按状态码判断: %v", backend.URL, err)
+		} else if ok {
+			return healthy
+		}
+	}
+
+	return b.statusHealthy(resp.StatusCode)
+}
+
+// statusHealthy 按 expected_status 判断状态码（未配置时 2xx 视为健康）
+func (b *BaseLoadBalancer) statusHealthy(code int) bool {
+	if b.healthCheck.ExpectedStatus.IsZero() {
+		return code >= 200 && code < 300
 	}
-	return resp.StatusCode == expectedStatus
+	return b.healthCheck.ExpectedStatus.Match(code)
+}
+
+// isGRPCHealthy 通过 grpc.health.v1.Health/Check 检查后端是否健康（状态为 SERVING 视为健康）
+// 参数：
+//   - backend: 后端实例
+//
+// 返回：
+//   - bool: 是否健康
+func (b *BaseLoadBalancer) isGRPCHealthy(backend *Backend) bool {
+	target, err := grpcHealthTarget(backend.URL, b.healthCheck.GRPCPort)
+	if err != nil {
+		return false
+	}
+
+	serving, err := checkGRPCHealth(context.Background(), b.grpcClient, target, b.healthCheck.GRPCService)
+	return err == nil && serving
 }
 
-// LogHealthChange 记录健康状态变化
+// LogHealthChange 记录健康状态变化，并更新 llmproxy_backend_healthy 指标
 // 参数：
 //   - backend: 后端实例
 //   - oldStatus: 旧状态
 //   - newStatus: 新状态
 func LogHealthChange(backend *Backend, oldStatus, newStatus bool) {
+	metrics.SetBackendHealthy(backend.Name, backend.URL, newStatus)
 	if oldStatus != newStatus {
 		if newStatus {
 			log.Printf("后端 %s 恢复健康", backend.URL)
@@ -0,0 +1,210 @@
+package lb
+
+import (
+	"context"
+	"crypto/md5"
+	"encoding/binary"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"llmproxy/internal/config"
+)
+
+// KeyedBalancer 支持按 Key 选择后端的负载均衡器（如一致性哈希）
+type KeyedBalancer interface {
+	// NextFor 根据 Key 选择后端，相同 Key 尽量落到同一后端
+	// 参数：
+	//   - key: 哈希 Key（为空时等价于 Next）
+	//
+	// 返回：
+	//   - *Backend: 后端实例，如果没有健康后端则返回 nil
+	NextFor(key string) *Backend
+}
+
+// NextFor 按 Key 选择后端
+// 负载均衡器实现了 KeyedBalancer 时使用 Key 选择，否则退化为 Next
+// 参数：
+//   - balancer: 负载均衡器
+//   - key: 哈希 Key
+//
+// 返回：
+//   - *Backend: 后端实例
+func NextFor(balancer LoadBalancer, key string) *Backend {
+	if kb, ok := balancer.(KeyedBalancer); ok && key != "" {
+		return kb.NextFor(key)
+	}
+	return balancer.Next()
+}
+
+// hashKeyContextKey 请求上下文中哈希 Key 的键
+type hashKeyContextKey struct{}
+
+// WithHashKey 将哈希 Key 写入上下文（由 handler 写入，路由器读取）
+func WithHashKey(ctx context.Context, key string) context.Context {
+	return context.WithValue(ctx, hashKeyContextKey{}, key)
+}
+
+// HashKeyFromContext 从上下文读取哈希 Key
+func HashKeyFromContext(ctx context.Context) string {
+	key, _ := ctx.Value(hashKeyContextKey{}).(string)
+	return key
+}
+
+// defaultVirtualNodes 每个权重单位的默认虚拟节点数
+const defaultVirtualNodes = 160
+
+// ConsistentHash 一致性哈希负载均衡器
+// 使用带虚拟节点的哈希环，相同 Key（API Key 或缓存亲和 Header）落到同一后端，
+// 以提高上游 prompt cache 命中率。后端不健康时顺时针落到下一个健康后端，
+// 只有原本落在该后端上的 Key 会迁移。
+type ConsistentHash struct {
+	*BaseLoadBalancer
+	virtualNodes int
+	ring         []uint32            // 已排序的虚拟节点哈希值
+	nodes        map[uint32]*Backend // 虚拟节点哈希 -> 后端
+	rr           int                 // 无 Key 时的轮询索引
+	mu           sync.RWMutex
+}
+
+// NewConsistentHash 创建一致性哈希负载均衡器
+// 参数：
+//   - backends: 后端配置列表
+//   - healthCheck: 健康检查配置
+//   - virtualNodes: 每个权重单位的虚拟节点数（<= 0 时使用默认值 160）
+//
+// 返回：
+//   - LoadBalancer: 负载均衡器实例
+func NewConsistentHash(backends []*config.Backend, healthCheck *config.HealthCheckConfig, virtualNodes int) LoadBalancer {
+	if virtualNodes <= 0 {
+		virtualNodes = defaultVirtualNodes
+	}
+	c := &ConsistentHash{
+		BaseLoadBalancer: NewBaseLoadBalancer(backends, healthCheck),
+		virtualNodes:     virtualNodes,
+	}
+	c.rebuild()
+	return c
+}
+
+// UpdateBackends 替换后端列表并重建哈希环（后端集合变化时调用）
+// 已存在的后端保留其健康状态
+// 参数：
+//   - backends: 新的后端配置列表
+func (c *ConsistentHash) UpdateBackends(backends []*config.Backend) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.setBackends(c.mergeBackends(backends))
+	c.rebuild()
+}
+
+// rebuild 重建哈希环（调用方需持有写锁或处于构造阶段）
+// 每个后端按 权重 × virtualNodes 生成虚拟节点
+func (c *ConsistentHash) rebuild() {
+	c.ring = c.ring[:0]
+	c.nodes = make(map[uint32]*Backend)
+
+	for _, b := range c.backends {
+		replicas := b.Weight * c.virtualNodes
+		for i := 0; i < replicas; i++ {
+			h := hashKey(b.URL + "#" + strconv.Itoa(i))
+			if _, exists := c.nodes[h]; exists {
+				// 哈希冲突时保留先加入的节点
+				continue
+			}
+			c.nodes[h] = b
+			c.ring = append(c.ring, h)
+		}
+	}
+
+	sort.Slice(c.ring, func(i, j int) bool { return c.ring[i] < c.ring[j] })
+}
+
+// NextFor 根据 Key 在哈希环上选择后端
+// 从 Key 的哈希位置顺时针查找第一个健康后端
+// 参数：
+//   - key: 哈希 Key
+//
+// 返回：
+//   - *Backend: 后端实例，如果没有健康后端则返回 nil
+func (c *ConsistentHash) NextFor(key string) *Backend {
+	if key == "" {
+		return c.Next()
+	}
+
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	if len(c.ring) == 0 {
+		return nil
+	}
+
+	h := hashKey(key)
+	start := sort.Search(len(c.ring), func(i int) bool { return c.ring[i] >= h })
+
+	// 最多遍历一圈；不健康的后端跳过
+	for i := 0; i < len(c.ring); i++ {
+		backend := c.nodes[c.ring[(start+i)%len(c.ring)]]
+		if backend.Healthy {
+			return backend
+		}
+	}
+	return nil
+}
+
+// Next 获取下一个健康的后端（无 Key 时按轮询选择）
+// 返回：
+//   - *Backend: 后端实例，如果没有健康后端则返回 nil
+func (c *ConsistentHash) Next() *Backend {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	backends := c.GetBackends()
+	for i := 0; i < len(backends); i++ {
+		backend := backends[c.rr%len(backends)]
+		c.rr = (c.rr + 1) % len(backends)
+		if backend.Healthy {
+			return backend
+		}
+	}
+	return nil
+}
+
+// UpdateHealth 更新后端健康状态
+// 哈希环本身不变，不健康的后端在选择时被跳过，恢复后其 Key 自动回到原后端
+// 参数：
+//   - backend: 后端实例
+//   - healthy: 健康状态
+func (c *ConsistentHash) UpdateHealth(backend *Backend, healthy bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	oldStatus := backend.Healthy
+	backend.Healthy = healthy
+	LogHealthChange(backend, oldStatus, healthy)
+}
+
+// RecordResult 记录请求结果（一致性哈希策略不需要统计）
+// 参数：
+//   - backend: 后端实例
+//   - latency: 请求延迟
+//   - err: 错误信息
+func (c *ConsistentHash) RecordResult(backend *Backend, latency time.Duration, err error) {
+	// 一致性哈希策略不需要记录结果
+}
+
+// Start 启动健康检查
+// 参数：
+//   - ctx: 上下文，用于取消健康检查
+func (c *ConsistentHash) Start(ctx context.Context) {
+	c.StartHealthCheck(ctx, c.UpdateHealth, "一致性哈希")
+}
+
+// hashKey 计算 Key 的哈希值
+// 与 ketama 相同使用 MD5 的前 4 字节，相似 Key（如 url#0、url#1）也能均匀分布
+func hashKey(key string) uint32 {
+	sum := md5.Sum([]byte(key))
+	return binary.BigEndian.Uint32(sum[:4])
+}
@@ -0,0 +1,178 @@
+package lb
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"testing"
+
+	"llmproxy/internal/config"
+)
+
+// testBackends 生成 n 个权重为 1 的后端配置
+func testBackends(n int) []*config.Backend {
+	backends := make([]*config.Backend, n)
+	for i := range backends {
+		backends[i] = &config.Backend{
+			Name:   fmt.Sprintf("b%d", i),
+			URL:    fmt.Sprintf("http://10.0.0.%d:8000", i+1),
+			Weight: 1,
+		}
+	}
+	return backends
+}
+
+func TestConsistentHashKeyStability(t *testing.T) {
+	c := NewConsistentHash(testBackends(4), nil, 0).(*ConsistentHash)
+
+	for i := 0; i < 200; i++ {
+		key := fmt.Sprintf("sk-user-%d", i)
+		first := c.NextFor(key)
+		if first == nil {
+			t.Fatalf("NextFor(%q) = nil", key)
+		}
+		for j := 0; j < 5; j++ {
+			if got := c.NextFor(key); got != first {
+				t.Fatalf("NextFor(%q) = %s, want %s", key, got.URL, first.URL)
+			}
+		}
+	}
+
+	// 相同配置重建的负载均衡器对同一 Key 选择相同后端（多实例部署时一致）
+	other := NewConsistentHash(testBackends(4), nil, 0).(*ConsistentHash)
+	for i := 0; i < 200; i++ {
+		key := fmt.Sprintf("sk-user-%d", i)
+		if c.NextFor(key).URL != other.NextFor(key).URL {
+			t.Fatalf("key %q maps to different backends across instances", key)
+		}
+	}
+}
+
+func TestConsistentHashDistribution(t *testing.T) {
+	const nodes, keys = 4, 20000
+	c := NewConsistentHash(testBackends(nodes), nil, 0).(*ConsistentHash)
+
+	counts := make(map[string]int)
+	for i := 0; i < keys; i++ {
+		counts[c.NextFor(fmt.Sprintf("key-%d", i)).URL]++
+	}
+	if len(counts) != nodes {
+		t.Fatalf("keys landed on %d backends, want %d", len(counts), nodes)
+	}
+	expected := float64(keys) / nodes
+	for url, n := range counts {
+		if math.Abs(float64(n)-expected)/expected > 0.15 {
+			t.Errorf("backend %s got %d keys, want %.0f ± 15%%", url, n, expected)
+		}
+	}
+}
+
+func TestConsistentHashWeightedDistribution(t *testing.T) {
+	backends := testBackends(2)
+	backends[0].Weight = 3
+	c := NewConsistentHash(backends, nil, 0).(*ConsistentHash)
+
+	counts := make(map[string]int)
+	for i := 0; i < 20000; i++ {
+		counts[c.NextFor(fmt.Sprintf("key-%d", i)).URL]++
+	}
+	ratio := float64(counts[backends[0].URL]) / float64(counts[backends[1].URL])
+	if ratio < 2.5 || ratio > 3.5 {
+		t.Errorf("weight 3:1 gave ratio %.2f", ratio)
+	}
+}
+
+func TestConsistentHashRebalanceOnBackendChange(t *testing.T) {
+	const keys = 10000
+	c := NewConsistentHash(testBackends(4), nil, 0).(*ConsistentHash)
+
+	before := make(map[string]string, keys)
+	for i := 0; i < keys; i++ {
+		key := fmt.Sprintf("key-%d", i)
+		before[key] = c.NextFor(key).URL
+	}
+
+	// 新增一个后端：只有约 1/5 的 Key 迁移，且都迁移到新后端
+	added := testBackends(5)
+	c.UpdateBackends(added)
+	moved := 0
+	for key, url := range before {
+		got := c.NextFor(key).URL
+		if got != url {
+			moved++
+			if got != added[4].URL {
+				t.Fatalf("key %q moved from %s to %s, want the new backend", key, url, got)
+			}
+		}
+	}
+	if frac := float64(moved) / keys; frac < 0.12 || frac > 0.28 {
+		t.Errorf("%.1f%% of keys moved after adding a backend, want about 20%%", frac*100)
+	}
+
+	// 移除新后端后所有 Key 回到原后端
+	c.UpdateBackends(testBackends(4))
+	for key, url := range before {
+		if got := c.NextFor(key).URL; got != url {
+			t.Fatalf("key %q = %s after removing the backend, want %s", key, got, url)
+		}
+	}
+}
+
+func TestConsistentHashSkipsUnhealthy(t *testing.T) {
+	c := NewConsistentHash(testBackends(3), nil, 0).(*ConsistentHash)
+
+	before := make(map[string]*Backend)
+	for i := 0; i < 1000; i++ {
+		key := fmt.Sprintf("key-%d", i)
+		before[key] = c.NextFor(key)
+	}
+
+	down := c.GetBackends()[0]
+	c.UpdateHealth(down, false)
+	for key, b := range before {
+		got := c.NextFor(key)
+		if got == down {
+			t.Fatalf("key %q landed on an unhealthy backend", key)
+		}
+		// 只有原本落在不健康后端上的 Key 迁移
+		if b != down && got != b {
+			t.Fatalf("key %q moved from healthy backend %s to %s", key, b.URL, got.URL)
+		}
+	}
+
+	// 恢复后 Key 回到原后端
+	c.UpdateHealth(down, true)
+	for key, b := range before {
+		if got := c.NextFor(key); got != b {
+			t.Fatalf("key %q = %s after recovery, want %s", key, got.URL, b.URL)
+		}
+	}
+
+	for _, b := range c.GetBackends() {
+		c.UpdateHealth(b, false)
+	}
+	if got := c.NextFor("key-1"); got != nil {
+		t.Errorf("NextFor() with no healthy backends = %s, want nil", got.URL)
+	}
+}
+
+func TestNextForFallsBackToNext(t *testing.T) {
+	rr := NewRoundRobin(testBackends(2), nil)
+	// 轮询策略不支持按 Key 选择，退化为 Next
+	if a, b := NextFor(rr, "k"), NextFor(rr, "k"); a == b {
+		t.Errorf("NextFor on round robin returned the same backend twice: %s", a.URL)
+	}
+
+	c := NewConsistentHash(testBackends(2), nil, 0)
+	if a, b := NextFor(c, ""), NextFor(c, ""); a == b {
+		t.Errorf("NextFor with empty key should round-robin, got %s twice", a.URL)
+	}
+
+	ctx := WithHashKey(context.Background(), "sk-abc")
+	if got := HashKeyFromContext(ctx); got != "sk-abc" {
+		t.Errorf("HashKeyFromContext() = %q, want %q", got, "sk-abc")
+	}
+	if got := HashKeyFromContext(context.Background()); got != "" {
+		t.Errorf("HashKeyFromContext(empty) = %q, want empty", got)
+	}
+}
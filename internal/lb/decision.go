@@ -0,0 +1,222 @@
+package lb
+
+import (
+	"errors"
+	"log"
+	"sync/atomic"
+
+	"llmproxy/internal/metrics"
+)
+
+// 后端选择原因
+const (
+	ReasonRoundRobin      = "round_robin"      // 轮询
+	ReasonWeight          = "weight"           // 按权重
+	ReasonLeastConn       = "least_conn"       // 最少连接数
+	ReasonLatency         = "latency"          // 延迟最低
+	ReasonPeakEWMA        = "peak_ewma"        // 峰值 EWMA 延迟 × 在途请求数最低
+	ReasonHashKey         = "hash_key"         // 一致性哈希命中
+	ReasonHealthSkip      = "health_skip"      // 池中有不健康后端被跳过
+	ReasonNoHealthy       = "no_healthy"       // 没有健康后端
+	ReasonRateLimitSkip   = "rate_limit_skip"  // 有后端因达到后端限流上限被跳过
+	ReasonRateLimited     = "rate_limited"     // 健康后端均已达到后端限流上限
+	ReasonFallbackPrimary = "fallback_primary" // 故障转移规则的主后端
+	ReasonFallback        = "fallback"         // 故障转移到备用后端
+	ReasonHook            = "hook"             // on_route 钩子指定的后端
+	ReasonCanary          = "canary"           // 金丝雀分流到金丝雀后端
+)
+
+// errNotAllowed 选中后被 ChooseAllowed 过滤掉的后端（释放选择时传给 RecordResult）
+var errNotAllowed = errors.New("后端被过滤，未发送请求")
+
+// DefaultPool 默认后端池名称（未匹配 model_routes 的请求）
+const DefaultPool = "default"
+
+// decisionLog 是否输出选择原因调试日志
+var decisionLog atomic.Bool
+
+// SetDecisionLog 设置是否输出后端选择原因的调试日志
+// 参数：
+//   - enabled: 是否启用
+func SetDecisionLog(enabled bool) {
+	decisionLog.Store(enabled)
+}
+
+// Choose 按 Key 选择后端，并记录选择原因（指标 + 可选调试日志）
+// 参数：
+//   - balancer: 负载均衡器
+//   - key: 哈希 Key（可为空）
+//   - pool: 后端池名称（默认池为 DefaultPool，模型路由为后端组名）
+//
+// 返回：
+//   - *Backend: 后端实例，如果没有健康后端则返回 nil
+func Choose(balancer LoadBalancer, key, pool string) *Backend {
+	return ChooseAllowed(balancer, key, pool, nil)
+}
+
+// ChooseAllowed 按 Key 选择 allow 允许的后端，并记录选择原因
+// 负载均衡器选中的后端被 allow 拒绝时视为暂时不可用：先通过 RecordResult 释放该次选择
+// （最少连接数策略会在 Next 中计数），再按池中顺序选择第一个健康且被允许的后端，
+// 并通过 Acquire 登记该次选择，保证调用方随后的 RecordResult 与之成对
+// 参数：
+//   - balancer: 负载均衡器
+//   - key: 哈希 Key（可为空）
+//   - pool: 后端池名称
+//   - allow: 后端过滤函数（nil 表示不过滤）
+//
+// 返回：
+//   - *Backend: 后端实例，如果没有可用后端则返回 nil
+func ChooseAllowed(balancer LoadBalancer, key, pool string, allow func(*Backend) bool) *Backend {
+	backend := NextFor(balancer, key)
+
+	skipped := 0
+	if allow != nil && backend != nil && !allow(backend) {
+		balancer.RecordResult(backend, 0, errNotAllowed)
+		rejected := backend
+		backend = nil
+		skipped++
+		for _, candidate := range poolBackends(balancer) {
+			if candidate == rejected || !candidate.Healthy {
+				continue
+			}
+			if allow(candidate) {
+				backend = candidate
+				Acquire(balancer, backend)
+				break
+			}
+			skipped++
+		}
+	}
+
+	unhealthy := unhealthyBackends(balancer)
+	var reason string
+	switch {
+	case backend == nil && skipped > 0:
+		reason = ReasonRateLimited
+	case backend == nil:
+		reason = ReasonNoHealthy
+	case skipped > 0:
+		reason = ReasonRateLimitSkip
+	case len(unhealthy) > 0:
+		reason = ReasonHealthSkip
+	default:
+		reason = strategyReason(balancer, key)
+	}
+
+	RecordDecision(pool, backend, reason, unhealthy)
+	return backend
+}
+
+// acquirer 需要在 Next 中登记在途请求的策略（最少连接数、峰值 EWMA）
+type acquirer interface {
+	Acquire(backend *Backend)
+}
+
+// Acquire 登记一次不经过 Next 的后端选择（如限流回退、故障转移规则或钩子指定的后端）
+// 与 Next 一样增加在途请求计数，请求结束后由 RecordResult 减少；不统计在途请求的策略不做处理
+// 参数：
+//   - balancer: 负载均衡器
+//   - backend: 选中的后端
+func Acquire(balancer LoadBalancer, backend *Backend) {
+	if a, ok := balancer.(acquirer); ok && backend != nil {
+		a.Acquire(backend)
+	}
+}
+
+// RecordDecision 记录一次后端选择
+// 参数：
+//   - pool: 后端池名称
+//   - backend: 选中的后端（nil 表示没有可用后端）
+//   - reason: 选择原因
+//   - unhealthy: 被跳过的不健康后端（仅用于调试日志）
+func RecordDecision(pool string, backend *Backend, reason string, unhealthy []string) {
+	name, url := "", ""
+	if backend != nil {
+		name, url = backend.Name, backend.URL
+	}
+	metrics.RecordLBDecision(pool, name, url, reason)
+
+	if decisionLog.Load() {
+		if len(unhealthy) > 0 {
+			log.Printf("负载均衡选择: pool=%s, backend=%s, reason=%s, 不健康后端=%v", pool, url, reason, unhealthy)
+		} else {
+			log.Printf("负载均衡选择: pool=%s, backend=%s, reason=%s", pool, url, reason)
+		}
+	}
+}
+
+// strategyReason 根据负载均衡器类型返回正常选择时的原因
+func strategyReason(balancer LoadBalancer, key string) string {
+	switch balancer.(type) {
+	case *Weighted:
+		return ReasonWeight
+	case *LeastConnections:
+		return ReasonLeastConn
+	case *LatencyBased:
+		return ReasonLatency
+	case *PeakEWMA:
+		return ReasonPeakEWMA
+	case *ConsistentHash:
+		if key != "" {
+			return ReasonHashKey
+		}
+	}
+	return ReasonRoundRobin
+}
+
+// poolBackends 返回池中的后端（负载均衡器不支持列出后端时返回 nil）
+func poolBackends(balancer LoadBalancer) []*Backend {
+	lister, ok := balancer.(interface{ GetBackends() []*Backend })
+	if !ok {
+		return nil
+	}
+	return lister.GetBackends()
+}
+
+// HealthyCount 统计池中健康的后端数量
+// 参数：
+//   - balancer: 负载均衡器
+//
+// 返回：
+//   - int: 健康后端数（负载均衡器不支持列出后端时为 0）
+func HealthyCount(balancer LoadBalancer) int {
+	count := 0
+	for _, b := range poolBackends(balancer) {
+		if b.Healthy {
+			count++
+		}
+	}
+	return count
+}
+
+// FindBackend 在池中按 URL 或名称查找后端
+// 参数：
+//   - balancer: 负载均衡器
+//   - target: 后端 URL 或名称
+//
+// 返回：
+//   - *Backend: 后端实例（未找到或负载均衡器不支持列出后端时返回 nil）
+func FindBackend(balancer LoadBalancer, target string) *Backend {
+	for _, b := range poolBackends(balancer) {
+		if b.URL == target || (b.Name != "" && b.Name == target) {
+			return b
+		}
+	}
+	return nil
+}
+
+// unhealthyBackends 返回池中标记为不健康的后端 URL
+func unhealthyBackends(balancer LoadBalancer) []string {
+	lister, ok := balancer.(interface{ GetBackends() []*Backend })
+	if !ok {
+		return nil
+	}
+
+	var result []string
+	for _, b := range lister.GetBackends() {
+		if !b.Healthy {
+			result = append(result, b.URL)
+		}
+	}
+	return result
+}
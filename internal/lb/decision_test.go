@@ -0,0 +1,105 @@
+package lb
+
+import (
+	"testing"
+	"time"
+)
+
+// inflightCounter 读取策略内部的在途请求计数
+type inflightCounter func(b *Backend) int
+
+func TestChooseAllowedKeepsInflightBalanced(t *testing.T) {
+	tests := []struct {
+		name     string
+		balancer LoadBalancer
+		count    func(LoadBalancer) inflightCounter
+	}{
+		{
+			name:     "最少连接数",
+			balancer: NewLeastConnections(testBackends(2), nil),
+			count: func(balancer LoadBalancer) inflightCounter {
+				lc := balancer.(*LeastConnections)
+				return func(b *Backend) int {
+					lc.mu.RLock()
+					defer lc.mu.RUnlock()
+					return lc.concurrent[b.URL]
+				}
+			},
+		},
+		{
+			name:     "峰值 EWMA",
+			balancer: NewPeakEWMA(testBackends(2), nil, 0),
+			count: func(balancer LoadBalancer) inflightCounter {
+				p := balancer.(*PeakEWMA)
+				return func(b *Backend) int {
+					p.mu.Lock()
+					defer p.mu.Unlock()
+					return p.stat(b.URL).pending
+				}
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			count := tt.count(tt.balancer)
+			backends := poolBackends(tt.balancer)
+			b0, b1 := backends[0], backends[1]
+
+			// 两个后端各有一个在途请求
+			if tt.balancer.Next() == nil || tt.balancer.Next() == nil {
+				t.Fatal("Next() = nil")
+			}
+			if count(b0) != 1 || count(b1) != 1 {
+				t.Fatalf("in-flight = %d/%d, want 1/1", count(b0), count(b1))
+			}
+
+			// b0 达到限流上限：回退到 b1，回退选择同样计入在途请求
+			onlyB1 := func(b *Backend) bool { return b == b1 }
+			for i := 0; i < 5; i++ {
+				got := ChooseAllowed(tt.balancer, "", DefaultPool, onlyB1)
+				if got != b1 {
+					t.Fatalf("ChooseAllowed() = %v, want b1", got)
+				}
+				if count(b0) != 1 || count(b1) != 2 {
+					t.Fatalf("in-flight during fallback = %d/%d, want 1/2", count(b0), count(b1))
+				}
+				tt.balancer.RecordResult(got, time.Millisecond, nil)
+			}
+
+			// 回退请求结束后不影响原有的在途请求
+			if count(b0) != 1 || count(b1) != 1 {
+				t.Errorf("in-flight after fallback requests = %d/%d, want 1/1", count(b0), count(b1))
+			}
+
+			// 没有可用后端时不登记
+			if got := ChooseAllowed(tt.balancer, "", DefaultPool, func(*Backend) bool { return false }); got != nil {
+				t.Fatalf("ChooseAllowed() = %v, want nil", got)
+			}
+			if count(b0) != 1 || count(b1) != 1 {
+				t.Errorf("in-flight after rejected choice = %d/%d, want 1/1", count(b0), count(b1))
+			}
+		})
+	}
+}
+
+func TestAcquireIgnoresStatelessStrategies(t *testing.T) {
+	for _, balancer := range []LoadBalancer{
+		NewRoundRobin(testBackends(2), nil),
+		NewWeighted(testBackends(2), nil),
+		NewConsistentHash(testBackends(2), nil, 0),
+	} {
+		backend := poolBackends(balancer)[0]
+		Acquire(balancer, backend)
+		Acquire(balancer, nil)
+		balancer.RecordResult(backend, 0, nil)
+	}
+
+	// 不在池中的后端（如故障转移规则指定的后端）同样成对计数
+	lc := NewLeastConnections(testBackends(1), nil).(*LeastConnections)
+	other := &Backend{URL: "http://other"}
+	Acquire(lc, other)
+	lc.RecordResult(other, 0, nil)
+	if lc.concurrent[other.URL] != 0 {
+		t.Errorf("in-flight for external backend = %d, want 0", lc.concurrent[other.URL])
+	}
+}
@@ -0,0 +1,202 @@
+package lb
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+)
+
+// HealthCheckTypeGRPC gRPC 健康检查探测方式
+const HealthCheckTypeGRPC = "grpc"
+
+// grpcHealthCheckPath grpc.health.v1.Health/Check 的请求路径
+const grpcHealthCheckPath = "/grpc.health.v1.Health/Check"
+
+// grpcServingStatusServing HealthCheckResponse.ServingStatus 中的 SERVING
+const grpcServingStatusServing = 1
+
+// grpcMaxResponseSize 健康检查响应的最大长度（HealthCheckResponse 只有一个枚举字段）
+const grpcMaxResponseSize = 1024
+
+// newGRPCHealthClient 创建 gRPC 健康检查使用的 HTTP/2 客户端
+// http 后端使用明文 HTTP/2（h2c），https 后端通过 TLS ALPN 协商 HTTP/2
+// 参数：
+//   - timeout: 单次检查超时
+//
+// 返回：
+//   - *http.Client: HTTP/2 客户端
+func newGRPCHealthClient(timeout time.Duration) *http.Client {
+	protocols := new(http.Protocols)
+	protocols.SetHTTP2(true)
+	protocols.SetUnencryptedHTTP2(true)
+	return &http.Client{
+		Timeout: timeout,
+		Transport: &http.Transport{
+			Protocols:       protocols,
+			TLSClientConfig: &tls.Config{MinVersion: tls.VersionTLS12},
+		},
+	}
+}
+
+// grpcHealthTarget 计算 gRPC 健康检查的目标地址（后端主机 + 配置的 gRPC 端口）
+// 参数：
+//   - backendURL: 后端 URL
+//   - port: gRPC 端口（0 表示使用后端 URL 的端口）
+//
+// 返回：
+//   - string: 目标地址（如 http://10.0.0.1:50051）
+//   - error: 后端 URL 无效时返回错误
+func grpcHealthTarget(backendURL string, port int) (string, error) {
+	u, err := url.Parse(backendURL)
+	if err != nil || u.Host == "" {
+		return "", fmt.Errorf("无效的后端 URL: %s", backendURL)
+	}
+	scheme := "http"
+	if u.Scheme == "https" {
+		scheme = "https"
+	}
+	host := u.Host
+	if port > 0 {
+		host = net.JoinHostPort(u.Hostname(), strconv.Itoa(port))
+	}
+	return scheme + "://" + host, nil
+}
+
+// checkGRPCHealth 调用 grpc.health.v1.Health/Check
+// 参数：
+//   - ctx: 上下文
+//   - client: HTTP/2 客户端
+//   - target: 目标地址
+//   - service: 检查的服务名（为空表示整个服务器）
+//
+// 返回：
+//   - bool: 服务状态是否为 SERVING
+//   - error: 请求失败或 gRPC 调用返回错误时返回错误
+func checkGRPCHealth(ctx context.Context, client *http.Client, target, service string) (bool, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, target+grpcHealthCheckPath, bytes.NewReader(grpcFrame(encodeHealthCheckRequest(service))))
+	if err != nil {
+		return false, err
+	}
+	req.Header.Set("Content-Type", "application/grpc")
+	req.Header.Set("TE", "trailers")
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return false, err
+	}
+	defer func() {
+		_ = resp.Body.Close()
+	}()
+	if resp.StatusCode != http.StatusOK {
+		return false, fmt.Errorf("HTTP %d", resp.StatusCode)
+	}
+
+	body, err := io.ReadAll(io.LimitReader(resp.Body, grpcMaxResponseSize))
+	if err != nil {
+		return false, err
+	}
+
+	// 出错时服务端只返回头部（Trailers-Only），grpc-status 位于响应头中
+	grpcStatus := resp.Trailer.Get("Grpc-Status")
+	if grpcStatus == "" {
+		grpcStatus = resp.Header.Get("Grpc-Status")
+	}
+	if grpcStatus != "0" {
+		message := resp.Trailer.Get("Grpc-Message")
+		if message == "" {
+			message = resp.Header.Get("Grpc-Message")
+		}
+		return false, fmt.Errorf("grpc-status=%s %s", grpcStatus, message)
+	}
+
+	msg, err := parseGRPCFrame(body)
+	if err != nil {
+		return false, err
+	}
+	return decodeHealthCheckStatus(msg) == grpcServingStatusServing, nil
+}
+
+// grpcFrame 按 gRPC 长度前缀格式封装消息（1 字节压缩标志 + 4 字节长度）
+func grpcFrame(msg []byte) []byte {
+	frame := make([]byte, 5+len(msg))
+	binary.BigEndian.PutUint32(frame[1:5], uint32(len(msg)))
+	copy(frame[5:], msg)
+	return frame
+}
+
+// parseGRPCFrame 解析第一条长度前缀消息
+func parseGRPCFrame(body []byte) ([]byte, error) {
+	if len(body) < 5 {
+		return nil, fmt.Errorf("响应消息不完整")
+	}
+	if body[0] != 0 {
+		return nil, fmt.Errorf("不支持压缩的响应消息")
+	}
+	n := binary.BigEndian.Uint32(body[1:5])
+	if uint32(len(body)-5) < n {
+		return nil, fmt.Errorf("响应消息不完整")
+	}
+	return body[5 : 5+n], nil
+}
+
+// encodeHealthCheckRequest 编码 HealthCheckRequest{service = 1}
+func encodeHealthCheckRequest(service string) []byte {
+	if service == "" {
+		return nil
+	}
+	msg := []byte{0x0a} // 字段 1，长度分隔类型
+	msg = binary.AppendUvarint(msg, uint64(len(service)))
+	return append(msg, service...)
+}
+
+// decodeHealthCheckStatus 解码 HealthCheckResponse 中的 status 字段（字段 1，varint）
+// 未知字段被跳过；缺少 status 时返回 0（UNKNOWN）
+func decodeHealthCheckStatus(msg []byte) uint64 {
+	var status uint64
+	for len(msg) > 0 {
+		tag, n := binary.Uvarint(msg)
+		if n <= 0 {
+			return 0
+		}
+		msg = msg[n:]
+		field, wireType := tag>>3, tag&0x7
+		switch wireType {
+		case 0: // varint
+			v, n := binary.Uvarint(msg)
+			if n <= 0 {
+				return 0
+			}
+			msg = msg[n:]
+			if field == 1 {
+				status = v
+			}
+		case 1: // 64 位
+			if len(msg) < 8 {
+				return 0
+			}
+			msg = msg[8:]
+		case 2: // 长度分隔
+			l, n := binary.Uvarint(msg)
+			if n <= 0 || uint64(len(msg)-n) < l {
+				return 0
+			}
+			msg = msg[n+int(l):]
+		case 5: // 32 位
+			if len(msg) < 4 {
+				return 0
+			}
+			msg = msg[4:]
+		default:
+			return 0
+		}
+	}
+	return status
+}
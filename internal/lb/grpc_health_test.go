@@ -0,0 +1,122 @@
+package lb
+
+import (
+	"context"
+	"net"
+	"strconv"
+	"testing"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/health"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+
+	"llmproxy/internal/config"
+)
+
+// startGRPCHealthServer 在本地端口启动 grpc.health.v1 服务，返回健康状态服务和监听端口
+func startGRPCHealthServer(t *testing.T) (*health.Server, int) {
+	t.Helper()
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	server := grpc.NewServer()
+	healthServer := health.NewServer()
+	healthpb.RegisterHealthServer(server, healthServer)
+	go func() {
+		_ = server.Serve(lis)
+	}()
+	t.Cleanup(server.Stop)
+	return healthServer, lis.Addr().(*net.TCPAddr).Port
+}
+
+func TestCheckGRPCHealth(t *testing.T) {
+	healthServer, port := startGRPCHealthServer(t)
+	healthServer.SetServingStatus("", healthpb.HealthCheckResponse_SERVING)
+	healthServer.SetServingStatus("llm.Inference", healthpb.HealthCheckResponse_NOT_SERVING)
+
+	client := newGRPCHealthClient(time.Second)
+	target := "http://127.0.0.1:" + strconv.Itoa(port)
+
+	tests := []struct {
+		name        string
+		service     string
+		wantServing bool
+		wantErr     bool
+	}{
+		{"整个服务器 SERVING", "", true, false},
+		{"服务 NOT_SERVING", "llm.Inference", false, false},
+		{"未注册的服务返回 NOT_FOUND", "unknown.Service", false, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			serving, err := checkGRPCHealth(context.Background(), client, target, tt.service)
+			if serving != tt.wantServing || (err != nil) != tt.wantErr {
+				t.Errorf("checkGRPCHealth(%q) = %v, %v; want %v, error = %v", tt.service, serving, err, tt.wantServing, tt.wantErr)
+			}
+		})
+	}
+
+	// 状态变化立即生效
+	healthServer.SetServingStatus("llm.Inference", healthpb.HealthCheckResponse_SERVING)
+	if serving, err := checkGRPCHealth(context.Background(), client, target, "llm.Inference"); err != nil || !serving {
+		t.Errorf("after SetServingStatus(SERVING): %v, %v; want true", serving, err)
+	}
+}
+
+func TestGRPCHealthCheckBackend(t *testing.T) {
+	healthServer, port := startGRPCHealthServer(t)
+
+	// 后端 URL 指向 HTTP 端口，健康检查使用单独配置的 gRPC 端口
+	backends := []*config.Backend{{Name: "vllm", URL: "http://127.0.0.1:1/v1", Weight: 1}}
+	base := NewBaseLoadBalancer(backends, &config.HealthCheckConfig{
+		Type:     HealthCheckTypeGRPC,
+		GRPCPort: port,
+		Timeout:  time.Second,
+	})
+	backend := base.GetBackends()[0]
+
+	healthServer.SetServingStatus("", healthpb.HealthCheckResponse_SERVING)
+	if !base.isHealthy(backend) {
+		t.Error("SERVING backend reported unhealthy")
+	}
+
+	healthServer.SetServingStatus("", healthpb.HealthCheckResponse_NOT_SERVING)
+	if base.isHealthy(backend) {
+		t.Error("NOT_SERVING backend reported healthy")
+	}
+
+	// 健康服务关闭（Shutdown 将所有服务置为 NOT_SERVING）
+	healthServer.SetServingStatus("", healthpb.HealthCheckResponse_SERVING)
+	healthServer.Shutdown()
+	if base.isHealthy(backend) {
+		t.Error("backend reported healthy after health server shutdown")
+	}
+
+	// 连接失败视为不健康
+	unreachable := NewBaseLoadBalancer(backends, &config.HealthCheckConfig{Type: HealthCheckTypeGRPC, Timeout: time.Second})
+	if unreachable.isHealthy(unreachable.GetBackends()[0]) {
+		t.Error("unreachable backend reported healthy")
+	}
+}
+
+func TestGRPCHealthTarget(t *testing.T) {
+	tests := []struct {
+		url     string
+		port    int
+		want    string
+		wantErr bool
+	}{
+		{"http://10.0.0.1:8000/v1", 50051, "http://10.0.0.1:50051", false},
+		{"https://api.example.com/v1", 0, "https://api.example.com", false},
+		{"http://[::1]:8000", 9000, "http://[::1]:9000", false},
+		{"not a url", 0, "", true},
+	}
+	for _, tt := range tests {
+		got, err := grpcHealthTarget(tt.url, tt.port)
+		if got != tt.want || (err != nil) != tt.wantErr {
+			t.Errorf("grpcHealthTarget(%q, %d) = %q, %v; want %q", tt.url, tt.port, got, err, tt.want)
+		}
+	}
+}
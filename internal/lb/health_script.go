@@ -0,0 +1,54 @@
+package lb
+
+import (
+	"net/http"
+	"sync/atomic"
+)
+
+// healthResponseLimit 交给健康检查脚本的响应体最大长度
+const healthResponseLimit = 64 * 1024
+
+// HealthCheckResponse 健康检查响应（交给健康检查脚本判断）
+type HealthCheckResponse struct {
+	StatusCode int         // HTTP 状态码
+	Header     http.Header // 响应头
+	Body       []byte      // 响应体（最多 64KB）
+}
+
+// HealthScript 健康检查后处理脚本
+// 由 scripting 包实现（lb 不能依赖脚本引擎），通过 SetHealthScript 注入
+type HealthScript interface {
+	// CheckHealth 根据响应判断后端是否健康
+	// 返回：
+	//   - bool: 是否健康
+	//   - bool: 脚本是否给出了结论（false 时按状态码判断）
+	//   - error: 脚本执行失败或超时
+	CheckHealth(backend *Backend, resp *HealthCheckResponse) (bool, bool, error)
+}
+
+// healthScriptHolder 包装 HealthScript，便于原子替换
+type healthScriptHolder struct {
+	script HealthScript
+}
+
+// healthScript 当前的健康检查脚本（为空表示只按状态码判断）
+var healthScript atomic.Pointer[healthScriptHolder]
+
+// SetHealthScript 设置 HTTP 健康检查的后处理脚本，脚本的结论覆盖状态码判断
+// 参数：
+//   - script: 健康检查脚本（nil 表示移除）
+func SetHealthScript(script HealthScript) {
+	if script == nil {
+		healthScript.Store(nil)
+		return
+	}
+	healthScript.Store(&healthScriptHolder{script: script})
+}
+
+// currentHealthScript 获取当前的健康检查脚本
+func currentHealthScript() HealthScript {
+	if holder := healthScript.Load(); holder != nil {
+		return holder.script
+	}
+	return nil
+}
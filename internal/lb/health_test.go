@@ -0,0 +1,290 @@
+package lb
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"llmproxy/internal/config"
+	"llmproxy/internal/metrics"
+)
+
+// metricSample 读取指定样本的当前值（不存在时返回空字符串）
+func metricSample(t *testing.T, sample string) string {
+	t.Helper()
+	rec := httptest.NewRecorder()
+	metrics.Handler(rec, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+	for _, line := range strings.Split(rec.Body.String(), "\n") {
+		if value, ok := strings.CutPrefix(line, sample+" "); ok {
+			return value
+		}
+	}
+	return ""
+}
+
+// waitForSample 等待样本达到期望值
+func waitForSample(t *testing.T, sample, want string) {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for time.Now().Before(deadline) {
+		if metricSample(t, sample) == want {
+			return
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+	t.Fatalf("%s = %q, want %q", sample, metricSample(t, sample), want)
+}
+
+func TestBackendHealthGauge(t *testing.T) {
+	metrics.Init(nil)
+	t.Cleanup(func() { metrics.Init(nil) })
+
+	// 模拟后端的 /health 返回值可切换
+	var healthy atomic.Bool
+	healthy.Store(true)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/health" || !healthy.Load() {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer server.Close()
+
+	rr := NewRoundRobin([]*config.Backend{{Name: "vllm-1", URL: server.URL}}, &config.HealthCheckConfig{
+		Interval: 10 * time.Millisecond,
+		Path:     "/health",
+	}).(*RoundRobin)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go rr.Start(ctx)
+
+	const gauge = `llmproxy_backend_healthy{backend="vllm-1"}`
+	waitForSample(t, gauge, "1")
+
+	healthy.Store(false)
+	waitForSample(t, gauge, "0")
+	if rr.Next() != nil {
+		t.Error("Next() returned the unhealthy backend")
+	}
+	if metricSample(t, `llmproxy_backend_checks_total{backend="vllm-1",result="unhealthy"}`) == "" {
+		t.Error("unhealthy checks not counted")
+	}
+
+	healthy.Store(true)
+	waitForSample(t, gauge, "1")
+	if metricSample(t, `llmproxy_backend_checks_total{backend="vllm-1",result="healthy"}`) == "" {
+		t.Error("healthy checks not counted")
+	}
+}
+
+func TestLogHealthChangeSetsGauge(t *testing.T) {
+	metrics.Init(nil)
+	t.Cleanup(func() { metrics.Init(nil) })
+
+	// 未命名的后端以 URL 作为标签
+	backend := &Backend{URL: "http://10.0.0.1:8000", Healthy: true}
+	w := NewWeighted(nil, nil).(*Weighted)
+	w.UpdateHealth(backend, false)
+	if got := metricSample(t, `llmproxy_backend_healthy{backend="http://10.0.0.1:8000"}`); got != "0" {
+		t.Errorf("gauge = %q, want 0", got)
+	}
+	w.UpdateHealth(backend, true)
+	if got := metricSample(t, `llmproxy_backend_healthy{backend="http://10.0.0.1:8000"}`); got != "1" {
+		t.Errorf("gauge = %q, want 1", got)
+	}
+}
+
+// mustStatusMatch 解析状态码规则，失败时终止测试
+func mustStatusMatch(t *testing.T, rule string) config.StatusMatch {
+	t.Helper()
+	m, err := config.ParseStatusMatch(rule)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return m
+}
+
+func TestHealthCheckHeaders(t *testing.T) {
+	// 只有带正确 Authorization 的探测才返回健康
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer probe-token" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer server.Close()
+	backends := []*config.Backend{{Name: "vllm-1", URL: server.URL}}
+
+	tests := []struct {
+		name    string
+		headers map[string]string
+		want    bool
+	}{
+		{"带 Authorization", map[string]string{"Authorization": "Bearer probe-token"}, true},
+		{"错误的 Token", map[string]string{"Authorization": "Bearer wrong"}, false},
+		{"不带请求头", nil, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			base := NewBaseLoadBalancer(backends, &config.HealthCheckConfig{Path: "/health", Headers: tt.headers})
+			if got := base.isHealthy(base.GetBackends()[0]); got != tt.want {
+				t.Errorf("isHealthy() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+
+	// 轮询负载均衡器的后台检查同样带上请求头
+	metrics.Init(nil)
+	t.Cleanup(func() { metrics.Init(nil) })
+	rr := NewRoundRobin(backends, &config.HealthCheckConfig{
+		Interval: 10 * time.Millisecond,
+		Headers:  map[string]string{"Authorization": "Bearer probe-token"},
+	}).(*RoundRobin)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go rr.Start(ctx)
+	deadline := time.Now().Add(5 * time.Second)
+	for metricSample(t, `llmproxy_backend_checks_total{backend="vllm-1",result="healthy"}`) == "" {
+		if time.Now().After(deadline) {
+			t.Fatal("no healthy background check recorded")
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+	if got := metricSample(t, `llmproxy_backend_checks_total{backend="vllm-1",result="unhealthy"}`); got != "" {
+		t.Errorf("unhealthy checks = %s, want none", got)
+	}
+}
+
+func TestHealthCheckBody(t *testing.T) {
+	var gotMethod, gotType, gotBody atomic.Value
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		gotMethod.Store(r.Method)
+		gotType.Store(r.Header.Get("Content-Type"))
+		gotBody.Store(string(body))
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer server.Close()
+	backends := []*config.Backend{{URL: server.URL}}
+
+	tests := []struct {
+		name       string
+		cfg        *config.HealthCheckConfig
+		wantMethod string
+		wantType   string
+	}{
+		{"配置 body 时默认 POST JSON", &config.HealthCheckConfig{Body: `{"model":"m","max_tokens":1}`}, http.MethodPost, "application/json"},
+		{"显式方法和 Content-Type", &config.HealthCheckConfig{Method: http.MethodPut, Body: "ping", Headers: map[string]string{"Content-Type": "text/plain"}}, http.MethodPut, "text/plain"},
+		{"没有 body 时默认 GET", &config.HealthCheckConfig{}, http.MethodGet, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			base := NewBaseLoadBalancer(backends, tt.cfg)
+			if !base.isHealthy(base.GetBackends()[0]) {
+				t.Fatal("isHealthy() = false")
+			}
+			if gotMethod.Load() != tt.wantMethod || gotType.Load() != tt.wantType || gotBody.Load() != tt.cfg.Body {
+				t.Errorf("request = %v %q body %q; want %s %q body %q", gotMethod.Load(), gotType.Load(), gotBody.Load(), tt.wantMethod, tt.wantType, tt.cfg.Body)
+			}
+		})
+	}
+}
+
+func TestHealthCheckExpectedStatus(t *testing.T) {
+	var status atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(int(status.Load()))
+	}))
+	defer server.Close()
+	backends := []*config.Backend{{URL: server.URL}}
+
+	tests := []struct {
+		rule   string
+		status int
+		want   bool
+	}{
+		{"", 204, true}, // 未配置时接受 2xx
+		{"", 301, false},
+		{"200", 204, false},
+		{"200-299", 204, true},
+		{"200-299", 503, false},
+		{"200,401", 401, true},
+		{"200,401", 403, false},
+	}
+	for _, tt := range tests {
+		cfg := &config.HealthCheckConfig{}
+		if tt.rule != "" {
+			cfg.ExpectedStatus = mustStatusMatch(t, tt.rule)
+		}
+		base := NewBaseLoadBalancer(backends, cfg)
+		status.Store(int32(tt.status))
+		if got := base.isHealthy(base.GetBackends()[0]); got != tt.want {
+			t.Errorf("expected_status %q, status %d: isHealthy() = %v, want %v", tt.rule, tt.status, got, tt.want)
+		}
+	}
+}
+
+// fakeHealthScript 返回固定结论的健康检查脚本，记录收到的响应
+type fakeHealthScript struct {
+	healthy, verdict bool
+	err              error
+	got              *HealthCheckResponse
+}
+
+func (s *fakeHealthScript) CheckHealth(backend *Backend, resp *HealthCheckResponse) (bool, bool, error) {
+	s.got = resp
+	return s.healthy, s.verdict, s.err
+}
+
+func TestHealthScriptOverridesStatus(t *testing.T) {
+	var status atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("X-Model-State", "loading")
+		w.WriteHeader(int(status.Load()))
+		_, _ = w.Write([]byte(`{"status":"degraded"}`))
+	}))
+	defer server.Close()
+	base := NewBaseLoadBalancer([]*config.Backend{{URL: server.URL}}, &config.HealthCheckConfig{})
+	t.Cleanup(func() { SetHealthScript(nil) })
+
+	tests := []struct {
+		name   string
+		status int
+		script *fakeHealthScript
+		want   bool
+	}{
+		{"200 被脚本判为不健康", 200, &fakeHealthScript{healthy: false, verdict: true}, false},
+		{"503 被脚本判为健康", 503, &fakeHealthScript{healthy: true, verdict: true}, true},
+		{"脚本未给出结论时按状态码", 503, &fakeHealthScript{}, false},
+		{"脚本出错时按状态码", 200, &fakeHealthScript{err: errors.New("boom")}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			SetHealthScript(tt.script)
+			status.Store(int32(tt.status))
+			if got := base.isHealthy(base.GetBackends()[0]); got != tt.want {
+				t.Errorf("isHealthy() = %v, want %v", got, tt.want)
+			}
+			// 脚本收到状态码、响应头和响应体
+			resp := tt.script.got
+			if resp == nil || resp.StatusCode != tt.status || resp.Header.Get("X-Model-State") != "loading" || string(resp.Body) != `{"status":"degraded"}` {
+				t.Errorf("script got %+v", resp)
+			}
+		})
+	}
+
+	// 移除脚本后恢复按状态码判断
+	SetHealthScript(nil)
+	status.Store(200)
+	if !base.isHealthy(base.GetBackends()[0]) {
+		t.Error("isHealthy() = false after removing the script")
+	}
+}
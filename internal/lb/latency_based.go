@@ -108,6 +108,29 @@ func (lb *LatencyBased) RecordResult(backend *Backend, latency time.Duration, er
 	}
 }
 
+// UpdateBackends 替换后端列表
+// 保留已存在后端的延迟统计，新后端使用默认延迟，移除已删除后端的统计
+// 参数：
+//   - backends: 新的后端配置列表
+func (lb *LatencyBased) UpdateBackends(backends []*config.Backend) {
+	lb.mu.Lock()
+	defer lb.mu.Unlock()
+
+	merged := lb.mergeBackends(backends)
+	urls := backendURLs(merged)
+	for url := range lb.latency {
+		if !urls[url] {
+			delete(lb.latency, url)
+		}
+	}
+	for _, b := range merged {
+		if _, ok := lb.latency[b.URL]; !ok {
+			lb.latency[b.URL] = 100 * time.Millisecond // 默认延迟
+		}
+	}
+	lb.setBackends(merged)
+}
+
 // Start 启动健康检查
 // 参数：
 //   - ctx: 上下文，用于取消健康检查
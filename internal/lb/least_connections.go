@@ -68,6 +68,16 @@ func (lc *LeastConnections) Next() *Backend {
 	return selected
 }
 
+// Acquire 登记一次不经过 Next 的后端选择（增加并发计数，由 RecordResult 减少）
+// 参数：
+//   - backend: 后端实例
+func (lc *LeastConnections) Acquire(backend *Backend) {
+	lc.mu.Lock()
+	defer lc.mu.Unlock()
+
+	lc.concurrent[backend.URL]++
+}
+
 // UpdateHealth 更新后端健康状态
 // 参数：
 //   - backend: 后端实例
@@ -96,6 +106,24 @@ func (lc *LeastConnections) RecordResult(backend *Backend, latency time.Duration
 	}
 }
 
+// UpdateBackends 替换后端列表
+// 保留已存在后端的并发计数（在途请求完成时仍会减少），移除已删除后端的计数
+// 参数：
+//   - backends: 新的后端配置列表
+func (lc *LeastConnections) UpdateBackends(backends []*config.Backend) {
+	lc.mu.Lock()
+	defer lc.mu.Unlock()
+
+	merged := lc.mergeBackends(backends)
+	urls := backendURLs(merged)
+	for url := range lc.concurrent {
+		if !urls[url] {
+			delete(lc.concurrent, url)
+		}
+	}
+	lc.setBackends(merged)
+}
+
 // Start 启动健康检查
 // 参数：
 //   - ctx: 上下文，用于取消健康检查
@@ -0,0 +1,202 @@
+package lb
+
+import (
+	"context"
+	"math"
+	"sync"
+	"time"
+
+	"llmproxy/internal/config"
+)
+
+// DefaultPeakEWMADecay 峰值 EWMA 的默认衰减时间常数
+const DefaultPeakEWMADecay = 10 * time.Second
+
+// peakEWMAPenalty 尚无延迟数据且已有请求在途的后端的代价（避免冷启动时把请求集中到未测量的后端）
+const peakEWMAPenalty = float64(time.Minute)
+
+// ewmaStat 单个后端的峰值 EWMA 统计
+type ewmaStat struct {
+	cost    float64   // 延迟的峰值 EWMA（纳秒，0 表示尚无数据）
+	stamp   time.Time // 上次更新时间
+	pending int       // 在途请求数
+}
+
+// PeakEWMA 峰值 EWMA 负载均衡器
+// 每个后端维护按时间衰减的延迟 EWMA：新延迟高于当前值时直接取新值（峰值），否则按距上次更新的时间衰减平滑；
+// 选择 代价 × (在途请求数 + 1) 最低的健康后端，同时考虑延迟和当前负载
+type PeakEWMA struct {
+	*BaseLoadBalancer                      // 嵌入基础负载均衡器
+	decay             time.Duration        // 衰减时间常数
+	stats             map[string]*ewmaStat // 每个后端的统计
+	now               func() time.Time     // 当前时间
+	mu                sync.Mutex           // 互斥锁
+}
+
+// NewPeakEWMA 创建峰值 EWMA 负载均衡器
+// 参数：
+//   - backends: 后端配置列表
+//   - healthCheck: 健康检查配置
+//   - decay: 衰减时间常数（<= 0 时使用默认值 10s）
+//
+// 返回：
+//   - LoadBalancer: 负载均衡器实例
+func NewPeakEWMA(backends []*config.Backend, healthCheck *config.HealthCheckConfig, decay time.Duration) LoadBalancer {
+	if decay <= 0 {
+		decay = DefaultPeakEWMADecay
+	}
+	lb := &PeakEWMA{
+		BaseLoadBalancer: NewBaseLoadBalancer(backends, healthCheck),
+		decay:            decay,
+		stats:            make(map[string]*ewmaStat),
+		now:              time.Now,
+	}
+
+	for _, b := range backends {
+		if b != nil {
+			lb.stats[b.URL] = &ewmaStat{}
+		}
+	}
+
+	return lb
+}
+
+// Next 获取代价最低的健康后端
+// 返回：
+//   - *Backend: 后端实例
+func (p *PeakEWMA) Next() *Backend {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	now := p.now()
+	var selected *Backend
+	minScore := math.Inf(1)
+
+	for _, backend := range p.GetBackends() {
+		if !backend.Healthy {
+			continue
+		}
+
+		score := p.score(p.stat(backend.URL), now)
+		if score < minScore {
+			minScore = score
+			selected = backend
+		}
+	}
+
+	if selected != nil {
+		// 增加在途请求数
+		p.stat(selected.URL).pending++
+	}
+
+	return selected
+}
+
+// score 计算后端的代价：衰减后的峰值 EWMA × (在途请求数 + 1)
+func (p *PeakEWMA) score(s *ewmaStat, now time.Time) float64 {
+	if s.cost == 0 {
+		// 尚无延迟数据：没有在途请求时优先尝试，有在途请求时等待首个结果
+		if s.pending == 0 {
+			return 0
+		}
+		return peakEWMAPenalty + float64(s.pending)
+	}
+	return p.decayed(s, now) * float64(s.pending+1)
+}
+
+// decayed 按距上次更新的时间衰减后的代价（空闲的后端代价逐渐降低，慢后端恢复后能重新获得流量）
+func (p *PeakEWMA) decayed(s *ewmaStat, now time.Time) float64 {
+	elapsed := now.Sub(s.stamp)
+	if elapsed <= 0 {
+		return s.cost
+	}
+	return s.cost * math.Exp(-float64(elapsed)/float64(p.decay))
+}
+
+// stat 获取后端统计（动态后端首次出现时创建），调用方需持有锁
+func (p *PeakEWMA) stat(url string) *ewmaStat {
+	s, ok := p.stats[url]
+	if !ok {
+		s = &ewmaStat{}
+		p.stats[url] = s
+	}
+	return s
+}
+
+// Acquire 登记一次不经过 Next 的后端选择（增加在途请求数，由 RecordResult 减少）
+// 参数：
+//   - backend: 后端实例
+func (p *PeakEWMA) Acquire(backend *Backend) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.stat(backend.URL).pending++
+}
+
+// UpdateHealth 更新后端健康状态
+// 参数：
+//   - backend: 后端实例
+//   - healthy: 健康状态
+func (p *PeakEWMA) UpdateHealth(backend *Backend, healthy bool) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	oldStatus := backend.Healthy
+	backend.Healthy = healthy
+	LogHealthChange(backend, oldStatus, healthy)
+}
+
+// RecordResult 记录请求结果：减少在途请求数，成功时更新峰值 EWMA
+// 参数：
+//   - backend: 后端实例
+//   - latency: 请求延迟
+//   - err: 错误信息（失败时不更新延迟统计）
+func (p *PeakEWMA) RecordResult(backend *Backend, latency time.Duration, err error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	s := p.stat(backend.URL)
+	if s.pending > 0 {
+		s.pending--
+	}
+	if err != nil {
+		return
+	}
+
+	now := p.now()
+	rtt := float64(latency)
+	if rtt > s.cost || s.cost == 0 {
+		// 峰值：延迟升高时立即生效
+		s.cost = rtt
+	} else {
+		// 延迟降低时按时间衰减平滑：间隔越长，新样本权重越大
+		w := math.Exp(-float64(now.Sub(s.stamp)) / float64(p.decay))
+		s.cost = s.cost*w + rtt*(1-w)
+	}
+	s.stamp = now
+}
+
+// UpdateBackends 替换后端列表
+// 保留已存在后端的统计，移除已删除后端的统计（新后端在首次选择时创建）
+// 参数：
+//   - backends: 新的后端配置列表
+func (p *PeakEWMA) UpdateBackends(backends []*config.Backend) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	merged := p.mergeBackends(backends)
+	urls := backendURLs(merged)
+	for url := range p.stats {
+		if !urls[url] {
+			delete(p.stats, url)
+		}
+	}
+	p.setBackends(merged)
+}
+
+// Start 启动健康检查
+// 参数：
+//   - ctx: 上下文，用于取消健康检查
+func (p *PeakEWMA) Start(ctx context.Context) {
+	p.StartHealthCheck(ctx, p.UpdateHealth, "峰值 EWMA")
+}
@@ -0,0 +1,119 @@
+package lb
+
+import (
+	"testing"
+	"time"
+)
+
+// newTestPeakEWMA 创建使用可手动推进时钟的峰值 EWMA 负载均衡器
+func newTestPeakEWMA(n int, decay time.Duration) (*PeakEWMA, *time.Time) {
+	p := NewPeakEWMA(testBackends(n), nil, decay).(*PeakEWMA)
+	now := time.Date(2026, 3, 15, 10, 0, 0, 0, time.UTC)
+	p.now = func() time.Time { return now }
+	return p, &now
+}
+
+func TestPeakEWMAPrefersFasterBackend(t *testing.T) {
+	p, now := newTestPeakEWMA(2, time.Second)
+	latencies := map[string]time.Duration{"b0": 20 * time.Millisecond, "b1": 200 * time.Millisecond}
+
+	// 串行请求：每个请求完成后再发下一个
+	counts := make(map[string]int)
+	for i := 0; i < 1000; i++ {
+		b := p.Next()
+		counts[b.Name]++
+		*now = now.Add(latencies[b.Name])
+		p.RecordResult(b, latencies[b.Name], nil)
+	}
+	if counts["b0"] < 900 {
+		t.Errorf("counts = %v, want most requests on the faster b0", counts)
+	}
+	if counts["b1"] == 0 {
+		t.Errorf("counts = %v, want the slow backend probed again after its cost decays", counts)
+	}
+}
+
+func TestPeakEWMAConcurrentLoad(t *testing.T) {
+	p, _ := newTestPeakEWMA(2, time.Second)
+	for _, b := range p.GetBackends() {
+		p.Acquire(b)
+		p.RecordResult(b, 10*time.Millisecond, nil)
+	}
+
+	// 延迟相同时按在途请求数分摊
+	var inflight []*Backend
+	counts := make(map[string]int)
+	for i := 0; i < 10; i++ {
+		b := p.Next()
+		counts[b.Name]++
+		inflight = append(inflight, b)
+	}
+	if counts["b0"] != 5 || counts["b1"] != 5 {
+		t.Errorf("counts = %v, want 5/5 with equal latency", counts)
+	}
+	for _, b := range inflight {
+		p.RecordResult(b, 10*time.Millisecond, nil)
+	}
+
+	// 延迟 1:4 时，快后端最多承担 4 倍的在途请求
+	p.RecordResult(p.GetBackends()[1], 40*time.Millisecond, nil)
+	counts = make(map[string]int)
+	for i := 0; i < 10; i++ {
+		counts[p.Next().Name]++
+	}
+	if counts["b0"] != 8 || counts["b1"] != 2 {
+		t.Errorf("counts = %v, want b0=8 b1=2 with a 1:4 latency ratio", counts)
+	}
+}
+
+func TestPeakEWMAPeakAndDecay(t *testing.T) {
+	p, now := newTestPeakEWMA(1, 10*time.Second)
+	b := p.GetBackends()[0]
+	s := p.stats[b.URL]
+
+	p.RecordResult(b, 100*time.Millisecond, nil)
+	// 延迟升高时立即取峰值
+	p.RecordResult(b, time.Second, nil)
+	if s.cost != float64(time.Second) {
+		t.Fatalf("cost after peak = %v, want 1s", time.Duration(s.cost))
+	}
+
+	// 较低的样本按时间平滑：间隔一个衰减常数时新样本权重为 1 - 1/e
+	*now = now.Add(10 * time.Second)
+	p.RecordResult(b, 100*time.Millisecond, nil)
+	if got := time.Duration(s.cost); got < 430*time.Millisecond || got > 435*time.Millisecond {
+		t.Errorf("smoothed cost = %v, want about 431ms", got)
+	}
+
+	// 失败的请求不更新延迟
+	p.RecordResult(b, 5*time.Second, errNotAllowed)
+	if got := time.Duration(s.cost); got > 435*time.Millisecond {
+		t.Errorf("cost after failed request = %v, want unchanged", got)
+	}
+
+	// 空闲时代价按时间衰减
+	before := p.decayed(s, *now)
+	*now = now.Add(10 * time.Second)
+	if after := p.decayed(s, *now); after >= before/2 {
+		t.Errorf("decayed cost %v -> %v, want it to shrink while idle", time.Duration(before), time.Duration(after))
+	}
+}
+
+func TestPeakEWMASkipsUnhealthyAndTriesNewBackends(t *testing.T) {
+	p, _ := newTestPeakEWMA(3, 0)
+	if p.decay != DefaultPeakEWMADecay {
+		t.Errorf("decay = %v, want default %v", p.decay, DefaultPeakEWMADecay)
+	}
+	backends := p.GetBackends()
+	p.UpdateHealth(backends[2], false)
+
+	// 尚无延迟数据的后端各尝试一次，等待首个结果前不再继续分配
+	first, second := p.Next(), p.Next()
+	if first == second || first.Name == "b2" || second.Name == "b2" {
+		t.Fatalf("Next() = %s, %s; want b0 and b1 once each", first.Name, second.Name)
+	}
+	p.RecordResult(first, 10*time.Millisecond, nil)
+	if got := p.Next(); got != first {
+		t.Errorf("Next() = %s, want %s with a known latency", got.Name, first.Name)
+	}
+}
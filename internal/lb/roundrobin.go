@@ -42,6 +42,11 @@ func (r *RoundRobin) Next() *Backend {
 		return nil
 	}
 
+	// 后端列表缩短后索引可能越界
+	if r.current >= len(backends) {
+		r.current = 0
+	}
+
 	// 尝试最多 len(backends) 次，找到健康的后端
 	attempts := 0
 	maxAttempts := len(backends)
@@ -83,6 +88,20 @@ func (r *RoundRobin) RecordResult(backend *Backend, latency time.Duration, err e
 	// 轮询策略不需要记录结果
 }
 
+// UpdateBackends 替换后端列表
+// 参数：
+//   - backends: 新的后端配置列表
+func (r *RoundRobin) UpdateBackends(backends []*config.Backend) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	merged := r.mergeBackends(backends)
+	r.setBackends(merged)
+	if r.current >= len(merged) {
+		r.current = 0
+	}
+}
+
 // Start 启动健康检查
 // 参数：
 //   - ctx: 上下文，用于取消健康检查
@@ -10,6 +10,7 @@ import (
 
 // Weighted 加权轮询负载均衡器
 // 使用平滑加权轮询算法 (Smooth Weighted Round-Robin)
+// 后端的权重和健康状态只在持有 mu 时读写，运行时调整权重需通过 SetWeight / UpdateBackends
 type Weighted struct {
 	*BaseLoadBalancer
 	weights []int      // 当前权重
@@ -37,6 +38,7 @@ func NewWeighted(backends []*config.Backend, healthCheck *config.HealthCheckConf
 // 1. 每次选择时，给每个后端的当前权重加上其原始权重
 // 2. 选择当前权重最大的健康后端
 // 3. 被选中的后端，当前权重减去所有后端的权重总和
+// 选择结果交错分布：权重 5:1 时顺序为 A A A B A A，而不是连续选择同一个后端
 //
 // 返回：
 //   - *Backend: 后端实例，如果没有健康后端则返回 nil
@@ -68,11 +70,10 @@ func (w *Weighted) Next() *Backend {
 	}
 
 	// 选择当前权重最大的健康后端
+	// 健康状态变化后剩余后端的当前权重可能全为负数，不能以固定值作为初始最大值，否则会返回 nil
 	maxIdx := -1
-	maxWeight := -1
 	for i, bk := range backends {
-		if bk.Healthy && w.weights[i] > maxWeight {
-			maxWeight = w.weights[i]
+		if bk.Healthy && (maxIdx < 0 || w.weights[i] > w.weights[maxIdx]) {
 			maxIdx = i
 		}
 	}
@@ -87,6 +88,54 @@ func (w *Weighted) Next() *Backend {
 	return backends[maxIdx]
 }
 
+// SetWeight 调整后端权重（运行时生效，不影响其他后端的当前权重）
+// 参数：
+//   - url: 后端 URL
+//   - weight: 新权重（<= 0 时按 1 处理）
+//
+// 返回：
+//   - bool: 是否找到该后端
+func (w *Weighted) SetWeight(url string, weight int) bool {
+	if weight <= 0 {
+		weight = 1
+	}
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	for _, bk := range w.GetBackends() {
+		if bk.URL == url {
+			bk.Weight = weight
+			return true
+		}
+	}
+	return false
+}
+
+// UpdateBackends 替换后端列表（后端集合或权重变化时调用）
+// 已存在的后端保留其健康状态和当前权重，新后端的当前权重从 0 开始
+// 参数：
+//   - backends: 新的后端配置列表
+func (w *Weighted) UpdateBackends(backends []*config.Backend) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	old := make(map[string]int, len(w.weights))
+	for i, b := range w.GetBackends() {
+		if i < len(w.weights) {
+			old[b.URL] = w.weights[i]
+		}
+	}
+
+	merged := w.mergeBackends(backends)
+	weights := make([]int, len(merged))
+	for i, b := range merged {
+		weights[i] = old[b.URL]
+	}
+	w.setBackends(merged)
+	w.weights = weights
+}
+
 // UpdateHealth 更新后端健康状态
 // 参数：
 //   - backend: 后端实例
@@ -0,0 +1,140 @@
+package lb
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+	"testing"
+
+	"llmproxy/internal/config"
+)
+
+func TestWeightedSetWeight(t *testing.T) {
+	w := NewWeighted(testBackends(2), nil).(*Weighted)
+
+	if !w.SetWeight("http://10.0.0.1:8000", 3) {
+		t.Fatal("SetWeight() = false for existing backend")
+	}
+	if w.SetWeight("http://10.0.0.9:8000", 3) {
+		t.Error("SetWeight() = true for unknown backend")
+	}
+
+	// 权重 3:1，每 4 次选择中 b0 出现 3 次
+	counts := make(map[string]int)
+	for i := 0; i < 400; i++ {
+		counts[w.Next().Name]++
+	}
+	if counts["b0"] != 300 || counts["b1"] != 100 {
+		t.Errorf("counts = %v, want b0=300 b1=100", counts)
+	}
+}
+
+func TestWeightedUpdateBackends(t *testing.T) {
+	w := NewWeighted(testBackends(2), nil).(*Weighted)
+	w.UpdateHealth(w.GetBackends()[1], false)
+
+	// 保留已有后端的健康状态，新增后端参与选择
+	w.UpdateBackends(testBackends(3))
+	counts := make(map[string]int)
+	for i := 0; i < 10; i++ {
+		counts[w.Next().Name]++
+	}
+	if counts["b1"] != 0 || counts["b0"] != 5 || counts["b2"] != 5 {
+		t.Errorf("counts = %v, want b0=5 b2=5 and unhealthy b1 skipped", counts)
+	}
+}
+
+func TestWeightedSmoothInterleaving(t *testing.T) {
+	w := NewWeighted([]*config.Backend{
+		{Name: "a", URL: "http://10.0.0.1:8000", Weight: 5},
+		{Name: "b", URL: "http://10.0.0.2:8000", Weight: 1},
+	}, nil).(*Weighted)
+
+	// 平滑加权轮询：5:1 时 b 穿插在 a 之间，而不是连续选择 5 次 a
+	var got []string
+	for i := 0; i < 12; i++ {
+		got = append(got, w.Next().Name)
+	}
+	want := "a a a b a a a a a b a a"
+	if s := strings.Join(got, " "); s != want {
+		t.Errorf("sequence = %q, want %q", s, want)
+	}
+}
+
+func TestWeightedAfterHealthChange(t *testing.T) {
+	w := NewWeighted([]*config.Backend{
+		{Name: "a", URL: "http://10.0.0.1:8000", Weight: 5},
+		{Name: "b", URL: "http://10.0.0.2:8000", Weight: 1},
+		{Name: "c", URL: "http://10.0.0.3:8000", Weight: 1},
+	}, nil).(*Weighted)
+	backends := w.GetBackends()
+
+	// b、c 刚被选中过，当前权重为较大的负数；a 下线后剩余后端的当前权重全为负数，仍要选出后端
+	w.weights = []int{3, -6, -6}
+	w.UpdateHealth(backends[0], false)
+	for i := 0; i < 4; i++ {
+		if b := w.Next(); b == nil || b.Name == "a" {
+			t.Fatalf("Next() #%d = %+v, want b or c", i+1, b)
+		}
+	}
+
+	// 全部下线时返回 nil
+	w.UpdateHealth(backends[1], false)
+	w.UpdateHealth(backends[2], false)
+	if b := w.Next(); b != nil {
+		t.Errorf("Next() with no healthy backend = %+v, want nil", b)
+	}
+}
+
+// TestWeightedConcurrentUpdates 并发选择与调整权重，需配合 -race 运行
+func TestWeightedConcurrentUpdates(t *testing.T) {
+	w := NewWeighted(testBackends(3), nil).(*Weighted)
+
+	var wg sync.WaitGroup
+	stop := make(chan struct{})
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for {
+				select {
+				case <-stop:
+					return
+				default:
+				}
+				if bk := w.Next(); bk == nil {
+					t.Error("Next() = nil with healthy backends")
+					return
+				}
+			}
+		}()
+	}
+
+	for i := 0; i < 200; i++ {
+		w.SetWeight(fmt.Sprintf("http://10.0.0.%d:8000", i%3+1), i%5+1)
+		// 后端数量在 2~4 之间变化，权重随之调整
+		backends := testBackends(i%3 + 2)
+		for j, b := range backends {
+			b.Weight = (i+j)%4 + 1
+		}
+		w.UpdateBackends(backends)
+		if i%10 == 0 {
+			w.UpdateHealth(w.GetBackends()[0], i%20 == 0)
+		}
+	}
+	close(stop)
+	wg.Wait()
+
+	// 最终状态下权重生效
+	w.UpdateBackends([]*config.Backend{
+		{Name: "a", URL: "http://a", Weight: 2},
+		{Name: "b", URL: "http://b", Weight: 1},
+	})
+	counts := make(map[string]int)
+	for i := 0; i < 30; i++ {
+		counts[w.Next().Name]++
+	}
+	if counts["a"] != 20 || counts["b"] != 10 {
+		t.Errorf("counts after updates = %v, want a=20 b=10", counts)
+	}
+}
@@ -0,0 +1,322 @@
+package logfile
+
+import (
+	"compress/gzip"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"llmproxy/internal/config"
+)
+
+// 轮转方式
+const (
+	RotateDaily  = "daily"  // 每天轮转
+	RotateHourly = "hourly" // 每小时轮转
+	RotateSize   = "size"   // 文件达到 max_size 时轮转
+)
+
+// 轮转默认参数
+const (
+	DefaultMaxSize = 100 // rotate=size 时的默认文件大小上限（MB）
+
+	backupTimeFormat = "2006-01-02T15-04-05.000" // 轮转文件名中的时间格式
+	compressSuffix   = ".gz"
+)
+
+// File 按配置轮转的日志文件（并发安全）
+// 轮转时当前文件重命名为 <name>-<时间><ext>，按需在后台压缩为 .gz，并删除超过 max_age 天的旧文件；
+// max_size 在任何轮转方式下都生效（daily / hourly 时为可选的附加上限）
+type File struct {
+	cfg     *config.LogFileConfig
+	perm    os.FileMode
+	maxSize int64
+
+	mu          sync.Mutex
+	file        *os.File
+	size        int64
+	periodStart time.Time      // 当前文件所属的轮转周期（daily / hourly）
+	bg          sync.WaitGroup // 后台压缩和清理任务
+	now         func() time.Time
+}
+
+// Open 打开日志文件（追加写入）
+// 参数：
+//   - cfg: 日志文件配置（rotate 为空时不轮转）
+//   - perm: 文件权限（轮转后的文件和压缩文件沿用该权限）
+//
+// 返回：
+//   - *File: 日志文件
+//   - error: 配置不合法或文件打开失败时返回错误
+func Open(cfg *config.LogFileConfig, perm os.FileMode) (*File, error) {
+	if cfg == nil || cfg.Path == "" {
+		return nil, fmt.Errorf("未配置日志文件路径")
+	}
+
+	f := &File{
+		cfg:  cfg,
+		perm: perm,
+		now:  time.Now,
+	}
+	switch cfg.Rotate {
+	case "", RotateDaily, RotateHourly:
+	case RotateSize:
+		if cfg.MaxSize <= 0 {
+			f.maxSize = DefaultMaxSize * 1024 * 1024
+		}
+	default:
+		return nil, fmt.Errorf("不支持的日志轮转方式: %s", cfg.Rotate)
+	}
+	if cfg.MaxSize > 0 {
+		f.maxSize = int64(cfg.MaxSize) * 1024 * 1024
+	}
+
+	if dir := filepath.Dir(cfg.Path); dir != "" {
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			return nil, fmt.Errorf("创建日志目录失败: %w", err)
+		}
+	}
+	if err := f.openExisting(); err != nil {
+		return nil, err
+	}
+	if cfg.Rotate != "" {
+		f.startCleanup()
+	}
+	return f, nil
+}
+
+// openExisting 打开（或创建）当前日志文件，以文件修改时间确定所属周期
+func (f *File) openExisting() error {
+	file, err := os.OpenFile(f.cfg.Path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, f.perm)
+	if err != nil {
+		return fmt.Errorf("打开日志文件失败: %w", err)
+	}
+	info, err := file.Stat()
+	if err != nil {
+		_ = file.Close()
+		return fmt.Errorf("读取日志文件信息失败: %w", err)
+	}
+
+	f.file = file
+	f.size = info.Size()
+	f.periodStart = f.period(info.ModTime())
+	if info.Size() == 0 {
+		f.periodStart = f.period(f.now())
+	}
+	return nil
+}
+
+// period 返回时间所属轮转周期的开始时间（非 daily / hourly 时返回零值）
+func (f *File) period(t time.Time) time.Time {
+	switch f.cfg.Rotate {
+	case RotateDaily:
+		y, m, d := t.Date()
+		return time.Date(y, m, d, 0, 0, 0, 0, t.Location())
+	case RotateHourly:
+		return t.Truncate(time.Hour)
+	}
+	return time.Time{}
+}
+
+// Write 写入日志，需要时先轮转
+func (f *File) Write(p []byte) (int, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if f.file == nil {
+		return 0, os.ErrClosed
+	}
+	if f.shouldRotate(int64(len(p))) {
+		if err := f.rotate(); err != nil {
+			// 轮转失败时继续写入当前文件，避免丢日志
+			log.Printf("日志文件轮转失败: %v", err)
+		}
+	}
+
+	n, err := f.file.Write(p)
+	f.size += int64(n)
+	return n, err
+}
+
+// shouldRotate 判断写入前是否需要轮转
+func (f *File) shouldRotate(n int64) bool {
+	if f.size == 0 {
+		return false
+	}
+	if f.maxSize > 0 && f.size+n > f.maxSize {
+		return true
+	}
+	if f.cfg.Rotate == RotateDaily || f.cfg.Rotate == RotateHourly {
+		return !f.period(f.now()).Equal(f.periodStart)
+	}
+	return false
+}
+
+// rotate 将当前文件重命名为轮转文件并打开新文件（调用方持有锁）
+func (f *File) rotate() error {
+	if err := f.file.Close(); err != nil {
+		return err
+	}
+	f.file = nil
+
+	backup := f.backupName(f.now())
+	if err := os.Rename(f.cfg.Path, backup); err != nil {
+		// 重命名失败时重新打开原文件继续写入
+		if openErr := f.openExisting(); openErr != nil {
+			return fmt.Errorf("%w（重新打开失败: %v）", err, openErr)
+		}
+		return err
+	}
+
+	file, err := os.OpenFile(f.cfg.Path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, f.perm)
+	if err != nil {
+		return fmt.Errorf("创建日志文件失败: %w", err)
+	}
+	f.file = file
+	f.size = 0
+	f.periodStart = f.period(f.now())
+
+	f.bg.Add(1)
+	go func() {
+		defer f.bg.Done()
+		if f.cfg.Compress {
+			if err := compressFile(backup, f.perm); err != nil {
+				log.Printf("压缩日志文件失败: %v", err)
+			}
+		}
+		f.prune()
+	}()
+	return nil
+}
+
+// backupName 生成轮转文件名：<name>-<时间><ext>
+func (f *File) backupName(t time.Time) string {
+	dir, name, ext := splitPath(f.cfg.Path)
+	return filepath.Join(dir, fmt.Sprintf("%s-%s%s", name, t.Format(backupTimeFormat), ext))
+}
+
+// splitPath 拆分日志路径为目录、文件名（不含扩展名）和扩展名
+func splitPath(path string) (string, string, string) {
+	dir := filepath.Dir(path)
+	base := filepath.Base(path)
+	ext := filepath.Ext(base)
+	return dir, strings.TrimSuffix(base, ext), ext
+}
+
+// startCleanup 在后台清理过期的轮转文件（启动时执行一次）
+func (f *File) startCleanup() {
+	f.bg.Add(1)
+	go func() {
+		defer f.bg.Done()
+		f.prune()
+	}()
+}
+
+// prune 删除超过 max_age 天的轮转文件（以文件名中的轮转时间判断）
+func (f *File) prune() {
+	if f.cfg.MaxAge <= 0 {
+		return
+	}
+	cutoff := f.now().Add(-time.Duration(f.cfg.MaxAge) * 24 * time.Hour)
+
+	backups, err := f.backups()
+	if err != nil {
+		log.Printf("读取日志目录失败: %v", err)
+		return
+	}
+	for _, b := range backups {
+		if b.rotatedAt.Before(cutoff) {
+			if err := os.Remove(b.path); err != nil && !os.IsNotExist(err) {
+				log.Printf("删除过期日志文件失败: %v", err)
+			}
+		}
+	}
+}
+
+// backup 轮转文件
+type backup struct {
+	path      string
+	rotatedAt time.Time
+}
+
+// backups 列出当前日志的轮转文件
+func (f *File) backups() ([]backup, error) {
+	dir, name, ext := splitPath(f.cfg.Path)
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	prefix := name + "-"
+	var result []backup
+	for _, e := range entries {
+		if e.IsDir() {
+			continue
+		}
+		fn := strings.TrimSuffix(e.Name(), compressSuffix)
+		if !strings.HasPrefix(fn, prefix) || !strings.HasSuffix(fn, ext) {
+			continue
+		}
+		ts := strings.TrimSuffix(strings.TrimPrefix(fn, prefix), ext)
+		t, err := time.ParseInLocation(backupTimeFormat, ts, time.Local)
+		if err != nil {
+			continue
+		}
+		result = append(result, backup{path: filepath.Join(dir, e.Name()), rotatedAt: t})
+	}
+	return result, nil
+}
+
+// compressFile 将文件压缩为 <path>.gz 并删除原文件
+func compressFile(path string, perm os.FileMode) error {
+	src, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = src.Close() }()
+
+	gzPath := path + compressSuffix
+	dst, err := os.OpenFile(gzPath, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, perm)
+	if err != nil {
+		return err
+	}
+
+	gz := gzip.NewWriter(dst)
+	if _, err := io.Copy(gz, src); err != nil {
+		_ = dst.Close()
+		_ = os.Remove(gzPath)
+		return err
+	}
+	if err := gz.Close(); err != nil {
+		_ = dst.Close()
+		_ = os.Remove(gzPath)
+		return err
+	}
+	if err := dst.Close(); err != nil {
+		_ = os.Remove(gzPath)
+		return err
+	}
+	return os.Remove(path)
+}
+
+// Close 等待后台压缩完成后关闭文件
+func (f *File) Close() error {
+	if f == nil {
+		return nil
+	}
+	f.mu.Lock()
+	file := f.file
+	f.file = nil
+	f.mu.Unlock()
+
+	f.bg.Wait()
+	if file != nil {
+		return file.Close()
+	}
+	return nil
+}
@@ -0,0 +1,209 @@
+package logfile
+
+import (
+	"compress/gzip"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	"llmproxy/internal/config"
+)
+
+// listDir 返回目录中的文件名（已排序）
+func listDir(t *testing.T, dir string) []string {
+	t.Helper()
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	names := make([]string, 0, len(entries))
+	for _, e := range entries {
+		names = append(names, e.Name())
+	}
+	sort.Strings(names)
+	return names
+}
+
+// readGzip 读取 gzip 文件解压后的内容
+func readGzip(t *testing.T, path string) string {
+	t.Helper()
+	file, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+	gz, err := gzip.NewReader(file)
+	if err != nil {
+		t.Fatalf("gzip.NewReader(%s) error = %v", path, err)
+	}
+	data, err := io.ReadAll(gz)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(data)
+}
+
+// mustWrite 写入一行日志
+func mustWrite(t *testing.T, f *File, line string) {
+	t.Helper()
+	if _, err := f.Write([]byte(line)); err != nil {
+		t.Fatalf("Write() error = %v", err)
+	}
+}
+
+func TestSizeRotationCompresses(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "access.log")
+	f, err := Open(&config.LogFileConfig{Path: path, Rotate: RotateSize, Compress: true}, 0o644)
+	if err != nil {
+		t.Fatalf("Open() error = %v", err)
+	}
+	// 以字节为单位的上限，避免写入 MB 级数据
+	f.maxSize = 100
+	f.now = func() time.Time { return time.Date(2026, 3, 15, 10, 0, 0, 0, time.Local) }
+
+	first := strings.Repeat("a", 59) + "\n"
+	second := strings.Repeat("b", 59) + "\n"
+	mustWrite(t, f, first)
+	mustWrite(t, f, second) // 60 + 60 > 100，写入前轮转
+	if err := f.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	want := []string{"access-2026-03-15T10-00-00.000.log.gz", "access.log"}
+	if got := listDir(t, dir); strings.Join(got, ",") != strings.Join(want, ",") {
+		t.Fatalf("files = %v, want %v", got, want)
+	}
+	if got := readGzip(t, filepath.Join(dir, want[0])); got != first {
+		t.Errorf("rotated content = %q, want first line", got)
+	}
+	if data, _ := os.ReadFile(path); string(data) != second {
+		t.Errorf("current content = %q, want second line", data)
+	}
+}
+
+func TestSizeRotationWithoutCompress(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "requests.jsonl")
+	f, err := Open(&config.LogFileConfig{Path: path, Rotate: RotateSize}, 0o600)
+	if err != nil {
+		t.Fatal(err)
+	}
+	f.maxSize = 10
+	now := time.Date(2026, 3, 15, 10, 0, 0, 0, time.Local)
+	f.now = func() time.Time { return now }
+
+	for _, line := range []string{"0123456789", "abcdefghij", "klmnopqrst"} {
+		mustWrite(t, f, line)
+		now = now.Add(time.Second)
+	}
+	_ = f.Close()
+
+	want := []string{"requests-2026-03-15T10-00-01.000.jsonl", "requests-2026-03-15T10-00-02.000.jsonl", "requests.jsonl"}
+	if got := listDir(t, dir); strings.Join(got, ",") != strings.Join(want, ",") {
+		t.Fatalf("files = %v, want %v", got, want)
+	}
+	if data, _ := os.ReadFile(filepath.Join(dir, want[0])); string(data) != "0123456789" {
+		t.Errorf("first backup = %q", data)
+	}
+}
+
+func TestDailyRotation(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "access.log")
+	f, err := Open(&config.LogFileConfig{Path: path, Rotate: RotateDaily}, 0o644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	now := time.Date(2026, 3, 15, 23, 59, 0, 0, time.Local)
+	f.now = func() time.Time { return now }
+	f.periodStart = f.period(now)
+
+	mustWrite(t, f, "day 1\n")
+	now = now.Add(30 * time.Second)
+	mustWrite(t, f, "day 1 again\n")
+	now = now.Add(time.Minute) // 跨过零点
+	mustWrite(t, f, "day 2\n")
+	_ = f.Close()
+
+	want := []string{"access-2026-03-16T00-00-30.000.log", "access.log"}
+	if got := listDir(t, dir); strings.Join(got, ",") != strings.Join(want, ",") {
+		t.Fatalf("files = %v, want %v", got, want)
+	}
+	if data, _ := os.ReadFile(filepath.Join(dir, want[0])); string(data) != "day 1\nday 1 again\n" {
+		t.Errorf("rotated content = %q", data)
+	}
+}
+
+func TestPruneByAge(t *testing.T) {
+	dir := t.TempDir()
+	now := time.Now()
+	old := now.AddDate(0, 0, -10).Format(backupTimeFormat)
+	recent := now.AddDate(0, 0, -2).Format(backupTimeFormat)
+	for _, name := range []string{
+		"access-" + old + ".log.gz",    // 过期的压缩文件
+		"access-" + old + ".log",       // 过期的未压缩文件
+		"access-" + recent + ".log.gz", // 未过期
+		"access-notatime.log",          // 文件名不是轮转格式
+		"other-" + old + ".log",        // 其他日志的轮转文件
+	} {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte("x"), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	f, err := Open(&config.LogFileConfig{Path: filepath.Join(dir, "access.log"), Rotate: RotateDaily, MaxAge: 7}, 0o644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_ = f.Close() // 等待启动时的清理完成
+
+	want := []string{"access-" + recent + ".log.gz", "access-notatime.log", "access.log", "other-" + old + ".log"}
+	sort.Strings(want)
+	if got := listDir(t, dir); strings.Join(got, ",") != strings.Join(want, ",") {
+		t.Errorf("files after prune = %v, want %v", got, want)
+	}
+}
+
+func TestRotationPrunesOldBackups(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "access.log")
+	f, err := Open(&config.LogFileConfig{Path: path, Rotate: RotateSize, Compress: true, MaxAge: 1}, 0o644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	f.bg.Wait() // 启动时的清理在后台读取时钟
+	f.maxSize = 5
+	now := time.Date(2026, 3, 10, 12, 0, 0, 0, time.Local)
+	f.now = func() time.Time { return now }
+
+	mustWrite(t, f, "12345")
+	mustWrite(t, f, "67890") // 轮转出 3 月 10 日的文件
+	f.bg.Wait()
+	now = now.AddDate(0, 0, 3)
+	mustWrite(t, f, "abcde") // 轮转出 3 月 13 日的文件，并删除 3 月 10 日的文件
+	_ = f.Close()
+
+	want := []string{"access-2026-03-13T12-00-00.000.log.gz", "access.log"}
+	if got := listDir(t, dir); strings.Join(got, ",") != strings.Join(want, ",") {
+		t.Errorf("files = %v, want %v", got, want)
+	}
+}
+
+func TestOpenErrors(t *testing.T) {
+	if _, err := Open(nil, 0o644); err == nil {
+		t.Error("Open(nil) error = nil")
+	}
+	if _, err := Open(&config.LogFileConfig{Path: filepath.Join(t.TempDir(), "a.log"), Rotate: "weekly"}, 0o644); err == nil {
+		t.Error("Open() with unsupported rotate: error = nil")
+	}
+
+	var f *File
+	if err := f.Close(); err != nil {
+		t.Errorf("nil Close() = %v", err)
+	}
+}
@@ -0,0 +1,179 @@
+package metrics
+
+import (
+	"regexp"
+	"strings"
+	"sync"
+)
+
+// backend 标签取值方式
+const (
+	BackendLabelName = "name" // 使用后端名称，未命名的后端使用 URL（默认）
+	BackendLabelURL  = "url"  // 使用后端 URL
+	BackendLabelNone = "none" // 不区分后端（标签值为空）
+)
+
+// model 标签默认值
+const (
+	DefaultMaxModelLabels = 50      // 未配置白名单时最多记录的不同模型数
+	ModelLabelOther       = "other" // 不在白名单内或超出上限的模型
+)
+
+// labelOptions 标签基数控制选项
+type labelOptions struct {
+	normalizePaths bool   // 是否将路径中的 ID 折叠为 :id
+	backendLabel   string // backend 标签取值方式
+}
+
+var (
+	labelMu   sync.RWMutex
+	labelOpts = labelOptions{backendLabel: BackendLabelName}
+)
+
+// uuidPattern UUID 路径段
+var uuidPattern = regexp.MustCompile(`^[0-9a-fA-F]{8}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{12}$`)
+
+// SetLabelOptions 设置指标标签的基数控制选项
+// 参数：
+//   - normalizePaths: 是否将路径中的 ID（纯数字、UUID、含数字的长随机串）折叠为 :id
+//   - backendLabel: backend 标签取值方式（name / url / none，空值等同 name）
+func SetLabelOptions(normalizePaths bool, backendLabel string) {
+	if backendLabel == "" {
+		backendLabel = BackendLabelName
+	}
+
+	labelMu.Lock()
+	defer labelMu.Unlock()
+	labelOpts = labelOptions{
+		normalizePaths: normalizePaths,
+		backendLabel:   backendLabel,
+	}
+}
+
+// modelLabeler model 标签取值控制
+type modelLabeler struct {
+	mu      sync.Mutex
+	allowed []string            // 模型白名单（支持 * 后缀通配），为空时按数量上限
+	max     int                 // 未配置白名单时最多记录的不同模型数
+	seen    map[string]struct{} // 已记录的模型
+}
+
+var modelLabels = &modelLabeler{max: DefaultMaxModelLabels, seen: make(map[string]struct{})}
+
+// SetModelLabels 设置 model 标签的基数控制
+// 配置白名单时只记录匹配的模型；否则按出现顺序记录前 max 个不同的模型。其余模型记为 other
+// 参数：
+//   - allowed: 模型白名单（支持 * 后缀通配，可为空）
+//   - max: 未配置白名单时最多记录的不同模型数（<= 0 时使用默认值 50）
+func SetModelLabels(allowed []string, max int) {
+	if max <= 0 {
+		max = DefaultMaxModelLabels
+	}
+
+	modelLabels.mu.Lock()
+	defer modelLabels.mu.Unlock()
+	modelLabels.allowed = allowed
+	modelLabels.max = max
+	modelLabels.seen = make(map[string]struct{})
+}
+
+// modelLabel 返回用作指标标签的模型名
+func modelLabel(model string) string {
+	if model == "" {
+		return ""
+	}
+
+	m := modelLabels
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if len(m.allowed) > 0 {
+		for _, pattern := range m.allowed {
+			if pattern == model || (strings.HasSuffix(pattern, "*") && strings.HasPrefix(model, strings.TrimSuffix(pattern, "*"))) {
+				return model
+			}
+		}
+		return ModelLabelOther
+	}
+
+	if _, ok := m.seen[model]; ok {
+		return model
+	}
+	if len(m.seen) >= m.max {
+		return ModelLabelOther
+	}
+	m.seen[model] = struct{}{}
+	return model
+}
+
+// pathLabel 返回用作指标标签的路径
+func pathLabel(path string) string {
+	labelMu.RLock()
+	normalize := labelOpts.normalizePaths
+	labelMu.RUnlock()
+
+	if !normalize {
+		return path
+	}
+	return NormalizePath(path)
+}
+
+// backendLabel 返回用作指标标签的后端标识
+func backendLabel(name, url string) string {
+	labelMu.RLock()
+	defer labelMu.RUnlock()
+
+	switch labelOpts.backendLabel {
+	case BackendLabelNone:
+		return ""
+	case BackendLabelName:
+		if name != "" {
+			return name
+		}
+	}
+	return url
+}
+
+// NormalizePath 将路径中的 ID 段折叠为 :id
+// 例如 /v1/files/123/content -> /v1/files/:id/content
+// 参数：
+//   - path: 请求路径
+//
+// 返回：
+//   - string: 归一化后的路径
+func NormalizePath(path string) string {
+	segments := strings.Split(path, "/")
+	for i, seg := range segments {
+		if isIDSegment(seg) {
+			segments[i] = ":id"
+		}
+	}
+	return strings.Join(segments, "/")
+}
+
+// isIDSegment 判断路径段是否为 ID
+// 纯数字、UUID，或长度不少于 16 且包含数字的字母数字串（如 file-abc123...、chatcmpl-xxx）
+func isIDSegment(seg string) bool {
+	if seg == "" {
+		return false
+	}
+	if uuidPattern.MatchString(seg) {
+		return true
+	}
+
+	hasDigit, allDigit := false, true
+	for _, c := range seg {
+		switch {
+		case c >= '0' && c <= '9':
+			hasDigit = true
+		case c >= 'a' && c <= 'z', c >= 'A' && c <= 'Z', c == '-', c == '_':
+			allDigit = false
+		default:
+			return false
+		}
+	}
+	if allDigit {
+		return true
+	}
+	return hasDigit && len(seg) >= 16
+}
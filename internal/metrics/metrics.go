@@ -3,84 +3,271 @@ package metrics
 import (
 	"net/http"
 	"strconv"
+	"sync"
+	"sync/atomic"
 
 	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
 	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"llmproxy/internal/config"
 )
 
-var (
-	// requestsTotal 请求总数
-	requestsTotal = prometheus.NewCounterVec(
-		prometheus.CounterOpts{
-			Name: "llmproxy_requests_total",
-			Help: "Total number of requests",
-		},
-		[]string{"path", "stream", "backend", "status"},
-	)
+// DefaultLatencyBuckets 默认的请求延迟分桶（毫秒），未配置 metrics.latency_buckets 时使用
+var DefaultLatencyBuckets = []float64{10, 50, 100, 200, 500, 1000, 2000, 5000, 10000}
 
-	// latencyMs 请求延迟（毫秒）
-	latencyMs = prometheus.NewHistogramVec(
-		prometheus.HistogramOpts{
-			Name:    "llmproxy_latency_ms",
-			Help:    "Request latency in milliseconds",
-			Buckets: []float64{10, 50, 100, 200, 500, 1000, 2000, 5000, 10000},
-		},
-		[]string{"path", "stream", "backend"},
-	)
+// Metrics Prometheus 指标集合
+// 所有指标注册在独立的 Registry 上，便于按配置重建
+type Metrics struct {
+	registry *prometheus.Registry
+	handler  http.Handler // /metrics 端点 handler
 
-	// webhookSuccess Webhook 成功数
-	webhookSuccess = prometheus.NewCounter(
-		prometheus.CounterOpts{
-			Name: "llmproxy_webhook_success_total",
-			Help: "Total number of successful webhook calls",
-		},
-	)
+	requestsTotal  *prometheus.CounterVec   // 请求总数
+	latencyMs      *prometheus.HistogramVec // 请求延迟（毫秒）
+	errorsTotal    *prometheus.CounterVec   // 错误请求数（按模型和错误类别）
+	webhookSuccess prometheus.Counter       // Webhook 成功数
+	webhookFailure prometheus.Counter       // Webhook 失败数
+	usageTokens    *prometheus.CounterVec   // Token 使用量
+	shadowUsage    *prometheus.CounterVec   // 影子用量上报结果（不计入 webhookSuccess / webhookFailure）
+	lbDecisions    *prometheus.CounterVec   // 负载均衡选择次数（按后端池、后端和选择原因）
+	modelFallbacks *prometheus.CounterVec   // 模型降级次数（按原模型和替代模型）
+	inflight       prometheus.Gauge         // 正在处理的请求数
+	backendHealthy *prometheus.GaugeVec     // 后端健康状态（1 健康 / 0 不健康）
+	backendChecks  *prometheus.CounterVec   // 后端健康检查次数（按结果）
+	storageUp      *prometheus.GaugeVec     // 存储连接健康状态（1 可用 / 0 不可用）
+	mirrorTotal    *prometheus.CounterVec   // 镜像请求数（按模型和影子后端状态码）
+	mirrorMs       *prometheus.HistogramVec // 镜像请求延迟（毫秒）
+	canaryTotal    *prometheus.CounterVec   // 金丝雀分流请求数（按模型和实际服务的一侧）
+	usageSpilled   *prometheus.GaugeVec     // 用量溢出文件 / 死信队列中等待重放的记录数（按上报器）
+}
 
-	// webhookFailure Webhook 失败数
-	webhookFailure = prometheus.NewCounter(
-		prometheus.CounterOpts{
-			Name: "llmproxy_webhook_failure_total",
-			Help: "Total number of failed webhook calls",
-		},
-	)
+// std 全局指标集合，由 Init 按配置替换
+var std atomic.Pointer[Metrics]
 
-	// usageTokens Token 使用量
-	usageTokens = prometheus.NewCounterVec(
-		prometheus.CounterOpts{
-			Name: "llmproxy_usage_tokens_total",
-			Help: "Total number of tokens used",
-		},
-		[]string{"type"}, // type: prompt, completion
-	)
-)
+// inflightCount 在途请求数，与 llmproxy_inflight_requests 同步增减（不随 Init 重建，供关闭时排空读取）
+var inflightCount atomic.Int64
 
 func init() {
-	// 注册所有指标
-	prometheus.MustRegister(requestsTotal)
-	prometheus.MustRegister(latencyMs)
-	prometheus.MustRegister(webhookSuccess)
-	prometheus.MustRegister(webhookFailure)
-	prometheus.MustRegister(usageTokens)
+	std.Store(New(nil))
+}
+
+// New 按配置创建指标集合
+// 参数：
+//   - cfg: 指标配置（为 nil 或未配置 latency_buckets 时使用默认分桶）
+//
+// 返回：
+//   - *Metrics: 指标集合（已注册 Go 运行时和进程指标）
+func New(cfg *config.MetricsConfig) *Metrics {
+	buckets := DefaultLatencyBuckets
+	if cfg != nil && len(cfg.LatencyBuckets) > 0 {
+		buckets = cfg.LatencyBuckets
+	}
+
+	m := &Metrics{
+		registry: prometheus.NewRegistry(),
+		requestsTotal: prometheus.NewCounterVec(
+			prometheus.CounterOpts{
+				Name: "llmproxy_requests_total",
+				Help: "Total number of requests",
+			},
+			[]string{"path", "model", "stream", "backend", "status"},
+		),
+		latencyMs: prometheus.NewHistogramVec(
+			prometheus.HistogramOpts{
+				Name:    "llmproxy_latency_ms",
+				Help:    "Request latency in milliseconds",
+				Buckets: buckets,
+			},
+			[]string{"path", "model", "stream", "backend"},
+		),
+		errorsTotal: prometheus.NewCounterVec(
+			prometheus.CounterOpts{
+				Name: "llmproxy_errors_total",
+				Help: "Total number of failed requests by model and error class",
+			},
+			[]string{"model", "class"}, // class: client_error, rate_limited, server_error, timeout
+		),
+		webhookSuccess: prometheus.NewCounter(
+			prometheus.CounterOpts{
+				Name: "llmproxy_webhook_success_total",
+				Help: "Total number of successful webhook calls",
+			},
+		),
+		webhookFailure: prometheus.NewCounter(
+			prometheus.CounterOpts{
+				Name: "llmproxy_webhook_failure_total",
+				Help: "Total number of failed webhook calls",
+			},
+		),
+		usageTokens: prometheus.NewCounterVec(
+			prometheus.CounterOpts{
+				Name: "llmproxy_usage_tokens_total",
+				Help: "Total number of tokens used",
+			},
+			[]string{"type"}, // type: prompt, completion
+		),
+		shadowUsage: prometheus.NewCounterVec(
+			prometheus.CounterOpts{
+				Name: "llmproxy_shadow_usage_total",
+				Help: "Total number of shadow usage reports by result",
+			},
+			[]string{"reporter", "result"}, // result: success, failure
+		),
+		usageSpilled: prometheus.NewGaugeVec(
+			prometheus.GaugeOpts{
+				Name: "llmproxy_usage_spilled_records",
+				Help: "Number of usage records waiting in a spill file or dead-letter queue",
+			},
+			[]string{"reporter"},
+		),
+		lbDecisions: prometheus.NewCounterVec(
+			prometheus.CounterOpts{
+				Name: "llmproxy_lb_decisions_total",
+				Help: "Total number of load balancer backend selections by reason",
+			},
+			[]string{"pool", "backend", "reason"},
+		),
+		modelFallbacks: prometheus.NewCounterVec(
+			prometheus.CounterOpts{
+				Name: "llmproxy_model_fallback_total",
+				Help: "Total number of requests served by a fallback model",
+			},
+			[]string{"from", "to"},
+		),
+		inflight: prometheus.NewGauge(
+			prometheus.GaugeOpts{
+				Name: "llmproxy_inflight_requests",
+				Help: "Number of proxy requests currently being served",
+			},
+		),
+		backendHealthy: prometheus.NewGaugeVec(
+			prometheus.GaugeOpts{
+				Name: "llmproxy_backend_healthy",
+				Help: "Whether the backend is healthy (1) or not (0)",
+			},
+			[]string{"backend"},
+		),
+		backendChecks: prometheus.NewCounterVec(
+			prometheus.CounterOpts{
+				Name: "llmproxy_backend_checks_total",
+				Help: "Total number of backend health checks by result",
+			},
+			[]string{"backend", "result"}, // result: healthy, unhealthy
+		),
+		storageUp: prometheus.NewGaugeVec(
+			prometheus.GaugeOpts{
+				Name: "llmproxy_storage_up",
+				Help: "Whether the storage connection answered its last health check (1) or not (0)",
+			},
+			[]string{"kind", "connection"}, // kind: database, replica, cache
+		),
+		mirrorTotal: prometheus.NewCounterVec(
+			prometheus.CounterOpts{
+				Name: "llmproxy_mirror_requests_total",
+				Help: "Total number of requests mirrored to the shadow backend by result",
+			},
+			[]string{"model", "status"}, // status: 影子后端状态码，或 error / dropped
+		),
+		mirrorMs: prometheus.NewHistogramVec(
+			prometheus.HistogramOpts{
+				Name:    "llmproxy_mirror_latency_ms",
+				Help:    "Shadow backend latency in milliseconds",
+				Buckets: buckets,
+			},
+			[]string{"model"},
+		),
+		canaryTotal: prometheus.NewCounterVec(
+			prometheus.CounterOpts{
+				Name: "llmproxy_canary_requests_total",
+				Help: "Total number of canary-matched requests by the arm that served them",
+			},
+			[]string{"model", "arm"}, // arm: canary, stable
+		),
+	}
+
+	// 注册所有指标（与默认 Registry 一样包含 Go 运行时和进程指标）
+	m.registry.MustRegister(
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+		m.requestsTotal,
+		m.latencyMs,
+		m.errorsTotal,
+		m.webhookSuccess,
+		m.webhookFailure,
+		m.usageTokens,
+		m.lbDecisions,
+		m.shadowUsage,
+		m.modelFallbacks,
+		m.inflight,
+		m.backendHealthy,
+		m.backendChecks,
+		m.storageUp,
+		m.mirrorTotal,
+		m.mirrorMs,
+		m.canaryTotal,
+		m.usageSpilled,
+	)
+	m.handler = promhttp.InstrumentMetricHandler(m.registry, promhttp.HandlerFor(m.registry, promhttp.HandlerOpts{}))
+	return m
+}
+
+// Init 按配置重建全局指标集合
+// 应在开始处理请求前调用，此前记录的指标会被丢弃
+// 参数：
+//   - cfg: 指标配置
+func Init(cfg *config.MetricsConfig) {
+	std.Store(New(cfg))
 }
 
 // Handler 返回 Prometheus metrics handler
 func Handler(w http.ResponseWriter, r *http.Request) {
-	promhttp.Handler().ServeHTTP(w, r)
+	std.Load().Handler().ServeHTTP(w, r)
+}
+
+// Handler 返回该指标集合的 HTTP handler
+func (m *Metrics) Handler() http.Handler {
+	return m.handler
 }
 
 // RecordRequest 记录请求指标
+// 状态码 >= 400 时同时计入 llmproxy_errors_total
 // 参数：
 //   - path: 请求路径
+//   - model: 请求的模型名（按白名单 / 数量上限折叠，见 SetModelLabels）
 //   - isStream: 是否为流式请求
-//   - backend: 后端 URL
+//   - backendName: 后端名称（为空时使用 URL）
+//   - backendURL: 后端 URL
 //   - latency: 请求延迟
 //   - statusCode: HTTP 状态码
-func RecordRequest(path string, isStream bool, backend string, latency float64, statusCode int) {
+func RecordRequest(path, model string, isStream bool, backendName, backendURL string, latency float64, statusCode int) {
 	streamStr := strconv.FormatBool(isStream)
 	statusStr := strconv.Itoa(statusCode)
+	path = pathLabel(path)
+	model = modelLabel(model)
+	backend := backendLabel(backendName, backendURL)
+
+	m := std.Load()
+	m.requestsTotal.WithLabelValues(path, model, streamStr, backend, statusStr).Inc()
+	m.latencyMs.WithLabelValues(path, model, streamStr, backend).Observe(latency)
+	if class := errorClass(statusCode); class != "" {
+		m.errorsTotal.WithLabelValues(model, class).Inc()
+	}
+}
 
-	requestsTotal.WithLabelValues(path, streamStr, backend, statusStr).Inc()
-	latencyMs.WithLabelValues(path, streamStr, backend).Observe(latency)
+// errorClass 按状态码划分错误类别
+// 返回：
+//   - string: client_error / rate_limited / server_error / timeout（非错误时为空）
+func errorClass(statusCode int) string {
+	switch {
+	case statusCode == http.StatusTooManyRequests:
+		return "rate_limited"
+	case statusCode == http.StatusGatewayTimeout:
+		return "timeout"
+	case statusCode >= 500:
+		return "server_error"
+	case statusCode >= 400:
+		return "client_error"
+	}
+	return ""
 }
 
 // RecordUsage 记录 Token 使用量
@@ -88,16 +275,137 @@ func RecordRequest(path string, isStream bool, backend string, latency float64,
 //   - promptTokens: 输入 token 数
 //   - completionTokens: 输出 token 数
 func RecordUsage(promptTokens, completionTokens int) {
-	usageTokens.WithLabelValues("prompt").Add(float64(promptTokens))
-	usageTokens.WithLabelValues("completion").Add(float64(completionTokens))
+	m := std.Load()
+	m.usageTokens.WithLabelValues("prompt").Add(float64(promptTokens))
+	m.usageTokens.WithLabelValues("completion").Add(float64(completionTokens))
 }
 
 // RecordWebhookSuccess 记录 Webhook 成功
 func RecordWebhookSuccess() {
-	webhookSuccess.Inc()
+	std.Load().webhookSuccess.Inc()
 }
 
 // RecordWebhookFailure 记录 Webhook 失败
 func RecordWebhookFailure() {
-	webhookFailure.Inc()
+	std.Load().webhookFailure.Inc()
+}
+
+// RecordShadowUsage 记录影子用量上报结果
+// 参数：
+//   - reporter: 上报器名称
+//   - success: 是否成功
+func RecordShadowUsage(reporter string, success bool) {
+	result := "success"
+	if !success {
+		result = "failure"
+	}
+	std.Load().shadowUsage.WithLabelValues(reporter, result).Inc()
+}
+
+// SetUsageSpilled 记录用量溢出文件 / 死信队列中等待重放的记录数
+// 参数：
+//   - reporter: 上报器名称
+//   - n: 记录数
+func SetUsageSpilled(reporter string, n int) {
+	std.Load().usageSpilled.WithLabelValues(reporter).Set(float64(n))
+}
+
+// RecordLBDecision 记录一次负载均衡选择
+// 参数：
+//   - pool: 后端池名称
+//   - backendName: 选中的后端名称（为空时使用 URL）
+//   - backendURL: 选中的后端 URL（没有可用后端时为空）
+//   - reason: 选择原因
+func RecordLBDecision(pool, backendName, backendURL, reason string) {
+	std.Load().lbDecisions.WithLabelValues(pool, backendLabel(backendName, backendURL), reason).Inc()
+}
+
+// RecordModelFallback 记录一次模型降级
+// 参数：
+//   - from: 原模型
+//   - to: 实际使用的替代模型
+func RecordModelFallback(from, to string) {
+	std.Load().modelFallbacks.WithLabelValues(from, to).Inc()
+}
+
+// SetBackendHealthy 记录后端当前的健康状态
+// 参数：
+//   - backendName: 后端名称（为空时使用 URL）
+//   - backendURL: 后端 URL
+//   - healthy: 是否健康
+func SetBackendHealthy(backendName, backendURL string, healthy bool) {
+	value := 0.0
+	if healthy {
+		value = 1
+	}
+	std.Load().backendHealthy.WithLabelValues(backendLabel(backendName, backendURL)).Set(value)
+}
+
+// RecordBackendCheck 记录一次后端健康检查结果
+// 参数：
+//   - backendName: 后端名称（为空时使用 URL）
+//   - backendURL: 后端 URL
+//   - healthy: 检查是否通过
+func RecordBackendCheck(backendName, backendURL string, healthy bool) {
+	result := "healthy"
+	if !healthy {
+		result = "unhealthy"
+	}
+	std.Load().backendChecks.WithLabelValues(backendLabel(backendName, backendURL), result).Inc()
+}
+
+// SetStorageUp 记录存储连接当前的健康状态
+// 参数：
+//   - kind: 连接类型（database / replica / cache）
+//   - name: 连接名称
+//   - up: 是否可用
+func SetStorageUp(kind, name string, up bool) {
+	value := 0.0
+	if up {
+		value = 1
+	}
+	std.Load().storageUp.WithLabelValues(kind, name).Set(value)
+}
+
+// RecordMirror 记录一次镜像请求（与主请求的指标分开统计）
+// 参数：
+//   - model: 模型名
+//   - status: 影子后端状态码，或 error（请求失败）/ dropped（并发已满，未发送）
+//   - latency: 影子请求延迟（毫秒，dropped 时不记录）
+func RecordMirror(model, status string, latency float64) {
+	model = modelLabel(model)
+	m := std.Load()
+	m.mirrorTotal.WithLabelValues(model, status).Inc()
+	if status != "dropped" {
+		m.mirrorMs.WithLabelValues(model).Observe(latency)
+	}
+}
+
+// RecordCanary 记录一次金丝雀分流
+// 参数：
+//   - model: 模型名
+//   - arm: 实际服务请求的一侧（canary / stable）
+func RecordCanary(model, arm string) {
+	std.Load().canaryTotal.WithLabelValues(modelLabel(model), arm).Inc()
+}
+
+// InFlightStart 记录一个请求开始处理
+// 返回：
+//   - func(): 请求结束时调用（通常 defer），只生效一次
+func InFlightStart() func() {
+	g := std.Load().inflight
+	g.Inc()
+	inflightCount.Add(1)
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			g.Dec()
+			inflightCount.Add(-1)
+		})
+	}
+}
+
+// InFlight 返回当前在途请求数（包括未结束的流式响应）
+func InFlight() int64 {
+	return inflightCount.Load()
 }
@@ -0,0 +1,224 @@
+package metrics
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"llmproxy/internal/config"
+)
+
+// resetMetrics 按配置重建全局指标集合并恢复默认标签选项
+func resetMetrics(t *testing.T, cfg *config.MetricsConfig) {
+	t.Helper()
+	Init(cfg)
+	SetLabelOptions(false, "")
+	SetModelLabels(nil, 0)
+	t.Cleanup(func() {
+		Init(nil)
+		SetLabelOptions(false, "")
+		SetModelLabels(nil, 0)
+	})
+}
+
+// scrape 抓取 /metrics 端点的文本输出
+func scrape(t *testing.T) string {
+	t.Helper()
+	rec := httptest.NewRecorder()
+	Handler(rec, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("scrape: status = %d", rec.Code)
+	}
+	body, _ := io.ReadAll(rec.Body)
+	return string(body)
+}
+
+// assertSample 断言输出中包含指定样本行
+func assertSample(t *testing.T, body, sample string) {
+	t.Helper()
+	for _, line := range strings.Split(body, "\n") {
+		if line == sample {
+			return
+		}
+	}
+	t.Errorf("missing sample %q", sample)
+}
+
+// assertNoSample 断言输出中没有以指定前缀开头的样本行
+func assertNoSample(t *testing.T, body, prefix string) {
+	t.Helper()
+	for _, line := range strings.Split(body, "\n") {
+		if strings.HasPrefix(line, prefix) {
+			t.Errorf("unexpected sample %q", line)
+		}
+	}
+}
+
+func TestRecordRequestLabels(t *testing.T) {
+	resetMetrics(t, nil)
+
+	RecordRequest("/v1/chat/completions", "gpt-4o", true, "vllm-1", "http://vllm-1:8000", 120, 200)
+	RecordRequest("/v1/chat/completions", "gpt-4o", true, "vllm-1", "http://vllm-1:8000", 80, 200)
+	RecordRequest("/v1/chat/completions", "llama-3", false, "", "http://vllm-2:8000", 30, 429)
+	RecordRequest("/v1/chat/completions", "llama-3", false, "", "http://vllm-2:8000", 3000, 504)
+	RecordRequest("/v1/completions", "gpt-4o", false, "vllm-1", "http://vllm-1:8000", 10, 400)
+
+	body := scrape(t)
+	assertSample(t, body, `llmproxy_requests_total{backend="vllm-1",model="gpt-4o",path="/v1/chat/completions",status="200",stream="true"} 2`)
+	// 未命名的后端使用 URL
+	assertSample(t, body, `llmproxy_requests_total{backend="http://vllm-2:8000",model="llama-3",path="/v1/chat/completions",status="429",stream="false"} 1`)
+	assertSample(t, body, `llmproxy_latency_ms_count{backend="vllm-1",model="gpt-4o",path="/v1/chat/completions",stream="true"} 2`)
+	assertSample(t, body, `llmproxy_latency_ms_sum{backend="vllm-1",model="gpt-4o",path="/v1/chat/completions",stream="true"} 200`)
+
+	// 错误按模型和类别计数，成功请求不计入
+	assertSample(t, body, `llmproxy_errors_total{class="rate_limited",model="llama-3"} 1`)
+	assertSample(t, body, `llmproxy_errors_total{class="timeout",model="llama-3"} 1`)
+	assertSample(t, body, `llmproxy_errors_total{class="client_error",model="gpt-4o"} 1`)
+	assertNoSample(t, body, `llmproxy_errors_total{class="server_error"`)
+}
+
+func TestErrorClass(t *testing.T) {
+	tests := []struct {
+		status int
+		want   string
+	}{
+		{200, ""},
+		{302, ""},
+		{400, "client_error"},
+		{404, "client_error"},
+		{429, "rate_limited"},
+		{500, "server_error"},
+		{502, "server_error"},
+		{504, "timeout"},
+	}
+	for _, tt := range tests {
+		if got := errorClass(tt.status); got != tt.want {
+			t.Errorf("errorClass(%d) = %q, want %q", tt.status, got, tt.want)
+		}
+	}
+}
+
+func TestModelLabelAllowlist(t *testing.T) {
+	resetMetrics(t, nil)
+	SetModelLabels([]string{"gpt-4o", "llama-*"}, 0)
+
+	for _, model := range []string{"gpt-4o", "llama-3-70b", "mistral-7b", "gpt-4o-mini"} {
+		RecordRequest("/v1/chat/completions", model, false, "b", "", 1, 500)
+	}
+
+	body := scrape(t)
+	assertSample(t, body, `llmproxy_errors_total{class="server_error",model="gpt-4o"} 1`)
+	assertSample(t, body, `llmproxy_errors_total{class="server_error",model="llama-3-70b"} 1`)
+	// 白名单以外的模型折叠为 other
+	assertSample(t, body, `llmproxy_errors_total{class="server_error",model="other"} 2`)
+	assertNoSample(t, body, `llmproxy_errors_total{class="server_error",model="mistral-7b"}`)
+}
+
+func TestModelLabelCap(t *testing.T) {
+	resetMetrics(t, nil)
+	SetModelLabels(nil, 2)
+
+	for _, model := range []string{"m1", "m2", "m3", "m1", "m4", ""} {
+		RecordRequest("/v1/chat/completions", model, false, "b", "", 1, 200)
+	}
+
+	body := scrape(t)
+	assertSample(t, body, `llmproxy_requests_total{backend="b",model="m1",path="/v1/chat/completions",status="200",stream="false"} 2`)
+	assertSample(t, body, `llmproxy_requests_total{backend="b",model="m2",path="/v1/chat/completions",status="200",stream="false"} 1`)
+	// 超出上限的模型记为 other，已记录的模型不受影响；未知模型为空
+	assertSample(t, body, `llmproxy_requests_total{backend="b",model="other",path="/v1/chat/completions",status="200",stream="false"} 2`)
+	assertSample(t, body, `llmproxy_requests_total{backend="b",model="",path="/v1/chat/completions",status="200",stream="false"} 1`)
+}
+
+func TestLabelOptions(t *testing.T) {
+	resetMetrics(t, nil)
+	SetLabelOptions(true, BackendLabelNone)
+
+	RecordRequest("/v1/files/file-abc123def456ghi789/content", "m", false, "vllm-1", "http://vllm-1:8000", 1, 200)
+
+	body := scrape(t)
+	assertSample(t, body, `llmproxy_requests_total{backend="",model="m",path="/v1/files/:id/content",status="200",stream="false"} 1`)
+}
+
+func TestNormalizePath(t *testing.T) {
+	tests := []struct {
+		path string
+		want string
+	}{
+		{"/v1/chat/completions", "/v1/chat/completions"},
+		{"/v1/files/123/content", "/v1/files/:id/content"},
+		{"/v1/batches/3f2504e0-4f89-11d3-9a0c-0305e82c3301", "/v1/batches/:id"},
+		{"/v1/files/file-abc123def456ghi789", "/v1/files/:id"},
+		{"/v1/models/llama-3", "/v1/models/llama-3"},
+	}
+	for _, tt := range tests {
+		if got := NormalizePath(tt.path); got != tt.want {
+			t.Errorf("NormalizePath(%q) = %q, want %q", tt.path, got, tt.want)
+		}
+	}
+}
+
+// bucketBounds 返回 llmproxy_latency_ms 输出中的 le 分桶边界
+func bucketBounds(body string) []string {
+	var bounds []string
+	for _, line := range strings.Split(body, "\n") {
+		if !strings.HasPrefix(line, "llmproxy_latency_ms_bucket{") {
+			continue
+		}
+		i := strings.Index(line, `le="`)
+		j := strings.Index(line[i+4:], `"`)
+		bounds = append(bounds, line[i+4:i+4+j])
+	}
+	return bounds
+}
+
+func TestLatencyBuckets(t *testing.T) {
+	tests := []struct {
+		name string
+		cfg  *config.MetricsConfig
+		want string
+	}{
+		{"未配置时使用默认分桶", nil, "10,50,100,200,500,1000,2000,5000,10000,+Inf"},
+		{"空分桶使用默认值", &config.MetricsConfig{}, "10,50,100,200,500,1000,2000,5000,10000,+Inf"},
+		{"自定义分桶", &config.MetricsConfig{LatencyBuckets: []float64{25, 250, 2500, 60000}}, "25,250,2500,60000,+Inf"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resetMetrics(t, tt.cfg)
+			RecordRequest("/v1/chat/completions", "m", false, "b", "", 300, 200)
+
+			body := scrape(t)
+			if got := strings.Join(bucketBounds(body), ","); got != tt.want {
+				t.Errorf("bucket bounds = %s, want %s", got, tt.want)
+			}
+		})
+	}
+
+	// 自定义分桶的计数落在对应区间
+	resetMetrics(t, &config.MetricsConfig{LatencyBuckets: []float64{25, 250, 2500}})
+	for _, latency := range []float64{10, 100, 300, 5000} {
+		RecordRequest("/v1/chat/completions", "m", false, "b", "", latency, 200)
+	}
+	body := scrape(t)
+	for le, count := range map[string]string{"25": "1", "250": "2", "2500": "3", "+Inf": "4"} {
+		assertSample(t, body, `llmproxy_latency_ms_bucket{backend="b",model="m",path="/v1/chat/completions",stream="false",le="`+le+`"} `+count)
+	}
+}
+
+func TestInitReplacesMetrics(t *testing.T) {
+	resetMetrics(t, nil)
+	RecordRequest("/v1/chat/completions", "m", false, "b", "", 1, 200)
+
+	// 重建后之前的计数被丢弃，实例之间互不影响
+	standalone := New(&config.MetricsConfig{LatencyBuckets: []float64{1}})
+	Init(nil)
+	assertNoSample(t, scrape(t), "llmproxy_requests_total{")
+
+	rec := httptest.NewRecorder()
+	standalone.Handler().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+	if rec.Code != http.StatusOK || strings.Contains(rec.Body.String(), "llmproxy_requests_total{") {
+		t.Errorf("standalone registry output unexpected:\n%s", rec.Body)
+	}
+}
@@ -0,0 +1,127 @@
+package middleware
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"net"
+	"os"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// servedCN 建立新的 TLS 连接，返回服务端证书的 CN
+func servedCN(t *testing.T, addr string, ca *testCA) string {
+	t.Helper()
+	roots := x509.NewCertPool()
+	roots.AddCert(ca.cert)
+	conn, err := tls.Dial("tcp", addr, &tls.Config{RootCAs: roots, ServerName: "127.0.0.1"})
+	if err != nil {
+		t.Fatalf("tls.Dial() error = %v", err)
+	}
+	defer conn.Close()
+	return conn.ConnectionState().PeerCertificates[0].Subject.CommonName
+}
+
+// replaceCert 写入新的证书和私钥，并把修改时间设为 mod
+func replaceCert(t *testing.T, certFile, keyFile string, certPEM, keyPEM []byte, mod time.Time) {
+	t.Helper()
+	for path, data := range map[string][]byte{certFile: certPEM, keyFile: keyPEM} {
+		if err := os.WriteFile(path, data, 0o600); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.Chtimes(path, mod, mod); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestCertReloadServesNewCertificate(t *testing.T) {
+	ca := newTestCA(t, "test-ca")
+	dir := t.TempDir()
+	certPEM, keyPEM := ca.issue(t, "cert-v1", true)
+	certFile := writeTestFile(t, dir, "tls.crt", certPEM)
+	keyFile := writeTestFile(t, dir, "tls.key", keyPEM)
+
+	reloader, err := newCertReloader(certFile, keyFile)
+	if err != nil {
+		t.Fatalf("newCertReloader() error = %v", err)
+	}
+	// 握手在服务端 goroutine 中读取时钟
+	var clock atomic.Int64
+	clock.Store(time.Now().UnixNano())
+	reloader.now = func() time.Time { return time.Unix(0, clock.Load()) }
+	advance := func(d time.Duration) { clock.Add(int64(d)) }
+
+	ln, err := tls.Listen("tcp", "127.0.0.1:0", &tls.Config{GetCertificate: reloader.GetCertificate})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go func(c net.Conn) {
+				_ = c.(*tls.Conn).Handshake()
+				_ = c.Close()
+			}(conn)
+		}
+	}()
+	addr := ln.Addr().String()
+
+	if cn := servedCN(t, addr, ca); cn != "cert-v1" {
+		t.Fatalf("initial cert = %s, want cert-v1", cn)
+	}
+
+	// cert-manager 续签：替换证书文件
+	certPEM, keyPEM = ca.issue(t, "cert-v2", true)
+	replaceCert(t, certFile, keyFile, certPEM, keyPEM, time.Now().Add(time.Minute))
+
+	// 检查间隔内复用缓存的证书
+	advance(certCheckInterval / 2)
+	if cn := servedCN(t, addr, ca); cn != "cert-v1" {
+		t.Errorf("cert within check interval = %s, want cached cert-v1", cn)
+	}
+
+	// 超过检查间隔后，新连接使用新证书
+	advance(certCheckInterval)
+	if cn := servedCN(t, addr, ca); cn != "cert-v2" {
+		t.Errorf("cert after rotation = %s, want cert-v2", cn)
+	}
+
+	// 只写入了一半的证书：加载失败时继续使用当前证书
+	replaceCert(t, certFile, keyFile, certPEM[:len(certPEM)/2], keyPEM, time.Now().Add(2*time.Minute))
+	advance(2 * certCheckInterval)
+	if cn := servedCN(t, addr, ca); cn != "cert-v2" {
+		t.Errorf("cert after broken write = %s, want cert-v2", cn)
+	}
+
+	// 文件被删除时同样继续使用当前证书
+	if err := os.Remove(certFile); err != nil {
+		t.Fatal(err)
+	}
+	advance(2 * certCheckInterval)
+	if cn := servedCN(t, addr, ca); cn != "cert-v2" {
+		t.Errorf("cert after file removal = %s, want cert-v2", cn)
+	}
+}
+
+func TestNewCertReloaderErrors(t *testing.T) {
+	ca := newTestCA(t, "test-ca")
+	dir := t.TempDir()
+	certPEM, _ := ca.issue(t, "server", true)
+	_, otherKey := ca.issue(t, "other", true)
+	certFile := writeTestFile(t, dir, "tls.crt", certPEM)
+	keyFile := writeTestFile(t, dir, "tls.key", otherKey)
+
+	if _, err := newCertReloader(certFile, dir+"/missing.key"); err == nil {
+		t.Error("newCertReloader() with missing key: error = nil")
+	}
+	// 证书与私钥不匹配
+	if _, err := newCertReloader(certFile, keyFile); err == nil {
+		t.Error("newCertReloader() with mismatched key: error = nil")
+	}
+}
@@ -0,0 +1,72 @@
+package middleware
+
+import (
+	"context"
+	"log"
+	"net/http"
+	"sync/atomic"
+	"time"
+
+	"llmproxy/internal/metrics"
+)
+
+// Drainer 关闭时的在途请求排空
+// 在途请求数沿用代理处理器的 llmproxy_inflight_requests 统计；进入排空状态后，新响应带 Connection: close，
+// 促使客户端关闭长连接并重新连接到其他实例
+type Drainer struct {
+	draining atomic.Bool
+}
+
+// NewDrainer 创建排空器
+// 返回：
+//   - *Drainer: 排空器实例
+func NewDrainer() *Drainer {
+	return &Drainer{}
+}
+
+// Middleware 包装处理器：排空期间为响应加上 Connection: close
+// 参数：
+//   - next: 下一个处理器
+//
+// 返回：
+//   - http.Handler: 包装后的处理器
+func (d *Drainer) Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if d.draining.Load() {
+			w.Header().Set("Connection", "close")
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// Start 进入排空状态（收到退出信号时调用）
+func (d *Drainer) Start() {
+	d.draining.Store(true)
+}
+
+// InFlight 返回当前在途请求数（包括未结束的流式响应）
+func (d *Drainer) InFlight() int64 {
+	return metrics.InFlight()
+}
+
+// Shutdown 停止接受新连接并等待在途请求（含流式响应）完成，超时后强制断开剩余连接
+// 参数：
+//   - server: HTTP 服务器
+//   - timeout: 最长等待时间
+//
+// 返回：
+//   - error: 超时或关闭失败时返回错误
+func (d *Drainer) Shutdown(server *http.Server, timeout time.Duration) error {
+	d.Start()
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	err := server.Shutdown(ctx)
+	if err != nil {
+		log.Printf("等待在途请求超时，强制断开 %d 个请求: %v", d.InFlight(), err)
+		if closeErr := server.Close(); closeErr != nil {
+			log.Printf("HTTP 服务器关闭失败: %v", closeErr)
+		}
+	}
+	return err
+}
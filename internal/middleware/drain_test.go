@@ -0,0 +1,137 @@
+package middleware
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"llmproxy/internal/metrics"
+)
+
+// startDrainServer 在本地端口启动包装了排空器的 HTTP 服务器
+// 处理器和代理处理器一样记录在途请求
+func startDrainServer(t *testing.T, d *Drainer, handler http.HandlerFunc) (*http.Server, string) {
+	t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	server := &http.Server{Handler: d.Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		defer metrics.InFlightStart()()
+		handler(w, r)
+	}))}
+	go func() { _ = server.Serve(ln) }()
+	t.Cleanup(func() { _ = server.Close() })
+	return server, "http://" + ln.Addr().String()
+}
+
+// slowStream 每隔 interval 写出一个事件，共 n 个
+func slowStream(n int, interval time.Duration) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/event-stream")
+		for i := 0; i < n; i++ {
+			fmt.Fprintf(w, "data: %d\n\n", i)
+			w.(http.Flusher).Flush()
+			time.Sleep(interval)
+		}
+		fmt.Fprint(w, "data: [DONE]\n\n")
+	}
+}
+
+func TestDrainerShutdownWaitsForStream(t *testing.T) {
+	d := NewDrainer()
+	server, url := startDrainServer(t, d, slowStream(5, 50*time.Millisecond))
+
+	resp, err := http.Get(url)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	reader := bufio.NewReader(resp.Body)
+	if line, err := reader.ReadString('\n'); err != nil || line != "data: 0\n" {
+		t.Fatalf("first event = %q, %v", line, err)
+	}
+	if got := d.InFlight(); got != 1 {
+		t.Errorf("InFlight() = %d, want 1", got)
+	}
+
+	// 流式响应进行中开始关闭
+	done := make(chan error, 1)
+	start := time.Now()
+	go func() { done <- d.Shutdown(server, 5*time.Second) }()
+
+	rest, err := io.ReadAll(reader)
+	if err != nil {
+		t.Fatalf("stream cut during shutdown: %v", err)
+	}
+	if !strings.HasSuffix(string(rest), "data: 4\n\ndata: [DONE]\n\n") {
+		t.Errorf("stream tail = %q, want every event", rest)
+	}
+	if err := <-done; err != nil {
+		t.Errorf("Shutdown() error = %v", err)
+	}
+	if elapsed := time.Since(start); elapsed > 2*time.Second {
+		t.Errorf("Shutdown() took %v after the stream ended", elapsed)
+	}
+	if got := d.InFlight(); got != 0 {
+		t.Errorf("InFlight() after shutdown = %d, want 0", got)
+	}
+
+	// 关闭后不再接受新连接
+	if _, err := http.Get(url); err == nil {
+		t.Error("request after shutdown succeeded")
+	}
+}
+
+func TestDrainerShutdownTimeoutForcesClose(t *testing.T) {
+	d := NewDrainer()
+	release := make(chan struct{})
+	defer close(release)
+	server, url := startDrainServer(t, d, func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, "data: 0\n\n")
+		w.(http.Flusher).Flush()
+		<-release
+	})
+
+	resp, err := http.Get(url)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+
+	// 超过关闭超时的流式响应被强制断开
+	start := time.Now()
+	if err := d.Shutdown(server, 100*time.Millisecond); err == nil {
+		t.Error("Shutdown() error = nil, want a timeout")
+	}
+	if elapsed := time.Since(start); elapsed > 2*time.Second {
+		t.Errorf("Shutdown() took %v, want about the 100ms timeout", elapsed)
+	}
+	if _, err := io.ReadAll(resp.Body); err == nil {
+		t.Error("stream ended cleanly, want it cut by the forced close")
+	}
+}
+
+func TestDrainerConnectionClose(t *testing.T) {
+	d := NewDrainer()
+	h := d.Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/", nil))
+	if got := rec.Header().Get("Connection"); got != "" {
+		t.Errorf("Connection before draining = %q, want empty", got)
+	}
+
+	d.Start()
+	rec = httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/", nil))
+	if got := rec.Header().Get("Connection"); got != "close" {
+		t.Errorf("Connection while draining = %q, want close", got)
+	}
+}
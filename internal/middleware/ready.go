@@ -0,0 +1,137 @@
+package middleware
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"sync/atomic"
+
+	"llmproxy/internal/lb"
+	"llmproxy/internal/storage"
+)
+
+// Readiness 就绪检查
+// 存活检查（/health、/livez）只表示进程在运行；就绪检查（/ready、/readyz）在关闭期间
+// 或任一检查项失败时返回 503，供 Kubernetes 等上游摘除流量
+type Readiness struct {
+	mu       sync.RWMutex
+	checks   []readinessCheck
+	stopping atomic.Bool
+}
+
+// readinessCheck 一个就绪检查项
+type readinessCheck struct {
+	name  string
+	check func() error
+}
+
+// NewReadiness 创建就绪检查
+// 返回：
+//   - *Readiness: 就绪检查实例（未添加检查项时始终就绪，直到 Stop）
+func NewReadiness() *Readiness {
+	return &Readiness{}
+}
+
+// AddCheck 添加检查项
+// 参数：
+//   - name: 检查项名称（用于响应中的失败原因）
+//   - check: 检查函数，返回错误表示未就绪
+func (rd *Readiness) AddCheck(name string, check func() error) {
+	rd.mu.Lock()
+	defer rd.mu.Unlock()
+	rd.checks = append(rd.checks, readinessCheck{name: name, check: check})
+}
+
+// BackendsCheck 创建健康后端数检查项
+// 参数：
+//   - min: 所有后端池合计至少需要的健康后端数
+//   - pools: 后端池（默认池和各后端组）
+//
+// 返回：
+//   - func() error: 检查函数
+func BackendsCheck(min int, pools ...lb.LoadBalancer) func() error {
+	return func() error {
+		healthy := 0
+		for _, pool := range pools {
+			healthy += lb.HealthyCount(pool)
+		}
+		if healthy < min {
+			return fmt.Errorf("%d healthy backends, need %d", healthy, min)
+		}
+		return nil
+	}
+}
+
+// StorageCheck 创建存储连接检查项（状态来自 storage.health_check 最近一次检查）
+// 参数：
+//   - manager: 存储管理器
+//   - names: 必须可用的连接名称（"*" 表示全部）
+//
+// 返回：
+//   - func() error: 检查函数
+func StorageCheck(manager *storage.Manager, names []string) func() error {
+	return func() error {
+		if down := manager.Unhealthy(names); len(down) > 0 {
+			return fmt.Errorf("unavailable: %s", strings.Join(down, ", "))
+		}
+		return nil
+	}
+}
+
+// Stop 标记为正在关闭，之后始终返回未就绪（收到退出信号时调用）
+func (rd *Readiness) Stop() {
+	rd.stopping.Store(true)
+}
+
+// Failures 执行所有检查项
+// 返回：
+//   - map[string]string: 失败的检查项及原因（为空表示就绪）
+func (rd *Readiness) Failures() map[string]string {
+	failures := make(map[string]string)
+	if rd.stopping.Load() {
+		failures["shutdown"] = "server is shutting down"
+	}
+
+	rd.mu.RLock()
+	checks := rd.checks
+	rd.mu.RUnlock()
+	for _, c := range checks {
+		if err := c.check(); err != nil {
+			failures[c.name] = err.Error()
+		}
+	}
+	return failures
+}
+
+// Handler 就绪检查端点：就绪时返回 200 OK，否则返回 503
+// ?detail=1 时返回 JSON：{"status": "ok" | "not_ready", "failures": {检查项: 原因}}
+func (rd *Readiness) Handler(w http.ResponseWriter, r *http.Request) {
+	failures := rd.Failures()
+	code := http.StatusOK
+	if len(failures) > 0 {
+		code = http.StatusServiceUnavailable
+	}
+
+	if r.URL.Query().Get("detail") != "" {
+		status := "ok"
+		if len(failures) > 0 {
+			status = "not_ready"
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(code)
+		_ = json.NewEncoder(w).Encode(map[string]interface{}{
+			"status":   status,
+			"failures": failures,
+		})
+		return
+	}
+
+	w.WriteHeader(code)
+	if code == http.StatusOK {
+		_, _ = w.Write([]byte("OK"))
+		return
+	}
+	_, _ = w.Write([]byte("NOT READY"))
+}
@@ -0,0 +1,138 @@
+package middleware
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"llmproxy/internal/config"
+	"llmproxy/internal/lb"
+	"llmproxy/internal/storage"
+
+	"github.com/alicebob/miniredis/v2"
+)
+
+// readyStatus 请求就绪检查端点，返回状态码和失败项
+func readyStatus(t *testing.T, rd *Readiness) (int, map[string]string) {
+	t.Helper()
+	rec := httptest.NewRecorder()
+	rd.Handler(rec, httptest.NewRequest(http.MethodGet, "/readyz?detail=1", nil))
+	var body struct {
+		Status   string            `json:"status"`
+		Failures map[string]string `json:"failures"`
+	}
+	if err := json.Unmarshal(rec.Body.Bytes(), &body); err != nil {
+		t.Fatalf("invalid readiness body %s: %v", rec.Body, err)
+	}
+	return rec.Code, body.Failures
+}
+
+// newReadyPool 创建包含 n 个后端的负载均衡池
+func newReadyPool(n int) lb.LoadBalancer {
+	backends := make([]*config.Backend, n)
+	for i := range backends {
+		backends[i] = &config.Backend{URL: fmt.Sprintf("http://10.0.0.%d:8000", i+1), Weight: 1}
+	}
+	return lb.NewRoundRobin(backends, nil)
+}
+
+// setHealthy 设置池中所有后端的健康状态
+func setHealthy(pool lb.LoadBalancer, healthy bool) {
+	for _, b := range pool.(interface{ GetBackends() []*lb.Backend }).GetBackends() {
+		b.Healthy = healthy
+	}
+}
+
+func TestReadinessBackends(t *testing.T) {
+	primary, group := newReadyPool(2), newReadyPool(1)
+	rd := NewReadiness()
+	rd.AddCheck("backends", BackendsCheck(2, primary, group))
+
+	if code, failures := readyStatus(t, rd); code != http.StatusOK || len(failures) != 0 {
+		t.Fatalf("all healthy: %d %v, want 200", code, failures)
+	}
+
+	// 默认池全部不可用，只剩后端组的 1 个健康后端
+	setHealthy(primary, false)
+	code, failures := readyStatus(t, rd)
+	if code != http.StatusServiceUnavailable || failures["backends"] != "1 healthy backends, need 2" {
+		t.Fatalf("one healthy: %d %v, want 503", code, failures)
+	}
+
+	setHealthy(group, false)
+	if code, _ := readyStatus(t, rd); code != http.StatusServiceUnavailable {
+		t.Errorf("none healthy: %d, want 503", code)
+	}
+
+	// 恢复后重新就绪
+	setHealthy(primary, true)
+	if code, _ := readyStatus(t, rd); code != http.StatusOK {
+		t.Errorf("after recovery: %d, want 200", code)
+	}
+}
+
+func TestReadinessStorage(t *testing.T) {
+	mr := miniredis.RunT(t)
+	manager := storage.NewManager()
+	err := manager.Initialize(&config.StorageConfig{Caches: []*config.CacheConnection{{
+		Name: "redis", Enabled: true, Driver: "redis", Addr: mr.Addr(),
+		DialTimeout: 100 * time.Millisecond, ReadTimeout: 100 * time.Millisecond,
+	}}})
+	if err != nil {
+		t.Fatalf("Initialize() error = %v", err)
+	}
+	t.Cleanup(func() { _ = manager.Close() })
+
+	required, optional := NewReadiness(), NewReadiness()
+	required.AddCheck("storage", StorageCheck(manager, []string{"redis"}))
+	optional.AddCheck("storage", StorageCheck(manager, []string{"other"}))
+	ctx := context.Background()
+
+	manager.CheckHealth(ctx, time.Second)
+	if code, failures := readyStatus(t, required); code != http.StatusOK {
+		t.Fatalf("redis up: %d %v, want 200", code, failures)
+	}
+
+	// Redis 宕机：只影响要求该连接的就绪检查
+	mr.Close()
+	manager.CheckHealth(ctx, 100*time.Millisecond)
+	code, failures := readyStatus(t, required)
+	if code != http.StatusServiceUnavailable || failures["storage"] != "unavailable: cache/redis" {
+		t.Fatalf("redis down: %d %v, want 503", code, failures)
+	}
+	if code, _ := readyStatus(t, optional); code != http.StatusOK {
+		t.Errorf("unrelated storage: %d, want 200", code)
+	}
+
+	if err := mr.Restart(); err != nil {
+		t.Fatal(err)
+	}
+	manager.CheckHealth(ctx, time.Second)
+	if code, failures := readyStatus(t, required); code != http.StatusOK {
+		t.Errorf("redis recovered: %d %v, want 200", code, failures)
+	}
+}
+
+func TestReadinessStop(t *testing.T) {
+	rd := NewReadiness()
+	rec := httptest.NewRecorder()
+	rd.Handler(rec, httptest.NewRequest(http.MethodGet, "/ready", nil))
+	if rec.Code != http.StatusOK || rec.Body.String() != "OK" {
+		t.Fatalf("before Stop: %d %q", rec.Code, rec.Body)
+	}
+
+	// 关闭期间始终未就绪
+	rd.Stop()
+	rec = httptest.NewRecorder()
+	rd.Handler(rec, httptest.NewRequest(http.MethodGet, "/ready", nil))
+	if rec.Code != http.StatusServiceUnavailable || rec.Body.String() != "NOT READY" {
+		t.Errorf("after Stop: %d %q", rec.Code, rec.Body)
+	}
+	if _, failures := readyStatus(t, rd); failures["shutdown"] == "" {
+		t.Errorf("failures = %v, want shutdown", failures)
+	}
+}
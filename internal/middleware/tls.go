@@ -0,0 +1,189 @@
+package middleware
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"sync"
+	"time"
+
+	"llmproxy/internal/config"
+)
+
+// 客户端证书认证方式
+const (
+	ClientAuthNone    = "none"    // 不请求客户端证书（默认）
+	ClientAuthRequest = "request" // 请求客户端证书，但不要求、不校验
+	ClientAuthVerify  = "verify"  // 客户端提供证书时必须通过 CA 校验
+	ClientAuthRequire = "require" // 必须提供并通过 CA 校验的客户端证书
+)
+
+// certCheckInterval 两次检查证书文件修改时间的最小间隔
+const certCheckInterval = 10 * time.Second
+
+// certReloader 在握手时提供服务端证书，证书文件更新后自动重新加载
+// 通过比较文件修改时间判断是否更新，同一间隔内的握手复用缓存的证书；
+// 重新加载失败（如 cert-manager 只写入了一半）时继续使用旧证书
+type certReloader struct {
+	certFile string
+	keyFile  string
+
+	mu        sync.Mutex
+	cert      *tls.Certificate
+	certMod   time.Time
+	keyMod    time.Time
+	checkedAt time.Time
+	now       func() time.Time
+}
+
+// newCertReloader 创建证书加载器并立即加载一次证书
+// 参数：
+//   - certFile: 证书文件路径
+//   - keyFile: 私钥文件路径
+//
+// 返回：
+//   - *certReloader: 证书加载器
+//   - error: 首次加载失败时返回错误
+func newCertReloader(certFile, keyFile string) (*certReloader, error) {
+	r := &certReloader{
+		certFile: certFile,
+		keyFile:  keyFile,
+		now:      time.Now,
+	}
+	certMod, keyMod, err := r.modTimes()
+	if err != nil {
+		return nil, err
+	}
+	if err := r.load(certMod, keyMod); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+// modTimes 返回证书和私钥文件的修改时间
+func (r *certReloader) modTimes() (time.Time, time.Time, error) {
+	certInfo, err := os.Stat(r.certFile)
+	if err != nil {
+		return time.Time{}, time.Time{}, fmt.Errorf("读取 TLS 证书失败: %w", err)
+	}
+	keyInfo, err := os.Stat(r.keyFile)
+	if err != nil {
+		return time.Time{}, time.Time{}, fmt.Errorf("读取 TLS 私钥失败: %w", err)
+	}
+	return certInfo.ModTime(), keyInfo.ModTime(), nil
+}
+
+// load 加载证书（调用方持有锁或处于初始化阶段）
+func (r *certReloader) load(certMod, keyMod time.Time) error {
+	cert, err := tls.LoadX509KeyPair(r.certFile, r.keyFile)
+	if err != nil {
+		return fmt.Errorf("加载 TLS 证书失败: %w", err)
+	}
+	r.cert = &cert
+	r.certMod = certMod
+	r.keyMod = keyMod
+	r.checkedAt = r.now()
+	return nil
+}
+
+// GetCertificate 实现 tls.Config.GetCertificate
+func (r *certReloader) GetCertificate(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	now := r.now()
+	if now.Sub(r.checkedAt) < certCheckInterval {
+		return r.cert, nil
+	}
+	r.checkedAt = now
+
+	certMod, keyMod, err := r.modTimes()
+	if err != nil {
+		log.Printf("检查 TLS 证书失败，继续使用当前证书: %v", err)
+		return r.cert, nil
+	}
+	if certMod.Equal(r.certMod) && keyMod.Equal(r.keyMod) {
+		return r.cert, nil
+	}
+	if err := r.load(certMod, keyMod); err != nil {
+		log.Printf("重新加载 TLS 证书失败，继续使用当前证书: %v", err)
+		return r.cert, nil
+	}
+	log.Printf("TLS 证书已重新加载: %s", r.certFile)
+	return r.cert, nil
+}
+
+// ServerTLSConfig 根据配置构建服务端 TLS 配置
+// 证书在握手时通过 GetCertificate 提供，证书文件更新后无需重启即可生效
+// 参数：
+//   - cfg: TLS 配置
+//
+// 返回：
+//   - *tls.Config: TLS 配置（启动时使用 ListenAndServeTLS("", "")）
+//   - error: 证书加载失败、CA 文件读取失败或 client_auth 不合法时返回错误
+func ServerTLSConfig(cfg *config.TLSConfig) (*tls.Config, error) {
+	reloader, err := newCertReloader(cfg.CertFile, cfg.KeyFile)
+	if err != nil {
+		return nil, err
+	}
+
+	tlsCfg := &tls.Config{
+		MinVersion:     tls.VersionTLS12,
+		GetCertificate: reloader.GetCertificate,
+	}
+
+	switch cfg.ClientAuth {
+	case "", ClientAuthNone:
+		tlsCfg.ClientAuth = tls.NoClientCert
+	case ClientAuthRequest:
+		tlsCfg.ClientAuth = tls.RequestClientCert
+	case ClientAuthVerify:
+		tlsCfg.ClientAuth = tls.VerifyClientCertIfGiven
+	case ClientAuthRequire:
+		tlsCfg.ClientAuth = tls.RequireAndVerifyClientCert
+	default:
+		return nil, fmt.Errorf("不支持的 client_auth: %q", cfg.ClientAuth)
+	}
+
+	if cfg.ClientCAFile != "" {
+		pem, err := os.ReadFile(cfg.ClientCAFile)
+		if err != nil {
+			return nil, fmt.Errorf("读取客户端 CA 证书失败: %w", err)
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("客户端 CA 证书中没有有效的 PEM 证书: %s", cfg.ClientCAFile)
+		}
+		tlsCfg.ClientCAs = pool
+	} else if tlsCfg.ClientAuth == tls.VerifyClientCertIfGiven || tlsCfg.ClientAuth == tls.RequireAndVerifyClientCert {
+		return nil, fmt.Errorf("client_auth 为 %s 时必须配置 client_ca_file", cfg.ClientAuth)
+	}
+
+	return tlsCfg, nil
+}
+
+// ClientCertMiddleware 将已校验的客户端证书 CN 写入请求头，供鉴权和钩子使用
+// 请求中携带的同名头总是先被删除，防止客户端伪造
+// 参数：
+//   - header: 请求头名称
+//   - next: 下一个处理器
+//
+// 返回：
+//   - http.Handler: 处理器
+func ClientCertMiddleware(header string, next http.Handler) http.Handler {
+	if header == "" {
+		return next
+	}
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		r.Header.Del(header)
+		// 只信任经过 CA 校验的证书链（request 模式下的证书未校验）
+		if r.TLS != nil && len(r.TLS.VerifiedChains) > 0 && len(r.TLS.VerifiedChains[0]) > 0 {
+			r.Header.Set(header, r.TLS.VerifiedChains[0][0].Subject.CommonName)
+		}
+		next.ServeHTTP(w, r)
+	})
+}
@@ -0,0 +1,266 @@
+package middleware
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"io"
+	"log"
+	"math/big"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"llmproxy/internal/config"
+)
+
+// testCA 测试用的自签名 CA
+type testCA struct {
+	cert    *x509.Certificate
+	key     *ecdsa.PrivateKey
+	certPEM []byte
+}
+
+// newTestCA 生成自签名 CA
+func newTestCA(t *testing.T, cn string) *testCA {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tmpl := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: cn},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  true,
+		KeyUsage:              x509.KeyUsageCertSign,
+		BasicConstraintsValid: true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, _ := x509.ParseCertificate(der)
+	return &testCA{cert: cert, key: key, certPEM: pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})}
+}
+
+// issue 签发证书，返回 PEM 编码的证书和私钥
+// server 为 true 时签发 127.0.0.1 的服务端证书，否则签发客户端证书
+func (ca *testCA) issue(t *testing.T, cn string, server bool) (certPEM, keyPEM []byte) {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	serial, _ := rand.Int(rand.Reader, big.NewInt(1<<62))
+	tmpl := &x509.Certificate{
+		SerialNumber: serial,
+		Subject:      pkix.Name{CommonName: cn},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+	}
+	if server {
+		tmpl.ExtKeyUsage = []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth}
+		tmpl.IPAddresses = []net.IP{net.ParseIP("127.0.0.1")}
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, ca.cert, &key.PublicKey, ca.key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}),
+		pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER})
+}
+
+// writeTestFile 在目录中写入文件并返回路径
+func writeTestFile(t *testing.T, dir, name string, data []byte) string {
+	t.Helper()
+	path := filepath.Join(dir, name)
+	if err := os.WriteFile(path, data, 0o600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+// startTLSServer 使用 ServerTLSConfig 启动 HTTPS 服务，处理器返回 X-Client-CN 请求头
+func startTLSServer(t *testing.T, cfg *config.TLSConfig) string {
+	t.Helper()
+	tlsCfg, err := ServerTLSConfig(cfg)
+	if err != nil {
+		t.Fatalf("ServerTLSConfig() error = %v", err)
+	}
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	handler := ClientCertMiddleware("X-Client-CN", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = io.WriteString(w, r.Header.Get("X-Client-CN"))
+	}))
+	srv := &http.Server{Handler: handler, TLSConfig: tlsCfg, ErrorLog: log.New(io.Discard, "", 0)}
+	go func() { _ = srv.ServeTLS(ln, "", "") }()
+	t.Cleanup(func() { _ = srv.Close() })
+	return "https://" + ln.Addr().String()
+}
+
+// tlsGet 以指定客户端证书（可为 nil）请求服务，返回响应体
+func tlsGet(t *testing.T, url string, rootCA *testCA, clientCert *tls.Certificate) (string, error) {
+	t.Helper()
+	roots := x509.NewCertPool()
+	roots.AddCert(rootCA.cert)
+	clientTLS := &tls.Config{RootCAs: roots}
+	if clientCert != nil {
+		// 总是发送证书（不按服务端声明的 CA 列表筛选），确保未知 CA 的证书也送达服务端
+		clientTLS.GetClientCertificate = func(*tls.CertificateRequestInfo) (*tls.Certificate, error) {
+			return clientCert, nil
+		}
+	}
+	client := &http.Client{Transport: &http.Transport{TLSClientConfig: clientTLS}, Timeout: 5 * time.Second}
+	defer client.CloseIdleConnections()
+
+	resp, err := client.Get(url)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(resp.Body)
+	return string(body), err
+}
+
+// mtlsFixture mTLS 测试所需的证书
+type mtlsFixture struct {
+	ca       *testCA
+	dir      string
+	certFile string
+	keyFile  string
+	caFile   string
+	client   tls.Certificate // 由受信任 CA 签发
+	unknown  tls.Certificate // 由未知 CA 签发
+}
+
+func newMTLSFixture(t *testing.T) *mtlsFixture {
+	t.Helper()
+	f := &mtlsFixture{ca: newTestCA(t, "test-ca"), dir: t.TempDir()}
+	certPEM, keyPEM := f.ca.issue(t, "127.0.0.1", true)
+	f.certFile = writeTestFile(t, f.dir, "server.crt", certPEM)
+	f.keyFile = writeTestFile(t, f.dir, "server.key", keyPEM)
+	f.caFile = writeTestFile(t, f.dir, "ca.crt", f.ca.certPEM)
+
+	var err error
+	if f.client, err = tls.X509KeyPair(f.ca.issue(t, "billing-service", false)); err != nil {
+		t.Fatal(err)
+	}
+	if f.unknown, err = tls.X509KeyPair(newTestCA(t, "rogue-ca").issue(t, "intruder", false)); err != nil {
+		t.Fatal(err)
+	}
+	return f
+}
+
+func TestMTLSRequire(t *testing.T) {
+	f := newMTLSFixture(t)
+	url := startTLSServer(t, &config.TLSConfig{CertFile: f.certFile, KeyFile: f.keyFile, ClientCAFile: f.caFile, ClientAuth: ClientAuthRequire})
+
+	// 受信任 CA 签发的证书通过，CN 写入请求头
+	body, err := tlsGet(t, url, f.ca, &f.client)
+	if err != nil {
+		t.Fatalf("valid client cert rejected: %v", err)
+	}
+	if body != "billing-service" {
+		t.Errorf("client CN = %q, want billing-service", body)
+	}
+
+	// 未知 CA 签发的证书和未提供证书都被拒绝
+	if _, err := tlsGet(t, url, f.ca, &f.unknown); err == nil {
+		t.Error("client cert from unknown CA accepted")
+	}
+	if _, err := tlsGet(t, url, f.ca, nil); err == nil {
+		t.Error("request without client cert accepted")
+	}
+}
+
+func TestMTLSVerifyAndRequest(t *testing.T) {
+	f := newMTLSFixture(t)
+
+	// verify：不提供证书可以连接，提供的证书必须通过校验
+	url := startTLSServer(t, &config.TLSConfig{CertFile: f.certFile, KeyFile: f.keyFile, ClientCAFile: f.caFile, ClientAuth: ClientAuthVerify})
+	if body, err := tlsGet(t, url, f.ca, nil); err != nil || body != "" {
+		t.Errorf("verify without cert = %q, %v; want empty CN", body, err)
+	}
+	if body, err := tlsGet(t, url, f.ca, &f.client); err != nil || body != "billing-service" {
+		t.Errorf("verify with valid cert = %q, %v", body, err)
+	}
+	if _, err := tlsGet(t, url, f.ca, &f.unknown); err == nil {
+		t.Error("verify: client cert from unknown CA accepted")
+	}
+
+	// request：证书不校验，也不写入 CN
+	url = startTLSServer(t, &config.TLSConfig{CertFile: f.certFile, KeyFile: f.keyFile, ClientAuth: ClientAuthRequest})
+	if body, err := tlsGet(t, url, f.ca, &f.unknown); err != nil || body != "" {
+		t.Errorf("request mode with unverified cert = %q, %v; want empty CN", body, err)
+	}
+}
+
+func TestServerTLSConfigErrors(t *testing.T) {
+	f := newMTLSFixture(t)
+	notPEM := writeTestFile(t, f.dir, "bad.crt", []byte("not a certificate"))
+
+	tests := []struct {
+		name string
+		cfg  config.TLSConfig
+		want string
+	}{
+		{"不支持的 client_auth", config.TLSConfig{ClientAuth: "always"}, "不支持的 client_auth"},
+		{"require 未配置 CA", config.TLSConfig{ClientAuth: ClientAuthRequire}, "必须配置 client_ca_file"},
+		{"verify 未配置 CA", config.TLSConfig{ClientAuth: ClientAuthVerify}, "必须配置 client_ca_file"},
+		{"CA 文件不存在", config.TLSConfig{ClientAuth: ClientAuthRequire, ClientCAFile: filepath.Join(f.dir, "missing.crt")}, "读取客户端 CA 证书失败"},
+		{"CA 文件不是 PEM", config.TLSConfig{ClientAuth: ClientAuthRequire, ClientCAFile: notPEM}, "没有有效的 PEM 证书"},
+		{"服务端证书不存在", config.TLSConfig{CertFile: filepath.Join(f.dir, "missing.crt")}, "读取 TLS 证书失败"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := tt.cfg
+			if cfg.CertFile == "" {
+				cfg.CertFile, cfg.KeyFile = f.certFile, f.keyFile
+			}
+			if cfg.KeyFile == "" {
+				cfg.KeyFile = f.keyFile
+			}
+			_, err := ServerTLSConfig(&cfg)
+			if err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("ServerTLSConfig() error = %v, want %q", err, tt.want)
+			}
+		})
+	}
+
+	tlsCfg, err := ServerTLSConfig(&config.TLSConfig{CertFile: f.certFile, KeyFile: f.keyFile})
+	if err != nil || tlsCfg.ClientAuth != tls.NoClientCert || tlsCfg.MinVersion != tls.VersionTLS12 {
+		t.Errorf("default ServerTLSConfig() = %+v, %v", tlsCfg, err)
+	}
+}
+
+func TestClientCertMiddlewareStripsForgedHeader(t *testing.T) {
+	handler := ClientCertMiddleware("X-Client-CN", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = io.WriteString(w, r.Header.Get("X-Client-CN"))
+	}))
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	req.Header.Set("X-Client-CN", "admin")
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+	if rec.Body.String() != "" {
+		t.Errorf("forged CN passed through: %q", rec.Body.String())
+	}
+}
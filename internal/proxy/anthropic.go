@@ -0,0 +1,62 @@
+package proxy
+
+import (
+	"log"
+	"net/http"
+
+	"llmproxy/internal/config"
+	"llmproxy/internal/translate"
+)
+
+// anthropicMessagesRequest 判断请求是否需要按 Anthropic Messages API 转换
+// 参数：
+//   - cfg: 配置对象（server.anthropic_messages 未启用时总是返回 false）
+//   - r: HTTP 请求
+//
+// 返回：
+//   - bool: 是否为需要转换的 /v1/messages 请求
+func anthropicMessagesRequest(cfg *config.Config, r *http.Request) bool {
+	if cfg == nil || cfg.Server == nil || cfg.Server.AnthropicMessages == nil || !cfg.Server.AnthropicMessages.Enabled {
+		return false
+	}
+	return r.URL.Path == translate.AnthropicMessagesPath
+}
+
+// withPath 返回改写了路径的请求副本（不修改原请求，外层中间件仍看到原路径）
+func withPath(r *http.Request, path string) *http.Request {
+	r2 := r.WithContext(r.Context())
+	u := *r.URL
+	u.Path = path
+	u.RawPath = ""
+	r2.URL = &u
+	return r2
+}
+
+// writeAnthropicError 写入 Anthropic 格式的错误响应
+func writeAnthropicError(w http.ResponseWriter, statusCode int, errType, message string) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(statusCode)
+	if _, err := w.Write(translate.AnthropicError(errType, message)); err != nil {
+		log.Printf("写入响应失败: %v", err)
+	}
+}
+
+// anthropicResponse 将后端的非流式 OpenAI 响应转换为 Anthropic 格式
+// 参数：
+//   - statusCode: 后端状态码
+//   - respBody: 后端响应体
+//   - model: 请求的模型名
+//
+// 返回：
+//   - []byte: Anthropic 响应体（非 2xx 时为 Anthropic 错误格式）
+func anthropicResponse(statusCode int, respBody []byte, model string) []byte {
+	if statusCode < 200 || statusCode >= 300 {
+		return translate.ErrorToAnthropic(statusCode, respBody)
+	}
+	converted, err := translate.OpenAIToAnthropic(respBody, model)
+	if err != nil {
+		log.Printf("转换 Anthropic 响应失败: %v", err)
+		return translate.AnthropicError("api_error", err.Error())
+	}
+	return converted
+}
@@ -0,0 +1,111 @@
+package proxy
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+
+	"llmproxy/internal/config"
+)
+
+// anthropicConfig 启用 /v1/messages 转换的配置
+func anthropicConfig() *config.Config {
+	return &config.Config{Server: &config.ServerConfig{AnthropicMessages: &config.AnthropicMessagesConfig{Enabled: true}}}
+}
+
+// recordedUpstream 模拟后端：检查收到的是 Chat Completions 请求，返回 translate/testdata 中录制的响应
+func recordedUpstream(t *testing.T, file, contentType string) (server *httptest.Server, received *map[string]interface{}) {
+	t.Helper()
+	data, err := os.ReadFile("../translate/testdata/" + file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var req map[string]interface{}
+	server = newTestUpstream(t, func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/v1/chat/completions" {
+			t.Errorf("upstream path = %s, want /v1/chat/completions", r.URL.Path)
+		}
+		body, _ := io.ReadAll(r.Body)
+		if err := json.Unmarshal(body, &req); err != nil {
+			t.Errorf("upstream body: %v", err)
+		}
+		w.Header().Set("Content-Type", contentType)
+		_, _ = w.Write(data)
+	})
+	return server, &req
+}
+
+func TestAnthropicMessagesNonStreaming(t *testing.T) {
+	upstream, received := recordedUpstream(t, "openai_response.json", "application/json")
+	h := newTestProxy(t, anthropicConfig(), upstream)
+
+	rec := postProxy(h, "/v1/messages", `{"model":"claude-3-5-sonnet","max_tokens":64,"system":"be brief","messages":[{"role":"user","content":"hi"}]}`, nil)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status = %d, body = %s", rec.Code, rec.Body)
+	}
+	if msgs, _ := (*received)["messages"].([]interface{}); len(msgs) != 2 || (*received)["max_tokens"] != float64(64) {
+		t.Errorf("upstream request = %v", *received)
+	}
+
+	var resp struct {
+		Type       string `json:"type"`
+		StopReason string `json:"stop_reason"`
+		Content    []struct {
+			Type string `json:"type"`
+		} `json:"content"`
+		Usage struct {
+			InputTokens int `json:"input_tokens"`
+		} `json:"usage"`
+	}
+	if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("response is not JSON: %s", rec.Body)
+	}
+	if resp.Type != "message" || resp.StopReason != "tool_use" || len(resp.Content) != 2 || resp.Usage.InputTokens != 57 {
+		t.Errorf("response = %s", rec.Body)
+	}
+}
+
+func TestAnthropicMessagesStreaming(t *testing.T) {
+	upstream, received := recordedUpstream(t, "openai_stream.txt", "text/event-stream")
+	h := newTestProxy(t, anthropicConfig(), upstream)
+
+	rec := postProxy(h, "/v1/messages", `{"model":"claude-3-5-sonnet","max_tokens":64,"stream":true,"messages":[{"role":"user","content":"hi"}]}`, nil)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status = %d, body = %s", rec.Code, rec.Body)
+	}
+	if (*received)["stream"] != true {
+		t.Errorf("upstream request = %v", *received)
+	}
+	want, err := os.ReadFile("../translate/testdata/anthropic_stream.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if rec.Body.String() != string(want) {
+		t.Errorf("stream body mismatch\n got:\n%s", rec.Body)
+	}
+}
+
+func TestAnthropicMessagesErrors(t *testing.T) {
+	upstream := newTestUpstream(t, func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusTooManyRequests)
+		_, _ = w.Write([]byte(`{"error":{"message":"slow down"}}`))
+	})
+	h := newTestProxy(t, anthropicConfig(), upstream)
+
+	// 后端错误转换为 Anthropic 错误格式
+	rec := postProxy(h, "/v1/messages", `{"model":"m","messages":[{"role":"user","content":"hi"}]}`, nil)
+	if rec.Code != http.StatusTooManyRequests || !strings.Contains(rec.Body.String(), `"type":"rate_limit_error"`) {
+		t.Errorf("upstream error: status = %d, body = %s", rec.Code, rec.Body)
+	}
+
+	// 请求体不合法时返回 Anthropic 格式的 400
+	rec = postProxy(h, "/v1/messages", `{"model":"m"}`, nil)
+	if rec.Code != http.StatusBadRequest || !strings.Contains(rec.Body.String(), `"type":"invalid_request_error"`) {
+		t.Errorf("invalid request: status = %d, body = %s", rec.Code, rec.Body)
+	}
+}
@@ -14,6 +14,8 @@ import (
 	"llmproxy/internal/metrics"
 	"llmproxy/internal/ratelimit"
 	"llmproxy/internal/routing"
+	"llmproxy/internal/translate"
+	"llmproxy/internal/types"
 )
 
 // ModelRequest 用于提取模型名称
@@ -30,10 +32,22 @@ func NewDatabaseHandler(
 	keyStore auth.KeyStore,
 	limiter ratelimit.RateLimiter,
 	dbStore *database.Store,
+	idempotency *IdempotencyCache,
 ) http.HandlerFunc {
+	// 额度阈值告警（在扣减额度时触发）
+	if cfg.Auth != nil {
+		keyStore = auth.NewAlertingKeyStore(keyStore, cfg.Auth.QuotaAlerts)
+	}
+	mirror := routing.NewMirror(cfg.Routing, cfg.Upstream)
+
 	return func(w http.ResponseWriter, r *http.Request) {
 		start := time.Now()
+		defer metrics.InFlightStart()()
 
+		anthropic := anthropicMessagesRequest(cfg, r)
+		if anthropic {
+			r = withPath(r, translate.OpenAIChatPath)
+		}
 		if !isLLMEndpoint(r.URL.Path) {
 			http.NotFound(w, r)
 			return
@@ -44,16 +58,23 @@ func NewDatabaseHandler(
 			return
 		}
 
-		bodyBytes, err := io.ReadAll(r.Body)
+		bodyBytes, err := readRequestBody(w, r, cfg)
 		if err != nil {
-			log.Printf("读取请求体失败: %v", err)
-			http.Error(w, "Bad request", http.StatusBadRequest)
 			return
 		}
 		defer func() {
 			_ = r.Body.Close()
 		}()
 
+		// Anthropic 请求体转换为 OpenAI 格式
+		if anthropic {
+			if bodyBytes, err = translate.AnthropicToOpenAI(bodyBytes); err != nil {
+				log.Printf("转换 Anthropic 请求失败: %v", err)
+				writeAnthropicError(w, http.StatusBadRequest, "invalid_request_error", err.Error())
+				return
+			}
+		}
+
 		var modelReq ModelRequest
 		if err := json.Unmarshal(bodyBytes, &modelReq); err != nil {
 			log.Printf("解析请求体失败: %v", err)
@@ -61,28 +82,75 @@ func NewDatabaseHandler(
 			return
 		}
 
+		// 按 Prefer 请求头固定上游模型名
+		bodyBytes, modelReq.Model, err = applyModelPin(cfg, w, r, bodyBytes, modelReq.Model)
+		if err != nil {
+			log.Printf("拒绝固定模型: %v", err)
+			http.Error(w, `{"error":"Model not allowed for pinning"}`, http.StatusBadRequest)
+			return
+		}
+		if w.Header().Get("Preference-Applied") != "" {
+			r = r.WithContext(routing.WithoutModelFallback(r.Context()))
+		}
+
+		// 检查 Key 的模型白名单
+		if !checkAllowedModel(cfg, w, r, modelReq.Model) {
+			return
+		}
+
+		// 校验 tools / response_format 结构
+		if err := validateStructuredRequest(requestValidation(cfg), bodyBytes); err != nil {
+			log.Printf("请求结构校验失败: %v", err)
+			writeValidationError(w, err)
+			return
+		}
+
+		// 流式请求附加 stream_options.include_usage
+		bodyBytes = includeStreamUsage(cfg.Usage, r.URL.Path, bodyBytes, modelReq.Stream)
+
+		// 模型级限流
+		if ok, _ := ratelimit.AllowModel(limiter, cfg.RateLimit, modelReq.Model); !ok {
+			w.Header().Set("Retry-After", "1")
+			http.Error(w, `{"error":"Model rate limit exceeded"}`, http.StatusTooManyRequests)
+			return
+		}
+
+		// 幂等键：重复请求直接返回缓存的响应
+		idem, handled := idempotency.Begin(w, r, extractAPIKey(r, cfg.Auth), bodyBytes, modelReq.Stream)
+		if handled {
+			return
+		}
+		defer idem.release()
+
 		// 选择后端并发送请求
 		model := modelReq.Model
+		hashKey := extractHashKey(r, cfg.Routing, extractAPIKey(r, cfg.Auth), ExtractClientIP(r))
+		r = r.WithContext(lb.WithHashKey(r.Context(), hashKey))
+		r = r.WithContext(routing.WithStream(r.Context(), modelReq.Stream))
+
 		var resp *http.Response
 		var backend *lb.Backend
 
 		if router != nil {
 			resp, backend, err = router.ProxyRequest(r, bodyBytes, model)
 		} else {
-			backend = loadBalancer.Next()
+			backend = lb.Choose(loadBalancer, hashKey, lb.DefaultPool)
 			if backend == nil {
 				log.Println("没有可用的健康后端")
 				http.Error(w, "No healthy backend", http.StatusServiceUnavailable)
 				return
 			}
-			resp, err = sendRequest(r, backend, bodyBytes)
+			resp, err = sendRequest(r, backend, bodyBytes, cfg.Upstream)
 		}
 
+		// 主请求发出后按比例异步镜像到影子后端
+		mirror.Send(r, bodyBytes, model)
+
 		if err != nil {
 			log.Printf("后端请求失败: %v", err)
 			http.Error(w, "Backend error", http.StatusBadGateway)
 			if backend != nil {
-				metrics.RecordRequest(r.URL.Path, modelReq.Stream, backend.URL, float64(time.Since(start).Milliseconds()), http.StatusBadGateway)
+				metrics.RecordRequest(r.URL.Path, model, modelReq.Stream, backend.Name, backend.URL, float64(time.Since(start).Milliseconds()), http.StatusBadGateway)
 			}
 			// 记录失败日志
 			if dbStore != nil {
@@ -94,43 +162,68 @@ func NewDatabaseHandler(
 			_ = resp.Body.Close()
 		}()
 
+		if fallback := resp.Header.Get(routing.ModelFallbackHeader); fallback != "" {
+			log.Printf("请求模型 %s 已降级为 %s", model, fallback)
+			w.Header().Set(routing.ModelFallbackHeader, fallback)
+			model = fallback
+		}
+
 		log.Printf("请求转发到后端: %s, model=%s, stream=%v", backend.URL, model, modelReq.Stream)
 
 		respBody, err := io.ReadAll(resp.Body)
 		if err != nil {
 			log.Printf("读取响应体失败: %v", err)
 			http.Error(w, "Backend error", http.StatusBadGateway)
-			metrics.RecordRequest(r.URL.Path, modelReq.Stream, backend.URL, float64(time.Since(start).Milliseconds()), http.StatusBadGateway)
+			metrics.RecordRequest(r.URL.Path, model, modelReq.Stream, backend.Name, backend.URL, float64(time.Since(start).Milliseconds()), http.StatusBadGateway)
 			return
 		}
 
-		if modelReq.Stream {
+		streaming := upstreamStreaming(cfg, resp, modelReq.Stream)
+		if modelReq.Stream && !streaming {
+			log.Printf("上游未返回流式响应（Content-Type=%q），按普通 JSON 响应返回", resp.Header.Get("Content-Type"))
+		}
+
+		if streaming {
 			w.Header().Set("Content-Type", "text/event-stream")
 			w.Header().Set("Cache-Control", "no-cache")
-			w.Header().Set("Connection", "keep-alive")
 			w.WriteHeader(resp.StatusCode)
-			if _, err := w.Write(respBody); err != nil {
+			clientBody := respBody
+			if anthropic {
+				stream := translate.NewAnthropicStream(modelReq.Model)
+				clientBody = append(stream.Write(respBody), stream.Finish()...)
+			}
+			if _, err := w.Write(clientBody); err != nil {
 				log.Printf("写入流式响应失败: %v", err)
 			}
 		} else {
-			w.Header().Set("Content-Type", "application/json")
+			clientBody := respBody
+			if anthropic {
+				clientBody = anthropicResponse(resp.StatusCode, respBody, modelReq.Model)
+			}
+			contentType := writeUpstreamHeaders(w, resp, anthropic)
 			w.WriteHeader(resp.StatusCode)
-			if _, err := w.Write(respBody); err != nil {
+			if _, err := w.Write(clientBody); err != nil {
 				log.Printf("写入响应失败: %v", err)
+			} else {
+				idem.store(resp.StatusCode, contentType, clientBody)
 			}
 		}
 
 		latency := float64(time.Since(start).Milliseconds())
-		metrics.RecordRequest(r.URL.Path, modelReq.Stream, backend.URL, latency, resp.StatusCode)
+		metrics.RecordRequest(r.URL.Path, model, modelReq.Stream, backend.Name, backend.URL, latency, resp.StatusCode)
 
 		log.Printf("请求完成: status=%d, latency=%dms", resp.StatusCode, int(latency))
+		traceResponse(r, model, modelReq.Stream, backend, resp.StatusCode, respBody, streaming)
 
 		// 异步处理用量上报和日志记录
 		go func() {
-			usage := collectUsage(bodyBytes, respBody, modelReq.Stream, backend.URL, r.URL.Path, resp.StatusCode, int64(latency))
+			usage := collectUsage(bodyBytes, respBody, streaming, backend.URL, r.URL.Path, resp.StatusCode, int64(latency))
 			if usage != nil {
-				if keyStore != nil {
-					apiKeyStr := extractAPIKey(r)
+				if identity := types.IdentityFromContext(r.Context()); identity != nil {
+					usage.UserID = identity.UserID
+					usage.APIKey = identity.APIKey
+				} else if keyStore != nil {
+					apiKeyStr := extractAPIKey(r, cfg.Auth)
 					if apiKeyStr != "" {
 						key, err := keyStore.Get(apiKeyStr)
 						if err == nil {
@@ -143,7 +236,8 @@ func NewDatabaseHandler(
 				if usage.Usage != nil {
 					metrics.RecordUsage(usage.Usage.PromptTokens, usage.Usage.CompletionTokens)
 
-					if keyStore != nil && usage.APIKey != "" {
+					// 估算的用量不扣减额度
+					if keyStore != nil && usage.APIKey != "" && !usage.Estimated {
 						totalTokens := int64(usage.Usage.PromptTokens + usage.Usage.CompletionTokens)
 						if err := keyStore.IncrementUsedQuota(usage.APIKey, totalTokens); err != nil {
 							log.Printf("扣减额度失败: %v", err)
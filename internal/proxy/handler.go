@@ -7,15 +7,20 @@ import (
 	"log"
 	"math/rand"
 	"net/http"
+	"strings"
 	"time"
 
 	"llmproxy/internal/auth"
+	"llmproxy/internal/billing"
 	"llmproxy/internal/config"
 	"llmproxy/internal/hooks"
 	"llmproxy/internal/lb"
 	"llmproxy/internal/metrics"
 	"llmproxy/internal/ratelimit"
 	"llmproxy/internal/routing"
+	"llmproxy/internal/tracing"
+	"llmproxy/internal/translate"
+	"llmproxy/internal/utils"
 )
 
 // 全局 HTTP 客户端（复用连接池）
@@ -30,7 +35,8 @@ var proxyClient = &http.Client{
 
 // RequestBody 请求体结构（仅用于提取 stream 参数）
 type RequestBody struct {
-	Stream bool `json:"stream"`
+	Model  string `json:"model"`
+	Stream bool   `json:"stream"`
 }
 
 // HandlerOptions 处理器选项
@@ -42,6 +48,8 @@ type HandlerOptions struct {
 	Limiter      ratelimit.RateLimiter
 	Logger       *Logger
 	Hooks        *hooks.Executor
+	Spend        *billing.SpendTracker // 每日消费统计（可选）
+	Idempotency  *IdempotencyCache     // Idempotency-Key 响应缓存（可选）
 }
 
 // NewHandler 创建代理处理器
@@ -66,21 +74,29 @@ func NewHandler(cfg *config.Config, loadBalancer lb.LoadBalancer, router *routin
 
 // NewHandlerWithOptions 使用完整选项创建代理处理器
 func NewHandlerWithOptions(opts *HandlerOptions) http.HandlerFunc {
+	// 额度阈值告警（在扣减额度时触发）
+	if opts.Config.Auth != nil {
+		opts.KeyStore = auth.NewAlertingKeyStore(opts.KeyStore, opts.Config.Auth.QuotaAlerts)
+	}
+	// 流量镜像（routing.mirror，未启用时为 nil）
+	mirror := routing.NewMirror(opts.Config.Routing, opts.Config.Upstream)
+
 	return func(w http.ResponseWriter, r *http.Request) {
 		start := time.Now()
+		defer metrics.InFlightStart()()
 		requestID := generateRequestID()
 		clientIP := ExtractClientIP(r)
 
 		// 提取 API Key 和 User ID（用于日志和钩子）
-		apiKey := extractAPIKey(r)
-		var userID string
-		if opts.KeyStore != nil && apiKey != "" {
-			if key, err := opts.KeyStore.Get(apiKey); err == nil {
-				userID = key.UserID
-			}
-		}
+		apiKey := extractAPIKey(r, opts.Config.Auth)
+		userID := resolveUserID(r, opts.KeyStore, apiKey)
 
 		// 1. 仅处理 LLM API 路径
+		// 启用 server.anthropic_messages 时 /v1/messages 按 Chat Completions 转发，响应转换回 Anthropic 格式
+		anthropic := anthropicMessagesRequest(opts.Config, r)
+		if anthropic {
+			r = withPath(r, translate.OpenAIChatPath)
+		}
 		if !isLLMEndpoint(r.URL.Path) {
 			http.NotFound(w, r)
 			return
@@ -101,6 +117,7 @@ func NewHandlerWithOptions(opts *HandlerOptions) http.HandlerFunc {
 			}
 			proxyReq, _ := http.NewRequest("GET", backend.URL+r.URL.Path, nil)
 			proxyReq.Header = r.Header.Clone()
+			utils.StampUpstreamHeaders(proxyReq.Header, opts.Config.Upstream)
 			resp, err := proxyClient.Do(proxyReq)
 			if err != nil {
 				http.Error(w, "Backend error", http.StatusBadGateway)
@@ -120,18 +137,25 @@ func NewHandlerWithOptions(opts *HandlerOptions) http.HandlerFunc {
 			return
 		}
 
-		// 3. 读取请求体
-		bodyBytes, err := io.ReadAll(r.Body)
+		// 3. 读取请求体（超过 server.max_body_size 时返回 413）
+		bodyBytes, err := readRequestBody(w, r, opts.Config)
 		if err != nil {
-			log.Printf("读取请求体失败: %v", err)
-			http.Error(w, "Bad request", http.StatusBadRequest)
 			return
 		}
 		defer func() {
 			_ = r.Body.Close()
 		}()
 
-		// 4. 解析请求体，仅提取 stream 参数
+		// 3.1 Anthropic 请求体转换为 OpenAI 格式
+		if anthropic {
+			if bodyBytes, err = translate.AnthropicToOpenAI(bodyBytes); err != nil {
+				log.Printf("转换 Anthropic 请求失败: %v", err)
+				writeAnthropicError(w, http.StatusBadRequest, "invalid_request_error", err.Error())
+				return
+			}
+		}
+
+		// 4. 解析请求体，仅提取 model 和 stream 参数
 		var reqBody RequestBody
 		if err := json.Unmarshal(bodyBytes, &reqBody); err != nil {
 			log.Printf("解析请求体失败: %v", err)
@@ -140,6 +164,7 @@ func NewHandlerWithOptions(opts *HandlerOptions) http.HandlerFunc {
 		}
 
 		// 4.1 执行 on_request 钩子
+		var loggedBody []byte // 请求日志使用的请求体（nil 表示使用实际发往后端的请求体）
 		if opts.Hooks != nil {
 			hookCtx := &hooks.HookContext{
 				Request:   hooks.ExtractRequestInfo(r, bodyBytes, clientIP, apiKey, userID),
@@ -152,18 +177,125 @@ func NewHandlerWithOptions(opts *HandlerOptions) http.HandlerFunc {
 				http.Error(w, result.Error, http.StatusForbidden)
 				return
 			}
+
+			// 钩子修改了请求体：重新校验 JSON 并重新提取 model/stream，
+			// 保证后续路由、限流、日志和用量统计都基于修改后的请求
+			if result.Modified && len(result.Body) > 0 {
+				var modified RequestBody
+				if err := json.Unmarshal(result.Body, &modified); err != nil {
+					log.Printf("on_request 钩子返回的请求体不是合法 JSON: %v", err)
+					http.Error(w, "Invalid request body from on_request hook", http.StatusInternalServerError)
+					return
+				}
+				if modified.Model != reqBody.Model {
+					log.Printf("on_request 钩子修改了模型: %s -> %s", reqBody.Model, modified.Model)
+				}
+				if opts.Config.Hooks != nil && opts.Config.Hooks.LogOriginalBody {
+					loggedBody = bodyBytes
+				}
+				bodyBytes = result.Body
+				reqBody = modified
+			}
+			// 钩子修改了请求头：写入发往后端的请求头（空值表示删除）
+			if result.Modified && len(result.Headers) > 0 {
+				r = applyHookHeaders(r, result.Headers)
+			}
+		}
+
+		// 4.2 按 Prefer 请求头固定上游模型名（在钩子之后，保证不再被改写）
+		bodyBytes, reqBody.Model, err = applyModelPin(opts.Config, w, r, bodyBytes, reqBody.Model)
+		if err != nil {
+			log.Printf("拒绝固定模型: %v", err)
+			http.Error(w, `{"error":"Model not allowed for pinning"}`, http.StatusBadRequest)
+			return
+		}
+		if w.Header().Get("Preference-Applied") != "" {
+			// 客户端固定了模型版本，不允许再降级到其他模型
+			r = r.WithContext(routing.WithoutModelFallback(r.Context()))
+		}
+
+		// 检查 Key 的模型白名单（在钩子和模型固定之后，检查最终请求的模型）
+		if !checkAllowedModel(opts.Config, w, r, reqBody.Model) {
+			opts.Logger.LogDenied(r, apiKey, http.StatusForbidden, "model_not_allowed", time.Since(start))
+			return
+		}
+
+		// 4.3 校验 tools / response_format 结构（server.request_validation，未启用时跳过）
+		if err := validateStructuredRequest(requestValidation(opts.Config), bodyBytes); err != nil {
+			log.Printf("请求结构校验失败: %v", err)
+			writeValidationError(w, err)
+			return
+		}
+
+		// 流式请求附加 stream_options.include_usage（usage.include_stream_usage），保证上游返回用量
+		bodyBytes = includeStreamUsage(opts.Config.Usage, r.URL.Path, bodyBytes, reqBody.Stream)
+
+		// 4.4 模型级限流（rate_limit.per_model，与 Key 无关）
+		if ok, _ := ratelimit.AllowModel(opts.Limiter, opts.Config.RateLimit, reqBody.Model); !ok {
+			opts.Logger.LogDenied(r, apiKey, http.StatusTooManyRequests, "ratelimit:model", time.Since(start))
+			w.Header().Set("Retry-After", "1")
+			http.Error(w, `{"error":"Model rate limit exceeded"}`, http.StatusTooManyRequests)
+			return
+		}
+
+		// 4.5 流式并发数限制（流结束或客户端断开时释放）
+		if reqBody.Stream {
+			releaseStream, ok := ratelimit.AcquireStream(opts.Limiter, opts.Config.RateLimit, apiKey, clientIP)
+			if !ok {
+				opts.Logger.LogDenied(r, apiKey, http.StatusTooManyRequests, "ratelimit:stream", time.Since(start))
+				http.Error(w, `{"error":"Concurrent stream limit exceeded"}`, http.StatusTooManyRequests)
+				return
+			}
+			defer releaseStream()
+		}
+
+		// 4.6 幂等键（server.idempotency，仅非流式请求）：重复请求直接返回缓存的响应
+		idem, handled := opts.Idempotency.Begin(w, r, apiKey, bodyBytes, reqBody.Stream)
+		if handled {
+			return
 		}
+		defer idem.release()
 
 		// 5. 选择后端并发送请求
+		// 哈希 Key 写入请求上下文，供一致性哈希策略（含智能路由）使用
+		hashKey := extractHashKey(r, opts.Config.Routing, apiKey, clientIP)
+		r = r.WithContext(lb.WithHashKey(r.Context(), hashKey))
+		// 流式标记：路由器只在首字节前重试流式请求
+		r = r.WithContext(routing.WithStream(r.Context(), reqBody.Stream))
+
+		// 5.1 执行 on_route 钩子：返回 metadata.backend 时指定后端（URL / 名称）或后端组，
+		// 目标不存在或不健康时按默认规则路由
+		if opts.Hooks != nil {
+			hookCtx := &hooks.HookContext{
+				Request:   hooks.ExtractRequestInfo(r, bodyBytes, clientIP, apiKey, userID),
+				Metadata:  map[string]interface{}{"model": reqBody.Model},
+				Timestamp: start,
+			}
+			result := opts.Hooks.ExecuteOnRoute(hookCtx)
+			if !result.Continue {
+				log.Printf("on_route 钩子拒绝请求: %s", result.Error)
+				http.Error(w, result.Error, http.StatusForbidden)
+				return
+			}
+			if target, _ := result.Metadata["backend"].(string); target != "" {
+				r = r.WithContext(routing.WithRouteTarget(r.Context(), target))
+			}
+		}
+
 		var resp *http.Response
 		var backend *lb.Backend
 
 		if opts.Router != nil {
 			// 使用智能路由（带重试和故障转移）
-			resp, backend, err = opts.Router.ProxyRequest(r, bodyBytes, "")
+			resp, backend, err = opts.Router.ProxyRequest(r, bodyBytes, reqBody.Model)
 		} else {
 			// 使用简单负载均衡
-			backend = opts.LoadBalancer.Next()
+			if target := routing.RouteTarget(r.Context()); target != "" {
+				backend = routing.ChooseRouteTarget(opts.LoadBalancer, target)
+			}
+			if backend == nil {
+				backend = lb.Choose(opts.LoadBalancer, hashKey, lb.DefaultPool)
+			}
 			if backend == nil {
 				log.Println("没有可用的健康后端")
 				// 执行 on_error 钩子
@@ -179,9 +311,12 @@ func NewHandlerWithOptions(opts *HandlerOptions) http.HandlerFunc {
 				http.Error(w, "No healthy backend", http.StatusServiceUnavailable)
 				return
 			}
-			resp, err = sendRequest(r, backend, bodyBytes)
+			resp, err = sendRequest(r, backend, bodyBytes, opts.Config.Upstream)
 		}
 
+		// 主请求发出后按比例异步镜像到影子后端，不影响主请求
+		mirror.Send(r, bodyBytes, reqBody.Model)
+
 		if err != nil {
 			log.Printf("后端请求失败: %v", err)
 			// 执行 on_error 钩子
@@ -196,7 +331,7 @@ func NewHandlerWithOptions(opts *HandlerOptions) http.HandlerFunc {
 			}
 			http.Error(w, "Backend error", http.StatusBadGateway)
 			if backend != nil {
-				metrics.RecordRequest(r.URL.Path, reqBody.Stream, backend.URL, float64(time.Since(start).Milliseconds()), http.StatusBadGateway)
+				metrics.RecordRequest(r.URL.Path, reqBody.Model, reqBody.Stream, backend.Name, backend.URL, float64(time.Since(start).Milliseconds()), http.StatusBadGateway)
 			}
 			return
 		}
@@ -206,14 +341,29 @@ func NewHandlerWithOptions(opts *HandlerOptions) http.HandlerFunc {
 
 		log.Printf("请求转发到后端: %s, stream=%v", backend.URL, reqBody.Stream)
 
+		// 5.1 发生模型降级时告知客户端，后续日志和用量统计使用实际模型
+		if fallback := resp.Header.Get(routing.ModelFallbackHeader); fallback != "" {
+			log.Printf("请求模型 %s 已降级为 %s", reqBody.Model, fallback)
+			w.Header().Set(routing.ModelFallbackHeader, fallback)
+			reqBody.Model = fallback
+			if rewritten, err := routing.RewriteModel(bodyBytes, fallback); err == nil {
+				bodyBytes = rewritten
+			}
+		}
+
 		// 6. 处理响应
 		var respBody []byte
+		var disconnected bool // 客户端是否中途断开
 
-		if reqBody.Stream {
+		streaming := upstreamStreaming(opts.Config, resp, reqBody.Stream)
+		if reqBody.Stream && !streaming {
+			log.Printf("上游未返回流式响应（Content-Type=%q），按普通 JSON 响应返回", resp.Header.Get("Content-Type"))
+		}
+
+		if streaming {
 			// 流式响应：逐块转发，实现真正的 SSE 流式传输
 			w.Header().Set("Content-Type", "text/event-stream")
 			w.Header().Set("Cache-Control", "no-cache")
-			w.Header().Set("Connection", "keep-alive")
 			w.Header().Set("X-Accel-Buffering", "no") // 禁用 nginx 缓冲
 			w.WriteHeader(resp.StatusCode)
 
@@ -227,41 +377,73 @@ func NewHandlerWithOptions(opts *HandlerOptions) http.HandlerFunc {
 			var buffer bytes.Buffer
 			buf := make([]byte, 4096)
 
+			// Anthropic 请求：SSE 数据逐块转换为 Anthropic 事件（缓冲区仍保存 OpenAI 格式用于用量统计）
+			var anthropicStream *translate.AnthropicStream
+			if anthropic {
+				anthropicStream = translate.NewAnthropicStream(reqBody.Model)
+			}
+
 			for {
 				n, readErr := resp.Body.Read(buf)
 				if n > 0 {
+					// 先收集到缓冲区，确保客户端断开时已收到的数据仍计入用量
+					_, _ = buffer.Write(buf[:n]) // buffer.Write 不会返回错误
+					chunk := buf[:n]
+					if anthropicStream != nil {
+						chunk = anthropicStream.Write(chunk)
+					}
 					// 写入客户端
-					if _, err := w.Write(buf[:n]); err != nil {
+					if _, err := w.Write(chunk); err != nil {
 						log.Printf("写入客户端失败: %v", err)
+						disconnected = true
 						break
 					}
 					if flusher != nil {
 						flusher.Flush() // 立即刷新到客户端
 					}
-					// 同时收集到缓冲区
-					_, _ = buffer.Write(buf[:n]) // buffer.Write 不会返回错误
 				}
 				if readErr != nil {
 					if readErr != io.EOF {
-						log.Printf("读取流式响应失败: %v", readErr)
+						// 客户端断开会取消请求上下文，导致读取后端失败
+						if r.Context().Err() != nil {
+							disconnected = true
+						} else {
+							log.Printf("读取流式响应失败: %v", readErr)
+						}
 					}
 					break
 				}
 			}
+			if anthropicStream != nil && !disconnected {
+				if _, err := w.Write(anthropicStream.Finish()); err != nil {
+					log.Printf("写入客户端失败: %v", err)
+				} else if flusher != nil {
+					flusher.Flush()
+				}
+			}
 			respBody = buffer.Bytes()
+			if disconnected {
+				log.Printf("客户端在流式响应中途断开: 已接收 %d 字节", len(respBody))
+			}
 		} else {
 			// 非流式响应：读取完整响应后返回
 			respBody, err = io.ReadAll(resp.Body)
 			if err != nil {
 				log.Printf("读取响应体失败: %v", err)
 				http.Error(w, "Backend error", http.StatusBadGateway)
-				metrics.RecordRequest(r.URL.Path, reqBody.Stream, backend.URL, float64(time.Since(start).Milliseconds()), http.StatusBadGateway)
+				metrics.RecordRequest(r.URL.Path, reqBody.Model, reqBody.Stream, backend.Name, backend.URL, float64(time.Since(start).Milliseconds()), http.StatusBadGateway)
 				return
 			}
-			w.Header().Set("Content-Type", "application/json")
+			clientBody := respBody
+			if anthropic {
+				clientBody = anthropicResponse(resp.StatusCode, respBody, reqBody.Model)
+			}
+			contentType := writeUpstreamHeaders(w, resp, anthropic)
 			w.WriteHeader(resp.StatusCode)
-			if _, err := w.Write(respBody); err != nil {
+			if _, err := w.Write(clientBody); err != nil {
 				log.Printf("写入响应失败: %v", err)
+			} else {
+				idem.store(resp.StatusCode, contentType, clientBody)
 			}
 		}
 
@@ -290,29 +472,50 @@ func NewHandlerWithOptions(opts *HandlerOptions) http.HandlerFunc {
 
 		// 8. 记录请求指标
 		latency := float64(time.Since(start).Milliseconds())
-		metrics.RecordRequest(r.URL.Path, reqBody.Stream, backend.URL, latency, resp.StatusCode)
+		metrics.RecordRequest(r.URL.Path, reqBody.Model, reqBody.Stream, backend.Name, backend.URL, latency, resp.StatusCode)
 
 		log.Printf("请求完成: status=%d, latency=%dms", resp.StatusCode, int(latency))
 
+		// 8.1 记录追踪属性（模型、后端和 Token 用量）
+		traceResponse(r, reqBody.Model, reqBody.Stream, backend, resp.StatusCode, respBody, streaming)
+
 		// 9. 异步触发用量上报、日志记录和 on_complete 钩子
 		go func() {
-			usage := collectUsage(bodyBytes, respBody, reqBody.Stream, backend.URL, r.URL.Path, resp.StatusCode, int64(latency))
+			usage := collectUsage(bodyBytes, respBody, streaming, backend.URL, r.URL.Path, resp.StatusCode, int64(latency))
+			if usage != nil && disconnected {
+				// 客户端中途断开：上游通常不会再发送 usage 块，按已收到的数据估算（非 2xx 响应同样估算）
+				usage.Disconnected = true
+				if usage.Usage == nil {
+					usage.Usage = estimateStreamUsage(bodyBytes, respBody)
+					usage.Estimated = usage.Usage != nil
+				}
+			}
 			if usage != nil {
 				// 添加用户信息
 				usage.UserID = userID
 				usage.APIKey = apiKey
 
 				// 记录 Token 使用量指标（如果有 usage 信息）
+				// 估算的用量（estimated）随用量记录上报，但不扣减额度、不计入当日消费
 				if usage.Usage != nil {
 					metrics.RecordUsage(usage.Usage.PromptTokens, usage.Usage.CompletionTokens)
 
 					// 扣减额度（如果启用鉴权）
-					if opts.KeyStore != nil && usage.APIKey != "" {
+					if opts.KeyStore != nil && usage.APIKey != "" && !usage.Estimated {
 						totalTokens := int64(usage.Usage.PromptTokens + usage.Usage.CompletionTokens)
 						if err := opts.KeyStore.IncrementUsedQuota(usage.APIKey, totalTokens); err != nil {
 							log.Printf("扣减额度失败: %v", err)
 						}
 					}
+
+					// 计算费用并累计当日消费
+					if opts.Spend != nil {
+						model, _ := usage.RequestBody["model"].(string)
+						usage.Cost = opts.Spend.Cost(model, usage.Usage.PromptTokens, usage.Usage.CompletionTokens)
+						if !usage.Estimated {
+							opts.Spend.Record(usage.APIKey, usage.Cost)
+						}
+					}
 				}
 
 				// 发送用量数据（Webhook 或数据库）
@@ -334,7 +537,7 @@ func NewHandlerWithOptions(opts *HandlerOptions) http.HandlerFunc {
 					Method:       r.Method,
 					Path:         r.URL.Path,
 					Headers:      ExtractHeaders(r),
-					RequestBody:  string(bodyBytes),
+					RequestBody:  string(requestLogBody(bodyBytes, loggedBody)),
 					ResponseBody: string(respBody),
 					StatusCode:   resp.StatusCode,
 					LatencyMs:    int64(latency),
@@ -393,32 +596,182 @@ func randomString(n int) string {
 //   - r: 原始请求
 //   - backend: 后端实例
 //   - bodyBytes: 请求体
+//   - upstream: 上游请求头配置
 //
 // 返回：
 //   - *http.Response: 响应
 //   - error: 错误信息
-func sendRequest(r *http.Request, backend *lb.Backend, bodyBytes []byte) (*http.Response, error) {
-	proxyReq, err := http.NewRequest("POST", backend.URL+r.URL.Path, bytes.NewReader(bodyBytes))
+func sendRequest(r *http.Request, backend *lb.Backend, bodyBytes []byte, upstream *config.UpstreamConfig) (*http.Response, error) {
+	ctx, span := tracing.Start(r.Context(), "backend.request", tracing.KindClient)
+	defer span.End()
+	span.SetAttr("backend.url", backend.URL)
+
+	// 绑定客户端请求上下文，客户端断开时同时中断后端请求
+	proxyReq, err := http.NewRequestWithContext(ctx, "POST", backend.URL+r.URL.Path, bytes.NewReader(bodyBytes))
 	if err != nil {
+		span.SetError(err)
 		return nil, err
 	}
 
 	proxyReq.Header = r.Header.Clone()
-	return proxyClient.Do(proxyReq)
+	utils.StampUpstreamHeaders(proxyReq.Header, upstream)
+	tracing.Inject(ctx, proxyReq.Header)
+
+	backend.StartRequest()
+	sent := time.Now()
+	resp, err := proxyClient.Do(proxyReq)
+	backend.EndRequest(time.Since(sent), err)
+	if err != nil {
+		span.SetError(err)
+		return nil, err
+	}
+	span.SetHTTPStatus(resp.StatusCode)
+	return resp, nil
+}
+
+// traceResponse 将模型、后端和 Token 用量记录到请求的根 Span
+// 未启用追踪时直接返回，不解析响应体
+// 参数：
+//   - r: 原始请求
+//   - model: 实际使用的模型
+//   - stream: 客户端是否请求流式响应
+//   - backend: 处理请求的后端
+//   - statusCode: 后端响应状态码
+//   - respBody: 响应体
+//   - streaming: 是否按 SSE 流式转发
+func traceResponse(r *http.Request, model string, stream bool, backend *lb.Backend, statusCode int, respBody []byte, streaming bool) {
+	span := tracing.FromContext(r.Context())
+	if span == nil {
+		return
+	}
+	span.SetAttr("llm.model", model)
+	span.SetAttr("llm.stream", stream)
+	span.SetAttr("backend.url", backend.URL)
+	span.SetAttr("backend.status_code", statusCode)
+	if usage, _, _ := parseUsage(respBody, streaming); usage != nil {
+		span.SetAttr("llm.usage.prompt_tokens", usage.PromptTokens)
+		span.SetAttr("llm.usage.completion_tokens", usage.CompletionTokens)
+		span.SetAttr("llm.usage.total_tokens", usage.TotalTokens)
+	}
 }
 
-// extractAPIKey 从请求中提取 API Key
+// upstreamStreaming 判断上游是否真正返回了流式响应
+// 部分后端会忽略 stream: true 直接返回完整 JSON，此时按普通响应转发，避免客户端误解析；
+// 非 2xx 且不是 SSE 的错误响应（如 429 JSON 错误）始终按普通响应转发，不受 stream_mismatch 影响
+// 参数：
+//   - cfg: 配置对象（server.stream_mismatch 为 sse 时保持按请求参数处理）
+//   - resp: 后端响应
+//   - requested: 客户端是否请求了流式响应
+//
+// 返回：
+//   - bool: 是否按 SSE 流式转发
+func upstreamStreaming(cfg *config.Config, resp *http.Response, requested bool) bool {
+	if !requested {
+		return false
+	}
+
+	contentType := strings.ToLower(resp.Header.Get("Content-Type"))
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return strings.Contains(contentType, "text/event-stream")
+	}
+	if cfg != nil && cfg.Server != nil && cfg.Server.StreamMismatch == config.StreamMismatchSSE {
+		return true
+	}
+
+	if contentType == "" {
+		// 未声明类型：长度已知（非分块传输）视为完整响应
+		return resp.ContentLength < 0
+	}
+	return strings.Contains(contentType, "text/event-stream")
+}
+
+// writeUpstreamHeaders 写入非流式响应的响应头
+// 成功响应固定为 application/json；上游错误响应保留其 Content-Type（如 HTML 网关错误页）
+// 和 Retry-After，客户端可以按上游的限流提示退避
+// 参数：
+//   - w: 响应写入器
+//   - resp: 后端响应
+//   - anthropic: 是否为 Anthropic 请求（响应已转换为 Anthropic 格式的 JSON）
+//
+// 返回：
+//   - string: 写入的 Content-Type
+func writeUpstreamHeaders(w http.ResponseWriter, resp *http.Response, anthropic bool) string {
+	contentType := "application/json"
+	if resp.StatusCode >= 400 {
+		if ct := resp.Header.Get("Content-Type"); ct != "" && !anthropic {
+			contentType = ct
+		}
+		if retryAfter := resp.Header.Get("Retry-After"); retryAfter != "" {
+			w.Header().Set("Retry-After", retryAfter)
+		}
+	}
+	w.Header().Set("Content-Type", contentType)
+	return contentType
+}
+
+// extractAPIKey 从请求中提取 API Key（与鉴权使用相同的 Header、认证方案和查询参数）
 // 参数：
 //   - r: HTTP 请求
+//   - cfg: 鉴权配置（为 nil 时使用默认 Header 和 Bearer 方案）
 //
 // 返回：
 //   - string: API Key
-func extractAPIKey(r *http.Request) string {
-	auth := r.Header.Get("Authorization")
-	if auth != "" && len(auth) > 7 && auth[:7] == "Bearer " {
-		return auth[7:]
+func extractAPIKey(r *http.Request, cfg *config.AuthConfig) string {
+	if cfg == nil {
+		return utils.ExtractAPIKeyFromRequest(r, nil)
 	}
-	return r.Header.Get("X-API-Key")
+	return utils.ExtractAPIKeyFromRequest(r, &utils.APIKeySource{
+		HeaderNames: cfg.HeaderNames,
+		Scheme:      cfg.Scheme,
+		QueryParam:  cfg.QueryParam,
+	})
+}
+
+// protectedHookHeaders 钩子不能修改的请求头（由代理和 HTTP 客户端维护）
+var protectedHookHeaders = map[string]bool{
+	"Host":              true,
+	"Content-Length":    true,
+	"Transfer-Encoding": true,
+	"Connection":        true,
+}
+
+// applyHookHeaders 将 on_request 钩子返回的请求头写入请求副本
+// 参数：
+//   - r: HTTP 请求
+//   - headers: 钩子返回的请求头（值为空字符串时删除该请求头）
+//
+// 返回：
+//   - *http.Request: 请求头已修改的请求副本（不影响外层中间件持有的原请求）
+func applyHookHeaders(r *http.Request, headers map[string]string) *http.Request {
+	r2 := r.WithContext(r.Context())
+	r2.Header = r.Header.Clone()
+	for name, value := range headers {
+		name = http.CanonicalHeaderKey(name)
+		if protectedHookHeaders[name] {
+			log.Printf("on_request 钩子不能修改请求头 %s，已忽略", name)
+			continue
+		}
+		if value == "" {
+			r2.Header.Del(name)
+		} else {
+			r2.Header.Set(name, value)
+		}
+	}
+	return r2
+}
+
+// requestLogBody 选择请求日志记录的请求体
+// 参数：
+//   - sent: 实际发往后端的请求体
+//   - original: hooks.log_original_body 开启且钩子修改了请求体时为原始请求体，否则为 nil
+//
+// 返回：
+//   - []byte: 日志记录的请求体
+func requestLogBody(sent, original []byte) []byte {
+	if original != nil {
+		return original
+	}
+	return sent
 }
 
 // isLLMEndpoint 判断是否为 LLM API 端点
@@ -433,3 +786,25 @@ func isLLMEndpoint(path string) bool {
 		path == "/v1/embeddings" ||
 		path == "/v1/models"
 }
+
+// extractHashKey 提取一致性哈希 Key
+// 优先级：缓存亲和 Header > API Key > 客户端 IP
+// 参数：
+//   - r: HTTP 请求
+//   - routing: 路由配置
+//   - apiKey: API Key
+//   - clientIP: 客户端 IP
+//
+// 返回：
+//   - string: 哈希 Key
+func extractHashKey(r *http.Request, routing *config.RoutingConfig, apiKey, clientIP string) string {
+	if routing != nil && routing.ConsistentHash != nil && routing.ConsistentHash.Header != "" {
+		if v := r.Header.Get(routing.ConsistentHash.Header); v != "" {
+			return v
+		}
+	}
+	if apiKey != "" {
+		return apiKey
+	}
+	return clientIP
+}
@@ -0,0 +1,414 @@
+package proxy
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"llmproxy/internal/config"
+	"llmproxy/internal/lb"
+	"llmproxy/internal/metrics"
+	"llmproxy/internal/middleware"
+	"llmproxy/internal/ratelimit"
+	"llmproxy/internal/routing"
+)
+
+// newTestProxy 创建转发到指定模拟后端的代理处理器（简单负载均衡，不启用鉴权）
+// cfg 为 nil 时使用空配置，后端列表由 upstreams 生成
+func newTestProxy(t *testing.T, cfg *config.Config, upstreams ...*httptest.Server) http.HandlerFunc {
+	t.Helper()
+	if cfg == nil {
+		cfg = &config.Config{}
+	}
+	for i, upstream := range upstreams {
+		cfg.Backends = append(cfg.Backends, &config.Backend{Name: fmt.Sprintf("upstream-%d", i), URL: upstream.URL, Weight: 1})
+	}
+	return NewHandlerWithOptions(&HandlerOptions{
+		Config:       cfg,
+		LoadBalancer: lb.NewRoundRobin(cfg.Backends, nil),
+	})
+}
+
+// newTestUpstream 启动模拟后端，测试结束时关闭
+func newTestUpstream(t *testing.T, handler http.HandlerFunc) *httptest.Server {
+	t.Helper()
+	server := httptest.NewServer(handler)
+	t.Cleanup(server.Close)
+	return server
+}
+
+// postProxy 向代理发送 POST 请求
+func postProxy(h http.Handler, path, body string, header http.Header) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(http.MethodPost, path, strings.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	for k, v := range header {
+		req.Header[k] = v
+	}
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+	return rec
+}
+
+// metricValue 读取指定样本的当前值（不存在时返回空字符串）
+func metricValue(t *testing.T, sample string) string {
+	t.Helper()
+	rec := httptest.NewRecorder()
+	metrics.Handler(rec, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+	for _, line := range strings.Split(rec.Body.String(), "\n") {
+		if value, ok := strings.CutPrefix(line, sample+" "); ok {
+			return value
+		}
+	}
+	return ""
+}
+
+// inflightGauge 读取 llmproxy_inflight_requests 的当前值
+func inflightGauge(t *testing.T) string {
+	t.Helper()
+	value := metricValue(t, "llmproxy_inflight_requests")
+	if value == "" {
+		t.Fatal("llmproxy_inflight_requests not exported")
+	}
+	return value
+}
+
+func TestInFlightGauge(t *testing.T) {
+	metrics.Init(nil)
+	t.Cleanup(func() { metrics.Init(nil) })
+
+	// 后端收到请求后阻塞，直到 release 关闭
+	arrived := make(chan struct{}, 8)
+	release := make(chan struct{})
+	upstream := newTestUpstream(t, func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		arrived <- struct{}{}
+		<-release
+		if strings.Contains(string(body), `"stream":true`) {
+			w.Header().Set("Content-Type", "text/event-stream")
+			fmt.Fprint(w, "data: {\"choices\":[]}\n\ndata: [DONE]\n\n")
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		fmt.Fprint(w, `{"choices":[]}`)
+	})
+	h := newTestProxy(t, nil, upstream)
+
+	if got := inflightGauge(t); got != "0" {
+		t.Fatalf("idle gauge = %s, want 0", got)
+	}
+
+	// 同时发出流式和非流式请求
+	bodies := []string{
+		`{"model":"m","stream":true}`,
+		`{"model":"m"}`,
+		`{"model":"m"}`,
+	}
+	var wg sync.WaitGroup
+	for _, body := range bodies {
+		wg.Add(1)
+		go func(body string) {
+			defer wg.Done()
+			if rec := postProxy(h, "/v1/chat/completions", body, nil); rec.Code != http.StatusOK {
+				t.Errorf("status = %d, body = %s", rec.Code, rec.Body)
+			}
+		}(body)
+	}
+	for range bodies {
+		select {
+		case <-arrived:
+		case <-time.After(5 * time.Second):
+			t.Fatal("requests did not reach the upstream")
+		}
+	}
+
+	if got := inflightGauge(t); got != "3" {
+		t.Errorf("gauge with 3 blocked requests = %s, want 3", got)
+	}
+
+	close(release)
+	wg.Wait()
+	if got := inflightGauge(t); got != "0" {
+		t.Errorf("gauge after requests finished = %s, want 0", got)
+	}
+
+	// 提前返回的请求同样递减
+	postProxy(h, "/v1/chat/completions", `not json`, nil)
+	if got := inflightGauge(t); got != "0" {
+		t.Errorf("gauge after rejected request = %s, want 0", got)
+	}
+}
+
+func TestInFlightStartOnce(t *testing.T) {
+	metrics.Init(nil)
+	t.Cleanup(func() { metrics.Init(nil) })
+
+	done := metrics.InFlightStart()
+	if got := inflightGauge(t); got != "1" || metrics.InFlight() != 1 {
+		t.Fatalf("gauge = %s, InFlight() = %d, want 1", got, metrics.InFlight())
+	}
+	done()
+	done()
+	if got := inflightGauge(t); got != "0" || metrics.InFlight() != 0 {
+		t.Errorf("after double done: gauge = %s, InFlight() = %d, want 0", got, metrics.InFlight())
+	}
+}
+
+func TestStreamConnectionCloseWhileDraining(t *testing.T) {
+	upstream := newTestUpstream(t, func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/event-stream")
+		fmt.Fprint(w, "data: {\"choices\":[]}\n\ndata: [DONE]\n\n")
+	})
+	drainer := middleware.NewDrainer()
+	h := drainer.Middleware(newTestProxy(t, nil, upstream))
+
+	// 未排空时流式响应不设置 Connection，沿用默认的长连接
+	rec := postProxy(h, "/v1/chat/completions", `{"model":"m","stream":true}`, nil)
+	if rec.Code != http.StatusOK || rec.Header().Get("Content-Type") != "text/event-stream" {
+		t.Fatalf("status = %d, Content-Type = %q", rec.Code, rec.Header().Get("Content-Type"))
+	}
+	if got := rec.Header().Get("Connection"); got != "" {
+		t.Errorf("Connection before draining = %q, want empty", got)
+	}
+
+	// 排空期间流式响应保留 Connection: close
+	drainer.Start()
+	rec = postProxy(h, "/v1/chat/completions", `{"model":"m","stream":true}`, nil)
+	if got := rec.Header().Get("Connection"); got != "close" {
+		t.Errorf("Connection while draining = %q, want close", got)
+	}
+	if got := drainer.InFlight(); got != 0 {
+		t.Errorf("InFlight() after the stream = %d, want 0", got)
+	}
+}
+
+func TestModelRateLimit(t *testing.T) {
+	var hits atomic.Int32
+	upstream := newTestUpstream(t, func(w http.ResponseWriter, r *http.Request) {
+		hits.Add(1)
+		w.Header().Set("Content-Type", "application/json")
+		fmt.Fprint(w, `{"choices":[]}`)
+	})
+	cfg := &config.Config{
+		Backends: []*config.Backend{{Name: "upstream", URL: upstream.URL, Weight: 1}},
+		RateLimit: &config.RateLimitConfig{
+			Enabled: true,
+			PerModel: []config.ModelLimit{
+				{Models: []string{"gpt-4*"}, RequestsPerSecond: 1, BurstSize: 1},
+			},
+		},
+	}
+	h := NewHandlerWithOptions(&HandlerOptions{
+		Config:       cfg,
+		LoadBalancer: lb.NewRoundRobin(cfg.Backends, nil),
+		Limiter:      ratelimit.NewMemoryRateLimiter(ratelimit.Limit{}),
+	})
+
+	tests := []struct {
+		name  string
+		model string
+		want  int
+	}{
+		{"匹配规则的首个请求", "gpt-4", http.StatusOK},
+		{"通配匹配的模型共享额度", "gpt-4o", http.StatusTooManyRequests},
+		{"未匹配的模型不限流", "gpt-3.5-turbo", http.StatusOK},
+		{"未匹配的模型再次请求", "gpt-3.5-turbo", http.StatusOK},
+	}
+	for _, tt := range tests {
+		rec := postProxy(h, "/v1/chat/completions", `{"model":"`+tt.model+`"}`, nil)
+		if rec.Code != tt.want {
+			t.Errorf("%s: status = %d, want %d", tt.name, rec.Code, tt.want)
+			continue
+		}
+		if rec.Code == http.StatusTooManyRequests {
+			if rec.Header().Get("Retry-After") != "1" || !strings.Contains(rec.Body.String(), "Model rate limit exceeded") {
+				t.Errorf("%s: Retry-After = %q, body = %s", tt.name, rec.Header().Get("Retry-After"), rec.Body)
+			}
+		}
+	}
+
+	// 被拒绝的请求不转发到后端
+	if got := hits.Load(); got != 3 {
+		t.Errorf("upstream hits = %d, want 3", got)
+	}
+}
+
+func TestStreamLimit(t *testing.T) {
+	metrics.Init(nil)
+	t.Cleanup(func() { metrics.Init(nil) })
+
+	started := make(chan struct{}, 1)
+	hold := make(chan struct{})
+	var releaseOnce sync.Once
+	releaseUpstream := func() { releaseOnce.Do(func() { close(hold) }) }
+	upstream := newTestUpstream(t, func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/event-stream")
+		fmt.Fprint(w, "data: {\"choices\":[]}\n\n")
+		w.(http.Flusher).Flush()
+		select {
+		case started <- struct{}{}:
+		default:
+		}
+		select {
+		case <-hold:
+		case <-r.Context().Done():
+			return
+		}
+		fmt.Fprint(w, "data: {\"choices\":[],\"usage\":{\"prompt_tokens\":3,\"completion_tokens\":1,\"total_tokens\":4}}\n\n")
+		fmt.Fprint(w, "data: [DONE]\n\n")
+	})
+	t.Cleanup(releaseUpstream) // 先于关闭模拟后端执行
+	accessLog := filepath.Join(t.TempDir(), "access.log")
+	logger, err := NewLogger(&config.LoggingConfig{Enabled: true, Access: &config.AccessLoggingConfig{
+		Enabled:   true,
+		Output:    "file",
+		LogDenied: true,
+		File:      &config.LogFileConfig{Path: accessLog},
+	}}, nil, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = logger.Close() })
+	cfg := &config.Config{
+		Backends: []*config.Backend{{Name: "upstream", URL: upstream.URL, Weight: 1}},
+		RateLimit: &config.RateLimitConfig{
+			Enabled: true,
+			PerKey:  &config.KeyLimit{Enabled: true, MaxConcurrentStreams: 1},
+		},
+	}
+	h := NewHandlerWithOptions(&HandlerOptions{
+		Config:       cfg,
+		LoadBalancer: lb.NewRoundRobin(cfg.Backends, nil),
+		Limiter:      ratelimit.NewMemoryRateLimiter(ratelimit.Limit{}),
+		Logger:       logger,
+	})
+	const body = `{"model":"gpt-4o","stream":true}`
+
+	// 第一个流保持连接
+	first := make(chan *httptest.ResponseRecorder, 1)
+	go func() { first <- postProxy(h, "/v1/chat/completions", body, nil) }()
+	select {
+	case <-started:
+	case <-time.After(5 * time.Second):
+		t.Fatal("first stream did not reach the upstream")
+	}
+
+	// 超出名额：返回 429 并记录拒绝原因
+	rec := postProxy(h, "/v1/chat/completions", body, nil)
+	if rec.Code != http.StatusTooManyRequests || !strings.Contains(rec.Body.String(), "Concurrent stream limit exceeded") {
+		t.Fatalf("second stream: status = %d, body = %s; want 429", rec.Code, rec.Body)
+	}
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		data, _ := os.ReadFile(accessLog)
+		if strings.Contains(string(data), `denied="ratelimit:stream"`) {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("access log = %q, want the denied stream", data)
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+
+	// 第一个流结束后释放名额
+	releaseUpstream()
+	if rec := <-first; rec.Code != http.StatusOK {
+		t.Fatalf("first stream: status = %d", rec.Code)
+	}
+	if rec := postProxy(h, "/v1/chat/completions", body, nil); rec.Code != http.StatusOK {
+		t.Errorf("stream after release: status = %d, want 200", rec.Code)
+	}
+
+	// 等待两个流的用量异步记录完成，避免影响后续测试的指标
+	const sample = `llmproxy_usage_tokens_total{type="prompt"}`
+	deadline = time.Now().Add(5 * time.Second)
+	for metricValue(t, sample) != "6" && time.Now().Before(deadline) {
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+func TestHedgedRequestUsageCountedOnce(t *testing.T) {
+	metrics.Init(nil)
+	t.Cleanup(func() { metrics.Init(nil) })
+
+	// slow 在 fast 胜出后才返回（如果没有被取消），两者的用量不同
+	backend := func(delay time.Duration, promptTokens int) *httptest.Server {
+		return newTestUpstream(t, func(w http.ResponseWriter, r *http.Request) {
+			_, _ = io.Copy(io.Discard, r.Body)
+			select {
+			case <-time.After(delay):
+			case <-r.Context().Done():
+				return
+			}
+			w.Header().Set("Content-Type", "application/json")
+			fmt.Fprintf(w, `{"choices":[],"usage":{"prompt_tokens":%d,"completion_tokens":1,"total_tokens":%d}}`, promptTokens, promptTokens+1)
+		})
+	}
+	slow, fast := backend(300*time.Millisecond, 1000), backend(0, 7)
+
+	cfg := &config.Config{Backends: []*config.Backend{
+		{Name: "slow", URL: slow.URL, Weight: 1},
+		{Name: "fast", URL: fast.URL, Weight: 1},
+	}}
+	balancer := lb.NewRoundRobin(cfg.Backends, nil)
+	router := routing.NewRouter(&routing.RoutingConfig{
+		Enabled: true,
+		Hedge:   &config.HedgeConfig{Enabled: true, Delay: 20 * time.Millisecond},
+	}, balancer, nil)
+	h := NewHandlerWithOptions(&HandlerOptions{Config: cfg, LoadBalancer: balancer, Router: router})
+
+	rec := postProxy(h, "/v1/chat/completions", `{"model":"gpt-4o"}`, nil)
+	if rec.Code != http.StatusOK || !strings.Contains(rec.Body.String(), `"prompt_tokens":7`) {
+		t.Fatalf("status = %d, body = %s; want the fast response", rec.Code, rec.Body)
+	}
+
+	// 用量异步记录：只计入胜出的响应
+	const sample = `llmproxy_usage_tokens_total{type="prompt"}`
+	deadline := time.Now().Add(5 * time.Second)
+	for metricValue(t, sample) == "" && time.Now().Before(deadline) {
+		time.Sleep(5 * time.Millisecond)
+	}
+	time.Sleep(400 * time.Millisecond) // 超过慢后端的响应时间
+	if got := metricValue(t, sample); got != "7" {
+		t.Errorf("prompt tokens = %s, want 7 (winner only)", got)
+	}
+}
+
+func TestMirrorDoesNotAffectPrimary(t *testing.T) {
+	shadowHit := make(chan struct{}, 1)
+	shadow := newTestUpstream(t, func(w http.ResponseWriter, r *http.Request) {
+		shadowHit <- struct{}{}
+		time.Sleep(200 * time.Millisecond)
+		http.Error(w, "shadow down", http.StatusInternalServerError)
+	})
+	upstream := newTestUpstream(t, func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		fmt.Fprint(w, `{"primary":true}`)
+	})
+	cfg := &config.Config{Routing: &config.RoutingConfig{
+		Mirror: &config.MirrorConfig{Enabled: true, Target: shadow.URL, Percentage: 100},
+	}}
+	h := newTestProxy(t, cfg, upstream)
+
+	// 客户端总是拿到主后端的响应，不等待影子后端
+	start := time.Now()
+	rec := postProxy(h, "/v1/chat/completions", `{"model":"gpt-4o"}`, nil)
+	if rec.Code != http.StatusOK || rec.Body.String() != `{"primary":true}` {
+		t.Errorf("status = %d, body = %s", rec.Code, rec.Body)
+	}
+	if elapsed := time.Since(start); elapsed >= 200*time.Millisecond {
+		t.Errorf("request waited %v for the shadow backend", elapsed)
+	}
+	select {
+	case <-shadowHit:
+	case <-time.After(5 * time.Second):
+		t.Fatal("request was not mirrored")
+	}
+}
@@ -0,0 +1,237 @@
+package proxy
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"sync"
+	"testing"
+	"time"
+
+	"llmproxy/internal/config"
+	"llmproxy/internal/hooks"
+	"llmproxy/internal/lb"
+)
+
+// rewriteModelHook 把 gpt-4o 改写为 gpt-4o-mini，并添加和删除请求头
+const rewriteModelHook = `
+local body = string.gsub(request.body, '"model":"gpt%-4o"', '"model":"gpt-4o-mini"')
+return {
+	continue = true,
+	modified = true,
+	body = body,
+	headers = { ["X-Injected"] = "yes", ["X-Remove-Me"] = "", ["Host"] = "evil.example" },
+}
+`
+
+// upstreamRequest 后端收到的请求
+type upstreamRequest struct {
+	Model    string
+	Stream   bool
+	Injected string
+	Removed  string
+	Host     string
+}
+
+// newHookProxy 创建启用 on_request 钩子的代理，返回后端收到的最后一个请求
+func newHookProxy(t *testing.T, script string, logOriginal bool, logger *Logger) (http.HandlerFunc, func() upstreamRequest) {
+	t.Helper()
+	var mu sync.Mutex
+	var got upstreamRequest
+	upstream := newTestUpstream(t, func(w http.ResponseWriter, r *http.Request) {
+		var body struct {
+			Model  string `json:"model"`
+			Stream bool   `json:"stream"`
+		}
+		data, _ := io.ReadAll(r.Body)
+		if err := json.Unmarshal(data, &body); err != nil {
+			t.Errorf("upstream body %s: %v", data, err)
+		}
+		mu.Lock()
+		got = upstreamRequest{body.Model, body.Stream, r.Header.Get("X-Injected"), r.Header.Get("X-Remove-Me"), r.Host}
+		mu.Unlock()
+		w.Header().Set("Content-Type", "application/json")
+		fmt.Fprint(w, `{"choices":[]}`)
+	})
+
+	hooksCfg := &config.HooksConfig{
+		Enabled:         true,
+		OnRequest:       &config.ScriptConfig{Enabled: true, Script: script},
+		LogOriginalBody: logOriginal,
+	}
+	executor, err := hooks.NewExecutor(hooksCfg)
+	if err != nil {
+		t.Fatalf("NewExecutor() error = %v", err)
+	}
+	cfg := &config.Config{
+		Backends: []*config.Backend{{Name: "upstream", URL: upstream.URL, Weight: 1}},
+		Hooks:    hooksCfg,
+	}
+	h := NewHandlerWithOptions(&HandlerOptions{
+		Config:       cfg,
+		LoadBalancer: lb.NewRoundRobin(cfg.Backends, nil),
+		Hooks:        executor,
+		Logger:       logger,
+	})
+	return h, func() upstreamRequest {
+		mu.Lock()
+		defer mu.Unlock()
+		return got
+	}
+}
+
+func TestOnRequestHookModifiesUpstreamRequest(t *testing.T) {
+	h, upstream := newHookProxy(t, rewriteModelHook, false, nil)
+
+	header := http.Header{}
+	header.Set("X-Remove-Me", "secret")
+	rec := postProxy(h, "/v1/chat/completions", `{"model":"gpt-4o","messages":[]}`, header)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status = %d, body = %s", rec.Code, rec.Body)
+	}
+
+	got := upstream()
+	if got.Model != "gpt-4o-mini" {
+		t.Errorf("upstream model = %q, want gpt-4o-mini", got.Model)
+	}
+	if got.Injected != "yes" {
+		t.Errorf("upstream X-Injected = %q, want yes", got.Injected)
+	}
+	// 空值删除请求头；受保护的请求头不能修改
+	if got.Removed != "" {
+		t.Errorf("upstream X-Remove-Me = %q, want removed", got.Removed)
+	}
+	if got.Host == "evil.example" {
+		t.Error("hook overrode the protected Host header")
+	}
+}
+
+func TestOnRequestHookRecomputesStream(t *testing.T) {
+	const enableStream = `
+return { continue = true, modified = true, body = '{"model":"gpt-4o","stream":true}' }
+`
+	h, upstream := newHookProxy(t, enableStream, false, nil)
+	rec := postProxy(h, "/v1/chat/completions", `{"model":"gpt-4o"}`, nil)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status = %d, body = %s", rec.Code, rec.Body)
+	}
+	if !upstream().Stream {
+		t.Error("stream flag from the hook body not forwarded")
+	}
+}
+
+func TestOnRequestHookInvalidBody(t *testing.T) {
+	const broken = `return { continue = true, modified = true, body = "not json" }`
+	h, _ := newHookProxy(t, broken, false, nil)
+	if rec := postProxy(h, "/v1/chat/completions", `{"model":"gpt-4o"}`, nil); rec.Code != http.StatusInternalServerError {
+		t.Errorf("status = %d, want 500", rec.Code)
+	}
+
+	const reject = `return { continue = false, error = "blocked" }`
+	h, _ = newHookProxy(t, reject, false, nil)
+	if rec := postProxy(h, "/v1/chat/completions", `{"model":"gpt-4o"}`, nil); rec.Code != http.StatusForbidden {
+		t.Errorf("rejected: status = %d, want 403", rec.Code)
+	}
+}
+
+func TestOnRequestHookLoggedBody(t *testing.T) {
+	tests := []struct {
+		name        string
+		logOriginal bool
+		want        string
+	}{
+		{"默认记录发往后端的请求体", false, `{"model":"gpt-4o-mini","messages":[]}`},
+		{"log_original_body 记录原始请求体", true, `{"model":"gpt-4o","messages":[]}`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db := newTestLogDB(t)
+			logger := newTestDBLogger(t, db, &config.RequestLoggingConfig{BatchSize: 1, FlushInterval: 5 * time.Millisecond, IncludeBody: true})
+			t.Cleanup(func() { _ = logger.Close() })
+			h, _ := newHookProxy(t, rewriteModelHook, tt.logOriginal, logger)
+
+			postProxy(h, "/v1/chat/completions", `{"model":"gpt-4o","messages":[]}`, nil)
+			deadline := time.Now().Add(5 * time.Second)
+			for countRequestLogs(t, db) == 0 && time.Now().Before(deadline) {
+				time.Sleep(5 * time.Millisecond)
+			}
+			var body string
+			if err := db.QueryRow(`SELECT request_body FROM request_logs`).Scan(&body); err != nil {
+				t.Fatal(err)
+			}
+			if body != tt.want {
+				t.Errorf("logged body = %s, want %s", body, tt.want)
+			}
+		})
+	}
+}
+
+// routeHook 按 X-Route 请求头指定后端
+const routeHook = `
+local target = request.headers["X-Route"]
+if target == nil or target == "" then
+	return { continue = true }
+end
+return { continue = true, metadata = { backend = target } }
+`
+
+func TestOnRouteHookChoosesBackend(t *testing.T) {
+	names := []string{"a", "b"}
+	cfg := &config.Config{Hooks: &config.HooksConfig{
+		Enabled: true,
+		OnRoute: &config.ScriptConfig{Enabled: true, Script: routeHook},
+	}}
+	for _, name := range names {
+		name := name
+		upstream := newTestUpstream(t, func(w http.ResponseWriter, r *http.Request) {
+			fmt.Fprintf(w, `{"backend":%q}`, name)
+		})
+		cfg.Backends = append(cfg.Backends, &config.Backend{Name: name, URL: upstream.URL, Weight: 1})
+	}
+	executor, err := hooks.NewExecutor(cfg.Hooks)
+	if err != nil {
+		t.Fatalf("NewExecutor() error = %v", err)
+	}
+	h := NewHandlerWithOptions(&HandlerOptions{
+		Config:       cfg,
+		LoadBalancer: lb.NewRoundRobin(cfg.Backends, nil),
+		Hooks:        executor,
+	})
+
+	route := func(target string) string {
+		t.Helper()
+		header := http.Header{}
+		header.Set("X-Route", target)
+		rec := postProxy(h, "/v1/chat/completions", `{"model":"gpt-4o"}`, header)
+		if rec.Code != http.StatusOK {
+			t.Fatalf("X-Route %q: status = %d, body = %s", target, rec.Code, rec.Body)
+		}
+		var resp struct {
+			Backend string `json:"backend"`
+		}
+		if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil {
+			t.Fatalf("response %s: %v", rec.Body, err)
+		}
+		return resp.Backend
+	}
+
+	// 钩子指定的后端接收所有请求，不参与轮询
+	for i := 0; i < 3; i++ {
+		if got := route("b"); got != "b" {
+			t.Fatalf("request %d routed to %q, want b", i, got)
+		}
+	}
+	if got := route(cfg.Backends[0].URL); got != "a" {
+		t.Errorf("routed by URL to %q, want a", got)
+	}
+
+	// 不存在的后端被忽略，按轮询路由到两个后端
+	seen := map[string]bool{}
+	for i := 0; i < 4; i++ {
+		seen[route("missing")] = true
+	}
+	if !seen["a"] || !seen["b"] {
+		t.Errorf("invalid target routed to %v, want round robin over a and b", seen)
+	}
+}
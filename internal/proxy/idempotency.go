@@ -0,0 +1,268 @@
+package proxy
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"sync"
+	"time"
+
+	"llmproxy/internal/config"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// IdempotencyHeader 幂等键请求头
+const IdempotencyHeader = "Idempotency-Key"
+
+// 幂等键参数
+const (
+	DefaultIdempotencyTTL = 24 * time.Hour
+	idempotencyPendingTTL = 10 * time.Minute // 处理中标记的最长保留时间（进程异常退出时自动释放）
+	idempotencyMaxKeyLen  = 255
+	idempotencyRedisPfx   = "llmproxy:idempotency:"
+)
+
+// IdempotencyCache 幂等键响应缓存
+// 缓存 Key 按 API Key 隔离，不同调用方使用相同的 Idempotency-Key 互不影响
+type IdempotencyCache struct {
+	client redis.UniversalClient // 为 nil 时使用进程内缓存
+	ttl    time.Duration
+
+	mu        sync.Mutex
+	memory    map[string]*idempotencyEntry
+	lastSweep time.Time
+}
+
+// idempotencyEntry 一个幂等键的状态
+type idempotencyEntry struct {
+	BodyHash    string    `json:"body_hash"`
+	Pending     bool      `json:"pending,omitempty"` // 首个请求仍在处理中
+	StatusCode  int       `json:"status_code,omitempty"`
+	ContentType string    `json:"content_type,omitempty"`
+	Body        []byte    `json:"body,omitempty"`
+	expires     time.Time // 仅进程内缓存使用
+}
+
+// NewIdempotencyCache 创建幂等键响应缓存
+// 参数：
+//   - cfg: 幂等键配置（未启用时返回 nil）
+//   - client: Redis 客户端（为 nil 时使用进程内缓存）
+//
+// 返回：
+//   - *IdempotencyCache: 响应缓存（nil 表示未启用，所有方法均为空操作）
+func NewIdempotencyCache(cfg *config.IdempotencyConfig, client redis.UniversalClient) *IdempotencyCache {
+	if cfg == nil || !cfg.Enabled {
+		return nil
+	}
+	ttl := cfg.TTL
+	if ttl <= 0 {
+		ttl = DefaultIdempotencyTTL
+	}
+	return &IdempotencyCache{
+		client: client,
+		ttl:    ttl,
+		memory: make(map[string]*idempotencyEntry),
+	}
+}
+
+// idempotentRequest 一次携带幂等键的请求
+type idempotentRequest struct {
+	cache    *IdempotencyCache
+	key      string
+	bodyHash string
+	stored   bool
+}
+
+// Begin 处理请求中的幂等键
+// 首次出现的 Key 占用处理中标记；已完成的 Key 直接写回缓存的响应；
+// 同一 Key 对应不同请求体或仍在处理中时返回 409
+// 参数：
+//   - w: 响应写入器
+//   - r: HTTP 请求
+//   - apiKey: API Key（用于隔离不同调用方）
+//   - body: 请求体
+//   - stream: 是否为流式请求（流式请求不缓存）
+//
+// 返回：
+//   - *idempotentRequest: 需要在响应后调用 store / release（无幂等键时为 nil，方法均为空操作）
+//   - bool: 是否已写入响应（重放或冲突），调用方应直接返回
+func (c *IdempotencyCache) Begin(w http.ResponseWriter, r *http.Request, apiKey string, body []byte, stream bool) (*idempotentRequest, bool) {
+	if c == nil || stream {
+		return nil, false
+	}
+	idemKey := r.Header.Get(IdempotencyHeader)
+	if idemKey == "" {
+		return nil, false
+	}
+	if len(idemKey) > idempotencyMaxKeyLen {
+		http.Error(w, `{"error":"Idempotency-Key is too long"}`, http.StatusBadRequest)
+		return nil, true
+	}
+
+	scope := sha256.Sum256([]byte(apiKey))
+	sum := sha256.Sum256(body)
+	req := &idempotentRequest{
+		cache:    c,
+		key:      hex.EncodeToString(scope[:8]) + ":" + idemKey,
+		bodyHash: hex.EncodeToString(sum[:]),
+	}
+
+	existing, err := c.reserve(r.Context(), req.key, req.bodyHash)
+	if err != nil {
+		// 缓存不可用时不阻断请求，按普通请求处理
+		log.Printf("幂等键缓存不可用，按普通请求处理: %v", err)
+		return nil, false
+	}
+	if existing == nil {
+		return req, false
+	}
+
+	switch {
+	case existing.BodyHash != req.bodyHash:
+		http.Error(w, `{"error":"Idempotency-Key was already used with a different request body"}`, http.StatusConflict)
+	case existing.Pending:
+		http.Error(w, `{"error":"A request with this Idempotency-Key is still in progress"}`, http.StatusConflict)
+	default:
+		contentType := existing.ContentType
+		if contentType == "" {
+			contentType = "application/json"
+		}
+		w.Header().Set("Content-Type", contentType)
+		w.Header().Set("Idempotent-Replayed", "true")
+		w.WriteHeader(existing.StatusCode)
+		if _, err := w.Write(existing.Body); err != nil {
+			log.Printf("写入响应失败: %v", err)
+		}
+		log.Printf("幂等键重放: 返回缓存的响应 (status=%d)", existing.StatusCode)
+	}
+	return nil, true
+}
+
+// store 缓存成功的响应（非 2xx 响应不缓存，客户端可以用同一 Key 重试）
+func (req *idempotentRequest) store(statusCode int, contentType string, body []byte) {
+	if req == nil || statusCode < 200 || statusCode >= 300 {
+		return
+	}
+	entry := &idempotencyEntry{
+		BodyHash:    req.bodyHash,
+		StatusCode:  statusCode,
+		ContentType: contentType,
+		Body:        body,
+	}
+	if err := req.cache.put(req.key, entry, req.cache.ttl); err != nil {
+		log.Printf("缓存幂等响应失败: %v", err)
+		return
+	}
+	req.stored = true
+}
+
+// release 未缓存响应时释放处理中标记（通常 defer 调用）
+func (req *idempotentRequest) release() {
+	if req == nil || req.stored {
+		return
+	}
+	req.cache.delete(req.key)
+}
+
+// reserve 原子地占用处理中标记
+// 返回：
+//   - *idempotencyEntry: Key 已存在时返回已有状态；占用成功时返回 nil
+//   - error: 缓存访问失败
+func (c *IdempotencyCache) reserve(ctx context.Context, key, bodyHash string) (*idempotencyEntry, error) {
+	pending := &idempotencyEntry{BodyHash: bodyHash, Pending: true}
+	pendingTTL := idempotencyPendingTTL
+	if c.ttl < pendingTTL {
+		pendingTTL = c.ttl
+	}
+
+	if c.client == nil {
+		c.mu.Lock()
+		defer c.mu.Unlock()
+		now := time.Now()
+		c.sweepLocked(now)
+		if entry, ok := c.memory[key]; ok && now.Before(entry.expires) {
+			return entry, nil
+		}
+		pending.expires = now.Add(pendingTTL)
+		c.memory[key] = pending
+		return nil, nil
+	}
+
+	data, err := json.Marshal(pending)
+	if err != nil {
+		return nil, err
+	}
+	ok, err := c.client.SetNX(ctx, idempotencyRedisPfx+key, data, pendingTTL).Result()
+	if err != nil {
+		return nil, err
+	}
+	if ok {
+		return nil, nil
+	}
+	raw, err := c.client.Get(ctx, idempotencyRedisPfx+key).Bytes()
+	if err == redis.Nil {
+		// 标记恰好过期，按新请求重新占用
+		return c.reserve(ctx, key, bodyHash)
+	}
+	if err != nil {
+		return nil, err
+	}
+	var entry idempotencyEntry
+	if err := json.Unmarshal(raw, &entry); err != nil {
+		return nil, fmt.Errorf("解析幂等缓存失败: %w", err)
+	}
+	return &entry, nil
+}
+
+// put 写入完成的响应
+func (c *IdempotencyCache) put(key string, entry *idempotencyEntry, ttl time.Duration) error {
+	if c.client == nil {
+		c.mu.Lock()
+		defer c.mu.Unlock()
+		entry.expires = time.Now().Add(ttl)
+		c.memory[key] = entry
+		return nil
+	}
+
+	data, err := json.Marshal(entry)
+	if err != nil {
+		return err
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+	return c.client.Set(ctx, idempotencyRedisPfx+key, data, ttl).Err()
+}
+
+// delete 删除 Key（释放处理中标记）
+func (c *IdempotencyCache) delete(key string) {
+	if c.client == nil {
+		c.mu.Lock()
+		delete(c.memory, key)
+		c.mu.Unlock()
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+	if err := c.client.Del(ctx, idempotencyRedisPfx+key).Err(); err != nil {
+		log.Printf("释放幂等键失败: %v", err)
+	}
+}
+
+// sweepLocked 清理进程内缓存中过期的 Key（每分钟最多一次，调用方持有锁）
+func (c *IdempotencyCache) sweepLocked(now time.Time) {
+	if now.Sub(c.lastSweep) < time.Minute {
+		return
+	}
+	c.lastSweep = now
+	for key, entry := range c.memory {
+		if !now.Before(entry.expires) {
+			delete(c.memory, key)
+		}
+	}
+}
@@ -0,0 +1,174 @@
+package proxy
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"llmproxy/internal/config"
+	"llmproxy/internal/lb"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/redis/go-redis/v9"
+)
+
+// idemHeader 构造携带 API Key 和幂等键的请求头
+func idemHeader(apiKey, idemKey string) http.Header {
+	h := http.Header{}
+	h.Set("Authorization", "Bearer "+apiKey)
+	if idemKey != "" {
+		h.Set(IdempotencyHeader, idemKey)
+	}
+	return h
+}
+
+// newIdempotentProxy 创建启用幂等键的代理；upstream 返回的状态码由 status 控制
+func newIdempotentProxy(t *testing.T, client redis.UniversalClient, status *atomic.Int32, hits *atomic.Int32) (http.HandlerFunc, func(want int) int) {
+	t.Helper()
+	upstream := newTestUpstream(t, func(w http.ResponseWriter, r *http.Request) {
+		n := hits.Add(1)
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(int(status.Load()))
+		fmt.Fprintf(w, `{"id":"resp-%d","usage":{"prompt_tokens":3,"completion_tokens":4,"total_tokens":7}}`, n)
+	})
+	cfg := &config.Config{
+		Backends: []*config.Backend{{Name: "upstream", URL: upstream.URL, Weight: 1}},
+	}
+	db := newTestLogDB(t)
+	logger := newTestDBLogger(t, db, &config.RequestLoggingConfig{BatchSize: 1, FlushInterval: 5 * time.Millisecond})
+	t.Cleanup(func() { _ = logger.Close() })
+	h := NewHandlerWithOptions(&HandlerOptions{
+		Config:       cfg,
+		LoadBalancer: lb.NewRoundRobin(cfg.Backends, nil),
+		Logger:       logger,
+		Idempotency:  NewIdempotencyCache(&config.IdempotencyConfig{Enabled: true, TTL: time.Hour}, client),
+	})
+	// 请求日志异步写入：等待达到 want 条后再观察一段时间，确认没有多余的记录
+	waitLogs := func(want int) int {
+		deadline := time.Now().Add(5 * time.Second)
+		for countRequestLogs(t, db) < want && time.Now().Before(deadline) {
+			time.Sleep(5 * time.Millisecond)
+		}
+		time.Sleep(50 * time.Millisecond)
+		return countRequestLogs(t, db)
+	}
+	return h, waitLogs
+}
+
+func TestIdempotencyReplayAndConflict(t *testing.T) {
+	caches := map[string]func(t *testing.T) redis.UniversalClient{
+		"进程内缓存": func(t *testing.T) redis.UniversalClient { return nil },
+		"Redis": func(t *testing.T) redis.UniversalClient {
+			client := redis.NewClient(&redis.Options{Addr: miniredis.RunT(t).Addr()})
+			t.Cleanup(func() { _ = client.Close() })
+			return client
+		},
+	}
+	for name, newClient := range caches {
+		t.Run(name, func(t *testing.T) {
+			var status, hits atomic.Int32
+			status.Store(http.StatusOK)
+			h, waitLogs := newIdempotentProxy(t, newClient(t), &status, &hits)
+
+			const body = `{"model":"gpt-4o","messages":[{"role":"user","content":"hi"}]}`
+			first := postProxy(h, "/v1/chat/completions", body, idemHeader("sk-a", "retry-1"))
+			if first.Code != http.StatusOK || !strings.Contains(first.Body.String(), "resp-1") {
+				t.Fatalf("first: status = %d, body = %s", first.Code, first.Body)
+			}
+
+			// 重放：返回缓存的响应体，不再请求后端
+			replay := postProxy(h, "/v1/chat/completions", body, idemHeader("sk-a", "retry-1"))
+			if replay.Code != http.StatusOK || replay.Body.String() != first.Body.String() {
+				t.Errorf("replay: status = %d, body = %s; want %s", replay.Code, replay.Body, first.Body)
+			}
+			if replay.Header().Get("Idempotent-Replayed") != "true" || replay.Header().Get("Content-Type") != "application/json" {
+				t.Errorf("replay headers = %v", replay.Header())
+			}
+
+			// 同一幂等键、不同请求体：冲突
+			conflict := postProxy(h, "/v1/chat/completions", `{"model":"gpt-4o","messages":[]}`, idemHeader("sk-a", "retry-1"))
+			if conflict.Code != http.StatusConflict {
+				t.Errorf("different body: status = %d, want 409", conflict.Code)
+			}
+			if got := hits.Load(); got != 1 {
+				t.Fatalf("upstream hits = %d, want 1", got)
+			}
+
+			// 不同 API Key 使用相同幂等键互不影响
+			if rec := postProxy(h, "/v1/chat/completions", body, idemHeader("sk-b", "retry-1")); !strings.Contains(rec.Body.String(), "resp-2") {
+				t.Errorf("other api key: body = %s, want a fresh response", rec.Body)
+			}
+
+			// 重放不重复记录用量
+			if got := waitLogs(2); got != 2 {
+				t.Errorf("request logs = %d, want 2", got)
+			}
+		})
+	}
+}
+
+func TestIdempotencyOnlyCachesSuccess(t *testing.T) {
+	var status, hits atomic.Int32
+	status.Store(http.StatusInternalServerError)
+	h, _ := newIdempotentProxy(t, nil, &status, &hits)
+	const body = `{"model":"gpt-4o"}`
+
+	// 失败的响应不缓存，同一 Key 可以重试
+	if rec := postProxy(h, "/v1/chat/completions", body, idemHeader("sk-a", "k")); rec.Code != http.StatusInternalServerError {
+		t.Fatalf("first: status = %d", rec.Code)
+	}
+	status.Store(http.StatusOK)
+	if rec := postProxy(h, "/v1/chat/completions", body, idemHeader("sk-a", "k")); rec.Code != http.StatusOK || rec.Header().Get("Idempotent-Replayed") != "" {
+		t.Fatalf("retry: status = %d, headers = %v", rec.Code, rec.Header())
+	}
+	if got := hits.Load(); got != 2 {
+		t.Errorf("upstream hits = %d, want 2", got)
+	}
+
+	// 流式请求和没有幂等键的请求不缓存
+	for _, tt := range []struct {
+		body   string
+		header http.Header
+	}{
+		{`{"model":"gpt-4o","stream":true}`, idemHeader("sk-a", "stream")},
+		{body, idemHeader("sk-a", "")},
+	} {
+		before := hits.Load()
+		postProxy(h, "/v1/chat/completions", tt.body, tt.header)
+		postProxy(h, "/v1/chat/completions", tt.body, tt.header)
+		if got := hits.Load() - before; got != 2 {
+			t.Errorf("%s: upstream hits = %d, want 2", tt.body, got)
+		}
+	}
+
+	// 过长的幂等键
+	if rec := postProxy(h, "/v1/chat/completions", body, idemHeader("sk-a", strings.Repeat("k", 256))); rec.Code != http.StatusBadRequest {
+		t.Errorf("long key: status = %d, want 400", rec.Code)
+	}
+}
+
+func TestIdempotencyPendingConflict(t *testing.T) {
+	c := NewIdempotencyCache(&config.IdempotencyConfig{Enabled: true}, nil)
+	if c.ttl != DefaultIdempotencyTTL {
+		t.Errorf("ttl = %v, want default", c.ttl)
+	}
+	if NewIdempotencyCache(&config.IdempotencyConfig{}, nil) != nil {
+		t.Error("disabled config returned a cache")
+	}
+
+	// 首个请求仍在处理中时，重放返回 409；释放后可重新占用
+	if existing, err := c.reserve(t.Context(), "k", "hash"); existing != nil || err != nil {
+		t.Fatalf("reserve() = %+v, %v", existing, err)
+	}
+	existing, err := c.reserve(t.Context(), "k", "hash")
+	if err != nil || existing == nil || !existing.Pending {
+		t.Fatalf("second reserve() = %+v, %v; want pending", existing, err)
+	}
+	(&idempotentRequest{cache: c, key: "k"}).release()
+	if existing, _ := c.reserve(t.Context(), "k", "hash"); existing != nil {
+		t.Errorf("reserve() after release = %+v, want nil", existing)
+	}
+}
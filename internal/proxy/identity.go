@@ -0,0 +1,31 @@
+package proxy
+
+import (
+	"net/http"
+
+	"llmproxy/internal/auth"
+	"llmproxy/internal/types"
+)
+
+// resolveUserID 获取请求对应的用户 ID
+// 经过鉴权管道的请求直接使用上下文中的调用方身份；
+// 未经过鉴权管道时（如 skip_paths）才回退到查询 Key 存储
+// 参数：
+//   - r: HTTP 请求
+//   - keyStore: Key 存储（可为 nil）
+//   - apiKey: API Key
+//
+// 返回：
+//   - string: 用户 ID（未知时为空）
+func resolveUserID(r *http.Request, keyStore auth.KeyStore, apiKey string) string {
+	if identity := types.IdentityFromContext(r.Context()); identity != nil {
+		return identity.UserID
+	}
+	if keyStore == nil || apiKey == "" {
+		return ""
+	}
+	if key, err := keyStore.Get(apiKey); err == nil && key != nil {
+		return key.UserID
+	}
+	return ""
+}
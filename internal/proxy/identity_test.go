@@ -0,0 +1,131 @@
+package proxy
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+
+	"llmproxy/internal/auth"
+	"llmproxy/internal/config"
+	"llmproxy/internal/lb"
+	"llmproxy/internal/metrics"
+	"llmproxy/internal/types"
+)
+
+// countingKeyStore 记录 Get 调用次数的 Key 存储
+type countingKeyStore struct {
+	mu   sync.Mutex
+	gets int
+}
+
+func (s *countingKeyStore) Get(key string) (*auth.APIKey, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.gets++
+	return &auth.APIKey{Key: key, UserID: "store-user"}, nil
+}
+
+func (s *countingKeyStore) Update(key *auth.APIKey) error { return nil }
+
+func (s *countingKeyStore) IncrementUsedQuota(key string, tokens int64) error { return nil }
+
+// getCalls 返回 Get 调用次数
+func (s *countingKeyStore) getCalls() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.gets
+}
+
+func TestResolveUserID(t *testing.T) {
+	withIdentity := httptest.NewRequest(http.MethodPost, "/v1/chat/completions", nil)
+	withIdentity = withIdentity.WithContext(types.WithIdentity(withIdentity.Context(), &types.Identity{APIKey: "sk-test", UserID: "ctx-user"}))
+	plain := httptest.NewRequest(http.MethodPost, "/v1/chat/completions", nil)
+
+	tests := []struct {
+		name      string
+		r         *http.Request
+		store     bool
+		apiKey    string
+		want      string
+		wantCalls int
+	}{
+		{"上下文中的身份，不查询存储", withIdentity, true, "sk-test", "ctx-user", 0},
+		{"未经过鉴权管道时查询存储", plain, true, "sk-test", "store-user", 1},
+		{"没有 Key", plain, true, "", "", 0},
+		{"没有存储", plain, false, "sk-test", "", 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			store := &countingKeyStore{}
+			var keyStore auth.KeyStore
+			if tt.store {
+				keyStore = store
+			}
+			if got := resolveUserID(tt.r, keyStore, tt.apiKey); got != tt.want {
+				t.Errorf("resolveUserID() = %q, want %q", got, tt.want)
+			}
+			if store.getCalls() != tt.wantCalls {
+				t.Errorf("KeyStore.Get calls = %d, want %d", store.getCalls(), tt.wantCalls)
+			}
+		})
+	}
+}
+
+func TestHandlerUsesContextIdentity(t *testing.T) {
+	metrics.Init(nil)
+	t.Cleanup(func() { metrics.Init(nil) })
+
+	webhook := newUsageWebhook(t, nil)
+	reporter := webhookReporter(webhook.URL, config.UsageWebhookConfig{})
+	if err := InitUsageWebhook(reporter); err != nil {
+		t.Fatal(err)
+	}
+	upstream := newTestUpstream(t, func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write([]byte(`{"id":"ok","usage":{"prompt_tokens":3,"completion_tokens":5,"total_tokens":8}}`))
+	})
+	cfg := &config.Config{Usage: &config.UsageConfig{Enabled: true, Reporters: []*config.UsageReporter{reporter}}}
+	cfg.Backends = []*config.Backend{{Name: "upstream", URL: upstream.URL, Weight: 1}}
+	store := &countingKeyStore{}
+	proxy := NewHandlerWithOptions(&HandlerOptions{
+		Config:       cfg,
+		LoadBalancer: lb.NewRoundRobin(cfg.Backends, nil),
+		KeyStore:     store,
+	})
+
+	// 鉴权中间件写入的身份：处理器直接使用，不再查询 Key 存储
+	authed := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		identity := auth.NewIdentity("sk-test", "oauth2", map[string]interface{}{"user_id": "ctx-user"})
+		proxy.ServeHTTP(w, r.WithContext(types.WithIdentity(r.Context(), identity)))
+	})
+	header := http.Header{"Authorization": {"Bearer sk-test"}}
+	if rec := postProxy(authed, "/v1/chat/completions", `{"model":"gpt-4o","messages":[]}`, header); rec.Code != http.StatusOK {
+		t.Fatalf("status = %d, body = %s", rec.Code, rec.Body)
+	}
+	waitFor(t, "usage webhook", func() bool { return len(webhook.received()) == 1 })
+
+	var record UsageRecord
+	if err := json.Unmarshal(webhook.received()[0].body, &record); err != nil {
+		t.Fatal(err)
+	}
+	if record.UserID != "ctx-user" || record.APIKey != "sk-test" {
+		t.Errorf("usage user_id = %q, api_key = %q; want ctx-user, sk-test", record.UserID, record.APIKey)
+	}
+	if calls := store.getCalls(); calls != 0 {
+		t.Errorf("KeyStore.Get calls = %d, want 0", calls)
+	}
+
+	// 未经过鉴权管道（如 skip_paths）时仍回退到查询 Key 存储
+	if rec := postProxy(proxy, "/v1/chat/completions", `{"model":"gpt-4o","messages":[]}`, header); rec.Code != http.StatusOK {
+		t.Fatalf("status = %d, body = %s", rec.Code, rec.Body)
+	}
+	waitFor(t, "usage webhook", func() bool { return len(webhook.received()) == 2 })
+	if err := json.Unmarshal(webhook.received()[1].body, &record); err != nil {
+		t.Fatal(err)
+	}
+	if record.UserID != "store-user" || store.getCalls() != 1 {
+		t.Errorf("without identity: user_id = %q, Get calls = %d; want store-user, 1", record.UserID, store.getCalls())
+	}
+}
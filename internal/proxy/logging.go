@@ -6,12 +6,14 @@ import (
 	"fmt"
 	"log"
 	"net/http"
-	"os"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"llmproxy/internal/config"
+	"llmproxy/internal/logfile"
+	"llmproxy/internal/utils"
 )
 
 // RequestLog 请求日志记录
@@ -32,17 +34,35 @@ type RequestLog struct {
 	Model        string            `json:"model,omitempty"`
 	IsStream     bool              `json:"is_stream"`
 	Error        string            `json:"error,omitempty"`
+	Tools        []string          `json:"tools,omitempty"`       // 请求中声明的工具名称（log_tools 启用时）
+	ToolCalls    []string          `json:"tool_calls,omitempty"`  // 响应中模型调用的工具名称（log_tools 启用时）
+	DenyReason   string            `json:"deny_reason,omitempty"` // 被鉴权/限流拒绝的原因（仅访问日志）
 }
 
+// 请求日志批量写入默认参数
+const (
+	DefaultLogBatchSize     = 100
+	DefaultLogFlushInterval = time.Second
+	DefaultLogBufferSize    = 10000
+)
+
 // Logger 日志记录器
+// 请求日志先写入缓冲区，由后台协程按 batch_size / flush_interval 在一个事务中批量写入数据库
 type Logger struct {
-	requestCfg *config.RequestLoggingConfig
-	accessCfg  *config.AccessLoggingConfig
-	db         *sql.DB
-	driver     string
-	table      string
-	accessFile *os.File
-	mu         sync.Mutex
+	requestCfg  *config.RequestLoggingConfig
+	accessCfg   *config.AccessLoggingConfig
+	db          *sql.DB
+	driver      string
+	table       string
+	accessFile  *logfile.File
+	requestFile *logfile.File // 请求日志文件（每行一条 JSON，可与数据库同时使用）
+	mu          sync.Mutex
+
+	queue     chan *RequestLog // 待写入数据库的请求日志
+	stop      chan struct{}
+	done      chan struct{}
+	closeOnce sync.Once
+	dropped   atomic.Int64 // 缓冲区已满时丢弃的条数（每次写入后报告）
 }
 
 // NewLogger 创建日志记录器
@@ -69,14 +89,34 @@ func NewLogger(cfg *config.LoggingConfig, db *sql.DB, driver string) (*Logger, e
 		if err := logger.initRequestLogTable(); err != nil {
 			return nil, fmt.Errorf("初始化请求日志表失败: %w", err)
 		}
+
+		bufferSize := cfg.Request.BufferSize
+		if bufferSize <= 0 {
+			bufferSize = DefaultLogBufferSize
+		}
+		logger.queue = make(chan *RequestLog, bufferSize)
+		logger.stop = make(chan struct{})
+		logger.done = make(chan struct{})
+		go logger.runRequestLogWriter()
 		log.Printf("请求日志已启用，表: %s", table)
 	}
 
+	// 初始化请求日志文件
+	if cfg.Request != nil && cfg.Request.Enabled && cfg.Request.File != nil && cfg.Request.File.Path != "" {
+		file, err := logfile.Open(cfg.Request.File, 0600)
+		if err != nil {
+			return nil, fmt.Errorf("打开请求日志文件失败: %w", err)
+		}
+		logger.requestFile = file
+		log.Printf("请求日志已启用，文件: %s", cfg.Request.File.Path)
+	}
+
 	// 初始化访问日志文件
 	if cfg.Access != nil && cfg.Access.Enabled {
 		if cfg.Access.Output == "file" && cfg.Access.File != nil && cfg.Access.File.Path != "" {
-			file, err := os.OpenFile(cfg.Access.File.Path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+			file, err := logfile.Open(cfg.Access.File, 0644)
 			if err != nil {
+				_ = logger.requestFile.Close()
 				return nil, fmt.Errorf("打开访问日志文件失败: %w", err)
 			}
 			logger.accessFile = file
@@ -117,6 +157,8 @@ func (l *Logger) initRequestLogTable() error {
 				model VARCHAR(64),
 				is_stream BOOLEAN DEFAULT FALSE,
 				error TEXT,
+				tools TEXT,
+				tool_calls TEXT,
 				INDEX idx_timestamp (timestamp),
 				INDEX idx_api_key (api_key),
 				INDEX idx_user_id (user_id)
@@ -141,7 +183,9 @@ func (l *Logger) initRequestLogTable() error {
 				user_id VARCHAR(64),
 				model VARCHAR(64),
 				is_stream BOOLEAN DEFAULT FALSE,
-				error TEXT
+				error TEXT,
+				tools TEXT,
+				tool_calls TEXT
 			);
 			CREATE INDEX IF NOT EXISTS idx_%s_timestamp ON %s(timestamp);
 			CREATE INDEX IF NOT EXISTS idx_%s_api_key ON %s(api_key);
@@ -166,7 +210,9 @@ func (l *Logger) initRequestLogTable() error {
 				user_id TEXT,
 				model TEXT,
 				is_stream INTEGER DEFAULT 0,
-				error TEXT
+				error TEXT,
+				tools TEXT,
+				tool_calls TEXT
 			);
 			CREATE INDEX IF NOT EXISTS idx_%s_timestamp ON %s(timestamp);
 			CREATE INDEX IF NOT EXISTS idx_%s_api_key ON %s(api_key);
@@ -176,8 +222,14 @@ func (l *Logger) initRequestLogTable() error {
 		return fmt.Errorf("不支持的数据库驱动: %s", l.driver)
 	}
 
-	_, err := l.db.Exec(createSQL)
-	return err
+	if _, err := l.db.Exec(createSQL); err != nil {
+		return err
+	}
+
+	// 迁移：为已存在的表添加工具名称字段（忽略已存在错误）
+	_, _ = l.db.Exec(fmt.Sprintf(`ALTER TABLE %s ADD COLUMN tools TEXT`, l.table))
+	_, _ = l.db.Exec(fmt.Sprintf(`ALTER TABLE %s ADD COLUMN tool_calls TEXT`, l.table))
+	return nil
 }
 
 // LogRequest 异步记录请求日志
@@ -186,9 +238,20 @@ func (l *Logger) LogRequest(reqLog *RequestLog) {
 		return
 	}
 
-	// 异步写入请求日志到数据库
-	if l.requestCfg != nil && l.requestCfg.Enabled && l.db != nil {
-		go l.writeRequestLog(reqLog)
+	// 提取工具名称（只记录名称，不记录参数）
+	if l.requestCfg != nil && l.requestCfg.LogTools && reqLog != nil {
+		reqLog.Tools = extractRequestTools([]byte(reqLog.RequestBody))
+		reqLog.ToolCalls = extractToolCalls([]byte(reqLog.ResponseBody), reqLog.IsStream)
+	}
+
+	// 写入缓冲区，由后台协程批量写入数据库
+	if l.queue != nil && reqLog != nil {
+		l.enqueueRequestLog(reqLog)
+	}
+
+	// 写入请求日志文件
+	if l.requestFile != nil {
+		go l.writeRequestLogFile(reqLog)
 	}
 
 	// 写入访问日志
@@ -197,12 +260,160 @@ func (l *Logger) LogRequest(reqLog *RequestLog) {
 	}
 }
 
-// writeRequestLog 写入请求日志到数据库
-func (l *Logger) writeRequestLog(reqLog *RequestLog) {
-	if l.db == nil || reqLog == nil {
+// LogDenied 记录被鉴权/限流中间件拒绝的请求（只写访问日志，需开启 access.log_denied）
+// 这类请求不会到达代理处理器，因此不经过 LogRequest
+// 参数：
+//   - r: HTTP 请求
+//   - apiKey: 请求携带的 API Key（写入时脱敏，可为空）
+//   - statusCode: 返回给客户端的状态码
+//   - reason: 拒绝原因
+//   - latency: 中间件处理耗时
+func (l *Logger) LogDenied(r *http.Request, apiKey string, statusCode int, reason string, latency time.Duration) {
+	if l == nil || l.accessCfg == nil || !l.accessCfg.Enabled || !l.accessCfg.LogDenied {
+		return
+	}
+
+	reqLog := &RequestLog{
+		RequestID:  generateRequestID(),
+		Timestamp:  time.Now().Add(-latency),
+		ClientIP:   utils.GetClientIP(r.Header.Get("X-Forwarded-For"), r.Header.Get("X-Real-IP"), r.RemoteAddr),
+		Method:     r.Method,
+		Path:       r.URL.Path,
+		StatusCode: statusCode,
+		LatencyMs:  latency.Milliseconds(),
+		APIKey:     apiKey,
+		UserID:     r.Header.Get("X-API-Key-UserID"),
+		DenyReason: reason,
+	}
+	go l.writeAccessLog(reqLog)
+}
+
+// enqueueRequestLog 将请求日志放入写入缓冲区
+// 缓冲区已满时按 block_on_full 阻塞等待或丢弃；关闭后不再接收
+func (l *Logger) enqueueRequestLog(reqLog *RequestLog) {
+	if l.requestCfg.BlockOnFull {
+		select {
+		case l.queue <- reqLog:
+		case <-l.stop:
+		}
 		return
 	}
 
+	select {
+	case l.queue <- reqLog:
+	default:
+		l.dropped.Add(1)
+	}
+}
+
+// runRequestLogWriter 后台批量写入循环
+// 攒满 batch_size 条或距上次写入超过 flush_interval 时写入；收到停止信号后写完缓冲区中剩余的日志
+func (l *Logger) runRequestLogWriter() {
+	defer close(l.done)
+
+	batchSize := l.requestCfg.BatchSize
+	if batchSize <= 0 {
+		batchSize = DefaultLogBatchSize
+	}
+	interval := l.requestCfg.FlushInterval
+	if interval <= 0 {
+		interval = DefaultLogFlushInterval
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	batch := make([]*RequestLog, 0, batchSize)
+	flush := func() {
+		if len(batch) > 0 {
+			l.flushRequestLogs(batch)
+			batch = batch[:0]
+		}
+		if n := l.dropped.Swap(0); n > 0 {
+			log.Printf("请求日志缓冲区已满，丢弃 %d 条", n)
+		}
+	}
+
+	for {
+		select {
+		case reqLog := <-l.queue:
+			batch = append(batch, reqLog)
+			if len(batch) >= batchSize {
+				flush()
+			}
+		case <-ticker.C:
+			flush()
+		case <-l.stop:
+			for {
+				select {
+				case reqLog := <-l.queue:
+					batch = append(batch, reqLog)
+					if len(batch) >= batchSize {
+						flush()
+					}
+				default:
+					flush()
+					return
+				}
+			}
+		}
+	}
+}
+
+// flushRequestLogs 在一个事务中批量写入请求日志
+func (l *Logger) flushRequestLogs(batch []*RequestLog) {
+	if err := l.writeRequestLogs(batch); err != nil {
+		log.Printf("写入请求日志失败（%d 条）: %v", len(batch), err)
+	}
+}
+
+// writeRequestLogs 使用预编译语句在一个事务中写入请求日志
+// 参数：
+//   - batch: 请求日志列表
+//
+// 返回：
+//   - error: 错误信息（任一条失败时整批回滚）
+func (l *Logger) writeRequestLogs(batch []*RequestLog) error {
+	tx, err := l.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer func() { _ = tx.Rollback() }()
+
+	stmt, err := tx.Prepare(l.insertRequestLogSQL())
+	if err != nil {
+		return err
+	}
+	defer func() { _ = stmt.Close() }()
+
+	for _, reqLog := range batch {
+		if _, err := stmt.Exec(l.requestLogArgs(reqLog)...); err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+// insertRequestLogSQL 返回请求日志插入语句（postgres 使用 $n 占位符）
+func (l *Logger) insertRequestLogSQL() string {
+	placeholders := make([]string, 18)
+	for i := range placeholders {
+		placeholders[i] = "?"
+		if l.driver == "postgres" {
+			placeholders[i] = fmt.Sprintf("$%d", i+1)
+		}
+	}
+	return fmt.Sprintf(`
+		INSERT INTO %s (
+			request_id, timestamp, client_ip, method, path, headers,
+			request_body, response_body, status_code, latency_ms,
+			backend_url, api_key, user_id, model, is_stream, error,
+			tools, tool_calls
+		) VALUES (%s)
+	`, l.table, strings.Join(placeholders, ", "))
+}
+
+// requestLogArgs 返回请求日志插入语句的参数
+func (l *Logger) requestLogArgs(reqLog *RequestLog) []interface{} {
 	// 序列化 headers
 	headersJSON := "{}"
 	if reqLog.Headers != nil {
@@ -219,22 +430,33 @@ func (l *Logger) writeRequestLog(reqLog *RequestLog) {
 		responseBody = ""
 	}
 
-	insertSQL := fmt.Sprintf(`
-		INSERT INTO %s (
-			request_id, timestamp, client_ip, method, path, headers,
-			request_body, response_body, status_code, latency_ms,
-			backend_url, api_key, user_id, model, is_stream, error
-		) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
-	`, l.table)
-
-	_, err := l.db.Exec(
-		insertSQL,
+	return []interface{}{
 		reqLog.RequestID, reqLog.Timestamp, reqLog.ClientIP, reqLog.Method, reqLog.Path, headersJSON,
 		requestBody, responseBody, reqLog.StatusCode, reqLog.LatencyMs,
 		reqLog.BackendURL, reqLog.APIKey, reqLog.UserID, reqLog.Model, reqLog.IsStream, reqLog.Error,
-	)
+		jsonList(reqLog.Tools), jsonList(reqLog.ToolCalls),
+	}
+}
+
+// writeRequestLogFile 写入请求日志到文件（每行一条 JSON）
+func (l *Logger) writeRequestLogFile(reqLog *RequestLog) {
+	if reqLog == nil {
+		return
+	}
+
+	entry := *reqLog
+	entry.APIKey = maskKey(reqLog.APIKey)
+	if l.requestCfg != nil && !l.requestCfg.IncludeBody {
+		entry.RequestBody = ""
+		entry.ResponseBody = ""
+	}
+	line, err := json.Marshal(&entry)
 	if err != nil {
-		log.Printf("写入请求日志失败: %v", err)
+		log.Printf("序列化请求日志失败: %v", err)
+		return
+	}
+	if _, err := l.requestFile.Write(append(line, '\n')); err != nil {
+		log.Printf("写入请求日志文件失败: %v", err)
 	}
 }
 
@@ -269,6 +491,9 @@ func (l *Logger) writeAccessLog(reqLog *RequestLog) {
 		if reqLog.Error != "" {
 			logEntry["error"] = reqLog.Error
 		}
+		if reqLog.DenyReason != "" {
+			logEntry["deny_reason"] = reqLog.DenyReason
+		}
 		if b, err := json.Marshal(logEntry); err == nil {
 			logLine = string(b)
 		}
@@ -290,6 +515,9 @@ func (l *Logger) writeAccessLog(reqLog *RequestLog) {
 		if reqLog.Error != "" {
 			logLine += fmt.Sprintf(" error=%q", reqLog.Error)
 		}
+		if reqLog.DenyReason != "" {
+			logLine += fmt.Sprintf(" denied=%q", reqLog.DenyReason)
+		}
 	}
 
 	l.mu.Lock()
@@ -302,15 +530,22 @@ func (l *Logger) writeAccessLog(reqLog *RequestLog) {
 	}
 }
 
-// Close 关闭日志记录器
+// Close 写完缓冲区中的请求日志后关闭日志记录器
 func (l *Logger) Close() error {
 	if l == nil {
 		return nil
 	}
-	if l.accessFile != nil {
-		return l.accessFile.Close()
+	if l.queue != nil {
+		l.closeOnce.Do(func() {
+			close(l.stop)
+		})
+		<-l.done
 	}
-	return nil
+	requestErr := l.requestFile.Close()
+	if err := l.accessFile.Close(); err != nil {
+		return err
+	}
+	return requestErr
 }
 
 // ExtractClientIP 从请求中提取客户端 IP
@@ -375,6 +610,18 @@ func maskKey(key string) string {
 	return key[:4] + "***" + key[len(key)-4:]
 }
 
+// jsonList 将名称列表序列化为 JSON 数组（空列表存为 NULL）
+func jsonList(names []string) interface{} {
+	if len(names) == 0 {
+		return nil
+	}
+	b, err := json.Marshal(names)
+	if err != nil {
+		return nil
+	}
+	return string(b)
+}
+
 // defaultIfEmpty 如果为空则返回默认值
 func defaultIfEmpty(s, defaultVal string) string {
 	if s == "" {
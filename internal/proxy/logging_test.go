@@ -0,0 +1,149 @@
+package proxy
+
+import (
+	"database/sql"
+	"fmt"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"llmproxy/internal/config"
+)
+
+// newTestLogDB 在临时目录创建 SQLite 数据库（多个连接共享同一文件）
+func newTestLogDB(t *testing.T) *sql.DB {
+	t.Helper()
+	db, err := sql.Open("sqlite", filepath.Join(t.TempDir(), "logs.db")+"?_pragma=busy_timeout(5000)")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = db.Close() })
+	return db
+}
+
+// newTestDBLogger 创建只写数据库的请求日志记录器
+func newTestDBLogger(t *testing.T, db *sql.DB, cfg *config.RequestLoggingConfig) *Logger {
+	t.Helper()
+	cfg.Enabled = true
+	logger, err := NewLogger(&config.LoggingConfig{Enabled: true, Request: cfg}, db, "sqlite")
+	if err != nil {
+		t.Fatalf("NewLogger() error = %v", err)
+	}
+	return logger
+}
+
+// countRequestLogs 返回请求日志表中的记录数
+func countRequestLogs(t *testing.T, db *sql.DB) int {
+	t.Helper()
+	var n int
+	if err := db.QueryRow(`SELECT COUNT(*) FROM request_logs`).Scan(&n); err != nil {
+		t.Fatal(err)
+	}
+	return n
+}
+
+func TestRequestLogBatchWrites(t *testing.T) {
+	db := newTestLogDB(t)
+	// 刷新间隔足够长，只有攒满一批或关闭时才写入
+	logger := newTestDBLogger(t, db, &config.RequestLoggingConfig{
+		BatchSize:     50,
+		FlushInterval: time.Hour,
+		BufferSize:    64,
+		BlockOnFull:   true,
+		IncludeBody:   true,
+	})
+
+	const writers, perWriter = 8, 125
+	var wg sync.WaitGroup
+	for w := 0; w < writers; w++ {
+		wg.Add(1)
+		go func(w int) {
+			defer wg.Done()
+			for i := 0; i < perWriter; i++ {
+				logger.LogRequest(&RequestLog{
+					RequestID:   fmt.Sprintf("req-%d-%d", w, i),
+					Timestamp:   time.Now(),
+					Method:      "POST",
+					Path:        "/v1/chat/completions",
+					StatusCode:  200,
+					Model:       "gpt-4o",
+					RequestBody: `{"model":"gpt-4o"}`,
+				})
+			}
+		}(w)
+	}
+	wg.Wait()
+
+	if err := logger.Close(); err != nil {
+		t.Fatalf("Close() error = %v", err)
+	}
+	if got := countRequestLogs(t, db); got != writers*perWriter {
+		t.Errorf("persisted %d logs, want %d", got, writers*perWriter)
+	}
+
+	var distinct int
+	if err := db.QueryRow(`SELECT COUNT(DISTINCT request_id) FROM request_logs WHERE request_body = '{"model":"gpt-4o"}'`).Scan(&distinct); err != nil {
+		t.Fatal(err)
+	}
+	if distinct != writers*perWriter {
+		t.Errorf("distinct request ids with body = %d, want %d", distinct, writers*perWriter)
+	}
+
+	// 关闭后不再接收，也不阻塞
+	logger.LogRequest(&RequestLog{RequestID: "after-close"})
+	if err := logger.Close(); err != nil {
+		t.Errorf("second Close() error = %v", err)
+	}
+}
+
+func TestRequestLogFlushInterval(t *testing.T) {
+	db := newTestLogDB(t)
+	logger := newTestDBLogger(t, db, &config.RequestLoggingConfig{
+		BatchSize:     1000,
+		FlushInterval: 20 * time.Millisecond,
+	})
+	defer logger.Close()
+
+	for i := 0; i < 3; i++ {
+		logger.LogRequest(&RequestLog{RequestID: fmt.Sprintf("req-%d", i), Timestamp: time.Now()})
+	}
+
+	// 未满一批，按刷新间隔写入
+	deadline := time.Now().Add(5 * time.Second)
+	for countRequestLogs(t, db) != 3 {
+		if time.Now().After(deadline) {
+			t.Fatalf("persisted %d logs before Close, want 3", countRequestLogs(t, db))
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestRequestLogDropsWhenFull(t *testing.T) {
+	// 不启动后台写入，缓冲区满后直接丢弃
+	logger := &Logger{
+		requestCfg: &config.RequestLoggingConfig{},
+		queue:      make(chan *RequestLog, 2),
+		stop:       make(chan struct{}),
+	}
+	for i := 0; i < 5; i++ {
+		logger.enqueueRequestLog(&RequestLog{})
+	}
+	if len(logger.queue) != 2 || logger.dropped.Load() != 3 {
+		t.Errorf("queued %d, dropped %d; want 2 and 3", len(logger.queue), logger.dropped.Load())
+	}
+
+	// 阻塞模式在停止后返回，不会永久阻塞
+	logger.requestCfg.BlockOnFull = true
+	close(logger.stop)
+	done := make(chan struct{})
+	go func() {
+		logger.enqueueRequestLog(&RequestLog{})
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("enqueue blocked after stop")
+	}
+}
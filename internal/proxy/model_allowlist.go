@@ -0,0 +1,55 @@
+package proxy
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+
+	"llmproxy/internal/auth"
+	"llmproxy/internal/config"
+)
+
+// modelNotAllowedStatus 模型不在 Key 白名单内时的状态名称
+const modelNotAllowedStatus = "MODEL_NOT_ALLOWED"
+
+// checkAllowedModel 检查请求的模型是否在当前 Key 的 allowed_models 内
+// 白名单由鉴权中间件写入请求上下文；未限制的 Key 直接放行。
+// 拒绝时按 auth.status_codes.model_not_allowed 写入与鉴权失败相同格式的错误响应
+// 参数：
+//   - cfg: 配置对象
+//   - w: HTTP 响应写入器
+//   - r: HTTP 请求
+//   - model: 最终请求的模型名
+//
+// 返回：
+//   - bool: 是否允许（false 时已写入响应）
+func checkAllowedModel(cfg *config.Config, w http.ResponseWriter, r *http.Request, model string) bool {
+	allowed := auth.AllowedModels(r.Context())
+	if auth.ModelAllowed(allowed, model) {
+		return true
+	}
+
+	httpCode := http.StatusForbidden
+	message := "当前 API Key 无权使用该模型"
+	if cfg.Auth != nil && cfg.Auth.StatusCodes != nil {
+		if sc := cfg.Auth.StatusCodes.ModelNotAllowed; sc != nil {
+			if sc.HttpCode > 0 {
+				httpCode = sc.HttpCode
+			}
+			if sc.Message != "" {
+				message = sc.Message
+			}
+		}
+	}
+
+	log.Printf("拒绝请求: 模型 %s 不在 Key 的 allowed_models 内", model)
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(httpCode)
+	_ = json.NewEncoder(w).Encode(map[string]interface{}{
+		"error": map[string]string{
+			"code":    modelNotAllowedStatus,
+			"message": message,
+		},
+	})
+	return false
+}
@@ -0,0 +1,159 @@
+package proxy
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+
+	"llmproxy/internal/auth"
+	"llmproxy/internal/config"
+	"llmproxy/internal/lb"
+	"llmproxy/internal/routing"
+	"llmproxy/internal/types"
+)
+
+// withAllowedModels 模拟鉴权中间件：把带模型白名单的调用方身份写入请求上下文
+func withAllowedModels(h http.Handler, allowed string) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		metadata := map[string]interface{}{}
+		if allowed != "" {
+			metadata[auth.MetadataAllowedModels] = allowed
+		}
+		identity := auth.NewIdentity("sk-test", "static", metadata)
+		h.ServeHTTP(w, r.WithContext(types.WithIdentity(r.Context(), identity)))
+	})
+}
+
+func TestAllowedModels(t *testing.T) {
+	var upstreamCalls atomic.Int32
+	upstream := newTestUpstream(t, func(w http.ResponseWriter, r *http.Request) {
+		upstreamCalls.Add(1)
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write([]byte(`{"id":"ok"}`))
+	})
+	proxy := newTestProxy(t, nil, upstream)
+
+	tests := []struct {
+		name    string
+		allowed string
+		model   string
+		want    int
+	}{
+		{"在白名单内", "gpt-4o,claude-3-*", "gpt-4o", http.StatusOK},
+		{"不在白名单内", "gpt-4o,claude-3-*", "gpt-4", http.StatusForbidden},
+		{"通配符", "gpt-4o,claude-3-*", "claude-3-haiku", http.StatusOK},
+		{"未限制", "", "any-model", http.StatusOK},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			upstreamCalls.Store(0)
+			rec := postProxy(withAllowedModels(proxy, tt.allowed), "/v1/chat/completions", `{"model":"`+tt.model+`","messages":[]}`, nil)
+			if rec.Code != tt.want {
+				t.Fatalf("status = %d, want %d; body = %s", rec.Code, tt.want, rec.Body)
+			}
+			if tt.want == http.StatusOK {
+				if upstreamCalls.Load() != 1 {
+					t.Errorf("upstream calls = %d, want 1", upstreamCalls.Load())
+				}
+				return
+			}
+
+			// 拒绝时不转发，错误格式与鉴权失败一致
+			if upstreamCalls.Load() != 0 {
+				t.Errorf("upstream calls = %d, want 0", upstreamCalls.Load())
+			}
+			var resp struct {
+				Error struct {
+					Code    string `json:"code"`
+					Message string `json:"message"`
+				} `json:"error"`
+			}
+			if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil {
+				t.Fatal(err)
+			}
+			if resp.Error.Code != "MODEL_NOT_ALLOWED" || resp.Error.Message == "" {
+				t.Errorf("error = %+v, want MODEL_NOT_ALLOWED", resp.Error)
+			}
+		})
+	}
+}
+
+func TestAllowedModelsStatusCode(t *testing.T) {
+	upstream := newTestUpstream(t, func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte(`{}`))
+	})
+	proxy := newTestProxy(t, &config.Config{Auth: &config.AuthConfig{StatusCodes: &config.StatusCodes{
+		ModelNotAllowed: &config.StatusCodeConfig{HttpCode: 404, Message: "model not found"},
+	}}}, upstream)
+
+	// 按 auth.status_codes.model_not_allowed 返回
+	rec := postProxy(withAllowedModels(proxy, "gpt-4o"), "/v1/chat/completions", `{"model":"gpt-4","messages":[]}`, nil)
+	if rec.Code != http.StatusNotFound || !strings.Contains(rec.Body.String(), "model not found") {
+		t.Errorf("status = %d, body = %s; want 404 with the configured message", rec.Code, rec.Body)
+	}
+}
+
+func TestAllowedModelsFallback(t *testing.T) {
+	var mu sync.Mutex
+	var served []string
+	upstream := newTestUpstream(t, func(w http.ResponseWriter, r *http.Request) {
+		var req struct {
+			Model string `json:"model"`
+		}
+		_ = json.NewDecoder(r.Body).Decode(&req)
+		mu.Lock()
+		served = append(served, req.Model)
+		mu.Unlock()
+		if req.Model == "gpt-4o" {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write([]byte(`{"id":"ok"}`))
+	})
+	newProxy := func(fallbacks ...string) http.HandlerFunc {
+		cfg := &config.Config{Backends: []*config.Backend{{Name: "upstream", URL: upstream.URL, Weight: 1}}}
+		balancer := lb.NewRoundRobin(cfg.Backends, nil)
+		router := routing.NewRouter(&routing.RoutingConfig{
+			Enabled:       true,
+			ModelFallback: []config.ModelFallbackRule{{Models: []string{"gpt-4o"}, Fallbacks: fallbacks}},
+		}, balancer, nil)
+		return NewHandlerWithOptions(&HandlerOptions{Config: cfg, LoadBalancer: balancer, Router: router})
+	}
+
+	tests := []struct {
+		name         string
+		fallbacks    []string
+		want         int
+		wantFallback string
+		wantServed   string
+	}{
+		{"跳过无权使用的替代模型", []string{"gpt-4", "gpt-4o-mini"}, http.StatusOK, "gpt-4o-mini", "gpt-4o gpt-4o-mini"},
+		{"替代模型均无权使用", []string{"gpt-4"}, http.StatusServiceUnavailable, "", "gpt-4o"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mu.Lock()
+			served = nil
+			mu.Unlock()
+
+			rec := postProxy(withAllowedModels(newProxy(tt.fallbacks...), "gpt-4o,gpt-4o-mini"), "/v1/chat/completions", `{"model":"gpt-4o","messages":[]}`, nil)
+			if rec.Code != tt.want {
+				t.Fatalf("status = %d, want %d; body = %s", rec.Code, tt.want, rec.Body)
+			}
+			if got := rec.Header().Get(routing.ModelFallbackHeader); got != tt.wantFallback {
+				t.Errorf("%s = %q, want %q", routing.ModelFallbackHeader, got, tt.wantFallback)
+			}
+
+			// 无权使用的替代模型不会转发到上游
+			mu.Lock()
+			defer mu.Unlock()
+			if got := strings.Join(served, " "); got != tt.wantServed {
+				t.Errorf("upstream models = %q, want %q", got, tt.wantServed)
+			}
+		})
+	}
+}
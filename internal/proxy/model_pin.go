@@ -0,0 +1,75 @@
+package proxy
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+
+	"llmproxy/internal/config"
+	"llmproxy/internal/routing"
+)
+
+// modelPinPreference Prefer 请求头中固定模型的偏好名（Prefer: model=gpt-4-0613）
+const modelPinPreference = "model"
+
+// parseModelPin 从 Prefer 请求头（RFC 7240）中提取固定的模型名
+// 支持多个 Prefer 头和逗号分隔的多个偏好，偏好参数（; 之后）被忽略
+// 参数：
+//   - r: HTTP 请求
+//
+// 返回：
+//   - string: 模型名（未指定时为空）
+func parseModelPin(r *http.Request) string {
+	for _, header := range r.Header.Values("Prefer") {
+		for _, pref := range strings.Split(header, ",") {
+			if i := strings.Index(pref, ";"); i >= 0 {
+				pref = pref[:i]
+			}
+			name, value, ok := strings.Cut(pref, "=")
+			if !ok || !strings.EqualFold(strings.TrimSpace(name), modelPinPreference) {
+				continue
+			}
+			return strings.Trim(strings.TrimSpace(value), `"`)
+		}
+	}
+	return ""
+}
+
+// applyModelPin 按 Prefer 请求头固定上游模型名
+// 未配置 routing.model_pin.allowed 或请求未携带偏好时原样返回；
+// 模型名在白名单内时写回请求体的 model 字段，并设置 Preference-Applied 响应头
+// 参数：
+//   - cfg: 配置对象
+//   - w: HTTP 响应写入器
+//   - r: HTTP 请求
+//   - body: 请求体
+//   - model: 当前模型名
+//
+// 返回：
+//   - []byte: 请求体（固定后为改写后的请求体）
+//   - string: 模型名
+//   - error: 模型不在白名单内时返回错误
+func applyModelPin(cfg *config.Config, w http.ResponseWriter, r *http.Request, body []byte, model string) ([]byte, string, error) {
+	if cfg.Routing == nil || cfg.Routing.ModelPin == nil || len(cfg.Routing.ModelPin.Allowed) == 0 {
+		return body, model, nil
+	}
+
+	pinned := parseModelPin(r)
+	if pinned == "" {
+		return body, model, nil
+	}
+	if !routing.MatchModels(cfg.Routing.ModelPin.Allowed, pinned) {
+		return body, model, fmt.Errorf("模型不允许固定: %s", pinned)
+	}
+
+	if pinned != model {
+		rewritten, err := routing.RewriteModel(body, pinned)
+		if err != nil {
+			return body, model, err
+		}
+		body = rewritten
+	}
+
+	w.Header().Set("Preference-Applied", modelPinPreference+"="+pinned)
+	return body, pinned, nil
+}
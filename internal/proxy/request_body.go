@@ -0,0 +1,43 @@
+package proxy
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+
+	"llmproxy/internal/config"
+)
+
+// readRequestBody 读取请求体，大小受 server.max_body_size 限制
+// 超出限制时写入 413 响应，读取失败时写入 400 响应（只限制请求体，不影响流式响应）
+// 参数：
+//   - w: 响应写入器
+//   - r: HTTP 请求
+//   - cfg: 配置对象（max_body_size 为负数时不限制）
+//
+// 返回：
+//   - []byte: 请求体
+//   - error: 读取失败（已写入错误响应，调用方应直接返回）
+func readRequestBody(w http.ResponseWriter, r *http.Request, cfg *config.Config) ([]byte, error) {
+	if cfg != nil && cfg.Server != nil && cfg.Server.MaxBodySize > 0 {
+		r.Body = http.MaxBytesReader(w, r.Body, cfg.Server.MaxBodySize)
+	}
+
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		var tooLarge *http.MaxBytesError
+		if errors.As(err, &tooLarge) {
+			log.Printf("请求体超过大小限制: %d 字节", tooLarge.Limit)
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(http.StatusRequestEntityTooLarge)
+			_, _ = fmt.Fprintf(w, `{"error":"Request body too large","max_body_size":%d}`, tooLarge.Limit)
+			return nil, err
+		}
+		log.Printf("读取请求体失败: %v", err)
+		http.Error(w, "Bad request", http.StatusBadRequest)
+		return nil, err
+	}
+	return body, nil
+}
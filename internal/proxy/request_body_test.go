@@ -0,0 +1,78 @@
+package proxy
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync/atomic"
+	"testing"
+
+	"llmproxy/internal/config"
+)
+
+// paddedBody 构造指定长度的 JSON 请求体
+func paddedBody(t *testing.T, size int, stream bool) string {
+	t.Helper()
+	prefix := fmt.Sprintf(`{"model":"gpt-4o","stream":%v,"pad":"`, stream)
+	pad := size - len(prefix) - len(`"}`)
+	if pad < 0 {
+		t.Fatalf("size %d is too small", size)
+	}
+	return prefix + strings.Repeat("x", pad) + `"}`
+}
+
+func TestMaxBodySize(t *testing.T) {
+	const limit = 256
+	var hits atomic.Int32
+	upstream := newTestUpstream(t, func(w http.ResponseWriter, r *http.Request) {
+		hits.Add(1)
+		w.Header().Set("Content-Type", "text/event-stream")
+		// 响应远大于请求体限制，不受影响
+		for i := 0; i < 100; i++ {
+			fmt.Fprintf(w, "data: {\"choices\":[{\"delta\":{\"content\":\"%s\"}}]}\n\n", strings.Repeat("y", 32))
+		}
+		fmt.Fprint(w, "data: [DONE]\n\n")
+	})
+	h := newTestProxy(t, &config.Config{Server: &config.ServerConfig{MaxBodySize: limit}}, upstream)
+
+	// 恰好等于限制：正常转发，流式响应完整返回
+	rec := postProxy(h, "/v1/chat/completions", paddedBody(t, limit, true), nil)
+	if rec.Code != http.StatusOK || hits.Load() != 1 {
+		t.Fatalf("body at limit: status = %d, hits = %d, body = %s", rec.Code, hits.Load(), rec.Body)
+	}
+	if rec.Body.Len() <= limit || !strings.HasSuffix(rec.Body.String(), "data: [DONE]\n\n") {
+		t.Errorf("stream response truncated: %d bytes", rec.Body.Len())
+	}
+
+	// 超过 1 字节：413 JSON 错误，不转发
+	rec = postProxy(h, "/v1/chat/completions", paddedBody(t, limit+1, false), nil)
+	if rec.Code != http.StatusRequestEntityTooLarge {
+		t.Fatalf("body over limit: status = %d, want 413", rec.Code)
+	}
+	if ct := rec.Header().Get("Content-Type"); ct != "application/json" {
+		t.Errorf("Content-Type = %q, want application/json", ct)
+	}
+	var resp struct {
+		Error       string `json:"error"`
+		MaxBodySize int64  `json:"max_body_size"`
+	}
+	if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil || resp.Error != "Request body too large" || resp.MaxBodySize != limit {
+		t.Errorf("body = %s, err = %v", rec.Body, err)
+	}
+	if hits.Load() != 1 {
+		t.Errorf("oversized request reached the upstream")
+	}
+}
+
+func TestMaxBodySizeDisabled(t *testing.T) {
+	upstream := newTestUpstream(t, func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		fmt.Fprint(w, `{"choices":[]}`)
+	})
+	// max_body_size 为负数时不限制
+	h := newTestProxy(t, &config.Config{Server: &config.ServerConfig{MaxBodySize: -1}}, upstream)
+	if rec := postProxy(h, "/v1/chat/completions", paddedBody(t, 1<<20, false), nil); rec.Code != http.StatusOK {
+		t.Errorf("status = %d, want 200", rec.Code)
+	}
+}
@@ -0,0 +1,638 @@
+package proxy
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"net/http"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"llmproxy/internal/config"
+)
+
+// toolNamePattern 工具 / response_format 名称规则（OpenAI 与 Anthropic 一致）
+var toolNamePattern = regexp.MustCompile(`^[a-zA-Z0-9_-]{1,64}$`)
+
+// maxSchemaDepth Schema 最大嵌套深度（防止异常请求耗尽栈）
+const maxSchemaDepth = 64
+
+// schemaDialects $schema URI -> 版本
+var schemaDialects = map[string]string{
+	"http://json-schema.org/draft-04/schema":       config.SchemaDraft04,
+	"http://json-schema.org/draft-06/schema":       config.SchemaDraft06,
+	"http://json-schema.org/draft-07/schema":       config.SchemaDraft07,
+	"https://json-schema.org/draft/2019-09/schema": config.SchemaDraft2019,
+	"https://json-schema.org/draft/2020-12/schema": config.SchemaDraft2020,
+}
+
+// schemaOrder JSON Schema 版本的先后顺序
+var schemaOrder = map[string]int{
+	config.SchemaDraft04:   4,
+	config.SchemaDraft06:   6,
+	config.SchemaDraft07:   7,
+	config.SchemaDraft2019: 8,
+	config.SchemaDraft2020: 9,
+}
+
+// jsonSchemaTypes JSON Schema 支持的 type 取值
+var jsonSchemaTypes = map[string]bool{
+	"null": true, "boolean": true, "object": true, "array": true,
+	"number": true, "string": true, "integer": true,
+}
+
+// requestValidationError 请求结构校验错误
+type requestValidationError struct {
+	Param   string // 出错的字段路径，如 tools[0].function.parameters.properties.age.type
+	Message string // 错误说明
+}
+
+// Error 实现 error 接口
+func (e *requestValidationError) Error() string {
+	return e.Param + ": " + e.Message
+}
+
+// invalidf 构造校验错误
+func invalidf(param, format string, args ...interface{}) error {
+	return &requestValidationError{Param: param, Message: fmt.Sprintf(format, args...)}
+}
+
+// writeValidationError 返回 400（OpenAI 兼容的错误格式，param 指向出错字段）
+// 参数：
+//   - w: HTTP 响应写入器
+//   - err: 校验错误
+func writeValidationError(w http.ResponseWriter, err error) {
+	body := map[string]interface{}{
+		"message": err.Error(),
+		"type":    "invalid_request_error",
+	}
+	if ve, ok := err.(*requestValidationError); ok {
+		body["param"] = ve.Param
+	}
+	data, _ := json.Marshal(map[string]interface{}{"error": body})
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusBadRequest)
+	_, _ = w.Write(data)
+}
+
+// requestValidation 返回 server.request_validation 配置（未配置时为 nil）
+func requestValidation(cfg *config.Config) *config.RequestValidationConfig {
+	if cfg == nil || cfg.Server == nil {
+		return nil
+	}
+	return cfg.Server.RequestValidation
+}
+
+// validateStructuredRequest 校验请求中的 tools / functions / response_format 结构
+// 只检查明显不合法的结构（字段类型、名称、JSON Schema 关键字），不校验模型是否支持这些参数；
+// 未启用或请求不含这些字段时直接通过
+// 参数：
+//   - cfg: 校验配置（nil 或未启用时不校验）
+//   - body: 请求体
+//
+// 返回：
+//   - error: 第一个校验错误（*requestValidationError）
+func validateStructuredRequest(cfg *config.RequestValidationConfig, body []byte) error {
+	if cfg == nil || !cfg.Enabled {
+		return nil
+	}
+
+	var req struct {
+		Tools          json.RawMessage `json:"tools"`
+		Functions      json.RawMessage `json:"functions"`
+		ResponseFormat json.RawMessage `json:"response_format"`
+	}
+	if err := json.Unmarshal(body, &req); err != nil {
+		return nil // 非 JSON 请求体由后续流程处理
+	}
+
+	dialect := cfg.SchemaVersion
+	if dialect == "" {
+		dialect = config.SchemaDraft2020
+	}
+
+	names := make(map[string]string) // 工具名 -> 首次声明的位置
+	if isPresent(req.Tools) {
+		if err := validateTools(req.Tools, dialect, names); err != nil {
+			return err
+		}
+	}
+	if isPresent(req.Functions) {
+		if err := validateFunctions(req.Functions, dialect, names); err != nil {
+			return err
+		}
+	}
+	if isPresent(req.ResponseFormat) {
+		if err := validateResponseFormat(req.ResponseFormat, dialect); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// isPresent 字段是否存在且不为 null
+func isPresent(raw json.RawMessage) bool {
+	return len(raw) > 0 && string(raw) != "null"
+}
+
+// validateTools 校验 tools 数组
+// 支持 OpenAI 格式（{type: function, function: {...}}）和 Anthropic 格式（{name, input_schema}）；
+// 其他 type 的内置工具（如 Anthropic 服务端工具）只检查是否为对象
+func validateTools(raw json.RawMessage, dialect string, names map[string]string) error {
+	var tools []json.RawMessage
+	if err := json.Unmarshal(raw, &tools); err != nil {
+		return invalidf("tools", "必须是数组")
+	}
+
+	for i, t := range tools {
+		param := fmt.Sprintf("tools[%d]", i)
+		var tool map[string]json.RawMessage
+		if err := json.Unmarshal(t, &tool); err != nil || tool == nil {
+			return invalidf(param, "必须是对象")
+		}
+
+		toolType, err := optionalString(tool, "type", param)
+		if err != nil {
+			return err
+		}
+
+		switch {
+		case isPresent(tool["function"]) || toolType == "function":
+			// OpenAI 函数工具
+			if !isPresent(tool["function"]) {
+				return invalidf(param+".function", "type 为 function 时必须提供")
+			}
+			if err := validateFunction(tool["function"], param+".function", dialect, names); err != nil {
+				return err
+			}
+		case isPresent(tool["input_schema"]):
+			// Anthropic 自定义工具
+			name, err := requiredName(tool, param)
+			if err != nil {
+				return err
+			}
+			if err := checkDuplicate(names, name, param+".name"); err != nil {
+				return err
+			}
+			if _, err := optionalString(tool, "description", param); err != nil {
+				return err
+			}
+			if err := validateRootSchema(tool["input_schema"], param+".input_schema", dialect, true, false); err != nil {
+				return err
+			}
+		case toolType == "":
+			return invalidf(param, "缺少 function（OpenAI）或 input_schema（Anthropic）")
+		}
+	}
+	return nil
+}
+
+// validateFunctions 校验旧版 functions 数组
+func validateFunctions(raw json.RawMessage, dialect string, names map[string]string) error {
+	var functions []json.RawMessage
+	if err := json.Unmarshal(raw, &functions); err != nil {
+		return invalidf("functions", "必须是数组")
+	}
+	for i, f := range functions {
+		if err := validateFunction(f, fmt.Sprintf("functions[%d]", i), dialect, names); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// validateFunction 校验函数定义（name / description / parameters / strict）
+func validateFunction(raw json.RawMessage, param, dialect string, names map[string]string) error {
+	var fn map[string]json.RawMessage
+	if err := json.Unmarshal(raw, &fn); err != nil || fn == nil {
+		return invalidf(param, "必须是对象")
+	}
+
+	name, err := requiredName(fn, param)
+	if err != nil {
+		return err
+	}
+	if err := checkDuplicate(names, name, param+".name"); err != nil {
+		return err
+	}
+	if _, err := optionalString(fn, "description", param); err != nil {
+		return err
+	}
+	strict, err := optionalBool(fn, "strict", param)
+	if err != nil {
+		return err
+	}
+	if isPresent(fn["parameters"]) {
+		return validateRootSchema(fn["parameters"], param+".parameters", dialect, false, strict)
+	}
+	if strict {
+		return invalidf(param+".parameters", "strict 为 true 时必须提供")
+	}
+	return nil
+}
+
+// validateResponseFormat 校验 response_format（text / json_object / json_schema）
+func validateResponseFormat(raw json.RawMessage, dialect string) error {
+	const param = "response_format"
+
+	var rf map[string]json.RawMessage
+	if err := json.Unmarshal(raw, &rf); err != nil || rf == nil {
+		return invalidf(param, "必须是对象")
+	}
+	typ, err := optionalString(rf, "type", param)
+	if err != nil {
+		return err
+	}
+
+	switch typ {
+	case "text", "json_object":
+		return nil
+	case "json_schema":
+	case "":
+		return invalidf(param+".type", "缺少 type（可选 text / json_object / json_schema）")
+	default:
+		return invalidf(param+".type", "不支持的取值 %q（可选 text / json_object / json_schema）", typ)
+	}
+
+	if !isPresent(rf["json_schema"]) {
+		return invalidf(param+".json_schema", "type 为 json_schema 时必须提供")
+	}
+	var js map[string]json.RawMessage
+	if err := json.Unmarshal(rf["json_schema"], &js); err != nil || js == nil {
+		return invalidf(param+".json_schema", "必须是对象")
+	}
+	if _, err := requiredName(js, param+".json_schema"); err != nil {
+		return err
+	}
+	if _, err := optionalString(js, "description", param+".json_schema"); err != nil {
+		return err
+	}
+	strict, err := optionalBool(js, "strict", param+".json_schema")
+	if err != nil {
+		return err
+	}
+	if isPresent(js["schema"]) {
+		return validateRootSchema(js["schema"], param+".json_schema.schema", dialect, false, strict)
+	}
+	if strict {
+		return invalidf(param+".json_schema.schema", "strict 为 true 时必须提供")
+	}
+	return nil
+}
+
+// requiredName 读取必填的 name 字段并检查命名规则
+func requiredName(obj map[string]json.RawMessage, param string) (string, error) {
+	name, err := optionalString(obj, "name", param)
+	if err != nil {
+		return "", err
+	}
+	if name == "" {
+		return "", invalidf(param+".name", "不能为空")
+	}
+	if !toolNamePattern.MatchString(name) {
+		return "", invalidf(param+".name", "%q 不合法（只能包含字母、数字、_ 和 -，最长 64 个字符）", name)
+	}
+	return name, nil
+}
+
+// checkDuplicate 检查工具名是否重复声明
+func checkDuplicate(names map[string]string, name, param string) error {
+	if first, ok := names[name]; ok {
+		return invalidf(param, "工具名 %q 与 %s 重复", name, first)
+	}
+	names[name] = param
+	return nil
+}
+
+// optionalString 读取可选的字符串字段（存在但不是字符串时返回错误）
+func optionalString(obj map[string]json.RawMessage, key, param string) (string, error) {
+	raw, ok := obj[key]
+	if !ok || !isPresent(raw) {
+		return "", nil
+	}
+	var s string
+	if err := json.Unmarshal(raw, &s); err != nil {
+		return "", invalidf(param+"."+key, "必须是字符串")
+	}
+	return s, nil
+}
+
+// optionalBool 读取可选的布尔字段（存在但不是布尔值时返回错误）
+func optionalBool(obj map[string]json.RawMessage, key, param string) (bool, error) {
+	raw, ok := obj[key]
+	if !ok || !isPresent(raw) {
+		return false, nil
+	}
+	var b bool
+	if err := json.Unmarshal(raw, &b); err != nil {
+		return false, invalidf(param+"."+key, "必须是布尔值")
+	}
+	return b, nil
+}
+
+// validateRootSchema 校验工具参数 / 结构化输出的根 Schema
+// 参数：
+//   - raw: Schema
+//   - param: 字段路径
+//   - dialect: 默认 JSON Schema 版本（Schema 声明了 $schema 时以声明为准）
+//   - requireObject: 根 Schema 是否必须声明 type: object（Anthropic input_schema）
+//   - strict: 是否按严格模式校验（所有对象必须 additionalProperties: false 且全部属性必填）
+func validateRootSchema(raw json.RawMessage, param, dialect string, requireObject, strict bool) error {
+	var root interface{}
+	if err := json.Unmarshal(raw, &root); err != nil {
+		return invalidf(param, "不是合法的 JSON")
+	}
+	obj, ok := root.(map[string]interface{})
+	if !ok {
+		return invalidf(param, "必须是 JSON Schema 对象")
+	}
+
+	if s, ok := obj["$schema"]; ok {
+		uri, _ := s.(string)
+		d, known := schemaDialects[strings.TrimSuffix(uri, "#")]
+		if !known {
+			return invalidf(param+".$schema", "不支持的 JSON Schema 版本 %v", s)
+		}
+		dialect = d
+	}
+
+	typ, hasType := obj["type"]
+	if hasType && typ != "object" {
+		return invalidf(param+".type", "根 Schema 的 type 必须为 \"object\"")
+	}
+	if !hasType && (requireObject || strict) {
+		return invalidf(param+".type", "根 Schema 必须声明 type: \"object\"")
+	}
+
+	c := &schemaChecker{dialect: dialect, strict: strict}
+	return c.check(root, param, 0)
+}
+
+// schemaChecker 按 JSON Schema 版本检查 Schema 结构
+type schemaChecker struct {
+	dialect string
+	strict  bool
+}
+
+// atLeast 当前版本是否不早于 v
+func (c *schemaChecker) atLeast(v string) bool {
+	return schemaOrder[c.dialect] >= schemaOrder[v]
+}
+
+// check 递归检查一个子 Schema
+func (c *schemaChecker) check(node interface{}, param string, depth int) error {
+	if depth > maxSchemaDepth {
+		return invalidf(param, "Schema 嵌套超过 %d 层", maxSchemaDepth)
+	}
+
+	if _, ok := node.(bool); ok {
+		if !c.atLeast(config.SchemaDraft06) {
+			return invalidf(param, "%s 不支持布尔 Schema", c.dialect)
+		}
+		return nil
+	}
+	schema, ok := node.(map[string]interface{})
+	if !ok {
+		return invalidf(param, "必须是 JSON Schema 对象")
+	}
+
+	if err := c.checkType(schema, param); err != nil {
+		return err
+	}
+	if err := c.checkKeywords(schema, param); err != nil {
+		return err
+	}
+	if c.strict {
+		if err := c.checkStrict(schema, param); err != nil {
+			return err
+		}
+	}
+
+	// 子 Schema 映射
+	for _, key := range []string{"properties", "patternProperties", "definitions", "$defs", "dependentSchemas"} {
+		v, ok := schema[key]
+		if !ok {
+			continue
+		}
+		if key == "$defs" && !c.atLeast(config.SchemaDraft2019) {
+			continue // 早期版本中 $defs 不是关键字
+		}
+		m, ok := v.(map[string]interface{})
+		if !ok {
+			return invalidf(param+"."+key, "必须是对象")
+		}
+		for _, name := range sortedKeys(m) {
+			if err := c.check(m[name], param+"."+key+"."+name, depth+1); err != nil {
+				return err
+			}
+		}
+	}
+
+	// 单个子 Schema
+	for _, key := range []string{"additionalProperties", "not", "contains", "propertyNames", "if", "then", "else", "additionalItems", "unevaluatedProperties", "unevaluatedItems"} {
+		if v, ok := schema[key]; ok {
+			if err := c.check(v, param+"."+key, depth+1); err != nil {
+				return err
+			}
+		}
+	}
+
+	// 子 Schema 数组
+	for _, key := range []string{"allOf", "anyOf", "oneOf", "prefixItems"} {
+		v, ok := schema[key]
+		if !ok {
+			continue
+		}
+		if key == "prefixItems" && !c.atLeast(config.SchemaDraft2020) {
+			return invalidf(param+".prefixItems", "%s 不支持 prefixItems（请使用数组形式的 items）", c.dialect)
+		}
+		list, ok := v.([]interface{})
+		if !ok || len(list) == 0 {
+			return invalidf(param+"."+key, "必须是非空数组")
+		}
+		for i, sub := range list {
+			if err := c.check(sub, fmt.Sprintf("%s.%s[%d]", param, key, i), depth+1); err != nil {
+				return err
+			}
+		}
+	}
+
+	// items：2020-12 只允许单个 Schema，早期版本还允许 Schema 数组（元组）
+	if v, ok := schema["items"]; ok {
+		if list, isList := v.([]interface{}); isList {
+			if c.atLeast(config.SchemaDraft2020) {
+				return invalidf(param+".items", "2020-12 中 items 必须是单个 Schema（元组请使用 prefixItems）")
+			}
+			for i, sub := range list {
+				if err := c.check(sub, fmt.Sprintf("%s.items[%d]", param, i), depth+1); err != nil {
+					return err
+				}
+			}
+		} else if err := c.check(v, param+".items", depth+1); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// checkType 检查 type 关键字
+func (c *schemaChecker) checkType(schema map[string]interface{}, param string) error {
+	v, ok := schema["type"]
+	if !ok {
+		return nil
+	}
+	switch t := v.(type) {
+	case string:
+		if !jsonSchemaTypes[t] {
+			return invalidf(param+".type", "不支持的类型 %q", t)
+		}
+	case []interface{}:
+		if len(t) == 0 {
+			return invalidf(param+".type", "类型数组不能为空")
+		}
+		seen := make(map[string]bool)
+		for _, item := range t {
+			s, ok := item.(string)
+			if !ok || !jsonSchemaTypes[s] {
+				return invalidf(param+".type", "不支持的类型 %v", item)
+			}
+			if seen[s] {
+				return invalidf(param+".type", "类型 %q 重复", s)
+			}
+			seen[s] = true
+		}
+	default:
+		return invalidf(param+".type", "必须是字符串或字符串数组")
+	}
+	return nil
+}
+
+// checkKeywords 检查非 Schema 取值的关键字
+func (c *schemaChecker) checkKeywords(schema map[string]interface{}, param string) error {
+	if v, ok := schema["required"]; ok {
+		list, ok := v.([]interface{})
+		if !ok {
+			return invalidf(param+".required", "必须是字符串数组")
+		}
+		if len(list) == 0 && !c.atLeast(config.SchemaDraft06) {
+			return invalidf(param+".required", "draft-04 中 required 不能为空数组")
+		}
+		seen := make(map[string]bool)
+		for _, item := range list {
+			s, ok := item.(string)
+			if !ok {
+				return invalidf(param+".required", "必须是字符串数组")
+			}
+			if seen[s] {
+				return invalidf(param+".required", "属性 %q 重复", s)
+			}
+			seen[s] = true
+		}
+	}
+
+	if v, ok := schema["enum"]; ok {
+		if list, ok := v.([]interface{}); !ok || len(list) == 0 {
+			return invalidf(param+".enum", "必须是非空数组")
+		}
+	}
+
+	for _, key := range []string{"$ref", "pattern", "format", "title", "description"} {
+		if v, ok := schema[key]; ok {
+			if _, ok := v.(string); !ok {
+				return invalidf(param+"."+key, "必须是字符串")
+			}
+		}
+	}
+
+	for _, key := range []string{"minLength", "maxLength", "minItems", "maxItems", "minProperties", "maxProperties", "minContains", "maxContains"} {
+		if v, ok := schema[key]; ok {
+			n, ok := v.(float64)
+			if !ok || n < 0 || n != math.Trunc(n) {
+				return invalidf(param+"."+key, "必须是非负整数")
+			}
+		}
+	}
+
+	for _, key := range []string{"minimum", "maximum"} {
+		if v, ok := schema[key]; ok {
+			if _, ok := v.(float64); !ok {
+				return invalidf(param+"."+key, "必须是数字")
+			}
+		}
+	}
+	if v, ok := schema["multipleOf"]; ok {
+		if n, ok := v.(float64); !ok || n <= 0 {
+			return invalidf(param+".multipleOf", "必须是大于 0 的数字")
+		}
+	}
+
+	// exclusiveMinimum / exclusiveMaximum：draft-04 为布尔值，draft-06 起为数字
+	for _, key := range []string{"exclusiveMinimum", "exclusiveMaximum"} {
+		v, ok := schema[key]
+		if !ok {
+			continue
+		}
+		if c.atLeast(config.SchemaDraft06) {
+			if _, ok := v.(float64); !ok {
+				return invalidf(param+"."+key, "%s 中必须是数字", c.dialect)
+			}
+		} else if _, ok := v.(bool); !ok {
+			return invalidf(param+"."+key, "draft-04 中必须是布尔值")
+		}
+	}
+	return nil
+}
+
+// checkStrict 严格模式：对象必须禁止额外属性，并将全部属性列为必填
+func (c *schemaChecker) checkStrict(schema map[string]interface{}, param string) error {
+	if !schemaHasType(schema, "object") {
+		return nil
+	}
+	if ap, ok := schema["additionalProperties"]; !ok || ap != false {
+		return invalidf(param+".additionalProperties", "严格模式下必须为 false")
+	}
+
+	props, _ := schema["properties"].(map[string]interface{})
+	required := make(map[string]bool)
+	if list, ok := schema["required"].([]interface{}); ok {
+		for _, item := range list {
+			if s, ok := item.(string); ok {
+				required[s] = true
+			}
+		}
+	}
+	for _, name := range sortedKeys(props) {
+		if !required[name] {
+			return invalidf(param+".required", "严格模式下必须包含属性 %s", strconv.Quote(name))
+		}
+	}
+	return nil
+}
+
+// sortedKeys 按字典序返回对象的键（保证错误信息稳定）
+func sortedKeys(m map[string]interface{}) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// schemaHasType 判断 Schema 的 type 是否包含指定类型
+func schemaHasType(schema map[string]interface{}, typ string) bool {
+	switch t := schema["type"].(type) {
+	case string:
+		return t == typ
+	case []interface{}:
+		for _, item := range t {
+			if item == typ {
+				return true
+			}
+		}
+	}
+	return false
+}
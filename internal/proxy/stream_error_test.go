@@ -0,0 +1,103 @@
+package proxy
+
+import (
+	"io"
+	"net/http"
+	"testing"
+
+	"llmproxy/internal/config"
+)
+
+// rateLimitedBody 上游返回的 429 JSON 错误
+const rateLimitedBody = `{"error":{"message":"Rate limit reached","type":"rate_limit_exceeded","code":"rate_limit_exceeded"}}`
+
+func TestStreamingRequestUpstreamJSONError(t *testing.T) {
+	tests := []struct {
+		name string
+		cfg  *config.Config
+	}{
+		{"默认配置", nil},
+		// stream_mismatch: sse 只影响成功响应，错误响应仍按普通 JSON 返回
+		{"stream_mismatch sse", &config.Config{Server: &config.ServerConfig{StreamMismatch: config.StreamMismatchSSE}}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			upstream := newTestUpstream(t, func(w http.ResponseWriter, r *http.Request) {
+				w.Header().Set("Content-Type", "application/json; charset=utf-8")
+				w.Header().Set("Retry-After", "7")
+				w.WriteHeader(http.StatusTooManyRequests)
+				_, _ = io.WriteString(w, rateLimitedBody)
+			})
+			h := newTestProxy(t, tt.cfg, upstream)
+
+			rec := postProxy(h, "/v1/chat/completions", `{"model":"gpt-4","stream":true,"messages":[]}`, nil)
+			if rec.Code != http.StatusTooManyRequests {
+				t.Fatalf("status = %d, want 429", rec.Code)
+			}
+			if ct := rec.Header().Get("Content-Type"); ct != "application/json; charset=utf-8" {
+				t.Errorf("Content-Type = %q, want the upstream JSON type", ct)
+			}
+			if rec.Body.String() != rateLimitedBody {
+				t.Errorf("body = %q, want the upstream error unchanged", rec.Body)
+			}
+			if got := rec.Header().Get("Retry-After"); got != "7" {
+				t.Errorf("Retry-After = %q, want 7", got)
+			}
+		})
+	}
+}
+
+func TestStreamingRequestUpstreamHTMLError(t *testing.T) {
+	upstream := newTestUpstream(t, func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html")
+		w.WriteHeader(http.StatusBadGateway)
+		_, _ = io.WriteString(w, "<html>Bad Gateway</html>")
+	})
+	h := newTestProxy(t, nil, upstream)
+
+	rec := postProxy(h, "/v1/chat/completions", `{"model":"gpt-4","stream":true,"messages":[]}`, nil)
+	if rec.Code != http.StatusBadGateway {
+		t.Fatalf("status = %d, want 502", rec.Code)
+	}
+	if ct := rec.Header().Get("Content-Type"); ct != "text/html" {
+		t.Errorf("Content-Type = %q, want text/html", ct)
+	}
+	if rec.Body.String() != "<html>Bad Gateway</html>" {
+		t.Errorf("body = %q", rec.Body)
+	}
+}
+
+func TestUpstreamStreaming(t *testing.T) {
+	sse := &config.Config{Server: &config.ServerConfig{StreamMismatch: config.StreamMismatchSSE}}
+	tests := []struct {
+		name          string
+		cfg           *config.Config
+		status        int
+		contentType   string
+		contentLength int64
+		requested     bool
+		want          bool
+	}{
+		{"SSE 成功", nil, 200, "text/event-stream", -1, true, true},
+		{"未请求流式", nil, 200, "text/event-stream", -1, false, false},
+		{"忽略 stream 返回 JSON", nil, 200, "application/json", 10, true, false},
+		{"未声明类型的分块响应", nil, 200, "", -1, true, true},
+		{"未声明类型的定长响应", nil, 200, "", 10, true, false},
+		{"stream_mismatch sse", sse, 200, "application/json", 10, true, true},
+		{"429 JSON", nil, 429, "application/json", 10, true, false},
+		{"429 JSON + stream_mismatch sse", sse, 429, "application/json", 10, true, false},
+		{"500 无类型", sse, 500, "", -1, true, false},
+		{"错误以 SSE 返回", nil, 400, "text/event-stream", -1, true, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resp := &http.Response{StatusCode: tt.status, Header: http.Header{}, ContentLength: tt.contentLength}
+			if tt.contentType != "" {
+				resp.Header.Set("Content-Type", tt.contentType)
+			}
+			if got := upstreamStreaming(tt.cfg, resp, tt.requested); got != tt.want {
+				t.Errorf("upstreamStreaming() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,139 @@
+package proxy
+
+import (
+	"encoding/json"
+)
+
+// toolDef 请求中声明的工具（兼容 OpenAI tools / functions 和 Anthropic tools）
+type toolDef struct {
+	Name     string `json:"name"` // Anthropic tools[].name、OpenAI functions[].name
+	Function struct {
+		Name string `json:"name"`
+	} `json:"function"` // OpenAI tools[].function.name
+}
+
+// toolCall 模型发起的工具调用（OpenAI tool_calls[]）
+type toolCall struct {
+	Function struct {
+		Name string `json:"name"`
+	} `json:"function"`
+}
+
+// functionCall 旧版函数调用（OpenAI function_call）
+type functionCall struct {
+	Name string `json:"name"`
+}
+
+// contentBlock Anthropic 内容块（type=tool_use 时为工具调用）
+type contentBlock struct {
+	Type string `json:"type"`
+	Name string `json:"name"`
+}
+
+// extractRequestTools 提取请求中声明的工具名称（去重，保持顺序）
+// 只提取名称，不记录参数定义
+// 参数：
+//   - body: 请求体
+//
+// 返回：
+//   - []string: 工具名称列表
+func extractRequestTools(body []byte) []string {
+	var req struct {
+		Tools     []toolDef `json:"tools"`
+		Functions []toolDef `json:"functions"`
+	}
+	if err := json.Unmarshal(body, &req); err != nil {
+		return nil
+	}
+
+	var names []string
+	seen := make(map[string]bool)
+	for _, t := range append(req.Tools, req.Functions...) {
+		name := t.Function.Name
+		if name == "" {
+			name = t.Name
+		}
+		if name != "" && !seen[name] {
+			seen[name] = true
+			names = append(names, name)
+		}
+	}
+	return names
+}
+
+// extractToolCalls 提取响应中模型调用的工具名称（每次调用一项，不记录参数）
+// 参数：
+//   - respBody: 响应体（流式时为 SSE 文本）
+//   - stream: 是否为流式响应
+//
+// 返回：
+//   - []string: 工具名称列表
+func extractToolCalls(respBody []byte, stream bool) []string {
+	if !stream {
+		var resp struct {
+			Choices []struct {
+				Message struct {
+					ToolCalls    []toolCall    `json:"tool_calls"`
+					FunctionCall *functionCall `json:"function_call"`
+				} `json:"message"`
+			} `json:"choices"`
+			Content []contentBlock `json:"content"`
+		}
+		if err := json.Unmarshal(respBody, &resp); err != nil {
+			return nil
+		}
+
+		var names []string
+		for _, c := range resp.Choices {
+			for _, tc := range c.Message.ToolCalls {
+				names = appendName(names, tc.Function.Name)
+			}
+			if c.Message.FunctionCall != nil {
+				names = appendName(names, c.Message.FunctionCall.Name)
+			}
+		}
+		for _, b := range resp.Content {
+			if b.Type == "tool_use" {
+				names = appendName(names, b.Name)
+			}
+		}
+		return names
+	}
+
+	// 流式响应：工具名称只出现在每次调用的首个 delta（Anthropic 为 content_block_start）中
+	var names []string
+	for _, data := range sseDataChunks(respBody) {
+		var chunk struct {
+			Choices []struct {
+				Delta struct {
+					ToolCalls    []toolCall    `json:"tool_calls"`
+					FunctionCall *functionCall `json:"function_call"`
+				} `json:"delta"`
+			} `json:"choices"`
+			ContentBlock *contentBlock `json:"content_block"`
+		}
+		if err := json.Unmarshal(data, &chunk); err != nil {
+			continue
+		}
+		for _, c := range chunk.Choices {
+			for _, tc := range c.Delta.ToolCalls {
+				names = appendName(names, tc.Function.Name)
+			}
+			if c.Delta.FunctionCall != nil {
+				names = appendName(names, c.Delta.FunctionCall.Name)
+			}
+		}
+		if chunk.ContentBlock != nil && chunk.ContentBlock.Type == "tool_use" {
+			names = appendName(names, chunk.ContentBlock.Name)
+		}
+	}
+	return names
+}
+
+// appendName 追加非空名称
+func appendName(names []string, name string) []string {
+	if name == "" {
+		return names
+	}
+	return append(names, name)
+}
@@ -0,0 +1,109 @@
+package proxy
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"sync"
+	"testing"
+
+	"llmproxy/internal/config"
+	"llmproxy/internal/tracing"
+)
+
+// exportedSpan 收集器收到的 Span（只解析断言需要的字段）
+type exportedSpan struct {
+	SpanID       string `json:"spanId"`
+	ParentSpanID string `json:"parentSpanId"`
+	Name         string `json:"name"`
+	Attributes   []struct {
+		Key   string                 `json:"key"`
+		Value map[string]interface{} `json:"value"`
+	} `json:"attributes"`
+}
+
+// attr 返回属性值的字符串形式
+func (s *exportedSpan) attr(key string) string {
+	for _, a := range s.Attributes {
+		if a.Key == key {
+			for _, v := range a.Value {
+				return fmt.Sprint(v)
+			}
+		}
+	}
+	return ""
+}
+
+func TestProxyRequestSpans(t *testing.T) {
+	var mu sync.Mutex
+	spans := make(map[string]*exportedSpan)
+	collector := newTestUpstream(t, func(w http.ResponseWriter, r *http.Request) {
+		var req struct {
+			ResourceSpans []struct {
+				ScopeSpans []struct {
+					Spans []*exportedSpan `json:"spans"`
+				} `json:"scopeSpans"`
+			} `json:"resourceSpans"`
+		}
+		body, _ := io.ReadAll(r.Body)
+		if err := json.Unmarshal(body, &req); err != nil {
+			t.Errorf("collector: %v", err)
+		}
+		mu.Lock()
+		defer mu.Unlock()
+		for _, rs := range req.ResourceSpans {
+			for _, ss := range rs.ScopeSpans {
+				for _, s := range ss.Spans {
+					spans[s.Name] = s
+				}
+			}
+		}
+	})
+	if err := tracing.Init(&config.TracingConfig{Enabled: true, Endpoint: collector.URL}); err != nil {
+		t.Fatal(err)
+	}
+	defer tracing.Shutdown(context.Background())
+
+	upstream := newTestUpstream(t, func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("traceparent") == "" {
+			t.Error("upstream request has no traceparent")
+		}
+		w.Header().Set("Content-Type", "application/json")
+		fmt.Fprint(w, `{"choices":[],"usage":{"prompt_tokens":7,"completion_tokens":5,"total_tokens":12}}`)
+	})
+	h := tracing.Middleware(newTestProxy(t, nil, upstream))
+
+	if rec := postProxy(h, "/v1/chat/completions", `{"model":"gpt-4o"}`, nil); rec.Code != http.StatusOK {
+		t.Fatalf("status = %d, body = %s", rec.Code, rec.Body)
+	}
+	tracing.Shutdown(context.Background())
+
+	mu.Lock()
+	defer mu.Unlock()
+	root, backend := spans["POST /v1/chat/completions"], spans["backend.request"]
+	if root == nil || backend == nil {
+		t.Fatalf("exported spans = %v", spans)
+	}
+	if backend.ParentSpanID != root.SpanID {
+		t.Errorf("backend.request parent = %s, want root %s", backend.ParentSpanID, root.SpanID)
+	}
+	want := map[string]string{
+		"llm.model":                   "gpt-4o",
+		"backend.url":                 upstream.URL,
+		"backend.status_code":         "200",
+		"http.status_code":            "200",
+		"llm.usage.prompt_tokens":     "7",
+		"llm.usage.completion_tokens": "5",
+		"llm.usage.total_tokens":      "12",
+	}
+	for key, value := range want {
+		if got := root.attr(key); got != value {
+			t.Errorf("root %s = %q, want %q", key, got, value)
+		}
+	}
+	if got := backend.attr("backend.url"); got != upstream.URL {
+		t.Errorf("backend.request backend.url = %q", got)
+	}
+}
@@ -6,7 +6,9 @@ import (
 	"fmt"
 	"log"
 	"sync"
+	"time"
 
+	"llmproxy/internal/config"
 	"llmproxy/internal/metrics"
 
 	_ "github.com/go-sql-driver/mysql"
@@ -19,7 +21,11 @@ type UsageDBWriter struct {
 	name  string  // 上报器名称
 	db    *sql.DB // 数据库连接
 	table string  // 表名
-	mu    sync.Mutex
+
+	retry   int           // 写入尝试次数
+	backoff time.Duration // 首次重试等待时间（之后每次翻倍）
+	spill   *spillQueue   // 溢出文件（为 nil 不启用）
+	stop    chan struct{} // 停止重放任务
 }
 
 // usageDBWriters 全局用量数据库写入器映射（支持多个）
@@ -31,15 +37,19 @@ var usageDBMutex sync.RWMutex
 //   - name: 上报器名称
 //   - db: 数据库连接
 //   - driver: 数据库驱动（mysql/postgres/sqlite）
-//   - table: 表名
+//   - cfg: 用量数据库配置（表名、重试与溢出文件）
 //
 // 返回：
 //   - error: 错误信息
-func InitUsageDatabaseWithConnection(name string, db *sql.DB, driver, table string) error {
+func InitUsageDatabaseWithConnection(name string, db *sql.DB, driver string, cfg *config.UsageDatabaseConfig) error {
 	if db == nil {
 		return fmt.Errorf("数据库连接不能为空")
 	}
+	if cfg == nil {
+		cfg = &config.UsageDatabaseConfig{}
+	}
 
+	table := cfg.Table
 	if table == "" {
 		table = "usage_records"
 	}
@@ -52,14 +62,39 @@ func InitUsageDatabaseWithConnection(name string, db *sql.DB, driver, table stri
 		log.Printf("警告: 创建用量表失败: %v（请手动创建）", err)
 	}
 
+	writer := &UsageDBWriter{
+		name:    name,
+		db:      db,
+		table:   table,
+		retry:   cfg.Retry,
+		backoff: cfg.RetryBackoff,
+		stop:    make(chan struct{}),
+	}
+	if writer.retry <= 0 {
+		writer.retry = 3
+	}
+	if writer.backoff <= 0 {
+		writer.backoff = 100 * time.Millisecond
+	}
+
+	if cfg.SpillFile != "" {
+		spill, err := newSpillQueue(name, cfg.SpillFile, cfg.SpillMax)
+		if err != nil {
+			return err
+		}
+		writer.spill = spill
+		interval := cfg.ReplayInterval
+		if interval <= 0 {
+			interval = 30 * time.Second
+		}
+		go writer.replayLoop(interval)
+	}
+
 	// 存储到全局映射
 	usageDBMutex.Lock()
-	usageDBWriters[name] = &UsageDBWriter{
-		name:  name,
-		db:    db,
-		table: table,
-	}
+	usageDBWriters[name] = writer
 	usageDBMutex.Unlock()
+	markUsageReporterReady(name)
 
 	log.Printf("用量数据库 [%s] 已初始化: %s, 表: %s", name, driver, table)
 	return nil
@@ -151,6 +186,7 @@ func createUsageTable(db *sql.DB, driver, table string) error {
 }
 
 // SendUsageToDatabaseByName 写入用量数据到指定数据库
+// 写入失败时按指数退避重试；仍失败且配置了 spill_file 时追加到溢出文件（不超过 spill_max 条），由后台任务重放
 // 参数：
 //   - name: 上报器名称
 //   - usage: 用量记录
@@ -159,18 +195,73 @@ func SendUsageToDatabaseByName(name string, usage *UsageRecord) {
 		return
 	}
 
-	usageDBMutex.RLock()
-	writer, ok := usageDBWriters[name]
-	usageDBMutex.RUnlock()
-
-	if !ok || writer == nil {
+	writer := getUsageDBWriter(name)
+	if writer == nil {
 		log.Printf("[%s] 用量数据库未初始化", name)
 		return
 	}
 
-	writer.mu.Lock()
-	defer writer.mu.Unlock()
+	var err error
+	backoff := writer.backoff
+	for attempt := 0; attempt < writer.retry; attempt++ {
+		if attempt > 0 {
+			log.Printf("[%s] 用量写入重试 %d/%d", name, attempt+1, writer.retry)
+			time.Sleep(backoff)
+			backoff *= 2
+		}
+		if err = writer.insert(usage); err == nil {
+			metrics.RecordWebhookSuccess()
+			log.Printf("[%s] 用量数据已写入数据库: request_id=%s", name, usage.RequestID)
+			return
+		}
+	}
 
+	log.Printf("[%s] 写入用量数据失败，已重试 %d 次: %v", name, writer.retry, err)
+	metrics.RecordWebhookFailure()
+
+	if writer.spill == nil {
+		return
+	}
+	dropped, err := writer.spill.push([]*UsageRecord{usage})
+	if err != nil {
+		log.Printf("[%s] 用量记录写入溢出文件失败，记录丢失: request_id=%s, err=%v", name, usage.RequestID, err)
+		return
+	}
+	if dropped > 0 {
+		log.Printf("[%s] 溢出文件已满，用量记录丢失: request_id=%s", name, usage.RequestID)
+		return
+	}
+	log.Printf("[%s] 用量记录已写入溢出文件，等待重放: request_id=%s", name, usage.RequestID)
+}
+
+// sendUsageToDatabaseOnce 写入一次用量数据（不重试、不溢出，供影子上报器使用）
+// 参数：
+//   - name: 上报器名称
+//   - usage: 用量记录
+//
+// 返回：
+//   - bool: 是否成功
+func sendUsageToDatabaseOnce(name string, usage *UsageRecord) bool {
+	writer := getUsageDBWriter(name)
+	if writer == nil || usage == nil {
+		return false
+	}
+	if err := writer.insert(usage); err != nil {
+		log.Printf("[%s] 写入用量数据失败: %v", name, err)
+		return false
+	}
+	return true
+}
+
+// getUsageDBWriter 获取指定名称的写入器
+func getUsageDBWriter(name string) *UsageDBWriter {
+	usageDBMutex.RLock()
+	defer usageDBMutex.RUnlock()
+	return usageDBWriters[name]
+}
+
+// insert 插入一条用量记录
+func (w *UsageDBWriter) insert(usage *UsageRecord) error {
 	// 序列化请求体
 	requestBodyJSON, err := json.Marshal(usage.RequestBody)
 	if err != nil {
@@ -195,9 +286,9 @@ func SendUsageToDatabaseByName(name string, usage *UsageRecord) {
 			backend_url, status_code, latency_ms, 
 			prompt_tokens, completion_tokens, total_tokens, request_body
 		) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
-	`, writer.table)
+	`, w.table)
 
-	_, err = writer.db.Exec(
+	_, err = w.db.Exec(
 		insertSQL,
 		usage.RequestID,
 		usage.Timestamp,
@@ -213,15 +304,26 @@ func SendUsageToDatabaseByName(name string, usage *UsageRecord) {
 		totalTokens,
 		string(requestBodyJSON),
 	)
+	return err
+}
 
-	if err != nil {
-		log.Printf("[%s] 写入用量数据失败: %v", name, err)
-		metrics.RecordWebhookFailure()
-		return
-	}
+// replayLoop 定期重放溢出文件
+func (w *UsageDBWriter) replayLoop(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
 
-	metrics.RecordWebhookSuccess()
-	log.Printf("[%s] 用量数据已写入数据库: request_id=%s, tokens=%d", name, usage.RequestID, totalTokens)
+	for {
+		select {
+		case <-w.stop:
+			return
+		case <-ticker.C:
+			if n, err := w.spill.replay(w.insert); err != nil {
+				log.Printf("[%s] 重放溢出文件失败: %v", w.name, err)
+			} else if n > 0 {
+				log.Printf("[%s] 已从溢出文件重放 %d 条用量记录", w.name, n)
+			}
+		}
+	}
 }
 
 // CloseAllUsageDatabases 关闭所有用量数据库连接
@@ -230,6 +332,9 @@ func CloseAllUsageDatabases() {
 	defer usageDBMutex.Unlock()
 
 	for name, writer := range usageDBWriters {
+		if writer != nil && writer.stop != nil {
+			close(writer.stop)
+		}
 		if writer != nil && writer.db != nil {
 			if err := writer.db.Close(); err != nil {
 				log.Printf("[%s] 关闭用量数据库连接失败: %v", name, err)
@@ -0,0 +1,149 @@
+package proxy
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	"llmproxy/internal/config"
+	"llmproxy/internal/metrics"
+)
+
+// usageDeadLetter Webhook 上报器的死信队列
+// 重试耗尽的用量记录写入本地文件，后台任务定期按顺序重新发送，端点恢复后自动清空
+type usageDeadLetter struct {
+	reporter *config.UsageReporter // 上报器配置
+	queue    *spillQueue           // 死信文件
+	stop     chan struct{}         // 停止重发任务
+}
+
+// usageDeadLetters 全局死信队列映射（按上报器名称）
+var usageDeadLetters = make(map[string]*usageDeadLetter)
+var usageDeadLetterMutex sync.RWMutex
+
+// InitUsageWebhook 初始化 Webhook 上报器（配置了 dead_letter.file 时启用死信队列）
+// 未调用或初始化失败的 Webhook 上报器会被 SendUsage 跳过
+// 参数：
+//   - reporter: 上报器配置
+//
+// 返回：
+//   - error: 错误信息
+func InitUsageWebhook(reporter *config.UsageReporter) error {
+	if reporter == nil || reporter.Webhook == nil {
+		return fmt.Errorf("缺少 webhook 配置")
+	}
+	dl := reporter.DeadLetter
+	if dl == nil || dl.File == "" {
+		markUsageReporterReady(reporter.Name)
+		return nil
+	}
+
+	queue, err := newSpillQueue(reporter.Name, dl.File, dl.MaxRecords)
+	if err != nil {
+		return err
+	}
+	d := &usageDeadLetter{
+		reporter: reporter,
+		queue:    queue,
+		stop:     make(chan struct{}),
+	}
+
+	interval := dl.DrainInterval
+	if interval <= 0 {
+		interval = 30 * time.Second
+	}
+	go d.drainLoop(interval)
+
+	usageDeadLetterMutex.Lock()
+	if old := usageDeadLetters[reporter.Name]; old != nil {
+		close(old.stop)
+	}
+	usageDeadLetters[reporter.Name] = d
+	usageDeadLetterMutex.Unlock()
+	markUsageReporterReady(reporter.Name)
+
+	log.Printf("[%s] 用量死信队列已启用: %s（最多 %d 条，现有 %d 条）", reporter.Name, dl.File, queue.max, queue.count)
+	return nil
+}
+
+// getUsageDeadLetter 获取指定上报器的死信队列（未启用时返回 nil）
+func getUsageDeadLetter(name string) *usageDeadLetter {
+	usageDeadLetterMutex.RLock()
+	defer usageDeadLetterMutex.RUnlock()
+	return usageDeadLetters[name]
+}
+
+// deadLetterUsage 将发送失败的用量记录写入死信队列（未启用时直接丢弃）
+// 参数：
+//   - name: 上报器名称
+//   - usage: 用量记录
+func deadLetterUsage(name string, usage *UsageRecord) {
+	d := getUsageDeadLetter(name)
+	if d == nil {
+		return
+	}
+	dropped, err := d.queue.push([]*UsageRecord{usage})
+	if err != nil {
+		log.Printf("[%s] 用量记录写入死信队列失败，记录丢失: request_id=%s, err=%v", name, usage.RequestID, err)
+		return
+	}
+	if dropped > 0 {
+		log.Printf("[%s] 死信队列已满，用量记录丢失: request_id=%s", name, usage.RequestID)
+		return
+	}
+	log.Printf("[%s] 用量记录已写入死信队列，等待重发: request_id=%s", name, usage.RequestID)
+}
+
+// drainLoop 定期重新发送死信队列中的记录
+func (d *usageDeadLetter) drainLoop(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-d.stop:
+			return
+		case <-ticker.C:
+			if n, err := d.drain(); err != nil {
+				log.Printf("[%s] 重发死信队列失败: %v", d.reporter.Name, err)
+			} else if n > 0 {
+				log.Printf("[%s] 已从死信队列重发 %d 条用量记录", d.reporter.Name, n)
+			}
+		}
+	}
+}
+
+// drain 按顺序重新发送死信队列中的记录（每条只尝试一次，失败即停止等待下一轮）
+// 端点返回不可重试的错误时丢弃该记录，避免一条坏记录阻塞整个队列
+//
+// 返回：
+//   - int: 移出队列的记录数
+//   - error: 错误信息
+func (d *usageDeadLetter) drain() (int, error) {
+	webhook := d.reporter.Webhook
+	timeout := webhook.Timeout
+	if timeout == 0 {
+		timeout = 3 * time.Second
+	}
+
+	return d.queue.replay(func(usage *UsageRecord) error {
+		data, err := json.Marshal(usage)
+		if err != nil {
+			log.Printf("[%s] 序列化死信记录失败，丢弃: request_id=%s, err=%v", d.reporter.Name, usage.RequestID, err)
+			return nil
+		}
+		result := sendWebhookOnce(webhook, timeout, data)
+		switch {
+		case result.ok:
+			metrics.RecordWebhookSuccess()
+		case !result.retryable:
+			log.Printf("[%s] Webhook 拒绝死信记录，丢弃: request_id=%s", d.reporter.Name, usage.RequestID)
+			metrics.RecordWebhookFailure()
+		default:
+			return fmt.Errorf("webhook 仍不可用")
+		}
+		return nil
+	})
+}
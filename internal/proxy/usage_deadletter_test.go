@@ -0,0 +1,220 @@
+package proxy
+
+import (
+	"encoding/json"
+	"net/http"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"llmproxy/internal/config"
+	"llmproxy/internal/metrics"
+)
+
+// initTestDeadLetter 初始化带死信队列的 Webhook 上报器，测试结束时停止重发任务
+func initTestDeadLetter(t *testing.T, reporter *config.UsageReporter) {
+	t.Helper()
+	if err := InitUsageWebhook(reporter); err != nil {
+		t.Fatalf("InitUsageWebhook() error = %v", err)
+	}
+	t.Cleanup(func() {
+		usageDeadLetterMutex.Lock()
+		defer usageDeadLetterMutex.Unlock()
+		if d := usageDeadLetters[reporter.Name]; d != nil {
+			close(d.stop)
+			delete(usageDeadLetters, reporter.Name)
+		}
+	})
+}
+
+// spilledIDs 返回死信（溢出）文件中记录的 request_id
+func spilledIDs(t *testing.T, path string) []string {
+	t.Helper()
+	records, err := readSpill(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ids := make([]string, len(records))
+	for i, r := range records {
+		ids[i] = r.RequestID
+	}
+	return ids
+}
+
+// waitFor 轮询直到条件成立
+func waitFor(t *testing.T, what string, cond func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(3 * time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatalf("timed out waiting for %s", what)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestUsageDeadLetterDrainsAfterRecovery(t *testing.T) {
+	metrics.Init(nil)
+	t.Cleanup(func() { metrics.Init(nil) })
+
+	var down atomic.Bool
+	down.Store(true)
+	webhook := newUsageWebhook(t, func(int) int {
+		if down.Load() {
+			return http.StatusServiceUnavailable
+		}
+		return http.StatusOK
+	})
+
+	file := filepath.Join(t.TempDir(), "dlq", "usage.jsonl")
+	reporter := webhookReporter(webhook.URL, config.UsageWebhookConfig{Retry: 2, InitialWait: time.Millisecond})
+	reporter.DeadLetter = &config.UsageDeadLetterConfig{File: file, DrainInterval: 20 * time.Millisecond}
+	initTestDeadLetter(t, reporter)
+
+	// 端点不可用：重试耗尽后按顺序写入死信队列
+	for _, id := range []string{"req-1", "req-2", "req-3"} {
+		SendUsage(&config.UsageConfig{Enabled: true, Reporters: []*config.UsageReporter{reporter}}, &UsageRecord{RequestID: id})
+	}
+	if got := spilledIDs(t, file); len(got) != 3 || got[0] != "req-1" || got[2] != "req-3" {
+		t.Fatalf("dead letter records = %v, want req-1..req-3", got)
+	}
+	if got := metricValue(t, `llmproxy_usage_spilled_records{reporter="test-webhook"}`); got != "3" {
+		t.Errorf("llmproxy_usage_spilled_records = %q, want 3", got)
+	}
+	failedAttempts := len(webhook.received())
+
+	// 端点恢复后后台任务按原顺序重发并清空队列（文件清空后才更新 gauge，需一并等待）
+	down.Store(false)
+	waitFor(t, "dead letter drain", func() bool {
+		return len(spilledIDs(t, file)) == 0 &&
+			metricValue(t, `llmproxy_usage_spilled_records{reporter="test-webhook"}`) == "0"
+	})
+
+	var drained []string
+	for _, req := range webhook.received()[failedAttempts:] {
+		var usage UsageRecord
+		if err := json.Unmarshal(req.body, &usage); err != nil {
+			t.Fatal(err)
+		}
+		if req.header.Get("Content-Type") != "application/json" {
+			t.Errorf("Content-Type = %q", req.header.Get("Content-Type"))
+		}
+		drained = append(drained, usage.RequestID)
+	}
+	if len(drained) != 3 || drained[0] != "req-1" || drained[1] != "req-2" || drained[2] != "req-3" {
+		t.Errorf("drained records = %v, want req-1, req-2, req-3", drained)
+	}
+}
+
+func TestUsageDeadLetterCap(t *testing.T) {
+	metrics.Init(nil)
+	t.Cleanup(func() { metrics.Init(nil) })
+
+	webhook := newUsageWebhook(t, func(int) int { return http.StatusBadGateway })
+	file := filepath.Join(t.TempDir(), "usage.jsonl")
+	reporter := webhookReporter(webhook.URL, config.UsageWebhookConfig{Retry: 1})
+	reporter.DeadLetter = &config.UsageDeadLetterConfig{File: file, MaxRecords: 2, DrainInterval: time.Hour}
+	initTestDeadLetter(t, reporter)
+
+	// 超出容量的新记录被丢弃，已有记录保留
+	for _, id := range []string{"req-1", "req-2", "req-3"} {
+		sendUsageToWebhook(reporter, &UsageRecord{RequestID: id})
+	}
+	if got := spilledIDs(t, file); len(got) != 2 || got[0] != "req-1" || got[1] != "req-2" {
+		t.Errorf("dead letter records = %v, want req-1, req-2", got)
+	}
+}
+
+func TestUsageDeadLetterSkipsNonRetryable(t *testing.T) {
+	metrics.Init(nil)
+	t.Cleanup(func() { metrics.Init(nil) })
+
+	webhook := newUsageWebhook(t, func(int) int { return http.StatusBadRequest })
+	file := filepath.Join(t.TempDir(), "usage.jsonl")
+	reporter := webhookReporter(webhook.URL, config.UsageWebhookConfig{Retry: 3})
+	reporter.DeadLetter = &config.UsageDeadLetterConfig{File: file, DrainInterval: time.Hour}
+	initTestDeadLetter(t, reporter)
+
+	// 4xx 重发也不会成功，不写入死信队列
+	sendUsageToWebhook(reporter, &UsageRecord{RequestID: "req-1"})
+	if got := spilledIDs(t, file); len(got) != 0 {
+		t.Errorf("dead letter records = %v, want none", got)
+	}
+}
+
+func TestUsageDeadLetterSurvivesRestart(t *testing.T) {
+	metrics.Init(nil)
+	t.Cleanup(func() { metrics.Init(nil) })
+
+	// 上次运行留下的死信记录在启动后重发，端点拒绝的记录被丢弃而不阻塞队列
+	file := filepath.Join(t.TempDir(), "usage.jsonl")
+	if err := appendSpill(file, []*UsageRecord{{RequestID: "bad"}, {RequestID: "good"}}); err != nil {
+		t.Fatal(err)
+	}
+	webhook := newUsageWebhook(t, func(n int) int {
+		if n == 1 {
+			return http.StatusUnprocessableEntity
+		}
+		return http.StatusOK
+	})
+	reporter := webhookReporter(webhook.URL, config.UsageWebhookConfig{})
+	reporter.DeadLetter = &config.UsageDeadLetterConfig{File: file, DrainInterval: 20 * time.Millisecond}
+	initTestDeadLetter(t, reporter)
+
+	waitFor(t, "dead letter drain", func() bool { return len(spilledIDs(t, file)) == 0 })
+	if got := len(webhook.received()); got != 2 {
+		t.Errorf("webhook requests = %d, want 2", got)
+	}
+}
+
+func TestUsageDatabaseSpillReplays(t *testing.T) {
+	metrics.Init(nil)
+	t.Cleanup(func() { metrics.Init(nil) })
+
+	db := newTestLogDB(t)
+	file := filepath.Join(t.TempDir(), "spill.jsonl")
+	const name = "test-usage-db"
+	err := InitUsageDatabaseWithConnection(name, db, "sqlite", &config.UsageDatabaseConfig{
+		Retry:          2,
+		RetryBackoff:   time.Millisecond,
+		SpillFile:      file,
+		ReplayInterval: 20 * time.Millisecond,
+	})
+	if err != nil {
+		t.Fatalf("InitUsageDatabaseWithConnection() error = %v", err)
+	}
+	t.Cleanup(func() {
+		usageDBMutex.Lock()
+		defer usageDBMutex.Unlock()
+		close(usageDBWriters[name].stop)
+		delete(usageDBWriters, name)
+	})
+
+	count := func() int {
+		var n int
+		if err := db.QueryRow(`SELECT COUNT(*) FROM usage_records`).Scan(&n); err != nil {
+			return -1
+		}
+		return n
+	}
+
+	// 表不可用时写入溢出文件
+	if _, err := db.Exec(`DROP TABLE usage_records`); err != nil {
+		t.Fatal(err)
+	}
+	SendUsageToDatabaseByName(name, &UsageRecord{RequestID: "req-1"})
+	SendUsageToDatabaseByName(name, &UsageRecord{RequestID: "req-2"})
+	if got := spilledIDs(t, file); len(got) != 2 {
+		t.Fatalf("spilled records = %v, want 2", got)
+	}
+
+	// 数据库恢复后重放
+	if err := createUsageTable(db, "sqlite", "usage_records"); err != nil {
+		t.Fatal(err)
+	}
+	waitFor(t, "spill replay", func() bool { return count() == 2 })
+	if got := spilledIDs(t, file); len(got) != 0 {
+		t.Errorf("spilled records after replay = %v, want none", got)
+	}
+}
@@ -6,11 +6,15 @@ import (
 	"encoding/json"
 	"io"
 	"log"
+	"math/rand"
 	"net/http"
+	"strconv"
+	"sync"
 	"time"
 
 	"llmproxy/internal/config"
 	"llmproxy/internal/metrics"
+	"llmproxy/internal/utils"
 )
 
 // 全局 Webhook HTTP 客户端（复用连接池）
@@ -35,6 +39,7 @@ type UsageRecord struct {
 
 	// 用量信息（从响应中提取）
 	Usage *UsageInfo `json:"usage,omitempty"` // 用量信息
+	Cost  float64    `json:"cost,omitempty"`  // 按 billing.pricing 计算的费用（未启用计费时为 0）
 
 	// 元数据
 	Method     string `json:"method"`      // HTTP 方法
@@ -42,6 +47,9 @@ type UsageRecord struct {
 	BackendURL string `json:"backend_url"` // 后端 URL
 	StatusCode int    `json:"status_code"` // 响应状态码
 	LatencyMs  int64  `json:"latency_ms"`  // 延迟（毫秒）
+
+	Disconnected bool `json:"disconnected,omitempty"` // 客户端是否在流式响应中途断开
+	Estimated    bool `json:"estimated,omitempty"`    // 用量是否为估算值（流式响应中没有 usage 块）
 }
 
 // UsageInfo 用量信息
@@ -85,6 +93,43 @@ func collectUsage(reqBody []byte, respBody []byte, isStream bool, backendURL, en
 	}
 
 	// 提取用量信息
+	usage, requestID, err := parseUsage(respBody, isStream)
+	if err != nil {
+		log.Printf("解析响应失败: %v", err)
+	}
+
+	// 流式响应中没有任何块带 usage（客户端未请求 include_usage 或上游不支持）：按已收到的数据估算
+	estimated := false
+	if isStream && usage == nil && statusCode >= 200 && statusCode < 300 {
+		usage = estimateStreamUsage(reqBody, respBody)
+		estimated = usage != nil
+	}
+
+	// 构造用量记录
+	return &UsageRecord{
+		RequestID:   requestID,
+		Timestamp:   time.Now(),
+		RequestBody: requestBodyMap,
+		Usage:       usage,
+		Method:      "POST",
+		Path:        endpoint,
+		BackendURL:  backendURL,
+		StatusCode:  statusCode,
+		LatencyMs:   latencyMs,
+		Estimated:   estimated,
+	}
+}
+
+// parseUsage 从响应中提取用量信息和上游请求 ID
+// 参数：
+//   - respBody: 响应体
+//   - isStream: 是否为流式响应
+//
+// 返回：
+//   - *UsageInfo: 用量信息（响应中没有时为 nil）
+//   - string: 上游返回的请求 ID
+//   - error: 非流式响应无法解析时返回错误
+func parseUsage(respBody []byte, isStream bool) (*UsageInfo, string, error) {
 	var usage *UsageInfo
 	var requestID string
 
@@ -92,70 +137,215 @@ func collectUsage(reqBody []byte, respBody []byte, isStream bool, backendURL, en
 	if !isStream {
 		var resp OpenAIResponse
 		if err := json.Unmarshal(respBody, &resp); err != nil {
-			log.Printf("解析响应失败: %v", err)
-		} else {
-			requestID = resp.ID
-			// 检查是否包含 usage 信息
-			if resp.Usage.PromptTokens > 0 || resp.Usage.CompletionTokens > 0 {
-				usage = &UsageInfo{
-					PromptTokens:     resp.Usage.PromptTokens,
-					CompletionTokens: resp.Usage.CompletionTokens,
-					TotalTokens:      resp.Usage.TotalTokens,
-				}
-			}
+			return nil, "", err
 		}
-	} else {
-		// 流式请求：解析 SSE 流中的最后一个 data 块
-		lines := bytes.Split(respBody, []byte("\n"))
-		var lastData []byte
-
-		for _, line := range lines {
-			line = bytes.TrimSpace(line)
-			if bytes.HasPrefix(line, []byte("data: ")) {
-				data := bytes.TrimPrefix(line, []byte("data: "))
-				if !bytes.Equal(data, []byte("[DONE]")) {
-					lastData = data
-				}
+		requestID = resp.ID
+		// 检查是否包含 usage 信息
+		if resp.Usage.PromptTokens > 0 || resp.Usage.CompletionTokens > 0 {
+			usage = &UsageInfo{
+				PromptTokens:     resp.Usage.PromptTokens,
+				CompletionTokens: resp.Usage.CompletionTokens,
+				TotalTokens:      resp.Usage.TotalTokens,
 			}
 		}
+		return usage, requestID, nil
+	}
 
-		if len(lastData) > 0 {
-			var chunk struct {
-				ID    string `json:"id"`
-				Usage *struct {
-					PromptTokens     int `json:"prompt_tokens"`
-					CompletionTokens int `json:"completion_tokens"`
-					TotalTokens      int `json:"total_tokens"`
-				} `json:"usage"`
+	// 流式请求：逐个解析 SSE data 块，取最后一个可解析且包含 usage 的块
+	// （usage 通常在 choices 为空的倒数第二块，部分上游放在 [DONE] 之后或 x_groq.usage 中；
+	// 客户端中途断开时最后一块可能不完整，因此不能只看最后一行）
+	for _, data := range sseDataChunks(respBody) {
+		var chunk struct {
+			ID    string           `json:"id"`
+			Usage *streamUsageInfo `json:"usage"`
+			XGroq *struct {
+				Usage *streamUsageInfo `json:"usage"`
+			} `json:"x_groq"`
+		}
+		if err := json.Unmarshal(data, &chunk); err != nil {
+			continue
+		}
+		if chunk.ID != "" {
+			requestID = chunk.ID
+		}
+		found := chunk.Usage
+		if found == nil && chunk.XGroq != nil {
+			found = chunk.XGroq.Usage
+		}
+		if found != nil && (found.PromptTokens > 0 || found.CompletionTokens > 0) {
+			total := found.TotalTokens
+			if total == 0 {
+				total = found.PromptTokens + found.CompletionTokens
+			}
+			usage = &UsageInfo{
+				PromptTokens:     found.PromptTokens,
+				CompletionTokens: found.CompletionTokens,
+				TotalTokens:      total,
 			}
+		}
+	}
+	return usage, requestID, nil
+}
+
+// streamUsageInfo 流式响应块中的 usage 对象
+type streamUsageInfo struct {
+	PromptTokens     int `json:"prompt_tokens"`
+	CompletionTokens int `json:"completion_tokens"`
+	TotalTokens      int `json:"total_tokens"`
+}
+
+// sseDataChunks 提取 SSE 响应中所有 data 块
+// [DONE] 只是结束标记，跳过后继续扫描（部分上游在其后才发送 usage 块）
+// 参数：
+//   - respBody: SSE 响应体
+//
+// 返回：
+//   - [][]byte: data 块列表
+func sseDataChunks(respBody []byte) [][]byte {
+	var chunks [][]byte
+	for _, line := range bytes.Split(respBody, []byte("\n")) {
+		line = bytes.TrimSpace(line)
+		if !bytes.HasPrefix(line, []byte("data:")) {
+			continue
+		}
+		data := bytes.TrimSpace(bytes.TrimPrefix(line, []byte("data:")))
+		if len(data) == 0 || bytes.Equal(data, []byte("[DONE]")) {
+			continue
+		}
+		chunks = append(chunks, data)
+	}
+	return chunks
+}
 
-			if err := json.Unmarshal(lastData, &chunk); err != nil {
-				log.Printf("解析流式数据失败: %v", err)
-			} else {
-				requestID = chunk.ID
-				if chunk.Usage != nil && (chunk.Usage.PromptTokens > 0 || chunk.Usage.CompletionTokens > 0) {
-					usage = &UsageInfo{
-						PromptTokens:     chunk.Usage.PromptTokens,
-						CompletionTokens: chunk.Usage.CompletionTokens,
-						TotalTokens:      chunk.Usage.TotalTokens,
-					}
-				}
+// estimateStreamUsage 估算流式响应的用量（所有块都没有 usage 时使用）
+// 输出 token 按包含内容的 delta 块计数（每块通常对应 1 个 token），
+// 输入 token 按请求体字符数 / 4 粗略估算
+// 参数：
+//   - reqBody: 请求体
+//   - respBody: 已收到的（可能不完整的）SSE 响应体
+//
+// 返回：
+//   - *UsageInfo: 估算的用量，无法估算时返回 nil
+func estimateStreamUsage(reqBody, respBody []byte) *UsageInfo {
+	completion := 0
+	for _, data := range sseDataChunks(respBody) {
+		var chunk struct {
+			Choices []struct {
+				Delta struct {
+					Content string `json:"content"`
+				} `json:"delta"`
+				Text string `json:"text"`
+			} `json:"choices"`
+		}
+		if err := json.Unmarshal(data, &chunk); err != nil {
+			continue
+		}
+		for _, c := range chunk.Choices {
+			if c.Delta.Content != "" || c.Text != "" {
+				completion++
 			}
 		}
 	}
 
-	// 构造用量记录
-	return &UsageRecord{
-		RequestID:   requestID,
-		Timestamp:   time.Now(),
-		RequestBody: requestBodyMap,
-		Usage:       usage,
-		Method:      "POST",
-		Path:        endpoint,
-		BackendURL:  backendURL,
-		StatusCode:  statusCode,
-		LatencyMs:   latencyMs,
+	prompt := len([]rune(string(reqBody))) / 4
+	if completion == 0 && prompt == 0 {
+		return nil
+	}
+	return &UsageInfo{
+		PromptTokens:     prompt,
+		CompletionTokens: completion,
+		TotalTokens:      prompt + completion,
+	}
+}
+
+// includeStreamUsage 为流式请求附加 stream_options.include_usage=true，让上游在流末尾返回用量
+// 仅在启用用量上报且配置了 usage.include_stream_usage 时生效；
+// 客户端已显式设置 include_usage 时保持不变
+// 参数：
+//   - cfg: 用量上报配置
+//   - path: 请求路径（仅 /v1/chat/completions 和 /v1/completions）
+//   - body: 请求体
+//   - stream: 是否为流式请求
+//
+// 返回：
+//   - []byte: 处理后的请求体（无需修改或解析失败时原样返回）
+func includeStreamUsage(cfg *config.UsageConfig, path string, body []byte, stream bool) []byte {
+	if cfg == nil || !cfg.Enabled || !cfg.IncludeStreamUsage || !stream {
+		return body
 	}
+	if path != "/v1/chat/completions" && path != "/v1/completions" {
+		return body
+	}
+
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(body, &fields); err != nil {
+		return body
+	}
+	options := make(map[string]json.RawMessage)
+	if raw, ok := fields["stream_options"]; ok && string(raw) != "null" {
+		if err := json.Unmarshal(raw, &options); err != nil {
+			return body
+		}
+	}
+	if _, ok := options["include_usage"]; ok {
+		return body
+	}
+	options["include_usage"] = json.RawMessage("true")
+
+	raw, err := json.Marshal(options)
+	if err != nil {
+		return body
+	}
+	fields["stream_options"] = raw
+	rewritten, err := json.Marshal(fields)
+	if err != nil {
+		return body
+	}
+	return rewritten
+}
+
+// readyReporters 已成功初始化的上报器名称（webhook / database）
+var readyReporters = make(map[string]bool)
+
+// skippedReporters 已提示过未初始化的上报器名称（每个只提示一次）
+var skippedReporters = make(map[string]bool)
+var reporterStateMutex sync.Mutex
+
+// markUsageReporterReady 记录上报器已成功初始化
+// 参数：
+//   - name: 上报器名称
+func markUsageReporterReady(name string) {
+	reporterStateMutex.Lock()
+	defer reporterStateMutex.Unlock()
+	readyReporters[name] = true
+	delete(skippedReporters, name)
+}
+
+// usageReporterReady 判断上报器是否已成功初始化
+// 未初始化（如引用的存储连接不存在）时只在第一次跳过时记录警告，避免每个请求刷屏
+// 参数：
+//   - reporter: 上报器配置
+//
+// 返回：
+//   - bool: 是否可以发送
+func usageReporterReady(reporter *config.UsageReporter) bool {
+	var ready bool
+	if reporter.Type == "builtin" {
+		builtinUsageMutex.RLock()
+		ready = builtinUsageStore != nil
+		builtinUsageMutex.RUnlock()
+	}
+
+	reporterStateMutex.Lock()
+	defer reporterStateMutex.Unlock()
+	if ready || readyReporters[reporter.Name] {
+		return true
+	}
+	if !skippedReporters[reporter.Name] {
+		skippedReporters[reporter.Name] = true
+		log.Printf("警告: 用量上报器 [%s] 未成功初始化，将跳过该上报器", reporter.Name)
+	}
+	return false
 }
 
 // SendUsage 发送用量数据到所有配置的上报器
@@ -167,9 +357,15 @@ func SendUsage(cfg *config.UsageConfig, usage *UsageRecord) {
 		return
 	}
 
-	// 遍历所有上报器
+	// 遍历所有上报器（跳过初始化失败的上报器）
 	for _, reporter := range cfg.Reporters {
-		if reporter == nil || !reporter.Enabled {
+		if reporter == nil || !reporter.Enabled || !usageReporterReady(reporter) {
+			continue
+		}
+
+		// 影子上报器独立异步执行，不影响主上报路径
+		if reporter.Shadow {
+			go sendShadowUsage(reporter, usage)
 			continue
 		}
 
@@ -187,6 +383,7 @@ func SendUsage(cfg *config.UsageConfig, usage *UsageRecord) {
 }
 
 // sendUsageToWebhook 发送用量数据到 Webhook
+// 重试耗尽后写入死信队列（如已配置），不可重试的错误直接丢弃
 // 参数：
 //   - reporter: 上报器配置
 //   - usage: 用量记录
@@ -216,52 +413,145 @@ func sendUsageToWebhook(reporter *config.UsageReporter, usage *UsageRecord) {
 		timeout = 3 * time.Second
 	}
 
+	var result webhookAttempt
 	for attempt := 0; attempt < maxRetries; attempt++ {
 		if attempt > 0 {
-			log.Printf("[%s] Webhook 重试 %d/%d", reporter.Name, attempt+1, maxRetries)
-			time.Sleep(time.Duration(attempt) * 100 * time.Millisecond)
+			wait := webhookBackoff(webhook, attempt, result.retryAfter)
+			log.Printf("[%s] Webhook 重试 %d/%d（等待 %v）", reporter.Name, attempt+1, maxRetries, wait)
+			time.Sleep(wait)
 		}
 
-		if sendWebhookOnce(webhook.URL, timeout, data, webhook.Headers) {
+		result = sendWebhookOnce(webhook, timeout, data)
+		if result.ok {
 			metrics.RecordWebhookSuccess()
 			return
 		}
+		if !result.retryable {
+			log.Printf("[%s] Webhook 返回不可重试的错误，放弃发送", reporter.Name)
+			metrics.RecordWebhookFailure()
+			return
+		}
 	}
 
 	log.Printf("[%s] Webhook 发送失败，已重试 %d 次", reporter.Name, maxRetries)
 	metrics.RecordWebhookFailure()
+	deadLetterUsage(reporter.Name, usage)
+}
+
+// webhookBackoff 计算第 attempt 次重试前的等待时间
+// 指数退避：initial_wait * multiplier^(attempt-1)，不超过 max_wait，
+// 实际等待取其一半加上随机的另一半（抖动），避免大量请求在端点恢复时同时重试；
+// 上次响应带有 Retry-After 时按其等待（同样不超过 max_wait）
+// 参数：
+//   - webhook: Webhook 配置
+//   - attempt: 重试次数（从 1 开始）
+//   - retryAfter: 上次响应的 Retry-After（0 表示没有）
+//
+// 返回：
+//   - time.Duration: 等待时间
+func webhookBackoff(webhook *config.UsageWebhookConfig, attempt int, retryAfter time.Duration) time.Duration {
+	initial := webhook.InitialWait
+	if initial <= 0 {
+		initial = 100 * time.Millisecond
+	}
+	maxWait := webhook.MaxWait
+	if maxWait <= 0 {
+		maxWait = 5 * time.Second
+	}
+	multiplier := webhook.Multiplier
+	if multiplier < 1 {
+		multiplier = 2
+	}
+
+	if retryAfter > 0 {
+		return min(retryAfter, maxWait)
+	}
+
+	wait := float64(initial)
+	for i := 1; i < attempt && wait < float64(maxWait); i++ {
+		wait *= multiplier
+	}
+	wait = min(wait, float64(maxWait))
+
+	half := wait / 2
+	return time.Duration(half + rand.Float64()*half)
+}
+
+// webhookAttempt 一次 Webhook 请求的结果
+type webhookAttempt struct {
+	ok         bool          // 是否成功（2xx）
+	retryable  bool          // 失败是否可重试（网络错误、5xx、429）
+	retryAfter time.Duration // 响应中的 Retry-After（没有时为 0）
+}
+
+// sendShadowUsage 发送用量数据到影子上报器
+// 影子上报器用于试运行新的用量接收端：只尝试一次，不重试，
+// 结果只计入 llmproxy_shadow_usage_total，异常不会影响主上报路径
+// 参数：
+//   - reporter: 上报器配置
+//   - usage: 用量记录
+func sendShadowUsage(reporter *config.UsageReporter, usage *UsageRecord) {
+	defer func() {
+		if r := recover(); r != nil {
+			log.Printf("[%s] 影子用量上报异常: %v", reporter.Name, r)
+		}
+	}()
+
+	switch reporter.Type {
+	case "webhook":
+		if reporter.Webhook == nil {
+			return
+		}
+		data, err := json.Marshal(usage)
+		if err != nil {
+			log.Printf("[%s] 序列化用量数据失败: %v", reporter.Name, err)
+			metrics.RecordShadowUsage(reporter.Name, false)
+			return
+		}
+		timeout := reporter.Webhook.Timeout
+		if timeout == 0 {
+			timeout = 3 * time.Second
+		}
+		metrics.RecordShadowUsage(reporter.Name, sendWebhookOnce(reporter.Webhook, timeout, data).ok)
+	case "database":
+		metrics.RecordShadowUsage(reporter.Name, sendUsageToDatabaseOnce(reporter.Name, usage))
+	case "builtin":
+		SendUsageToBuiltin(usage)
+	default:
+		log.Printf("[%s] 未知的用量上报类型: %s", reporter.Name, reporter.Type)
+	}
 }
 
-// sendWebhookOnce 发送一次 Webhook 请求
+// sendWebhookOnce 发送一次 Webhook 请求（配置了 secret 时附带时间戳和签名，每次重试重新签名）
 // 参数：
-//   - url: Webhook URL
+//   - webhook: Webhook 配置
 //   - timeout: 超时时间
 //   - data: 请求体数据
-//   - headers: 自定义请求头
 //
 // 返回：
-//   - bool: 是否成功
-func sendWebhookOnce(url string, timeout time.Duration, data []byte, headers map[string]string) bool {
+//   - webhookAttempt: 请求结果
+func sendWebhookOnce(webhook *config.UsageWebhookConfig, timeout time.Duration, data []byte) webhookAttempt {
 	ctx, cancel := context.WithTimeout(context.Background(), timeout)
 	defer cancel()
 
-	req, err := http.NewRequestWithContext(ctx, "POST", url, bytes.NewReader(data))
+	req, err := http.NewRequestWithContext(ctx, "POST", webhook.URL, bytes.NewReader(data))
 	if err != nil {
 		log.Printf("创建 Webhook 请求失败: %v", err)
-		return false
+		return webhookAttempt{}
 	}
 
 	req.Header.Set("Content-Type", "application/json")
 
 	// 添加自定义请求头
-	for key, value := range headers {
+	for key, value := range webhook.Headers {
 		req.Header.Set(key, value)
 	}
+	utils.SignRequest(req, data, webhook.Secret, webhook.SignatureHeader)
 
 	resp, err := webhookClient.Do(req)
 	if err != nil {
 		log.Printf("Webhook 请求失败: %v", err)
-		return false
+		return webhookAttempt{retryable: true}
 	}
 	defer func() {
 		_ = resp.Body.Close()
@@ -272,8 +562,35 @@ func sendWebhookOnce(url string, timeout time.Duration, data []byte, headers map
 
 	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
 		log.Printf("Webhook 返回错误状态码 %d: %s", resp.StatusCode, string(body))
-		return false
+		return webhookAttempt{
+			retryable:  resp.StatusCode >= 500 || resp.StatusCode == http.StatusTooManyRequests,
+			retryAfter: parseRetryAfter(resp.Header.Get("Retry-After")),
+		}
 	}
 
-	return true
+	return webhookAttempt{ok: true}
+}
+
+// parseRetryAfter 解析 Retry-After 响应头（秒数或 HTTP 日期）
+// 参数：
+//   - value: 响应头的值
+//
+// 返回：
+//   - time.Duration: 等待时间（无法解析或已过期时为 0）
+func parseRetryAfter(value string) time.Duration {
+	if value == "" {
+		return 0
+	}
+	if seconds, err := strconv.Atoi(value); err == nil {
+		if seconds <= 0 {
+			return 0
+		}
+		return time.Duration(seconds) * time.Second
+	}
+	if at, err := http.ParseTime(value); err == nil {
+		if wait := time.Until(at); wait > 0 {
+			return wait
+		}
+	}
+	return 0
 }
@@ -0,0 +1,335 @@
+package proxy
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"llmproxy/internal/config"
+	"llmproxy/internal/metrics"
+)
+
+// webhookRequest Webhook 收到的请求
+type webhookRequest struct {
+	header http.Header
+	body   []byte
+}
+
+// usageWebhook 记录请求并按 status 返回状态码的用量 Webhook
+type usageWebhook struct {
+	*httptest.Server
+	mu       sync.Mutex
+	requests []webhookRequest
+	status   func(n int) int // 第 n 次请求（从 1 开始）的状态码
+}
+
+// newUsageWebhook 启动用量 Webhook（status 为 nil 时始终返回 200）
+func newUsageWebhook(t *testing.T, status func(n int) int) *usageWebhook {
+	t.Helper()
+	w := &usageWebhook{status: status}
+	w.Server = httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		w.mu.Lock()
+		w.requests = append(w.requests, webhookRequest{header: r.Header.Clone(), body: body})
+		n := len(w.requests)
+		w.mu.Unlock()
+		if w.status != nil {
+			rw.WriteHeader(w.status(n))
+		}
+	}))
+	t.Cleanup(w.Close)
+	return w
+}
+
+// received 返回已收到的请求
+func (w *usageWebhook) received() []webhookRequest {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return append([]webhookRequest(nil), w.requests...)
+}
+
+// webhookReporter 创建指向 URL 的 Webhook 上报器
+func webhookReporter(url string, webhook config.UsageWebhookConfig) *config.UsageReporter {
+	webhook.URL = url
+	return &config.UsageReporter{Name: "test-webhook", Type: "webhook", Enabled: true, Webhook: &webhook}
+}
+
+// hmacHex 独立计算 "<timestamp>.<body>" 的 HMAC-SHA256
+func hmacHex(secret, timestamp string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(timestamp + "."))
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+func TestUsageWebhookSignature(t *testing.T) {
+	metrics.Init(nil)
+	t.Cleanup(func() { metrics.Init(nil) })
+
+	tests := []struct {
+		name   string
+		header string // 配置的签名请求头
+		want   string // 实际使用的签名请求头
+	}{
+		{"默认请求头", "", "X-LLMProxy-Signature"},
+		{"自定义请求头", "X-Usage-Signature", "X-Usage-Signature"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			webhook := newUsageWebhook(t, nil)
+			sendUsageToWebhook(webhookReporter(webhook.URL, config.UsageWebhookConfig{
+				Secret:          "usage-secret",
+				SignatureHeader: tt.header,
+			}), &UsageRecord{RequestID: "req-1", UserID: "u1"})
+
+			reqs := webhook.received()
+			if len(reqs) != 1 {
+				t.Fatalf("webhook requests = %d, want 1", len(reqs))
+			}
+			req := reqs[0]
+			timestamp := req.header.Get("X-LLMProxy-Timestamp")
+			unix, err := strconv.ParseInt(timestamp, 10, 64)
+			if err != nil || time.Since(time.Unix(unix, 0)).Abs() > time.Minute {
+				t.Fatalf("X-LLMProxy-Timestamp = %q, want current unix seconds", timestamp)
+			}
+			if got, want := req.header.Get(tt.want), hmacHex("usage-secret", timestamp, req.body); got != want {
+				t.Errorf("%s = %q, want %q", tt.want, got, want)
+			}
+		})
+	}
+}
+
+func TestUsageWebhookUnsignedWithoutSecret(t *testing.T) {
+	metrics.Init(nil)
+	t.Cleanup(func() { metrics.Init(nil) })
+
+	webhook := newUsageWebhook(t, nil)
+	sendUsageToWebhook(webhookReporter(webhook.URL, config.UsageWebhookConfig{
+		Headers: map[string]string{"Authorization": "Bearer ingest"},
+	}), &UsageRecord{RequestID: "req-1"})
+
+	reqs := webhook.received()
+	if len(reqs) != 1 {
+		t.Fatalf("webhook requests = %d, want 1", len(reqs))
+	}
+	// 未配置 secret 时与之前一致：不带签名，自定义请求头照常发送
+	h := reqs[0].header
+	if h.Get("X-LLMProxy-Signature") != "" || h.Get("X-LLMProxy-Timestamp") != "" {
+		t.Errorf("unsigned webhook got signature headers: %v", h)
+	}
+	if h.Get("Authorization") != "Bearer ingest" {
+		t.Errorf("Authorization = %q", h.Get("Authorization"))
+	}
+}
+
+func TestWebhookBackoffSchedule(t *testing.T) {
+	webhook := &config.UsageWebhookConfig{
+		InitialWait: 100 * time.Millisecond,
+		MaxWait:     time.Second,
+		Multiplier:  3,
+	}
+
+	// 100ms、300ms、900ms，之后封顶 1s；抖动后落在 [wait/2, wait]
+	for attempt, want := range map[int]time.Duration{
+		1: 100 * time.Millisecond,
+		2: 300 * time.Millisecond,
+		3: 900 * time.Millisecond,
+		4: time.Second,
+		9: time.Second,
+	} {
+		for i := 0; i < 50; i++ {
+			got := webhookBackoff(webhook, attempt, 0)
+			if got < want/2 || got > want {
+				t.Fatalf("attempt %d: backoff = %v, want within [%v, %v]", attempt, got, want/2, want)
+			}
+		}
+	}
+
+	// Retry-After 优先，但不超过 max_wait
+	if got := webhookBackoff(webhook, 1, 700*time.Millisecond); got != 700*time.Millisecond {
+		t.Errorf("Retry-After 700ms: backoff = %v", got)
+	}
+	if got := webhookBackoff(webhook, 1, time.Minute); got != time.Second {
+		t.Errorf("Retry-After 1m: backoff = %v, want max_wait 1s", got)
+	}
+
+	// 默认值：100ms 起，倍数 2，封顶 5s
+	defaults := &config.UsageWebhookConfig{}
+	for attempt, want := range map[int]time.Duration{1: 100 * time.Millisecond, 2: 200 * time.Millisecond, 10: 5 * time.Second} {
+		if got := webhookBackoff(defaults, attempt, 0); got < want/2 || got > want {
+			t.Errorf("default attempt %d: backoff = %v, want within [%v, %v]", attempt, got, want/2, want)
+		}
+	}
+}
+
+func TestParseRetryAfter(t *testing.T) {
+	tests := []struct {
+		value string
+		want  time.Duration
+	}{
+		{"", 0},
+		{"3", 3 * time.Second},
+		{"0", 0},
+		{"-1", 0},
+		{"soon", 0},
+		{time.Now().Add(-time.Hour).UTC().Format(http.TimeFormat), 0},
+	}
+	for _, tt := range tests {
+		if got := parseRetryAfter(tt.value); got != tt.want {
+			t.Errorf("parseRetryAfter(%q) = %v, want %v", tt.value, got, tt.want)
+		}
+	}
+
+	// HTTP 日期格式
+	if got := parseRetryAfter(time.Now().Add(time.Minute).UTC().Format(http.TimeFormat)); got <= 58*time.Second || got > time.Minute {
+		t.Errorf("parseRetryAfter(date in 1m) = %v", got)
+	}
+}
+
+func TestUsageWebhookRetryByStatus(t *testing.T) {
+	metrics.Init(nil)
+	t.Cleanup(func() { metrics.Init(nil) })
+
+	tests := []struct {
+		name   string
+		status int
+		want   int // 请求次数
+	}{
+		{"400 不重试", http.StatusBadRequest, 1},
+		{"401 不重试", http.StatusUnauthorized, 1},
+		{"500 重试", http.StatusInternalServerError, 3},
+		{"503 重试", http.StatusServiceUnavailable, 3},
+		{"429 重试", http.StatusTooManyRequests, 3},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			webhook := newUsageWebhook(t, func(int) int { return tt.status })
+			sendUsageToWebhook(webhookReporter(webhook.URL, config.UsageWebhookConfig{
+				Retry:       3,
+				InitialWait: time.Millisecond,
+				MaxWait:     5 * time.Millisecond,
+			}), &UsageRecord{RequestID: "req-1"})
+			if got := len(webhook.received()); got != tt.want {
+				t.Errorf("webhook requests = %d, want %d", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestUsageWebhookRetrySucceeds(t *testing.T) {
+	metrics.Init(nil)
+	t.Cleanup(func() { metrics.Init(nil) })
+
+	// 前两次 502，第三次成功
+	webhook := newUsageWebhook(t, func(n int) int {
+		if n < 3 {
+			return http.StatusBadGateway
+		}
+		return http.StatusOK
+	})
+	sendUsageToWebhook(webhookReporter(webhook.URL, config.UsageWebhookConfig{
+		Retry:       5,
+		InitialWait: time.Millisecond,
+	}), &UsageRecord{RequestID: "req-1"})
+	if got := len(webhook.received()); got != 3 {
+		t.Errorf("webhook requests = %d, want 3", got)
+	}
+	if got := metricValue(t, "llmproxy_webhook_success_total"); got != "1" {
+		t.Errorf("llmproxy_webhook_success_total = %q, want 1", got)
+	}
+}
+
+func TestUsageWebhookHonoursRetryAfter(t *testing.T) {
+	metrics.Init(nil)
+	t.Cleanup(func() { metrics.Init(nil) })
+
+	var mu sync.Mutex
+	var times []time.Time
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		times = append(times, time.Now())
+		n := len(times)
+		mu.Unlock()
+		if n == 1 {
+			w.Header().Set("Retry-After", "1")
+			w.WriteHeader(http.StatusTooManyRequests)
+		}
+	}))
+	t.Cleanup(server.Close)
+
+	sendUsageToWebhook(webhookReporter(server.URL, config.UsageWebhookConfig{
+		Retry:       2,
+		InitialWait: time.Millisecond,
+		MaxWait:     10 * time.Second,
+	}), &UsageRecord{RequestID: "req-1"})
+
+	mu.Lock()
+	defer mu.Unlock()
+	if len(times) != 2 {
+		t.Fatalf("webhook requests = %d, want 2", len(times))
+	}
+	if gap := times[1].Sub(times[0]); gap < 900*time.Millisecond {
+		t.Errorf("retry after %v, want about 1s from Retry-After", gap)
+	}
+}
+
+// captureLog 在测试期间捕获标准日志输出
+func captureLog(t *testing.T) *bytes.Buffer {
+	t.Helper()
+	var buf bytes.Buffer
+	log.SetOutput(&buf)
+	t.Cleanup(func() { log.SetOutput(os.Stderr) })
+	return &buf
+}
+
+func TestSendUsageSkipsUninitializedReporters(t *testing.T) {
+	metrics.Init(nil)
+	t.Cleanup(func() { metrics.Init(nil) })
+
+	// 未调用 InitUsageWebhook 的 Webhook 上报器和引用了不存在存储的数据库上报器
+	webhook := newUsageWebhook(t, nil)
+	hook := webhookReporter(webhook.URL, config.UsageWebhookConfig{})
+	hook.Name = "uninitialized-webhook"
+	db := &config.UsageReporter{Name: "uninitialized-db", Type: "database", Enabled: true}
+	cfg := &config.UsageConfig{Enabled: true, Reporters: []*config.UsageReporter{hook, db}}
+
+	logs := captureLog(t)
+	for i := 0; i < 100; i++ {
+		SendUsage(cfg, &UsageRecord{RequestID: fmt.Sprintf("req-%d", i)})
+	}
+
+	// 每个上报器只警告一次，不再逐请求记录“未初始化”
+	out := logs.String()
+	for _, name := range []string{hook.Name, db.Name} {
+		if n := strings.Count(out, "用量上报器 ["+name+"] 未成功初始化"); n != 1 {
+			t.Errorf("warnings for %s = %d, want 1", name, n)
+		}
+	}
+	if strings.Contains(out, "用量数据库未初始化") {
+		t.Errorf("per-request database warning logged:\n%s", out)
+	}
+	if got := len(webhook.received()); got != 0 {
+		t.Errorf("uninitialized webhook received %d requests", got)
+	}
+
+	// 初始化成功后开始发送
+	if err := InitUsageWebhook(hook); err != nil {
+		t.Fatal(err)
+	}
+	SendUsage(cfg, &UsageRecord{RequestID: "req-ready"})
+	if got := len(webhook.received()); got != 1 {
+		t.Errorf("initialized webhook received %d requests, want 1", got)
+	}
+}
@@ -0,0 +1,179 @@
+package proxy
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"sync"
+
+	"llmproxy/internal/metrics"
+)
+
+// defaultSpillMax 溢出文件默认最多保留的记录数
+const defaultSpillMax = 100000
+
+// spillQueue 基于本地文件的用量记录队列（JSON Lines）
+// 用于数据库溢出文件和 Webhook 死信队列：发送失败的记录追加到文件，后台任务按顺序重放
+type spillQueue struct {
+	name  string // 上报器名称（用于日志和指标）
+	path  string // 文件路径
+	max   int    // 最多保留的记录数
+	mu    sync.Mutex
+	count int // 当前文件中的记录数
+}
+
+// newSpillQueue 创建溢出队列（文件中已有的记录会保留并计数）
+// 参数：
+//   - name: 上报器名称
+//   - path: 文件路径
+//   - max: 最多保留的记录数（<= 0 时使用默认值 100000）
+//
+// 返回：
+//   - *spillQueue: 溢出队列
+//   - error: 错误信息
+func newSpillQueue(name, path string, max int) (*spillQueue, error) {
+	if max <= 0 {
+		max = defaultSpillMax
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return nil, fmt.Errorf("创建溢出文件目录失败: %w", err)
+	}
+	records, err := readSpill(path)
+	if err != nil {
+		return nil, err
+	}
+	q := &spillQueue{name: name, path: path, max: max, count: len(records)}
+	metrics.SetUsageSpilled(name, q.count)
+	return q, nil
+}
+
+// push 追加记录，超出容量的记录被丢弃
+// 参数：
+//   - records: 用量记录
+//
+// 返回：
+//   - int: 因队列已满被丢弃的记录数
+//   - error: 写入失败时返回错误（此时没有记录被写入）
+func (q *spillQueue) push(records []*UsageRecord) (int, error) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	dropped := 0
+	if free := q.max - q.count; len(records) > free {
+		dropped = len(records) - max(free, 0)
+		records = records[:len(records)-dropped]
+	}
+	if len(records) == 0 {
+		return dropped, nil
+	}
+	if err := appendSpill(q.path, records); err != nil {
+		return dropped, err
+	}
+	q.count += len(records)
+	metrics.SetUsageSpilled(q.name, q.count)
+	return dropped, nil
+}
+
+// replay 按顺序重放队列中的记录
+// 遇到写入失败即停止，未写入的记录保留在文件中等待下次重放
+// 参数：
+//   - write: 写入单条记录的函数
+//
+// 返回：
+//   - int: 成功重放的记录数
+//   - error: 错误信息
+func (q *spillQueue) replay(write func(*UsageRecord) error) (int, error) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	records, err := readSpill(q.path)
+	if err != nil || len(records) == 0 {
+		return 0, err
+	}
+
+	replayed := 0
+	for _, r := range records {
+		if err := write(r); err != nil {
+			break
+		}
+		replayed++
+	}
+	if replayed == 0 {
+		return 0, nil
+	}
+
+	// 用剩余记录重写溢出文件
+	remaining := records[replayed:]
+	tmp := q.path + ".tmp"
+	_ = os.Remove(tmp)
+	if len(remaining) > 0 {
+		if err := appendSpill(tmp, remaining); err != nil {
+			return replayed, err
+		}
+		if err := os.Rename(tmp, q.path); err != nil {
+			return replayed, fmt.Errorf("替换溢出文件失败: %w", err)
+		}
+	} else if err := os.Remove(q.path); err != nil {
+		return replayed, fmt.Errorf("删除溢出文件失败: %w", err)
+	}
+	q.count = len(remaining)
+	metrics.SetUsageSpilled(q.name, q.count)
+	return replayed, nil
+}
+
+// appendSpill 追加记录到溢出文件（调用方需持有锁）
+func appendSpill(path string, records []*UsageRecord) error {
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0600)
+	if err != nil {
+		return fmt.Errorf("打开溢出文件失败: %w", err)
+	}
+	defer func() {
+		_ = f.Close()
+	}()
+
+	enc := json.NewEncoder(f)
+	for _, r := range records {
+		if err := enc.Encode(r); err != nil {
+			return fmt.Errorf("写入溢出文件失败: %w", err)
+		}
+	}
+	return f.Sync()
+}
+
+// readSpill 读取溢出文件中的全部记录（文件不存在时返回空）
+func readSpill(path string) ([]*UsageRecord, error) {
+	f, err := os.Open(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("打开溢出文件失败: %w", err)
+	}
+	defer func() {
+		_ = f.Close()
+	}()
+
+	var records []*UsageRecord
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 64*1024), 16<<20)
+	for scanner.Scan() {
+		line := scanner.Bytes()
+		if len(line) == 0 {
+			continue
+		}
+		var r UsageRecord
+		if err := json.Unmarshal(line, &r); err != nil {
+			log.Printf("跳过无法解析的溢出记录: %v", err)
+			continue
+		}
+		records = append(records, &r)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("读取溢出文件失败: %w", err)
+	}
+	return records, nil
+}
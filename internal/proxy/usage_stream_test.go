@@ -0,0 +1,381 @@
+package proxy
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+
+	"llmproxy/internal/auth"
+	"llmproxy/internal/billing"
+	"llmproxy/internal/config"
+	"llmproxy/internal/lb"
+	"llmproxy/internal/metrics"
+)
+
+func TestParseStreamUsageTranscripts(t *testing.T) {
+	tests := []struct {
+		name   string
+		sse    string
+		want   *UsageInfo
+		wantID string
+	}{
+		{
+			// OpenAI：include_usage 时 usage 在 choices 为空的倒数第二块，之前各块 usage 为 null
+			name: "OpenAI include_usage",
+			sse: `data: {"id":"chatcmpl-1","object":"chat.completion.chunk","choices":[{"index":0,"delta":{"role":"assistant","content":""}}],"usage":null}
+
+data: {"id":"chatcmpl-1","object":"chat.completion.chunk","choices":[{"index":0,"delta":{"content":"Hi"}}],"usage":null}
+
+data: {"id":"chatcmpl-1","object":"chat.completion.chunk","choices":[{"index":0,"delta":{},"finish_reason":"stop"}],"usage":null}
+
+data: {"id":"chatcmpl-1","object":"chat.completion.chunk","choices":[],"usage":{"prompt_tokens":12,"completion_tokens":3,"total_tokens":15}}
+
+data: [DONE]
+
+`,
+			want:   &UsageInfo{PromptTokens: 12, CompletionTokens: 3, TotalTokens: 15},
+			wantID: "chatcmpl-1",
+		},
+		{
+			// 部分兼容实现在 [DONE] 之后才发送 usage 块
+			name: "usage after DONE",
+			sse: `data: {"id":"gen-2","choices":[{"delta":{"content":"Hello"}}]}
+
+data: [DONE]
+
+data: {"id":"gen-2","choices":[],"usage":{"prompt_tokens":8,"completion_tokens":1,"total_tokens":9}}
+
+`,
+			want:   &UsageInfo{PromptTokens: 8, CompletionTokens: 1, TotalTokens: 9},
+			wantID: "gen-2",
+		},
+		{
+			// vLLM continuous_usage_stats：每块都带累计 usage，取最后一个
+			name: "cumulative usage in every chunk",
+			sse: `data: {"id":"cmpl-3","choices":[{"delta":{"content":"a"}}],"usage":{"prompt_tokens":5,"completion_tokens":1,"total_tokens":6}}
+
+data: {"id":"cmpl-3","choices":[{"delta":{"content":"b"}}],"usage":{"prompt_tokens":5,"completion_tokens":2,"total_tokens":7}}
+
+data: {"id":"cmpl-3","choices":[{"delta":{},"finish_reason":"stop"}],"usage":{"prompt_tokens":5,"completion_tokens":2,"total_tokens":7}}
+
+data: [DONE]
+`,
+			want:   &UsageInfo{PromptTokens: 5, CompletionTokens: 2, TotalTokens: 7},
+			wantID: "cmpl-3",
+		},
+		{
+			// Groq：usage 在最后一块的 x_groq 中
+			name: "Groq x_groq.usage",
+			sse: `data: {"id":"chatcmpl-g","choices":[{"delta":{"content":"ok"}}],"x_groq":{"id":"req_1"}}
+
+data: {"id":"chatcmpl-g","choices":[{"delta":{},"finish_reason":"stop"}],"x_groq":{"id":"req_1","usage":{"prompt_tokens":20,"completion_tokens":4,"total_tokens":24}}}
+
+data: [DONE]
+`,
+			want:   &UsageInfo{PromptTokens: 20, CompletionTokens: 4, TotalTokens: 24},
+			wantID: "chatcmpl-g",
+		},
+		{
+			// CRLF 换行、data: 后无空格、缺少 total_tokens、中间夹杂注释和 event 行
+			name: "CRLF without total",
+			sse: ": keep-alive\r\nevent: message\r\ndata:{\"id\":\"x-5\",\"choices\":[{\"delta\":{\"content\":\"z\"}}]}\r\n\r\n" +
+				"data:{\"id\":\"x-5\",\"choices\":[],\"usage\":{\"prompt_tokens\":7,\"completion_tokens\":2}}\r\n\r\ndata:[DONE]\r\n\r\n",
+			want:   &UsageInfo{PromptTokens: 7, CompletionTokens: 2, TotalTokens: 9},
+			wantID: "x-5",
+		},
+		{
+			// 客户端中途断开：最后一块被截断，之前的 usage 仍然有效
+			name: "truncated final chunk",
+			sse: `data: {"id":"chatcmpl-6","choices":[],"usage":{"prompt_tokens":3,"completion_tokens":2,"total_tokens":5}}
+
+data: {"id":"chatcmpl-6","choices":[{"delta":{"cont`,
+			want:   &UsageInfo{PromptTokens: 3, CompletionTokens: 2, TotalTokens: 5},
+			wantID: "chatcmpl-6",
+		},
+		{
+			// 未请求 include_usage：没有任何块带 usage
+			name: "no usage",
+			sse: `data: {"id":"chatcmpl-7","choices":[{"delta":{"content":"Hi"}}]}
+
+data: [DONE]
+`,
+			wantID: "chatcmpl-7",
+		},
+		{
+			name: "only DONE",
+			sse:  "data: [DONE]\n\n",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			usage, id, err := parseUsage([]byte(tt.sse), true)
+			if err != nil {
+				t.Fatalf("parseUsage() error = %v", err)
+			}
+			if id != tt.wantID {
+				t.Errorf("request id = %q, want %q", id, tt.wantID)
+			}
+			switch {
+			case tt.want == nil && usage != nil:
+				t.Errorf("usage = %+v, want nil", usage)
+			case tt.want != nil && (usage == nil || *usage != *tt.want):
+				t.Errorf("usage = %+v, want %+v", usage, tt.want)
+			}
+		})
+	}
+}
+
+func TestCollectUsageEstimatesStreamWithoutUsage(t *testing.T) {
+	req := []byte(`{"model":"gpt-4","stream":true,"messages":[{"role":"user","content":"hi"}]}`)
+	sse := []byte("data: {\"id\":\"c\",\"choices\":[{\"delta\":{\"content\":\"a\"}}]}\n\n" +
+		"data: {\"id\":\"c\",\"choices\":[{\"delta\":{\"content\":\"b\"}}]}\n\ndata: [DONE]\n\n")
+
+	record := collectUsage(req, sse, true, "http://upstream", "/v1/chat/completions", http.StatusOK, 10)
+	if record.Usage == nil || !record.Estimated {
+		t.Fatalf("usage = %+v, estimated = %v; want an estimate", record.Usage, record.Estimated)
+	}
+	if record.Usage.CompletionTokens != 2 || record.Usage.PromptTokens != len(req)/4 {
+		t.Errorf("estimated usage = %+v", record.Usage)
+	}
+
+	// 上游返回了 usage 时不估算
+	withUsage := append(sse, []byte(`data: {"id":"c","choices":[],"usage":{"prompt_tokens":9,"completion_tokens":2,"total_tokens":11}}`+"\n\n")...)
+	record = collectUsage(req, withUsage, true, "http://upstream", "/v1/chat/completions", http.StatusOK, 10)
+	if record.Estimated || record.Usage == nil || record.Usage.TotalTokens != 11 {
+		t.Errorf("usage = %+v, estimated = %v; want reported usage", record.Usage, record.Estimated)
+	}
+}
+
+func TestIncludeStreamUsage(t *testing.T) {
+	enabled := &config.UsageConfig{Enabled: true, IncludeStreamUsage: true}
+	tests := []struct {
+		name   string
+		cfg    *config.UsageConfig
+		path   string
+		body   string
+		stream bool
+		want   string // 期望的 stream_options（空表示请求体不变）
+	}{
+		{"附加 include_usage", enabled, "/v1/chat/completions", `{"model":"m","stream":true}`, true, `{"include_usage":true}`},
+		{"保留其他选项", enabled, "/v1/completions", `{"stream":true,"stream_options":{"foo":1}}`, true, `{"foo":1,"include_usage":true}`},
+		{"stream_options 为 null", enabled, "/v1/chat/completions", `{"stream":true,"stream_options":null}`, true, `{"include_usage":true}`},
+		{"客户端显式关闭", enabled, "/v1/chat/completions", `{"stream":true,"stream_options":{"include_usage":false}}`, true, ""},
+		{"非流式", enabled, "/v1/chat/completions", `{"model":"m"}`, false, ""},
+		{"其他端点", enabled, "/v1/embeddings", `{"stream":true}`, true, ""},
+		{"未启用", &config.UsageConfig{Enabled: true}, "/v1/chat/completions", `{"stream":true}`, true, ""},
+		{"用量上报关闭", &config.UsageConfig{IncludeStreamUsage: true}, "/v1/chat/completions", `{"stream":true}`, true, ""},
+		{"无效 JSON", enabled, "/v1/chat/completions", `{"stream":`, true, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := includeStreamUsage(tt.cfg, tt.path, []byte(tt.body), tt.stream)
+			if tt.want == "" {
+				if string(got) != tt.body {
+					t.Errorf("body = %s, want unchanged", got)
+				}
+				return
+			}
+			var fields map[string]json.RawMessage
+			if err := json.Unmarshal(got, &fields); err != nil {
+				t.Fatalf("invalid body %s: %v", got, err)
+			}
+			if string(fields["stream_options"]) != tt.want {
+				t.Errorf("stream_options = %s, want %s", fields["stream_options"], tt.want)
+			}
+		})
+	}
+}
+
+func TestProxyInjectsIncludeUsage(t *testing.T) {
+	received := make(chan string, 1)
+	upstream := newTestUpstream(t, func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		received <- string(body)
+		w.Header().Set("Content-Type", "text/event-stream")
+		_, _ = io.WriteString(w, "data: [DONE]\n\n")
+	})
+	h := newTestProxy(t, &config.Config{Usage: &config.UsageConfig{Enabled: true, IncludeStreamUsage: true}}, upstream)
+
+	rec := postProxy(h, "/v1/chat/completions", `{"model":"gpt-4","stream":true,"messages":[]}`, nil)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status = %d, body = %s", rec.Code, rec.Body)
+	}
+	if body := <-received; !strings.Contains(body, `"stream_options":{"include_usage":true}`) {
+		t.Errorf("upstream body = %s, want stream_options.include_usage", body)
+	}
+}
+
+// billedStream 带额度和计费的代理（请求携带 streamAuth），用量上报到 Webhook
+type billedStream struct {
+	handler http.Handler
+	store   auth.KeyStore
+	spend   *billing.SpendTracker
+	webhook *usageWebhook
+}
+
+// streamAuth 使用 sk-stream 的请求头
+var streamAuth = http.Header{"Authorization": {"Bearer sk-stream"}}
+
+// newBilledStream 创建转发到 upstream 的带额度和计费的代理
+func newBilledStream(t *testing.T, upstream *httptest.Server) *billedStream {
+	t.Helper()
+	metrics.Init(nil)
+	t.Cleanup(func() { metrics.Init(nil) })
+
+	webhook := newUsageWebhook(t, nil)
+	reporter := webhookReporter(webhook.URL, config.UsageWebhookConfig{})
+	if err := InitUsageWebhook(reporter); err != nil {
+		t.Fatal(err)
+	}
+	spend, err := billing.NewSpendTracker(&config.BillingConfig{Enabled: true, Pricing: []*config.ModelPrice{
+		{Model: "gpt-4o", Prompt: 0.005, Completion: 0.015},
+	}}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cfg := &config.Config{
+		Backends: []*config.Backend{{Name: "upstream", URL: upstream.URL, Weight: 1}},
+		Usage:    &config.UsageConfig{Enabled: true, Reporters: []*config.UsageReporter{reporter}},
+	}
+	store := auth.NewFileKeyStore([]*auth.APIKey{{Key: "sk-stream", Status: "active", TotalQuota: 100000}})
+	proxy := NewHandlerWithOptions(&HandlerOptions{
+		Config:       cfg,
+		LoadBalancer: lb.NewRoundRobin(cfg.Backends, nil),
+		KeyStore:     store,
+		Spend:        spend,
+	})
+	return &billedStream{handler: proxy, store: store, spend: spend, webhook: webhook}
+}
+
+// record 等待第 n 条用量记录（从 1 开始）
+func (b *billedStream) record(t *testing.T, n int) UsageRecord {
+	t.Helper()
+	waitFor(t, "usage webhook", func() bool { return len(b.webhook.received()) >= n })
+	var record UsageRecord
+	if err := json.Unmarshal(b.webhook.received()[n-1].body, &record); err != nil {
+		t.Fatal(err)
+	}
+	return record
+}
+
+// billed 返回 sk-stream 已扣减的额度和当日消费
+func (b *billedStream) billed(t *testing.T) (int64, float64) {
+	t.Helper()
+	key, err := b.store.Get("sk-stream")
+	if err != nil || key == nil {
+		t.Fatalf("Get() = %v, %v", key, err)
+	}
+	spent, err := b.spend.Spent("sk-stream")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return key.UsedQuota, spent
+}
+
+func TestEstimatedStreamUsageNotBilled(t *testing.T) {
+	const content = "data: {\"id\":\"c\",\"choices\":[{\"delta\":{\"content\":\"a\"}}]}\n\n"
+	const usage = "data: {\"id\":\"c\",\"choices\":[],\"usage\":{\"prompt_tokens\":9,\"completion_tokens\":2,\"total_tokens\":11}}\n\n"
+	var withUsage atomic.Bool
+	upstream := newTestUpstream(t, func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/event-stream")
+		_, _ = io.WriteString(w, content)
+		if withUsage.Load() {
+			_, _ = io.WriteString(w, usage)
+		}
+		_, _ = io.WriteString(w, "data: [DONE]\n\n")
+	})
+	b := newBilledStream(t, upstream)
+	const body = `{"model":"gpt-4o","stream":true,"messages":[{"role":"user","content":"hi"}]}`
+
+	// 上游没有返回 usage：上报估算值，但不扣减额度、不计入当日消费
+	if rec := postProxy(b.handler, "/v1/chat/completions", body, streamAuth); rec.Code != http.StatusOK {
+		t.Fatalf("status = %d, body = %s", rec.Code, rec.Body)
+	}
+	record := b.record(t, 1)
+	if !record.Estimated || record.Usage == nil || record.Usage.CompletionTokens != 1 || record.Cost <= 0 {
+		t.Errorf("estimated record: usage = %+v, estimated = %v, cost = %v", record.Usage, record.Estimated, record.Cost)
+	}
+	if used, spent := b.billed(t); used != 0 || spent != 0 {
+		t.Errorf("after estimated usage: used quota = %d, spent = %v; want 0, 0", used, spent)
+	}
+
+	// 上游返回了 usage：按实际用量扣减和计费
+	withUsage.Store(true)
+	if rec := postProxy(b.handler, "/v1/chat/completions", body, streamAuth); rec.Code != http.StatusOK {
+		t.Fatalf("status = %d, body = %s", rec.Code, rec.Body)
+	}
+	record = b.record(t, 2)
+	if record.Estimated || record.Usage == nil || record.Usage.TotalTokens != 11 {
+		t.Errorf("reported record: usage = %+v, estimated = %v", record.Usage, record.Estimated)
+	}
+	if used, spent := b.billed(t); used != 11 || spent != record.Cost || spent <= 0 {
+		t.Errorf("after reported usage: used quota = %d, spent = %v; want 11, %v", used, spent, record.Cost)
+	}
+}
+
+func TestStreamClientDisconnectUsage(t *testing.T) {
+	const content = "data: {\"id\":\"c\",\"choices\":[{\"delta\":{\"content\":\"a\"}}]}\n\n"
+	const usage = "data: {\"id\":\"c\",\"choices\":[],\"usage\":{\"prompt_tokens\":4,\"completion_tokens\":3,\"total_tokens\":7}}\n\n"
+	var withUsage atomic.Bool
+	upstream := newTestUpstream(t, func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/event-stream")
+		if withUsage.Load() {
+			// 带累计用量的上游（如 continuous_usage_stats）：断开前已收到 usage
+			_, _ = io.WriteString(w, usage)
+		}
+		_, _ = io.WriteString(w, content)
+		w.(http.Flusher).Flush()
+		<-r.Context().Done() // 保持连接直到代理取消
+	})
+	b := newBilledStream(t, upstream)
+	server := httptest.NewServer(b.handler)
+	t.Cleanup(server.Close)
+
+	// disconnect 读到第一个数据块后断开客户端连接
+	disconnect := func() {
+		t.Helper()
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+		req, err := http.NewRequestWithContext(ctx, http.MethodPost, server.URL+"/v1/chat/completions",
+			strings.NewReader(`{"model":"gpt-4o","stream":true,"messages":[{"role":"user","content":"hi"}]}`))
+		if err != nil {
+			t.Fatal(err)
+		}
+		req.Header = streamAuth.Clone()
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer resp.Body.Close()
+		if _, err := bufio.NewReader(resp.Body).ReadString('\n'); err != nil {
+			t.Fatalf("read first chunk: %v", err)
+		}
+	}
+
+	// 断开前没有 usage：按已收到的数据估算，不计费
+	disconnect()
+	record := b.record(t, 1)
+	if !record.Disconnected || !record.Estimated || record.Usage == nil || record.Usage.CompletionTokens != 1 {
+		t.Errorf("record = usage %+v, disconnected %v, estimated %v; want an estimated disconnect", record.Usage, record.Disconnected, record.Estimated)
+	}
+	if used, spent := b.billed(t); used != 0 || spent != 0 {
+		t.Errorf("after estimated disconnect: used quota = %d, spent = %v; want 0, 0", used, spent)
+	}
+
+	// 断开前已收到 usage：使用上游的用量并计费
+	withUsage.Store(true)
+	disconnect()
+	record = b.record(t, 2)
+	if !record.Disconnected || record.Estimated || record.Usage == nil || record.Usage.TotalTokens != 7 {
+		t.Errorf("record = usage %+v, disconnected %v, estimated %v; want reported usage", record.Usage, record.Disconnected, record.Estimated)
+	}
+	if used, spent := b.billed(t); used != 7 || spent <= 0 {
+		t.Errorf("after reported disconnect: used quota = %d, spent = %v; want 7, > 0", used, spent)
+	}
+}
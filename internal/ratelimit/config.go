@@ -8,3 +8,4 @@ import (
 type RateLimitConfig = config.RateLimitConfig
 type GlobalLimit = config.GlobalLimit
 type KeyLimit = config.KeyLimit
+type ModelLimit = config.ModelLimit
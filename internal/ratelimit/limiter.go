@@ -1,17 +1,22 @@
 package ratelimit
 
 import (
+	"errors"
 	"fmt"
 	"sync"
 	"time"
 )
 
+// ErrNoDefaultLimit 构造限流器时未传入默认限额，无法使用 Allow
+var ErrNoDefaultLimit = errors.New("限流器未配置默认限额")
+
 // RateLimiter 限流器接口
 type RateLimiter interface {
-	// Allow 检查是否允许请求
+	// Allow 按构造时传入的默认限额检查是否允许请求（计 1 次）
+	// 未配置默认限额时返回 ErrNoDefaultLimit；需要按层级（全局 / Key / 模型）限流时使用 AllowN
 	Allow(key string) (bool, error)
 
-	// AllowN 检查是否允许指定数量的 tokens
+	// AllowN 按调用方传入的限额检查是否允许指定数量的 tokens
 	AllowN(key string, maxTokens, rate int64, n int64) (bool, int64, error)
 
 	// Remaining 获取剩余配额
@@ -24,11 +29,45 @@ type RateLimiter interface {
 	DecrementConcurrent(key string) error
 }
 
+// Limit 限流器的默认限额（供 Allow 使用）
+type Limit struct {
+	Rate  int64 // 每秒请求数（0 表示未配置）
+	Burst int64 // 令牌桶容量（默认 Rate 的 2 倍，滑动窗口不使用）
+}
+
+// DefaultLimit 从限流配置推导默认限额：优先使用 per_key，其次 global
+// 参数：
+//   - config: 限流配置
+//
+// 返回：
+//   - Limit: 默认限额（都未启用时为零值）
+func DefaultLimit(config *RateLimitConfig) Limit {
+	if config == nil {
+		return Limit{}
+	}
+	if config.PerKey != nil && config.PerKey.Enabled && config.PerKey.RequestsPerSecond > 0 {
+		return Limit{Rate: int64(config.PerKey.RequestsPerSecond), Burst: int64(config.PerKey.BurstSize)}
+	}
+	if config.Global != nil && config.Global.Enabled && config.Global.RequestsPerSecond > 0 {
+		return Limit{Rate: int64(config.Global.RequestsPerSecond), Burst: int64(config.Global.BurstSize)}
+	}
+	return Limit{}
+}
+
+// burst 令牌桶容量（未配置时为速率的 2 倍，与中间件一致）
+func (l Limit) burst() int64 {
+	if l.Burst > 0 {
+		return l.Burst
+	}
+	return l.Rate * 2
+}
+
 // MemoryRateLimiter 基于内存的限流器（令牌桶算法）
 type MemoryRateLimiter struct {
 	buckets    map[string]*tokenBucket // key -> 令牌桶
 	mu         sync.RWMutex            // 读写锁
 	concurrent map[string]int64        // 并发计数
+	defaults   Limit                   // Allow 使用的默认限额
 }
 
 // tokenBucket 令牌桶
@@ -40,24 +79,31 @@ type tokenBucket struct {
 }
 
 // NewMemoryRateLimiter 创建内存限流器
+// 参数：
+//   - defaults: Allow 使用的默认限额（只使用 AllowN 时可传零值）
+//
 // 返回：
 //   - RateLimiter: 限流器实例
-func NewMemoryRateLimiter() RateLimiter {
+func NewMemoryRateLimiter(defaults Limit) RateLimiter {
 	return &MemoryRateLimiter{
 		buckets:    make(map[string]*tokenBucket),
 		concurrent: make(map[string]int64),
+		defaults:   defaults,
 	}
 }
 
-// Allow 检查是否允许请求（消耗 1 个令牌）
+// Allow 按默认限额检查是否允许请求（消耗 1 个令牌）
 // 参数：
 //   - key: 限流 key
 //
 // 返回：
 //   - bool: 是否允许
-//   - error: 错误信息
+//   - error: 未配置默认限额时返回 ErrNoDefaultLimit
 func (m *MemoryRateLimiter) Allow(key string) (bool, error) {
-	allowed, _, err := m.AllowN(key, 100, 10, 1)
+	if m.defaults.Rate <= 0 {
+		return false, ErrNoDefaultLimit
+	}
+	allowed, _, err := m.AllowN(key, m.defaults.burst(), m.defaults.Rate, 1)
 	return allowed, err
 }
 
@@ -0,0 +1,59 @@
+package ratelimit
+
+import (
+	"testing"
+)
+
+func TestAllowUsesConfiguredLimit(t *testing.T) {
+	_, client := newTestRedisClient(t)
+
+	tests := []struct {
+		name    string
+		limiter func(Limit) RateLimiter
+	}{
+		{"内存", NewMemoryRateLimiter},
+		{"Redis", func(l Limit) RateLimiter { return NewRedisRateLimiter(client, "", l) }},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// 未配置 burst 时容量为速率的 2 倍
+			if got := countAllowed(t, tt.limiter(Limit{Rate: 3}), "default-burst", 20); got != 6 {
+				t.Errorf("Rate 3: allowed %d, want 6", got)
+			}
+			if got := countAllowed(t, tt.limiter(Limit{Rate: 3, Burst: 4}), "burst", 20); got != 4 {
+				t.Errorf("Rate 3 Burst 4: allowed %d, want 4", got)
+			}
+			// 不再使用写死的 100 / 10
+			if got := countAllowed(t, tt.limiter(Limit{Rate: 200, Burst: 150}), "large", 150); got != 150 {
+				t.Errorf("Rate 200 Burst 150: allowed %d, want 150", got)
+			}
+		})
+	}
+}
+
+func TestDefaultLimit(t *testing.T) {
+	tests := []struct {
+		name string
+		cfg  *RateLimitConfig
+		want Limit
+	}{
+		{"未配置", nil, Limit{}},
+		{"都未启用", &RateLimitConfig{Global: &GlobalLimit{RequestsPerSecond: 10}}, Limit{}},
+		{"仅 global", &RateLimitConfig{Global: &GlobalLimit{Enabled: true, RequestsPerSecond: 10, BurstSize: 15}}, Limit{Rate: 10, Burst: 15}},
+		{"per_key 优先", &RateLimitConfig{
+			Global: &GlobalLimit{Enabled: true, RequestsPerSecond: 10},
+			PerKey: &KeyLimit{Enabled: true, RequestsPerSecond: 2},
+		}, Limit{Rate: 2}},
+		{"per_key 速率为 0 时使用 global", &RateLimitConfig{
+			Global: &GlobalLimit{Enabled: true, RequestsPerSecond: 10},
+			PerKey: &KeyLimit{Enabled: true},
+		}, Limit{Rate: 10}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := DefaultLimit(tt.cfg); got != tt.want {
+				t.Errorf("DefaultLimit() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
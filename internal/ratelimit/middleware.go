@@ -5,10 +5,17 @@ import (
 	"log"
 	"net/http"
 	"strconv"
+	"time"
 
+	"llmproxy/internal/types"
 	"llmproxy/internal/utils"
 )
 
+// DenialLogger 拒绝请求的访问日志接口（由 proxy.Logger 实现）
+type DenialLogger interface {
+	LogDenied(r *http.Request, apiKey string, statusCode int, reason string, latency time.Duration)
+}
+
 // Middleware 限流中间件
 // 参数：
 //   - limiter: 限流器
@@ -18,7 +25,27 @@ import (
 // 返回：
 //   - http.HandlerFunc: HTTP 处理函数
 func Middleware(limiter RateLimiter, config *RateLimitConfig, next http.HandlerFunc) http.HandlerFunc {
+	return MiddlewareWithDenialLog(limiter, config, nil, next)
+}
+
+// MiddlewareWithDenialLog 限流中间件，被限流的请求写入访问日志
+// 参数：
+//   - limiter: 限流器
+//   - config: 限流配置
+//   - denials: 拒绝请求的访问日志（nil 时不记录）
+//   - next: 下一个处理器
+//
+// 返回：
+//   - http.HandlerFunc: HTTP 处理函数
+func MiddlewareWithDenialLog(limiter RateLimiter, config *RateLimitConfig, denials DenialLogger, next http.HandlerFunc) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
+		startTime := time.Now()
+		logDenied := func(apiKey, reason string) {
+			if denials != nil {
+				denials.LogDenied(r, apiKey, http.StatusTooManyRequests, "ratelimit:"+reason, time.Since(startTime))
+			}
+		}
+
 		// 1. 全局限流
 		if config.Global != nil && config.Global.Enabled {
 			burstSize := config.Global.BurstSize
@@ -40,13 +67,14 @@ func Middleware(limiter RateLimiter, config *RateLimitConfig, next http.HandlerF
 			if err != nil || !allowed {
 				w.Header().Set("Retry-After", "1")
 				log.Println("全局限流: 请求被拒绝")
+				logDenied(requestAPIKey(r), "global")
 				http.Error(w, `{"error":"Global rate limit exceeded"}`, http.StatusTooManyRequests)
 				return
 			}
 		}
 
 		// 2. API Key 级限流
-		apiKey := utils.ExtractAPIKey(r.Header.Get("Authorization"), r.Header.Get("X-API-Key"))
+		apiKey := requestAPIKey(r)
 		if apiKey != "" && config.PerKey != nil && config.PerKey.Enabled {
 			keyLimitKey := fmt.Sprintf("ratelimit:key:%s", apiKey)
 
@@ -70,6 +98,7 @@ func Middleware(limiter RateLimiter, config *RateLimitConfig, next http.HandlerF
 			if err != nil || !allowed {
 				w.Header().Set("Retry-After", "1")
 				log.Printf("Key 级限流: 请求被拒绝, key: %s", utils.MaskKey(apiKey))
+				logDenied(apiKey, "per_key")
 				http.Error(w, `{"error":"Rate limit exceeded"}`, http.StatusTooManyRequests)
 				return
 			}
@@ -83,6 +112,7 @@ func Middleware(limiter RateLimiter, config *RateLimitConfig, next http.HandlerF
 						log.Printf("减少并发计数失败: %v", decErr)
 					}
 					log.Printf("并发数限流: 请求被拒绝, key: %s, concurrent: %d", utils.MaskKey(apiKey), current)
+					logDenied(apiKey, "concurrent")
 					http.Error(w, `{"error":"Concurrent limit exceeded"}`, http.StatusTooManyRequests)
 					return
 				}
@@ -100,3 +130,13 @@ func Middleware(limiter RateLimiter, config *RateLimitConfig, next http.HandlerF
 		next(w, r)
 	}
 }
+
+// requestAPIKey 获取请求的 API Key
+// 经过鉴权管道的请求使用上下文中调用方身份的 Key（与鉴权按同样的 header_names / scheme / query_param 提取），
+// 否则从 Authorization / X-API-Key 请求头提取
+func requestAPIKey(r *http.Request) string {
+	if identity := types.IdentityFromContext(r.Context()); identity != nil {
+		return identity.APIKey
+	}
+	return utils.ExtractAPIKey(r.Header.Get("Authorization"), r.Header.Get("X-API-Key"))
+}
@@ -0,0 +1,82 @@
+package ratelimit
+
+import (
+	"log"
+	"strings"
+)
+
+// MatchModelLimit 查找模型对应的限流规则（按顺序匹配，首个匹配生效）
+// 参数：
+//   - config: 限流配置
+//   - model: 模型名
+//
+// 返回：
+//   - *ModelLimit: 匹配的规则（未匹配时返回 nil）
+func MatchModelLimit(config *RateLimitConfig, model string) *ModelLimit {
+	if config == nil || model == "" {
+		return nil
+	}
+	for i := range config.PerModel {
+		rule := &config.PerModel[i]
+		for _, pattern := range rule.Models {
+			if matchModel(pattern, model) {
+				return rule
+			}
+		}
+	}
+	return nil
+}
+
+// matchModel 模型名匹配（支持 * 后缀通配，如 gpt-4*；单独的 * 匹配所有模型）
+func matchModel(pattern, model string) bool {
+	if strings.HasSuffix(pattern, "*") {
+		return strings.HasPrefix(model, strings.TrimSuffix(pattern, "*"))
+	}
+	return pattern == model
+}
+
+// AllowModel 检查模型级限流（与 API Key 无关，同一规则匹配的所有模型共享额度）
+// 需要在解析请求体得到模型名之后调用，因此由代理处理器而非限流中间件执行
+// 参数：
+//   - limiter: 限流器
+//   - config: 限流配置
+//   - model: 上游模型名
+//
+// 返回：
+//   - bool: 是否允许
+//   - *ModelLimit: 拒绝时为触发的规则（允许时为 nil）
+func AllowModel(limiter RateLimiter, config *RateLimitConfig, model string) (bool, *ModelLimit) {
+	if limiter == nil || config == nil || !config.Enabled {
+		return true, nil
+	}
+	rule := MatchModelLimit(config, model)
+	if rule == nil {
+		return true, nil
+	}
+	key := "model:" + strings.Join(rule.Models, ",")
+
+	if rule.RequestsPerSecond > 0 {
+		burstSize := rule.BurstSize
+		if burstSize <= 0 {
+			burstSize = rule.RequestsPerSecond * 2
+		}
+		allowed, _, err := limiter.AllowN(key, int64(burstSize), int64(rule.RequestsPerSecond), 1)
+		if err != nil || !allowed {
+			log.Printf("模型级限流: 请求被拒绝, model: %s, limit: %d req/s", model, rule.RequestsPerSecond)
+			return false, rule
+		}
+	}
+
+	if rule.RequestsPerMinute > 0 {
+		// 令牌桶速率以每秒整数计：每个请求消耗 60 个令牌，每秒补充 requests_per_minute 个，
+		// 即每分钟恰好补充 requests_per_minute 个请求，桶容量为一分钟的额度
+		rpm := int64(rule.RequestsPerMinute)
+		allowed, _, err := limiter.AllowN(key+":rpm", rpm*60, rpm, 60)
+		if err != nil || !allowed {
+			log.Printf("模型级限流: 请求被拒绝, model: %s, limit: %d req/min", model, rule.RequestsPerMinute)
+			return false, rule
+		}
+	}
+
+	return true, nil
+}
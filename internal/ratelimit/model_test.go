@@ -0,0 +1,113 @@
+package ratelimit
+
+import (
+	"testing"
+)
+
+// testModelConfig 模型级限流配置：gpt-4 系列 2 req/s，claude-3-opus 1 req/s
+func testModelConfig() *RateLimitConfig {
+	return &RateLimitConfig{
+		Enabled: true,
+		PerModel: []ModelLimit{
+			{Models: []string{"gpt-4o-mini"}, RequestsPerSecond: 100},
+			{Models: []string{"gpt-4*"}, RequestsPerSecond: 2, BurstSize: 2},
+			{Models: []string{"claude-3-opus"}, RequestsPerSecond: 1, BurstSize: 1},
+		},
+	}
+}
+
+func TestMatchModelLimit(t *testing.T) {
+	cfg := testModelConfig()
+	tests := []struct {
+		model string
+		want  int // 匹配规则的下标，-1 表示未匹配
+	}{
+		{"gpt-4", 1},
+		{"gpt-4o", 1},
+		{"gpt-4-turbo", 1},
+		{"gpt-4o-mini", 0}, // 按顺序匹配，首个匹配生效
+		{"claude-3-opus", 2},
+		{"claude-3-opus-20240229", -1}, // 无通配时精确匹配
+		{"gpt-3.5-turbo", -1},
+		{"", -1},
+	}
+	for _, tt := range tests {
+		got := MatchModelLimit(cfg, tt.model)
+		var want *ModelLimit
+		if tt.want >= 0 {
+			want = &cfg.PerModel[tt.want]
+		}
+		if got != want {
+			t.Errorf("MatchModelLimit(%q) = %+v, want %+v", tt.model, got, want)
+		}
+	}
+
+	// 单独的 * 匹配所有模型
+	catchAll := &RateLimitConfig{PerModel: []ModelLimit{{Models: []string{"*"}}}}
+	if MatchModelLimit(catchAll, "anything") == nil {
+		t.Error("* did not match")
+	}
+	if MatchModelLimit(nil, "gpt-4") != nil {
+		t.Error("nil config matched")
+	}
+}
+
+func TestAllowModel(t *testing.T) {
+	cfg := testModelConfig()
+	limiter := NewMemoryRateLimiter(Limit{})
+
+	allow := func(model string) bool {
+		ok, _ := AllowModel(limiter, cfg, model)
+		return ok
+	}
+
+	// 通配规则匹配的模型共享额度
+	if !allow("gpt-4") || !allow("gpt-4o") {
+		t.Fatal("requests within the gpt-4* burst denied")
+	}
+	ok, rule := AllowModel(limiter, cfg, "gpt-4-turbo")
+	if ok || rule != &cfg.PerModel[1] {
+		t.Fatalf("third gpt-4* request = %v, %+v; want denied by gpt-4*", ok, rule)
+	}
+
+	// 其他规则和未匹配的模型不受影响
+	if !allow("claude-3-opus") {
+		t.Error("first claude-3-opus request denied")
+	}
+	if allow("claude-3-opus") {
+		t.Error("second claude-3-opus request allowed")
+	}
+	for i := 0; i < 50; i++ {
+		if !allow("gpt-3.5-turbo") {
+			t.Fatalf("unmatched model denied after %d requests", i)
+		}
+	}
+
+	// 未启用限流时不检查
+	disabled := testModelConfig()
+	disabled.Enabled = false
+	if ok, _ := AllowModel(limiter, disabled, "gpt-4"); !ok {
+		t.Error("disabled config denied a request")
+	}
+	if ok, _ := AllowModel(nil, cfg, "gpt-4"); !ok {
+		t.Error("nil limiter denied a request")
+	}
+}
+
+func TestAllowModelPerMinute(t *testing.T) {
+	cfg := &RateLimitConfig{
+		Enabled:  true,
+		PerModel: []ModelLimit{{Models: []string{"o1*"}, RequestsPerMinute: 3}},
+	}
+	limiter := NewMemoryRateLimiter(Limit{})
+
+	// 每分钟额度一次性可用，用完后拒绝
+	for i := 0; i < 3; i++ {
+		if ok, _ := AllowModel(limiter, cfg, "o1-preview"); !ok {
+			t.Fatalf("request %d denied", i+1)
+		}
+	}
+	if ok, rule := AllowModel(limiter, cfg, "o1-mini"); ok || rule == nil {
+		t.Errorf("fourth request = %v, %+v; want denied", ok, rule)
+	}
+}
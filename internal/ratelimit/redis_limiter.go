@@ -2,7 +2,10 @@ package ratelimit
 
 import (
 	"context"
+	"crypto/rand"
+	"encoding/hex"
 	"fmt"
+	"log"
 	"time"
 
 	"github.com/redis/go-redis/v9"
@@ -10,36 +13,42 @@ import (
 
 // RedisRateLimiter 基于 Redis 的分布式限流器（令牌桶算法）
 type RedisRateLimiter struct {
-	client *redis.Client // Redis 客户端
-	prefix string        // Key 前缀
+	client   redis.UniversalClient // Redis 客户端（单节点 / Sentinel / Cluster）
+	prefix   string                // Key 前缀
+	defaults Limit                 // Allow 使用的默认限额
 }
 
 // NewRedisRateLimiter 创建 Redis 限流器
 // 参数：
 //   - client: Redis 客户端
 //   - prefix: Key 前缀（可选，默认 "ratelimit:"）
+//   - defaults: Allow 使用的默认限额（只使用 AllowN 时可传零值）
 //
 // 返回：
 //   - RateLimiter: 限流器实例
-func NewRedisRateLimiter(client *redis.Client, prefix string) RateLimiter {
+func NewRedisRateLimiter(client redis.UniversalClient, prefix string, defaults Limit) RateLimiter {
 	if prefix == "" {
 		prefix = "ratelimit:"
 	}
 	return &RedisRateLimiter{
-		client: client,
-		prefix: prefix,
+		client:   client,
+		prefix:   prefix,
+		defaults: defaults,
 	}
 }
 
-// Allow 检查是否允许请求（消耗 1 个令牌）
+// Allow 按默认限额检查是否允许请求（消耗 1 个令牌）
 // 参数：
 //   - key: 限流 key
 //
 // 返回：
 //   - bool: 是否允许
-//   - error: 错误信息
+//   - error: 未配置默认限额时返回 ErrNoDefaultLimit
 func (r *RedisRateLimiter) Allow(key string) (bool, error) {
-	allowed, _, err := r.AllowN(key, 100, 10, 1)
+	if r.defaults.Rate <= 0 {
+		return false, ErrNoDefaultLimit
+	}
+	allowed, _, err := r.AllowN(key, r.defaults.burst(), r.defaults.Rate, 1)
 	return allowed, err
 }
 
@@ -180,3 +189,98 @@ func (r *RedisRateLimiter) DecrementConcurrent(key string) error {
 
 	return nil
 }
+
+// streamLeaseTTL 流式名额的租约时长，流存续期间每 1/3 租约续约一次
+const streamLeaseTTL = time.Minute
+
+// streamLeaseScript Lua 脚本实现流式名额租约
+// KEYS[1]: 名额 key（有序集合，成员为单个流，分数为租约到期时间）
+// ARGV[1]: max（最大流数量）
+// ARGV[2]: now（当前时间戳，毫秒）
+// ARGV[3]: lease（租约时长，毫秒）
+// ARGV[4]: member（流的唯一标识）
+// 返回：allowed(0/1)
+const streamLeaseScript = `
+local key = KEYS[1]
+local max = tonumber(ARGV[1])
+local now = tonumber(ARGV[2])
+local lease = tonumber(ARGV[3])
+
+redis.call('ZREMRANGEBYSCORE', key, '-inf', now)
+if redis.call('ZCARD', key) >= max then
+    return 0
+end
+
+redis.call('ZADD', key, now + lease, ARGV[4])
+redis.call('PEXPIRE', key, lease)
+return 1
+`
+
+// streamRenewScript Lua 脚本为仍在进行的流续约（成员已被回收时不重新加入）
+// KEYS[1]: 名额 key
+// ARGV[1]: now（当前时间戳，毫秒）
+// ARGV[2]: lease（租约时长，毫秒）
+// ARGV[3]: member（流的唯一标识）
+const streamRenewScript = `
+if redis.call('ZADD', KEYS[1], 'XX', 'CH', tonumber(ARGV[1]) + tonumber(ARGV[2]), ARGV[3]) == 1 then
+    redis.call('PEXPIRE', KEYS[1], ARGV[2])
+end
+return 1
+`
+
+// AcquireStreamLease 占用一个流式名额（实现 StreamLimiter）
+// 名额保存在独立的有序集合中，与请求并发计数互不影响
+// 参数：
+//   - key: 名额 key
+//   - max: 最大流数量
+//
+// 返回：
+//   - func(): 释放函数，停止续约并归还名额
+//   - bool: 是否占用成功
+//   - error: 错误信息
+func (r *RedisRateLimiter) AcquireStreamLease(key string, max int64) (func(), bool, error) {
+	ctx := context.Background()
+	fullKey := r.prefix + key
+
+	var id [8]byte
+	_, _ = rand.Read(id[:])
+	member := hex.EncodeToString(id[:])
+
+	allowed, err := r.client.Eval(ctx, streamLeaseScript, []string{fullKey},
+		max, time.Now().UnixMilli(), streamLeaseTTL.Milliseconds(), member).Int64()
+	if err != nil {
+		return nil, false, fmt.Errorf("redis 流式名额脚本执行失败: %w", err)
+	}
+	if allowed != 1 {
+		return nil, false, nil
+	}
+
+	// 流存续期间定期续约
+	stop := make(chan struct{})
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		ticker := time.NewTicker(streamLeaseTTL / 3)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-stop:
+				return
+			case <-ticker.C:
+				if err := r.client.Eval(ctx, streamRenewScript, []string{fullKey},
+					time.Now().UnixMilli(), streamLeaseTTL.Milliseconds(), member).Err(); err != nil {
+					log.Printf("流式名额续约失败: %v", err)
+				}
+			}
+		}
+	}()
+
+	release := func() {
+		close(stop)
+		<-done
+		if err := r.client.ZRem(ctx, fullKey, member).Err(); err != nil {
+			log.Printf("释放流式名额失败: %v", err)
+		}
+	}
+	return release, true, nil
+}
@@ -0,0 +1,270 @@
+package ratelimit
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// slidingWindow 滑动窗口长度
+// 窗口内的请求数严格不超过 rate，不允许令牌桶那样的突发
+const slidingWindow = time.Second
+
+// MemorySlidingWindowLimiter 基于内存的滑动窗口限流器
+// AllowN 的 rate 为每个窗口（1 秒）允许的最大请求数，maxTokens（突发容量）不生效
+// 并发计数沿用 MemoryRateLimiter
+type MemorySlidingWindowLimiter struct {
+	*MemoryRateLimiter
+	windows map[string]*timestampRing // key -> 窗口内的请求时间戳
+	mu      sync.Mutex
+}
+
+// timestampRing 环形缓冲区，按时间顺序保存窗口内的请求时间戳
+type timestampRing struct {
+	times []time.Time // 容量即窗口内最大请求数
+	head  int         // 最早时间戳的位置
+	count int         // 当前时间戳数量
+}
+
+// NewMemorySlidingWindowLimiter 创建内存滑动窗口限流器
+// 参数：
+//   - defaults: Allow 使用的默认限额（只使用 AllowN 时可传零值，Burst 不生效）
+//
+// 返回：
+//   - RateLimiter: 限流器实例
+func NewMemorySlidingWindowLimiter(defaults Limit) RateLimiter {
+	return &MemorySlidingWindowLimiter{
+		MemoryRateLimiter: NewMemoryRateLimiter(defaults).(*MemoryRateLimiter),
+		windows:           make(map[string]*timestampRing),
+	}
+}
+
+// Allow 按默认限额检查是否允许请求（计 1 次）
+// 参数：
+//   - key: 限流 key
+//
+// 返回：
+//   - bool: 是否允许
+//   - error: 未配置默认限额时返回 ErrNoDefaultLimit
+func (m *MemorySlidingWindowLimiter) Allow(key string) (bool, error) {
+	if m.defaults.Rate <= 0 {
+		return false, ErrNoDefaultLimit
+	}
+	allowed, _, err := m.AllowN(key, 0, m.defaults.Rate, 1)
+	return allowed, err
+}
+
+// AllowN 检查最近一个窗口内的请求数加上 n 是否超过 rate
+// 参数：
+//   - key: 限流 key
+//   - maxTokens: 不使用（滑动窗口没有突发容量）
+//   - rate: 每个窗口允许的最大请求数
+//   - n: 本次计入的请求数
+//
+// 返回：
+//   - bool: 是否允许
+//   - int64: 窗口内剩余请求数
+//   - error: 错误信息
+func (m *MemorySlidingWindowLimiter) AllowN(key string, maxTokens, rate int64, n int64) (bool, int64, error) {
+	if rate <= 0 {
+		return false, 0, nil
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	now := time.Now()
+	ring, ok := m.windows[key]
+	if !ok || int64(len(ring.times)) != rate {
+		// 首次使用或限额变化时重建（限额变化后按新限额重新计数）
+		ring = &timestampRing{times: make([]time.Time, rate)}
+		m.windows[key] = ring
+	}
+	ring.evict(now.Add(-slidingWindow))
+
+	if int64(ring.count)+n > rate {
+		return false, rate - int64(ring.count), nil
+	}
+	for i := int64(0); i < n; i++ {
+		ring.push(now)
+	}
+	return true, rate - int64(ring.count), nil
+}
+
+// Remaining 获取当前窗口内剩余的请求数
+// 参数：
+//   - key: 限流 key
+//
+// 返回：
+//   - int64: 剩余配额
+//   - error: 错误信息
+func (m *MemorySlidingWindowLimiter) Remaining(key string) (int64, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	ring, ok := m.windows[key]
+	if !ok {
+		return 0, fmt.Errorf("key 不存在")
+	}
+	ring.evict(time.Now().Add(-slidingWindow))
+	return int64(len(ring.times) - ring.count), nil
+}
+
+// evict 移除早于 cutoff 的时间戳
+func (r *timestampRing) evict(cutoff time.Time) {
+	for r.count > 0 && !r.times[r.head].After(cutoff) {
+		r.head = (r.head + 1) % len(r.times)
+		r.count--
+	}
+}
+
+// push 追加时间戳（调用方保证未满）
+func (r *timestampRing) push(t time.Time) {
+	r.times[(r.head+r.count)%len(r.times)] = t
+	r.count++
+}
+
+// RedisSlidingWindowLimiter 基于 Redis 有序集合的分布式滑动窗口限流器
+// 语义同 MemorySlidingWindowLimiter，并发计数沿用 RedisRateLimiter
+type RedisSlidingWindowLimiter struct {
+	*RedisRateLimiter
+}
+
+// NewRedisSlidingWindowLimiter 创建 Redis 滑动窗口限流器
+// 参数：
+//   - client: Redis 客户端
+//   - prefix: Key 前缀（可选，默认 "ratelimit:"）
+//   - defaults: Allow 使用的默认限额（只使用 AllowN 时可传零值，Burst 不生效）
+//
+// 返回：
+//   - RateLimiter: 限流器实例
+func NewRedisSlidingWindowLimiter(client redis.UniversalClient, prefix string, defaults Limit) RateLimiter {
+	return &RedisSlidingWindowLimiter{
+		RedisRateLimiter: NewRedisRateLimiter(client, prefix, defaults).(*RedisRateLimiter),
+	}
+}
+
+// slidingWindowScript Lua 脚本实现滑动窗口计数
+// KEYS[1]: 窗口 key（有序集合，成员为单次请求，分数为时间戳）
+// KEYS[2]: 限额 key（供 Remaining 使用）
+// ARGV[1]: limit（窗口内最大请求数）
+// ARGV[2]: window（窗口长度，毫秒）
+// ARGV[3]: now（当前时间戳，毫秒）
+// ARGV[4]: requested（本次计入的请求数）
+// ARGV[5]: member（成员前缀，保证唯一）
+// 返回：allowed(0/1), remaining
+const slidingWindowScript = `
+local key = KEYS[1]
+local limit = tonumber(ARGV[1])
+local window = tonumber(ARGV[2])
+local now = tonumber(ARGV[3])
+local requested = tonumber(ARGV[4])
+
+redis.call('ZREMRANGEBYSCORE', key, '-inf', now - window)
+local count = redis.call('ZCARD', key)
+redis.call('SET', KEYS[2], limit, 'PX', window)
+
+if count + requested > limit then
+    return {0, limit - count}
+end
+
+for i = 1, requested do
+    redis.call('ZADD', key, now, ARGV[5] .. ':' .. i)
+end
+redis.call('PEXPIRE', key, window)
+
+return {1, limit - count - requested}
+`
+
+// Allow 按默认限额检查是否允许请求（计 1 次）
+// 参数：
+//   - key: 限流 key
+//
+// 返回：
+//   - bool: 是否允许
+//   - error: 未配置默认限额时返回 ErrNoDefaultLimit
+func (r *RedisSlidingWindowLimiter) Allow(key string) (bool, error) {
+	if r.defaults.Rate <= 0 {
+		return false, ErrNoDefaultLimit
+	}
+	allowed, _, err := r.AllowN(key, 0, r.defaults.Rate, 1)
+	return allowed, err
+}
+
+// AllowN 检查最近一个窗口内的请求数加上 n 是否超过 rate
+// 参数：
+//   - key: 限流 key
+//   - maxTokens: 不使用（滑动窗口没有突发容量）
+//   - rate: 每个窗口允许的最大请求数
+//   - n: 本次计入的请求数
+//
+// 返回：
+//   - bool: 是否允许
+//   - int64: 窗口内剩余请求数
+//   - error: 错误信息
+func (r *RedisSlidingWindowLimiter) AllowN(key string, maxTokens, rate int64, n int64) (bool, int64, error) {
+	ctx := context.Background()
+	fullKey, limitKey := r.windowKeys(key)
+
+	var id [8]byte
+	_, _ = rand.Read(id[:])
+	member := hex.EncodeToString(id[:])
+
+	result, err := r.client.Eval(ctx, slidingWindowScript, []string{fullKey, limitKey},
+		rate, slidingWindow.Milliseconds(), time.Now().UnixMilli(), n, member).Result()
+	if err != nil {
+		return false, 0, fmt.Errorf("redis 滑动窗口脚本执行失败: %w", err)
+	}
+
+	values, ok := result.([]interface{})
+	if !ok || len(values) != 2 {
+		return false, 0, fmt.Errorf("redis 滑动窗口脚本返回值格式错误")
+	}
+
+	allowed := values[0].(int64) == 1
+	remaining := values[1].(int64)
+
+	return allowed, remaining, nil
+}
+
+// Remaining 获取当前窗口内剩余的请求数（窗口内没有请求时返回 0）
+// 参数：
+//   - key: 限流 key
+//
+// 返回：
+//   - int64: 剩余配额
+//   - error: 错误信息
+func (r *RedisSlidingWindowLimiter) Remaining(key string) (int64, error) {
+	ctx := context.Background()
+	fullKey, limitKey := r.windowKeys(key)
+
+	limit, err := r.client.Get(ctx, limitKey).Int64()
+	if err == redis.Nil {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, fmt.Errorf("获取剩余配额失败: %w", err)
+	}
+
+	cutoff := time.Now().Add(-slidingWindow).UnixMilli()
+	count, err := r.client.ZCount(ctx, fullKey, fmt.Sprintf("(%d", cutoff), "+inf").Result()
+	if err != nil {
+		return 0, fmt.Errorf("获取剩余配额失败: %w", err)
+	}
+	if count > limit {
+		return 0, nil
+	}
+	return limit - count, nil
+}
+
+// windowKeys 生成窗口 key 和限额 key
+// 使用 {} 哈希标签，保证 Cluster 模式下两个 key 位于同一槽位（Lua 脚本要求）
+func (r *RedisSlidingWindowLimiter) windowKeys(key string) (string, string) {
+	base := r.prefix + "window:{" + key + "}"
+	return base, base + ":limit"
+}
@@ -0,0 +1,172 @@
+package ratelimit
+
+import (
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/redis/go-redis/v9"
+)
+
+// newTestRedisClient 启动 miniredis 并返回连接它的客户端
+func newTestRedisClient(t *testing.T) (*miniredis.Miniredis, redis.UniversalClient) {
+	t.Helper()
+	mr := miniredis.RunT(t)
+	client := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+	t.Cleanup(func() { _ = client.Close() })
+	return mr, client
+}
+
+// countAllowed 连续请求 attempts 次，返回被允许的次数
+func countAllowed(t *testing.T, limiter RateLimiter, key string, attempts int) int {
+	t.Helper()
+	allowed := 0
+	for i := 0; i < attempts; i++ {
+		ok, err := limiter.Allow(key)
+		if err != nil {
+			t.Fatalf("Allow() error = %v", err)
+		}
+		if ok {
+			allowed++
+		}
+	}
+	return allowed
+}
+
+func TestBurstTokenBucketVsSlidingWindow(t *testing.T) {
+	_, client := newTestRedisClient(t)
+	limit := Limit{Rate: 5, Burst: 10}
+
+	tests := []struct {
+		name    string
+		limiter RateLimiter
+		want    int
+	}{
+		// 令牌桶允许一次性用完桶容量
+		{"内存令牌桶", NewMemoryRateLimiter(limit), 10},
+		{"Redis 令牌桶", NewRedisRateLimiter(client, "tb:", limit), 10},
+		// 滑动窗口严格限制为每个窗口 rate 次，Burst 不生效
+		{"内存滑动窗口", NewMemorySlidingWindowLimiter(limit), 5},
+		{"Redis 滑动窗口", NewRedisSlidingWindowLimiter(client, "sw:", limit), 5},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := countAllowed(t, tt.limiter, "burst", 20); got != tt.want {
+				t.Errorf("allowed %d of 20 immediate requests, want %d", got, tt.want)
+			}
+			// 不同 key 互不影响
+			if got := countAllowed(t, tt.limiter, "other", 1); got != 1 {
+				t.Error("request for another key denied")
+			}
+		})
+	}
+}
+
+func TestSlidingWindowRecovers(t *testing.T) {
+	_, client := newTestRedisClient(t)
+	limiters := map[string]RateLimiter{
+		"内存":    NewMemorySlidingWindowLimiter(Limit{Rate: 3}),
+		"Redis": NewRedisSlidingWindowLimiter(client, "", Limit{Rate: 3}),
+	}
+	for name, limiter := range limiters {
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+			if got := countAllowed(t, limiter, "k", 5); got != 3 {
+				t.Fatalf("allowed %d, want 3", got)
+			}
+			// 整个窗口过去后恢复
+			time.Sleep(slidingWindow + 50*time.Millisecond)
+			if got := countAllowed(t, limiter, "k", 5); got != 3 {
+				t.Errorf("allowed %d after the window, want 3", got)
+			}
+		})
+	}
+}
+
+func TestMemorySlidingWindowIsStrict(t *testing.T) {
+	limiter := NewMemorySlidingWindowLimiter(Limit{}).(*MemorySlidingWindowLimiter)
+
+	// 窗口前半段 3 次，后半段 2 次
+	if ok, remaining, _ := limiter.AllowN("k", 0, 5, 3); !ok || remaining != 2 {
+		t.Fatalf("AllowN(3) = %v, %d", ok, remaining)
+	}
+	ring := limiter.windows["k"]
+	for i := 0; i < ring.count; i++ {
+		ring.times[i] = ring.times[i].Add(-800 * time.Millisecond)
+	}
+	if ok, remaining, _ := limiter.AllowN("k", 0, 5, 2); !ok || remaining != 0 {
+		t.Fatalf("AllowN(2) = %v, %d", ok, remaining)
+	}
+	if ok, _, _ := limiter.AllowN("k", 0, 5, 1); ok {
+		t.Fatal("request beyond the window limit allowed")
+	}
+
+	// 前 3 次移出窗口后只释放 3 个名额（令牌桶此时会按时间补充）
+	for i := 0; i < ring.count; i++ {
+		idx := (ring.head + i) % len(ring.times)
+		ring.times[idx] = ring.times[idx].Add(-300 * time.Millisecond)
+	}
+	if ok, remaining, _ := limiter.AllowN("k", 0, 5, 3); !ok || remaining != 0 {
+		t.Errorf("AllowN(3) after partial expiry = %v, %d", ok, remaining)
+	}
+	if remaining, err := limiter.Remaining("k"); err != nil || remaining != 0 {
+		t.Errorf("Remaining() = %d, %v", remaining, err)
+	}
+
+	// 一次请求多个名额超过限额时整体拒绝
+	if ok, _, _ := limiter.AllowN("big", 0, 5, 6); ok {
+		t.Error("AllowN(6) with rate 5 allowed")
+	}
+	if remaining, _ := limiter.Remaining("big"); remaining != 5 {
+		t.Errorf("Remaining() after denied AllowN = %d, want 5", remaining)
+	}
+
+	// 限额变化后按新限额重新计数
+	if ok, remaining, _ := limiter.AllowN("k", 0, 8, 1); !ok || remaining != 7 {
+		t.Errorf("AllowN with new rate = %v, %d; want true, 7", ok, remaining)
+	}
+}
+
+func TestRedisSlidingWindowKeys(t *testing.T) {
+	mr, client := newTestRedisClient(t)
+	limiter := NewRedisSlidingWindowLimiter(client, "rl:", Limit{})
+
+	if remaining, err := limiter.Remaining("user"); err != nil || remaining != 0 {
+		t.Errorf("Remaining() before any request = %d, %v", remaining, err)
+	}
+	if ok, remaining, err := limiter.AllowN("user", 0, 4, 3); err != nil || !ok || remaining != 1 {
+		t.Fatalf("AllowN(3) = %v, %d, %v", ok, remaining, err)
+	}
+	if remaining, err := limiter.Remaining("user"); err != nil || remaining != 1 {
+		t.Errorf("Remaining() = %d, %v; want 1", remaining, err)
+	}
+
+	// 窗口 key 和限额 key 使用同一哈希标签（Cluster 要求同槽位）
+	members, err := mr.ZMembers("rl:window:{user}")
+	if err != nil || len(members) != 3 {
+		t.Errorf("window members = %v, %v", members, err)
+	}
+	if limit, err := mr.Get("rl:window:{user}:limit"); err != nil || limit != "4" {
+		t.Errorf("limit key = %q, %v", limit, err)
+	}
+
+	// Redis 不可用时返回错误
+	mr.Close()
+	if _, _, err := limiter.AllowN("user", 0, 4, 1); err == nil {
+		t.Error("AllowN() with redis down: error = nil")
+	}
+}
+
+func TestAllowWithoutDefaultLimit(t *testing.T) {
+	_, client := newTestRedisClient(t)
+	for _, limiter := range []RateLimiter{
+		NewMemoryRateLimiter(Limit{}),
+		NewMemorySlidingWindowLimiter(Limit{}),
+		NewRedisRateLimiter(client, "", Limit{}),
+		NewRedisSlidingWindowLimiter(client, "", Limit{}),
+	} {
+		if _, err := limiter.Allow("k"); err != ErrNoDefaultLimit {
+			t.Errorf("%T.Allow() error = %v, want ErrNoDefaultLimit", limiter, err)
+		}
+	}
+}
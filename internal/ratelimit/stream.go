@@ -0,0 +1,74 @@
+package ratelimit
+
+import (
+	"fmt"
+	"log"
+
+	"llmproxy/internal/utils"
+)
+
+// StreamLimiter 按租约记录流式连接的限流器（可选接口，Redis 限流器实现）
+// 每个流占用一个带到期时间的名额，流存续期间定期续约：长连接不会因计数 Key 过期而丢失名额，
+// 实例崩溃后未释放的名额在租约到期后自动回收
+type StreamLimiter interface {
+	// AcquireStreamLease 在 key 的流数量小于 max 时占用一个名额，返回的释放函数在流结束后调用
+	AcquireStreamLease(key string, max int64) (func(), bool, error)
+}
+
+// AcquireStream 占用一个流式连接名额（按 API Key，无 Key 时按客户端 IP）
+// 参数：
+//   - limiter: 限流器
+//   - config: 限流配置
+//   - apiKey: API Key（可为空）
+//   - clientIP: 客户端 IP
+//
+// 返回：
+//   - func(): 释放函数，流结束或客户端断开后必须调用
+//   - bool: 是否允许建立新的流
+func AcquireStream(limiter RateLimiter, config *RateLimitConfig, apiKey, clientIP string) (func(), bool) {
+	noop := func() {}
+	if limiter == nil || config == nil || !config.Enabled || config.PerKey == nil || !config.PerKey.Enabled || config.PerKey.MaxConcurrentStreams <= 0 {
+		return noop, true
+	}
+	max := int64(config.PerKey.MaxConcurrentStreams)
+
+	streamKey := fmt.Sprintf("streams:ip:%s", clientIP)
+	display := clientIP
+	if apiKey != "" {
+		streamKey = fmt.Sprintf("streams:key:%s", apiKey)
+		display = utils.MaskKey(apiKey)
+	}
+
+	// 支持租约的限流器（Redis）按流记录名额
+	if leases, ok := limiter.(StreamLimiter); ok {
+		release, allowed, err := leases.AcquireStreamLease(streamKey, max)
+		if err != nil {
+			log.Printf("流式并发数限流: 占用名额失败, client: %s: %v", display, err)
+			return noop, false
+		}
+		if !allowed {
+			log.Printf("流式并发数限流: 请求被拒绝, client: %s, streams: %d", display, max)
+			return noop, false
+		}
+		return release, true
+	}
+
+	// 进程内限流器使用并发计数，计数增加成功后才需要减少
+	current, err := limiter.IncrementConcurrent(streamKey)
+	if err != nil {
+		log.Printf("流式并发数限流: 增加计数失败, client: %s: %v", display, err)
+		return noop, false
+	}
+	release := func() {
+		if err := limiter.DecrementConcurrent(streamKey); err != nil {
+			log.Printf("减少流式并发计数失败: %v", err)
+		}
+	}
+	if current > max {
+		release()
+		log.Printf("流式并发数限流: 请求被拒绝, client: %s, streams: %d", display, current)
+		return noop, false
+	}
+
+	return release, true
+}
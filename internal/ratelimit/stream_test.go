@@ -0,0 +1,144 @@
+package ratelimit
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"time"
+)
+
+// testStreamConfig 每个 Key 最多 max 个并发流
+func testStreamConfig(max int) *RateLimitConfig {
+	return &RateLimitConfig{Enabled: true, PerKey: &KeyLimit{Enabled: true, MaxConcurrentStreams: max}}
+}
+
+// failingCounter 增加并发计数总是失败，记录减少计数的次数
+type failingCounter struct {
+	*MemoryRateLimiter
+	decrements int
+}
+
+func (f *failingCounter) IncrementConcurrent(key string) (int64, error) {
+	return 0, errors.New("counter unavailable")
+}
+
+func (f *failingCounter) DecrementConcurrent(key string) error {
+	f.decrements++
+	return nil
+}
+
+func TestAcquireStreamMemory(t *testing.T) {
+	limiter := NewMemoryRateLimiter(Limit{})
+	cfg := testStreamConfig(2)
+
+	release1, ok1 := AcquireStream(limiter, cfg, "sk-a", "10.0.0.1")
+	release2, ok2 := AcquireStream(limiter, cfg, "sk-a", "10.0.0.1")
+	if !ok1 || !ok2 {
+		t.Fatalf("first two streams: %v, %v; want allowed", ok1, ok2)
+	}
+	if _, ok := AcquireStream(limiter, cfg, "sk-a", "10.0.0.1"); ok {
+		t.Fatal("third stream allowed, want denied")
+	}
+	// 其他 Key 不受影响
+	if release, ok := AcquireStream(limiter, cfg, "sk-b", "10.0.0.1"); !ok {
+		t.Error("other key denied")
+	} else {
+		release()
+	}
+
+	// 被拒绝的请求不占用名额：释放一个后可以再建立一个
+	release1()
+	release3, ok := AcquireStream(limiter, cfg, "sk-a", "10.0.0.1")
+	if !ok {
+		t.Fatal("stream after release denied")
+	}
+	release2()
+	release3()
+
+	// 增加计数失败时拒绝，且不减少计数
+	failing := &failingCounter{MemoryRateLimiter: NewMemoryRateLimiter(Limit{}).(*MemoryRateLimiter)}
+	if _, ok := AcquireStream(failing, cfg, "sk-a", "10.0.0.1"); ok {
+		t.Error("stream allowed when the counter fails")
+	}
+	if failing.decrements != 0 {
+		t.Errorf("DecrementConcurrent called %d times after a failed increment", failing.decrements)
+	}
+
+	// 未配置 max_concurrent_streams 时不限制
+	if _, ok := AcquireStream(limiter, testStreamConfig(0), "sk-a", "10.0.0.1"); !ok {
+		t.Error("stream denied without max_concurrent_streams")
+	}
+}
+
+func TestAcquireStreamRedis(t *testing.T) {
+	mr, client := newTestRedisClient(t)
+	limiter := NewRedisRateLimiter(client, "rl:", Limit{})
+	cfg := testStreamConfig(2)
+
+	release1, ok1 := AcquireStream(limiter, cfg, "sk-a", "10.0.0.1")
+	release2, ok2 := AcquireStream(limiter, cfg, "sk-a", "10.0.0.1")
+	if !ok1 || !ok2 {
+		t.Fatalf("first two streams: %v, %v; want allowed", ok1, ok2)
+	}
+	if _, ok := AcquireStream(limiter, cfg, "sk-a", "10.0.0.1"); ok {
+		t.Fatal("third stream allowed, want denied")
+	}
+
+	// 每个流是名额集合中的一个成员，不使用请求并发计数 Key
+	const key = "rl:streams:key:sk-a"
+	if members, err := mr.ZMembers(key); err != nil || len(members) != 2 {
+		t.Errorf("stream members = %v, %v; want 2", members, err)
+	}
+	for _, k := range mr.Keys() {
+		if strings.Contains(k, "concurrent") {
+			t.Errorf("unexpected concurrent counter key %q", k)
+		}
+	}
+	if ttl := mr.TTL(key); ttl <= 0 || ttl > streamLeaseTTL {
+		t.Errorf("TTL = %v, want within the lease (%v)", ttl, streamLeaseTTL)
+	}
+
+	// 释放后归还名额
+	release1()
+	release3, ok := AcquireStream(limiter, cfg, "sk-a", "10.0.0.1")
+	if !ok {
+		t.Fatal("stream after release denied")
+	}
+	release2()
+	release3()
+	if members, _ := mr.ZMembers(key); len(members) != 0 {
+		t.Errorf("stream members after release = %v, want none", members)
+	}
+
+	// 其他实例崩溃留下的名额在租约到期后回收
+	expired := float64(time.Now().Add(-time.Second).UnixMilli())
+	if _, err := mr.ZAdd(key, expired, "crashed-1"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := mr.ZAdd(key, expired, "crashed-2"); err != nil {
+		t.Fatal(err)
+	}
+	release, ok := AcquireStream(limiter, cfg, "sk-a", "10.0.0.1")
+	if !ok {
+		t.Fatal("stream denied by expired leases")
+	}
+	release()
+
+	// 无 Key 时按客户端 IP
+	release, ok = AcquireStream(limiter, cfg, "", "10.0.0.1")
+	if !ok || !mr.Exists("rl:streams:ip:10.0.0.1") {
+		t.Errorf("IP stream: allowed = %v, keys = %v", ok, mr.Keys())
+	}
+	release()
+
+	// 滑动窗口限流器沿用同样的流式名额
+	if _, ok := NewRedisSlidingWindowLimiter(client, "rl:", Limit{}).(StreamLimiter); !ok {
+		t.Error("RedisSlidingWindowLimiter does not implement StreamLimiter")
+	}
+
+	// Redis 不可用时拒绝
+	mr.Close()
+	if _, ok := AcquireStream(limiter, cfg, "sk-a", "10.0.0.1"); ok {
+		t.Error("stream allowed with redis down")
+	}
+}
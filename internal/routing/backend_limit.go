@@ -0,0 +1,75 @@
+package routing
+
+import (
+	"log"
+
+	"llmproxy/internal/config"
+	"llmproxy/internal/lb"
+	"llmproxy/internal/ratelimit"
+)
+
+// backendLimiter 后端级限流（令牌桶，按后端名称计数，无名称时按 URL）
+// 负载均衡器和路由器持有不同的 lb.Backend 实例，因此以名称而不是指针区分后端
+type backendLimiter struct {
+	limiter ratelimit.RateLimiter
+	limits  map[string]*config.BackendRateLimit
+}
+
+// newBackendLimiter 根据后端配置创建后端限流器
+// 参数：
+//   - backends: 后端配置列表
+//
+// 返回：
+//   - *backendLimiter: 后端限流器（没有后端配置限流时为 nil）
+func newBackendLimiter(backends []*config.Backend) *backendLimiter {
+	limits := make(map[string]*config.BackendRateLimit)
+	for _, b := range backends {
+		if b == nil || b.RateLimit == nil || b.RateLimit.RequestsPerSecond <= 0 {
+			continue
+		}
+		limits[backendKey(b.Name, b.URL)] = b.RateLimit
+	}
+	if len(limits) == 0 {
+		return nil
+	}
+	return &backendLimiter{
+		limiter: ratelimit.NewMemoryRateLimiter(ratelimit.Limit{}),
+		limits:  limits,
+	}
+}
+
+// backendKey 后端限流 Key
+func backendKey(name, url string) string {
+	if name != "" {
+		return name
+	}
+	return url
+}
+
+// allow 检查后端是否还有配额（消耗 1 个令牌），未配置限流的后端总是允许
+// 参数：
+//   - backend: 后端实例
+//
+// 返回：
+//   - bool: 是否允许
+func (l *backendLimiter) allow(backend *lb.Backend) bool {
+	if l == nil {
+		return true
+	}
+	key := backendKey(backend.Name, backend.URL)
+	limit, ok := l.limits[key]
+	if !ok {
+		return true
+	}
+
+	burst := limit.BurstSize
+	if burst <= 0 {
+		burst = limit.RequestsPerSecond
+	}
+	allowed, _, err := l.limiter.AllowN("backend:"+key, int64(burst), int64(limit.RequestsPerSecond), 1)
+	if err != nil {
+		log.Printf("后端限流检查失败，放行: %v", err)
+		return true
+	}
+	return allowed
+}
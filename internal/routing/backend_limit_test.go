@@ -0,0 +1,104 @@
+package routing
+
+import (
+	"net/http/httptest"
+	"testing"
+
+	"llmproxy/internal/config"
+	"llmproxy/internal/lb"
+)
+
+// namedBackends 为测试后端生成带名称的后端配置（名称与 X-Backend 响应头一致）
+func namedBackends(servers map[string]*httptest.Server, names ...string) []*config.Backend {
+	backends := make([]*config.Backend, len(names))
+	for i, name := range names {
+		backends[i] = &config.Backend{Name: name, URL: servers[name].URL, Weight: 1}
+	}
+	return backends
+}
+
+func TestRouterBackendRateLimit(t *testing.T) {
+	servers := map[string]*httptest.Server{
+		"a": newTestBackend(t, "a"),
+		"b": newTestBackend(t, "b"),
+	}
+	backends := namedBackends(servers, "a", "b")
+	// 令牌每秒只补充 1 个，测试期间 a 最多处理 2 个请求
+	backends[0].RateLimit = &config.BackendRateLimit{RequestsPerSecond: 1, BurstSize: 2}
+
+	// 最少连接数策略在请求之间总是优先选择 a
+	router := NewRouter(&RoutingConfig{Enabled: true}, lb.NewLeastConnections(backends, nil), nil)
+	router.SetBackendLimits(backends)
+
+	var got []string
+	for i := 0; i < 5; i++ {
+		got = append(got, proxyBackendName(t, router, "m"))
+	}
+	want := []string{"a", "a", "b", "b", "b"}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Fatalf("backends = %v, want %v", got, want)
+		}
+	}
+}
+
+func TestRouterBackendRateLimitAllExhausted(t *testing.T) {
+	servers := map[string]*httptest.Server{
+		"a": newTestBackend(t, "a"),
+		"b": newTestBackend(t, "b"),
+	}
+	backends := namedBackends(servers, "a", "b")
+	for _, b := range backends {
+		b.RateLimit = &config.BackendRateLimit{RequestsPerSecond: 1}
+	}
+
+	router := NewRouter(&RoutingConfig{Enabled: true}, newTestBalancer(servers["a"], servers["b"]), nil)
+	// 负载均衡器中的后端没有名称，按 URL 计数
+	for _, b := range backends {
+		b.Name = ""
+	}
+	router.SetBackendLimits(backends)
+
+	seen := map[string]bool{}
+	for i := 0; i < 2; i++ {
+		seen[proxyBackendName(t, router, "m")] = true
+	}
+	if !seen["a"] || !seen["b"] {
+		t.Fatalf("backends served = %v, want both a and b", seen)
+	}
+
+	req, body := newTestRequest("m")
+	if resp, _, err := router.ProxyRequest(req, body, "m"); err == nil {
+		resp.Body.Close()
+		t.Fatal("ProxyRequest() succeeded with every backend at its limit")
+	}
+}
+
+func TestRouterSpecifiedBackendKeepsInflightBalanced(t *testing.T) {
+	servers := map[string]*httptest.Server{
+		"a": newTestBackend(t, "a"),
+		"b": newTestBackend(t, "b"),
+	}
+	balancer := lb.NewLeastConnections(namedBackends(servers, "a", "b"), nil)
+	router := NewRouter(&RoutingConfig{Enabled: true}, balancer, nil)
+
+	// a 上有一个在途请求
+	if held := balancer.Next(); held == nil || held.Name != "a" {
+		t.Fatalf("Next() = %v, want a", held)
+	}
+
+	// 钩子指定 a：请求结束后不应抵消 a 上原有的在途请求
+	for i := 0; i < 3; i++ {
+		req, body := newTestRequest("m")
+		req = req.WithContext(WithRouteTarget(req.Context(), "a"))
+		resp, backend, err := router.ProxyRequest(req, body, "m")
+		if err != nil || backend.Name != "a" {
+			t.Fatalf("ProxyRequest() = %v, %v; want backend a", backend, err)
+		}
+		resp.Body.Close()
+	}
+
+	if next := balancer.Next(); next == nil || next.Name != "b" {
+		t.Errorf("Next() after hook-routed requests = %v, want b (a still has one request in flight)", next)
+	}
+}
@@ -0,0 +1,122 @@
+package routing
+
+import (
+	"hash/fnv"
+	"log"
+	"math/rand"
+	"net/http"
+
+	"llmproxy/internal/config"
+	"llmproxy/internal/lb"
+	"llmproxy/internal/metrics"
+)
+
+// 金丝雀分流的两侧（指标标签）
+const (
+	CanaryArmCanary = "canary"
+	CanaryArmStable = "stable"
+)
+
+// canaryConfig 获取已启用的金丝雀分流配置（未启用时返回 nil）
+func (r *Router) canaryConfig() *config.CanaryConfig {
+	if r.config == nil || r.config.Canary == nil || !r.config.Canary.Enabled || r.config.Canary.Backend == "" {
+		return nil
+	}
+	return r.config.Canary
+}
+
+// proxyCanary 按金丝雀分流代理请求
+// 分到金丝雀一侧的请求发往金丝雀后端（重试也发往该后端）；金丝雀后端不可用或请求失败时改走稳定侧，
+// 稳定侧按故障转移规则和负载均衡器正常路由
+// 参数：
+//   - req: HTTP 请求
+//   - bodyBytes: 请求体
+//   - model: 模型名
+//   - cfg: 金丝雀分流配置
+//
+// 返回：
+//   - *http.Response: 响应
+//   - *lb.Backend: 使用的后端
+//   - error: 错误信息
+func (r *Router) proxyCanary(req *http.Request, bodyBytes []byte, model string, cfg *config.CanaryConfig) (*http.Response, *lb.Backend, error) {
+	if canarySelected(lb.HashKeyFromContext(req.Context()), cfg.Percentage) {
+		backend, balancer, pool := r.findBackend(cfg.Backend)
+		switch {
+		case backend == nil:
+			log.Printf("金丝雀后端不存在: %s，改用稳定后端", cfg.Backend)
+		case !backend.Healthy:
+			log.Printf("金丝雀后端 %s 不健康，改用稳定后端", cfg.Backend)
+		case r.allowBackend(backend):
+			resp, used, err := r.proxyWithPool(req, bodyBytes, model, balancer, pool, backend, lb.ReasonCanary)
+			if err == nil {
+				metrics.RecordCanary(model, CanaryArmCanary)
+				return resp, used, nil
+			}
+			log.Printf("金丝雀后端 %s 失败，改用稳定后端: %v", cfg.Backend, err)
+		}
+	}
+
+	resp, backend, err := r.proxyFallback(req, bodyBytes, model)
+	if err == nil {
+		metrics.RecordCanary(model, CanaryArmStable)
+	}
+	return resp, backend, err
+}
+
+// canaryMatch 判断请求是否参与金丝雀分流
+// 参数：
+//   - cfg: 金丝雀分流配置
+//   - req: HTTP 请求
+//   - model: 模型名
+//
+// 返回：
+//   - bool: 模型和请求头均匹配时返回 true
+func canaryMatch(cfg *config.CanaryConfig, req *http.Request, model string) bool {
+	if len(cfg.Models) > 0 && !MatchModels(cfg.Models, model) {
+		return false
+	}
+	for name, value := range cfg.Headers {
+		if req.Header.Get(name) != value {
+			return false
+		}
+	}
+	return true
+}
+
+// canarySelected 判断请求是否分到金丝雀一侧
+// 按哈希 Key 的 FNV-1a 哈希确定性分流，同一个 Key 始终落在同一侧；没有 Key 时随机分流
+// 参数：
+//   - key: 哈希 Key
+//   - percentage: 金丝雀比例（0-100）
+//
+// 返回：
+//   - bool: 是否分到金丝雀一侧
+func canarySelected(key string, percentage float64) bool {
+	if percentage <= 0 {
+		return false
+	}
+	if percentage >= 100 {
+		return true
+	}
+	if key == "" {
+		return rand.Float64()*100 < percentage
+	}
+	h := fnv.New32a()
+	_, _ = h.Write([]byte(key))
+	// 精确到 0.01%
+	return float64(h.Sum32()%10000) < percentage*100
+}
+
+// isCanaryBackend 判断后端是否为金丝雀后端
+func (r *Router) isCanaryBackend(backend *lb.Backend) bool {
+	cfg := r.canaryConfig()
+	if cfg == nil {
+		return false
+	}
+	return backend.URL == cfg.Backend || (backend.Name != "" && backend.Name == cfg.Backend)
+}
+
+// selectable 负载均衡选择时的后端过滤：排除金丝雀后端和已达到后端限流上限的后端
+func (r *Router) selectable(backend *lb.Backend) bool {
+	return !r.isCanaryBackend(backend) && r.backendLimits().allow(backend)
+}
@@ -0,0 +1,174 @@
+package routing
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"llmproxy/internal/config"
+	"llmproxy/internal/lb"
+	"llmproxy/internal/metrics"
+)
+
+// canaryCount 读取金丝雀分流计数（不存在时返回空字符串）
+func canaryCount(t *testing.T, model, arm string) string {
+	t.Helper()
+	rec := httptest.NewRecorder()
+	metrics.Handler(rec, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+	sample := `llmproxy_canary_requests_total{arm="` + arm + `",model="` + model + `"} `
+	for _, line := range strings.Split(rec.Body.String(), "\n") {
+		if value, ok := strings.CutPrefix(line, sample); ok {
+			return value
+		}
+	}
+	return ""
+}
+
+// newCanaryRouter 创建以 canary 为金丝雀后端、stable-a / stable-b 为稳定后端的路由器
+func newCanaryRouter(t *testing.T, canary *config.CanaryConfig) *Router {
+	t.Helper()
+	servers := map[string]*httptest.Server{
+		"stable-a": newTestBackend(t, "stable-a"),
+		"stable-b": newTestBackend(t, "stable-b"),
+		"canary":   newTestBackend(t, "canary"),
+	}
+	return NewRouter(&RoutingConfig{Enabled: true, Canary: canary},
+		lb.NewRoundRobin(namedBackends(servers, "stable-a", "stable-b", "canary"), nil), nil)
+}
+
+// proxyKeyName 以指定哈希 Key 代理一次请求，返回响应的后端名称
+func proxyKeyName(t *testing.T, router *Router, key, model string, header http.Header) string {
+	t.Helper()
+	req, body := newTestRequest(model)
+	req = req.WithContext(lb.WithHashKey(context.Background(), key))
+	for k, v := range header {
+		req.Header[k] = v
+	}
+	resp, _, err := router.ProxyRequest(req, body, model)
+	if err != nil {
+		t.Fatalf("ProxyRequest(key %q) error = %v", key, err)
+	}
+	defer resp.Body.Close()
+	return resp.Header.Get("X-Backend")
+}
+
+func TestCanarySelectedRatio(t *testing.T) {
+	for _, percentage := range []float64{5, 30, 50} {
+		const keys = 20000
+		selected := 0
+		for i := 0; i < keys; i++ {
+			if canarySelected(fmt.Sprintf("user-%d", i), percentage) {
+				selected++
+			}
+		}
+		// 允许 ±1 个百分点的偏差
+		got := float64(selected) * 100 / keys
+		if got < percentage-1 || got > percentage+1 {
+			t.Errorf("percentage %v: %.2f%% of keys selected", percentage, got)
+		}
+	}
+
+	for _, key := range []string{"", "user-1"} {
+		if canarySelected(key, 0) {
+			t.Errorf("canarySelected(%q, 0) = true", key)
+		}
+		if !canarySelected(key, 100) {
+			t.Errorf("canarySelected(%q, 100) = false", key)
+		}
+	}
+}
+
+func TestCanarySplitAndStickiness(t *testing.T) {
+	metrics.Init(nil)
+	router := newCanaryRouter(t, &config.CanaryConfig{Enabled: true, Backend: "canary", Percentage: 10})
+
+	const keys = 1000
+	arms := make(map[string]string, keys)
+	canary := 0
+	for i := 0; i < keys; i++ {
+		key := fmt.Sprintf("user-%d", i)
+		got := proxyKeyName(t, router, key, "gpt-4o", nil)
+		if got == "canary" {
+			canary++
+		}
+		arms[key] = got
+	}
+	if canary < 70 || canary > 130 {
+		t.Errorf("%d of %d keys routed to the canary, want about 10%%", canary, keys)
+	}
+
+	// 同一个 Key 始终落在同一侧；金丝雀后端不参与稳定侧的轮询
+	for i := 0; i < 200; i++ {
+		key := fmt.Sprintf("user-%d", i)
+		got := proxyKeyName(t, router, key, "gpt-4o", nil)
+		if (got == "canary") != (arms[key] == "canary") {
+			t.Fatalf("key %s switched from %s to %s", key, arms[key], got)
+		}
+	}
+
+	if got, want := canaryCount(t, "gpt-4o", CanaryArmCanary), fmt.Sprint(canary+countCanary(arms, 200)); got != want {
+		t.Errorf("canary arm count = %s, want %s", got, want)
+	}
+	if got, want := canaryCount(t, "gpt-4o", CanaryArmStable), fmt.Sprint(keys+200-canary-countCanary(arms, 200)); got != want {
+		t.Errorf("stable arm count = %s, want %s", got, want)
+	}
+}
+
+// countCanary 统计前 n 个 Key 中分到金丝雀一侧的数量
+func countCanary(arms map[string]string, n int) int {
+	count := 0
+	for i := 0; i < n; i++ {
+		if arms[fmt.Sprintf("user-%d", i)] == "canary" {
+			count++
+		}
+	}
+	return count
+}
+
+func TestCanaryMatch(t *testing.T) {
+	router := newCanaryRouter(t, &config.CanaryConfig{
+		Enabled:    true,
+		Backend:    "canary",
+		Percentage: 100,
+		Models:     []string{"gpt-4*"},
+		Headers:    map[string]string{"X-Beta": "1"},
+	})
+	beta := http.Header{"X-Beta": []string{"1"}}
+
+	tests := []struct {
+		name   string
+		model  string
+		header http.Header
+		want   bool
+	}{
+		{"模型和请求头都匹配", "gpt-4o", beta, true},
+		{"模型不匹配", "claude-3", beta, false},
+		{"缺少请求头", "gpt-4o", nil, false},
+		{"请求头值不同", "gpt-4o", http.Header{"X-Beta": []string{"0"}}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			for i := 0; i < 3; i++ {
+				got := proxyKeyName(t, router, "user-1", tt.model, tt.header)
+				if (got == "canary") != tt.want {
+					t.Fatalf("request %d routed to %s, want canary = %v", i, got, tt.want)
+				}
+			}
+		})
+	}
+}
+
+func TestCanaryUnavailableUsesStable(t *testing.T) {
+	router := newCanaryRouter(t, &config.CanaryConfig{Enabled: true, Backend: "canary", Percentage: 100})
+	balancer := router.loadBalancer
+	balancer.UpdateHealth(lb.FindBackend(balancer, "canary"), false)
+
+	for i := 0; i < 4; i++ {
+		if got := proxyKeyName(t, router, "user-1", "gpt-4o", nil); !strings.HasPrefix(got, "stable-") {
+			t.Fatalf("request %d routed to %s, want a stable backend", i, got)
+		}
+	}
+}
@@ -8,3 +8,4 @@ import (
 type RoutingConfig = config.RoutingConfig
 type RetryConfig = config.RetryConfig
 type FallbackRule = config.FallbackRule
+type ModelRoute = config.ModelRoute
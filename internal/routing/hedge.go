@@ -0,0 +1,181 @@
+package routing
+
+import (
+	"context"
+	"io"
+	"log"
+	"net/http"
+	"time"
+
+	"llmproxy/internal/config"
+	"llmproxy/internal/lb"
+)
+
+// 对冲请求默认参数
+const (
+	DefaultHedgeDelay            = time.Second
+	DefaultHedgeMaxExtraRequests = 1
+)
+
+// hedgeResult 一个对冲请求的结果
+type hedgeResult struct {
+	resp    *http.Response
+	backend *lb.Backend
+	err     error
+	cancel  context.CancelFunc
+}
+
+// cancelOnClose 关闭响应体时取消对应请求的上下文
+type cancelOnClose struct {
+	io.ReadCloser
+	cancel context.CancelFunc
+}
+
+// Close 关闭响应体并取消上下文
+func (c *cancelOnClose) Close() error {
+	err := c.ReadCloser.Close()
+	c.cancel()
+	return err
+}
+
+// hedgeConfig 获取已启用的对冲请求配置（未启用时返回 nil）
+func (r *Router) hedgeConfig() *config.HedgeConfig {
+	if r.config == nil || r.config.Hedge == nil || !r.config.Hedge.Enabled {
+		return nil
+	}
+	return r.config.Hedge
+}
+
+// sendHedged 发送对冲请求
+// 先向 first 发送请求；每经过 delay 仍没有可用响应，就向另一个未使用过的健康后端追加一个请求（最多 max_extra_requests 个）。
+// 最先返回不可重试响应（2xx / 4xx）的请求胜出，其余请求立即取消，响应体被丢弃，
+// 因此只有胜出的响应会被转发和计入用量。所有请求都失败时返回最后一个失败结果，由重试逻辑处理
+// 参数：
+//   - a: 请求参数
+//   - pool: 后端池名称
+//   - first: 首个请求的后端
+//   - cfg: 对冲请求配置
+//
+// 返回：
+//   - *http.Response: 胜出的响应
+//   - *lb.Backend: 胜出的后端
+//   - error: 错误信息
+func (r *Router) sendHedged(a *sendAttempt, pool string, first *lb.Backend, cfg *config.HedgeConfig) (*http.Response, *lb.Backend, error) {
+	delay := cfg.Delay
+	if delay <= 0 {
+		delay = DefaultHedgeDelay
+	}
+	maxExtra := cfg.MaxExtraRequests
+	if maxExtra <= 0 {
+		maxExtra = DefaultHedgeMaxExtraRequests
+	}
+
+	// 缓冲区容纳所有请求的结果，胜出后其余 goroutine 不会阻塞
+	results := make(chan hedgeResult, maxExtra+1)
+	var used []*lb.Backend
+	var cancels []context.CancelFunc
+	launch := func(backend *lb.Backend, hedged bool) {
+		ctx, cancel := context.WithCancel(a.req.Context())
+		used = append(used, backend)
+		cancels = append(cancels, cancel)
+		go func() {
+			resp, err := r.send(ctx, a, backend, hedged)
+			results <- hedgeResult{resp: resp, backend: backend, err: err, cancel: cancel}
+		}()
+	}
+
+	launch(first, false)
+	inflight := 1
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+
+	var last hedgeResult
+	for inflight > 0 {
+		select {
+		case <-timer.C:
+			if len(used)-1 >= maxExtra {
+				continue
+			}
+			backend := r.chooseHedgeBackend(a.req, a.balancer, pool, used)
+			if backend == nil {
+				log.Printf("对冲请求: 没有其他可用后端，继续等待")
+				continue
+			}
+			log.Printf("对冲请求: %v 内未响应，追加请求到 %s", delay, backend.URL)
+			launch(backend, true)
+			inflight++
+			if len(used)-1 < maxExtra {
+				timer.Reset(delay)
+			}
+
+		case res := <-results:
+			inflight--
+			if res.err == nil && !shouldRetry(nil, res.resp.StatusCode) {
+				// 胜出：取消其余请求，丢弃其后返回的响应
+				for i, cancel := range cancels {
+					if used[i] != res.backend {
+						cancel()
+					}
+				}
+				if inflight > 0 {
+					go discardHedgeResults(results, inflight)
+				}
+				// 之前保留的失败结果不再使用
+				last.release()
+				if len(used) > 1 {
+					log.Printf("对冲请求: 采用 %s 的响应（共发送 %d 个请求）", res.backend.URL, len(used))
+				}
+				res.resp.Body = &cancelOnClose{ReadCloser: res.resp.Body, cancel: res.cancel}
+				return res.resp, res.backend, nil
+			}
+			// 失败：保留最后一个失败结果，继续等待其他请求
+			last.release()
+			last = res
+		}
+	}
+
+	if last.resp != nil {
+		last.resp.Body = &cancelOnClose{ReadCloser: last.resp.Body, cancel: last.cancel}
+	} else {
+		last.cancel()
+	}
+	return last.resp, last.backend, last.err
+}
+
+// release 丢弃结果：关闭响应体并取消上下文
+func (h *hedgeResult) release() {
+	if h.resp != nil {
+		_ = h.resp.Body.Close()
+	}
+	if h.cancel != nil {
+		h.cancel()
+	}
+}
+
+// discardHedgeResults 丢弃落败请求的结果
+func discardHedgeResults(results <-chan hedgeResult, n int) {
+	for i := 0; i < n; i++ {
+		res := <-results
+		res.release()
+	}
+}
+
+// chooseHedgeBackend 为追加请求选择一个尚未使用的健康后端
+// 参数：
+//   - req: HTTP 请求（读取一致性哈希 Key）
+//   - balancer: 负载均衡器
+//   - pool: 后端池名称
+//   - used: 已发送请求的后端
+//
+// 返回：
+//   - *lb.Backend: 后端实例（没有可用后端时返回 nil）
+func (r *Router) chooseHedgeBackend(req *http.Request, balancer lb.LoadBalancer, pool string, used []*lb.Backend) *lb.Backend {
+	return lb.ChooseAllowed(balancer, lb.HashKeyFromContext(req.Context()), pool, func(b *lb.Backend) bool {
+		for _, u := range used {
+			if u == b || u.URL == b.URL {
+				return false
+			}
+		}
+		return r.selectable(b)
+	})
+}
@@ -0,0 +1,178 @@
+package routing
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"llmproxy/internal/config"
+)
+
+// newSlowBackend 启动一个等待 delay 后才响应的测试后端；请求被取消时 cancelled 计数加 1
+func newSlowBackend(t *testing.T, name string, status int, delay time.Duration, cancelled *atomic.Int32) *httptest.Server {
+	t.Helper()
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// 读完请求体后服务端才能感知客户端断开
+		_, _ = io.Copy(io.Discard, r.Body)
+		select {
+		case <-time.After(delay):
+		case <-r.Context().Done():
+			if cancelled != nil {
+				cancelled.Add(1)
+			}
+			return
+		}
+		w.Header().Set("X-Backend", name)
+		w.WriteHeader(status)
+		_, _ = w.Write([]byte(`{"backend":"` + name + `"}`))
+	}))
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+// newHedgeRouter 创建启用对冲请求的路由器（轮询顺序与 servers 一致）
+func newHedgeRouter(hedge *config.HedgeConfig, servers ...*httptest.Server) *Router {
+	return NewRouter(&RoutingConfig{Enabled: true, Hedge: hedge}, newTestBalancer(servers...), nil)
+}
+
+// bodyTracker 记录经过的响应体中尚未关闭的数量
+type bodyTracker struct {
+	transport http.RoundTripper
+	open      atomic.Int32
+}
+
+// trackedBody 关闭时递减计数的响应体
+type trackedBody struct {
+	io.ReadCloser
+	once    sync.Once
+	tracker *bodyTracker
+}
+
+func (b *trackedBody) Close() error {
+	b.once.Do(func() { b.tracker.open.Add(-1) })
+	return b.ReadCloser.Close()
+}
+
+func (t *bodyTracker) RoundTrip(req *http.Request) (*http.Response, error) {
+	resp, err := t.transport.RoundTrip(req)
+	if err != nil {
+		return nil, err
+	}
+	t.open.Add(1)
+	resp.Body = &trackedBody{ReadCloser: resp.Body, tracker: t}
+	return resp, nil
+}
+
+func TestHedgeUsesFastBackend(t *testing.T) {
+	var cancelled atomic.Int32
+	slow := newSlowBackend(t, "slow", http.StatusOK, 5*time.Second, &cancelled)
+	fast := newTestBackend(t, "fast")
+	router := newHedgeRouter(&config.HedgeConfig{Enabled: true, Delay: 20 * time.Millisecond}, slow, fast)
+
+	start := time.Now()
+	req, body := newTestRequest("m")
+	resp, backend, err := router.ProxyRequest(req, body, "m")
+	if err != nil {
+		t.Fatalf("ProxyRequest() error = %v", err)
+	}
+	data, _ := io.ReadAll(resp.Body)
+	_ = resp.Body.Close()
+
+	if got := resp.Header.Get("X-Backend"); got != "fast" || backend.URL != fast.URL {
+		t.Errorf("winner = %s (%s), want fast", got, backend.URL)
+	}
+	if string(data) != `{"backend":"fast"}` {
+		t.Errorf("body = %s", data)
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("hedged request took %v, want about the hedge delay", elapsed)
+	}
+
+	// 落败的慢请求被取消
+	deadline := time.Now().Add(2 * time.Second)
+	for cancelled.Load() == 0 && time.Now().Before(deadline) {
+		time.Sleep(5 * time.Millisecond)
+	}
+	if cancelled.Load() != 1 {
+		t.Error("slow request was not cancelled")
+	}
+}
+
+func TestHedgeNotSentWhenFirstIsFast(t *testing.T) {
+	var hits atomic.Int32
+	counting := func(name string) *httptest.Server {
+		srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			hits.Add(1)
+			w.Header().Set("X-Backend", name)
+		}))
+		t.Cleanup(srv.Close)
+		return srv
+	}
+	router := newHedgeRouter(&config.HedgeConfig{Enabled: true, Delay: time.Second}, counting("a"), counting("b"))
+
+	if got := proxyBackendName(t, router, "m"); got != "a" {
+		t.Errorf("backend = %s, want a", got)
+	}
+	time.Sleep(50 * time.Millisecond)
+	if hits.Load() != 1 {
+		t.Errorf("backend hits = %d, want 1 (no hedge before the delay)", hits.Load())
+	}
+}
+
+func TestHedgeReleasesEarlierFailure(t *testing.T) {
+	// a 先返回可重试的 500，b 随后成功：a 的响应体必须被关闭
+	failing := newSlowBackend(t, "a", http.StatusInternalServerError, 40*time.Millisecond, nil)
+	winner := newSlowBackend(t, "b", http.StatusOK, 80*time.Millisecond, nil)
+	router := newHedgeRouter(&config.HedgeConfig{Enabled: true, Delay: 10 * time.Millisecond}, failing, winner)
+	tracker := &bodyTracker{transport: http.DefaultTransport}
+	router.httpClient = &http.Client{Transport: tracker}
+
+	req, body := newTestRequest("m")
+	resp, _, err := router.ProxyRequest(req, body, "m")
+	if err != nil {
+		t.Fatalf("ProxyRequest() error = %v", err)
+	}
+	if got := resp.Header.Get("X-Backend"); got != "b" {
+		t.Errorf("winner = %s, want b", got)
+	}
+	if open := tracker.open.Load(); open != 1 {
+		t.Errorf("open bodies before closing the winner = %d, want 1", open)
+	}
+	_ = resp.Body.Close()
+	if open := tracker.open.Load(); open != 0 {
+		t.Errorf("open bodies = %d, want 0", open)
+	}
+}
+
+func TestHedgeNotUsedForStreams(t *testing.T) {
+	slow := newSlowBackend(t, "slow", http.StatusOK, 100*time.Millisecond, nil)
+	fast := newTestBackend(t, "fast")
+	router := newHedgeRouter(&config.HedgeConfig{Enabled: true, Delay: 10 * time.Millisecond}, slow, fast)
+
+	resp, err := proxyStream(router)
+	if err != nil {
+		t.Fatalf("ProxyRequest() error = %v", err)
+	}
+	defer resp.Body.Close()
+	if got := resp.Header.Get("X-Backend"); got != "slow" {
+		t.Errorf("stream backend = %s, want slow (streams are not hedged)", got)
+	}
+}
+
+func TestChooseHedgeBackendSkipsUsed(t *testing.T) {
+	a, b := newTestBackend(t, "a"), newTestBackend(t, "b")
+	router := newHedgeRouter(&config.HedgeConfig{Enabled: true}, a, b)
+	backends := balancerBackends(router.loadBalancer)
+	req, _ := newTestRequest("m")
+
+	if got := router.chooseHedgeBackend(req, router.loadBalancer, "", backends[:1]); got != backends[1] {
+		t.Errorf("chooseHedgeBackend() = %v, want b", got)
+	}
+	if got := router.chooseHedgeBackend(req, router.loadBalancer, "", backends); got != nil {
+		t.Errorf("chooseHedgeBackend() with all used = %v, want nil", got)
+	}
+}
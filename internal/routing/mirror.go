@@ -0,0 +1,118 @@
+package routing
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"log"
+	"math/rand"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"llmproxy/internal/config"
+	"llmproxy/internal/metrics"
+	"llmproxy/internal/utils"
+)
+
+// 流量镜像默认参数
+const (
+	DefaultMirrorTimeout = 60 * time.Second
+	mirrorMaxInflight    = 64 // 同时进行的影子请求上限，超出时丢弃（避免影子后端变慢时堆积 goroutine）
+)
+
+// Mirror 流量镜像
+// 按比例把请求异步复制到影子后端，影子响应被丢弃，失败只记录日志和指标，不影响主请求
+type Mirror struct {
+	cfg      *config.MirrorConfig
+	target   string
+	upstream *config.UpstreamConfig
+	client   *http.Client
+	slots    chan struct{}
+	sample   func() float64 // 返回 [0, 100) 的随机数
+}
+
+// NewMirror 创建流量镜像
+// 参数：
+//   - routing: 路由配置（routing.mirror 未启用时返回 nil）
+//   - upstream: 上游请求头配置
+//
+// 返回：
+//   - *Mirror: 流量镜像（nil 表示未启用，Send 为空操作）
+func NewMirror(routing *config.RoutingConfig, upstream *config.UpstreamConfig) *Mirror {
+	if routing == nil || routing.Mirror == nil || !routing.Mirror.Enabled || routing.Mirror.Percentage <= 0 {
+		return nil
+	}
+	cfg := routing.Mirror
+	timeout := cfg.Timeout
+	if timeout <= 0 {
+		timeout = DefaultMirrorTimeout
+	}
+	log.Printf("流量镜像已启用: %s, 比例: %v%%", cfg.Target, cfg.Percentage)
+	return &Mirror{
+		cfg:      cfg,
+		target:   strings.TrimSuffix(cfg.Target, "/"),
+		upstream: upstream,
+		client:   &http.Client{Timeout: timeout},
+		slots:    make(chan struct{}, mirrorMaxInflight),
+		sample:   func() float64 { return rand.Float64() * 100 },
+	}
+}
+
+// Send 按配置的比例和模型过滤异步镜像请求（立即返回）
+// 参数：
+//   - req: 客户端请求（复制路径和请求头）
+//   - body: 发往主后端的请求体
+//   - model: 模型名
+func (m *Mirror) Send(req *http.Request, body []byte, model string) {
+	if m == nil {
+		return
+	}
+	if len(m.cfg.Models) > 0 && !MatchModels(m.cfg.Models, model) {
+		return
+	}
+	if m.sample() >= m.cfg.Percentage {
+		return
+	}
+
+	select {
+	case m.slots <- struct{}{}:
+	default:
+		metrics.RecordMirror(model, "dropped", 0)
+		return
+	}
+
+	// 请求头和请求体在主请求结束后可能被复用，先复制
+	header := req.Header.Clone()
+	path := req.URL.Path
+	payload := append([]byte(nil), body...)
+	go func() {
+		defer func() { <-m.slots }()
+		m.send(header, path, payload, model)
+	}()
+}
+
+// send 发送影子请求并丢弃响应
+func (m *Mirror) send(header http.Header, path string, body []byte, model string) {
+	start := time.Now()
+	// 不使用客户端请求的上下文：主请求结束后影子请求仍需完成
+	proxyReq, err := http.NewRequestWithContext(context.Background(), http.MethodPost, m.target+path, bytes.NewReader(body))
+	if err != nil {
+		log.Printf("流量镜像: 创建请求失败: %v", err)
+		metrics.RecordMirror(model, "error", 0)
+		return
+	}
+	proxyReq.Header = header
+	utils.StampUpstreamHeaders(proxyReq.Header, m.upstream)
+
+	resp, err := m.client.Do(proxyReq)
+	if err != nil {
+		log.Printf("流量镜像: 影子后端请求失败: %v", err)
+		metrics.RecordMirror(model, "error", float64(time.Since(start).Milliseconds()))
+		return
+	}
+	_, _ = io.Copy(io.Discard, resp.Body)
+	_ = resp.Body.Close()
+	metrics.RecordMirror(model, strconv.Itoa(resp.StatusCode), float64(time.Since(start).Milliseconds()))
+}
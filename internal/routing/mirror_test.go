@@ -0,0 +1,165 @@
+package routing
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"llmproxy/internal/config"
+	"llmproxy/internal/metrics"
+)
+
+// mirrorCount 读取镜像请求计数（不存在时返回空字符串）
+func mirrorCount(t *testing.T, model, status string) string {
+	t.Helper()
+	rec := httptest.NewRecorder()
+	metrics.Handler(rec, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+	sample := `llmproxy_mirror_requests_total{model="` + model + `",status="` + status + `"} `
+	for _, line := range strings.Split(rec.Body.String(), "\n") {
+		if value, ok := strings.CutPrefix(line, sample); ok {
+			return value
+		}
+	}
+	return ""
+}
+
+// waitMirrorCount 等待镜像请求计数达到期望值
+func waitMirrorCount(t *testing.T, model, status, want string) {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for mirrorCount(t, model, status) != want {
+		if time.Now().After(deadline) {
+			t.Fatalf("mirror %s/%s = %q, want %s", model, status, mirrorCount(t, model, status), want)
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+// newMirror 创建指向 target 的流量镜像，采样值按 0, 1, ..., 99 循环（结果确定）
+func newMirror(target string, percentage float64, models ...string) *Mirror {
+	m := NewMirror(&config.RoutingConfig{Mirror: &config.MirrorConfig{
+		Enabled: true, Target: target + "/", Percentage: percentage, Models: models,
+	}}, &config.UpstreamConfig{})
+	var mu sync.Mutex
+	next := 0
+	m.sample = func() float64 {
+		mu.Lock()
+		defer mu.Unlock()
+		v := float64(next % 100)
+		next++
+		return v
+	}
+	return m
+}
+
+func TestMirrorSampledRate(t *testing.T) {
+	metrics.Init(nil)
+	var hits atomic.Int32
+	var mu sync.Mutex
+	var gotPath, gotBody, gotHeader string
+	shadow := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		mu.Lock()
+		gotPath, gotBody, gotHeader = r.URL.Path, string(body), r.Header.Get("X-Test")
+		mu.Unlock()
+		hits.Add(1)
+	}))
+	defer shadow.Close()
+
+	m := newMirror(shadow.URL, 25)
+	for i := 0; i < 200; i++ {
+		req, body := newTestRequest("gpt-4o")
+		req.Header.Set("X-Test", "copied")
+		m.Send(req, body, "gpt-4o")
+	}
+
+	waitMirrorCount(t, "gpt-4o", "200", "50")
+	if hits.Load() != 50 {
+		t.Errorf("shadow hits = %d, want 50 (25%% of 200)", hits.Load())
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	if gotPath != "/v1/chat/completions" || gotBody != `{"model":"gpt-4o","messages":[]}` || gotHeader != "copied" {
+		t.Errorf("shadow request = %s %s %q", gotPath, gotBody, gotHeader)
+	}
+}
+
+func TestMirrorModelFilter(t *testing.T) {
+	metrics.Init(nil)
+	var hits atomic.Int32
+	shadow := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) { hits.Add(1) }))
+	defer shadow.Close()
+
+	m := newMirror(shadow.URL, 100, "llama-*")
+	for _, model := range []string{"gpt-4o", "llama-3", "claude", "llama-3.1"} {
+		req, body := newTestRequest(model)
+		m.Send(req, body, model)
+	}
+	waitMirrorCount(t, "llama-3.1", "200", "1")
+	waitMirrorCount(t, "llama-3", "200", "1")
+	if hits.Load() != 2 {
+		t.Errorf("shadow hits = %d, want 2", hits.Load())
+	}
+}
+
+func TestMirrorErrorsSwallowed(t *testing.T) {
+	metrics.Init(nil)
+	release := make(chan struct{})
+	failing := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-release
+		http.Error(w, "shadow down", http.StatusInternalServerError)
+	}))
+	defer failing.Close()
+	defer close(release)
+
+	// Send 立即返回，不等待影子后端
+	m := newMirror(failing.URL, 100)
+	req, body := newTestRequest("m")
+	start := time.Now()
+	m.Send(req, body, "m")
+	if elapsed := time.Since(start); elapsed > 100*time.Millisecond {
+		t.Errorf("Send() blocked for %v", elapsed)
+	}
+	release <- struct{}{}
+	waitMirrorCount(t, "m", "500", "1")
+
+	// 影子后端不可达：只记录 error
+	closed := httptest.NewServer(http.NotFoundHandler())
+	closed.Close()
+	m = newMirror(closed.URL, 100)
+	m.Send(req, body, "m")
+	waitMirrorCount(t, "m", "error", "1")
+}
+
+func TestMirrorDropsWhenSaturated(t *testing.T) {
+	metrics.Init(nil)
+	m := newMirror("http://127.0.0.1:1", 100)
+	for i := 0; i < mirrorMaxInflight; i++ {
+		m.slots <- struct{}{}
+	}
+	req, body := newTestRequest("m")
+	m.Send(req, body, "m")
+	waitMirrorCount(t, "m", "dropped", "1")
+}
+
+func TestNewMirrorDisabled(t *testing.T) {
+	tests := []*config.RoutingConfig{
+		nil,
+		{},
+		{Mirror: &config.MirrorConfig{Target: "http://shadow", Percentage: 50}},
+		{Mirror: &config.MirrorConfig{Enabled: true, Target: "http://shadow"}},
+	}
+	for i, cfg := range tests {
+		if m := NewMirror(cfg, nil); m != nil {
+			t.Errorf("case %d: NewMirror() = %+v, want nil", i, m)
+		}
+	}
+	// nil 镜像的 Send 为空操作
+	req, body := newTestRequest("m")
+	(*Mirror)(nil).Send(req, body, "m")
+}
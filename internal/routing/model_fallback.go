@@ -0,0 +1,152 @@
+package routing
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+
+	"llmproxy/internal/lb"
+	"llmproxy/internal/metrics"
+	"llmproxy/internal/types"
+)
+
+// ModelFallbackHeader 发生模型降级时返回给客户端的响应头，值为实际使用的模型名
+const ModelFallbackHeader = "X-Model-Fallback"
+
+// noModelFallbackKey 请求上下文中禁用模型降级的键
+type noModelFallbackKey struct{}
+
+// WithoutModelFallback 在上下文中标记请求不允许模型降级（如客户端已固定模型版本）
+func WithoutModelFallback(ctx context.Context) context.Context {
+	return context.WithValue(ctx, noModelFallbackKey{}, true)
+}
+
+// modelFallbackDisabled 从上下文读取是否禁用模型降级
+func modelFallbackDisabled(ctx context.Context) bool {
+	disabled, _ := ctx.Value(noModelFallbackKey{}).(bool)
+	return disabled
+}
+
+// RewriteModel 改写请求体中的 model 字段，其余字段保持不变
+// 参数：
+//   - body: 请求体（JSON 对象）
+//   - model: 新的模型名
+//
+// 返回：
+//   - []byte: 改写后的请求体
+//   - error: 错误信息
+func RewriteModel(body []byte, model string) ([]byte, error) {
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(body, &fields); err != nil {
+		return nil, fmt.Errorf("解析请求体失败: %w", err)
+	}
+	value, err := json.Marshal(model)
+	if err != nil {
+		return nil, fmt.Errorf("序列化模型名失败: %w", err)
+	}
+	fields["model"] = value
+
+	rewritten, err := json.Marshal(fields)
+	if err != nil {
+		return nil, fmt.Errorf("序列化请求体失败: %w", err)
+	}
+	return rewritten, nil
+}
+
+// findModelFallback 查找模型的降级列表
+// 参数：
+//   - model: 模型名
+//
+// 返回：
+//   - []string: 按顺序尝试的替代模型（未配置时为 nil）
+func (r *Router) findModelFallback(model string) []string {
+	if r.config == nil || model == "" {
+		return nil
+	}
+	for _, rule := range r.config.ModelFallback {
+		if MatchModels(rule.Models, model) {
+			return rule.Fallbacks
+		}
+	}
+	return nil
+}
+
+// fallbackAllowed 判断调用方的 Key 是否有权使用替代模型
+// 白名单与 auth.ModelAllowed 规则一致：未经过鉴权或白名单为空时不限制
+func fallbackAllowed(ctx context.Context, model string) bool {
+	identity := types.IdentityFromContext(ctx)
+	if identity == nil || len(identity.AllowedModels) == 0 {
+		return true
+	}
+	return MatchModels(identity.AllowedModels, model)
+}
+
+// modelUnavailable 判断模型在所有后端上均不可用
+// 所有后端失败（含重试耗尽），或最终响应为 5xx / 429 时视为不可用
+func modelUnavailable(resp *http.Response, err error) bool {
+	if err != nil {
+		return true
+	}
+	return resp != nil && (resp.StatusCode >= 500 || resp.StatusCode == http.StatusTooManyRequests)
+}
+
+// proxyWithModelFallback 主模型不可用时按顺序降级到替代模型
+// 替代模型按自身的 model_routes / fallback 规则选择后端；降级成功时关闭主模型的响应，
+// 并在响应头 ModelFallbackHeader 中返回实际使用的模型。不在 Key 的 allowed_models 内的替代模型会被跳过
+// 参数：
+//   - req: HTTP 请求
+//   - bodyBytes: 请求体
+//   - model: 主模型名
+//   - resp: 主模型的响应（可为 nil）
+//   - backend: 主模型使用的后端
+//   - err: 主模型的错误
+//
+// 返回：
+//   - *http.Response: 响应
+//   - *lb.Backend: 使用的后端
+//   - error: 错误信息（所有替代模型都不可用时返回主模型的结果）
+func (r *Router) proxyWithModelFallback(req *http.Request, bodyBytes []byte, model string, resp *http.Response, backend *lb.Backend, err error) (*http.Response, *lb.Backend, error) {
+	if !modelUnavailable(resp, err) || modelFallbackDisabled(req.Context()) {
+		return resp, backend, err
+	}
+	fallbacks := r.findModelFallback(model)
+	if len(fallbacks) == 0 {
+		return resp, backend, err
+	}
+
+	for _, alt := range fallbacks {
+		if alt == model {
+			continue
+		}
+		if !fallbackAllowed(req.Context(), alt) {
+			log.Printf("跳过替代模型 %s: 不在 Key 的 allowed_models 内", alt)
+			continue
+		}
+		body, rerr := RewriteModel(bodyBytes, alt)
+		if rerr != nil {
+			log.Printf("模型降级失败: %v", rerr)
+			break
+		}
+
+		log.Printf("模型 %s 不可用，降级到: %s", model, alt)
+		altResp, altBackend, altErr := r.proxyModel(req, body, alt)
+		if modelUnavailable(altResp, altErr) {
+			if altResp != nil {
+				_ = altResp.Body.Close()
+			}
+			log.Printf("替代模型 %s 不可用: %v", alt, altErr)
+			continue
+		}
+
+		if resp != nil {
+			_ = resp.Body.Close()
+		}
+		metrics.RecordModelFallback(model, alt)
+		altResp.Header.Set(ModelFallbackHeader, alt)
+		return altResp, altBackend, nil
+	}
+
+	return resp, backend, err
+}
@@ -0,0 +1,141 @@
+package routing
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// testRetryConfig 不等待退避的重试配置
+var testRetryConfig = &RetryConfig{
+	Enabled:     true,
+	MaxRetries:  2,
+	InitialWait: time.Millisecond,
+	MaxWait:     time.Millisecond,
+	Multiplier:  1,
+}
+
+// abortStream 在已写出的内容之后直接断开连接，模拟上游流式响应中断
+func abortStream(t *testing.T, w http.ResponseWriter) {
+	w.(http.Flusher).Flush()
+	conn, _, err := w.(http.Hijacker).Hijack()
+	if err != nil {
+		t.Errorf("Hijack() error = %v", err)
+		return
+	}
+	_ = conn.Close()
+}
+
+// proxyStream 以流式请求代理一次并返回响应
+func proxyStream(router *Router) (*http.Response, error) {
+	req, body := newTestRequest("llama-3")
+	req = req.WithContext(WithStream(req.Context(), true))
+	resp, _, err := router.ProxyRequest(req, body, "llama-3")
+	return resp, err
+}
+
+func TestStreamRetriedBeforeFirstByte(t *testing.T) {
+	var hits atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/event-stream")
+		if hits.Add(1) == 1 {
+			// 首次请求：发送响应头后、首字节前断开
+			w.WriteHeader(http.StatusOK)
+			abortStream(t, w)
+			return
+		}
+		_, _ = io.WriteString(w, "data: ok\n\ndata: [DONE]\n\n")
+	}))
+	defer srv.Close()
+
+	router := NewRouter(&RoutingConfig{Enabled: true, Retry: testRetryConfig}, newTestBalancer(srv), nil)
+	resp, err := proxyStream(router)
+	if err != nil {
+		t.Fatalf("ProxyRequest() error = %v", err)
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatalf("read body: %v", err)
+	}
+	// 预读的首个数据块放回响应体，客户端读到完整内容
+	if string(body) != "data: ok\n\ndata: [DONE]\n\n" {
+		t.Errorf("body = %q", body)
+	}
+	if n := hits.Load(); n != 2 {
+		t.Errorf("upstream hits = %d, want 2 (one retry)", n)
+	}
+}
+
+func TestStreamNotRetriedAfterFirstByte(t *testing.T) {
+	var hits atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		hits.Add(1)
+		w.Header().Set("Content-Type", "text/event-stream")
+		_, _ = io.WriteString(w, "data: partial\n\n")
+		abortStream(t, w)
+	}))
+	defer srv.Close()
+
+	router := NewRouter(&RoutingConfig{Enabled: true, Retry: testRetryConfig}, newTestBalancer(srv), nil)
+	resp, err := proxyStream(router)
+	if err != nil {
+		t.Fatalf("ProxyRequest() error = %v, want the partial stream", err)
+	}
+	defer resp.Body.Close()
+
+	// 首字节已交给客户端：中途断开表现为读取错误，不再重试
+	body, err := io.ReadAll(resp.Body)
+	if err == nil {
+		t.Error("read body: error = nil, want the upstream disconnect")
+	}
+	if !strings.HasPrefix(string(body), "data: partial\n\n") {
+		t.Errorf("body = %q, want the forwarded first chunk", body)
+	}
+	if n := hits.Load(); n != 1 {
+		t.Errorf("upstream hits = %d, want 1 (no retry after first byte)", n)
+	}
+}
+
+func TestStreamEmptyBodyExhaustsRetries(t *testing.T) {
+	var hits atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		hits.Add(1)
+		// 直接返回空响应体：首字节前 EOF 同样可重试
+	}))
+	defer srv.Close()
+
+	router := NewRouter(&RoutingConfig{Enabled: true, Retry: testRetryConfig}, newTestBalancer(srv), nil)
+	if resp, err := proxyStream(router); err == nil {
+		resp.Body.Close()
+		t.Fatal("ProxyRequest() error = nil, want retries exhausted")
+	}
+	if n := hits.Load(); n != int32(testRetryConfig.MaxRetries+1) {
+		t.Errorf("upstream hits = %d, want %d", n, testRetryConfig.MaxRetries+1)
+	}
+}
+
+func TestNonStreamEmptyBodyNotRetried(t *testing.T) {
+	var hits atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		hits.Add(1)
+	}))
+	defer srv.Close()
+
+	// 非流式请求不预读响应体，行为不变
+	router := NewRouter(&RoutingConfig{Enabled: true, Retry: testRetryConfig}, newTestBalancer(srv), nil)
+	req, body := newTestRequest("llama-3")
+	resp, _, err := router.ProxyRequest(req, body, "llama-3")
+	if err != nil {
+		t.Fatalf("ProxyRequest() error = %v", err)
+	}
+	resp.Body.Close()
+	if n := hits.Load(); n != 1 {
+		t.Errorf("upstream hits = %d, want 1", n)
+	}
+}
@@ -0,0 +1,106 @@
+package routing
+
+import (
+	"context"
+	"log"
+	"sort"
+
+	"llmproxy/internal/lb"
+)
+
+// routeTargetContextKey 请求上下文中路由目标的键
+type routeTargetContextKey struct{}
+
+// WithRouteTarget 在上下文中写入 on_route 钩子指定的路由目标（由 handler 写入，路由器读取）
+// 参数：
+//   - ctx: 请求上下文
+//   - target: 后端 URL、后端名称或后端组名
+//
+// 返回：
+//   - context.Context: 新的上下文
+func WithRouteTarget(ctx context.Context, target string) context.Context {
+	return context.WithValue(ctx, routeTargetContextKey{}, target)
+}
+
+// RouteTarget 从上下文读取路由目标（未指定时返回空字符串）
+func RouteTarget(ctx context.Context) string {
+	target, _ := ctx.Value(routeTargetContextKey{}).(string)
+	return target
+}
+
+// resolveRouteTarget 解析 on_route 钩子指定的路由目标
+// 先按后端 URL / 名称查找（默认池优先，其次按组名顺序），再按后端组名查找。
+// 后端不存在、不健康或已达到后端限流上限时返回 nil，由调用方按默认规则路由
+// 参数：
+//   - target: 后端 URL、后端名称或后端组名
+//
+// 返回：
+//   - *lb.Backend: 指定的后端（目标为后端组时为 nil）
+//   - lb.LoadBalancer: 后端所在池或目标组的负载均衡器（nil 表示目标无效）
+//   - string: 后端池名称
+func (r *Router) resolveRouteTarget(target string) (*lb.Backend, lb.LoadBalancer, string) {
+	if backend, balancer, pool := r.findBackend(target); backend != nil {
+		if !backend.Healthy {
+			log.Printf("on_route 钩子指定的后端 %s 不健康，按默认规则路由", target)
+			return nil, nil, ""
+		}
+		if !r.allowBackend(backend) {
+			return nil, nil, ""
+		}
+		return backend, balancer, pool
+	}
+
+	if group, ok := r.groups[target]; ok {
+		return nil, group, target
+	}
+
+	log.Printf("on_route 钩子指定的后端或后端组不存在: %s，按默认规则路由", target)
+	return nil, nil, ""
+}
+
+// findBackend 按后端 URL / 名称查找后端及其所在的池（默认池优先，其次按组名顺序）
+// 参数：
+//   - target: 后端 URL 或名称
+//
+// 返回：
+//   - *lb.Backend: 后端实例（未找到时返回 nil）
+//   - lb.LoadBalancer: 后端所在池的负载均衡器
+//   - string: 后端池名称
+func (r *Router) findBackend(target string) (*lb.Backend, lb.LoadBalancer, string) {
+	if backend := lb.FindBackend(r.loadBalancer, target); backend != nil {
+		return backend, r.loadBalancer, lb.DefaultPool
+	}
+
+	names := make([]string, 0, len(r.groups))
+	for name := range r.groups {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		if backend := lb.FindBackend(r.groups[name], target); backend != nil {
+			return backend, r.groups[name], name
+		}
+	}
+	return nil, nil, ""
+}
+
+// ChooseRouteTarget 在负载均衡器中查找 on_route 钩子指定的后端（未启用智能路由时使用）
+// 参数：
+//   - balancer: 负载均衡器
+//   - target: 后端 URL 或名称
+//
+// 返回：
+//   - *lb.Backend: 后端实例（不存在或不健康时返回 nil，由调用方按默认规则选择）
+func ChooseRouteTarget(balancer lb.LoadBalancer, target string) *lb.Backend {
+	backend := lb.FindBackend(balancer, target)
+	if backend == nil {
+		log.Printf("on_route 钩子指定的后端不存在: %s，按默认规则路由", target)
+		return nil
+	}
+	if !backend.Healthy {
+		log.Printf("on_route 钩子指定的后端 %s 不健康，按默认规则路由", target)
+		return nil
+	}
+	lb.RecordDecision(lb.DefaultPool, backend, lb.ReasonHook, nil)
+	return backend
+}
@@ -0,0 +1,117 @@
+package routing
+
+import (
+	"context"
+	"net/http/httptest"
+	"testing"
+
+	"llmproxy/internal/config"
+	"llmproxy/internal/lb"
+)
+
+// proxyTargetName 以 on_route 钩子指定的目标代理一次请求，返回响应的后端名称
+func proxyTargetName(t *testing.T, router *Router, target, model string) string {
+	t.Helper()
+	req, body := newTestRequest(model)
+	req = req.WithContext(WithRouteTarget(context.Background(), target))
+	resp, _, err := router.ProxyRequest(req, body, model)
+	if err != nil {
+		t.Fatalf("ProxyRequest(target %q) error = %v", target, err)
+	}
+	defer resp.Body.Close()
+	return resp.Header.Get("X-Backend")
+}
+
+func TestRouteTargetOverridesRouting(t *testing.T) {
+	servers := map[string]*httptest.Server{
+		"a":     newTestBackend(t, "a"),
+		"b":     newTestBackend(t, "b"),
+		"gpu-a": newTestBackend(t, "gpu-a"),
+	}
+	router := NewRouter(&RoutingConfig{
+		Enabled:     true,
+		ModelRoutes: []ModelRoute{{Models: []string{"llama-*"}, Group: "gpu"}},
+	}, lb.NewRoundRobin(namedBackends(servers, "a", "b"), nil), nil)
+	router.SetGroups(map[string]lb.LoadBalancer{
+		"gpu": lb.NewRoundRobin(namedBackends(servers, "gpu-a"), nil),
+	})
+
+	tests := []struct {
+		name   string
+		target string
+		model  string
+		want   string
+	}{
+		{"按名称指定后端", "b", "gpt-4o", "b"},
+		{"按 URL 指定后端", servers["b"].URL, "gpt-4o", "b"},
+		{"优先于模型路由", "a", "llama-3", "a"},
+		{"指定后端组内的后端", "gpu-a", "gpt-4o", "gpu-a"},
+		{"指定后端组", "gpu", "gpt-4o", "gpu-a"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// 多次请求都应发往同一后端，不参与轮询
+			for i := 0; i < 3; i++ {
+				if got := proxyTargetName(t, router, tt.target, tt.model); got != tt.want {
+					t.Fatalf("request %d routed to %q, want %q", i, got, tt.want)
+				}
+			}
+		})
+	}
+}
+
+func TestRouteTargetInvalidFallsBack(t *testing.T) {
+	servers := map[string]*httptest.Server{
+		"a":     newTestBackend(t, "a"),
+		"b":     newTestBackend(t, "b"),
+		"gpu-a": newTestBackend(t, "gpu-a"),
+	}
+	balancer := lb.NewRoundRobin(namedBackends(servers, "a", "b"), nil)
+	router := NewRouter(&RoutingConfig{
+		Enabled:     true,
+		ModelRoutes: []ModelRoute{{Models: []string{"llama-*"}, Group: "gpu"}},
+	}, balancer, nil)
+	router.SetGroups(map[string]lb.LoadBalancer{
+		"gpu": lb.NewRoundRobin(namedBackends(servers, "gpu-a"), nil),
+	})
+	balancer.UpdateHealth(balancerBackends(balancer)[1], false)
+
+	tests := []struct {
+		name   string
+		target string
+		model  string
+		want   string
+	}{
+		{"不存在的后端按默认规则路由", "missing", "gpt-4o", "a"},
+		{"不存在的后端仍遵循模型路由", "http://127.0.0.1:1", "llama-3", "gpu-a"},
+		{"不健康的后端按默认规则路由", "b", "gpt-4o", "a"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := proxyTargetName(t, router, tt.target, tt.model); got != tt.want {
+				t.Errorf("routed to %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestChooseRouteTarget(t *testing.T) {
+	backends := []*config.Backend{
+		{Name: "a", URL: "http://a.example", Weight: 1},
+		{Name: "b", URL: "http://b.example", Weight: 1},
+	}
+	balancer := lb.NewRoundRobin(backends, nil)
+	balancer.UpdateHealth(balancerBackends(balancer)[1], false)
+
+	if got := ChooseRouteTarget(balancer, "a"); got == nil || got.Name != "a" {
+		t.Errorf("ChooseRouteTarget(a) = %v, want a", got)
+	}
+	if got := ChooseRouteTarget(balancer, "http://a.example"); got == nil || got.Name != "a" {
+		t.Errorf("ChooseRouteTarget(url) = %v, want a", got)
+	}
+	for _, target := range []string{"b", "missing"} {
+		if got := ChooseRouteTarget(balancer, target); got != nil {
+			t.Errorf("ChooseRouteTarget(%s) = %s, want nil", target, got.Name)
+		}
+	}
+}
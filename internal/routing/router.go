@@ -2,20 +2,31 @@ package routing
 
 import (
 	"bytes"
+	"context"
+	"errors"
 	"fmt"
+	"io"
 	"log"
 	"net/http"
+	"sync"
 	"time"
 
+	"llmproxy/internal/config"
 	"llmproxy/internal/lb"
+	"llmproxy/internal/tracing"
+	"llmproxy/internal/utils"
 )
 
 // Router 智能路由器
 type Router struct {
-	config       *RoutingConfig         // 路由配置
-	loadBalancer lb.LoadBalancer        // 负载均衡器
-	httpClient   *http.Client           // HTTP 客户端
-	backendMap   map[string]*lb.Backend // URL -> Backend 映射
+	config       *RoutingConfig             // 路由配置
+	loadBalancer lb.LoadBalancer            // 负载均衡器
+	httpClient   *http.Client               // HTTP 客户端
+	backendMap   map[string]*lb.Backend     // URL -> Backend 映射
+	groups       map[string]lb.LoadBalancer // 后端组名 -> 负载均衡器（用于 model_routes）
+	limiter      *backendLimiter            // 后端级限流（nil 表示未配置）
+	mu           sync.RWMutex               // 保护 backendMap 和 limiter（服务发现运行时更新）
+	upstream     *config.UpstreamConfig     // 上游请求头配置
 }
 
 // NewRouter 创建路由器
@@ -47,51 +58,203 @@ func NewRouter(config *RoutingConfig, loadBalancer lb.LoadBalancer, backends []*
 	}
 }
 
-// ProxyRequest 代理请求（带重试和故障转移）
+// SetGroups 设置后端组的负载均衡器
+// model_routes 匹配到的模型从对应组中选择后端，未匹配的模型使用默认负载均衡器
+// 参数：
+//   - groups: 后端组名 -> 负载均衡器
+func (r *Router) SetGroups(groups map[string]lb.LoadBalancer) {
+	r.groups = groups
+}
+
+// SetBackendLimits 按后端配置的 rate_limit 启用后端级限流
+// 达到上限的后端在选择时视为暂时不可用，改为尝试其他后端
+// 参数：
+//   - backends: 后端配置列表
+func (r *Router) SetBackendLimits(backends []*config.Backend) {
+	limiter := newBackendLimiter(backends)
+	r.mu.Lock()
+	r.limiter = limiter
+	r.mu.Unlock()
+	if limiter != nil {
+		log.Printf("后端限流已启用: %d 个后端", len(limiter.limits))
+	}
+}
+
+// UpdateBackends 服务发现的后端列表变化时更新故障转移使用的后端映射和后端级限流
+// URL 未变化的后端沿用原实例（保留健康状态），已有后端的限流令牌桶保持不变
+// 参数：
+//   - backends: 最新的后端配置列表
+func (r *Router) UpdateBackends(backends []*config.Backend) {
+	limiter := newBackendLimiter(backends)
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	backendMap := make(map[string]*lb.Backend, len(backends))
+	for _, b := range backends {
+		weight := b.Weight
+		if weight <= 0 {
+			weight = 1
+		}
+		if existing, ok := r.backendMap[b.URL]; ok && existing.Name == b.Name && existing.Weight == weight {
+			backendMap[b.URL] = existing
+			continue
+		}
+		backendMap[b.URL] = &lb.Backend{Name: b.Name, URL: b.URL, Weight: weight, Healthy: true}
+	}
+	r.backendMap = backendMap
+
+	if limiter != nil && r.limiter != nil {
+		limiter.limiter = r.limiter.limiter
+	}
+	r.limiter = limiter
+}
+
+// lookupBackend 按 URL 查找故障转移规则引用的后端
+func (r *Router) lookupBackend(url string) *lb.Backend {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return r.backendMap[url]
+}
+
+// backendLimits 返回当前的后端级限流（nil 表示未配置）
+func (r *Router) backendLimits() *backendLimiter {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return r.limiter
+}
+
+// SetUpstream 设置发往后端的请求头配置（User-Agent / Via）
+// 参数：
+//   - cfg: 上游请求头配置
+func (r *Router) SetUpstream(cfg *config.UpstreamConfig) {
+	r.upstream = cfg
+}
+
+// streamContextKey 请求上下文中流式标记的键
+type streamContextKey struct{}
+
+// WithStream 在上下文中标记请求是否为流式（由 handler 写入，路由器读取）
+// 流式请求只在上游首字节到达前重试，首字节转发给客户端后不再重试
+func WithStream(ctx context.Context, stream bool) context.Context {
+	return context.WithValue(ctx, streamContextKey{}, stream)
+}
+
+// isStream 从上下文读取流式标记
+func isStream(ctx context.Context) bool {
+	stream, _ := ctx.Value(streamContextKey{}).(bool)
+	return stream
+}
+
+// ProxyRequest 代理请求（带重试、故障转移和模型降级）
 // 参数：
 //   - r: HTTP 请求
 //   - bodyBytes: 请求体
-//   - model: 模型名（已废弃，保留参数以兼容）
+//   - model: 模型名（用于匹配故障转移规则、模型路由和模型降级规则）
 //
 // 返回：
-//   - *http.Response: 响应
+//   - *http.Response: 响应（发生模型降级时带 ModelFallbackHeader 响应头）
 //   - *lb.Backend: 使用的后端
 //   - error: 错误信息
 func (r *Router) ProxyRequest(req *http.Request, bodyBytes []byte, model string) (*http.Response, *lb.Backend, error) {
+	resp, backend, err := r.proxyModel(req, bodyBytes, model)
+	return r.proxyWithModelFallback(req, bodyBytes, model, resp, backend, err)
+}
+
+// proxyModel 按模型代理请求（带重试和后端故障转移）
+// 参数：
+//   - req: HTTP 请求
+//   - bodyBytes: 请求体
+//   - model: 模型名
+//
+// 返回：
+//   - *http.Response: 响应
+//   - *lb.Backend: 使用的后端
+//   - error: 错误信息
+func (r *Router) proxyModel(req *http.Request, bodyBytes []byte, model string) (*http.Response, *lb.Backend, error) {
+	// on_route 钩子指定了后端或后端组：优先于故障转移规则和模型路由
+	if target := RouteTarget(req.Context()); target != "" {
+		if backend, balancer, pool := r.resolveRouteTarget(target); balancer != nil {
+			reason := ""
+			if backend != nil {
+				reason = lb.ReasonHook
+			}
+			return r.proxyWithPool(req, bodyBytes, model, balancer, pool, backend, reason)
+		}
+	}
+
+	// 金丝雀分流：匹配的请求按哈希 Key 分到金丝雀后端或稳定侧
+	if cfg := r.canaryConfig(); cfg != nil && canaryMatch(cfg, req, model) {
+		return r.proxyCanary(req, bodyBytes, model, cfg)
+	}
+
+	return r.proxyFallback(req, bodyBytes, model)
+}
+
+// proxyFallback 按故障转移规则代理请求（没有规则时使用负载均衡器选择后端）
+// 参数：
+//   - req: HTTP 请求
+//   - bodyBytes: 请求体
+//   - model: 模型名
+//
+// 返回：
+//   - *http.Response: 响应
+//   - *lb.Backend: 使用的后端
+//   - error: 错误信息
+func (r *Router) proxyFallback(req *http.Request, bodyBytes []byte, model string) (*http.Response, *lb.Backend, error) {
 	// 查找 fallback 规则
 	rule := r.findFallbackRule(model)
 
 	if rule == nil {
 		// 没有 fallback 规则，使用负载均衡器选择后端
-		return r.proxyWithRetry(req, bodyBytes, model, nil)
+		return r.proxyWithRetry(req, bodyBytes, model, nil, "")
 	}
 
+	// 记录每个后端的失败原因，最终汇总返回
+	var errs []error
+
 	// 尝试主后端
-	primary := r.backendMap[rule.Primary]
-	if primary != nil && primary.Healthy {
-		resp, backend, err := r.proxyWithRetry(req, bodyBytes, model, primary)
+	primary := r.lookupBackend(rule.Primary)
+	if primary != nil && primary.Healthy && r.allowBackend(primary) {
+		resp, backend, err := r.proxyWithRetry(req, bodyBytes, model, primary, lb.ReasonFallbackPrimary)
 		if err == nil {
 			return resp, backend, nil
 		}
 		log.Printf("主后端 %s 失败: %v", rule.Primary, err)
+		errs = append(errs, fmt.Errorf("%s: %w", rule.Primary, err))
 	}
 
 	// 尝试备用后端
+	attempts := 0
 	for _, fallbackURL := range rule.Fallback {
-		backend := r.backendMap[fallbackURL]
+		backend := r.lookupBackend(fallbackURL)
 		if backend == nil || !backend.Healthy {
 			continue
 		}
 
+		// 超过最大备用尝试次数，快速失败
+		if rule.MaxFallbackAttempts > 0 && attempts >= rule.MaxFallbackAttempts {
+			log.Printf("已达到最大故障转移次数 %d，停止尝试", rule.MaxFallbackAttempts)
+			break
+		}
+		if !r.allowBackend(backend) {
+			continue
+		}
+		attempts++
+
 		log.Printf("故障转移到: %s", fallbackURL)
-		resp, backend, err := r.proxyWithRetry(req, bodyBytes, model, backend)
+		resp, backend, err := r.proxyWithRetry(req, bodyBytes, model, backend, lb.ReasonFallback)
 		if err == nil {
 			return resp, backend, nil
 		}
 		log.Printf("备用后端 %s 失败: %v", fallbackURL, err)
+		errs = append(errs, fmt.Errorf("%s: %w", fallbackURL, err))
 	}
 
-	return nil, nil, fmt.Errorf("所有后端均失败，模型: %s", model)
+	if len(errs) == 0 {
+		return nil, nil, fmt.Errorf("所有后端均失败，模型: %s", model)
+	}
+	return nil, nil, fmt.Errorf("所有后端均失败，模型: %s: %w", model, errors.Join(errs...))
 }
 
 // proxyWithRetry 代理请求（带重试）
@@ -100,45 +263,76 @@ func (r *Router) ProxyRequest(req *http.Request, bodyBytes []byte, model string)
 //   - bodyBytes: 请求体
 //   - model: 模型名
 //   - backend: 指定后端（nil 表示使用负载均衡器选择）
+//   - reason: 指定后端时的选择原因（fallback_primary / fallback）
+//
+// 返回：
+//   - *http.Response: 响应
+//   - *lb.Backend: 使用的后端
+//   - error: 错误信息
+func (r *Router) proxyWithRetry(req *http.Request, bodyBytes []byte, model string, backend *lb.Backend, reason string) (*http.Response, *lb.Backend, error) {
+	// 按模型选择后端池
+	balancer, pool := r.balancerFor(model)
+	return r.proxyWithPool(req, bodyBytes, model, balancer, pool, backend, reason)
+}
+
+// proxyWithPool 在指定后端池中代理请求（带重试）
+// 参数：
+//   - req: HTTP 请求
+//   - bodyBytes: 请求体
+//   - model: 模型名
+//   - balancer: 后端池的负载均衡器
+//   - pool: 后端池名称
+//   - backend: 指定后端（nil 表示使用负载均衡器选择）
+//   - reason: 指定后端时的选择原因
 //
 // 返回：
 //   - *http.Response: 响应
 //   - *lb.Backend: 使用的后端
 //   - error: 错误信息
-func (r *Router) proxyWithRetry(req *http.Request, bodyBytes []byte, model string, backend *lb.Backend) (*http.Response, *lb.Backend, error) {
+func (r *Router) proxyWithPool(req *http.Request, bodyBytes []byte, model string, balancer lb.LoadBalancer, pool string, backend *lb.Backend, reason string) (*http.Response, *lb.Backend, error) {
 	var resp *http.Response
 	var selectedBackend *lb.Backend
 	var lastErr error
 
 	// 重试逻辑
+	stream := isStream(req.Context())
+	attempt := 0
 	err := retryRequest(r.config.Retry, func() (int, error) {
+		// 关闭上一次尝试的响应（重试前）
+		if resp != nil {
+			_ = resp.Body.Close()
+			resp = nil
+		}
+
 		// 选择后端
 		if backend == nil {
-			selectedBackend = r.loadBalancer.Next()
-			if selectedBackend == nil {
-				return 503, fmt.Errorf("没有可用的健康后端")
+			if r.backendLimits() == nil && r.canaryConfig() == nil {
+				selectedBackend = lb.Choose(balancer, lb.HashKeyFromContext(req.Context()), pool)
+				if selectedBackend == nil {
+					return 503, fmt.Errorf("没有可用的健康后端")
+				}
+			} else {
+				selectedBackend = lb.ChooseAllowed(balancer, lb.HashKeyFromContext(req.Context()), pool, r.selectable)
+				if selectedBackend == nil {
+					return 503, fmt.Errorf("没有可用的后端（不健康或已达到后端限流上限）")
+				}
 			}
 		} else {
+			// 指定的后端不经过 Next，先登记在途请求，与 send 中的 RecordResult 成对
 			selectedBackend = backend
+			lb.Acquire(balancer, backend)
+			lb.RecordDecision(pool, backend, reason, nil)
 		}
 
-		// 构造代理请求
-		proxyReq, err := http.NewRequest(req.Method, selectedBackend.URL+req.URL.Path, bytes.NewReader(bodyBytes))
-		if err != nil {
-			return 0, err
+		attempt++
+		a := &sendAttempt{req: req, body: bodyBytes, model: model, attempt: attempt, stream: stream, balancer: balancer}
+		var err error
+		if hedge := r.hedgeConfig(); hedge != nil && backend == nil && !stream {
+			// 对冲请求只用于负载均衡选择的非流式请求（故障转移规则或钩子指定的后端不对冲）
+			resp, selectedBackend, err = r.sendHedged(a, pool, selectedBackend, hedge)
+		} else {
+			resp, err = r.send(req.Context(), a, selectedBackend, false)
 		}
-
-		// 复制请求头
-		proxyReq.Header = req.Header.Clone()
-
-		// 发送请求
-		start := time.Now()
-		resp, err = r.httpClient.Do(proxyReq)
-		latency := time.Since(start)
-
-		// 记录结果
-		r.loadBalancer.RecordResult(selectedBackend, latency, err)
-
 		if err != nil {
 			lastErr = err
 			return 0, err
@@ -149,6 +343,9 @@ func (r *Router) proxyWithRetry(req *http.Request, bodyBytes []byte, model strin
 	})
 
 	if err != nil {
+		if resp != nil {
+			_ = resp.Body.Close()
+		}
 		if lastErr != nil {
 			return nil, selectedBackend, lastErr
 		}
@@ -158,6 +355,119 @@ func (r *Router) proxyWithRetry(req *http.Request, bodyBytes []byte, model strin
 	return resp, selectedBackend, nil
 }
 
+// sendAttempt 一次尝试的请求参数
+type sendAttempt struct {
+	req      *http.Request
+	body     []byte
+	model    string
+	attempt  int
+	stream   bool
+	balancer lb.LoadBalancer
+}
+
+// send 向指定后端发送一次请求，并将结果记录到负载均衡器
+// 参数：
+//   - ctx: 请求上下文（对冲请求使用可取消的子上下文）
+//   - a: 请求参数
+//   - backend: 目标后端
+//   - hedged: 是否为对冲追加的请求（记录到追踪 Span）
+//
+// 返回：
+//   - *http.Response: 响应
+//   - error: 错误信息
+func (r *Router) send(ctx context.Context, a *sendAttempt, backend *lb.Backend, hedged bool) (*http.Response, error) {
+	// 每次尝试一个追踪 Span（未启用追踪时 span 为 nil）
+	ctx, span := tracing.Start(ctx, "backend.request", tracing.KindClient)
+	defer span.End()
+	span.SetAttr("backend.url", backend.URL)
+	span.SetAttr("backend.name", backend.Name)
+	span.SetAttr("llm.model", a.model)
+	span.SetAttr("retry.attempt", a.attempt)
+	if hedged {
+		span.SetAttr("hedge", true)
+	}
+
+	// 构造代理请求
+	proxyReq, err := http.NewRequestWithContext(ctx, a.req.Method, backend.URL+a.req.URL.Path, bytes.NewReader(a.body))
+	if err != nil {
+		span.SetError(err)
+		return nil, err
+	}
+
+	// 复制请求头
+	proxyReq.Header = a.req.Header.Clone()
+	utils.StampUpstreamHeaders(proxyReq.Header, r.upstream)
+	tracing.Inject(ctx, proxyReq.Header)
+
+	// 发送请求
+	backend.StartRequest()
+	start := time.Now()
+	resp, err := r.httpClient.Do(proxyReq)
+
+	// 流式请求：预读首个数据块，首字节前失败视为可重试错误
+	if err == nil && a.stream && resp.StatusCode >= 200 && resp.StatusCode < 300 {
+		if err = peekFirstChunk(resp); err != nil {
+			_ = resp.Body.Close()
+			resp = nil
+		}
+	}
+	latency := time.Since(start)
+
+	// 记录结果
+	backend.EndRequest(latency, err)
+	a.balancer.RecordResult(backend, latency, err)
+
+	if err != nil {
+		span.SetError(err)
+		return nil, err
+	}
+	span.SetHTTPStatus(resp.StatusCode)
+	return resp, nil
+}
+
+// replayBody 先返回已预读的数据，再继续读取原始响应体
+type replayBody struct {
+	io.Reader
+	io.Closer
+}
+
+// peekFirstChunk 预读流式响应的首个数据块
+// 读取成功后将数据放回响应体，调用方仍能读到完整响应；
+// 上游在首字节前断开（包括直接 EOF）时返回错误，此时尚未向客户端写入任何数据，可以安全重试
+// 参数：
+//   - resp: 上游响应
+//
+// 返回：
+//   - error: 首字节前的读取错误
+func peekFirstChunk(resp *http.Response) error {
+	buf := make([]byte, 4096)
+	for {
+		n, err := resp.Body.Read(buf)
+		if n > 0 {
+			resp.Body = &replayBody{
+				Reader: io.MultiReader(bytes.NewReader(buf[:n]), resp.Body),
+				Closer: resp.Body,
+			}
+			return nil
+		}
+		if err == io.EOF {
+			return fmt.Errorf("流式响应在首字节前中断: %w", io.ErrUnexpectedEOF)
+		}
+		if err != nil {
+			return fmt.Errorf("流式响应在首字节前中断: %w", err)
+		}
+	}
+}
+
+// allowBackend 检查故障转移规则指定的后端是否未达到限流上限
+func (r *Router) allowBackend(backend *lb.Backend) bool {
+	if r.backendLimits().allow(backend) {
+		return true
+	}
+	log.Printf("后端 %s 已达到限流上限，跳过", backend.URL)
+	return false
+}
+
 // findFallbackRule 查找适用的 fallback 规则
 // 参数：
 //   - model: 模型名
@@ -176,19 +486,59 @@ func (r *Router) findFallbackRule(model string) *FallbackRule {
 		}
 
 		// 检查模型是否匹配
-		for _, m := range rule.Models {
-			if m == model {
-				return &rule
-			}
-			// 支持通配符匹配
-			if len(m) > 0 && m[len(m)-1] == '*' {
-				prefix := m[:len(m)-1]
-				if len(model) >= len(prefix) && model[:len(prefix)] == prefix {
-					return &rule
-				}
-			}
+		if MatchModels(rule.Models, model) {
+			return &rule
 		}
 	}
 
 	return nil
 }
+
+// balancerFor 根据模型选择负载均衡器
+// 参数：
+//   - model: 模型名
+//
+// 返回：
+//   - lb.LoadBalancer: 匹配到的后端组负载均衡器，未匹配时返回默认负载均衡器
+//   - string: 后端池名称（后端组名或 lb.DefaultPool）
+func (r *Router) balancerFor(model string) (lb.LoadBalancer, string) {
+	if r.config == nil || len(r.groups) == 0 || model == "" {
+		return r.loadBalancer, lb.DefaultPool
+	}
+
+	for _, route := range r.config.ModelRoutes {
+		if !MatchModels(route.Models, model) {
+			continue
+		}
+		if balancer, ok := r.groups[route.Group]; ok {
+			return balancer, route.Group
+		}
+		log.Printf("模型路由: 后端组 %s 不存在，使用默认后端池", route.Group)
+		break
+	}
+
+	return r.loadBalancer, lb.DefaultPool
+}
+
+// MatchModels 检查模型是否匹配列表中的任一模式
+// 参数：
+//   - patterns: 模型模式列表（支持 * 后缀通配）
+//   - model: 模型名
+//
+// 返回：
+//   - bool: 是否匹配
+func MatchModels(patterns []string, model string) bool {
+	for _, m := range patterns {
+		if m == model {
+			return true
+		}
+		// 支持通配符匹配
+		if len(m) > 0 && m[len(m)-1] == '*' {
+			prefix := m[:len(m)-1]
+			if len(model) >= len(prefix) && model[:len(prefix)] == prefix {
+				return true
+			}
+		}
+	}
+	return false
+}
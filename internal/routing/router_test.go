@@ -0,0 +1,198 @@
+package routing
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"llmproxy/internal/config"
+	"llmproxy/internal/lb"
+)
+
+// newTestBackend 启动一个在 X-Backend 响应头中返回自身名称的测试后端
+func newTestBackend(t *testing.T, name string) *httptest.Server {
+	t.Helper()
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("X-Backend", name)
+		_, _ = w.Write([]byte(`{"backend":"` + name + `"}`))
+	}))
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+// newTestBalancer 用测试后端创建轮询负载均衡器
+func newTestBalancer(servers ...*httptest.Server) lb.LoadBalancer {
+	backends := make([]*config.Backend, len(servers))
+	for i, srv := range servers {
+		backends[i] = &config.Backend{URL: srv.URL, Weight: 1}
+	}
+	return lb.NewRoundRobin(backends, nil)
+}
+
+// balancerBackends 返回负载均衡器中的后端列表
+func balancerBackends(balancer lb.LoadBalancer) []*lb.Backend {
+	return balancer.(interface{ GetBackends() []*lb.Backend }).GetBackends()
+}
+
+// newTestRequest 创建一个聊天补全请求
+func newTestRequest(model string) (*http.Request, []byte) {
+	body := []byte(`{"model":"` + model + `","messages":[]}`)
+	return httptest.NewRequest(http.MethodPost, "/v1/chat/completions", strings.NewReader(string(body))), body
+}
+
+// proxyBackendName 代理一次请求并返回响应的后端名称
+func proxyBackendName(t *testing.T, router *Router, model string) string {
+	t.Helper()
+	req, body := newTestRequest(model)
+	resp, _, err := router.ProxyRequest(req, body, model)
+	if err != nil {
+		t.Fatalf("ProxyRequest(%q) error = %v", model, err)
+	}
+	defer resp.Body.Close()
+	return resp.Header.Get("X-Backend")
+}
+
+func TestMatchModels(t *testing.T) {
+	tests := []struct {
+		name     string
+		patterns []string
+		model    string
+		want     bool
+	}{
+		{"精确匹配", []string{"llama-3"}, "llama-3", true},
+		{"精确不匹配", []string{"llama-3"}, "llama-3.1", false},
+		{"通配前缀", []string{"gpt-4*"}, "gpt-4o", true},
+		{"通配匹配前缀本身", []string{"gpt-4*"}, "gpt-4", true},
+		{"通配不匹配", []string{"gpt-4*"}, "gpt-3.5-turbo", false},
+		{"任一模式匹配", []string{"claude-*", "gpt-4*"}, "gpt-4-turbo", true},
+		{"单独星号匹配所有", []string{"*"}, "anything", true},
+		{"空列表", nil, "gpt-4o", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := MatchModels(tt.patterns, tt.model); got != tt.want {
+				t.Errorf("MatchModels(%v, %q) = %v, want %v", tt.patterns, tt.model, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRouterModelRoutes(t *testing.T) {
+	def := newTestBackend(t, "default")
+	vendor := newTestBackend(t, "vendor")
+	gpu := newTestBackend(t, "gpu")
+
+	router := NewRouter(&RoutingConfig{
+		Enabled: true,
+		ModelRoutes: []ModelRoute{
+			{Models: []string{"gpt-4*"}, Group: "vendor"},
+			{Models: []string{"llama-3"}, Group: "gpu"},
+			{Models: []string{"mistral"}, Group: "missing"},
+		},
+	}, newTestBalancer(def), nil)
+	router.SetGroups(map[string]lb.LoadBalancer{
+		"vendor": newTestBalancer(vendor),
+		"gpu":    newTestBalancer(gpu),
+	})
+
+	tests := []struct {
+		name  string
+		model string
+		want  string
+	}{
+		{"精确匹配", "llama-3", "gpu"},
+		{"通配匹配", "gpt-4o", "vendor"},
+		{"通配匹配另一模型", "gpt-4-turbo", "vendor"},
+		{"未匹配使用默认池", "llama-3.1", "default"},
+		{"后端组不存在使用默认池", "mistral", "default"},
+		{"未指定模型使用默认池", "", "default"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := proxyBackendName(t, router, tt.model); got != tt.want {
+				t.Errorf("model %q routed to %q, want %q", tt.model, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRouterModelRouteSkipsUnhealthyGroupBackends(t *testing.T) {
+	def := newTestBackend(t, "default")
+	a := newTestBackend(t, "gpu-a")
+	b := newTestBackend(t, "gpu-b")
+
+	group := newTestBalancer(a, b)
+	group.UpdateHealth(balancerBackends(group)[0], false)
+
+	router := NewRouter(&RoutingConfig{
+		Enabled:     true,
+		ModelRoutes: []ModelRoute{{Models: []string{"llama-*"}, Group: "gpu"}},
+	}, newTestBalancer(def), nil)
+	router.SetGroups(map[string]lb.LoadBalancer{"gpu": group})
+
+	for i := 0; i < 4; i++ {
+		if got := proxyBackendName(t, router, "llama-3"); got != "gpu-b" {
+			t.Fatalf("request %d routed to %q, want the healthy group backend gpu-b", i, got)
+		}
+	}
+
+	// 后端组内没有健康后端时不回退到默认池
+	group.UpdateHealth(balancerBackends(group)[1], false)
+	req, body := newTestRequest("llama-3")
+	if resp, _, err := router.ProxyRequest(req, body, "llama-3"); err == nil {
+		resp.Body.Close()
+		t.Fatal("ProxyRequest() with no healthy group backend: error = nil")
+	}
+}
+
+func TestRouterUpdateBackends(t *testing.T) {
+	servers := map[string]*httptest.Server{
+		"a": newTestBackend(t, "a"),
+		"b": newTestBackend(t, "b"),
+		"c": newTestBackend(t, "c"),
+	}
+	router := NewRouter(&RoutingConfig{
+		Enabled:  true,
+		Fallback: []config.FallbackRule{{Primary: servers["b"].URL, Fallback: []string{servers["c"].URL}}},
+	}, newTestBalancer(servers["a"]), []*lb.Backend{{Name: "a", URL: servers["a"].URL, Weight: 1, Healthy: true}})
+
+	// 启动时只有 a：规则中的后端都不存在
+	req, body := newTestRequest("m")
+	if resp, _, err := router.ProxyRequest(req, body, "m"); err == nil {
+		resp.Body.Close()
+		t.Fatal("ProxyRequest() succeeded before b and c were discovered")
+	}
+
+	// 服务发现新增 b 和 c 后，故障转移规则使用主后端
+	router.UpdateBackends(namedBackends(servers, "a", "b", "c"))
+	if got := proxyBackendName(t, router, "m"); got != "b" {
+		t.Errorf("after adding b and c: backend = %s, want b", got)
+	}
+
+	// 后端级限流随后端配置更新：b 达到上限后故障转移到 c
+	backends := namedBackends(servers, "a", "b", "c")
+	backends[1].RateLimit = &config.BackendRateLimit{RequestsPerSecond: 1, BurstSize: 1}
+	router.UpdateBackends(backends)
+	if got := []string{proxyBackendName(t, router, "m"), proxyBackendName(t, router, "m")}; got[0] != "b" || got[1] != "c" {
+		t.Errorf("with b limited: backends = %v, want [b c]", got)
+	}
+	// 再次更新不重置已有后端的令牌桶
+	router.UpdateBackends(backends)
+	if got := proxyBackendName(t, router, "m"); got != "c" {
+		t.Errorf("after an unchanged update: backend = %s, want c (b still at its limit)", got)
+	}
+
+	// 删除 b：直接使用备用后端
+	router.UpdateBackends(namedBackends(servers, "a", "c"))
+	if got := proxyBackendName(t, router, "m"); got != "c" {
+		t.Errorf("after removing b: backend = %s, want c", got)
+	}
+
+	// URL 未变化的后端保留健康状态
+	router.lookupBackend(servers["c"].URL).Healthy = false
+	router.UpdateBackends(namedBackends(servers, "a", "c"))
+	if backend := router.lookupBackend(servers["c"].URL); backend == nil || backend.Healthy {
+		t.Errorf("c after update = %+v, want the existing unhealthy instance", backend)
+	}
+}
@@ -66,7 +66,7 @@ func (a *AuthScript) CheckAuth(
 		return nil, nil
 	}
 	vm := vmInterface.(*lua.LState)
-	defer a.engine.vmPool.Put(vm)
+	defer a.engine.release(vm)
 
 	// 构造 request 表
 	requestTable := vm.NewTable()
@@ -85,6 +85,7 @@ func (a *AuthScript) CheckAuth(
 	keyInfoTable.RawSetString("status", lua.LString(keyInfo.Status))
 	keyInfoTable.RawSetString("total_quota", lua.LNumber(keyInfo.TotalQuota))
 	keyInfoTable.RawSetString("used_quota", lua.LNumber(keyInfo.UsedQuota))
+	keyInfoTable.RawSetString("rollover_quota", lua.LNumber(keyInfo.RolloverQuota))
 
 	// 添加 allowed_ips
 	allowedIPsTable := vm.NewTable()
@@ -108,7 +109,7 @@ func (a *AuthScript) CheckAuth(
 	vm.SetGlobal("standard_checks", standardChecksTable)
 
 	// 执行脚本
-	if err := vm.DoString(a.engine.script); err != nil {
+	if err := a.engine.run(vm); err != nil {
 		log.Printf("鉴权脚本执行失败: %v", err)
 		return nil, err
 	}
@@ -0,0 +1,67 @@
+package scripting
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	lua "github.com/yuin/gopher-lua"
+	"github.com/yuin/gopher-lua/parse"
+)
+
+// Compile 将 Lua 脚本源码编译为字节码
+// 编译结果不绑定 VM，可以在多个 VM 之间共享，避免每次执行都重新解析源码
+// 参数：
+//   - source: 脚本内容
+//   - name: 脚本名称（用于错误信息）
+//
+// 返回：
+//   - *lua.FunctionProto: 编译后的函数原型
+//   - error: 语法错误
+func Compile(source, name string) (*lua.FunctionProto, error) {
+	return compile(strings.NewReader(source), name)
+}
+
+// CompileFile 将 Lua 脚本文件编译为字节码
+// 参数：
+//   - path: 脚本文件路径
+//
+// 返回：
+//   - *lua.FunctionProto: 编译后的函数原型
+//   - error: 读取或语法错误
+func CompileFile(path string) (*lua.FunctionProto, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("读取脚本文件失败: %w", err)
+	}
+	defer file.Close()
+
+	return compile(bufio.NewReader(file), path)
+}
+
+// compile 解析并编译脚本
+func compile(reader io.Reader, name string) (*lua.FunctionProto, error) {
+	chunk, err := parse.Parse(reader, name)
+	if err != nil {
+		return nil, fmt.Errorf("脚本语法错误: %w", err)
+	}
+	proto, err := lua.Compile(chunk, name)
+	if err != nil {
+		return nil, fmt.Errorf("脚本编译失败: %w", err)
+	}
+	return proto, nil
+}
+
+// DoProto 在 VM 中执行已编译的脚本（等价于 DoString/DoFile，返回值留在栈上）
+// 参数：
+//   - vm: Lua VM
+//   - proto: 编译后的函数原型
+//
+// 返回：
+//   - error: 执行错误
+func DoProto(vm *lua.LState, proto *lua.FunctionProto) error {
+	vm.Push(vm.NewFunctionFromProto(proto))
+	return vm.PCall(0, lua.MultRet, nil)
+}
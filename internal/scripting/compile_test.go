@@ -0,0 +1,137 @@
+package scripting
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+
+	lua "github.com/yuin/gopher-lua"
+)
+
+// benchScript 用于基准测试的较大脚本：多个辅助函数加一个入口函数
+var benchScript = func() string {
+	var b strings.Builder
+	b.WriteString("local M = {}\n")
+	for i := 0; i < 200; i++ {
+		fmt.Fprintf(&b, "M.helper%d = function(t) local s = %d for _, v in ipairs(t) do s = s + v end return s end\n", i, i)
+	}
+	b.WriteString("function add(a, b) return a + b end\n")
+	b.WriteString("return add(1, 2)\n")
+	return b.String()
+}()
+
+func TestCompileSyntaxError(t *testing.T) {
+	if _, err := Compile("return {", "<test>"); err == nil || !strings.Contains(err.Error(), "脚本语法错误") {
+		t.Errorf("Compile() error = %v, want a syntax error", err)
+	}
+	if _, err := CompileFile(filepath.Join(t.TempDir(), "missing.lua")); err == nil {
+		t.Error("CompileFile(missing) error = nil")
+	}
+	if _, err := NewEngine(&EngineConfig{Script: "function f( end"}); err == nil {
+		t.Error("NewEngine() with a syntax error: error = nil")
+	}
+}
+
+func TestCompiledScriptAcrossPooledVMs(t *testing.T) {
+	engine, err := NewEngine(&EngineConfig{Script: `
+calls = 0
+function add(a, b)
+	calls = calls + 1
+	return a + b
+end
+`})
+	if err != nil {
+		t.Fatalf("NewEngine() error = %v", err)
+	}
+	defer engine.Close()
+
+	// 并发执行时池中会创建多个 VM，每个 VM 都加载同一份字节码
+	var wg sync.WaitGroup
+	errs := make(chan string, 1000)
+	for g := 0; g < 20; g++ {
+		wg.Add(1)
+		go func(g int) {
+			defer wg.Done()
+			for i := 0; i < 50; i++ {
+				ret, err := engine.Execute("add", lua.LNumber(g), lua.LNumber(i))
+				if err != nil {
+					errs <- err.Error()
+					return
+				}
+				if ret != lua.LNumber(g+i) {
+					errs <- "add(" + lua.LNumber(g).String() + ", " + lua.LNumber(i).String() + ") = " + ret.String()
+					return
+				}
+			}
+		}(g)
+	}
+	wg.Wait()
+	close(errs)
+	for msg := range errs {
+		t.Error(msg)
+	}
+}
+
+func TestScriptFileCompiledOnce(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "script.lua")
+	if err := os.WriteFile(path, []byte("return 42"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	engine, err := NewEngine(&EngineConfig{ScriptFile: path})
+	if err != nil {
+		t.Fatalf("NewEngine() error = %v", err)
+	}
+	defer engine.Close()
+
+	// 文件被改坏后，执行仍使用创建引擎时编译的字节码，不重新读取源码
+	if err := os.WriteFile(path, []byte("return {"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 3; i++ {
+		ret, err := engine.ExecuteSimple(nil)
+		if err != nil || ret != lua.LNumber(42) {
+			t.Fatalf("ExecuteSimple() = %v, %v; want 42", ret, err)
+		}
+	}
+
+	// Reload 时重新编译，语法错误保留旧脚本
+	if err := engine.Reload(); err == nil {
+		t.Error("Reload() with a syntax error: error = nil")
+	}
+	if ret, err := engine.ExecuteSimple(nil); err != nil || ret != lua.LNumber(42) {
+		t.Errorf("ExecuteSimple() after failed reload = %v, %v; want 42", ret, err)
+	}
+}
+
+// BenchmarkLoadSource 每次执行都解析源码（预编译之前的做法）
+func BenchmarkLoadSource(b *testing.B) {
+	vm := lua.NewState()
+	defer vm.Close()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if err := vm.DoString(benchScript); err != nil {
+			b.Fatal(err)
+		}
+		vm.Pop(1)
+	}
+}
+
+// BenchmarkLoadProto 执行预编译的字节码
+func BenchmarkLoadProto(b *testing.B) {
+	proto, err := Compile(benchScript, "<bench>")
+	if err != nil {
+		b.Fatal(err)
+	}
+	vm := lua.NewState()
+	defer vm.Close()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if err := DoProto(vm, proto); err != nil {
+			b.Fatal(err)
+		}
+		vm.Pop(1)
+	}
+}
@@ -21,7 +21,8 @@ type ScriptConfig struct {
 	Script     string        `yaml:"script"`      // 脚本内容（内联）
 	ScriptFile string        `yaml:"script_file"` // 脚本文件路径
 	Timeout    time.Duration `yaml:"timeout"`     // 执行超时时间
-	MaxMemory  int           `yaml:"max_memory"`  // 最大内存限制
+	MaxMemory  int           `yaml:"max_memory"`  // 最大内存限制（MB，0 表示不限制）
+	ModulePath []string      `yaml:"module_path"` // require 的模块搜索目录
 }
 
 // ToEngineConfig 转换为引擎配置
@@ -32,6 +33,7 @@ func (c *ScriptConfig) ToEngineConfig() *EngineConfig {
 		Script:     c.Script,
 		ScriptFile: c.ScriptFile,
 		Timeout:    c.Timeout,
-		MaxMemory:  c.MaxMemory,
+		MaxMemory:  MB(c.MaxMemory),
+		ModulePath: c.ModulePath,
 	}
 }
@@ -15,9 +15,12 @@ type Engine struct {
 	scriptFile  string        // 脚本文件路径
 	vmPool      *sync.Pool    // VM 池
 	timeout     time.Duration // 脚本执行超时时间
-	maxMemory   int           // 最大内存限制（字节）
+	maxMemory   int64         // 最大内存限制（字节，0 表示不限制）
 	initialized bool          // 是否已初始化
 	mu          sync.RWMutex  // 读写锁
+
+	proto      *lua.FunctionProto // 编译后的脚本字节码（所有 VM 共享）
+	modulePath []string           // require 的模块搜索目录
 }
 
 // EngineConfig 引擎配置
@@ -25,7 +28,8 @@ type EngineConfig struct {
 	Script     string        // 脚本内容（内联）
 	ScriptFile string        // 脚本文件路径
 	Timeout    time.Duration // 执行超时时间（默认 100ms）
-	MaxMemory  int           // 最大内存限制（默认 10MB）
+	MaxMemory  int64         // 最大内存限制（字节，0 表示不限制）
+	ModulePath []string      // require 的模块搜索目录（为空时禁用 require）
 }
 
 // NewEngine 创建 Lua 引擎
@@ -44,23 +48,24 @@ func NewEngine(config *EngineConfig) (*Engine, error) {
 	if config.Timeout == 0 {
 		config.Timeout = 100 * time.Millisecond
 	}
-	if config.MaxMemory == 0 {
-		config.MaxMemory = 10 * 1024 * 1024 // 10MB
-	}
 
 	engine := &Engine{
 		script:     config.Script,
 		scriptFile: config.ScriptFile,
 		timeout:    config.Timeout,
 		maxMemory:  config.MaxMemory,
+		modulePath: config.ModulePath,
 	}
 
-	// 创建 VM 池
-	engine.vmPool = &sync.Pool{
-		New: func() interface{} {
-			return engine.createVM()
-		},
+	// 编译脚本（语法错误在这里一次性发现）
+	proto, err := engine.compile()
+	if err != nil {
+		return nil, err
 	}
+	engine.proto = proto
+
+	// 创建 VM 池
+	engine.vmPool = engine.newPool()
 
 	// 验证脚本是否可以加载
 	if err := engine.validateScript(); err != nil {
@@ -77,23 +82,14 @@ func NewEngine(config *EngineConfig) (*Engine, error) {
 // 返回：
 //   - *lua.LState: Lua VM 实例
 func (e *Engine) createVM() *lua.LState {
-	vm := lua.NewState()
-
-	// 设置沙箱环境
-	setupSandbox(vm)
+	// 沙箱环境和受限的 require
+	vm := NewSandbox(e.modulePath)
 
 	// 加载标准库
 	setupStdlib(vm)
 
-	// 加载脚本
-	var err error
-	if e.scriptFile != "" {
-		err = vm.DoFile(e.scriptFile)
-	} else {
-		err = vm.DoString(e.script)
-	}
-
-	if err != nil {
+	// 加载脚本（执行共享的字节码，不重新解析源码）
+	if err := DoProtoLimited(vm, e.proto, e.maxMemory); err != nil {
 		log.Printf("加载脚本失败: %v", err)
 		vm.Close()
 		return nil
@@ -102,6 +98,58 @@ func (e *Engine) createVM() *lua.LState {
 	return vm
 }
 
+// newPool 创建 VM 池
+// 创建 VM 失败时返回 nil 接口值（而不是包含 nil 指针的接口），调用方据此判断获取失败
+func (e *Engine) newPool() *sync.Pool {
+	return &sync.Pool{
+		New: func() interface{} {
+			if vm := e.createVM(); vm != nil {
+				return vm
+			}
+			return nil
+		},
+	}
+}
+
+// compile 编译脚本
+// 返回：
+//   - *lua.FunctionProto: 编译后的函数原型
+//   - error: 错误信息
+func (e *Engine) compile() (*lua.FunctionProto, error) {
+	if e.scriptFile != "" {
+		return CompileFile(e.scriptFile)
+	}
+	return Compile(e.script, "<script>")
+}
+
+// program 获取当前的脚本字节码
+func (e *Engine) program() *lua.FunctionProto {
+	e.mu.RLock()
+	defer e.mu.RUnlock()
+	return e.proto
+}
+
+// run 在 VM 中执行当前脚本（受内存上限约束）
+// 参数：
+//   - vm: Lua VM 实例
+//
+// 返回：
+//   - error: 执行错误，内存超限时为 ErrMemoryLimit
+func (e *Engine) run(vm *lua.LState) error {
+	return DoProtoLimited(vm, e.program(), e.maxMemory)
+}
+
+// release 将 VM 放回池中；因内存超限被中止的 VM 直接关闭（其中可能仍引用着大量内存）
+// 参数：
+//   - vm: Lua VM 实例
+func (e *Engine) release(vm *lua.LState) {
+	if Aborted(vm) {
+		vm.Close()
+		return
+	}
+	e.vmPool.Put(vm)
+}
+
 // validateScript 验证脚本是否可以加载
 // 返回：
 //   - error: 错误信息
@@ -136,7 +184,7 @@ func (e *Engine) Execute(functionName string, args ...lua.LValue) (lua.LValue, e
 		return lua.LNil, fmt.Errorf("无法获取 VM")
 	}
 	vm := vmInterface.(*lua.LState)
-	defer e.vmPool.Put(vm)
+	defer e.release(vm)
 
 	// 注意：gopher-lua 不直接支持执行超时，这里通过 goroutine + select 实现
 	_ = vm.Context() // 可选：检查是否已设置 context
@@ -161,11 +209,13 @@ func (e *Engine) Execute(functionName string, args ...lua.LValue) (lua.LValue, e
 		}
 
 		// 调用函数
-		if err := vm.CallByParam(lua.P{
-			Fn:      fn,
-			NRet:    1,
-			Protect: true,
-		}, args...); err != nil {
+		if err := runGuarded(vm, e.maxMemory, func() error {
+			return vm.CallByParam(lua.P{
+				Fn:      fn,
+				NRet:    1,
+				Protect: true,
+			}, args...)
+		}); err != nil {
 			execErr = err
 			return
 		}
@@ -205,7 +255,7 @@ func (e *Engine) ExecuteSimple(context map[string]lua.LValue) (lua.LValue, error
 		return lua.LNil, fmt.Errorf("无法获取 VM")
 	}
 	vm := vmInterface.(*lua.LState)
-	defer e.vmPool.Put(vm)
+	defer e.release(vm)
 
 	// 设置上下文变量
 	for key, value := range context {
@@ -213,6 +263,7 @@ func (e *Engine) ExecuteSimple(context map[string]lua.LValue) (lua.LValue, error
 	}
 
 	// 设置超时
+	proto := e.program()
 	done := make(chan struct{})
 	var result lua.LValue
 	var execErr error
@@ -226,13 +277,7 @@ func (e *Engine) ExecuteSimple(context map[string]lua.LValue) (lua.LValue, error
 		}()
 
 		// 执行脚本
-		if e.scriptFile != "" {
-			execErr = vm.DoFile(e.scriptFile)
-		} else {
-			execErr = vm.DoString(e.script)
-		}
-
-		if execErr != nil {
+		if execErr = DoProtoLimited(vm, proto, e.maxMemory); execErr != nil {
 			return
 		}
 
@@ -273,17 +318,20 @@ func (e *Engine) Reload() error {
 	e.mu.Lock()
 	defer e.mu.Unlock()
 
-	// 验证新脚本
+	// 重新编译并验证新脚本
+	proto, err := e.compile()
+	if err != nil {
+		return err
+	}
+	oldProto := e.proto
+	e.proto = proto
 	if err := e.validateScript(); err != nil {
+		e.proto = oldProto
 		return fmt.Errorf("脚本验证失败: %w", err)
 	}
 
-	// 重新创建 VM 池
-	e.vmPool = &sync.Pool{
-		New: func() interface{} {
-			return e.createVM()
-		},
-	}
+	// 重新创建 VM 池（旧 VM 中加载的是旧脚本）
+	e.vmPool = e.newPool()
 
 	log.Printf("Lua 脚本已重新加载")
 	return nil
@@ -0,0 +1,121 @@
+package scripting
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	lua "github.com/yuin/gopher-lua"
+
+	"llmproxy/internal/lb"
+)
+
+// HealthCheckScript 健康检查后处理脚本执行器
+// 每次检查使用独立的 VM，脚本可以在顶层直接读取 response / backend
+type HealthCheckScript struct {
+	proto      *lua.FunctionProto // 编译后的脚本字节码
+	timeout    time.Duration      // 执行超时时间
+	maxMemory  int64              // 最大内存限制（字节，0 表示不限制）
+	modulePath []string           // require 的模块搜索目录
+}
+
+// NewHealthCheckScript 创建健康检查脚本执行器
+// 参数：
+//   - config: 引擎配置
+//
+// 返回：
+//   - *HealthCheckScript: 健康检查脚本执行器
+//   - error: 脚本为空或存在语法错误时返回错误
+func NewHealthCheckScript(config *EngineConfig) (*HealthCheckScript, error) {
+	if config.Script == "" && config.ScriptFile == "" {
+		return nil, fmt.Errorf("脚本内容和脚本文件路径不能同时为空")
+	}
+
+	var proto *lua.FunctionProto
+	var err error
+	if config.Script != "" {
+		proto, err = Compile(config.Script, "<health_check>")
+	} else {
+		proto, err = CompileFile(config.ScriptFile)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	timeout := config.Timeout
+	if timeout == 0 {
+		timeout = 100 * time.Millisecond
+	}
+
+	return &HealthCheckScript{
+		proto:      proto,
+		timeout:    timeout,
+		maxMemory:  config.MaxMemory,
+		modulePath: config.ModulePath,
+	}, nil
+}
+
+// CheckHealth 执行健康检查脚本
+// 脚本可读取全局变量 response（status / body / headers）和 backend（name / url），
+// 返回 true / false 表示是否健康，返回 nil 表示按状态码判断
+// 参数：
+//   - backend: 后端实例
+//   - resp: 健康检查响应
+//
+// 返回：
+//   - bool: 是否健康
+//   - bool: 脚本是否给出了结论
+//   - error: 执行失败、超时或返回值不是布尔值时返回错误
+func (h *HealthCheckScript) CheckHealth(backend *lb.Backend, resp *lb.HealthCheckResponse) (bool, bool, error) {
+	vm := NewSandbox(h.modulePath)
+	setupStdlib(vm)
+
+	headers := make(map[string]interface{}, len(resp.Header))
+	for k, v := range resp.Header {
+		// 键统一为小写，便于脚本按 response.headers["content-type"] 读取
+		headers[strings.ToLower(k)] = strings.Join(v, ", ")
+	}
+	SetGlobalMap(vm, "response", map[string]interface{}{
+		"status":  resp.StatusCode,
+		"body":    string(resp.Body),
+		"headers": headers,
+	})
+	SetGlobalMap(vm, "backend", map[string]interface{}{
+		"name": backend.Name,
+		"url":  backend.URL,
+	})
+
+	done := make(chan error, 1)
+	go func() {
+		defer func() {
+			if r := recover(); r != nil {
+				done <- fmt.Errorf("脚本执行 panic: %v", r)
+			}
+		}()
+		done <- DoProtoLimited(vm, h.proto, h.maxMemory)
+	}()
+
+	select {
+	case err := <-done:
+		defer vm.Close()
+		if err != nil {
+			return false, false, err
+		}
+	case <-time.After(h.timeout):
+		// gopher-lua 无法从外部中断执行，VM 待脚本结束后再关闭
+		go func() {
+			<-done
+			vm.Close()
+		}()
+		return false, false, fmt.Errorf("脚本执行超时（%v）", h.timeout)
+	}
+
+	switch ret := vm.Get(-1).(type) {
+	case lua.LBool:
+		return bool(ret), true, nil
+	case *lua.LNilType:
+		return false, false, nil
+	default:
+		return false, false, fmt.Errorf("脚本应返回 true / false 或 nil，实际返回 %s", ret.Type())
+	}
+}
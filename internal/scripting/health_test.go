@@ -0,0 +1,142 @@
+package scripting
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"llmproxy/internal/config"
+	"llmproxy/internal/lb"
+)
+
+// warmingScript 503 且带 X-Warming 头的后端视为健康（模型加载中仍接受排队请求），其他情况按状态码判断
+const warmingScript = `
+if response.status == 503 and response.headers["x-warming"] == "1" then
+	return true
+end
+return nil
+`
+
+// newHealthScript 创建健康检查脚本，失败时终止测试
+func newHealthScript(t *testing.T, cfg *EngineConfig) *HealthCheckScript {
+	t.Helper()
+	script, err := NewHealthCheckScript(cfg)
+	if err != nil {
+		t.Fatalf("NewHealthCheckScript() error = %v", err)
+	}
+	return script
+}
+
+func TestHealthCheckScript(t *testing.T) {
+	example := newHealthScript(t, &EngineConfig{ScriptFile: "../../examples/scripts/health_check.lua"})
+	warming := newHealthScript(t, &EngineConfig{Script: warmingScript})
+	backend := &lb.Backend{Name: "vllm-1", URL: "http://10.0.0.1:8000"}
+
+	tests := []struct {
+		name        string
+		script      *HealthCheckScript
+		status      int
+		header      http.Header
+		body        string
+		wantHealthy bool
+		wantVerdict bool
+	}{
+		{"200 但报告降级", example, 200, nil, `{"status":"degraded"}`, false, true},
+		{"200 且状态正常", example, 200, nil, `{"status":"ok"}`, true, true},
+		{"200 维护中", example, 200, nil, `{"status":"maintenance"}`, false, true},
+		{"非 JSON 交给状态码判断", example, 200, nil, `OK`, false, false},
+		{"503 预热中视为健康", warming, 503, http.Header{"X-Warming": {"1"}}, ``, true, true},
+		{"503 未预热交给状态码判断", warming, 503, nil, ``, false, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			healthy, verdict, err := tt.script.CheckHealth(backend, &lb.HealthCheckResponse{
+				StatusCode: tt.status,
+				Header:     tt.header,
+				Body:       []byte(tt.body),
+			})
+			if err != nil {
+				t.Fatalf("CheckHealth() error = %v", err)
+			}
+			if healthy != tt.wantHealthy || verdict != tt.wantVerdict {
+				t.Errorf("CheckHealth() = %v, %v; want %v, %v", healthy, verdict, tt.wantHealthy, tt.wantVerdict)
+			}
+		})
+	}
+}
+
+func TestHealthCheckScriptErrors(t *testing.T) {
+	backend := &lb.Backend{URL: "http://10.0.0.1:8000"}
+	resp := &lb.HealthCheckResponse{StatusCode: 200}
+
+	// 返回值不是布尔值
+	script := newHealthScript(t, &EngineConfig{Script: `return "healthy"`})
+	if _, verdict, err := script.CheckHealth(backend, resp); err == nil || verdict {
+		t.Errorf("string result: verdict = %v, error = %v; want error", verdict, err)
+	}
+
+	// 超时
+	script = newHealthScript(t, &EngineConfig{Script: `while true do end`, Timeout: 20 * time.Millisecond})
+	start := time.Now()
+	if _, _, err := script.CheckHealth(backend, resp); err == nil {
+		t.Error("infinite loop: error = nil")
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("timeout took %v", elapsed)
+	}
+
+	// 语法错误在创建时报告
+	if _, err := NewHealthCheckScript(&EngineConfig{Script: `return (`}); err == nil {
+		t.Error("syntax error: NewHealthCheckScript() error = nil")
+	}
+	if _, err := NewHealthCheckScript(&EngineConfig{}); err == nil {
+		t.Error("empty script: NewHealthCheckScript() error = nil")
+	}
+}
+
+func TestHealthCheckScriptOverridesStatus(t *testing.T) {
+	// 两个后端：一个 200 但报告降级，一个 503 但处于预热中
+	degraded := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte(`{"status":"degraded"}`))
+	}))
+	defer degraded.Close()
+	warmingUp := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("X-Warming", "1")
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer warmingUp.Close()
+
+	lb.SetHealthScript(newHealthScript(t, &EngineConfig{Script: `
+if response.status == 503 and response.headers["x-warming"] == "1" then return true end
+if string.find(response.body, "degraded") then return false end
+return nil
+`}))
+	t.Cleanup(func() { lb.SetHealthScript(nil) })
+
+	rr := lb.NewRoundRobin([]*config.Backend{
+		{Name: "degraded", URL: degraded.URL},
+		{Name: "warming", URL: warmingUp.URL},
+	}, &config.HealthCheckConfig{Interval: 10 * time.Millisecond, UnhealthyThreshold: 1, HealthyThreshold: 1})
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go rr.Start(ctx)
+
+	// 降级的后端被摘除，预热中的后端保留：连续选中的都是 warming
+	onlyWarming := func() bool {
+		for i := 0; i < 4; i++ {
+			if b := rr.Next(); b == nil || b.Name != "warming" {
+				return false
+			}
+		}
+		return true
+	}
+	deadline := time.Now().Add(5 * time.Second)
+	for !onlyWarming() {
+		if time.Now().After(deadline) {
+			t.Fatal("degraded backend still selected or warming backend removed")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
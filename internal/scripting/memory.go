@@ -0,0 +1,253 @@
+package scripting
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+	"time"
+
+	lua "github.com/yuin/gopher-lua"
+)
+
+// ErrMemoryLimit 脚本内存超出限制
+var ErrMemoryLimit = errors.New("脚本内存超出限制")
+
+// VM 栈的上限：限制递归深度和数据栈（寄存器）的增长
+const (
+	callStackSize   = 200        // 调用栈深度
+	registrySize    = 1024 * 4   // 数据栈初始大小（槽位）
+	registryMaxSize = 1024 * 256 // 数据栈最大大小（槽位，每个槽位 16 字节，约 4MB）
+)
+
+// memoryCheckInstructions 两次内存统计之间至少执行的指令数
+const memoryCheckInstructions = 4096
+
+// 内存统计中各类值的估算大小（字节）
+const (
+	valueSize    = 16 // LValue 接口值
+	tableSize    = 96 // 空表
+	entrySize    = 40 // 表中一个键值对
+	functionSize = 64 // 函数闭包
+	otherSize    = 32 // userdata、协程等
+)
+
+// closedChan 已关闭的 channel（内存超限后 Done 返回它，使 VM 在下一条指令处中止）
+var closedChan = func() chan struct{} {
+	ch := make(chan struct{})
+	close(ch)
+	return ch
+}()
+
+// MB 转换为字节
+// 参数：
+//   - mb: 兆字节数
+//
+// 返回：
+//   - int64: 字节数
+func MB(mb int) int64 {
+	return int64(mb) * 1024 * 1024
+}
+
+// NewState 创建限制了调用栈和数据栈大小的 Lua VM
+// 深递归或超长参数列表超出上限时脚本报错，而不是无限占用内存
+// 返回：
+//   - *lua.LState: Lua VM 实例
+func NewState() *lua.LState {
+	return lua.NewState(lua.Options{
+		CallStackSize:   callStackSize,
+		RegistrySize:    registrySize,
+		RegistryMaxSize: registryMaxSize,
+	})
+}
+
+// memoryGuard 按 VM 统计内存的 context
+// gopher-lua 在每条指令前调用 ctx.Done()，memoryGuard 借此每隔一定指令数统计一次 VM 可达对象的大小，
+// 超过上限时返回已关闭的 channel，脚本在当前指令处中止。只统计本 VM 的对象，不受其他请求影响，也不需要额外的 goroutine
+type memoryGuard struct {
+	parent    context.Context // VM 原有的 context
+	vm        *lua.LState     // 被统计的 VM
+	limit     int64           // 内存上限（字节）
+	countdown int             // 距下次统计的指令数（只在 VM 所在 goroutine 中访问）
+	exceeded  atomic.Bool     // 是否已超出上限
+}
+
+// Deadline 返回原有 context 的截止时间
+func (g *memoryGuard) Deadline() (time.Time, bool) { return g.parent.Deadline() }
+
+// Value 返回原有 context 中的值
+func (g *memoryGuard) Value(key interface{}) interface{} { return g.parent.Value(key) }
+
+// Done 每条指令前调用：到达统计间隔时统计内存，超出上限后返回已关闭的 channel
+func (g *memoryGuard) Done() <-chan struct{} {
+	if g.exceeded.Load() {
+		return closedChan
+	}
+	g.countdown--
+	if g.countdown <= 0 {
+		visited, over := measureMemory(g.vm, g.limit)
+		if over {
+			g.exceeded.Store(true)
+			return closedChan
+		}
+		// 统计开销与对象数成正比，间隔至少为对象数，摊销到每条指令不超过一次访问
+		g.countdown = max(memoryCheckInstructions, visited)
+	}
+	return g.parent.Done()
+}
+
+// Err 超出上限时返回 ErrMemoryLimit
+func (g *memoryGuard) Err() error {
+	if g.exceeded.Load() {
+		return ErrMemoryLimit
+	}
+	return g.parent.Err()
+}
+
+// GuardMemory 在脚本执行期间限制 VM 的内存占用
+// 统计从全局变量、注册表、调用栈上的局部变量和闭包上值可达的 Lua 对象（表、字符串、函数）的估算大小，
+// 超过上限时脚本在下一条指令处中止并返回错误，避免失控的脚本耗尽进程内存。
+// 中止后 VM 保留已中止的 context，调用方应关闭该 VM 而不是复用（见 Aborted）
+// 参数：
+//   - vm: Lua VM
+//   - limit: 内存上限（字节，<= 0 表示不限制）
+//
+// 返回：
+//   - func() error: 脚本执行结束后调用，停止统计；超出上限时返回 ErrMemoryLimit
+func GuardMemory(vm *lua.LState, limit int64) func() error {
+	if limit <= 0 {
+		return func() error { return nil }
+	}
+
+	parent := vm.Context()
+	guard := &memoryGuard{parent: parent, vm: vm, limit: limit, countdown: memoryCheckInstructions}
+	if guard.parent == nil {
+		guard.parent = context.Background()
+	}
+	vm.SetContext(guard)
+
+	return func() error {
+		if guard.exceeded.Load() {
+			return ErrMemoryLimit
+		}
+		if parent != nil {
+			vm.SetContext(parent)
+		} else {
+			vm.RemoveContext()
+		}
+		return nil
+	}
+}
+
+// Aborted 判断 VM 是否因内存超限被中止（此类 VM 不应再放回池中）
+// 参数：
+//   - vm: Lua VM
+//
+// 返回：
+//   - bool: 是否已被中止
+func Aborted(vm *lua.LState) bool {
+	ctx := vm.Context()
+	return ctx != nil && ctx.Err() != nil
+}
+
+// runGuarded 在内存上限约束下执行函数，超限时返回 ErrMemoryLimit（而不是 context 取消错误）
+func runGuarded(vm *lua.LState, limit int64, fn func() error) error {
+	stop := GuardMemory(vm, limit)
+	err := fn()
+	if memErr := stop(); memErr != nil {
+		return memErr
+	}
+	return err
+}
+
+// DoProtoLimited 在内存上限约束下执行已编译的脚本
+// 参数：
+//   - vm: Lua VM
+//   - proto: 编译后的函数原型
+//   - limit: 内存上限（字节，<= 0 表示不限制）
+//
+// 返回：
+//   - error: 执行错误，超出上限时为 ErrMemoryLimit
+func DoProtoLimited(vm *lua.LState, proto *lua.FunctionProto, limit int64) error {
+	return runGuarded(vm, limit, func() error {
+		return DoProto(vm, proto)
+	})
+}
+
+// memoryCounter 统计 VM 可达对象的估算大小
+type memoryCounter struct {
+	limit   int64
+	size    int64
+	visited int
+	seen    map[interface{}]bool
+}
+
+// measureMemory 统计 VM 可达对象的估算大小，超过上限时提前结束
+// 参数：
+//   - vm: Lua VM
+//   - limit: 内存上限（字节）
+//
+// 返回：
+//   - int: 访问的对象数
+//   - bool: 是否超过上限
+func measureMemory(vm *lua.LState, limit int64) (int, bool) {
+	c := &memoryCounter{limit: limit, seen: make(map[interface{}]bool)}
+	c.add(vm.G.Global)
+	c.add(vm.G.Registry)
+	for level := 0; !c.over(); level++ {
+		dbg, ok := vm.GetStack(level)
+		if !ok {
+			break
+		}
+		for n := 1; !c.over(); n++ {
+			name, value := vm.GetLocal(dbg, n)
+			if name == "" {
+				break
+			}
+			c.add(value)
+		}
+		if fn, err := vm.GetInfo("f", dbg, lua.LNil); err == nil {
+			c.add(fn)
+		}
+	}
+	return c.visited, c.over()
+}
+
+// over 是否已超过上限
+func (c *memoryCounter) over() bool {
+	return c.size > c.limit
+}
+
+// add 累加一个值及其引用的对象（每个表和函数只统计一次）
+func (c *memoryCounter) add(v lua.LValue) {
+	if c.over() {
+		return
+	}
+	c.visited++
+	switch val := v.(type) {
+	case lua.LString:
+		c.size += valueSize + int64(len(val))
+	case *lua.LTable:
+		if c.seen[val] {
+			return
+		}
+		c.seen[val] = true
+		c.size += tableSize
+		c.add(val.Metatable)
+		for key, value := val.Next(lua.LNil); key != lua.LNil && !c.over(); key, value = val.Next(key) {
+			c.size += entrySize
+			c.add(key)
+			c.add(value)
+		}
+	case *lua.LFunction:
+		if c.seen[val] {
+			return
+		}
+		c.seen[val] = true
+		c.size += functionSize
+		for _, uv := range val.Upvalues {
+			c.add(uv.Value())
+		}
+	case *lua.LUserData, *lua.LState:
+		c.size += otherSize
+	}
+}
@@ -0,0 +1,164 @@
+package scripting
+
+import (
+	"errors"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	lua "github.com/yuin/gopher-lua"
+)
+
+// hugeTableScript 不断向表中追加元素，直到被中止
+const hugeTableScript = `
+local t = {}
+for i = 1, 1e8 do
+	t[i] = i
+end
+return #t
+`
+
+// newLimitedEngine 创建内存上限为 limit 的引擎
+func newLimitedEngine(t *testing.T, script string, limit int64) *Engine {
+	t.Helper()
+	engine, err := NewEngine(&EngineConfig{Script: script, Timeout: 10 * time.Second, MaxMemory: limit})
+	if err != nil {
+		t.Fatalf("NewEngine() error = %v", err)
+	}
+	t.Cleanup(engine.Close)
+	return engine
+}
+
+func TestMemoryLimitAbortsHugeTable(t *testing.T) {
+	tests := []struct {
+		name   string
+		script string
+	}{
+		{"数组", `function run() local t = {} for i = 1, 1e8 do t[i] = i end return #t end`},
+		{"字符串值", `function run() local t = {} for i = 1, 1e7 do t["k" .. i] = string.rep("x", 100) end return 0 end`},
+		{"全局变量中的嵌套表", `function run() data = {} for i = 1, 1e7 do data[i] = { i, i } end return 0 end`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			engine := newLimitedEngine(t, tt.script, MB(1))
+
+			start := time.Now()
+			_, err := engine.Execute("run")
+			if !errors.Is(err, ErrMemoryLimit) {
+				t.Fatalf("Execute() error = %v, want ErrMemoryLimit", err)
+			}
+			if elapsed := time.Since(start); elapsed > 5*time.Second {
+				t.Errorf("script aborted after %v", elapsed)
+			}
+		})
+	}
+
+	// 加载时就超限的脚本无法创建引擎
+	if _, err := NewEngine(&EngineConfig{Script: hugeTableScript, MaxMemory: MB(1)}); err == nil {
+		t.Error("NewEngine() with a script exceeding the limit at load: error = nil")
+	}
+}
+
+func TestMemoryLimitAllowsSmallScripts(t *testing.T) {
+	engine := newLimitedEngine(t, `
+function fill(n)
+	local t = {}
+	for i = 1, n do t[i] = i end
+	return #t
+end
+`, MB(1))
+
+	// 上限以内的分配正常执行，VM 可以复用
+	for i := 0; i < 5; i++ {
+		ret, err := engine.Execute("fill", lua.LNumber(10000))
+		if err != nil || ret != lua.LNumber(10000) {
+			t.Fatalf("Execute(fill) = %v, %v", ret, err)
+		}
+	}
+
+	// 超限被中止后，引擎仍可继续执行其他请求
+	if _, err := engine.Execute("fill", lua.LNumber(1e8)); !errors.Is(err, ErrMemoryLimit) {
+		t.Fatalf("Execute(fill 1e8) error = %v, want ErrMemoryLimit", err)
+	}
+	if ret, err := engine.Execute("fill", lua.LNumber(10)); err != nil || ret != lua.LNumber(10) {
+		t.Errorf("Execute(fill) after abort = %v, %v", ret, err)
+	}
+}
+
+func TestMemoryLimitIsPerVM(t *testing.T) {
+	engine := newLimitedEngine(t, `
+function fill(n)
+	local t = {}
+	for i = 1, n do t[i] = i end
+	return #t
+end
+`, MB(1))
+
+	// 进程中其他位置的大量分配不计入脚本的内存
+	stop := make(chan struct{})
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		var hold [][]byte
+		for {
+			select {
+			case <-stop:
+				return
+			default:
+			}
+			hold = append(hold, make([]byte, 1<<20))
+			if len(hold) > 64 {
+				hold = nil
+			}
+		}
+	}()
+	defer func() {
+		close(stop)
+		wg.Wait()
+	}()
+
+	for i := 0; i < 20; i++ {
+		if ret, err := engine.Execute("fill", lua.LNumber(5000)); err != nil || ret != lua.LNumber(5000) {
+			t.Fatalf("Execute(fill) = %v, %v", ret, err)
+		}
+	}
+}
+
+func TestNewStateBoundsStacks(t *testing.T) {
+	vm := NewState()
+	defer vm.Close()
+
+	// 无限递归在调用栈上限处报错
+	err := vm.DoString(`local function f(n) return 1 + f(n + 1) end return f(1)`)
+	if err == nil || !strings.Contains(err.Error(), "stack overflow") {
+		t.Errorf("unbounded recursion: error = %v, want stack overflow", err)
+	}
+}
+
+func TestGuardMemoryRestoresContext(t *testing.T) {
+	vm := NewState()
+	defer vm.Close()
+
+	proto, err := Compile("local t = {} for i = 1, 100 do t[i] = i end return #t", "<test>")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := DoProtoLimited(vm, proto, MB(1)); err != nil {
+		t.Fatalf("DoProtoLimited() error = %v", err)
+	}
+	if vm.Context() != nil || Aborted(vm) {
+		t.Error("VM keeps the memory guard after a successful run")
+	}
+	vm.Pop(1)
+
+	// 超限后 VM 标记为已中止
+	proto, _ = Compile(hugeTableScript, "<test>")
+	if err := DoProtoLimited(vm, proto, MB(1)); !errors.Is(err, ErrMemoryLimit) {
+		t.Fatalf("DoProtoLimited() error = %v, want ErrMemoryLimit", err)
+	}
+	if !Aborted(vm) {
+		t.Error("Aborted() = false after the memory limit was hit")
+	}
+}
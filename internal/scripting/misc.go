@@ -64,7 +64,7 @@ func (r *RateLimitScript) CheckRateLimit(
 		return nil, nil
 	}
 	vm := vmInterface.(*lua.LState)
-	defer r.engine.vmPool.Put(vm)
+	defer r.engine.release(vm)
 
 	// 设置全局变量
 	SetGlobalMap(vm, "request", map[string]interface{}{
@@ -78,7 +78,7 @@ func (r *RateLimitScript) CheckRateLimit(
 	SetGlobalMap(vm, "current_time", currentTime)
 
 	// 执行脚本
-	if err := vm.DoString(r.engine.script); err != nil {
+	if err := r.engine.run(vm); err != nil {
 		log.Printf("限流脚本执行失败: %v", err)
 		return nil, err
 	}
@@ -175,7 +175,7 @@ func (u *UsageScript) CalculateUsage(
 		return nil, nil
 	}
 	vm := vmInterface.(*lua.LState)
-	defer u.engine.vmPool.Put(vm)
+	defer u.engine.release(vm)
 
 	// 设置全局变量
 	SetGlobalMap(vm, "request", map[string]interface{}{
@@ -191,7 +191,7 @@ func (u *UsageScript) CalculateUsage(
 	SetGlobalMap(vm, "metadata", metadata)
 
 	// 执行脚本
-	if err := vm.DoString(u.engine.script); err != nil {
+	if err := u.engine.run(vm); err != nil {
 		log.Printf("用量计算脚本执行失败: %v", err)
 		return nil, err
 	}
@@ -271,7 +271,7 @@ func (e *ErrorHandlerScript) HandleError(
 		return nil, nil
 	}
 	vm := vmInterface.(*lua.LState)
-	defer e.engine.vmPool.Put(vm)
+	defer e.engine.release(vm)
 
 	// 设置全局变量
 	SetGlobalMap(vm, "request", map[string]interface{}{
@@ -282,7 +282,7 @@ func (e *ErrorHandlerScript) HandleError(
 	SetGlobalMap(vm, "error", errorInfo)
 
 	// 执行脚本
-	if err := vm.DoString(e.engine.script); err != nil {
+	if err := e.engine.run(vm); err != nil {
 		log.Printf("错误处理脚本执行失败: %v", err)
 		return nil, err
 	}
@@ -0,0 +1,130 @@
+package scripting
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	lua "github.com/yuin/gopher-lua"
+)
+
+// moduleNamePattern 合法的模块名：字母、数字、下划线，用 . 分隔子目录（不允许 .. 和路径分隔符）
+var moduleNamePattern = regexp.MustCompile(`^[A-Za-z0-9_]+(\.[A-Za-z0-9_]+)*$`)
+
+// moduleProto 已编译的模块（按文件修改时间失效）
+type moduleProto struct {
+	modTime time.Time
+	proto   *lua.FunctionProto
+}
+
+// moduleCache 模块字节码缓存（文件路径 -> *moduleProto），所有 VM 共享
+var moduleCache sync.Map
+
+// SetupRequire 为 VM 注册受限的 require 函数（替换 VM 原有的 require）
+// require("a.b") 依次在搜索路径的各目录中查找 a/b.lua，只能加载这些目录内的文件；
+// 模块在每个 VM 中只执行一次，返回值被缓存（返回 nil 时缓存为 true，与 Lua 一致）
+// 参数：
+//   - vm: Lua VM 实例
+//   - paths: 模块搜索目录（为空时 require 直接报错）
+func SetupRequire(vm *lua.LState, paths []string) {
+	if len(paths) == 0 {
+		vm.SetGlobal("require", vm.NewFunction(func(L *lua.LState) int {
+			L.RaiseError("require 未启用：未配置 module_path")
+			return 0
+		}))
+		return
+	}
+
+	dirs := make([]string, 0, len(paths))
+	for _, p := range paths {
+		if abs, err := filepath.Abs(p); err == nil {
+			dirs = append(dirs, abs)
+		}
+	}
+
+	loaded := vm.NewTable()
+	vm.SetGlobal("require", vm.NewFunction(func(L *lua.LState) int {
+		name := L.CheckString(1)
+		if value := loaded.RawGetString(name); value != lua.LNil {
+			L.Push(value)
+			return 1
+		}
+
+		proto, err := loadModule(dirs, name)
+		if err != nil {
+			L.RaiseError("%s", err.Error())
+			return 0
+		}
+
+		top := L.GetTop()
+		L.Push(L.NewFunctionFromProto(proto))
+		L.Call(0, 1)
+		value := L.Get(-1)
+		L.SetTop(top)
+		if value == lua.LNil {
+			value = lua.LTrue
+		}
+
+		loaded.RawSetString(name, value)
+		L.Push(value)
+		return 1
+	}))
+}
+
+// loadModule 在搜索目录中查找并编译模块
+// 参数：
+//   - dirs: 模块搜索目录（绝对路径）
+//   - name: 模块名
+//
+// 返回：
+//   - *lua.FunctionProto: 编译后的模块
+//   - error: 模块名非法、未找到或编译失败
+func loadModule(dirs []string, name string) (*lua.FunctionProto, error) {
+	if !moduleNamePattern.MatchString(name) {
+		return nil, fmt.Errorf("非法的模块名: %q", name)
+	}
+
+	rel := strings.ReplaceAll(name, ".", string(filepath.Separator)) + ".lua"
+	for _, dir := range dirs {
+		path := filepath.Join(dir, rel)
+		info, err := os.Stat(path)
+		if err != nil || info.IsDir() {
+			continue
+		}
+		if !withinDir(dir, path) {
+			return nil, fmt.Errorf("模块 %s 不在搜索路径内", name)
+		}
+
+		if cached, ok := moduleCache.Load(path); ok {
+			if m := cached.(*moduleProto); m.modTime.Equal(info.ModTime()) {
+				return m.proto, nil
+			}
+		}
+		proto, err := CompileFile(path)
+		if err != nil {
+			return nil, fmt.Errorf("加载模块 %s 失败: %w", name, err)
+		}
+		moduleCache.Store(path, &moduleProto{modTime: info.ModTime(), proto: proto})
+		return proto, nil
+	}
+
+	return nil, fmt.Errorf("模块 %s 未找到（搜索路径: %s）", name, strings.Join(dirs, ", "))
+}
+
+// withinDir 判断文件解析符号链接后是否仍在目录内（防止通过符号链接访问目录外的文件）
+func withinDir(dir, path string) bool {
+	realDir, err := filepath.EvalSymlinks(dir)
+	if err != nil {
+		return false
+	}
+	realPath, err := filepath.EvalSymlinks(path)
+	if err != nil {
+		return false
+	}
+	rel, err := filepath.Rel(realDir, realPath)
+	return err == nil && rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator))
+}
@@ -0,0 +1,103 @@
+package scripting
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	lua "github.com/yuin/gopher-lua"
+)
+
+// writeModule 在 dir 下写入模块文件（name 可包含子目录）
+func writeModule(t *testing.T, dir, name, source string) {
+	t.Helper()
+	path := filepath.Join(dir, name)
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path, []byte(source), 0o600); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestRequireModuleFunction(t *testing.T) {
+	dir := t.TempDir()
+	writeModule(t, dir, "common.lua", `return function(a, b) return a * b end`)
+	writeModule(t, dir, "util/text.lua", `
+loads = (loads or 0) + 1
+return { upper = function(s) return string.upper(s) end }
+`)
+
+	engine, err := NewEngine(&EngineConfig{
+		ModulePath: []string{dir},
+		Script: `
+local multiply = require("common")
+local text = require("util.text")
+require("util.text")
+function run(a, b) return text.upper("x") .. multiply(a, b) .. loads end
+`,
+	})
+	if err != nil {
+		t.Fatalf("NewEngine() error = %v", err)
+	}
+	defer engine.Close()
+
+	// 模块返回的函数可在主脚本中调用；同一 VM 中模块只执行一次
+	ret, err := engine.Execute("run", lua.LNumber(6), lua.LNumber(7))
+	if err != nil || ret.String() != "X421" {
+		t.Errorf("Execute(run) = %v, %v; want X421", ret, err)
+	}
+}
+
+func TestRequireRejectsEscapes(t *testing.T) {
+	root := t.TempDir()
+	dir := filepath.Join(root, "modules")
+	writeModule(t, root, "secret.lua", `return "secret"`)
+	writeModule(t, dir, "ok.lua", `return "ok"`)
+	if err := os.Symlink(filepath.Join(root, "secret.lua"), filepath.Join(dir, "link.lua")); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name   string
+		module string
+		want   string
+	}{
+		{"上级目录", "../secret", "非法的模块名"},
+		{"路径分隔符", "sub/ok", "非法的模块名"},
+		{"绝对路径", "/etc/passwd", "非法的模块名"},
+		{"指向目录外的符号链接", "link", "不在搜索路径内"},
+		{"不存在的模块", "missing", "未找到"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			vm := NewSandbox([]string{dir})
+			defer vm.Close()
+			err := vm.DoString(`return require("` + tt.module + `")`)
+			if err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("require(%q) error = %v, want %q", tt.module, err, tt.want)
+			}
+		})
+	}
+}
+
+func TestSandboxRequireDisabledWithoutModulePath(t *testing.T) {
+	vm := NewSandbox(nil)
+	defer vm.Close()
+
+	// 未配置 module_path 时 require 报错，而不是回退到 gopher-lua 默认的文件系统加载
+	err := vm.DoString(`return require("os")`)
+	if err == nil || !strings.Contains(err.Error(), "require 未启用") {
+		t.Errorf("require without module_path: error = %v", err)
+	}
+
+	for _, global := range []string{"io", "package", "dofile", "loadfile", "debug"} {
+		if vm.GetGlobal(global) != lua.LNil {
+			t.Errorf("sandbox exposes %s", global)
+		}
+	}
+	if err := vm.DoString(`return os.execute("true")`); err == nil {
+		t.Error("sandbox allows os.execute")
+	}
+}
@@ -61,7 +61,7 @@ func (r *RouterScript) SelectBackend(
 		return "", nil
 	}
 	vm := vmInterface.(*lua.LState)
-	defer r.engine.vmPool.Put(vm)
+	defer r.engine.release(vm)
 
 	// 构造 request 表
 	requestTable := vm.NewTable()
@@ -88,16 +88,14 @@ func (r *RouterScript) SelectBackend(
 		backendTable.RawSetString("url", lua.LString(backend.URL))
 		backendTable.RawSetString("healthy", lua.LBool(backend.Healthy))
 		backendTable.RawSetString("weight", lua.LNumber(backend.Weight))
-		// 注意: lb.Backend 当前没有 AvgLatency 和 ActiveConnections 字段
-		// 如需这些信息，需要扩展 lb.Backend 结构体
-		backendTable.RawSetString("latency_ms", lua.LNumber(0))
-		backendTable.RawSetString("active_connections", lua.LNumber(0))
+		backendTable.RawSetString("latency_ms", lua.LNumber(backend.AvgLatencyMs.Load()))
+		backendTable.RawSetString("active_connections", lua.LNumber(backend.ActiveConnections.Load()))
 		backendsTable.RawSetString(name, backendTable)
 	}
 	vm.SetGlobal("backends", backendsTable)
 
 	// 执行脚本（脚本应该返回后端名称）
-	if err := vm.DoString(r.engine.script); err != nil {
+	if err := r.engine.run(vm); err != nil {
 		log.Printf("路由脚本执行失败: %v", err)
 		return "", err
 	}
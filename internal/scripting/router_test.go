@@ -0,0 +1,106 @@
+package scripting
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"llmproxy/internal/lb"
+)
+
+// lowestLatencyScript 选择平均延迟最低的健康后端（启动验证时没有 backends，返回 nil）
+const lowestLatencyScript = `
+if backends == nil then return nil end
+local best, best_latency
+for name, b in pairs(backends) do
+	if b.healthy and b.latency_ms > 0 and (best == nil or b.latency_ms < best_latency) then
+		best, best_latency = name, b.latency_ms
+	end
+end
+return best
+`
+
+// testRouterBackends 创建指定名称的后端
+func testRouterBackends(names ...string) map[string]*lb.Backend {
+	backends := make(map[string]*lb.Backend, len(names))
+	for _, name := range names {
+		backends[name] = &lb.Backend{Name: name, URL: "http://" + name, Weight: 1, Healthy: true}
+	}
+	return backends
+}
+
+// selectBackend 以空请求执行路由脚本
+func selectBackend(t *testing.T, script *RouterScript, backends map[string]*lb.Backend) string {
+	t.Helper()
+	name, err := script.SelectBackend(nil, "", "", "", "req-1", "/v1/chat/completions", nil, backends)
+	if err != nil {
+		t.Fatalf("SelectBackend() error = %v", err)
+	}
+	return name
+}
+
+func TestRouterScriptPicksLowestLatency(t *testing.T) {
+	script, err := NewRouterScript(&EngineConfig{Script: lowestLatencyScript})
+	if err != nil {
+		t.Fatalf("NewRouterScript() error = %v", err)
+	}
+	defer script.Close()
+
+	backends := testRouterBackends("fast", "slow", "down")
+	// 尚无延迟数据时由默认负载均衡决定
+	if got := selectBackend(t, script, backends); got != "" {
+		t.Errorf("without latency data: selected %q, want default", got)
+	}
+
+	for i := 0; i < 5; i++ {
+		for name, latency := range map[string]time.Duration{"fast": 20 * time.Millisecond, "slow": 300 * time.Millisecond, "down": time.Millisecond} {
+			backends[name].StartRequest()
+			backends[name].EndRequest(latency, nil)
+		}
+	}
+	backends["down"].Healthy = false
+	if got := selectBackend(t, script, backends); got != "fast" {
+		t.Errorf("selected %q, want the lowest-latency healthy backend fast", got)
+	}
+
+	// fast 变慢后改选 slow
+	for i := 0; i < 20; i++ {
+		backends["fast"].StartRequest()
+		backends["fast"].EndRequest(time.Second, nil)
+	}
+	if got := selectBackend(t, script, backends); got != "slow" {
+		t.Errorf("after fast degraded: selected %q, want slow", got)
+	}
+}
+
+func TestRouterScriptSeesActiveConnections(t *testing.T) {
+	script, err := NewRouterScript(&EngineConfig{Script: `
+if backends == nil then return nil end
+local best, least
+for name, b in pairs(backends) do
+	if least == nil or b.active_connections < least then
+		best, least = name, b.active_connections
+	end
+end
+return best
+`})
+	if err != nil {
+		t.Fatalf("NewRouterScript() error = %v", err)
+	}
+	defer script.Close()
+
+	backends := testRouterBackends("a", "b")
+	backends["a"].StartRequest()
+	backends["a"].StartRequest()
+	backends["b"].StartRequest()
+	if got := selectBackend(t, script, backends); got != "b" {
+		t.Errorf("selected %q, want b with fewer active connections", got)
+	}
+
+	backends["b"].StartRequest()
+	backends["b"].StartRequest()
+	backends["a"].EndRequest(time.Millisecond, errors.New("boom"))
+	if got := selectBackend(t, script, backends); got != "a" {
+		t.Errorf("selected %q, want a after its request ended", got)
+	}
+}
@@ -4,6 +4,20 @@ import (
 	lua "github.com/yuin/gopher-lua"
 )
 
+// NewSandbox 创建沙箱化的 Lua VM
+// 限制调用栈和数据栈大小，禁用文件、进程和调试相关的函数，并注册只能加载搜索路径内模块的 require
+// 参数：
+//   - modulePath: require 的模块搜索目录（为空时 require 直接报错）
+//
+// 返回：
+//   - *lua.LState: Lua VM 实例
+func NewSandbox(modulePath []string) *lua.LState {
+	vm := NewState()
+	setupSandbox(vm)
+	SetupRequire(vm, modulePath)
+	return vm
+}
+
 // setupSandbox 设置沙箱环境，禁用危险函数
 // 参数：
 //   - vm: Lua VM 实例
@@ -11,8 +25,7 @@ func setupSandbox(vm *lua.LState) {
 	// 禁用危险的标准库函数
 	disableDangerousFunctions(vm)
 
-	// 注意：gopher-lua 的栈大小限制需要在创建 LState 时通过 Options 设置
-	// 这里我们只禁用危险函数作为沙箱保护
+	// 栈大小限制在创建 LState 时通过 Options 设置（见 NewState）
 }
 
 // disableDangerousFunctions 禁用危险函数
@@ -62,7 +62,7 @@ func (t *TransformScript) TransformRequest(
 		return nil, nil
 	}
 	vm := vmInterface.(*lua.LState)
-	defer t.engine.vmPool.Put(vm)
+	defer t.engine.release(vm)
 
 	// 构造 request 表
 	requestTable := vm.NewTable()
@@ -82,7 +82,7 @@ func (t *TransformScript) TransformRequest(
 	vm.SetGlobal("request", requestTable)
 
 	// 执行脚本
-	if err := vm.DoString(t.engine.script); err != nil {
+	if err := t.engine.run(vm); err != nil {
 		log.Printf("请求转换脚本执行失败: %v", err)
 		return nil, err
 	}
@@ -151,7 +151,7 @@ func (t *TransformScript) TransformResponse(
 		return nil, nil
 	}
 	vm := vmInterface.(*lua.LState)
-	defer t.engine.vmPool.Put(vm)
+	defer t.engine.release(vm)
 
 	// 构造 request 表
 	requestTable := vm.NewTable()
@@ -178,7 +178,7 @@ func (t *TransformScript) TransformResponse(
 	vm.SetGlobal("latency_ms", lua.LNumber(latencyMS))
 
 	// 执行脚本
-	if err := vm.DoString(t.engine.script); err != nil {
+	if err := t.engine.run(vm); err != nil {
 		log.Printf("响应转换脚本执行失败: %v", err)
 		return nil, err
 	}
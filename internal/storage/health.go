@@ -0,0 +1,248 @@
+package storage
+
+import (
+	"context"
+	"database/sql"
+	"log"
+	"sort"
+	"sync"
+	"time"
+
+	"llmproxy/internal/config"
+	"llmproxy/internal/metrics"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// 健康检查默认参数
+const (
+	DefaultHealthCheckInterval = 10 * time.Second
+	DefaultHealthCheckTimeout  = 3 * time.Second
+)
+
+// 连接类型
+const (
+	KindDatabase = "database" // 数据库主库
+	KindReplica  = "replica"  // 由 read_dsn / read_host 创建的只读副本
+	KindCache    = "cache"    // Redis 缓存
+)
+
+// ConnectionStatus 存储连接的健康状态
+type ConnectionStatus struct {
+	Name      string    `json:"name"`
+	Kind      string    `json:"kind"` // database / replica / cache
+	Healthy   bool      `json:"healthy"`
+	Since     time.Time `json:"since"`      // 进入当前状态的时间
+	LastCheck time.Time `json:"last_check"` // 最近一次检查时间
+	LastError string    `json:"last_error,omitempty"`
+	Failures  int       `json:"consecutive_failures"` // 连续失败次数
+}
+
+// healthTarget 一个需要检查的连接
+// 连接句柄在整个生命周期内保持不变（其他模块直接持有），恢复依赖连接池重新拨号
+type healthTarget struct {
+	ping   func(ctx context.Context) error
+	reset  func(ctx context.Context) // Ping 失败后清理连接池，使后续请求重新建立连接（可为 nil）
+	status ConnectionStatus
+}
+
+// healthState 健康检查状态
+type healthState struct {
+	mu      sync.Mutex
+	targets []*healthTarget
+}
+
+// addDatabaseTarget 登记数据库连接（调用方持有 Manager 锁）
+// 参数：
+//   - kind: 连接类型
+//   - name: 连接名称
+//   - db: 数据库连接
+//   - maxIdle: 配置的最大空闲连接数（重置后恢复）
+func (h *healthState) addDatabaseTarget(kind, name string, db *sql.DB, maxIdle int) {
+	if maxIdle <= 0 {
+		maxIdle = 2 // database/sql 默认值
+	}
+	h.add(kind, name, db.PingContext, func(context.Context) {
+		// 丢弃空闲连接：数据库重启后这些连接已失效，下次使用时重新拨号
+		db.SetMaxIdleConns(0)
+		db.SetMaxIdleConns(maxIdle)
+	})
+}
+
+// addCacheTarget 登记 Redis 连接（调用方持有 Manager 锁）
+// go-redis 会丢弃出错的连接并按需重新拨号；Cluster 额外刷新槽位分布
+// 参数：
+//   - name: 连接名称
+//   - client: Redis 客户端
+func (h *healthState) addCacheTarget(name string, client redis.UniversalClient) {
+	var reset func(ctx context.Context)
+	if cluster, ok := client.(*redis.ClusterClient); ok {
+		reset = cluster.ReloadState
+	}
+	h.add(KindCache, name, func(ctx context.Context) error {
+		return client.Ping(ctx).Err()
+	}, reset)
+}
+
+// add 登记连接，初始状态为可用（启动时已 Ping 成功）
+func (h *healthState) add(kind, name string, ping func(ctx context.Context) error, reset func(ctx context.Context)) {
+	now := time.Now()
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.targets = append(h.targets, &healthTarget{
+		ping:  ping,
+		reset: reset,
+		status: ConnectionStatus{
+			Name:      name,
+			Kind:      kind,
+			Healthy:   true,
+			Since:     now,
+			LastCheck: now,
+		},
+	})
+	metrics.SetStorageUp(kind, name, true)
+}
+
+// StartHealthCheck 启动存储连接健康检查，阻塞直到 ctx 取消（通常以 goroutine 方式调用）
+// 参数：
+//   - ctx: 上下文，用于停止检查
+//   - cfg: 健康检查配置（未启用时直接返回）
+func (m *Manager) StartHealthCheck(ctx context.Context, cfg *config.StorageHealthCheckConfig) {
+	if cfg == nil || !cfg.Enabled {
+		return
+	}
+	interval := cfg.Interval
+	if interval <= 0 {
+		interval = DefaultHealthCheckInterval
+	}
+	timeout := cfg.Timeout
+	if timeout <= 0 {
+		timeout = DefaultHealthCheckTimeout
+	}
+	if timeout > interval {
+		timeout = interval
+	}
+
+	log.Printf("存储健康检查已启动，间隔: %v", interval)
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			m.CheckHealth(ctx, timeout)
+		}
+	}
+}
+
+// CheckHealth 检查一次所有连接，状态变化时记录日志
+// 参数：
+//   - ctx: 上下文
+//   - timeout: 单个连接的 Ping 超时
+func (m *Manager) CheckHealth(ctx context.Context, timeout time.Duration) {
+	m.health.mu.Lock()
+	targets := append([]*healthTarget(nil), m.health.targets...)
+	m.health.mu.Unlock()
+
+	for _, t := range targets {
+		pingCtx, cancel := context.WithTimeout(ctx, timeout)
+		err := t.ping(pingCtx)
+		cancel()
+		if err != nil && t.reset != nil {
+			t.reset(ctx)
+		}
+		m.health.record(t, err)
+	}
+}
+
+// record 记录一次检查结果
+func (h *healthState) record(t *healthTarget, err error) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	now := time.Now()
+	s := &t.status
+	s.LastCheck = now
+	wasHealthy := s.Healthy
+
+	if err != nil {
+		s.Healthy = false
+		s.LastError = err.Error()
+		s.Failures++
+		if wasHealthy {
+			s.Since = now
+			log.Printf("存储健康检查: %s [%s] 不可用: %v", s.Kind, s.Name, err)
+		}
+	} else {
+		s.Healthy = true
+		s.LastError = ""
+		if !wasHealthy {
+			s.Since = now
+			log.Printf("存储健康检查: %s [%s] 已恢复（连续失败 %d 次）", s.Kind, s.Name, s.Failures)
+		}
+		s.Failures = 0
+	}
+	metrics.SetStorageUp(s.Kind, s.Name, s.Healthy)
+}
+
+// Status 获取所有连接的健康状态（按类型、名称排序）
+// 返回：
+//   - []ConnectionStatus: 连接状态列表
+func (m *Manager) Status() []ConnectionStatus {
+	m.health.mu.Lock()
+	statuses := make([]ConnectionStatus, 0, len(m.health.targets))
+	for _, t := range m.health.targets {
+		statuses = append(statuses, t.status)
+	}
+	m.health.mu.Unlock()
+
+	sort.Slice(statuses, func(i, j int) bool {
+		if statuses[i].Kind != statuses[j].Kind {
+			return statuses[i].Kind < statuses[j].Kind
+		}
+		return statuses[i].Name < statuses[j].Name
+	})
+	return statuses
+}
+
+// Healthy 最近一次检查中所有连接是否都可用
+func (m *Manager) Healthy() bool {
+	m.health.mu.Lock()
+	defer m.health.mu.Unlock()
+	for _, t := range m.health.targets {
+		if !t.status.Healthy {
+			return false
+		}
+	}
+	return true
+}
+
+// Unhealthy 返回指定连接中最近一次检查不可用的连接（不含只读副本，副本不可用时读请求回退到主库）
+// 参数：
+//   - names: 连接名称（storage.databases / storage.caches 中的 name），"*" 表示所有连接
+//
+// 返回：
+//   - []string: 不可用的连接，格式为 "<kind>/<name>"
+func (m *Manager) Unhealthy(names []string) []string {
+	all := false
+	wanted := make(map[string]bool, len(names))
+	for _, name := range names {
+		if name == "*" {
+			all = true
+		}
+		wanted[name] = true
+	}
+
+	var down []string
+	for _, s := range m.Status() {
+		if s.Healthy || s.Kind == KindReplica {
+			continue
+		}
+		if all || wanted[s.Name] {
+			down = append(down, s.Kind+"/"+s.Name)
+		}
+	}
+	return down
+}
@@ -0,0 +1,156 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"llmproxy/internal/config"
+	"llmproxy/internal/metrics"
+
+	"github.com/alicebob/miniredis/v2"
+)
+
+// storageUp 读取 llmproxy_storage_up 指标的当前值（不存在时返回空字符串）
+func storageUp(t *testing.T, kind, name string) string {
+	t.Helper()
+	rec := httptest.NewRecorder()
+	metrics.Handler(rec, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+	sample := `llmproxy_storage_up{connection="` + name + `",kind="` + kind + `"} `
+	for _, line := range strings.Split(rec.Body.String(), "\n") {
+		if value, ok := strings.CutPrefix(line, sample); ok {
+			return value
+		}
+	}
+	return ""
+}
+
+// cacheStatus 返回指定缓存连接的健康状态
+func cacheStatus(t *testing.T, m *Manager, name string) ConnectionStatus {
+	t.Helper()
+	for _, s := range m.Status() {
+		if s.Kind == KindCache && s.Name == name {
+			return s
+		}
+	}
+	t.Fatalf("Status() has no cache %q", name)
+	return ConnectionStatus{}
+}
+
+func TestCacheHealthFailureAndRecovery(t *testing.T) {
+	metrics.Init(nil)
+	mr := miniredis.RunT(t)
+	m := newTestManager(t, &config.CacheConnection{
+		Name: "redis", Enabled: true, Driver: "redis", Addr: mr.Addr(),
+		DialTimeout: 100 * time.Millisecond, ReadTimeout: 100 * time.Millisecond,
+	})
+	ctx := context.Background()
+
+	m.CheckHealth(ctx, time.Second)
+	if s := cacheStatus(t, m, "redis"); !s.Healthy || !m.Healthy() || storageUp(t, KindCache, "redis") != "1" {
+		t.Fatalf("initial status = %+v, gauge = %s", s, storageUp(t, KindCache, "redis"))
+	}
+
+	// Redis 宕机：连续失败计数，指标和 Unhealthy 同步变化
+	mr.Close()
+	m.CheckHealth(ctx, time.Second)
+	m.CheckHealth(ctx, time.Second)
+	down := cacheStatus(t, m, "redis")
+	if down.Healthy || down.Failures != 2 || down.LastError == "" {
+		t.Fatalf("status after outage = %+v", down)
+	}
+	if m.Healthy() || storageUp(t, KindCache, "redis") != "0" {
+		t.Errorf("Healthy() = %v, gauge = %s", m.Healthy(), storageUp(t, KindCache, "redis"))
+	}
+	if got := m.Unhealthy([]string{"*"}); len(got) != 1 || got[0] != "cache/redis" {
+		t.Errorf("Unhealthy(*) = %v, want [cache/redis]", got)
+	}
+	if got := m.Unhealthy([]string{"other"}); len(got) != 0 {
+		t.Errorf("Unhealthy(other) = %v, want none", got)
+	}
+
+	// 同一地址重启后，原客户端重新拨号恢复
+	if err := mr.Restart(); err != nil {
+		t.Fatal(err)
+	}
+	m.CheckHealth(ctx, time.Second)
+	up := cacheStatus(t, m, "redis")
+	if !up.Healthy || up.Failures != 0 || up.LastError != "" || !up.Since.After(down.Since) {
+		t.Fatalf("status after restart = %+v", up)
+	}
+	if storageUp(t, KindCache, "redis") != "1" {
+		t.Errorf("gauge after restart = %s", storageUp(t, KindCache, "redis"))
+	}
+	if err := m.GetCache("redis").Set(ctx, "k", "v", 0).Err(); err != nil {
+		t.Errorf("Set() after restart error = %v", err)
+	}
+}
+
+func TestHealthCheckLoopResetsOnFailure(t *testing.T) {
+	metrics.Init(nil)
+	m := NewManager()
+	var failing atomic.Bool
+	var resets atomic.Int32
+	m.health.add(KindDatabase, "db", func(context.Context) error {
+		if failing.Load() {
+			return errors.New("connection refused")
+		}
+		return nil
+	}, func(context.Context) { resets.Add(1) })
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		m.StartHealthCheck(ctx, &config.StorageHealthCheckConfig{Enabled: true, Interval: 5 * time.Millisecond})
+		close(done)
+	}()
+	defer func() {
+		cancel()
+		<-done
+	}()
+
+	waitFor := func(healthy bool) {
+		t.Helper()
+		deadline := time.Now().Add(5 * time.Second)
+		for m.Healthy() != healthy {
+			if time.Now().After(deadline) {
+				t.Fatalf("Healthy() did not become %v: %+v", healthy, m.Status())
+			}
+			time.Sleep(time.Millisecond)
+		}
+	}
+
+	failing.Store(true)
+	waitFor(false)
+	if resets.Load() == 0 {
+		t.Error("reset not called after a failed ping")
+	}
+	if storageUp(t, KindDatabase, "db") != "0" {
+		t.Errorf("gauge = %s, want 0", storageUp(t, KindDatabase, "db"))
+	}
+
+	failing.Store(false)
+	waitFor(true)
+	if storageUp(t, KindDatabase, "db") != "1" {
+		t.Errorf("gauge = %s, want 1", storageUp(t, KindDatabase, "db"))
+	}
+}
+
+func TestReplicaNotReportedUnhealthy(t *testing.T) {
+	m := NewManager()
+	m.health.add(KindReplica, "main", func(context.Context) error { return errors.New("down") }, nil)
+	m.CheckHealth(context.Background(), time.Second)
+
+	// 副本不可用时读请求回退到主库，不影响就绪状态
+	if m.Healthy() {
+		t.Error("Healthy() = true with a failing replica")
+	}
+	if got := m.Unhealthy([]string{"*", "main"}); len(got) != 0 {
+		t.Errorf("Unhealthy() = %v, want none", got)
+	}
+}
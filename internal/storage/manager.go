@@ -18,16 +18,21 @@ import (
 // Manager 存储管理器
 // 负责管理数据库和 Redis 连接池
 type Manager struct {
-	databases map[string]*sql.DB       // 数据库连接池
-	caches    map[string]*redis.Client // Redis 连接池
+	databases map[string]*sql.DB               // 数据库连接池
+	replicas  map[string]*sql.DB               // 数据库名 -> 只读副本（未配置副本的数据库不在其中）
+	owned     []*sql.DB                        // 由 read_dsn / read_host 创建的副本连接（关闭时释放）
+	caches    map[string]redis.UniversalClient // Redis 连接池（单节点 / Sentinel / Cluster）
 	mu        sync.RWMutex
+
+	health healthState // 连接健康状态（见 StartHealthCheck）
 }
 
 // NewManager 创建存储管理器
 func NewManager() *Manager {
 	return &Manager{
 		databases: make(map[string]*sql.DB),
-		caches:    make(map[string]*redis.Client),
+		replicas:  make(map[string]*sql.DB),
+		caches:    make(map[string]redis.UniversalClient),
 	}
 }
 
@@ -50,9 +55,18 @@ func (m *Manager) Initialize(cfg *config.StorageConfig) error {
 			return fmt.Errorf("初始化数据库 [%s] 失败: %w", dbCfg.Name, err)
 		}
 		m.databases[dbCfg.Name] = db
+		m.health.addDatabaseTarget(KindDatabase, dbCfg.Name, db, dbCfg.MaxIdleConns)
 		log.Printf("数据库 [%s] 已连接: %s", dbCfg.Name, dbCfg.Driver)
 	}
 
+	// 初始化只读副本（引用其他连接时需等所有主库创建完成）
+	for _, dbCfg := range cfg.Databases {
+		if dbCfg == nil || !dbCfg.Enabled {
+			continue
+		}
+		m.initReplica(dbCfg)
+	}
+
 	// 初始化缓存连接
 	for _, cacheCfg := range cfg.Caches {
 		if cacheCfg == nil || !cacheCfg.Enabled {
@@ -63,7 +77,10 @@ func (m *Manager) Initialize(cfg *config.StorageConfig) error {
 			return fmt.Errorf("初始化缓存 [%s] 失败: %w", cacheCfg.Name, err)
 		}
 		m.caches[cacheCfg.Name] = cache
-		log.Printf("缓存 [%s] 已连接: %s", cacheCfg.Name, cacheCfg.Addr)
+		if cache != nil {
+			m.health.addCacheTarget(cacheCfg.Name, cache)
+			log.Printf("缓存 [%s] 已连接: %s %v", cacheCfg.Name, cacheCfg.GetMode(), cacheCfg.GetAddrs())
+		}
 	}
 
 	return nil
@@ -100,25 +117,49 @@ func (m *Manager) createDatabase(cfg *config.DatabaseConnection) (*sql.DB, error
 	return db, nil
 }
 
+// initReplica 初始化数据库的只读副本（调用方持有锁）
+// 副本不可用时记录警告，读查询回退到主库，不影响启动
+func (m *Manager) initReplica(cfg *config.DatabaseConnection) {
+	if cfg.ReadReplica != "" {
+		replica := m.databases[cfg.ReadReplica]
+		if replica == nil {
+			log.Printf("警告: 数据库 [%s] 的只读副本 [%s] 未启用或未连接，读查询使用主库", cfg.Name, cfg.ReadReplica)
+			return
+		}
+		m.replicas[cfg.Name] = replica
+		log.Printf("数据库 [%s] 的读查询使用副本 [%s]", cfg.Name, cfg.ReadReplica)
+		return
+	}
+
+	dsn := cfg.GetReadDSN()
+	if dsn == "" {
+		return
+	}
+	replicaCfg := *cfg
+	replicaCfg.DSN = dsn
+	replica, err := m.createDatabase(&replicaCfg)
+	if err != nil {
+		log.Printf("警告: 数据库 [%s] 的只读副本连接失败，读查询使用主库: %v", cfg.Name, err)
+		return
+	}
+	m.replicas[cfg.Name] = replica
+	m.owned = append(m.owned, replica)
+	m.health.addDatabaseTarget(KindReplica, cfg.Name, replica, cfg.MaxIdleConns)
+	log.Printf("数据库 [%s] 的只读副本已连接", cfg.Name)
+}
+
 // createCache 创建缓存连接
-func (m *Manager) createCache(cfg *config.CacheConnection) (*redis.Client, error) {
+func (m *Manager) createCache(cfg *config.CacheConnection) (redis.UniversalClient, error) {
 	// 内存缓存不需要创建 Redis 连接
 	if cfg.Driver == "memory" {
 		log.Printf("缓存 [%s] 使用内存模式，跳过 Redis 连接", cfg.Name)
 		return nil, nil
 	}
 
-	// Redis 缓存
-	client := redis.NewClient(&redis.Options{
-		Addr:         cfg.Addr,
-		Password:     cfg.Password,
-		DB:           cfg.DB,
-		DialTimeout:  cfg.DialTimeout,
-		ReadTimeout:  cfg.ReadTimeout,
-		WriteTimeout: cfg.WriteTimeout,
-		PoolSize:     cfg.PoolSize,
-		MinIdleConns: cfg.MinIdleConns,
-	})
+	client, err := newRedisClient(cfg)
+	if err != nil {
+		return nil, err
+	}
 
 	// 测试连接
 	ctx := context.Background()
@@ -130,6 +171,65 @@ func (m *Manager) createCache(cfg *config.CacheConnection) (*redis.Client, error
 	return client, nil
 }
 
+// newRedisClient 按部署模式创建 Redis 客户端（不测试连接）
+// 参数：
+//   - cfg: 缓存连接配置
+//
+// 返回：
+//   - redis.UniversalClient: 单节点为 *redis.Client，Sentinel 为故障转移客户端，Cluster 为 *redis.ClusterClient
+//   - error: 模式不支持或缺少地址时返回错误
+func newRedisClient(cfg *config.CacheConnection) (redis.UniversalClient, error) {
+	switch cfg.GetMode() {
+	case config.RedisModeStandalone:
+		return redis.NewClient(&redis.Options{
+			Addr:         cfg.Addr,
+			Password:     cfg.Password,
+			DB:           cfg.DB,
+			DialTimeout:  cfg.DialTimeout,
+			ReadTimeout:  cfg.ReadTimeout,
+			WriteTimeout: cfg.WriteTimeout,
+			PoolSize:     cfg.PoolSize,
+			MinIdleConns: cfg.MinIdleConns,
+		}), nil
+
+	case config.RedisModeSentinel:
+		addrs := cfg.GetAddrs()
+		if cfg.MasterName == "" || len(addrs) == 0 {
+			return nil, fmt.Errorf("sentinel 模式需要配置 master_name 和 addrs")
+		}
+		return redis.NewFailoverClient(&redis.FailoverOptions{
+			MasterName:       cfg.MasterName,
+			SentinelAddrs:    addrs,
+			SentinelPassword: cfg.SentinelPassword,
+			Password:         cfg.Password,
+			DB:               cfg.DB,
+			DialTimeout:      cfg.DialTimeout,
+			ReadTimeout:      cfg.ReadTimeout,
+			WriteTimeout:     cfg.WriteTimeout,
+			PoolSize:         cfg.PoolSize,
+			MinIdleConns:     cfg.MinIdleConns,
+		}), nil
+
+	case config.RedisModeCluster:
+		addrs := cfg.GetAddrs()
+		if len(addrs) == 0 {
+			return nil, fmt.Errorf("cluster 模式需要配置 addrs")
+		}
+		return redis.NewClusterClient(&redis.ClusterOptions{
+			Addrs:        addrs,
+			Password:     cfg.Password,
+			DialTimeout:  cfg.DialTimeout,
+			ReadTimeout:  cfg.ReadTimeout,
+			WriteTimeout: cfg.WriteTimeout,
+			PoolSize:     cfg.PoolSize,
+			MinIdleConns: cfg.MinIdleConns,
+		}), nil
+
+	default:
+		return nil, fmt.Errorf("不支持的 Redis 模式: %s", cfg.Mode)
+	}
+}
+
 // GetDatabase 获取数据库连接
 func (m *Manager) GetDatabase(name string) *sql.DB {
 	m.mu.RLock()
@@ -137,8 +237,19 @@ func (m *Manager) GetDatabase(name string) *sql.DB {
 	return m.databases[name]
 }
 
-// GetCache 获取缓存连接
-func (m *Manager) GetCache(name string) *redis.Client {
+// GetReadDatabase 获取用于读查询的数据库连接
+// 配置了只读副本时返回副本，否则返回主库
+func (m *Manager) GetReadDatabase(name string) *sql.DB {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	if replica := m.replicas[name]; replica != nil {
+		return replica
+	}
+	return m.databases[name]
+}
+
+// GetCache 获取缓存连接（内存模式或不存在时返回 nil）
+func (m *Manager) GetCache(name string) redis.UniversalClient {
 	m.mu.RLock()
 	defer m.mu.RUnlock()
 	return m.caches[name]
@@ -159,6 +270,14 @@ func (m *Manager) Close() error {
 		}
 	}
 
+	// 关闭副本连接（引用其他连接的副本已随主库关闭）
+	for _, db := range m.owned {
+		if err := db.Close(); err != nil {
+			log.Printf("关闭只读副本失败: %v", err)
+			lastErr = err
+		}
+	}
+
 	// 关闭缓存连接
 	for name, cache := range m.caches {
 		if cache == nil {
@@ -171,7 +290,13 @@ func (m *Manager) Close() error {
 	}
 
 	m.databases = make(map[string]*sql.DB)
-	m.caches = make(map[string]*redis.Client)
+	m.replicas = make(map[string]*sql.DB)
+	m.owned = nil
+	m.caches = make(map[string]redis.UniversalClient)
+
+	m.health.mu.Lock()
+	m.health.targets = nil
+	m.health.mu.Unlock()
 
 	return lastErr
 }
@@ -0,0 +1,128 @@
+package storage
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"llmproxy/internal/config"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/redis/go-redis/v9"
+)
+
+// newTestManager 使用给定缓存配置初始化存储管理器
+func newTestManager(t *testing.T, caches ...*config.CacheConnection) *Manager {
+	t.Helper()
+	m := NewManager()
+	if err := m.Initialize(&config.StorageConfig{Caches: caches}); err != nil {
+		t.Fatalf("Initialize() error = %v", err)
+	}
+	t.Cleanup(func() { _ = m.Close() })
+	return m
+}
+
+func TestStandaloneCache(t *testing.T) {
+	mr := miniredis.RunT(t)
+	m := newTestManager(t, &config.CacheConnection{Name: "redis", Enabled: true, Driver: "redis", Addr: mr.Addr(), DB: 2})
+
+	cache := m.GetCache("redis")
+	client, ok := cache.(*redis.Client)
+	if !ok {
+		t.Fatalf("GetCache() = %T, want *redis.Client", cache)
+	}
+	if client.Options().Addr != mr.Addr() || client.Options().DB != 2 {
+		t.Errorf("options = %s db %d", client.Options().Addr, client.Options().DB)
+	}
+
+	ctx := context.Background()
+	if err := cache.Set(ctx, "k", "v", 0).Err(); err != nil {
+		t.Fatalf("Set() error = %v", err)
+	}
+	mr.Select(2)
+	if got, _ := mr.Get("k"); got != "v" {
+		t.Errorf("miniredis db 2 k = %q, want v", got)
+	}
+
+	if status := m.Status(); len(status) != 1 || status[0].Kind != KindCache || !status[0].Healthy {
+		t.Errorf("Status() = %+v", status)
+	}
+}
+
+func TestCacheInitializeErrors(t *testing.T) {
+	// 内存模式不创建 Redis 连接
+	m := newTestManager(t, &config.CacheConnection{Name: "mem", Enabled: true, Driver: "memory"})
+	if cache := m.GetCache("mem"); cache != nil {
+		t.Errorf("memory cache = %T, want nil", cache)
+	}
+
+	// Redis 不可达时初始化失败
+	mr := miniredis.RunT(t)
+	addr := mr.Addr()
+	mr.Close()
+	err := NewManager().Initialize(&config.StorageConfig{Caches: []*config.CacheConnection{
+		{Name: "down", Enabled: true, Driver: "redis", Addr: addr, DialTimeout: 100 * time.Millisecond},
+	}})
+	if err == nil {
+		t.Error("Initialize() with unreachable redis: error = nil")
+	}
+}
+
+func TestNewRedisClientModes(t *testing.T) {
+	// Sentinel：返回故障转移客户端，地址由 Sentinel 解析
+	sentinel, err := newRedisClient(&config.CacheConnection{
+		Mode:       config.RedisModeSentinel,
+		MasterName: "mymaster",
+		Addrs:      []string{"10.0.0.1:26379", "10.0.0.2:26379"},
+		Password:   "secret",
+		DB:         3,
+	})
+	if err != nil {
+		t.Fatalf("sentinel: error = %v", err)
+	}
+	defer sentinel.Close()
+	client, ok := sentinel.(*redis.Client)
+	if !ok {
+		t.Fatalf("sentinel client = %T, want *redis.Client", sentinel)
+	}
+	if opt := client.Options(); opt.Addr != "FailoverClient" || opt.Password != "secret" || opt.DB != 3 {
+		t.Errorf("sentinel options = %s %q db %d", opt.Addr, opt.Password, opt.DB)
+	}
+
+	// Cluster：未配置 addrs 时使用 addr
+	cluster, err := newRedisClient(&config.CacheConnection{
+		Mode:     config.RedisModeCluster,
+		Addr:     "10.0.0.1:7000",
+		Password: "secret",
+		PoolSize: 20,
+	})
+	if err != nil {
+		t.Fatalf("cluster: error = %v", err)
+	}
+	defer cluster.Close()
+	clusterClient, ok := cluster.(*redis.ClusterClient)
+	if !ok {
+		t.Fatalf("cluster client = %T, want *redis.ClusterClient", cluster)
+	}
+	if opt := clusterClient.Options(); len(opt.Addrs) != 1 || opt.Addrs[0] != "10.0.0.1:7000" || opt.Password != "secret" || opt.PoolSize != 20 {
+		t.Errorf("cluster options = %v %q pool %d", opt.Addrs, opt.Password, opt.PoolSize)
+	}
+
+	broken := []struct {
+		name string
+		cfg  *config.CacheConnection
+	}{
+		{"sentinel 缺少 master_name", &config.CacheConnection{Mode: config.RedisModeSentinel, Addrs: []string{"10.0.0.1:26379"}}},
+		{"sentinel 缺少地址", &config.CacheConnection{Mode: config.RedisModeSentinel, MasterName: "mymaster"}},
+		{"cluster 缺少地址", &config.CacheConnection{Mode: config.RedisModeCluster}},
+		{"未知模式", &config.CacheConnection{Mode: "ring", Addr: "10.0.0.1:6379"}},
+	}
+	for _, tt := range broken {
+		t.Run(tt.name, func(t *testing.T) {
+			if client, err := newRedisClient(tt.cfg); err == nil {
+				client.Close()
+				t.Error("error = nil")
+			}
+		})
+	}
+}
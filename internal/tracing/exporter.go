@@ -0,0 +1,264 @@
+package tracing
+
+import (
+	"bytes"
+	"context"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"sort"
+	"strconv"
+	"sync/atomic"
+	"time"
+)
+
+// 导出参数
+const (
+	exportQueueSize     = 2048            // 待导出 Span 队列长度（满时丢弃）
+	exportBatchSize     = 512             // 单次导出的最大 Span 数
+	exportFlushInterval = 5 * time.Second // 定时导出间隔
+	exportTimeout       = 10 * time.Second
+)
+
+// exporter 以 OTLP/HTTP JSON 格式批量导出 Span
+type exporter struct {
+	endpoint    string
+	serviceName string
+	headers     map[string]string
+	client      *http.Client
+
+	queue   chan *otlpSpan
+	stop    chan struct{}
+	done    chan struct{}
+	dropped atomic.Int64 // 队列满时丢弃的 Span 数（导出时汇总打印）
+}
+
+// newExporter 创建导出器并启动后台导出协程
+func newExporter(endpoint, serviceName string, headers map[string]string) *exporter {
+	e := &exporter{
+		endpoint:    endpoint,
+		serviceName: serviceName,
+		headers:     headers,
+		client:      &http.Client{Timeout: exportTimeout},
+		queue:       make(chan *otlpSpan, exportQueueSize),
+		stop:        make(chan struct{}),
+		done:        make(chan struct{}),
+	}
+	go e.run()
+	return e
+}
+
+// enqueue 将结束的 Span 加入导出队列（不阻塞请求，队列满时丢弃）
+func (e *exporter) enqueue(s *Span, end time.Time) {
+	span := s.toOTLP(end)
+	select {
+	case e.queue <- span:
+	default:
+		e.dropped.Add(1)
+	}
+}
+
+// run 后台导出循环：攒够一批或定时导出，停止时导出剩余 Span
+func (e *exporter) run() {
+	defer close(e.done)
+
+	ticker := time.NewTicker(exportFlushInterval)
+	defer ticker.Stop()
+
+	batch := make([]*otlpSpan, 0, exportBatchSize)
+	flush := func() {
+		if n := e.dropped.Swap(0); n > 0 {
+			log.Printf("追踪: 导出队列已满，丢弃了 %d 个 Span", n)
+		}
+		if len(batch) == 0 {
+			return
+		}
+		if err := e.export(batch); err != nil {
+			log.Printf("追踪: 导出 %d 个 Span 失败: %v", len(batch), err)
+		}
+		batch = batch[:0]
+	}
+
+	for {
+		select {
+		case span := <-e.queue:
+			batch = append(batch, span)
+			if len(batch) >= exportBatchSize {
+				flush()
+			}
+		case <-ticker.C:
+			flush()
+		case <-e.stop:
+			for {
+				select {
+				case span := <-e.queue:
+					batch = append(batch, span)
+					if len(batch) >= exportBatchSize {
+						flush()
+					}
+				default:
+					flush()
+					return
+				}
+			}
+		}
+	}
+}
+
+// close 停止导出器，等待剩余 Span 导出完成（或 ctx 超时）
+func (e *exporter) close(ctx context.Context) {
+	close(e.stop)
+	select {
+	case <-e.done:
+	case <-ctx.Done():
+		log.Printf("追踪: 等待导出完成超时")
+	}
+}
+
+// export 发送一批 Span
+func (e *exporter) export(spans []*otlpSpan) error {
+	payload := otlpRequest{
+		ResourceSpans: []otlpResourceSpans{{
+			Resource: otlpResource{
+				Attributes: []otlpAttr{{Key: "service.name", Value: otlpValue{StringValue: &e.serviceName}}},
+			},
+			ScopeSpans: []otlpScopeSpans{{
+				Scope: otlpScope{Name: "llmproxy"},
+				Spans: spans,
+			}},
+		}},
+	}
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return fmt.Errorf("序列化失败: %w", err)
+	}
+
+	req, err := http.NewRequest(http.MethodPost, e.endpoint, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	for k, v := range e.headers {
+		req.Header.Set(k, v)
+	}
+
+	resp, err := e.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = resp.Body.Close() }()
+	_, _ = io.Copy(io.Discard, resp.Body)
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("收集器返回状态码 %d", resp.StatusCode)
+	}
+	return nil
+}
+
+// OTLP/HTTP JSON 数据结构（trace ID / span ID 为十六进制字符串，时间为纳秒字符串）
+type otlpRequest struct {
+	ResourceSpans []otlpResourceSpans `json:"resourceSpans"`
+}
+
+type otlpResourceSpans struct {
+	Resource   otlpResource     `json:"resource"`
+	ScopeSpans []otlpScopeSpans `json:"scopeSpans"`
+}
+
+type otlpResource struct {
+	Attributes []otlpAttr `json:"attributes"`
+}
+
+type otlpScopeSpans struct {
+	Scope otlpScope   `json:"scope"`
+	Spans []*otlpSpan `json:"spans"`
+}
+
+type otlpScope struct {
+	Name string `json:"name"`
+}
+
+type otlpSpan struct {
+	TraceID           string     `json:"traceId"`
+	SpanID            string     `json:"spanId"`
+	ParentSpanID      string     `json:"parentSpanId,omitempty"`
+	Name              string     `json:"name"`
+	Kind              int        `json:"kind"`
+	StartTimeUnixNano string     `json:"startTimeUnixNano"`
+	EndTimeUnixNano   string     `json:"endTimeUnixNano"`
+	Attributes        []otlpAttr `json:"attributes,omitempty"`
+	Status            otlpStatus `json:"status"`
+}
+
+type otlpStatus struct {
+	Code    int    `json:"code"`
+	Message string `json:"message,omitempty"`
+}
+
+type otlpAttr struct {
+	Key   string    `json:"key"`
+	Value otlpValue `json:"value"`
+}
+
+type otlpValue struct {
+	StringValue *string  `json:"stringValue,omitempty"`
+	IntValue    *string  `json:"intValue,omitempty"`
+	DoubleValue *float64 `json:"doubleValue,omitempty"`
+	BoolValue   *bool    `json:"boolValue,omitempty"`
+}
+
+// toOTLP 将 Span 转换为导出格式
+func (s *Span) toOTLP(end time.Time) *otlpSpan {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	span := &otlpSpan{
+		TraceID:           hex.EncodeToString(s.sc.traceID[:]),
+		SpanID:            hex.EncodeToString(s.sc.spanID[:]),
+		Name:              s.name,
+		Kind:              s.kind,
+		StartTimeUnixNano: strconv.FormatInt(s.start.UnixNano(), 10),
+		EndTimeUnixNano:   strconv.FormatInt(end.UnixNano(), 10),
+		Status:            otlpStatus{Code: s.status, Message: s.statusMsg},
+	}
+	if s.parentID != ([8]byte{}) {
+		span.ParentSpanID = hex.EncodeToString(s.parentID[:])
+	}
+	if span.Status.Code == statusUnset {
+		span.Status.Message = ""
+	}
+	// 属性按名称排序，导出结果稳定
+	keys := make([]string, 0, len(s.attrs))
+	for k := range s.attrs {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		span.Attributes = append(span.Attributes, otlpAttr{Key: k, Value: toOTLPValue(s.attrs[k])})
+	}
+	return span
+}
+
+// toOTLPValue 转换属性值
+func toOTLPValue(v interface{}) otlpValue {
+	switch val := v.(type) {
+	case string:
+		return otlpValue{StringValue: &val}
+	case bool:
+		return otlpValue{BoolValue: &val}
+	case int:
+		s := strconv.FormatInt(int64(val), 10)
+		return otlpValue{IntValue: &s}
+	case int64:
+		s := strconv.FormatInt(val, 10)
+		return otlpValue{IntValue: &s}
+	case float64:
+		return otlpValue{DoubleValue: &val}
+	default:
+		s := fmt.Sprint(val)
+		return otlpValue{StringValue: &s}
+	}
+}
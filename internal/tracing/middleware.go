@@ -0,0 +1,65 @@
+package tracing
+
+import (
+	"net/http"
+)
+
+// Middleware 追踪中间件：为每个请求创建根 Span（入站 traceparent 作为父节点）
+// 应放在鉴权等中间件外层，使其 Span 挂在根 Span 下
+// 参数：
+//   - next: 下一个处理器
+//
+// 返回：
+//   - http.HandlerFunc: HTTP 处理函数
+func Middleware(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		ctx := Extract(r.Context(), r.Header)
+		ctx, span := Start(ctx, r.Method+" "+r.URL.Path, KindServer)
+		if span == nil {
+			next(w, r)
+			return
+		}
+		defer span.End()
+
+		span.SetAttr("http.method", r.Method)
+		span.SetAttr("http.target", r.URL.Path)
+
+		sw := &statusWriter{ResponseWriter: w, status: http.StatusOK}
+		next(sw, r.WithContext(ctx))
+		span.SetHTTPStatus(sw.status)
+	}
+}
+
+// statusWriter 记录响应状态码，并保留流式响应所需的 Flush
+type statusWriter struct {
+	http.ResponseWriter
+	status      int
+	wroteHeader bool
+}
+
+// WriteHeader 记录状态码
+func (w *statusWriter) WriteHeader(code int) {
+	if !w.wroteHeader {
+		w.status = code
+		w.wroteHeader = true
+	}
+	w.ResponseWriter.WriteHeader(code)
+}
+
+// Write 写入响应体
+func (w *statusWriter) Write(b []byte) (int, error) {
+	w.wroteHeader = true
+	return w.ResponseWriter.Write(b)
+}
+
+// Flush 透传 Flush（SSE 流式响应依赖）
+func (w *statusWriter) Flush() {
+	if f, ok := w.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+// Unwrap 供 http.ResponseController 访问底层 ResponseWriter
+func (w *statusWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
@@ -0,0 +1,300 @@
+package tracing
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	mrand "math/rand"
+	"net/http"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"llmproxy/internal/config"
+)
+
+// Span 类型（取值与 OTLP SpanKind 一致）
+const (
+	KindInternal = 1 // 内部操作
+	KindServer   = 2 // 处理入站请求
+	KindClient   = 3 // 发往上游的请求
+)
+
+// Span 状态（取值与 OTLP StatusCode 一致）
+const (
+	statusUnset = 0
+	statusError = 2
+)
+
+// DefaultServiceName 默认服务名
+const DefaultServiceName = "llmproxy"
+
+// tracer 全局追踪器，未启用时为 nil（此时所有操作都是空操作）
+var tracer atomic.Pointer[Tracer]
+
+// Tracer 追踪器：负责采样和导出 Span
+type Tracer struct {
+	sampleRate float64
+	exporter   *exporter
+}
+
+// Init 按配置初始化全局追踪器（未启用时不做任何事）
+// 参数：
+//   - cfg: 追踪配置
+//
+// 返回：
+//   - error: 配置不合法时返回错误
+func Init(cfg *config.TracingConfig) error {
+	if cfg == nil || !cfg.Enabled {
+		return nil
+	}
+	if cfg.Endpoint == "" {
+		return fmt.Errorf("未配置 OTLP 导出地址")
+	}
+
+	rate := cfg.SampleRate
+	if rate <= 0 || rate > 1 {
+		rate = 1
+	}
+	serviceName := cfg.ServiceName
+	if serviceName == "" {
+		serviceName = DefaultServiceName
+	}
+
+	tracer.Store(&Tracer{
+		sampleRate: rate,
+		exporter:   newExporter(cfg.Endpoint, serviceName, cfg.Headers),
+	})
+	return nil
+}
+
+// Enabled 是否已启用追踪
+func Enabled() bool {
+	return tracer.Load() != nil
+}
+
+// Shutdown 导出剩余的 Span 并停止追踪
+// 参数：
+//   - ctx: 上下文（用于控制等待时间）
+func Shutdown(ctx context.Context) {
+	t := tracer.Swap(nil)
+	if t == nil {
+		return
+	}
+	t.exporter.close(ctx)
+}
+
+// spanContext 链路标识（W3C Trace Context）
+type spanContext struct {
+	traceID [16]byte
+	spanID  [8]byte
+	sampled bool
+}
+
+// Span 一次操作的追踪记录（nil Span 的所有方法均为空操作）
+type Span struct {
+	tracer   *Tracer
+	sc       spanContext
+	parentID [8]byte
+	name     string
+	kind     int
+	start    time.Time
+
+	mu        sync.Mutex
+	attrs     map[string]interface{}
+	status    int
+	statusMsg string
+	ended     bool
+}
+
+type spanKey struct{}
+type remoteKey struct{}
+
+// FromContext 获取上下文中的当前 Span
+// 返回：
+//   - *Span: 当前 Span（不存在时返回 nil）
+func FromContext(ctx context.Context) *Span {
+	span, _ := ctx.Value(spanKey{}).(*Span)
+	return span
+}
+
+// Start 创建当前 Span 的子 Span
+// 上下文中没有 Span 时以入站请求携带的 traceparent 为父节点，都没有时开启新链路
+// 参数：
+//   - ctx: 上下文
+//   - name: Span 名称
+//   - kind: Span 类型（KindInternal / KindServer / KindClient）
+//
+// 返回：
+//   - context.Context: 携带新 Span 的上下文
+//   - *Span: 新 Span（未启用或未被采样时为 nil）
+func Start(ctx context.Context, name string, kind int) (context.Context, *Span) {
+	t := tracer.Load()
+	if t == nil {
+		return ctx, nil
+	}
+
+	var sc spanContext
+	var parentID [8]byte
+	if parent := FromContext(ctx); parent != nil {
+		sc.traceID = parent.sc.traceID
+		sc.sampled = true
+		parentID = parent.sc.spanID
+	} else if remote, ok := ctx.Value(remoteKey{}).(spanContext); ok {
+		// 沿用上游的采样决定，保证同一条链路要么完整记录要么完全不记录
+		if !remote.sampled {
+			return ctx, nil
+		}
+		sc.traceID = remote.traceID
+		sc.sampled = true
+		parentID = remote.spanID
+	} else {
+		if t.sampleRate < 1 && mrand.Float64() >= t.sampleRate {
+			return ctx, nil
+		}
+		_, _ = rand.Read(sc.traceID[:])
+		sc.sampled = true
+	}
+	_, _ = rand.Read(sc.spanID[:])
+
+	span := &Span{
+		tracer:   t,
+		sc:       sc,
+		parentID: parentID,
+		name:     name,
+		kind:     kind,
+		start:    time.Now(),
+	}
+	return context.WithValue(ctx, spanKey{}, span), span
+}
+
+// SetAttr 设置属性（值支持 string / bool / 整数 / 浮点数，其他类型按字符串记录）
+func (s *Span) SetAttr(key string, value interface{}) {
+	if s == nil {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.attrs == nil {
+		s.attrs = make(map[string]interface{})
+	}
+	s.attrs[key] = value
+}
+
+// SetError 将 Span 标记为失败
+func (s *Span) SetError(err error) {
+	if s == nil || err == nil {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.status = statusError
+	s.statusMsg = err.Error()
+}
+
+// SetHTTPStatus 记录 HTTP 状态码，5xx 时将 Span 标记为失败
+func (s *Span) SetHTTPStatus(code int) {
+	if s == nil {
+		return
+	}
+	s.SetAttr("http.status_code", code)
+	if code >= 500 {
+		s.mu.Lock()
+		if s.status != statusError {
+			s.status = statusError
+			s.statusMsg = http.StatusText(code)
+		}
+		s.mu.Unlock()
+	}
+}
+
+// End 结束 Span 并提交导出（重复调用只生效一次）
+func (s *Span) End() {
+	if s == nil {
+		return
+	}
+	s.mu.Lock()
+	if s.ended {
+		s.mu.Unlock()
+		return
+	}
+	s.ended = true
+	s.mu.Unlock()
+
+	s.tracer.exporter.enqueue(s, time.Now())
+}
+
+// TraceID 返回链路 ID（十六进制，nil Span 返回空字符串）
+func (s *Span) TraceID() string {
+	if s == nil {
+		return ""
+	}
+	return hex.EncodeToString(s.sc.traceID[:])
+}
+
+// Inject 将当前 Span 写入 traceparent 请求头（用于发往上游的请求）
+// 参数：
+//   - ctx: 上下文
+//   - h: 请求头
+func Inject(ctx context.Context, h http.Header) {
+	span := FromContext(ctx)
+	if span == nil {
+		return
+	}
+	h.Set("traceparent", formatTraceparent(span.sc))
+}
+
+// Extract 解析入站请求的 traceparent 并存入上下文，供 Start 作为父节点
+// 参数：
+//   - ctx: 上下文
+//   - h: 入站请求头
+//
+// 返回：
+//   - context.Context: 上下文（无有效 traceparent 时原样返回）
+func Extract(ctx context.Context, h http.Header) context.Context {
+	sc, ok := parseTraceparent(h.Get("traceparent"))
+	if !ok {
+		return ctx
+	}
+	return context.WithValue(ctx, remoteKey{}, sc)
+}
+
+// formatTraceparent 生成 traceparent：00-<trace-id>-<span-id>-<flags>
+func formatTraceparent(sc spanContext) string {
+	flags := "00"
+	if sc.sampled {
+		flags = "01"
+	}
+	return "00-" + hex.EncodeToString(sc.traceID[:]) + "-" + hex.EncodeToString(sc.spanID[:]) + "-" + flags
+}
+
+// parseTraceparent 解析 traceparent（格式不合法或 ID 全零时返回 false）
+func parseTraceparent(value string) (spanContext, bool) {
+	var sc spanContext
+	parts := strings.Split(strings.TrimSpace(value), "-")
+	if len(parts) < 4 || len(parts[0]) != 2 || parts[0] == "ff" ||
+		len(parts[1]) != 32 || len(parts[2]) != 16 || len(parts[3]) != 2 {
+		return sc, false
+	}
+	// 版本 00 必须恰好 4 段，更高版本允许追加字段
+	if parts[0] == "00" && len(parts) != 4 {
+		return sc, false
+	}
+	if _, err := hex.Decode(sc.traceID[:], []byte(parts[1])); err != nil {
+		return sc, false
+	}
+	if _, err := hex.Decode(sc.spanID[:], []byte(parts[2])); err != nil {
+		return sc, false
+	}
+	flags, err := hex.DecodeString(parts[3])
+	if err != nil {
+		return sc, false
+	}
+	if sc.traceID == ([16]byte{}) || sc.spanID == ([8]byte{}) {
+		return sc, false
+	}
+	sc.sampled = flags[0]&0x01 == 1
+	return sc, true
+}
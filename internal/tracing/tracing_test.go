@@ -0,0 +1,307 @@
+package tracing
+
+import (
+	"bytes"
+	"context"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"flag"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"llmproxy/internal/config"
+)
+
+var update = flag.Bool("update", false, "更新 testdata 中的 golden 文件")
+
+// collector 模拟 OTLP/HTTP 收集器，保存收到的请求
+type collector struct {
+	mu       sync.Mutex
+	bodies   [][]byte
+	headers  []http.Header
+	received []*otlpSpan
+}
+
+// newCollector 启动模拟收集器
+func newCollector(t *testing.T) (*collector, string) {
+	t.Helper()
+	c := &collector{}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		var req otlpRequest
+		if err := json.Unmarshal(body, &req); err != nil {
+			t.Errorf("collector: invalid OTLP JSON: %v", err)
+		}
+		c.mu.Lock()
+		defer c.mu.Unlock()
+		c.bodies = append(c.bodies, body)
+		c.headers = append(c.headers, r.Header.Clone())
+		for _, rs := range req.ResourceSpans {
+			for _, ss := range rs.ScopeSpans {
+				c.received = append(c.received, ss.Spans...)
+			}
+		}
+	}))
+	t.Cleanup(srv.Close)
+	return c, srv.URL + "/v1/traces"
+}
+
+// spans 返回收到的 Span（按名称索引）
+func (c *collector) spans() map[string]*otlpSpan {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	result := make(map[string]*otlpSpan, len(c.received))
+	for _, s := range c.received {
+		result[s.Name] = s
+	}
+	return result
+}
+
+// initTracing 启用全局追踪，测试结束时关闭
+func initTracing(t *testing.T, endpoint string) {
+	t.Helper()
+	if err := Init(&config.TracingConfig{Enabled: true, Endpoint: endpoint, ServiceName: "llmproxy-test", Headers: map[string]string{"X-Tenant": "ops"}}); err != nil {
+		t.Fatalf("Init() error = %v", err)
+	}
+	t.Cleanup(func() { Shutdown(context.Background()) })
+}
+
+// attrValue 返回 Span 属性的字符串形式
+func attrValue(s *otlpSpan, key string) string {
+	for _, a := range s.Attributes {
+		if a.Key != key {
+			continue
+		}
+		switch {
+		case a.Value.StringValue != nil:
+			return *a.Value.StringValue
+		case a.Value.IntValue != nil:
+			return *a.Value.IntValue
+		case a.Value.BoolValue != nil:
+			if *a.Value.BoolValue {
+				return "true"
+			}
+			return "false"
+		}
+	}
+	return ""
+}
+
+// fixedSpan 构造 ID 和时间固定的 Span
+func fixedSpan(name string, kind int, traceID, spanID, parentID string, start time.Time) *Span {
+	s := &Span{name: name, kind: kind, start: start}
+	hex.Decode(s.sc.traceID[:], []byte(traceID))
+	hex.Decode(s.sc.spanID[:], []byte(spanID))
+	if parentID != "" {
+		hex.Decode(s.parentID[:], []byte(parentID))
+	}
+	s.sc.sampled = true
+	return s
+}
+
+func TestExportGolden(t *testing.T) {
+	c, endpoint := newCollector(t)
+	e := &exporter{endpoint: endpoint, serviceName: "llmproxy-test", headers: map[string]string{"X-Tenant": "ops"}, client: http.DefaultClient}
+
+	const traceID = "4bf92f3577b34da6a3ce929d0e0e4736"
+	start := time.Date(2026, 3, 15, 10, 0, 0, 0, time.UTC)
+	root := fixedSpan("POST /v1/chat/completions", KindServer, traceID, "00f067aa0ba902b7", "1111111111111111", start)
+	root.SetAttr("http.method", "POST")
+	root.SetAttr("llm.model", "gpt-4o")
+	root.SetAttr("llm.stream", false)
+	root.SetAttr("llm.usage.total_tokens", 42)
+	root.SetHTTPStatus(200)
+
+	auth := fixedSpan("auth.pipeline", KindInternal, traceID, "2222222222222222", "00f067aa0ba902b7", start.Add(time.Millisecond))
+	auth.SetAttr("auth.allow", true)
+
+	backend := fixedSpan("backend.request", KindClient, traceID, "3333333333333333", "00f067aa0ba902b7", start.Add(2*time.Millisecond))
+	backend.SetAttr("backend.url", "http://vllm-1:8000")
+	backend.SetAttr("retry.attempt", int64(2))
+	backend.SetAttr("latency_ratio", 0.5)
+	backend.SetError(errors.New("connection refused"))
+
+	spans := []*otlpSpan{
+		auth.toOTLP(start.Add(2 * time.Millisecond)),
+		backend.toOTLP(start.Add(50 * time.Millisecond)),
+		root.toOTLP(start.Add(60 * time.Millisecond)),
+	}
+	if err := e.export(spans); err != nil {
+		t.Fatalf("export() error = %v", err)
+	}
+
+	if len(c.bodies) != 1 {
+		t.Fatalf("collector received %d requests, want 1", len(c.bodies))
+	}
+	if got := c.headers[0].Get("Content-Type"); got != "application/json" {
+		t.Errorf("Content-Type = %q", got)
+	}
+	if got := c.headers[0].Get("X-Tenant"); got != "ops" {
+		t.Errorf("custom header X-Tenant = %q, want ops", got)
+	}
+
+	var got bytes.Buffer
+	if err := json.Indent(&got, c.bodies[0], "", "  "); err != nil {
+		t.Fatal(err)
+	}
+	got.WriteByte('\n')
+
+	golden := filepath.Join("testdata", "otlp_export.golden.json")
+	if *update {
+		if err := os.WriteFile(golden, got.Bytes(), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	want, err := os.ReadFile(golden)
+	if err != nil {
+		t.Fatalf("read golden file (run with -update to create it): %v", err)
+	}
+	if !bytes.Equal(got.Bytes(), want) {
+		t.Errorf("exported OTLP JSON differs from %s:\n%s", golden, got.String())
+	}
+}
+
+func TestSpanTree(t *testing.T) {
+	c, endpoint := newCollector(t)
+	initTracing(t, endpoint)
+
+	// 模拟上游：记录收到的 traceparent
+	var upstreamTraceparent string
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		upstreamTraceparent = r.Header.Get("traceparent")
+	}))
+	defer upstream.Close()
+
+	// 与代理相同的结构：根 Span 下依次为鉴权和后端请求
+	handler := Middleware(func(w http.ResponseWriter, r *http.Request) {
+		_, auth := Start(r.Context(), "auth.pipeline", KindInternal)
+		auth.SetAttr("auth.allow", true)
+		auth.End()
+
+		ctx, backend := Start(r.Context(), "backend.request", KindClient)
+		backend.SetAttr("backend.url", upstream.URL)
+		req, _ := http.NewRequestWithContext(ctx, http.MethodPost, upstream.URL, nil)
+		Inject(ctx, req.Header)
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Errorf("upstream request: %v", err)
+			return
+		}
+		resp.Body.Close()
+		backend.SetHTTPStatus(resp.StatusCode)
+		backend.End()
+
+		FromContext(r.Context()).SetAttr("llm.model", "gpt-4o")
+		w.WriteHeader(http.StatusTeapot)
+	})
+
+	const incoming = "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01"
+	req := httptest.NewRequest(http.MethodPost, "/v1/chat/completions", nil)
+	req.Header.Set("traceparent", incoming)
+	handler(httptest.NewRecorder(), req)
+	Shutdown(context.Background())
+
+	spans := c.spans()
+	root, auth, backend := spans["POST /v1/chat/completions"], spans["auth.pipeline"], spans["backend.request"]
+	if root == nil || auth == nil || backend == nil || len(spans) != 3 {
+		t.Fatalf("exported spans = %v, want root, auth.pipeline and backend.request", spans)
+	}
+
+	// 整条链路沿用入站 traceparent 的 trace id，根 Span 挂在上游 Span 下
+	for _, s := range spans {
+		if s.TraceID != "4bf92f3577b34da6a3ce929d0e0e4736" {
+			t.Errorf("%s trace id = %s", s.Name, s.TraceID)
+		}
+	}
+	if root.ParentSpanID != "00f067aa0ba902b7" || root.Kind != KindServer {
+		t.Errorf("root parent = %s, kind = %d", root.ParentSpanID, root.Kind)
+	}
+	if auth.ParentSpanID != root.SpanID || auth.Kind != KindInternal {
+		t.Errorf("auth.pipeline parent = %s, want root %s", auth.ParentSpanID, root.SpanID)
+	}
+	if backend.ParentSpanID != root.SpanID || backend.Kind != KindClient {
+		t.Errorf("backend.request parent = %s, want root %s", backend.ParentSpanID, root.SpanID)
+	}
+
+	// 发往上游的 traceparent 指向 backend.request
+	if want := "00-" + backend.TraceID + "-" + backend.SpanID + "-01"; upstreamTraceparent != want {
+		t.Errorf("upstream traceparent = %q, want %q", upstreamTraceparent, want)
+	}
+
+	if got := attrValue(root, "http.status_code"); got != "418" {
+		t.Errorf("root http.status_code = %q, want 418", got)
+	}
+	if got := attrValue(root, "llm.model"); got != "gpt-4o" {
+		t.Errorf("root llm.model = %q", got)
+	}
+	if got := attrValue(backend, "backend.url"); got != upstream.URL {
+		t.Errorf("backend.url = %q", got)
+	}
+}
+
+func TestDisabledTracingIsNoop(t *testing.T) {
+	Shutdown(context.Background())
+
+	ctx, span := Start(context.Background(), "noop", KindInternal)
+	if span != nil || FromContext(ctx) != nil {
+		t.Fatal("Start() created a span while tracing is disabled")
+	}
+	// nil Span 的方法都是空操作
+	span.SetAttr("k", "v")
+	span.SetError(errors.New("x"))
+	span.SetHTTPStatus(500)
+	span.End()
+	h := http.Header{}
+	Inject(ctx, h)
+	if h.Get("traceparent") != "" || span.TraceID() != "" {
+		t.Error("disabled tracing injected a traceparent")
+	}
+}
+
+func TestUnsampledParentSkipsTrace(t *testing.T) {
+	c, endpoint := newCollector(t)
+	initTracing(t, endpoint)
+
+	ctx := Extract(context.Background(), http.Header{"Traceparent": {"00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-00"}})
+	if _, span := Start(ctx, "root", KindServer); span != nil {
+		t.Error("Start() sampled a trace whose parent was not sampled")
+	}
+	Shutdown(context.Background())
+	if len(c.spans()) != 0 {
+		t.Errorf("exported %d spans, want 0", len(c.spans()))
+	}
+}
+
+func TestParseTraceparent(t *testing.T) {
+	tests := []struct {
+		value   string
+		ok      bool
+		sampled bool
+	}{
+		{"00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01", true, true},
+		{"00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-00", true, false},
+		{"01-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01-extra", true, true},
+		{"00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01-extra", false, false},
+		{"ff-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01", false, false},
+		{"00-00000000000000000000000000000000-00f067aa0ba902b7-01", false, false},
+		{"00-4bf92f3577b34da6a3ce929d0e0e4736-0000000000000000-01", false, false},
+		{"00-xyz-00f067aa0ba902b7-01", false, false},
+		{"", false, false},
+	}
+	for _, tt := range tests {
+		sc, ok := parseTraceparent(tt.value)
+		if ok != tt.ok || (ok && sc.sampled != tt.sampled) {
+			t.Errorf("parseTraceparent(%q) = sampled %v, ok %v; want %v, %v", tt.value, sc.sampled, ok, tt.sampled, tt.ok)
+		}
+		if ok && tt.value[:2] == "00" && formatTraceparent(sc) != tt.value {
+			t.Errorf("formatTraceparent() = %q, want %q", formatTraceparent(sc), tt.value)
+		}
+	}
+}
@@ -0,0 +1,472 @@
+// Package translate 提供不同 LLM API 格式之间的请求/响应转换
+// 目前支持 Anthropic Messages API（/v1/messages）与 OpenAI Chat Completions API 之间的转换，
+// 使按 Anthropic SDK 编写的客户端可以直接使用 OpenAI 兼容的后端
+package translate
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+)
+
+// API 路径
+const (
+	AnthropicMessagesPath = "/v1/messages"
+	OpenAIChatPath        = "/v1/chat/completions"
+)
+
+// anthropicRequest Anthropic Messages API 请求
+type anthropicRequest struct {
+	Model         string             `json:"model"`
+	System        json.RawMessage    `json:"system,omitempty"` // 字符串或文本块数组
+	Messages      []anthropicMessage `json:"messages"`
+	MaxTokens     int                `json:"max_tokens"`
+	Temperature   *float64           `json:"temperature,omitempty"`
+	TopP          *float64           `json:"top_p,omitempty"`
+	StopSequences []string           `json:"stop_sequences,omitempty"`
+	Stream        bool               `json:"stream,omitempty"`
+	Tools         []anthropicTool    `json:"tools,omitempty"`
+	ToolChoice    *anthropicChoice   `json:"tool_choice,omitempty"`
+	Metadata      *struct {
+		UserID string `json:"user_id,omitempty"`
+	} `json:"metadata,omitempty"`
+}
+
+// anthropicMessage Anthropic 消息（content 为字符串或内容块数组）
+type anthropicMessage struct {
+	Role    string          `json:"role"`
+	Content json.RawMessage `json:"content"`
+}
+
+// anthropicBlock Anthropic 内容块
+type anthropicBlock struct {
+	Type string `json:"type"` // text / image / tool_use / tool_result
+
+	Text string `json:"text,omitempty"`
+
+	Source *struct {
+		Type      string `json:"type"` // base64 / url
+		MediaType string `json:"media_type,omitempty"`
+		Data      string `json:"data,omitempty"`
+		URL       string `json:"url,omitempty"`
+	} `json:"source,omitempty"`
+
+	ID    string          `json:"id,omitempty"`
+	Name  string          `json:"name,omitempty"`
+	Input json.RawMessage `json:"input,omitempty"`
+
+	ToolUseID string          `json:"tool_use_id,omitempty"`
+	Content   json.RawMessage `json:"content,omitempty"` // tool_result 内容：字符串或内容块数组
+	IsError   bool            `json:"is_error,omitempty"`
+}
+
+// anthropicTool Anthropic 工具定义
+type anthropicTool struct {
+	Name        string          `json:"name"`
+	Description string          `json:"description,omitempty"`
+	InputSchema json.RawMessage `json:"input_schema"`
+}
+
+// anthropicChoice Anthropic 工具选择
+type anthropicChoice struct {
+	Type string `json:"type"` // auto / any / tool / none
+	Name string `json:"name,omitempty"`
+}
+
+// openAIMessage OpenAI 消息
+type openAIMessage struct {
+	Role       string           `json:"role"`
+	Content    interface{}      `json:"content"` // 字符串、内容块数组或 null
+	ToolCalls  []openAIToolCall `json:"tool_calls,omitempty"`
+	ToolCallID string           `json:"tool_call_id,omitempty"`
+}
+
+// openAIToolCall OpenAI 工具调用
+type openAIToolCall struct {
+	Index    *int   `json:"index,omitempty"` // 仅流式增量使用
+	ID       string `json:"id,omitempty"`
+	Type     string `json:"type,omitempty"`
+	Function struct {
+		Name      string `json:"name,omitempty"`
+		Arguments string `json:"arguments"`
+	} `json:"function"`
+}
+
+// openAIUsage OpenAI 用量
+type openAIUsage struct {
+	PromptTokens     int `json:"prompt_tokens"`
+	CompletionTokens int `json:"completion_tokens"`
+}
+
+// openAIResponse OpenAI Chat Completions 非流式响应
+type openAIResponse struct {
+	ID      string `json:"id"`
+	Model   string `json:"model"`
+	Choices []struct {
+		Message struct {
+			Content   *string          `json:"content"`
+			ToolCalls []openAIToolCall `json:"tool_calls"`
+		} `json:"message"`
+		FinishReason string `json:"finish_reason"`
+	} `json:"choices"`
+	Usage *openAIUsage `json:"usage"`
+}
+
+// AnthropicResponse Anthropic Messages API 非流式响应
+type AnthropicResponse struct {
+	ID           string                   `json:"id"`
+	Type         string                   `json:"type"` // 固定为 message
+	Role         string                   `json:"role"` // 固定为 assistant
+	Model        string                   `json:"model"`
+	Content      []map[string]interface{} `json:"content"`
+	StopReason   string                   `json:"stop_reason"`
+	StopSequence *string                  `json:"stop_sequence"`
+	Usage        AnthropicResponseUsage   `json:"usage"`
+}
+
+// AnthropicResponseUsage Anthropic 用量
+type AnthropicResponseUsage struct {
+	InputTokens  int `json:"input_tokens"`
+	OutputTokens int `json:"output_tokens"`
+}
+
+// AnthropicToOpenAI 将 Anthropic Messages 请求转换为 OpenAI Chat Completions 请求
+// 流式请求会附加 stream_options.include_usage，保证流末尾返回用量
+// 参数：
+//   - body: Anthropic 请求体
+//
+// 返回：
+//   - []byte: OpenAI 请求体
+//   - error: 请求体不合法时返回错误
+func AnthropicToOpenAI(body []byte) ([]byte, error) {
+	var req anthropicRequest
+	if err := json.Unmarshal(body, &req); err != nil {
+		return nil, fmt.Errorf("解析 Anthropic 请求失败: %w", err)
+	}
+	if req.Model == "" {
+		return nil, fmt.Errorf("model 不能为空")
+	}
+	if len(req.Messages) == 0 {
+		return nil, fmt.Errorf("messages 不能为空")
+	}
+
+	var messages []openAIMessage
+	if len(req.System) > 0 && string(req.System) != "null" {
+		system, err := textContent(req.System)
+		if err != nil {
+			return nil, fmt.Errorf("system: %w", err)
+		}
+		messages = append(messages, openAIMessage{Role: "system", Content: system})
+	}
+	for i, msg := range req.Messages {
+		converted, err := convertMessage(msg)
+		if err != nil {
+			return nil, fmt.Errorf("messages[%d]: %w", i, err)
+		}
+		messages = append(messages, converted...)
+	}
+
+	out := map[string]interface{}{
+		"model":    req.Model,
+		"messages": messages,
+	}
+	if req.MaxTokens > 0 {
+		out["max_tokens"] = req.MaxTokens
+	}
+	if req.Temperature != nil {
+		out["temperature"] = *req.Temperature
+	}
+	if req.TopP != nil {
+		out["top_p"] = *req.TopP
+	}
+	if len(req.StopSequences) > 0 {
+		out["stop"] = req.StopSequences
+	}
+	if req.Stream {
+		out["stream"] = true
+		out["stream_options"] = map[string]bool{"include_usage": true}
+	}
+	if req.Metadata != nil && req.Metadata.UserID != "" {
+		out["user"] = req.Metadata.UserID
+	}
+	if len(req.Tools) > 0 {
+		tools := make([]map[string]interface{}, 0, len(req.Tools))
+		for _, t := range req.Tools {
+			function := map[string]interface{}{"name": t.Name}
+			if t.Description != "" {
+				function["description"] = t.Description
+			}
+			if len(t.InputSchema) > 0 {
+				function["parameters"] = t.InputSchema
+			}
+			tools = append(tools, map[string]interface{}{"type": "function", "function": function})
+		}
+		out["tools"] = tools
+	}
+	if c := req.ToolChoice; c != nil {
+		switch c.Type {
+		case "auto", "none":
+			out["tool_choice"] = c.Type
+		case "any":
+			out["tool_choice"] = "required"
+		case "tool":
+			out["tool_choice"] = map[string]interface{}{
+				"type":     "function",
+				"function": map[string]string{"name": c.Name},
+			}
+		default:
+			return nil, fmt.Errorf("tool_choice.type: 不支持的取值 %q", c.Type)
+		}
+	}
+
+	return json.Marshal(out)
+}
+
+// convertMessage 转换一条 Anthropic 消息
+// tool_result 块转换为独立的 tool 消息（排在同一条消息的其他内容之前，紧跟上一条 assistant 的 tool_calls）
+func convertMessage(msg anthropicMessage) ([]openAIMessage, error) {
+	if msg.Role != "user" && msg.Role != "assistant" {
+		return nil, fmt.Errorf("role: 不支持的取值 %q", msg.Role)
+	}
+
+	var text string
+	if err := json.Unmarshal(msg.Content, &text); err == nil {
+		return []openAIMessage{{Role: msg.Role, Content: text}}, nil
+	}
+	var blocks []anthropicBlock
+	if err := json.Unmarshal(msg.Content, &blocks); err != nil {
+		return nil, fmt.Errorf("content 必须是字符串或内容块数组")
+	}
+
+	var result []openAIMessage
+	var parts []map[string]interface{}
+	var toolCalls []openAIToolCall
+	hasImage := false
+
+	for i, block := range blocks {
+		switch block.Type {
+		case "text":
+			parts = append(parts, map[string]interface{}{"type": "text", "text": block.Text})
+		case "image":
+			if block.Source == nil {
+				return nil, fmt.Errorf("content[%d]: image 缺少 source", i)
+			}
+			url := block.Source.URL
+			if block.Source.Type == "base64" {
+				url = "data:" + block.Source.MediaType + ";base64," + block.Source.Data
+			}
+			parts = append(parts, map[string]interface{}{
+				"type":      "image_url",
+				"image_url": map[string]string{"url": url},
+			})
+			hasImage = true
+		case "tool_use":
+			call := openAIToolCall{ID: block.ID, Type: "function"}
+			call.Function.Name = block.Name
+			call.Function.Arguments = "{}"
+			if len(block.Input) > 0 {
+				call.Function.Arguments = string(block.Input)
+			}
+			toolCalls = append(toolCalls, call)
+		case "tool_result":
+			content := ""
+			if len(block.Content) > 0 {
+				c, err := textContent(block.Content)
+				if err != nil {
+					return nil, fmt.Errorf("content[%d]: %w", i, err)
+				}
+				content = c
+			}
+			if block.IsError {
+				content = "Error: " + content
+			}
+			result = append(result, openAIMessage{Role: "tool", ToolCallID: block.ToolUseID, Content: content})
+		default:
+			return nil, fmt.Errorf("content[%d]: 不支持的内容块类型 %q", i, block.Type)
+		}
+	}
+
+	if len(parts) == 0 && len(toolCalls) == 0 {
+		return result, nil
+	}
+
+	converted := openAIMessage{Role: msg.Role, ToolCalls: toolCalls}
+	switch {
+	case hasImage:
+		converted.Content = parts
+	case len(parts) > 0:
+		// 纯文本内容合并为字符串，兼容只接受字符串 content 的后端
+		texts := make([]string, 0, len(parts))
+		for _, p := range parts {
+			texts = append(texts, p["text"].(string))
+		}
+		converted.Content = strings.Join(texts, "\n")
+	default:
+		converted.Content = nil
+	}
+	return append(result, converted), nil
+}
+
+// textContent 提取字符串或文本块数组中的文本（多个块以换行连接）
+func textContent(raw json.RawMessage) (string, error) {
+	var text string
+	if err := json.Unmarshal(raw, &text); err == nil {
+		return text, nil
+	}
+	var blocks []anthropicBlock
+	if err := json.Unmarshal(raw, &blocks); err != nil {
+		return "", fmt.Errorf("必须是字符串或文本块数组")
+	}
+	texts := make([]string, 0, len(blocks))
+	for _, b := range blocks {
+		if b.Type != "text" {
+			return "", fmt.Errorf("不支持的内容块类型 %q", b.Type)
+		}
+		texts = append(texts, b.Text)
+	}
+	return strings.Join(texts, "\n"), nil
+}
+
+// OpenAIToAnthropic 将 OpenAI Chat Completions 非流式响应转换为 Anthropic Messages 响应
+// 参数：
+//   - body: OpenAI 响应体
+//   - model: 请求的模型名（响应中没有 model 时使用）
+//
+// 返回：
+//   - []byte: Anthropic 响应体
+//   - error: 响应体无法解析时返回错误
+func OpenAIToAnthropic(body []byte, model string) ([]byte, error) {
+	var resp openAIResponse
+	if err := json.Unmarshal(body, &resp); err != nil {
+		return nil, fmt.Errorf("解析 OpenAI 响应失败: %w", err)
+	}
+	if len(resp.Choices) == 0 {
+		return nil, fmt.Errorf("OpenAI 响应缺少 choices")
+	}
+	if resp.Model != "" {
+		model = resp.Model
+	}
+
+	choice := resp.Choices[0]
+	out := AnthropicResponse{
+		ID:         messageID(resp.ID),
+		Type:       "message",
+		Role:       "assistant",
+		Model:      model,
+		Content:    []map[string]interface{}{},
+		StopReason: stopReason(choice.FinishReason),
+	}
+	if c := choice.Message.Content; c != nil && *c != "" {
+		out.Content = append(out.Content, map[string]interface{}{"type": "text", "text": *c})
+	}
+	for _, call := range choice.Message.ToolCalls {
+		out.Content = append(out.Content, map[string]interface{}{
+			"type":  "tool_use",
+			"id":    call.ID,
+			"name":  call.Function.Name,
+			"input": toolInput(call.Function.Arguments),
+		})
+	}
+	if resp.Usage != nil {
+		out.Usage = AnthropicResponseUsage{
+			InputTokens:  resp.Usage.PromptTokens,
+			OutputTokens: resp.Usage.CompletionTokens,
+		}
+	}
+
+	return json.Marshal(out)
+}
+
+// ErrorToAnthropic 将后端错误响应转换为 Anthropic 错误格式
+// 参数：
+//   - statusCode: 后端状态码
+//   - body: 后端响应体（OpenAI 错误格式或任意文本）
+//
+// 返回：
+//   - []byte: Anthropic 错误响应体
+func ErrorToAnthropic(statusCode int, body []byte) []byte {
+	message := strings.TrimSpace(string(body))
+	var openAIErr struct {
+		Error struct {
+			Message string `json:"message"`
+		} `json:"error"`
+	}
+	if json.Unmarshal(body, &openAIErr) == nil && openAIErr.Error.Message != "" {
+		message = openAIErr.Error.Message
+	}
+	return AnthropicError(errorType(statusCode), message)
+}
+
+// AnthropicError 生成 Anthropic 格式的错误响应体
+// 参数：
+//   - errType: 错误类型（如 invalid_request_error）
+//   - message: 错误信息
+//
+// 返回：
+//   - []byte: 错误响应体
+func AnthropicError(errType, message string) []byte {
+	data, _ := json.Marshal(map[string]interface{}{
+		"type": "error",
+		"error": map[string]string{
+			"type":    errType,
+			"message": message,
+		},
+	})
+	return data
+}
+
+// errorType 按状态码映射 Anthropic 错误类型
+func errorType(statusCode int) string {
+	switch statusCode {
+	case 400:
+		return "invalid_request_error"
+	case 401:
+		return "authentication_error"
+	case 403:
+		return "permission_error"
+	case 404:
+		return "not_found_error"
+	case 413:
+		return "request_too_large"
+	case 429:
+		return "rate_limit_error"
+	case 529:
+		return "overloaded_error"
+	default:
+		return "api_error"
+	}
+}
+
+// stopReason 映射 OpenAI finish_reason 到 Anthropic stop_reason
+func stopReason(finishReason string) string {
+	switch finishReason {
+	case "length":
+		return "max_tokens"
+	case "tool_calls", "function_call":
+		return "tool_use"
+	case "content_filter":
+		return "refusal"
+	default:
+		return "end_turn"
+	}
+}
+
+// messageID 生成 Anthropic 风格的消息 ID
+func messageID(id string) string {
+	if strings.HasPrefix(id, "msg_") {
+		return id
+	}
+	return "msg_" + strings.TrimPrefix(id, "chatcmpl-")
+}
+
+// toolInput 解析工具调用参数（无法解析时原样作为字符串字段保留）
+func toolInput(arguments string) interface{} {
+	if strings.TrimSpace(arguments) == "" {
+		return map[string]interface{}{}
+	}
+	var input interface{}
+	if err := json.Unmarshal([]byte(arguments), &input); err != nil {
+		return map[string]interface{}{"arguments": arguments}
+	}
+	return input
+}
@@ -0,0 +1,220 @@
+package translate
+
+import (
+	"bytes"
+	"encoding/json"
+)
+
+// AnthropicStream 将 OpenAI Chat Completions SSE 流转换为 Anthropic Messages SSE 事件流
+// 输入可以按任意边界分块写入（不完整的行会缓存到下一次写入），非并发安全
+type AnthropicStream struct {
+	model   string
+	pending []byte // 未处理完的不完整行
+
+	started    bool
+	finished   bool
+	blockIndex int    // 当前内容块索引（-1 表示没有打开的内容块）
+	blockType  string // 当前内容块类型：text / tool_use
+	toolIndex  int    // 当前 tool_use 块对应的 OpenAI tool_calls 索引
+	nextIndex  int    // 下一个内容块的索引
+	stopReason string
+	usage      AnthropicResponseUsage
+}
+
+// openAIChunk OpenAI 流式响应块
+type openAIChunk struct {
+	ID      string `json:"id"`
+	Model   string `json:"model"`
+	Choices []struct {
+		Delta struct {
+			Content   string           `json:"content"`
+			ToolCalls []openAIToolCall `json:"tool_calls"`
+		} `json:"delta"`
+		FinishReason *string `json:"finish_reason"`
+	} `json:"choices"`
+	Usage *openAIUsage `json:"usage"`
+}
+
+// NewAnthropicStream 创建流式转换器
+// 参数：
+//   - model: 请求的模型名（上游响应块中没有 model 时使用）
+//
+// 返回：
+//   - *AnthropicStream: 转换器实例
+func NewAnthropicStream(model string) *AnthropicStream {
+	return &AnthropicStream{model: model, blockIndex: -1}
+}
+
+// Write 写入一段 OpenAI SSE 数据，返回转换后的 Anthropic SSE 数据（可能为空）
+// 参数：
+//   - p: OpenAI SSE 数据
+//
+// 返回：
+//   - []byte: Anthropic SSE 数据
+func (s *AnthropicStream) Write(p []byte) []byte {
+	var out bytes.Buffer
+	s.pending = append(s.pending, p...)
+	for {
+		i := bytes.IndexByte(s.pending, '\n')
+		if i < 0 {
+			break
+		}
+		line := bytes.TrimRight(s.pending[:i], "\r")
+		s.pending = s.pending[i+1:]
+		s.handleLine(&out, line)
+	}
+	return out.Bytes()
+}
+
+// Finish 结束转换：处理缓存的最后一行，上游未发送 [DONE] 时补齐结束事件
+// 返回：
+//   - []byte: Anthropic SSE 数据
+func (s *AnthropicStream) Finish() []byte {
+	var out bytes.Buffer
+	if len(s.pending) > 0 {
+		s.handleLine(&out, bytes.TrimRight(s.pending, "\r"))
+		s.pending = nil
+	}
+	s.finish(&out)
+	return out.Bytes()
+}
+
+// handleLine 处理一行 SSE 数据（只关心 data 行）
+func (s *AnthropicStream) handleLine(out *bytes.Buffer, line []byte) {
+	if s.finished || !bytes.HasPrefix(line, []byte("data:")) {
+		return
+	}
+	data := bytes.TrimSpace(line[len("data:"):])
+	if string(data) == "[DONE]" {
+		s.finish(out)
+		return
+	}
+
+	var chunk openAIChunk
+	if err := json.Unmarshal(data, &chunk); err != nil {
+		return
+	}
+	if !s.started {
+		s.start(out, chunk.ID, chunk.Model)
+	}
+	if chunk.Usage != nil {
+		s.usage.InputTokens = chunk.Usage.PromptTokens
+		s.usage.OutputTokens = chunk.Usage.CompletionTokens
+	}
+
+	for _, choice := range chunk.Choices {
+		if choice.Delta.Content != "" {
+			if s.blockType != "text" {
+				s.openBlock(out, "text", map[string]interface{}{"type": "text", "text": ""})
+			}
+			s.emit(out, "content_block_delta", map[string]interface{}{
+				"type":  "content_block_delta",
+				"index": s.blockIndex,
+				"delta": map[string]string{"type": "text_delta", "text": choice.Delta.Content},
+			})
+		}
+
+		for _, call := range choice.Delta.ToolCalls {
+			index := 0
+			if call.Index != nil {
+				index = *call.Index
+			}
+			// 带 id 的增量表示新的工具调用
+			if call.ID != "" || s.blockType != "tool_use" {
+				s.openBlock(out, "tool_use", map[string]interface{}{
+					"type":  "tool_use",
+					"id":    call.ID,
+					"name":  call.Function.Name,
+					"input": map[string]interface{}{},
+				})
+				s.toolIndex = index
+			}
+			if call.Function.Arguments != "" && index == s.toolIndex {
+				s.emit(out, "content_block_delta", map[string]interface{}{
+					"type":  "content_block_delta",
+					"index": s.blockIndex,
+					"delta": map[string]string{"type": "input_json_delta", "partial_json": call.Function.Arguments},
+				})
+			}
+		}
+
+		if choice.FinishReason != nil && *choice.FinishReason != "" {
+			s.stopReason = stopReason(*choice.FinishReason)
+		}
+	}
+}
+
+// start 发送 message_start 事件
+func (s *AnthropicStream) start(out *bytes.Buffer, id, model string) {
+	s.started = true
+	if model == "" {
+		model = s.model
+	}
+	s.emit(out, "message_start", map[string]interface{}{
+		"type": "message_start",
+		"message": map[string]interface{}{
+			"id":            messageID(id),
+			"type":          "message",
+			"role":          "assistant",
+			"model":         model,
+			"content":       []interface{}{},
+			"stop_reason":   nil, // 在 message_delta 中给出
+			"stop_sequence": nil,
+			"usage":         AnthropicResponseUsage{},
+		},
+	})
+}
+
+// openBlock 关闭当前内容块并打开新的内容块
+func (s *AnthropicStream) openBlock(out *bytes.Buffer, blockType string, block map[string]interface{}) {
+	s.closeBlock(out)
+	s.blockIndex = s.nextIndex
+	s.nextIndex++
+	s.blockType = blockType
+	s.emit(out, "content_block_start", map[string]interface{}{
+		"type":          "content_block_start",
+		"index":         s.blockIndex,
+		"content_block": block,
+	})
+}
+
+// closeBlock 关闭当前内容块
+func (s *AnthropicStream) closeBlock(out *bytes.Buffer) {
+	if s.blockIndex < 0 {
+		return
+	}
+	s.emit(out, "content_block_stop", map[string]interface{}{
+		"type":  "content_block_stop",
+		"index": s.blockIndex,
+	})
+	s.blockIndex = -1
+	s.blockType = ""
+}
+
+// finish 发送结束事件（只发送一次；上游没有返回任何数据时不发送）
+func (s *AnthropicStream) finish(out *bytes.Buffer) {
+	if s.finished || !s.started {
+		return
+	}
+	s.finished = true
+	s.closeBlock(out)
+	if s.stopReason == "" {
+		s.stopReason = "end_turn"
+	}
+	s.emit(out, "message_delta", map[string]interface{}{
+		"type":  "message_delta",
+		"delta": map[string]interface{}{"stop_reason": s.stopReason, "stop_sequence": nil},
+		"usage": s.usage,
+	})
+	s.emit(out, "message_stop", map[string]string{"type": "message_stop"})
+}
+
+// emit 写入一个 SSE 事件
+func (s *AnthropicStream) emit(out *bytes.Buffer, event string, data interface{}) {
+	payload, _ := json.Marshal(data)
+	out.WriteString("event: ")
+	out.WriteString(event)
+	out.WriteString("\ndata: ")
+	out.Write(payload)
+	out.WriteString("\n\n")
+}
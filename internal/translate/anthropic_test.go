@@ -0,0 +1,185 @@
+package translate
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// readTestdata 读取 testdata 下的录制数据
+func readTestdata(t *testing.T, name string) []byte {
+	t.Helper()
+	data, err := os.ReadFile(filepath.Join("testdata", name))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return data
+}
+
+// assertJSONEqual 按 JSON 语义比较（忽略字段顺序和空白）
+func assertJSONEqual(t *testing.T, got, want []byte) {
+	t.Helper()
+	var g, w interface{}
+	if err := json.Unmarshal(got, &g); err != nil {
+		t.Fatalf("got is not JSON: %v\n%s", err, got)
+	}
+	if err := json.Unmarshal(want, &w); err != nil {
+		t.Fatalf("want is not JSON: %v", err)
+	}
+	if !reflect.DeepEqual(g, w) {
+		t.Errorf("JSON mismatch\n got: %s\nwant: %s", got, want)
+	}
+}
+
+func TestAnthropicToOpenAIRecorded(t *testing.T) {
+	got, err := AnthropicToOpenAI(readTestdata(t, "anthropic_request.json"))
+	if err != nil {
+		t.Fatalf("AnthropicToOpenAI() error = %v", err)
+	}
+	assertJSONEqual(t, got, readTestdata(t, "openai_request.json"))
+}
+
+func TestAnthropicToOpenAI(t *testing.T) {
+	tests := []struct {
+		name string
+		body string
+		want string
+	}{
+		{
+			"流式请求附加 include_usage",
+			`{"model":"m","max_tokens":10,"stream":true,"messages":[{"role":"user","content":"hi"}]}`,
+			`{"model":"m","max_tokens":10,"stream":true,"stream_options":{"include_usage":true},"messages":[{"role":"user","content":"hi"}]}`,
+		},
+		{
+			"字符串 system 和指定工具",
+			`{"model":"m","system":"be nice","tool_choice":{"type":"tool","name":"f"},"messages":[{"role":"user","content":"hi"}]}`,
+			`{"model":"m","tool_choice":{"type":"function","function":{"name":"f"}},"messages":[{"role":"system","content":"be nice"},{"role":"user","content":"hi"}]}`,
+		},
+		{
+			"工具返回错误",
+			`{"model":"m","messages":[{"role":"user","content":[{"type":"tool_result","tool_use_id":"t1","content":"boom","is_error":true}]}]}`,
+			`{"model":"m","messages":[{"role":"tool","tool_call_id":"t1","content":"Error: boom"}]}`,
+		},
+		{
+			"只有工具调用的 assistant 消息",
+			`{"model":"m","messages":[{"role":"assistant","content":[{"type":"tool_use","id":"t1","name":"f"}]}]}`,
+			`{"model":"m","messages":[{"role":"assistant","content":null,"tool_calls":[{"id":"t1","type":"function","function":{"name":"f","arguments":"{}"}}]}]}`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := AnthropicToOpenAI([]byte(tt.body))
+			if err != nil {
+				t.Fatalf("error = %v", err)
+			}
+			assertJSONEqual(t, got, []byte(tt.want))
+		})
+	}
+}
+
+func TestAnthropicToOpenAIErrors(t *testing.T) {
+	tests := []struct {
+		name string
+		body string
+	}{
+		{"不是 JSON", `{`},
+		{"缺少 model", `{"messages":[{"role":"user","content":"hi"}]}`},
+		{"缺少 messages", `{"model":"m"}`},
+		{"不支持的角色", `{"model":"m","messages":[{"role":"system","content":"hi"}]}`},
+		{"不支持的内容块", `{"model":"m","messages":[{"role":"user","content":[{"type":"document"}]}]}`},
+		{"图片缺少 source", `{"model":"m","messages":[{"role":"user","content":[{"type":"image"}]}]}`},
+		{"不支持的 tool_choice", `{"model":"m","tool_choice":{"type":"maybe"},"messages":[{"role":"user","content":"hi"}]}`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := AnthropicToOpenAI([]byte(tt.body)); err == nil {
+				t.Error("error = nil")
+			}
+		})
+	}
+}
+
+func TestOpenAIToAnthropicRecorded(t *testing.T) {
+	got, err := OpenAIToAnthropic(readTestdata(t, "openai_response.json"), "claude-3-5-sonnet-20241022")
+	if err != nil {
+		t.Fatalf("OpenAIToAnthropic() error = %v", err)
+	}
+	assertJSONEqual(t, got, readTestdata(t, "anthropic_response.json"))
+}
+
+func TestOpenAIToAnthropic(t *testing.T) {
+	// 响应没有 model 时使用请求的模型；length 映射为 max_tokens
+	got, err := OpenAIToAnthropic([]byte(`{"id":"chatcmpl-1","choices":[{"message":{"content":"hi"},"finish_reason":"length"}]}`), "claude")
+	if err != nil {
+		t.Fatal(err)
+	}
+	assertJSONEqual(t, got, []byte(`{"id":"msg_1","type":"message","role":"assistant","model":"claude",
+		"content":[{"type":"text","text":"hi"}],"stop_reason":"max_tokens","stop_sequence":null,
+		"usage":{"input_tokens":0,"output_tokens":0}}`))
+
+	if _, err := OpenAIToAnthropic([]byte(`{"choices":[]}`), "m"); err == nil {
+		t.Error("empty choices: error = nil")
+	}
+}
+
+func TestErrorToAnthropic(t *testing.T) {
+	got := ErrorToAnthropic(429, []byte(`{"error":{"message":"slow down","type":"rate_limit"}}`))
+	assertJSONEqual(t, got, []byte(`{"type":"error","error":{"type":"rate_limit_error","message":"slow down"}}`))
+
+	got = ErrorToAnthropic(502, []byte("bad gateway\n"))
+	assertJSONEqual(t, got, []byte(`{"type":"error","error":{"type":"api_error","message":"bad gateway"}}`))
+}
+
+func TestAnthropicStreamRecorded(t *testing.T) {
+	input := readTestdata(t, "openai_stream.txt")
+	want := string(readTestdata(t, "anthropic_stream.txt"))
+
+	// 一次写入
+	s := NewAnthropicStream("claude")
+	got := string(s.Write(input)) + string(s.Finish())
+	if got != want {
+		t.Errorf("stream output mismatch\n got:\n%s\nwant:\n%s", got, want)
+	}
+
+	// 按字节分块写入，结果相同
+	s = NewAnthropicStream("claude")
+	var out strings.Builder
+	for i := range input {
+		out.Write(s.Write(input[i : i+1]))
+	}
+	out.Write(s.Finish())
+	if out.String() != want {
+		t.Errorf("byte-by-byte output mismatch\n got:\n%s", out.String())
+	}
+}
+
+func TestAnthropicStreamWithoutDone(t *testing.T) {
+	// 上游未发送 [DONE] 且最后一行没有换行：Finish 补齐结束事件
+	s := NewAnthropicStream("claude")
+	out := string(s.Write([]byte("data: {\"id\":\"x\",\"choices\":[{\"delta\":{\"content\":\"hi\"}}]}")))
+	if out != "" {
+		t.Fatalf("incomplete line produced output: %q", out)
+	}
+	out = string(s.Finish())
+	for _, want := range []string{
+		`"model":"claude"`,
+		`"text":"hi"`,
+		`"stop_reason":"end_turn"`,
+		"event: message_stop",
+	} {
+		if !strings.Contains(out, want) {
+			t.Errorf("output missing %s:\n%s", want, out)
+		}
+	}
+	if extra := s.Finish(); len(extra) != 0 {
+		t.Errorf("second Finish() = %q, want empty", extra)
+	}
+
+	// 上游没有返回任何数据时不发送事件
+	if out := NewAnthropicStream("claude").Finish(); len(out) != 0 {
+		t.Errorf("empty stream Finish() = %q", out)
+	}
+}
@@ -0,0 +1,35 @@
+package types
+
+import "context"
+
+// Identity 鉴权通过后解析出的调用方身份
+// 由鉴权中间件写入请求上下文，代理处理器、限流和模型白名单检查直接读取，无需再次查询 Key 存储
+type Identity struct {
+	APIKey        string                 // 请求携带的 API Key
+	UserID        string                 // 用户 ID（元数据 user_id）
+	Name          string                 // Key 名称（元数据 name）
+	RateTier      string                 // 限流等级（元数据 rate_tier）
+	AllowedModels []string               // 允许使用的模型（元数据 allowed_models，为空表示不限制）
+	Provider      string                 // 做出放行决策的 Provider
+	Metadata      map[string]interface{} // 完整的鉴权元数据（只读）
+}
+
+// identityContextKey 请求上下文中调用方身份的键
+type identityContextKey struct{}
+
+// WithIdentity 在上下文中写入调用方身份
+// 参数：
+//   - ctx: 请求上下文
+//   - identity: 调用方身份
+//
+// 返回：
+//   - context.Context: 新的上下文
+func WithIdentity(ctx context.Context, identity *Identity) context.Context {
+	return context.WithValue(ctx, identityContextKey{}, identity)
+}
+
+// IdentityFromContext 从上下文读取调用方身份（未经过鉴权管道时返回 nil）
+func IdentityFromContext(ctx context.Context) *Identity {
+	identity, _ := ctx.Value(identityContextKey{}).(*Identity)
+	return identity
+}
@@ -1,9 +1,35 @@
 package utils
 
 import (
+	"net/http"
 	"strings"
+
+	"llmproxy/internal/config"
 )
 
+// Version 版本号（构建时可通过 -ldflags "-X llmproxy/internal/utils.Version=x.y.z" 设置）
+var Version = "dev"
+
+// viaPseudonym Via 请求头中的代理名称
+const viaPseudonym = "llmproxy"
+
+// StampUpstreamHeaders 按配置设置发往后端的 User-Agent 和 Via 请求头
+// 参数：
+//   - h: 上游请求头（已从客户端请求复制）
+//   - cfg: 上游请求头配置（为 nil 时不修改）
+func StampUpstreamHeaders(h http.Header, cfg *config.UpstreamConfig) {
+	if cfg == nil {
+		return
+	}
+	if cfg.UserAgent != "" {
+		h.Set("User-Agent", strings.ReplaceAll(cfg.UserAgent, "{version}", Version))
+	}
+	if cfg.Via {
+		// 按 RFC 9110 追加到已有的 Via 之后
+		h.Add("Via", "1.1 "+viaPseudonym)
+	}
+}
+
 // ExtractAPIKey 从请求中提取 API Key
 // 支持两种方式：
 // 1. Authorization: Bearer sk-xxx
@@ -31,38 +57,75 @@ func ExtractAPIKey(authHeader, apiKeyHeader string) string {
 	return ""
 }
 
+// defaultAPIKeyHeaders 未配置 header_names 时依次尝试的 Header
+var defaultAPIKeyHeaders = []string{"Authorization", "X-API-Key", "Api-Key"}
+
+// APIKeySource API Key 的提取方式
+type APIKeySource struct {
+	HeaderNames []string // 依次尝试的 Header（为空时使用 Authorization / X-API-Key / Api-Key）
+	Scheme      string   // Authorization 头的认证方案（默认 Bearer，大小写不敏感）
+	QueryParam  string   // 查询参数名（为空时不从 URL 读取，所有 Header 都没有 Key 时才尝试）
+}
+
 // ExtractAPIKeyFromHeaders 从请求 Header 中提取 API Key（支持自定义 Header）
 // 按照 headerNames 的顺序依次尝试提取，找到第一个非空值即返回
 // 参数：
 //   - headers: HTTP 请求头
-//   - headerNames: 自定义 Header 名称列表，为空时使用默认值 ["Authorization", "X-API-Key"]
+//   - headerNames: 自定义 Header 名称列表，为空时使用默认值 ["Authorization", "X-API-Key", "Api-Key"]
 //
 // 返回：
 //   - string: API Key
 func ExtractAPIKeyFromHeaders(headers map[string][]string, headerNames []string) string {
+	return extractAPIKeyFromHeaders(http.Header(headers), headerNames, "")
+}
+
+// ExtractAPIKeyFromRequest 按提取方式从请求中提取 API Key
+// 先按顺序尝试 Header，再尝试查询参数
+// 参数：
+//   - r: HTTP 请求
+//   - src: 提取方式（为 nil 时使用默认 Header 和 Bearer 方案）
+//
+// 返回：
+//   - string: API Key
+func ExtractAPIKeyFromRequest(r *http.Request, src *APIKeySource) string {
+	if src == nil {
+		src = &APIKeySource{}
+	}
+	if key := extractAPIKeyFromHeaders(r.Header, src.HeaderNames, src.Scheme); key != "" {
+		return key
+	}
+	if src.QueryParam != "" {
+		return r.URL.Query().Get(src.QueryParam)
+	}
+	return ""
+}
+
+// extractAPIKeyFromHeaders 按顺序从 Header 中提取 API Key
+// Authorization 头需带认证方案前缀（如 "Bearer sk-xxx"），其他 Header 直接取值
+func extractAPIKeyFromHeaders(headers http.Header, headerNames []string, scheme string) string {
 	// 使用默认 Header 名称
 	if len(headerNames) == 0 {
-		headerNames = []string{"Authorization", "X-API-Key"}
+		headerNames = defaultAPIKeyHeaders
+	}
+	if scheme == "" {
+		scheme = "Bearer"
 	}
 
-	// 按顺序尝试提取
+	// 按顺序尝试提取（Header 名称大小写不敏感）
 	for _, name := range headerNames {
-		values, ok := headers[name]
-		if !ok || len(values) == 0 {
-			continue
-		}
-
-		value := values[0]
+		value := headers.Get(name)
 		if value == "" {
 			continue
 		}
 
-		// Authorization Header 特殊处理：提取 Bearer token
-		if name == "Authorization" {
-			if strings.HasPrefix(value, "Bearer ") {
-				return strings.TrimPrefix(value, "Bearer ")
+		// Authorization Header 特殊处理：提取认证方案之后的 token
+		if strings.EqualFold(name, "Authorization") {
+			if len(value) > len(scheme) && strings.EqualFold(value[:len(scheme)], scheme) && value[len(scheme)] == ' ' {
+				if token := strings.TrimSpace(value[len(scheme)+1:]); token != "" {
+					return token
+				}
 			}
-			// 如果不是 Bearer 格式，继续尝试下一个 Header
+			// 如果不是该认证方案，继续尝试下一个 Header
 			continue
 		}
 
@@ -0,0 +1,57 @@
+package utils
+
+import (
+	"net/http/httptest"
+	"testing"
+)
+
+func TestExtractAPIKeyFromRequest(t *testing.T) {
+	tests := []struct {
+		name    string
+		url     string
+		headers map[string]string
+		src     *APIKeySource
+		want    string
+	}{
+		{"Authorization Bearer", "/v1/models", map[string]string{"Authorization": "Bearer sk-bearer"}, nil, "sk-bearer"},
+		{"Bearer 大小写不敏感", "/v1/models", map[string]string{"Authorization": "bearer sk-bearer"}, nil, "sk-bearer"},
+		{"X-API-Key", "/v1/models", map[string]string{"X-API-Key": "sk-x-api"}, nil, "sk-x-api"},
+		{"Api-Key", "/v1/models", map[string]string{"Api-Key": "sk-azure"}, nil, "sk-azure"},
+		{"Authorization 优先于 X-API-Key", "/v1/models", map[string]string{"Authorization": "Bearer sk-bearer", "X-API-Key": "sk-x-api"}, nil, "sk-bearer"},
+		{"非 Bearer 的 Authorization 回退到下一个 Header", "/v1/models", map[string]string{"Authorization": "Basic dXNlcg==", "X-API-Key": "sk-x-api"}, nil, "sk-x-api"},
+		{"Bearer 后为空", "/v1/models", map[string]string{"Authorization": "Bearer  "}, nil, ""},
+		{"默认不读取查询参数", "/v1/models?api_key=sk-query", nil, nil, ""},
+		{"查询参数", "/v1/models?api_key=sk-query", nil, &APIKeySource{QueryParam: "api_key"}, "sk-query"},
+		{"Header 优先于查询参数", "/v1/models?api_key=sk-query", map[string]string{"X-API-Key": "sk-x-api"}, &APIKeySource{QueryParam: "api_key"}, "sk-x-api"},
+		{"自定义认证方案", "/v1/models", map[string]string{"Authorization": "Token sk-token"}, &APIKeySource{Scheme: "Token"}, "sk-token"},
+		{"自定义认证方案不接受 Bearer", "/v1/models", map[string]string{"Authorization": "Bearer sk-bearer"}, &APIKeySource{Scheme: "Token"}, ""},
+		{"认证方案需以空格分隔", "/v1/models", map[string]string{"Authorization": "Tokensk-token"}, &APIKeySource{Scheme: "Token"}, ""},
+		{"自定义 Header", "/v1/models", map[string]string{"X-Custom-Key": "sk-custom"}, &APIKeySource{HeaderNames: []string{"X-Custom-Key"}}, "sk-custom"},
+		{"自定义 Header 名称大小写不敏感", "/v1/models", map[string]string{"X-Custom-Key": "sk-custom"}, &APIKeySource{HeaderNames: []string{"x-custom-key"}}, "sk-custom"},
+		{"自定义 Header 列表不含默认 Header", "/v1/models", map[string]string{"X-API-Key": "sk-x-api"}, &APIKeySource{HeaderNames: []string{"X-Custom-Key"}}, ""},
+		{"自定义 Header 按顺序尝试", "/v1/models", map[string]string{"X-First": "sk-first", "X-Second": "sk-second"}, &APIKeySource{HeaderNames: []string{"X-Second", "X-First"}}, "sk-second"},
+		{"没有 Key", "/v1/models", nil, nil, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest("POST", tt.url, nil)
+			for k, v := range tt.headers {
+				r.Header.Set(k, v)
+			}
+			if got := ExtractAPIKeyFromRequest(r, tt.src); got != tt.want {
+				t.Errorf("ExtractAPIKeyFromRequest() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestExtractAPIKeyFromHeaders(t *testing.T) {
+	// 旧接口：map 形式的 Header，使用默认 Bearer 方案
+	headers := map[string][]string{"Authorization": {"Bearer sk-bearer"}, "Api-Key": {"sk-azure"}}
+	if got := ExtractAPIKeyFromHeaders(headers, nil); got != "sk-bearer" {
+		t.Errorf("ExtractAPIKeyFromHeaders(default) = %q, want sk-bearer", got)
+	}
+	if got := ExtractAPIKeyFromHeaders(headers, []string{"Api-Key"}); got != "sk-azure" {
+		t.Errorf("ExtractAPIKeyFromHeaders(Api-Key) = %q, want sk-azure", got)
+	}
+}
@@ -0,0 +1,51 @@
+package utils
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// Webhook 签名请求头
+const (
+	SignatureHeader = "X-LLMProxy-Signature" // 默认签名请求头
+	TimestampHeader = "X-LLMProxy-Timestamp" // 签名时间戳（Unix 秒）
+)
+
+// SignBody 计算 Webhook 请求体的 HMAC-SHA256 签名
+// 签名内容为 "<timestamp>.<body>"，时间戳参与签名，接收方校验时间戳与当前时间的差值即可拒绝重放的旧请求
+// 参数：
+//   - secret: 签名密钥
+//   - timestamp: 时间戳（Unix 秒）
+//   - body: 请求体
+//
+// 返回：
+//   - string: 签名（格式为 sha256=<十六进制>）
+func SignBody(secret, timestamp string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	_, _ = mac.Write([]byte(timestamp))
+	_, _ = mac.Write([]byte("."))
+	_, _ = mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// SignRequest 为 Webhook 请求设置时间戳和签名请求头（secret 为空时不做任何修改）
+// 参数：
+//   - req: HTTP 请求
+//   - body: 请求体
+//   - secret: 签名密钥
+//   - header: 签名请求头名（为空时使用 X-LLMProxy-Signature）
+func SignRequest(req *http.Request, body []byte, secret, header string) {
+	if secret == "" {
+		return
+	}
+	if header == "" {
+		header = SignatureHeader
+	}
+	timestamp := strconv.FormatInt(time.Now().Unix(), 10)
+	req.Header.Set(TimestampHeader, timestamp)
+	req.Header.Set(header, SignBody(secret, timestamp, body))
+}
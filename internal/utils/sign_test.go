@@ -0,0 +1,37 @@
+package utils
+
+import (
+	"net/http/httptest"
+	"testing"
+)
+
+func TestSignBody(t *testing.T) {
+	// echo -n '1700000000.{"a":1}' | openssl dgst -sha256 -hmac secret
+	const want = "sha256=49f24e537407743fa4a0242bb63b94b9a47ee99cbbe071ccd8a22550ae411686"
+	if got := SignBody("secret", "1700000000", []byte(`{"a":1}`)); got != want {
+		t.Errorf("SignBody() = %q, want %q", got, want)
+	}
+}
+
+func TestSignRequest(t *testing.T) {
+	body := []byte(`{"a":1}`)
+
+	req := httptest.NewRequest("POST", "/", nil)
+	SignRequest(req, body, "", "")
+	if len(req.Header) != 0 {
+		t.Errorf("empty secret set headers: %v", req.Header)
+	}
+
+	req = httptest.NewRequest("POST", "/", nil)
+	SignRequest(req, body, "secret", "X-Custom-Signature")
+	timestamp := req.Header.Get(TimestampHeader)
+	if timestamp == "" {
+		t.Fatal("missing timestamp header")
+	}
+	if got := req.Header.Get("X-Custom-Signature"); got != SignBody("secret", timestamp, body) {
+		t.Errorf("signature = %q", got)
+	}
+	if req.Header.Get(SignatureHeader) != "" {
+		t.Error("default signature header set alongside custom header")
+	}
+}